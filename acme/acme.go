@@ -0,0 +1,237 @@
+/*
+Package acme provides an updater which obtains and renews certificates from an ACME server, such as Let's Encrypt,
+for ingress hosts which request one.
+*/
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/util"
+	xacme "golang.org/x/crypto/acme"
+)
+
+// LetsEncryptDirectoryURL is the directory of the Let's Encrypt production server.
+const LetsEncryptDirectoryURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// ChallengePath is the path which http-01 challenge responses must be served on.
+const ChallengePath = "/.well-known/acme-challenge/"
+
+const (
+	accountKeyFile      = "account.key"
+	checkInterval       = time.Hour * 12
+	orderTimeout        = time.Minute * 5
+	dnsPropagationDelay = time.Minute
+)
+
+// Config for the ACME updater.
+type Config struct {
+	// DirectoryURL of the ACME server.
+	DirectoryURL string
+	// Email to register the account with, for expiry notices.
+	Email string
+	// StateDir holds the account key, and should persist across restarts to avoid rate limits.
+	StateDir string
+	// ChallengeDir is where http-01 challenge responses are written, for nginx to serve on ChallengePath.
+	ChallengeDir string
+	// Route53HostedZone, if set, is the hosted zone dns-01 challenge records are created in, instead of
+	// solving http-01 challenges. This allows certificates for wildcard hosts.
+	Route53HostedZone string
+	// Route53Backoff configures how failed calls to Route53 are retried.
+	Route53Backoff r53.Backoff
+	// CertificatesDir is where certificates are written, as <host>.crt and <host>.key, with a wildcard
+	// written as _wildcard.
+	CertificatesDir string
+	// RenewBefore is how long before expiry certificates are renewed.
+	RenewBefore time.Duration
+}
+
+// New creates an updater which obtains certificates for ingress entries with ACME enabled.
+func New(conf Config) (controller.Updater, error) {
+	if conf.CertificatesDir == "" {
+		return nil, errors.New("unable to create ACME updater: missing certificates directory")
+	}
+	if conf.ChallengeDir == "" {
+		return nil, errors.New("unable to create ACME updater: missing challenge directory")
+	}
+	initMetrics()
+
+	var s solver = &http01Solver{dir: conf.ChallengeDir}
+	if conf.Route53HostedZone != "" {
+		s = &dns01Solver{r53: r53.New(conf.Route53HostedZone, conf.Route53Backoff), propagationDelay: dnsPropagationDelay}
+	}
+
+	return &acme{
+		Config: conf,
+		client: &client{
+			acme:   &xacme.Client{DirectoryURL: conf.DirectoryURL, HTTPClient: &http.Client{Timeout: time.Second * 30}},
+			email:  conf.Email,
+			solver: s,
+		},
+		updateCh: make(chan struct{}, 1),
+		doneCh:   make(chan struct{}),
+	}, nil
+}
+
+type acme struct {
+	Config
+	client   *client
+	updateCh chan struct{}
+	doneCh   chan struct{}
+	sync.Mutex
+	hosts []string
+}
+
+func (a *acme) Start() error {
+	for _, dir := range []string{a.StateDir, a.ChallengeDir, a.CertificatesDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("unable to create %s: %v", dir, err)
+		}
+	}
+	key, err := loadAccountKey(filepath.Join(a.StateDir, accountKeyFile))
+	if err != nil {
+		return fmt.Errorf("unable to load ACME account key: %v", err)
+	}
+	a.client.acme.Key = key
+
+	go a.periodicallyCheckCertificates()
+	return nil
+}
+
+func (a *acme) Stop() error {
+	close(a.doneCh)
+	return nil
+}
+
+func (a *acme) Health() error {
+	return nil
+}
+
+func (a *acme) Readiness() error {
+	return nil
+}
+
+// Update records the hosts needing certificates, which are obtained in the background as they can take minutes.
+// It returns an error for wildcard hosts if the challenge type can't validate them, after recording the others.
+func (a *acme) Update(entries controller.IngressEntries) error {
+	hosts, wildcards := acmeHosts(entries, a.client.solver.supportsWildcards())
+
+	a.Lock()
+	a.hosts = hosts
+	a.Unlock()
+
+	select {
+	case a.updateCh <- struct{}{}:
+	default:
+	}
+
+	if len(wildcards) > 0 {
+		return fmt.Errorf("unable to obtain certificates for wildcard hosts %v with %s challenges, "+
+			"which need dns-01", wildcards, a.client.solver.challengeType())
+	}
+	return nil
+}
+
+func (a *acme) String() string {
+	return "ACME certificate issuer"
+}
+
+// acmeHosts returns the unique hosts with ACME enabled, and separately the wildcard hosts if they aren't supported.
+func acmeHosts(entries controller.IngressEntries, wildcardsSupported bool) ([]string, []string) {
+	unique := make(map[string]bool)
+	unsupported := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.ACME {
+			continue
+		}
+		host := strings.ToLower(entry.Host)
+		if strings.HasPrefix(host, "*") && !wildcardsSupported {
+			unsupported[host] = true
+			continue
+		}
+		unique[host] = true
+	}
+	return sortedKeys(unique), sortedKeys(unsupported)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (a *acme) periodicallyCheckCertificates() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.doneCh:
+			return
+		case <-a.updateCh:
+		case <-ticker.C:
+		}
+		a.checkCertificates(time.Now())
+	}
+}
+
+func (a *acme) checkCertificates(now time.Time) {
+	a.Lock()
+	hosts := a.hosts
+	a.Unlock()
+
+	for _, host := range hosts {
+		if !a.renewalRequired(host, now) {
+			continue
+		}
+		log.Infof("Obtaining certificate for %s from %s", host, a.DirectoryURL)
+		if err := a.obtainCertificate(host); err != nil {
+			certificateFailures.Inc()
+			log.Errorf("Unable to obtain certificate for %s: %v", host, err)
+			continue
+		}
+		certificatesIssued.Inc()
+		log.Infof("Obtained certificate for %s", host)
+	}
+}
+
+// renewalRequired is true if the host has no certificate, or it expires within RenewBefore.
+func (a *acme) renewalRequired(host string, now time.Time) bool {
+	return util.CertificateExpiresBefore(a.certificatePath(host)+".crt", now.Add(a.RenewBefore))
+}
+
+// certificatePath is the path of the host's certificate and key, without extension.
+func (a *acme) certificatePath(host string) string {
+	return filepath.Join(a.CertificatesDir, strings.Replace(host, "*", "_wildcard", 1))
+}
+
+func (a *acme) obtainCertificate(host string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), orderTimeout)
+	defer cancel()
+
+	chain, key, err := a.client.obtainCertificate(ctx, host)
+	if err != nil {
+		return err
+	}
+
+	// write the key first, as the certificate is only loaded once it has a matching key
+	path := a.certificatePath(host)
+	if err := util.WriteFileAtomically(path+".key", key, 0600); err != nil {
+		return err
+	}
+	return util.WriteFileAtomically(path+".crt", chain, 0644)
+}
@@ -0,0 +1,21 @@
+package acme
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+var once sync.Once
+var certificatesIssued prometheus.Counter
+var certificateFailures prometheus.Counter
+
+func initMetrics() {
+	once.Do(func() {
+		certificatesIssued = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"acme_certificates_issued", "The number of certificates issued by the ACME server")
+		certificateFailures = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"acme_certificate_failures", "The number of failed attempts to obtain a certificate from the ACME server")
+	})
+}
@@ -0,0 +1,315 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+	xacme "golang.org/x/crypto/acme"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const token = "challenge-token"
+
+// fakeACMEServer speaks enough RFC 8555 to issue a certificate, once the challenge response is found in
+// challengeDir for http-01 or in r53 for dns-01.
+type fakeACMEServer struct {
+	*httptest.Server
+	t            *testing.T
+	challengeDir string
+	r53          *fakeR53
+	sync.Mutex
+	domain      string
+	validated   bool
+	certificate []byte
+}
+
+func newFakeACMEServer(t *testing.T, challengeDir string, r53 *fakeR53) *fakeACMEServer {
+	f := &fakeACMEServer{t: t, challengeDir: challengeDir, r53: r53}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeACMEServer) handle(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+
+	if r.Method == http.MethodHead {
+		return
+	}
+	if r.URL.Path == "/directory" {
+		f.write(w, http.StatusOK, map[string]string{
+			"newNonce":   f.URL + "/nonce",
+			"newAccount": f.URL + "/account",
+			"newOrder":   f.URL + "/order",
+		})
+		return
+	}
+
+	var jws map[string]string
+	assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&jws))
+	assert.NotEmpty(f.t, jws["signature"])
+	payload, err := base64.RawURLEncoding.DecodeString(jws["payload"])
+	assert.NoError(f.t, err)
+
+	switch r.URL.Path {
+	case "/account":
+		w.Header().Set("Location", f.URL+"/account/1")
+		f.write(w, http.StatusCreated, map[string]string{"status": xacme.StatusValid})
+	case "/order":
+		var request struct {
+			Identifiers []struct{ Value string }
+		}
+		assert.NoError(f.t, json.Unmarshal(payload, &request))
+		f.domain = request.Identifiers[0].Value
+		w.Header().Set("Location", f.URL+"/order/1")
+		f.write(w, http.StatusCreated, f.order())
+	case "/order/1":
+		w.Header().Set("Location", f.URL+"/order/1")
+		f.write(w, http.StatusOK, f.order())
+	case "/authz/1":
+		status := xacme.StatusPending
+		if f.validated {
+			status = xacme.StatusValid
+		}
+		wildcard := strings.HasPrefix(f.domain, "*.")
+		challenges := []map[string]string{{"type": dns01, "url": f.URL + "/challenge/dns", "token": token}}
+		if !wildcard {
+			challenges = append(challenges, map[string]string{"type": http01, "url": f.URL + "/challenge/http", "token": token})
+		}
+		f.write(w, http.StatusOK, map[string]interface{}{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": strings.TrimPrefix(f.domain, "*.")},
+			"wildcard":   wildcard,
+			"challenges": challenges,
+		})
+	case "/challenge/http":
+		keyAuth, err := ioutil.ReadFile(filepath.Join(f.challengeDir, token))
+		assert.NoError(f.t, err)
+		f.validated = strings.HasPrefix(string(keyAuth), token+".")
+		f.write(w, http.StatusOK, map[string]string{"type": http01, "url": f.URL + r.URL.Path, "token": token})
+	case "/challenge/dns":
+		f.validated = f.r53.txt("_acme-challenge."+strings.TrimPrefix(f.domain, "*.")+".") != ""
+		f.write(w, http.StatusOK, map[string]string{"type": dns01, "url": f.URL + r.URL.Path, "token": token})
+	case "/finalize/1":
+		var finalize map[string]string
+		assert.NoError(f.t, json.Unmarshal(payload, &finalize))
+		der, err := base64.RawURLEncoding.DecodeString(finalize["csr"])
+		assert.NoError(f.t, err)
+		f.certificate = issue(f.t, der)
+		w.Header().Set("Location", f.URL+"/order/1")
+		f.write(w, http.StatusOK, f.order())
+	case "/certificate/1":
+		_, _ = w.Write(f.certificate)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeACMEServer) order() map[string]interface{} {
+	o := map[string]interface{}{
+		"status":         xacme.StatusPending,
+		"identifiers":    []map[string]string{{"type": "dns", "value": f.domain}},
+		"authorizations": []string{f.URL + "/authz/1"},
+		"finalize":       f.URL + "/finalize/1",
+	}
+	if f.validated {
+		o["status"] = xacme.StatusReady
+	}
+	if f.certificate != nil {
+		o["status"] = xacme.StatusValid
+		o["certificate"] = f.URL + "/certificate/1"
+	}
+	return o
+}
+
+func (f *fakeACMEServer) write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	assert.NoError(f.t, json.NewEncoder(w).Encode(v))
+}
+
+// fakeR53 records the TXT records in a hosted zone.
+type fakeR53 struct {
+	sync.Mutex
+	records map[string]string
+}
+
+func (f *fakeR53) GetHostedZoneDomain() (string, error) {
+	return "foo.com.", nil
+}
+
+func (f *fakeR53) UpdateRecordSets(changes []*route53.Change) error {
+	f.Lock()
+	defer f.Unlock()
+	for _, change := range changes {
+		name := *change.ResourceRecordSet.Name
+		switch *change.Action {
+		case route53.ChangeActionUpsert:
+			f.records[name] = *change.ResourceRecordSet.ResourceRecords[0].Value
+		case route53.ChangeActionDelete:
+			delete(f.records, name)
+		}
+	}
+	return nil
+}
+
+func (f *fakeR53) GetRecords() ([]*route53.ResourceRecordSet, error) {
+	return nil, nil
+}
+
+func (f *fakeR53) txt(name string) string {
+	f.Lock()
+	defer f.Unlock()
+	return f.records[name]
+}
+
+func issue(t *testing.T, csrDER []byte) []byte {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	assert.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: csr.Subject.CommonName},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour * 24 * 90),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, csr.PublicKey, key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestOnlyHostsWithACMEAreIncluded(t *testing.T) {
+	entries := controller.IngressEntries{
+		{Host: "foo.com", ACME: true},
+		{Host: "FOO.com", ACME: true},
+		{Host: "bar.com"},
+		{Host: "*.baz.com", ACME: true},
+		{Host: "baz.com", ACME: true},
+	}
+
+	hosts, unsupported := acmeHosts(entries, false)
+	assert.Equal(t, []string{"baz.com", "foo.com"}, hosts)
+	assert.Equal(t, []string{"*.baz.com"}, unsupported)
+
+	hosts, unsupported = acmeHosts(entries, true)
+	assert.Equal(t, []string{"*.baz.com", "baz.com", "foo.com"}, hosts)
+	assert.Empty(t, unsupported)
+}
+
+func TestWildcardHostsAreAnErrorWithHTTP01(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "acme")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	updater, err := New(Config{ChallengeDir: filepath.Join(dir, "challenges"), CertificatesDir: filepath.Join(dir, "certs")})
+	assert.NoError(t, err)
+
+	err = updater.Update(controller.IngressEntries{{Host: "*.foo.com", ACME: true}, {Host: "bar.com", ACME: true}})
+
+	assert.EqualError(t, err, "unable to obtain certificates for wildcard hosts [*.foo.com] with http-01 challenges, which need dns-01")
+	assert.Equal(t, []string{"bar.com"}, updater.(*acme).hosts, "other hosts should still be obtained")
+}
+
+func TestCertificateIsObtainedAndRenewed(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "acme")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	challengeDir := filepath.Join(dir, "challenges")
+	certsDir := filepath.Join(dir, "certs")
+	server := newFakeACMEServer(t, challengeDir, nil)
+	defer server.Close()
+
+	a := newTestACME(t, server, dir)
+	assert.NoError(a.Start())
+	defer a.Stop()
+
+	now := time.Now()
+	assert.True(a.renewalRequired("foo.com", now), "missing certificates should be obtained")
+	assert.NoError(a.obtainCertificate("foo.com"))
+
+	assert.FileExists(filepath.Join(certsDir, "foo.com.crt"))
+	assert.FileExists(filepath.Join(certsDir, "foo.com.key"))
+	assert.FileExists(filepath.Join(dir, "state", accountKeyFile))
+	assert.NoFileExists(filepath.Join(challengeDir, token), "challenge response should be removed")
+
+	assert.False(a.renewalRequired("foo.com", now))
+	assert.True(a.renewalRequired("foo.com", now.Add(time.Hour*24*61)), "certificates should be renewed before expiry")
+}
+
+func TestWildcardCertificateIsObtainedWithDNS01(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "acme")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	r53 := &fakeR53{records: make(map[string]string)}
+	server := newFakeACMEServer(t, filepath.Join(dir, "challenges"), r53)
+	defer server.Close()
+
+	a := newTestACME(t, server, dir)
+	a.client.solver = &dns01Solver{r53: r53}
+	assert.NoError(a.Start())
+	defer a.Stop()
+
+	assert.NoError(a.obtainCertificate("*.foo.com"))
+
+	assert.FileExists(filepath.Join(dir, "certs", "_wildcard.foo.com.crt"))
+	assert.FileExists(filepath.Join(dir, "certs", "_wildcard.foo.com.key"))
+	assert.False(a.renewalRequired("*.foo.com", time.Now()))
+	assert.Empty(r53.records, "challenge record should be removed")
+}
+
+func newTestACME(t *testing.T, server *fakeACMEServer, dir string) *acme {
+	updater, err := New(Config{
+		DirectoryURL:    server.URL + "/directory",
+		Email:           "admin@foo.com",
+		StateDir:        filepath.Join(dir, "state"),
+		ChallengeDir:    filepath.Join(dir, "challenges"),
+		CertificatesDir: filepath.Join(dir, "certs"),
+		RenewBefore:     time.Hour * 24 * 30,
+	})
+	assert.NoError(t, err)
+	return updater.(*acme)
+}
+
+func TestAccountKeyIsReused(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "acme")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, accountKeyFile)
+
+	generated, err := loadAccountKey(path)
+	assert.NoError(err)
+	loaded, err := loadAccountKey(path)
+	assert.NoError(err)
+
+	assert.True(generated.Equal(loaded))
+}
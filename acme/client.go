@@ -0,0 +1,160 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	xacme "golang.org/x/crypto/acme"
+)
+
+// client orders certificates with the ACME (RFC 8555) client from x/crypto, which retries badNonce and
+// transient errors, validating hosts with the solver.
+type client struct {
+	acme       *xacme.Client
+	email      string
+	solver     solver
+	registered bool
+}
+
+// loadAccountKey reads the account key from path, generating and saving a new one if it doesn't exist.
+func loadAccountKey(path string) (*ecdsa.PrivateKey, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeKey(path, key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+}
+
+// obtainCertificate orders a certificate for host, solving the challenge of each pending authorization.
+// It returns the PEM encoded certificate chain and private key.
+func (c *client) obtainCertificate(ctx context.Context, host string) ([]byte, []byte, error) {
+	if err := c.register(ctx); err != nil {
+		return nil, nil, fmt.Errorf("unable to register account: %v", err)
+	}
+
+	order, err := c.acme.AuthorizeOrder(ctx, xacme.DomainIDs(host))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create order: %v", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := c.authorize(ctx, authzURL); err != nil {
+			return nil, nil, err
+		}
+	}
+	if order, err = c.acme.WaitOrder(ctx, order.URI); err != nil {
+		return nil, nil, fmt.Errorf("order for %s wasn't ready: %v", host, err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: host},
+		DNSNames: []string{host},
+	}, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create certificate request: %v", err)
+	}
+	ders, _, err := c.acme.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to finalize order for %s: %v", host, err)
+	}
+
+	var chain []byte
+	for _, der := range ders {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chain, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+func (c *client) register(ctx context.Context) error {
+	if c.registered {
+		return nil
+	}
+
+	account := &xacme.Account{}
+	if c.email != "" {
+		account.Contact = []string{"mailto:" + c.email}
+	}
+	if _, err := c.acme.Register(ctx, account, xacme.AcceptTOS); err != nil && !errors.Is(err, xacme.ErrAccountAlreadyExists) {
+		return err
+	}
+	c.registered = true
+	return nil
+}
+
+func (c *client) authorize(ctx context.Context, authzURL string) error {
+	authz, err := c.acme.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("unable to get authorization: %v", err)
+	}
+	if authz.Status == xacme.StatusValid {
+		return nil
+	}
+
+	domain := authz.Identifier.Value
+	var chal *xacme.Challenge
+	for _, offered := range authz.Challenges {
+		if offered.Type == c.solver.challengeType() {
+			chal = offered
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no %s challenge offered for %s", c.solver.challengeType(), domain)
+	}
+
+	cleanUp, err := c.solver.present(ctx, c.acme, domain, chal)
+	if err != nil {
+		return fmt.Errorf("unable to present %s challenge for %s: %v", chal.Type, domain, err)
+	}
+	defer cleanUp()
+
+	if _, err := c.acme.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("unable to accept %s challenge for %s: %v", chal.Type, domain, err)
+	}
+	if _, err := c.acme.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization for %s wasn't completed: %v", domain, err)
+	}
+	return nil
+}
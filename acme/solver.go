@@ -0,0 +1,109 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/dns/r53"
+	xacme "golang.org/x/crypto/acme"
+)
+
+const (
+	http01 = "http-01"
+	dns01  = "dns-01"
+
+	dnsChallengeTTL = 60
+)
+
+// solver presents the response to a challenge, so the ACME server can validate control of the domain.
+type solver interface {
+	// challengeType is the type of challenge solved, such as http-01.
+	challengeType() string
+	// supportsWildcards is true if the challenge can validate wildcard hosts.
+	supportsWildcards() bool
+	// present makes the response to the challenge available, returning a function to remove it once the
+	// authorization has completed.
+	present(ctx context.Context, c *xacme.Client, domain string, chal *xacme.Challenge) (func(), error)
+}
+
+// http01Solver writes http-01 responses to a directory, which nginx serves on ChallengePath.
+type http01Solver struct {
+	dir string
+}
+
+func (s *http01Solver) challengeType() string {
+	return http01
+}
+
+func (s *http01Solver) supportsWildcards() bool {
+	return false
+}
+
+func (s *http01Solver) present(_ context.Context, c *xacme.Client, _ string, chal *xacme.Challenge) (func(), error) {
+	if strings.ContainsAny(chal.Token, "/.") {
+		return nil, fmt.Errorf("invalid token %q", chal.Token)
+	}
+	response, err := c.HTTP01ChallengeResponse(chal.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(s.dir, chal.Token)
+	if err := ioutil.WriteFile(path, []byte(response), 0644); err != nil {
+		return nil, err
+	}
+	return func() { _ = os.Remove(path) }, nil
+}
+
+// dns01Solver creates dns-01 TXT records in a Route53 hosted zone.
+type dns01Solver struct {
+	r53 r53.Route53Client
+	// propagationDelay is how long to wait after creating a record before asking for it to be validated.
+	propagationDelay time.Duration
+}
+
+func (s *dns01Solver) challengeType() string {
+	return dns01
+}
+
+func (s *dns01Solver) supportsWildcards() bool {
+	return true
+}
+
+func (s *dns01Solver) present(ctx context.Context, c *xacme.Client, domain string, chal *xacme.Challenge) (func(), error) {
+	value, err := c.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &route53.ResourceRecordSet{
+		Name:            aws.String("_acme-challenge." + domain + "."),
+		Type:            aws.String(route53.RRTypeTxt),
+		TTL:             aws.Int64(dnsChallengeTTL),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(`"` + value + `"`)}},
+	}
+	if err := s.r53.UpdateRecordSets([]*route53.Change{{Action: aws.String(route53.ChangeActionUpsert), ResourceRecordSet: record}}); err != nil {
+		return nil, err
+	}
+	cleanUp := func() {
+		if err := s.r53.UpdateRecordSets([]*route53.Change{{Action: aws.String(route53.ChangeActionDelete), ResourceRecordSet: record}}); err != nil {
+			log.Warnf("Unable to delete challenge record %s: %v", *record.Name, err)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		cleanUp()
+		return nil, ctx.Err()
+	case <-time.After(s.propagationDelay):
+	}
+	return cleanUp, nil
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sky-uk/feed/k8s"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// allowConfigMaps are the allow lists in each config map, by namespace/name, for ingresses too large for an
+// annotation.
+type allowConfigMaps map[string][]string
+
+// newAllowConfigMaps reads the CIDRs from every key of each config map labelled as an allow list. They're separated
+// by commas or whitespace, and anything after a # is a comment.
+func newAllowConfigMaps(configMaps []*corev1.ConfigMap) allowConfigMaps {
+	allowLists := make(allowConfigMaps)
+	for _, configMap := range configMaps {
+		if configMap.Labels[k8s.AllowListLabel] != "true" {
+			continue
+		}
+		var keys []string
+		for key := range configMap.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		allow := []string{}
+		for _, key := range keys {
+			for _, line := range strings.Split(configMap.Data[key], "\n") {
+				line = strings.SplitN(line, "#", 2)[0]
+				allow = append(allow, strings.FieldsFunc(line, func(r rune) bool {
+					return r == ',' || r == ' ' || r == '\t' || r == '\r'
+				})...)
+			}
+		}
+		allowLists[configMap.Namespace+"/"+configMap.Name] = allow
+	}
+	return allowLists
+}
+
+// lookup finds the allow list for a namespace/name reference, or a name in the ingress's namespace.
+func (a allowConfigMaps) lookup(namespace, ref string) ([]string, bool) {
+	if !strings.Contains(ref, "/") {
+		ref = namespace + "/" + ref
+	}
+	allow, ok := a[strings.TrimSpace(ref)]
+	return allow, ok
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/sky-uk/feed/k8s"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAllowListsAreReadFromEveryKey(t *testing.T) {
+	allowLists := newAllowConfigMaps([]*corev1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "partners", Labels: allowListLabels},
+			Data: map[string]string{
+				"b": "10.2.0.0/16, 10.3.0.0/16\n",
+				"a": "# office\n10.0.0.0/16\n\n10.1.0.1 # vpn\n",
+			},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "empty", Labels: allowListLabels}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "unlabelled"},
+			Data:       map[string]string{"allow": "10.0.0.0/8"},
+		},
+	})
+
+	allow, found := allowLists.lookup("team", "shared/partners")
+	assert.True(t, found)
+	assert.Equal(t, []string{"10.0.0.0/16", "10.1.0.1", "10.2.0.0/16", "10.3.0.0/16"}, allow)
+
+	allow, found = allowLists.lookup("team", "empty")
+	assert.True(t, found, "names should be looked up in the ingress's namespace")
+	assert.Empty(t, allow)
+
+	_, found = allowLists.lookup("team", "partners")
+	assert.False(t, found)
+
+	_, found = allowLists.lookup("team", "shared/unlabelled")
+	assert.False(t, found, "config maps should only be used if they're labelled as allow lists")
+}
+
+var allowListLabels = map[string]string{k8s.AllowListLabel: "true"}
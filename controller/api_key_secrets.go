@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/k8s"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultAPIKeyHeader is the request header with the API key, unless set with the sky.uk/api-key-header annotation.
+const DefaultAPIKeyHeader = "X-Api-Key"
+
+// apiKeyHeader is a header name nginx can read as a variable.
+var apiKeyHeader = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// apiKey is restricted to the characters of base64, hex and UUID keys, so it can be quoted in the nginx config.
+var apiKey = regexp.MustCompile(`^[A-Za-z0-9._~+/=-]+$`)
+
+// apiKeySecrets are the secrets of API keys, by namespace/name, for the sky.uk/api-keys-from-secret annotation.
+type apiKeySecrets map[string]*corev1.Secret
+
+// newAPIKeySecrets keeps the secrets labelled as API keys.
+func newAPIKeySecrets(secrets []*corev1.Secret) apiKeySecrets {
+	apiKeys := make(apiKeySecrets)
+	for _, secret := range secrets {
+		if secret.Labels[k8s.APIKeysLabel] != "true" {
+			continue
+		}
+		apiKeys[secret.Namespace+"/"+secret.Name] = secret
+	}
+	return apiKeys
+}
+
+// lookup reads the API keys from a secret in the ingress's namespace, being the value of each key, to its key as the
+// client's name. Keys nginx can't match are skipped.
+func (a apiKeySecrets) lookup(namespace, name string) (map[string]string, bool) {
+	secret, ok := a[namespace+"/"+strings.TrimSpace(name)]
+	if !ok {
+		return nil, false
+	}
+	keys := make(map[string]string)
+	for client, value := range secret.Data {
+		key := strings.TrimSpace(string(value))
+		if !apiKey.MatchString(key) {
+			log.Warnf("Secret %s/%s has an invalid API key for %s. Ignoring it", secret.Namespace, secret.Name, client)
+			continue
+		}
+		keys[key] = client
+	}
+	return keys, true
+}
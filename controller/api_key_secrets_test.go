@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/sky-uk/feed/k8s"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAPIKeysAreReadFromSecretsInTheIngressNamespace(t *testing.T) {
+	apiKeys := newAPIKeySecrets([]*corev1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "api-keys", Labels: apiKeysLabels},
+			Data: map[string][]byte{
+				"partner-a": []byte("c2VjcmV0LWE=\n"),
+				"partner-b": []byte("0f8fad5b-d9cb-469f-a165-70867728950e"),
+				"broken":    []byte("not \"quotable\""),
+			},
+		},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "empty", Labels: apiKeysLabels}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "unlabelled"},
+			Data:       map[string][]byte{"partner-a": []byte("c2VjcmV0LWE=")},
+		},
+	})
+
+	keys, found := apiKeys.lookup("team", "api-keys")
+	assert.True(t, found)
+	assert.Equal(t, map[string]string{
+		"c2VjcmV0LWE=":                         "partner-a",
+		"0f8fad5b-d9cb-469f-a165-70867728950e": "partner-b",
+	}, keys)
+
+	keys, found = apiKeys.lookup("team", "empty")
+	assert.True(t, found)
+	assert.Empty(t, keys)
+
+	_, found = apiKeys.lookup("other", "api-keys")
+	assert.False(t, found, "secrets should only be looked up in the ingress's namespace")
+
+	_, found = apiKeys.lookup("team", "unlabelled")
+	assert.False(t, found, "only secrets labelled as API keys can be used")
+}
+
+var apiKeysLabels = map[string]string{k8s.APIKeysLabel: "true"}
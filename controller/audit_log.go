@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// Actions of audit records.
+const (
+	AuditAdded   = "added"
+	AuditChanged = "changed"
+	AuditRemoved = "removed"
+)
+
+// AuditRecord is a line of the audit log, recording an applied change to an ingress's entry for a host and path.
+type AuditRecord struct {
+	// Time is when the change was applied.
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Ingress string    `json:"ingress"`
+	Host    string    `json:"host"`
+	Path    string    `json:"path"`
+	// ChangedFields are the fields of the entry which changed, when it's changed.
+	ChangedFields []string `json:"changedFields,omitempty"`
+	// Before and After are the entry before and after the change, without its endpoints.
+	Before *RoutingTableEntry `json:"before,omitempty"`
+	After  *RoutingTableEntry `json:"after,omitempty"`
+	// Manager, Operation and ManagedAt are the latest change to the ingress in its managed fields, being who last
+	// changed it and when. They're not known for removed entries.
+	Manager   string     `json:"manager,omitempty"`
+	Operation string     `json:"operation,omitempty"`
+	ManagedAt *time.Time `json:"managedAt,omitempty"`
+}
+
+type auditKey struct {
+	namespace, name, host, path string
+}
+
+// auditLog appends a record to the file for every change to the entries applied since the last successful update.
+// The first update is the baseline, so nothing is recorded for it. It's only used by the update loop.
+type auditLog struct {
+	file string
+	last map[auditKey]RoutingTableEntry
+}
+
+// record appends the changes to the applied entries. They're recorded again with the next update if they can't be
+// written.
+func (a *auditLog) record(entries []IngressEntry, applied time.Time) {
+	if a.file == "" {
+		return
+	}
+
+	current := make(map[auditKey]RoutingTableEntry, len(entries))
+	ingresses := make(map[auditKey]*networkingv1.Ingress, len(entries))
+	for _, e := range entries {
+		key := auditKey{e.Namespace, e.Name, e.Host, e.Path}
+		entry := newRoutingTableEntry(e)
+		// endpoints change with every rollout, rather than with the ingress
+		entry.Endpoints = nil
+		current[key] = entry
+		ingresses[key] = e.Ingress
+	}
+	if a.last == nil {
+		a.last = current
+		return
+	}
+
+	records := auditRecords(a.last, current, ingresses, applied)
+	if len(records) == 0 {
+		a.last = current
+		return
+	}
+	if err := a.write(records); err != nil {
+		log.Warnf("Unable to write %d records to the audit log %s: %v", len(records), a.file, err)
+		auditLogWriteFailures.Inc()
+		return
+	}
+	a.last = current
+}
+
+func auditRecords(last, current map[auditKey]RoutingTableEntry, ingresses map[auditKey]*networkingv1.Ingress,
+	applied time.Time) []AuditRecord {
+
+	var records []AuditRecord
+	for key, after := range current {
+		after := after
+		record := AuditRecord{Time: applied, Ingress: key.namespace + "/" + key.name, Host: key.host, Path: key.path,
+			After: &after}
+		if before, ok := last[key]; ok {
+			changed := changedFields(before, after)
+			if len(changed) == 0 {
+				continue
+			}
+			record.Action = AuditChanged
+			record.ChangedFields = changed
+			record.Before = &before
+		} else {
+			record.Action = AuditAdded
+		}
+		setManager(&record, ingresses[key])
+		records = append(records, record)
+	}
+	for key, before := range last {
+		if _, ok := current[key]; !ok {
+			before := before
+			records = append(records, AuditRecord{Time: applied, Action: AuditRemoved,
+				Ingress: key.namespace + "/" + key.name, Host: key.host, Path: key.path, Before: &before})
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Ingress != b.Ingress {
+			return a.Ingress < b.Ingress
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Path < b.Path
+	})
+	return records
+}
+
+// changedFields returns the JSON names of the fields which differ between the entries.
+func changedFields(before, after RoutingTableEntry) []string {
+	var b, a map[string]json.RawMessage
+	beforeJSON, _ := json.Marshal(before)
+	afterJSON, _ := json.Marshal(after)
+	_ = json.Unmarshal(beforeJSON, &b)
+	_ = json.Unmarshal(afterJSON, &a)
+
+	var changed []string
+	for field, value := range a {
+		if !bytes.Equal(value, b[field]) {
+			changed = append(changed, field)
+		}
+	}
+	for field := range b {
+		if _, ok := a[field]; !ok {
+			changed = append(changed, field)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// setManager sets who made the latest change to the ingress, and when, from its managed fields. Changes to its status,
+// such as the load balancer addresses set by feed, are left out.
+func setManager(record *AuditRecord, ingress *networkingv1.Ingress) {
+	if ingress == nil {
+		return
+	}
+	for _, managed := range ingress.ManagedFields {
+		if managed.Subresource == "status" || managed.Time == nil {
+			continue
+		}
+		if record.ManagedAt == nil || managed.Time.Time.After(*record.ManagedAt) {
+			managedAt := managed.Time.Time
+			record.Manager = managed.Manager
+			record.Operation = string(managed.Operation)
+			record.ManagedAt = &managedAt
+		}
+	}
+}
+
+func (a *auditLog) write(records []AuditRecord) error {
+	var lines bytes.Buffer
+	enc := json.NewEncoder(&lines)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(a.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(lines.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func readAuditRecords(t *testing.T, file string) []AuditRecord {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	assert.NoError(t, err)
+	defer f.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record AuditRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditLogRecordsChangesAfterTheFirstUpdate(t *testing.T) {
+	initMetrics()
+	asserter := assert.New(t)
+	file := filepath.Join(t.TempDir(), "audit.log")
+	audit := auditLog{file: file}
+	applied := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	edited := metav1.NewTime(applied.Add(-time.Minute))
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{ManagedFields: []metav1.ManagedFieldsEntry{
+		{Manager: "kubectl-client-side-apply", Operation: metav1.ManagedFieldsOperationUpdate,
+			Time: &metav1.Time{Time: applied.Add(-time.Hour)}},
+		{Manager: "deploy-bot", Operation: metav1.ManagedFieldsOperationApply, Time: &edited},
+		{Manager: "feed-ingress", Operation: metav1.ManagedFieldsOperationUpdate, Time: &metav1.Time{Time: applied},
+			Subresource: "status"},
+	}}}
+	a := IngressEntry{Namespace: "core", Name: "a", Host: "a.com", Path: "/", ServiceAddress: "10.0.0.1",
+		ServicePort: 8080, Ingress: ingress}
+	b := IngressEntry{Namespace: "core", Name: "b", Host: "b.com", Path: "/", ServiceAddress: "10.0.0.2",
+		ServicePort: 8080}
+
+	audit.record([]IngressEntry{a, b}, applied)
+	asserter.Empty(readAuditRecords(t, file), "the first update should be the baseline")
+
+	changedA := a
+	changedA.ServiceAddress = "10.0.0.3"
+	changedA.Endpoints = []Endpoint{{Address: "172.16.0.1", Port: 9090}}
+	c := IngressEntry{Namespace: "core", Name: "c", Host: "c.com", Path: "/", ServiceAddress: "10.0.0.4",
+		ServicePort: 8080}
+	audit.record([]IngressEntry{changedA, c}, applied)
+
+	records := readAuditRecords(t, file)
+	if asserter.Len(records, 3) {
+		asserter.Equal(AuditChanged, records[0].Action)
+		asserter.Equal("core/a", records[0].Ingress)
+		asserter.Equal([]string{"serviceAddress"}, records[0].ChangedFields)
+		asserter.Equal("10.0.0.1", records[0].Before.ServiceAddress)
+		asserter.Equal("10.0.0.3", records[0].After.ServiceAddress)
+		asserter.Nil(records[0].After.Endpoints)
+		asserter.Equal("deploy-bot", records[0].Manager)
+		asserter.Equal("Apply", records[0].Operation)
+		asserter.True(edited.Time.Equal(*records[0].ManagedAt))
+
+		asserter.Equal(AuditRemoved, records[1].Action)
+		asserter.Equal("core/b", records[1].Ingress)
+		asserter.Nil(records[1].After)
+		asserter.Empty(records[1].Manager)
+
+		asserter.Equal(AuditAdded, records[2].Action)
+		asserter.Equal("core/c", records[2].Ingress)
+		asserter.Equal("c.com", records[2].Host)
+	}
+
+	changedA.Endpoints = nil
+	audit.record([]IngressEntry{changedA, c}, applied)
+	asserter.Len(readAuditRecords(t, file), 3, "endpoints aren't audited")
+}
+
+func TestAuditLogRecordsChangesAgainWhenTheyCantBeWritten(t *testing.T) {
+	initMetrics()
+	asserter := assert.New(t)
+	dir := t.TempDir()
+	audit := auditLog{file: filepath.Join(dir, "missing", "audit.log")}
+	a := IngressEntry{Namespace: "core", Name: "a", Host: "a.com", Path: "/"}
+
+	audit.record(nil, time.Now())
+	audit.record([]IngressEntry{a}, time.Now())
+
+	audit.file = filepath.Join(dir, "audit.log")
+	audit.record([]IngressEntry{a}, time.Now())
+	records := readAuditRecords(t, audit.file)
+	if asserter.Len(records, 1) {
+		asserter.Equal(AuditAdded, records[0].Action)
+	}
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConflictStrategy decides which ingress entry is used when several have the same host and path.
+type ConflictStrategy string
+
+const (
+	// ConflictByName keeps the entry which is first when ordered by namespace and name.
+	ConflictByName ConflictStrategy = "name"
+	// ConflictOldest keeps the entry from the oldest ingress.
+	ConflictOldest ConflictStrategy = "oldest"
+	// ConflictNewest keeps the entry from the newest ingress.
+	ConflictNewest ConflictStrategy = "newest"
+	// ConflictPriority keeps the entry with the highest sky.uk/route-priority, then the oldest.
+	ConflictPriority ConflictStrategy = "priority"
+	// ConflictSameNamespace keeps the entry from the namespace with the most entries for the host, then the oldest.
+	ConflictSameNamespace ConflictStrategy = "same-namespace"
+)
+
+// ConflictStrategies are the supported strategies.
+var ConflictStrategies = []ConflictStrategy{ConflictByName, ConflictOldest, ConflictNewest, ConflictPriority,
+	ConflictSameNamespace}
+
+// Valid returns true if the strategy is supported.
+func (s ConflictStrategy) Valid() bool {
+	for _, strategy := range ConflictStrategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+type routeKey struct {
+	host, path string
+}
+
+// newRouteKey matches entries the same way nginx does, where prefix paths are compared without their slashes.
+func newRouteKey(e IngressEntry) routeKey {
+	if e.ExactPath {
+		return routeKey{e.Host, e.Path}
+	}
+	path := strings.Trim(e.Path, "/")
+	if path == "" {
+		return routeKey{e.Host, "/"}
+	}
+	return routeKey{e.Host, "/" + path + "/"}
+}
+
+type hostNamespace struct {
+	host, namespace string
+}
+
+// conflict is an entry which wasn't used, because another has the same host and path.
+type conflict struct {
+	winner, loser IngressEntry
+}
+
+func (c conflict) String() string {
+	return fmt.Sprintf("%s %s%s is served by %s instead", c.loser.NamespaceName(), c.loser.Host, c.loser.Path,
+		c.winner.NamespaceName())
+}
+
+// resolveConflicts keeps one entry for each host and path, in their original order, returning the entries which
+// lost out.
+func resolveConflicts(entries []IngressEntry, strategy ConflictStrategy) ([]IngressEntry, []conflict) {
+	hostNamespaces := make(map[hostNamespace]int)
+	for _, e := range entries {
+		hostNamespaces[hostNamespace{e.Host, e.Namespace}]++
+	}
+
+	winners := make(map[routeKey]int)
+	for i, e := range entries {
+		key := newRouteKey(e)
+		if w, exists := winners[key]; !exists || strategy.prefer(e, entries[w], hostNamespaces) {
+			winners[key] = i
+		}
+	}
+
+	var resolved []IngressEntry
+	var conflicts []conflict
+	for i, e := range entries {
+		w := winners[newRouteKey(e)]
+		if w == i {
+			resolved = append(resolved, e)
+		} else {
+			conflicts = append(conflicts, conflict{winner: entries[w], loser: e})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].String() < conflicts[j].String()
+	})
+	return resolved, conflicts
+}
+
+// prefer returns true if a should be used instead of b.
+func (s ConflictStrategy) prefer(a, b IngressEntry, hostNamespaces map[hostNamespace]int) bool {
+	switch s {
+	case ConflictOldest:
+		if !a.CreationTimestamp.Equal(b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(b.CreationTimestamp)
+		}
+	case ConflictNewest:
+		if !a.CreationTimestamp.Equal(b.CreationTimestamp) {
+			return a.CreationTimestamp.After(b.CreationTimestamp)
+		}
+	case ConflictPriority:
+		if aPriority, bPriority := routePriority(a), routePriority(b); aPriority != bPriority {
+			return aPriority > bPriority
+		}
+		return ConflictOldest.prefer(a, b, hostNamespaces)
+	case ConflictSameNamespace:
+		aCount := hostNamespaces[hostNamespace{a.Host, a.Namespace}]
+		bCount := hostNamespaces[hostNamespace{b.Host, b.Namespace}]
+		if aCount != bCount {
+			return aCount > bCount
+		}
+		return ConflictOldest.prefer(a, b, hostNamespaces)
+	}
+	return byName(a) < byName(b)
+}
+
+// byName orders entries by namespace and name, then their route and service, to break any ties.
+func byName(e IngressEntry) string {
+	return strings.Join([]string{e.Namespace, e.Name, e.Host, e.Path, e.ServiceAddress,
+		strconv.Itoa(int(e.ServicePort))}, ":")
+}
+
+func routePriority(e IngressEntry) int {
+	if e.Ingress == nil {
+		return 0
+	}
+	priority, err := strconv.Atoi(e.Ingress.Annotations[routePriorityAnnotation])
+	if err != nil {
+		return 0
+	}
+	return priority
+}
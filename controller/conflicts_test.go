@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func conflictingEntry(namespace, name, path string, age time.Duration, annotations map[string]string) IngressEntry {
+	return IngressEntry{
+		Namespace:         namespace,
+		Name:              name,
+		Host:              "foo.sky.com",
+		Path:              path,
+		ServiceAddress:    "10.254.0.1",
+		ServicePort:       8080,
+		CreationTimestamp: time.Unix(1500000000, 0).Add(-age),
+		Ingress:           &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}},
+	}
+}
+
+func TestConflictsAreResolvedByStrategy(t *testing.T) {
+	older := conflictingEntry("b", "older", "/foo", time.Hour, nil)
+	newer := conflictingEntry("a", "newer", "/foo/", time.Minute, map[string]string{routePriorityAnnotation: "10"})
+	sibling := conflictingEntry("b", "sibling", "/bar", 0, nil)
+	unrelated := conflictingEntry("c", "unrelated", "/baz", 0, nil)
+	entries := []IngressEntry{older, newer, sibling, unrelated}
+
+	var tests = []struct {
+		strategy ConflictStrategy
+		winner   IngressEntry
+		loser    IngressEntry
+	}{
+		{ConflictByName, newer, older},
+		{ConflictOldest, older, newer},
+		{ConflictNewest, newer, older},
+		{ConflictPriority, newer, older},
+		{ConflictSameNamespace, older, newer},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.strategy), func(t *testing.T) {
+			resolved, conflicts := resolveConflicts(entries, test.strategy)
+
+			assert.ElementsMatch(t, []IngressEntry{test.winner, sibling, unrelated}, resolved)
+			assert.Equal(t, []conflict{{winner: test.winner, loser: test.loser}}, conflicts)
+		})
+	}
+}
+
+func TestPriorityFallsBackToOldest(t *testing.T) {
+	older := conflictingEntry("b", "older", "/foo", time.Hour, map[string]string{routePriorityAnnotation: "invalid"})
+	newer := conflictingEntry("a", "newer", "/foo", time.Minute, nil)
+
+	resolved, _ := resolveConflicts([]IngressEntry{newer, older}, ConflictPriority)
+
+	assert.Equal(t, []IngressEntry{older}, resolved)
+}
+
+func TestExactPathsOnlyConflictWithTheSamePath(t *testing.T) {
+	exact := conflictingEntry("a", "exact", "/foo", 0, nil)
+	exact.ExactPath = true
+	prefix := conflictingEntry("a", "prefix", "/foo", 0, nil)
+
+	resolved, conflicts := resolveConflicts([]IngressEntry{exact, prefix}, ConflictByName)
+
+	assert.Equal(t, []IngressEntry{exact, prefix}, resolved)
+	assert.Empty(t, conflicts)
+}
+
+func TestConflictStrategiesAreValidated(t *testing.T) {
+	assert.True(t, ConflictSameNamespace.Valid())
+	assert.False(t, ConflictStrategy("random").Valid())
+}
@@ -32,6 +32,77 @@ const (
 	stripPathAnnotation = "sky.uk/strip-path"
 	exactPathAnnotation = "sky.uk/exact-path"
 
+	// treats the path as a regular expression
+	pathRegexAnnotation = "sky.uk/path-regex"
+
+	// routes TLS connections by SNI directly to the backend, without terminating them
+	sslPassthroughAnnotation = "sky.uk/ssl-passthrough"
+
+	// requests a certificate for the host from an ACME server, such as Let's Encrypt
+	acmeAnnotation = "sky.uk/acme"
+
+	// proxies to the backend over TLS with feed-ingress's SPIFFE identity as a client certificate
+	backendSPIFFEAnnotation = "sky.uk/backend-spiffe"
+	// the DNS name the backend's SVID is verified against, instead of <service>.<namespace>.svc
+	backendSPIFFENameAnnotation = "sky.uk/backend-spiffe-name"
+
+	// a service in the ingress's namespace, as name or name:port, which takes traffic when the backend is unavailable
+	backupServiceAnnotation = "sky.uk/backup-service"
+
+	// names the FeedRoutePolicy in the ingress's namespace to configure it with
+	routePolicyAnnotation = "sky.uk/route-policy"
+
+	// references a config map, as namespace/name or a name in the ingress's namespace, with more CIDRs to allow
+	allowFromConfigMapAnnotation = "sky.uk/allow-from-configmap"
+
+	// restrict clients by the country of their address, looked up in the GeoIP database
+	allowCountriesAnnotation = "sky.uk/allow-countries"
+	denyCountriesAnnotation  = "sky.uk/deny-countries"
+
+	// excludes the ingress from tracing, or traces a proportion of its requests, if OpenTracing is enabled
+	tracingAnnotation           = "sky.uk/tracing"
+	tracingSampleRateAnnotation = "sky.uk/tracing-sample-rate"
+
+	// replaces these backend error responses with the controller's error pages
+	interceptErrorsAnnotation = "sky.uk/intercept-errors"
+
+	// adds a profile of security headers to responses, overriding the controller's default
+	securityHeadersAnnotation = "sky.uk/security-headers"
+
+	// sub-paths only reachable from the trusted frontends, or by internal redirects if there are none
+	internalPathsAnnotation = "sky.uk/internal-paths"
+
+	// redirects the path without its trailing slash with this status code, or serves it
+	trailingSlashAnnotation = "sky.uk/trailing-slash"
+
+	// proxies WebSocket upgrade requests, overriding the controller's default, and the timeout between messages
+	webSocketUpgradeAnnotation = "sky.uk/websocket-upgrade"
+	webSocketTimeoutAnnotation = "sky.uk/websocket-timeout"
+
+	// njs functions, as module.function, which handle requests instead of the backend and change response headers
+	njsContentAnnotation      = "sky.uk/njs-content"
+	njsHeaderFilterAnnotation = "sky.uk/njs-header-filter"
+
+	// only allows requests with an API key from the secret in the header, and limits the requests per second of each key
+	apiKeyHeaderAnnotation      = "sky.uk/api-key-header"
+	apiKeysFromSecretAnnotation = "sky.uk/api-keys-from-secret"
+	apiKeyRateLimitAnnotation   = "sky.uk/api-key-rate-limit"
+
+	// names the ingress's paths in vhost stats and metrics, instead of the path
+	statsNameAnnotation = "sky.uk/stats-name"
+
+	// requires HTTP basic auth, with the htpasswd file in this Vault secret under the ingress's namespace
+	vaultHtpasswdAnnotation = "sky.uk/vault-htpasswd"
+
+	// proxies to the backend over http (the default), h2c (cleartext HTTP/2), fastcgi or uwsgi
+	backendProtocolAnnotation = "sky.uk/backend-protocol"
+
+	// wins conflicts over the same host and path, with the priority conflict strategy
+	routePriorityAnnotation = "sky.uk/route-priority"
+
+	// turns new requests away with a 503, keeping the ingress configured, so its backend can be drained for maintenance
+	drainAnnotation = "sky.uk/drain"
+
 	backendTimeoutSeconds = "sky.uk/backend-timeout-seconds"
 	// sets keepalive_timeout on nginx upstream (http://nginx.org/en/docs/http/ngx_http_upstream_module.html#keepalive)
 	backendConnectionKeepalive = "sky.uk/backend-connection-keepalive"
@@ -45,6 +116,11 @@ const (
 
 	// sets Nginx (http://nginx.org/en/docs/http/ngx_http_upstream_module.html#max_conns)
 	backendMaxConnections = "sky.uk/backend-max-connections"
+	// sets keepalive on the nginx upstream, overriding the global keepalive count up to its cap
+	backendKeepaliveCount = "sky.uk/backend-keepalive-count"
+	// sets max_fails and fail_timeout on the nginx upstream server, to eject it after failed requests
+	backendMaxFails    = "sky.uk/backend-max-fails"
+	backendFailTimeout = "sky.uk/backend-fail-timeout"
 
 	ingressClassAnnotation = "kubernetes.io/ingress.class"
 )
@@ -57,30 +133,72 @@ type Controller interface {
 	Stop() error
 	// Health returns nil for a healthy controller, an error for unhealthy.
 	Health() error
+	// Liveness returns nil while the controller's update loop is running, an error if it's stuck.
+	Liveness() error
 	// Readiness returns nil for a ready controller, an error for unready.
 	Readiness() error
+	// Resync forces an immediate update of all updaters, without waiting for a change or the resync period. The
+	// ingresses and services are listed from the apiserver again first.
+	Resync() error
+	// Status returns the entries of the last successful update, and when it was.
+	Status() Status
 }
 
 type controller struct {
 	client                       k8s.Client
 	updaters                     []Updater
+	updateStages                 []updateStage
+	updaterTimeout               time.Duration
+	slowUpdateThreshold          time.Duration
+	watchStaleAfter              time.Duration
+	loopStuckAfter               time.Duration
+	shard                        Shard
+	shutdown                     ShutdownConfig
+	allowZeroIngresses           bool
+	conflictStrategy             ConflictStrategy
+	hostOwnership                bool
+	namespaceQuota               NamespaceQuota
+	removed                      removedEntries
+	routingTableFile             string
+	audit                        auditLog
+	namespaceDefaults            bool
+	allowFromConfigMaps          bool
+	apiKeysFromSecrets           bool
+	checkEndpoints               bool
+	endpointsMode                bool
+	endpointsZone                string
+	upstreamWeights              bool
+	referencedServicesOnly       bool
+	services                     serviceCache
+	hostOwners                   hostOwners
+	reportedEvents               map[string]bool
 	defaultAllow                 []string
 	defaultStripPath             bool
 	defaultExactPath             bool
 	defaultBackendTimeout        int
 	defaultBackendMaxConnections int
+	defaultBackendMaxFails       int
+	defaultBackendFailTimeout    time.Duration
 	defaultProxyBufferSize       int
 	defaultProxyBufferBlocks     int
+	defaultInterceptErrors       []int
+	defaultWebSocketUpgrade      bool
 	watcher                      k8s.Watcher
 	stopCh                       chan struct{}
 	watcherDone                  sync.WaitGroup
+	resyncCh                     chan struct{}
 	started                      bool
 	updatesHealth                util.SafeError
+	loopActivity                 util.SafeTime
+	applied                      appliedEntries
 	sync.Mutex
 	name                       string
 	includeClasslessIngresses  bool
+	allIngressClasses          bool
+	hostTemplate               HostTemplate
 	namespaceSelectors         []*k8s.NamespaceSelector
 	matchAllNamespaceSelectors bool
+	routePolicies              bool
 }
 
 // Config for creating a new ingress controller.
@@ -92,31 +210,134 @@ type Config struct {
 	DefaultExactPath             bool
 	DefaultBackendTimeoutSeconds int
 	DefaultBackendMaxConnections int
+	DefaultBackendMaxFails       int
+	DefaultBackendFailTimeout    time.Duration
 	DefaultProxyBufferSize       int
 	DefaultProxyBufferBlocks     int
 	Name                         string
 	IncludeClasslessIngresses    bool
 	NamespaceSelectors           []*k8s.NamespaceSelector
 	MatchAllNamespaceSelectors   bool
+	// DefaultInterceptErrors are the backend status codes replaced with error pages, unless overridden with the
+	// sky.uk/intercept-errors annotation.
+	DefaultInterceptErrors []int
+	// DefaultWebSocketUpgrade proxies WebSocket upgrade requests, unless overridden with the sky.uk/websocket-upgrade
+	// annotation.
+	DefaultWebSocketUpgrade bool
+	// RoutePolicies enables configuring ingresses with FeedRoutePolicy resources, which must be installed.
+	RoutePolicies bool
+	// UpdaterTimeout is how long each updater has to apply an update, or 0 for no limit.
+	UpdaterTimeout time.Duration
+	// SlowUpdateThreshold logs a warning with how long each updater took when an update takes longer than this, or
+	// never if 0.
+	SlowUpdateThreshold time.Duration
+	// WatchStaleAfter fails health when a watched resource hasn't been listed or had a watch event for this long, as
+	// its watch may have silently stopped. 0 disables the check.
+	WatchStaleAfter time.Duration
+	// LoopStuckAfter fails liveness when the update loop hasn't gone round for this long, such as when an update
+	// hangs. 0 disables the check.
+	LoopStuckAfter time.Duration
+	// Shard serves only the hosts in this shard, when hosts are divided between several groups of feed instances.
+	Shard Shard
+	// Shutdown sets out the drain sequence when the controller is stopped.
+	Shutdown ShutdownConfig
+	// AllowZeroIngresses updates with no entries rather than failing, so a new cluster can be healthy before any
+	// ingresses exist. The ingress entries metric shows when there are none.
+	AllowZeroIngresses bool
+	// ConflictStrategy decides which entry is used when ingresses have the same host and path. Defaults to
+	// ConflictByName.
+	ConflictStrategy ConflictStrategy
+	// HostOwnership stops ingresses using a host which is owned by another namespace, being the namespace of the
+	// oldest ingress for the host.
+	HostOwnership bool
+	// NamespaceQuota limits the hosts, paths and rate limits of each namespace's ingresses.
+	NamespaceQuota NamespaceQuota
+	// RemovalDrainWindow keeps entries removed from the ingresses for this long, set to Drain, so requests in flight
+	// can finish before they're removed. 0 removes them at once.
+	RemovalDrainWindow time.Duration
+	// RoutingTableFile is written with the RoutingTable of each successful update as JSON, if set.
+	RoutingTableFile string
+	// AuditLogFile is appended with an AuditRecord for each change to the entries applied by a successful update, as
+	// JSON lines, if set.
+	AuditLogFile string
+	// NamespaceDefaults uses ingress annotations set on a namespace as defaults for the ingresses in it.
+	NamespaceDefaults bool
+	// AllowFromConfigMaps resolves the sky.uk/allow-from-configmap annotation, watching config maps for changes.
+	AllowFromConfigMaps bool
+	// APIKeysFromSecrets resolves the sky.uk/api-keys-from-secret annotation, watching secrets for changes.
+	APIKeysFromSecrets bool
+	// CheckEndpoints reports entries whose service port has no ready endpoints, watching endpoints for changes.
+	// The entries are still used.
+	CheckEndpoints bool
+	// EndpointsMode sets the ready endpoints of each entry's service port, for updaters to proxy to instead of the
+	// service address, watching endpoints for changes.
+	EndpointsMode bool
+	// EndpointsZone is the zone of the node, whose endpoints are preferred in endpoints mode. Endpoints in other zones
+	// are only used when those in it are unavailable.
+	EndpointsZone string
+	// UpstreamWeights weights the endpoints of each service by their pods' sky.uk/upstream-weight annotation in
+	// endpoints mode, watching pods labelled with k8s.WeightedPodsLabel for changes.
+	UpstreamWeights bool
+	// ReferencedServicesOnly only lists and watches the services referenced by the backends of this controller's
+	// ingresses, rather than every service in the cluster.
+	ReferencedServicesOnly bool
+	// AllIngressClasses considers every ingress whatever its class, ignoring Name and IncludeClasslessIngresses.
+	AllIngressClasses bool
+	// HostTemplate generates the host of ingress rules without one.
+	HostTemplate HostTemplate
 }
 
 // New creates an ingress controller.
 func New(conf Config, stopCh chan struct{}) Controller {
+	initMetrics()
+
 	return &controller{
 		client:                       conf.KubernetesClient,
 		updaters:                     conf.Updaters,
+		updateStages:                 newUpdateStages(conf.Updaters),
+		updaterTimeout:               conf.UpdaterTimeout,
+		slowUpdateThreshold:          conf.SlowUpdateThreshold,
+		watchStaleAfter:              conf.WatchStaleAfter,
+		loopStuckAfter:               conf.LoopStuckAfter,
+		shard:                        conf.Shard,
+		shutdown:                     conf.Shutdown,
+		allowZeroIngresses:           conf.AllowZeroIngresses,
+		conflictStrategy:             conf.ConflictStrategy,
+		hostOwnership:                conf.HostOwnership,
+		namespaceQuota:               conf.NamespaceQuota,
+		removed:                      removedEntries{window: conf.RemovalDrainWindow},
+		routingTableFile:             conf.RoutingTableFile,
+		audit:                        auditLog{file: conf.AuditLogFile},
+		namespaceDefaults:            conf.NamespaceDefaults,
+		allowFromConfigMaps:          conf.AllowFromConfigMaps,
+		apiKeysFromSecrets:           conf.APIKeysFromSecrets,
+		checkEndpoints:               conf.CheckEndpoints,
+		endpointsMode:                conf.EndpointsMode,
+		endpointsZone:                conf.EndpointsZone,
+		upstreamWeights:              conf.UpstreamWeights,
+		referencedServicesOnly:       conf.ReferencedServicesOnly,
+		hostOwners:                   make(hostOwners),
+		reportedEvents:               make(map[string]bool),
 		defaultAllow:                 strings.Split(conf.DefaultAllow, ","),
 		defaultStripPath:             conf.DefaultStripPath,
 		defaultExactPath:             conf.DefaultExactPath,
 		defaultBackendTimeout:        conf.DefaultBackendTimeoutSeconds,
 		defaultBackendMaxConnections: conf.DefaultBackendMaxConnections,
+		defaultBackendMaxFails:       conf.DefaultBackendMaxFails,
+		defaultBackendFailTimeout:    conf.DefaultBackendFailTimeout,
 		defaultProxyBufferSize:       conf.DefaultProxyBufferSize,
 		defaultProxyBufferBlocks:     conf.DefaultProxyBufferBlocks,
+		defaultInterceptErrors:       conf.DefaultInterceptErrors,
+		defaultWebSocketUpgrade:      conf.DefaultWebSocketUpgrade,
 		stopCh:                       stopCh,
+		resyncCh:                     make(chan struct{}, 1),
 		name:                         conf.Name,
 		includeClasslessIngresses:    conf.IncludeClasslessIngresses,
+		allIngressClasses:            conf.AllIngressClasses,
+		hostTemplate:                 conf.HostTemplate,
 		namespaceSelectors:           conf.NamespaceSelectors,
 		matchAllNamespaceSelectors:   conf.MatchAllNamespaceSelectors,
+		routePolicies:                conf.RoutePolicies,
 	}
 }
 
@@ -154,32 +375,94 @@ func (c *controller) Start() error {
 
 func (c *controller) watchForUpdates() {
 	ingressWatcher := c.client.WatchIngresses()
+	if c.referencedServicesOnly {
+		// no services are referenced until the ingresses are first listed, so none are listed until then
+		_ = c.client.SetReferencedServices(map[string]bool{})
+	}
 	serviceWatcher := c.client.WatchServices()
 	namespaceWatcher := c.client.WatchNamespaces()
-	c.watcher = k8s.CombineWatchers(ingressWatcher, serviceWatcher, namespaceWatcher)
+	watchers := []k8s.Watcher{ingressWatcher, serviceWatcher, namespaceWatcher}
+	if c.routePolicies {
+		watchers = append(watchers, c.client.WatchRoutePolicies())
+	}
+	if c.allowFromConfigMaps {
+		watchers = append(watchers, c.client.WatchConfigMaps())
+	}
+	if c.apiKeysFromSecrets {
+		watchers = append(watchers, c.client.WatchSecrets())
+	}
+	if c.checkEndpoints || c.endpointsMode {
+		watchers = append(watchers, c.client.WatchEndpointSlices())
+	}
+	if c.endpointsMode && c.upstreamWeights {
+		watchers = append(watchers, c.client.WatchPods())
+	}
+	c.watcher = k8s.CombineWatchers(watchers...)
 	c.watcherDone.Add(1)
 	go c.handleUpdates()
 }
 
+// loopTick is how often the update loop goes round without updates, so LoopStuckAfter must be longer.
+const loopTick = 10 * time.Second
+
 func (c *controller) handleUpdates() {
 	defer log.Debug("Controller stopped watching for updates")
 
+	// the loop goes round at least every tick, so it's only seen as stuck if an update doesn't return
+	tick := time.NewTicker(loopTick)
+	defer tick.Stop()
 	for {
+		c.loopActivity.Set(time.Now())
 		select {
+		case <-tick.C:
+			if c.removed.due(time.Now()) {
+				log.Info("Updating to remove drained entries")
+				c.update()
+			}
 		case <-c.watcher.Updates():
 			log.Info("Received update on watcher")
-			if err := c.updateIngresses(); err != nil {
-				c.updatesHealth.Set(err)
-				log.Errorf("Unable to update ingresses: %v", err)
-			} else {
-				c.updatesHealth.Set(nil)
+			c.update()
+		case <-c.resyncCh:
+			log.Info("Forcing resync of all updaters")
+			if err := c.client.Relist(); err != nil {
+				log.Warnf("Unable to relist from the apiserver, so resyncing from the cached state: %v", err)
 			}
+			c.update()
 		case <-c.stopCh:
 			return
 		}
 	}
 }
 
+func (c *controller) update() {
+	if err := c.updateIngresses(); err != nil {
+		c.updatesHealth.Set(err)
+		log.Errorf("Unable to update ingresses: %v", err)
+	} else {
+		c.updatesHealth.Set(nil)
+	}
+}
+
+func (c *controller) Status() Status {
+	return c.applied.status()
+}
+
+func (c *controller) Resync() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.started {
+		return errors.New("cannot resync, not started")
+	}
+
+	select {
+	case c.resyncCh <- struct{}{}:
+	default:
+		log.Debug("Resync already pending")
+	}
+	return nil
+}
+
 func (c *controller) updateIngresses() (err error) {
 	defer func() {
 		if value := recover(); value != nil {
@@ -187,6 +470,8 @@ func (c *controller) updateIngresses() (err error) {
 		}
 	}()
 
+	start := time.Now()
+
 	// Get ingresses
 	var ingresses []*networkingv1.Ingress
 
@@ -202,11 +487,25 @@ func (c *controller) updateIngresses() (err error) {
 		return err
 	}
 
-	if len(ingresses) == 0 {
+	if len(ingresses) == 0 && !c.allowZeroIngresses {
 		return errors.New("found 0 ingresses")
 	}
 
+	var defaults namespaceDefaults
+	if c.namespaceDefaults {
+		namespaces, err := c.client.GetNamespaces()
+		if err != nil {
+			return err
+		}
+		defaults = newNamespaceDefaults(namespaces)
+	}
+
 	// Get services
+	if c.referencedServicesOnly {
+		if err := c.client.SetReferencedServices(c.referencedServices(ingresses, defaults)); err != nil {
+			return err
+		}
+	}
 	services, err := c.client.GetServices()
 
 	if err != nil {
@@ -215,29 +514,76 @@ func (c *controller) updateIngresses() (err error) {
 
 	log.Debugf("Found %d services", len(services))
 
-	if len(services) == 0 {
+	if len(services) == 0 && !c.allowZeroIngresses {
 		return errors.New("found 0 services")
 	}
 
-	log.Infof("Found %d ingresses and %d services", len(ingresses), len(services))
+	changed, removed := c.services.sync(services)
+	log.Infof("Found %d ingresses and %d services (%d changed and %d removed since the last update)",
+		len(ingresses), len(services), changed, removed)
+
+	var policies routePolicies
+	if c.routePolicies {
+		allPolicies, err := c.client.GetRoutePolicies()
+		if err != nil {
+			return err
+		}
+		log.Debugf("Found %d route policies", len(allPolicies))
+		policies = newRoutePolicies(allPolicies)
+	}
+
+	var allowLists allowConfigMaps
+	if c.allowFromConfigMaps {
+		configMaps, err := c.client.GetConfigMaps()
+		if err != nil {
+			return err
+		}
+		allowLists = newAllowConfigMaps(configMaps)
+	}
+
+	var apiKeys apiKeySecrets
+	if c.apiKeysFromSecrets {
+		secrets, err := c.client.GetSecrets()
+		if err != nil {
+			return err
+		}
+		apiKeys = newAPIKeySecrets(secrets)
+	}
+
+	listed := time.Now()
 
 	// Combine ingresses and services to create Ingress Entries
-	serviceMap := serviceNamesToClusterIPs(services)
+	reported := make(map[string]bool)
+	skips := make(skipCounts)
 	var skipped []string
 	var entries []IngressEntry
+	var backends []entryBackend
 	for _, ingress := range ingresses {
+		annotations := defaults.annotations(ingress)
 		for _, rule := range ingress.Spec.Rules {
+			if rule.Host == "" {
+				rule.Host = c.hostTemplate.host(ingress)
+			}
+			if !c.shard.Owns(rule.Host) {
+				continue
+			}
 
 			if rule.HTTP != nil {
 				for _, path := range rule.HTTP.Paths {
 
-					serviceName := serviceName{namespace: ingress.Namespace, name: path.Backend.Service.Name}
+					backend := serviceName{namespace: ingress.Namespace, name: path.Backend.Service.Name}
 
-					if address := serviceMap[serviceName]; address == "" {
-						skipped = append(skipped, fmt.Sprintf("%s/%s (service doesn't exist)", ingress.Namespace, ingress.Name))
-					} else if !c.ingressClassSupported(ingress) {
+					if !c.ingressClassSupported(ingress) {
 						skipped = append(skipped, fmt.Sprintf("%s/%s (ingress requests class [%s]; this instance is [%s])",
 							ingress.Namespace, ingress.Name, ingress.Annotations[ingressClassAnnotation], c.name))
+						skips.add(skipClassMismatch)
+					} else if address := c.services.address(backend); address == "" {
+						skipped = append(skipped, fmt.Sprintf("%s/%s (service doesn't exist)", ingress.Namespace, ingress.Name))
+						skips.add(skipServiceMissing)
+						c.recordEvent(reported, fmt.Sprintf("ServiceNotFound:%s/%s:%s", ingress.Namespace, ingress.Name,
+							backend.name), ingress, "ServiceNotFound",
+							fmt.Sprintf("Service %s doesn't exist, so host %s and path %s aren't served",
+								backend.name, rule.Host, path.Path))
 					} else {
 						entry := IngressEntry{
 							Namespace:      ingress.Namespace,
@@ -250,8 +596,12 @@ func (c *controller) updateIngresses() (err error) {
 							StripPaths:     c.defaultStripPath,
 							ExactPath:      c.defaultExactPath, BackendTimeoutSeconds: c.defaultBackendTimeout,
 							BackendMaxConnections: c.defaultBackendMaxConnections,
+							BackendMaxFails:       c.defaultBackendMaxFails,
+							BackendFailTimeout:    c.defaultBackendFailTimeout,
 							ProxyBufferSize:       c.defaultProxyBufferSize,
 							ProxyBufferBlocks:     c.defaultProxyBufferBlocks,
+							InterceptErrors:       c.defaultInterceptErrors,
+							WebSocketUpgrade:      c.defaultWebSocketUpgrade,
 							CreationTimestamp:     ingress.CreationTimestamp.Time,
 							Ingress:               ingress,
 							IngressClass:          ingress.Annotations[ingressClassAnnotation],
@@ -259,13 +609,19 @@ func (c *controller) updateIngresses() (err error) {
 
 						log.Debugf("Found ingress to update: %s/%s", ingress.Namespace, ingress.Name)
 
-						if lbScheme, ok := ingress.Annotations[frontendSchemeAnnotation]; ok {
+						// headless services can only be proxied to through their endpoints, so the service is named instead
+						if address == corev1.ClusterIPNone && c.endpointsMode {
+							entry.ServiceAddress = backend.name + "." + ingress.Namespace + ".svc"
+							entry.Headless = true
+						}
+
+						if lbScheme, ok := annotations[frontendSchemeAnnotation]; ok {
 							entry.LbScheme = lbScheme
-						} else if legacyElbScheme, ok := ingress.Annotations[legacyFrontendElbSchemeAnnotation]; ok {
+						} else if legacyElbScheme, ok := annotations[legacyFrontendElbSchemeAnnotation]; ok {
 							entry.LbScheme = legacyElbScheme
 						}
 
-						if allow, ok := ingress.Annotations[ingressAllowAnnotation]; ok {
+						if allow, ok := annotations[ingressAllowAnnotation]; ok {
 							if allow == "" {
 								entry.Allow = []string{}
 							} else {
@@ -277,7 +633,60 @@ func (c *controller) updateIngresses() (err error) {
 							}
 						}
 
-						if stripPath, ok := ingress.Annotations[stripPathAnnotation]; ok {
+						if ref, ok := annotations[allowFromConfigMapAnnotation]; ok && c.allowFromConfigMaps {
+							allow, found := allowLists.lookup(ingress.Namespace, ref)
+							if !found {
+								log.Warnf("Ingress %s/%s references config map %s in %s, which doesn't exist or isn't labelled %s=true, so none of its CIDRs are allowed",
+									ingress.Namespace, ingress.Name, ref, allowFromConfigMapAnnotation, k8s.AllowListLabel)
+							}
+							// the config map adds to sky.uk/allow if it's set, otherwise it replaces the default
+							if _, ok := annotations[ingressAllowAnnotation]; ok {
+								entry.Allow = append(append([]string{}, entry.Allow...), allow...)
+							} else {
+								entry.Allow = append([]string{}, allow...)
+							}
+						}
+
+						if name, ok := annotations[apiKeysFromSecretAnnotation]; ok && c.apiKeysFromSecrets {
+							keys, found := apiKeys.lookup(ingress.Namespace, name)
+							if !found {
+								log.Warnf("Ingress %s/%s references secret %s in %s, which doesn't exist, so no API keys are allowed",
+									ingress.Namespace, ingress.Name, name, apiKeysFromSecretAnnotation)
+								keys = map[string]string{}
+							}
+							entry.APIKeys = keys
+						}
+
+						if limit, ok := annotations[apiKeyRateLimitAnnotation]; ok {
+							if tmp, err := strconv.Atoi(limit); err != nil || tmp < 1 {
+								log.Warnf("Ingress %s/%s has an invalid API key rate limit annotation [%s]. Ignoring it",
+									ingress.Namespace, ingress.Name, limit)
+							} else {
+								entry.APIKeyRateLimit = tmp
+							}
+						}
+
+						if entry.APIKeys != nil || entry.APIKeyRateLimit > 0 {
+							entry.APIKeyHeader = DefaultAPIKeyHeader
+							if header, ok := annotations[apiKeyHeaderAnnotation]; ok {
+								if header = strings.TrimSpace(header); apiKeyHeader.MatchString(header) {
+									entry.APIKeyHeader = header
+								} else {
+									log.Warnf("Ingress %s/%s has an invalid API key header annotation [%s]. Using default",
+										ingress.Namespace, ingress.Name, header)
+								}
+							}
+						}
+
+						if countries, ok := annotations[allowCountriesAnnotation]; ok {
+							entry.AllowCountries = parseCountries(countries)
+						}
+
+						if countries, ok := annotations[denyCountriesAnnotation]; ok {
+							entry.DenyCountries = parseCountries(countries)
+						}
+
+						if stripPath, ok := annotations[stripPathAnnotation]; ok {
 							if stripPath == "true" {
 								entry.StripPaths = true
 							} else if stripPath == "false" {
@@ -288,7 +697,7 @@ func (c *controller) updateIngresses() (err error) {
 							}
 						}
 
-						if exactPath, ok := ingress.Annotations[exactPathAnnotation]; ok {
+						if exactPath, ok := annotations[exactPathAnnotation]; ok {
 							if exactPath == "true" {
 								entry.ExactPath = true
 							} else if exactPath == "false" {
@@ -299,22 +708,246 @@ func (c *controller) updateIngresses() (err error) {
 							}
 						}
 
-						if backendKeepAlive, ok := ingress.Annotations[legacyBackendKeepaliveSeconds]; ok {
+						// the path type takes precedence over the annotation, except for ImplementationSpecific
+						if path.PathType != nil {
+							switch *path.PathType {
+							case networkingv1.PathTypeExact:
+								entry.ExactPath = true
+							case networkingv1.PathTypePrefix:
+								entry.ExactPath = false
+								entry.PrefixPath = true
+							}
+						}
+
+						if pathRegex, ok := annotations[pathRegexAnnotation]; ok {
+							if pathRegex == "true" {
+								entry.PathRegex = true
+								entry.ExactPath = false
+								entry.PrefixPath = false
+							} else if pathRegex != "false" {
+								log.Warnf("Ingress %s/%s has an invalid path regex annotation [%s]. Using default",
+									ingress.Namespace, ingress.Name, pathRegex)
+							}
+						}
+
+						if sslPassthrough, ok := annotations[sslPassthroughAnnotation]; ok {
+							if sslPassthrough == "true" {
+								entry.SSLPassthrough = true
+							} else if sslPassthrough != "false" {
+								log.Warnf("Ingress %s/%s has an invalid ssl passthrough annotation [%s]. Using default",
+									ingress.Namespace, ingress.Name, sslPassthrough)
+							}
+						}
+
+						if drain, ok := annotations[drainAnnotation]; ok {
+							if drain == "true" {
+								entry.Drain = true
+							} else if drain != "false" {
+								log.Warnf("Ingress %s/%s has an invalid drain annotation [%s]. Using default",
+									ingress.Namespace, ingress.Name, drain)
+							}
+						}
+
+						if acme, ok := annotations[acmeAnnotation]; ok {
+							if acme == "true" {
+								entry.ACME = true
+							} else if acme != "false" {
+								log.Warnf("Ingress %s/%s has an invalid acme annotation [%s]. Using default",
+									ingress.Namespace, ingress.Name, acme)
+							}
+						}
+
+						if backendSPIFFE, ok := annotations[backendSPIFFEAnnotation]; ok {
+							if backendSPIFFE == "true" {
+								entry.BackendSPIFFE = true
+							} else if backendSPIFFE != "false" {
+								log.Warnf("Ingress %s/%s has an invalid backend spiffe annotation [%s]. Using default",
+									ingress.Namespace, ingress.Name, backendSPIFFE)
+							}
+						}
+
+						if entry.BackendSPIFFE {
+							entry.BackendSPIFFEName = backend.name + "." + ingress.Namespace + ".svc"
+							if name, ok := annotations[backendSPIFFENameAnnotation]; ok {
+								if name = strings.TrimSpace(name); validDNSName(name) {
+									entry.BackendSPIFFEName = name
+								} else {
+									log.Warnf("Ingress %s/%s has an invalid backend spiffe name annotation [%s]. Using default",
+										ingress.Namespace, ingress.Name, name)
+								}
+							}
+						}
+
+						if tracing, ok := annotations[tracingAnnotation]; ok {
+							if tracing == "false" {
+								entry.DisableTracing = true
+							} else if tracing != "true" {
+								log.Warnf("Ingress %s/%s has an invalid tracing annotation [%s]. Using default",
+									ingress.Namespace, ingress.Name, tracing)
+							}
+						}
+
+						if sampleRate, ok := annotations[tracingSampleRateAnnotation]; ok {
+							rate, err := strconv.ParseFloat(sampleRate, 64)
+							if err != nil || rate < 0 || rate > 1 {
+								log.Warnf("Ingress %s/%s has an invalid tracing sample rate annotation [%s], which should be between 0 and 1. Using default",
+									ingress.Namespace, ingress.Name, sampleRate)
+							} else if rate == 0 {
+								entry.DisableTracing = true
+							} else {
+								entry.TracingSampleRate = rate
+							}
+						}
+
+						if protocol, ok := annotations[backendProtocolAnnotation]; ok {
+							if validBackendProtocol(protocol) {
+								entry.BackendProtocol = protocol
+							} else {
+								log.Warnf("Ingress %s/%s has an invalid backend protocol annotation [%s]. Using default",
+									ingress.Namespace, ingress.Name, protocol)
+							}
+						}
+
+						if profile, ok := annotations[securityHeadersAnnotation]; ok {
+							entry.SecurityHeaders = strings.TrimSpace(profile)
+						}
+
+						if mode, ok := annotations[trailingSlashAnnotation]; ok {
+							entry.TrailingSlash = strings.TrimSpace(mode)
+						}
+
+						if upgrade, ok := annotations[webSocketUpgradeAnnotation]; ok {
+							if tmp, err := strconv.ParseBool(upgrade); err != nil {
+								log.Warnf("Ingress %s/%s has an invalid websocket upgrade annotation [%s]. Using default",
+									ingress.Namespace, ingress.Name, upgrade)
+							} else {
+								entry.WebSocketUpgrade = tmp
+							}
+						}
+
+						if timeout, ok := annotations[webSocketTimeoutAnnotation]; ok {
+							if tmp, err := strconv.Atoi(timeout); err != nil || tmp < 1 {
+								log.Warnf("Ingress %s/%s has an invalid websocket timeout annotation [%s]. Using default",
+									ingress.Namespace, ingress.Name, timeout)
+							} else {
+								entry.WebSocketTimeoutSeconds = tmp
+							}
+						}
+
+						if name, ok := annotations[statsNameAnnotation]; ok {
+							if name = strings.TrimSpace(name); validStatsName(name) {
+								entry.StatsName = name
+							} else {
+								log.Warnf("Ingress %s/%s has an invalid stats name annotation [%s]. Ignoring it",
+									ingress.Namespace, ingress.Name, name)
+							}
+						}
+
+						if secret, ok := annotations[vaultHtpasswdAnnotation]; ok {
+							if secret = strings.TrimSpace(secret); validSecretName(secret) {
+								entry.HtpasswdSecret = secret
+							} else {
+								log.Warnf("Ingress %s/%s has an invalid vault htpasswd annotation [%s]. Ignoring it",
+									ingress.Namespace, ingress.Name, secret)
+							}
+						}
+
+						if handler, ok := annotations[njsContentAnnotation]; ok {
+							if handler = strings.TrimSpace(handler); validNJSHandler(handler) {
+								entry.NJSContent = handler
+							} else {
+								log.Warnf("Ingress %s/%s has an invalid njs content annotation [%s]. Ignoring it",
+									ingress.Namespace, ingress.Name, handler)
+							}
+						}
+
+						if handler, ok := annotations[njsHeaderFilterAnnotation]; ok {
+							if handler = strings.TrimSpace(handler); validNJSHandler(handler) {
+								entry.NJSHeaderFilter = handler
+							} else {
+								log.Warnf("Ingress %s/%s has an invalid njs header filter annotation [%s]. Ignoring it",
+									ingress.Namespace, ingress.Name, handler)
+							}
+						}
+
+						if paths, ok := annotations[internalPathsAnnotation]; ok {
+							if internalPaths, err := parseInternalPaths(paths); err != nil {
+								log.Warnf("Ingress %s/%s has an invalid internal paths annotation [%s]: %v. Ignoring it",
+									ingress.Namespace, ingress.Name, paths, err)
+							} else {
+								entry.InternalPaths = internalPaths
+							}
+						}
+
+						if codes, ok := annotations[interceptErrorsAnnotation]; ok {
+							if interceptErrors, err := ParseInterceptErrors(codes); err != nil {
+								log.Warnf("Ingress %s/%s has an invalid intercept errors annotation [%s]: %v. Using default",
+									ingress.Namespace, ingress.Name, codes, err)
+							} else {
+								entry.InterceptErrors = interceptErrors
+							}
+						}
+
+						if backup, ok := annotations[backupServiceAnnotation]; ok {
+							name, port, err := parseBackupService(backup, path.Backend.Service.Port.Number)
+							if err != nil {
+								log.Warnf("Ingress %s/%s has an invalid backup service annotation [%s]: %v. Ignoring it",
+									ingress.Namespace, ingress.Name, backup, err)
+							} else if address := c.services.address(serviceName{namespace: ingress.Namespace, name: name}); address == "" {
+								log.Warnf("Ingress %s/%s has a backup service %s which doesn't exist. Ignoring it",
+									ingress.Namespace, ingress.Name, name)
+							} else if address == corev1.ClusterIPNone {
+								log.Warnf("Ingress %s/%s has a backup service %s which is headless. Ignoring it",
+									ingress.Namespace, ingress.Name, name)
+							} else {
+								entry.BackupServiceAddress = address
+								entry.BackupServicePort = port
+							}
+						}
+
+						if backendKeepAlive, ok := annotations[legacyBackendKeepaliveSeconds]; ok {
 							tmp, _ := strconv.Atoi(backendKeepAlive)
 							entry.BackendTimeoutSeconds = tmp
 						}
 
-						if timeout, ok := ingress.Annotations[backendTimeoutSeconds]; ok {
+						if timeout, ok := annotations[backendTimeoutSeconds]; ok {
 							tmp, _ := strconv.Atoi(timeout)
 							entry.BackendTimeoutSeconds = tmp
 						}
 
-						if maxConnections, ok := ingress.Annotations[backendMaxConnections]; ok {
+						if maxConnections, ok := annotations[backendMaxConnections]; ok {
 							tmp, _ := strconv.Atoi(maxConnections)
 							entry.BackendMaxConnections = tmp
 						}
 
-						if maxRequestsPerConnection, ok := ingress.Annotations[backendMaxRequestsPerConnection]; ok {
+						if keepaliveCount, ok := annotations[backendKeepaliveCount]; ok {
+							tmp, err := strconv.Atoi(keepaliveCount)
+							if err != nil || tmp < 1 {
+								log.Warnf("invalid value %v set for annotation for %q. Will continue with defaults", keepaliveCount, backendKeepaliveCount)
+							} else {
+								entry.BackendKeepaliveCount = tmp
+							}
+						}
+
+						if maxFails, ok := annotations[backendMaxFails]; ok {
+							tmp, err := strconv.Atoi(maxFails)
+							if err != nil || tmp < 0 {
+								log.Warnf("invalid value %v set for annotation for %q. Will continue with defaults", maxFails, backendMaxFails)
+							} else {
+								entry.BackendMaxFails = tmp
+							}
+						}
+
+						if failTimeout, ok := annotations[backendFailTimeout]; ok {
+							timeout, err := time.ParseDuration(failTimeout)
+							if err != nil || timeout < 0 {
+								log.Warnf("invalid value %v set for annotation for %q. Will continue with defaults", failTimeout, backendFailTimeout)
+							} else {
+								entry.BackendFailTimeout = timeout
+							}
+						}
+
+						if maxRequestsPerConnection, ok := annotations[backendMaxRequestsPerConnection]; ok {
 							intVal, err := strconv.ParseUint(maxRequestsPerConnection, 10, 64)
 							if err != nil {
 								log.Warnf("invalid value %v set for annotation for %q. Will continue with defaults", maxRequestsPerConnection, backendMaxRequestsPerConnection)
@@ -323,7 +956,7 @@ func (c *controller) updateIngresses() (err error) {
 							}
 						}
 
-						if connectionKeepalive, ok := ingress.Annotations[backendConnectionKeepalive]; ok {
+						if connectionKeepalive, ok := annotations[backendConnectionKeepalive]; ok {
 							keepaliveTimeout, err := time.ParseDuration(connectionKeepalive)
 							if err != nil {
 								log.Warnf("invalid value %v set for annotation for %q. Will continue with defaults", connectionKeepalive, backendConnectionKeepalive)
@@ -332,7 +965,7 @@ func (c *controller) updateIngresses() (err error) {
 							}
 						}
 
-						if proxyBufferSizeString, ok := ingress.Annotations[proxyBufferSizeAnnotation]; ok {
+						if proxyBufferSizeString, ok := annotations[proxyBufferSizeAnnotation]; ok {
 							tmp, _ := strconv.Atoi(proxyBufferSizeString)
 							entry.ProxyBufferSize = tmp
 							if tmp > maxAllowedProxyBufferSize {
@@ -341,7 +974,7 @@ func (c *controller) updateIngresses() (err error) {
 							}
 						}
 
-						if proxyBufferBlocksString, ok := ingress.Annotations[proxyBufferBlocksAnnotation]; ok {
+						if proxyBufferBlocksString, ok := annotations[proxyBufferBlocksAnnotation]; ok {
 							tmp, _ := strconv.Atoi(proxyBufferBlocksString)
 							entry.ProxyBufferBlocks = tmp
 							if tmp > maxAllowedProxyBufferBlocks {
@@ -350,16 +983,31 @@ func (c *controller) updateIngresses() (err error) {
 							}
 						}
 
+						if c.routePolicies {
+							if policy := policies.find(ingress, rule.Host); policy != nil {
+								log.Debugf("Applying route policy %s/%s to %s/%s", policy.Namespace, policy.Name, ingress.Namespace, ingress.Name)
+								applyRoutePolicy(&entry, policy)
+							}
+						}
+
 						if err := entry.validate(); err == nil {
 							entries = append(entries, entry)
+							if c.checkEndpoints || c.endpointsMode {
+								backends = append(backends, entryBackend{index: len(entries) - 1, entry: entry, service: backend.name})
+							}
 						} else {
 							skipped = append(skipped, fmt.Sprintf("%s (%v)", entry.NamespaceName(), err))
+							skips.add(skipInvalidEntry)
+							c.recordEvent(reported, fmt.Sprintf("InvalidIngressEntry:%s:%s%s", entry.NamespaceName(),
+								entry.Host, entry.Path), ingress, "InvalidIngressEntry",
+								fmt.Sprintf("Host %s and path %s aren't served: %v", entry.Host, entry.Path, err))
 						}
 					}
 				}
 
 			} else {
 				skipped = append(skipped, fmt.Sprintf("%s/%s (HTTP key doesn't exist in this ingress definition)", ingress.Namespace, ingress.Name))
+				skips.add(skipNoHTTPRules)
 			}
 		}
 	}
@@ -371,17 +1019,258 @@ func (c *controller) updateIngresses() (err error) {
 		}
 	}
 
-	for _, u := range c.updaters {
-		log.Debugf("Calling updater %v", u)
-		if err := u.Update(entries); err != nil {
+	var unready []entryBackend
+	if c.checkEndpoints || c.endpointsMode {
+		if unready, err = c.findEndpoints(entries, backends); err != nil {
 			return err
 		}
 	}
 
+	entries = c.dropUnreadyHeadlessEntries(entries, reported, skips)
+	entries = c.rejectUnownedHosts(entries, reported, skips)
+	entries = c.resolveConflicts(entries, reported, skips)
+	entries = c.enforceNamespaceQuotas(entries, reported, skips)
+	skips.set()
+	c.reportUnreadyBackends(unready, reported)
+	c.reportedEvents = reported
+
+	ingressEntries.Set(float64(len(entries)))
+	if len(entries) == 0 {
+		log.Warn("No ingresses are configured, so all requests will get a 404")
+	}
+	entries = c.removed.add(entries, time.Now())
+
+	built := time.Now()
+	err = updateAll(c.updateStages, entries, c.updaterTimeout)
+	took := time.Since(start)
+	updateDuration.Observe(took.Seconds())
+	if c.slowUpdateThreshold > 0 && took > c.slowUpdateThreshold {
+		log.Warnf("Update took %v, longer than %v: listing %v, building %d entries %v, updating %v",
+			took.Round(time.Millisecond), c.slowUpdateThreshold, listed.Sub(start).Round(time.Millisecond),
+			len(entries), built.Sub(listed).Round(time.Millisecond), breakdown(c.updateStages))
+	}
+	if err != nil {
+		return err
+	}
+	lastSuccessfulUpdate.SetToCurrentTime()
+	applied := time.Now()
+	c.applied.set(entries, applied)
+	c.writeRoutingTable(entries, applied)
+	c.audit.record(entries, applied)
+
 	return nil
 }
 
+// rejectUnownedHosts drops entries for hosts owned by another namespace, when host ownership is enforced. Each
+// dropped entry is logged and counted, and its ingress gets an event the first time it's rejected.
+func (c *controller) rejectUnownedHosts(entries []IngressEntry, reported map[string]bool,
+	skips skipCounts) []IngressEntry {
+	ingressHostRejections.Reset()
+	if !c.hostOwnership {
+		return entries
+	}
+	allowed, rejections := c.hostOwners.claim(entries)
+
+	for _, rejection := range rejections {
+		rejected := rejection.rejected
+		log.Infof("Ignoring %s because its host is owned by namespace %s", rejected, rejection.owner.Namespace)
+		ingressHostRejections.WithLabelValues(rejected.Namespace, rejected.Name, rejected.Host).Set(1)
+		skips.add(skipHostNotOwned)
+
+		message := fmt.Sprintf("Host %s is owned by namespace %s, as %s claimed it first",
+			rejected.Host, rejection.owner.Namespace, rejection.owner.NamespaceName())
+		c.recordEvent(reported, rejection.String(), rejected.Ingress, "HostOwnedByAnotherNamespace", message)
+	}
+
+	return allowed
+}
+
+// resolveConflicts drops entries which have the same host and path as another. Each dropped entry is logged and
+// counted, and its ingress gets an event the first time it loses out.
+func (c *controller) resolveConflicts(entries []IngressEntry, reported map[string]bool,
+	skips skipCounts) []IngressEntry {
+	strategy := c.conflictStrategy
+	if strategy == "" {
+		strategy = ConflictByName
+	}
+	resolved, conflicts := resolveConflicts(entries, strategy)
+
+	ingressConflicts.Reset()
+	for _, conflict := range conflicts {
+		loser := conflict.loser
+		log.Infof("Ignoring %s because it duplicates the host/path of %s", loser, conflict.winner)
+		ingressConflicts.WithLabelValues(loser.Namespace, loser.Name, loser.Host, loser.Path).Set(1)
+		skips.add(skipConflict)
+
+		message := fmt.Sprintf("Host %s and path %s are also used by %s, which is served instead (%s strategy)",
+			loser.Host, loser.Path, conflict.winner.NamespaceName(), strategy)
+		c.recordEvent(reported, conflict.String(), loser.Ingress, "HostPathConflict", message)
+	}
+
+	return resolved
+}
+
+// enforceNamespaceQuotas drops entries beyond their namespace's quota. Each dropped entry is logged and counted, and
+// its ingress gets an event the first time it's rejected.
+func (c *controller) enforceNamespaceQuotas(entries []IngressEntry, reported map[string]bool,
+	skips skipCounts) []IngressEntry {
+	ingressQuotaRejections.Reset()
+	allowed, rejections := c.namespaceQuota.enforce(entries)
+
+	for _, rejection := range rejections {
+		rejected := rejection.entry
+		log.Infof("Ignoring %s because namespace %s has used its quota of %d %s", rejected, rejected.Namespace,
+			rejection.limit, rejection.resource)
+		ingressQuotaRejections.WithLabelValues(rejected.Namespace, rejected.Name, rejected.Host, rejected.Path,
+			rejection.resource).Set(1)
+		skips.add(skipQuotaExceeded)
+
+		message := fmt.Sprintf("Host %s and path %s aren't served, as namespace %s has used its quota of %d %s",
+			rejected.Host, rejected.Path, rejected.Namespace, rejection.limit, rejection.resource)
+		c.recordEvent(reported, rejection.String(), rejected.Ingress, "NamespaceQuotaExceeded", message)
+	}
+
+	return allowed
+}
+
+// entryBackend is an entry, its index in the entries, and the name of its service.
+type entryBackend struct {
+	index   int
+	entry   IngressEntry
+	service string
+}
+
+// findEndpoints returns the backends whose service port has no ready endpoints if they're checked, and sets the
+// ready endpoints of the entries in endpoints mode. Only the endpoint slices of the services used by the backends are
+// watched.
+func (c *controller) findEndpoints(entries []IngressEntry, backends []entryBackend) ([]entryBackend, error) {
+	used := make(map[string]bool)
+	var services []*corev1.Service
+	for _, backend := range backends {
+		key := backend.entry.Namespace + "/" + backend.service
+		if !used[key] {
+			used[key] = true
+			services = append(services, c.services.get(backend.entry.Namespace, backend.service))
+		}
+	}
+	if err := c.client.SetEndpointSliceServices(used); err != nil {
+		return nil, err
+	}
+	slices, err := c.client.GetEndpointSlices()
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Found %d endpoint slices for %d services", len(slices), len(used))
+
+	var weights podWeights
+	if c.endpointsMode && c.upstreamWeights {
+		pods, err := c.client.GetPods()
+		if err != nil {
+			return nil, err
+		}
+		weights = newPodWeights(pods)
+	}
+
+	ready := newReadyEndpoints(services, slices, c.endpointsZone, weights)
+	var unready []entryBackend
+	for _, backend := range backends {
+		endpoints := ready.forPort(backend.entry.Namespace, backend.service, backend.entry.ServicePort)
+		// headless entries without endpoints are dropped instead
+		if len(endpoints) == 0 && c.checkEndpoints && !backend.entry.Headless {
+			unready = append(unready, backend)
+		}
+		if c.endpointsMode {
+			entries[backend.index].Endpoints = endpoints
+		}
+	}
+	return unready, nil
+}
+
+// referencedServices returns the services, by namespace/name, of the backends and backup services of the ingresses
+// this controller serves.
+func (c *controller) referencedServices(ingresses []*networkingv1.Ingress, defaults namespaceDefaults) map[string]bool {
+	referenced := make(map[string]bool)
+	for _, ingress := range ingresses {
+		if !c.ingressClassSupported(ingress) {
+			continue
+		}
+		if backup, ok := defaults.annotations(ingress)[backupServiceAnnotation]; ok {
+			if name, _, err := parseBackupService(backup, 0); err == nil {
+				referenced[ingress.Namespace+"/"+name] = true
+			}
+		}
+		for _, rule := range ingress.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				if path.Backend.Service != nil {
+					referenced[ingress.Namespace+"/"+path.Backend.Service.Name] = true
+				}
+			}
+		}
+	}
+	return referenced
+}
+
+// reportUnreadyBackends logs and counts entries whose service port has no ready endpoints, as requests to them can
+// only get a 502. Each ingress gets an event the first time its backend has no ready endpoints.
+func (c *controller) reportUnreadyBackends(unready []entryBackend, reported map[string]bool) {
+	ingressUnreadyBackends.Reset()
+	for _, backend := range unready {
+		entry := backend.entry
+		log.Infof("%s has no ready endpoints for service %s port %d", entry, backend.service, entry.ServicePort)
+		ingressUnreadyBackends.WithLabelValues(entry.Namespace, entry.Name, entry.Host, entry.Path).Set(1)
+
+		message := fmt.Sprintf("Service %s has no ready endpoints for port %d, so requests to host %s and path %s will fail",
+			backend.service, entry.ServicePort, entry.Host, entry.Path)
+		key := fmt.Sprintf("NoReadyEndpoints:%s:%s:%d", entry.NamespaceName(), backend.service, entry.ServicePort)
+		c.recordEvent(reported, key, entry.Ingress, "NoReadyEndpoints", message)
+	}
+}
+
+// dropUnreadyHeadlessEntries drops the entries of headless services without ready endpoints, as there's nothing to
+// proxy to. Each dropped entry is logged and counted, and its ingress gets an event the first time it's dropped.
+func (c *controller) dropUnreadyHeadlessEntries(entries []IngressEntry, reported map[string]bool,
+	skips skipCounts) []IngressEntry {
+	ready := entries[:0]
+	for _, entry := range entries {
+		if !entry.Headless || len(entry.Endpoints) > 0 {
+			ready = append(ready, entry)
+			continue
+		}
+		log.Infof("Ignoring %s because its headless service has no ready endpoints", entry)
+		skips.add(skipHeadlessUnready)
+
+		message := fmt.Sprintf("Headless service %s has no ready endpoints for port %d, so host %s and path %s "+
+			"aren't served", entry.ServiceAddress, entry.ServicePort, entry.Host, entry.Path)
+		key := fmt.Sprintf("HeadlessServiceUnready:%s:%s:%d", entry.NamespaceName(), entry.ServiceAddress,
+			entry.ServicePort)
+		c.recordEvent(reported, key, entry.Ingress, "HeadlessServiceUnready", message)
+	}
+	return ready
+}
+
+// recordEvent records an event on the ingress, unless it was reported by the previous update. The key is added to
+// reported once the event is recorded, so failures are retried on the next update.
+func (c *controller) recordEvent(reported map[string]bool, key string, ingress *networkingv1.Ingress,
+	reason, message string) {
+	if c.reportedEvents[key] || ingress == nil {
+		reported[key] = true
+		return
+	}
+	if err := c.client.RecordIngressEvent(ingress, reason, message); err != nil {
+		log.Warnf("Unable to record %s event on %s/%s, will retry on the next update: %v",
+			reason, ingress.Namespace, ingress.Name, err)
+		return
+	}
+	reported[key] = true
+}
+
 func (c *controller) ingressClassSupported(ingress *networkingv1.Ingress) bool {
+	if c.allIngressClasses {
+		return true
+	}
 
 	isValid := false
 
@@ -399,17 +1288,6 @@ type serviceName struct {
 	name      string
 }
 
-func serviceNamesToClusterIPs(services []*corev1.Service) map[serviceName]string {
-	m := make(map[serviceName]string)
-
-	for _, svc := range services {
-		name := serviceName{namespace: svc.Namespace, name: svc.Name}
-		m[name] = svc.Spec.ClusterIP
-	}
-
-	return m
-}
-
 func (c *controller) Stop() error {
 	c.Lock()
 	defer c.Unlock()
@@ -421,12 +1299,7 @@ func (c *controller) Stop() error {
 	log.Info("Stopping controller")
 	close(c.stopCh)
 
-	for i := range c.updaters {
-		u := c.updaters[len(c.updaters)-1-i]
-		if err := u.Stop(); err != nil {
-			log.Warnf("Error while stopping %v: %v", u, err)
-		}
-	}
+	stopAll(c.updateStages, c.shutdown)
 
 	c.started = false
 	log.Info("Controller has stopped")
@@ -451,6 +1324,29 @@ func (c *controller) Health() error {
 		return fmt.Errorf("updates failed to apply: %v", err)
 	}
 
+	if c.watchStaleAfter > 0 {
+		if err := staleWatches(c.client.WatchActivity(), c.watchStaleAfter, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Liveness doesn't fail for failed updates or unhealthy updaters, which are often transient, such as AWS being
+// unavailable, so restarting doesn't help. It succeeds until the controller is started, as updaters may take a while
+// to start, and doesn't take the lock Start holds while they do.
+func (c *controller) Liveness() error {
+	if c.loopStuckAfter <= 0 {
+		return nil
+	}
+	last := c.loopActivity.Get()
+	if last.IsZero() {
+		return nil
+	}
+	if stuck := time.Since(last); stuck > c.loopStuckAfter {
+		return fmt.Errorf("update loop has been stuck for %v", stuck.Round(time.Second))
+	}
 	return nil
 }
 
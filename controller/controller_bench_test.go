@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	fake "github.com/sky-uk/feed/util/test"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// benchmarkIngresses is roughly the number of ingresses in our largest clusters, each using one of the benchmark
+// services.
+const benchmarkIngresses = 2500
+
+type noopUpdater struct{}
+
+func (noopUpdater) Start() error                { return nil }
+func (noopUpdater) Stop() error                 { return nil }
+func (noopUpdater) Update(IngressEntries) error { return nil }
+func (noopUpdater) Health() error               { return nil }
+func (noopUpdater) Readiness() error            { return nil }
+func (noopUpdater) String() string              { return "noop" }
+
+func BenchmarkUpdateIngresses(b *testing.B) {
+	services := createBenchmarkServices()
+	var ingresses []*networkingv1.Ingress
+	for i := 0; i < benchmarkIngresses; i++ {
+		service := services[i*len(services)/benchmarkIngresses]
+		ingresses = append(ingresses, createIngressesFixture(service.Namespace, fmt.Sprintf("host-%d.example.com", i),
+			service.Name, ingressSvcPort, map[string]string{ingressClassAnnotation: defaultIngressClass}, ingressPath)...)
+	}
+
+	client := new(fake.FakeClient)
+	client.On("GetAllIngresses").Return(ingresses, nil)
+	client.On("GetServices").Return(services, nil)
+	controller := New(Config{
+		Name:             defaultIngressClass,
+		KubernetesClient: client,
+		Updaters:         []Updater{noopUpdater{}},
+	}, make(chan struct{})).(*controller)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := controller.updateIngresses(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
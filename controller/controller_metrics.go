@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+// reasons an ingress entry is skipped, for the skipped_ingresses metric
+const (
+	skipClassMismatch  = "class_mismatch"
+	skipServiceMissing = "service_missing"
+	skipInvalidEntry   = "invalid_entry"
+	skipNoHTTPRules    = "no_http_rules"
+	skipConflict       = "conflict"
+	skipHostNotOwned   = "host_not_owned"
+	skipQuotaExceeded  = "quota_exceeded"
+	// the headless service has no ready endpoints to proxy to, in endpoints mode
+	skipHeadlessUnready = "headless_service_unready"
+)
+
+var skipReasons = []string{skipClassMismatch, skipServiceMissing, skipInvalidEntry, skipNoHTTPRules, skipConflict,
+	skipHostNotOwned, skipQuotaExceeded, skipHeadlessUnready}
+
+// skipCounts are the number of entries an update skips, by reason.
+type skipCounts map[string]int
+
+func (s skipCounts) add(reason string) {
+	s[reason]++
+}
+
+// set sets the skipped_ingresses metric to the counts, so entries which are no longer skipped stop being counted.
+func (s skipCounts) set() {
+	for _, reason := range skipReasons {
+		skippedIngresses.WithLabelValues(reason).Set(float64(s[reason]))
+	}
+}
+
+var once sync.Once
+var lastSuccessfulUpdate prometheus.Gauge
+var ingressEntries prometheus.Gauge
+var drainingEntries prometheus.Gauge
+var ingressConflicts *prometheus.GaugeVec
+var ingressHostRejections *prometheus.GaugeVec
+var ingressQuotaRejections *prometheus.GaugeVec
+var ingressUnreadyBackends *prometheus.GaugeVec
+var skippedIngresses *prometheus.GaugeVec
+var routingTableWriteFailures prometheus.Counter
+var auditLogWriteFailures prometheus.Counter
+var updaterLastSuccessfulUpdate *prometheus.GaugeVec
+var updateDuration prometheus.Histogram
+var updaterUpdateDuration *prometheus.HistogramVec
+
+func initMetrics() {
+	once.Do(func() {
+		lastSuccessfulUpdate = metrics.RegisterNewDefaultGauge(metrics.PrometheusControllerSubsystem,
+			"last_successful_update_timestamp",
+			"The unix time in seconds at which all updaters were last successfully updated.")
+		updaterLastSuccessfulUpdate = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusControllerSubsystem,
+			"updater_last_successful_update_timestamp",
+			"The unix time in seconds at which each updater was last successfully updated.",
+			[]string{"updater"})
+		updateDuration = metrics.RegisterNewDefaultHistogram(metrics.PrometheusControllerSubsystem,
+			"update_duration_seconds",
+			"Time taken by each update, from listing the ingresses until every updater has been updated.", nil)
+		updaterUpdateDuration = metrics.RegisterNewDefaultHistogramVec(metrics.PrometheusControllerSubsystem,
+			"updater_update_duration_seconds",
+			"Time taken by each updater to be updated, including updates which fail or time out.",
+			nil, []string{"updater"})
+		ingressEntries = metrics.RegisterNewDefaultGauge(metrics.PrometheusControllerSubsystem,
+			"ingress_entries",
+			"The number of ingress entries in the last update. Zero means every request gets a 404.")
+		drainingEntries = metrics.RegisterNewDefaultGauge(metrics.PrometheusControllerSubsystem,
+			"draining_ingress_entries",
+			"The number of removed ingress entries in the last update which are kept draining until their window ends.")
+		ingressConflicts = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusControllerSubsystem,
+			"ingress_conflicts",
+			"Set to 1 for each ingress entry which isn't used, because another ingress has the same host and path.",
+			[]string{"namespace", "name", "host", "path"})
+		ingressHostRejections = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusControllerSubsystem,
+			"ingress_host_rejections",
+			"Set to 1 for each ingress which isn't used, because its host is owned by another namespace.",
+			[]string{"namespace", "name", "host"})
+		ingressQuotaRejections = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusControllerSubsystem,
+			"ingress_quota_rejections",
+			"Set to 1 for each ingress entry which isn't used, because its namespace has used its quota of the resource.",
+			[]string{"namespace", "name", "host", "path", "resource"})
+		ingressUnreadyBackends = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusControllerSubsystem,
+			"ingress_unready_backends",
+			"Set to 1 for each ingress entry whose service port has no ready endpoints, when endpoints are checked.",
+			[]string{"namespace", "name", "host", "path"})
+		skippedIngresses = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusControllerSubsystem,
+			"skipped_ingresses",
+			"The number of ingress entries left out of the last update, by reason.",
+			[]string{"reason"})
+		routingTableWriteFailures = metrics.RegisterNewDefaultCounter(metrics.PrometheusControllerSubsystem,
+			"routing_table_write_failures",
+			"The number of successful updates whose routing table couldn't be written to the routing table file.")
+		auditLogWriteFailures = metrics.RegisterNewDefaultCounter(metrics.PrometheusControllerSubsystem,
+			"audit_log_write_failures",
+			"The number of successful updates whose changes couldn't be appended to the audit log. They're recorded "+
+				"again with the next update.")
+	})
+}
@@ -3,19 +3,28 @@ package controller
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sky-uk/feed/k8s"
+	"github.com/sky-uk/feed/util/metrics"
 	fake "github.com/sky-uk/feed/util/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
 const smallWaitTime = time.Millisecond * 50
 const defaultIngressClass = "main"
 
@@ -285,6 +294,93 @@ func TestControllerReturnsErrorIfUpdaterFails(t *testing.T) {
 	assert.Error(t, controller.Start())
 }
 
+func TestControllerIsAliveWhileUpdatesFail(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	controller := New(Config{
+		Updaters:                     []Updater{updater},
+		KubernetesClient:             client,
+		DefaultAllow:                 ingressDefaultAllow,
+		DefaultBackendTimeoutSeconds: backendTimeout,
+		LoopStuckAfter:               time.Minute,
+	}, make(chan struct{}))
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Update", mock.Anything).Return(fmt.Errorf("kaboom, update failed :("))
+	updater.On("Health").Return(nil)
+
+	client.On("GetAllIngresses").Return(createDefaultIngresses(), nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	asserter.NoError(controller.Liveness(), "should be alive until started")
+	asserter.NoError(controller.Start())
+
+	// when
+	updateCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+
+	// then
+	asserter.Error(controller.Health())
+	asserter.NoError(controller.Liveness())
+
+	// cleanup
+	_ = controller.Stop()
+}
+
+func TestControllerIsNotAliveIfAnUpdateIsStuck(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	controller := New(Config{
+		Updaters:                     []Updater{updater},
+		KubernetesClient:             client,
+		DefaultAllow:                 ingressDefaultAllow,
+		DefaultBackendTimeoutSeconds: backendTimeout,
+		LoopStuckAfter:               smallWaitTime,
+	}, make(chan struct{}))
+
+	ingressWatcher, updateCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+
+	unstick := make(chan struct{})
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Update", mock.Anything).Run(func(mock.Arguments) { <-unstick }).Return(nil)
+	updater.On("Health").Return(nil)
+
+	client.On("GetAllIngresses").Return(createDefaultIngresses(), nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	asserter.NoError(controller.Start())
+	asserter.NoError(controller.Liveness())
+
+	// when
+	updateCh <- struct{}{}
+	time.Sleep(2 * smallWaitTime)
+
+	// then
+	asserter.Error(controller.Liveness())
+	close(unstick)
+	time.Sleep(smallWaitTime / 2)
+	asserter.NoError(controller.Liveness())
+
+	// cleanup
+	_ = controller.Stop()
+}
+
 func TestUnhealthyIfUpdaterFails(t *testing.T) {
 	// given
 	asserter := assert.New(t)
@@ -313,15 +409,318 @@ func TestUnhealthyIfUpdaterFails(t *testing.T) {
 	updateCh <- struct{}{}
 	time.Sleep(smallWaitTime)
 	asserter.NoError(controller.Health())
+	lastUpdate := testutil.ToFloat64(lastSuccessfulUpdate)
+	asserter.InDelta(float64(time.Now().Unix()), lastUpdate, 5)
+	asserter.InDelta(lastUpdate, testutil.ToFloat64(updaterLastSuccessfulUpdate.WithLabelValues("FakeUpdater")), 1)
 
 	updateCh <- struct{}{}
 	time.Sleep(smallWaitTime)
 	asserter.Error(controller.Health())
+	asserter.Equal(lastUpdate, testutil.ToFloat64(lastSuccessfulUpdate), "failed update should not change timestamp")
+
+	// cleanup
+	_ = controller.Stop()
+}
+
+func TestResyncUpdatesUpdatersWithoutWatcherUpdate(t *testing.T) {
+	// given
+	asserter := assert.New(t)
+	updater := new(fakeUpdater)
+	client := new(fake.FakeClient)
+	controller := newController(updater, client)
+	ingressWatcher, _ := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Update", mock.Anything).Return(nil)
+	client.On("GetAllIngresses").Return(createDefaultIngresses(), nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	client.On("Relist").Return(nil)
+
+	// when
+	asserter.Error(controller.Resync(), "resync before start should fail")
+	asserter.NoError(controller.Start())
+	asserter.NoError(controller.Resync())
+	time.Sleep(smallWaitTime)
+
+	// then
+	updater.AssertNumberOfCalls(t, "Update", 1)
+	client.AssertCalled(t, "Relist")
 
 	// cleanup
 	_ = controller.Stop()
 }
 
+func TestRoutePoliciesAreAppliedToEntries(t *testing.T) {
+	timeout := 120
+	stripPath := true
+	allow := []string{"10.0.0.0/8"}
+	policies := []*k8s.RoutePolicy{
+		{Namespace: ingressNamespace, Name: "by-name", Spec: k8s.RoutePolicySpec{BackendTimeoutSeconds: &timeout, Allow: &allow,
+			RateLimit: &k8s.RateLimit{RequestsPerSecond: 10, Burst: 5}, ResponseHeaders: map[string]string{"Cache-Control": "no-store"}}},
+		{Namespace: ingressNamespace, Name: "by-host", Spec: k8s.RoutePolicySpec{Hosts: []string{ingressHost}, StripPath: &stripPath}},
+		{Namespace: "other", Name: "other-namespace", Spec: k8s.RoutePolicySpec{Hosts: []string{ingressHost}, Allow: &[]string{}}},
+	}
+
+	var tests = []struct {
+		description string
+		annotations map[string]string
+		assertions  func(*assert.Assertions, IngressEntry)
+	}{
+		{
+			"policy referenced by name",
+			map[string]string{routePolicyAnnotation: "by-name"},
+			func(asserter *assert.Assertions, entry IngressEntry) {
+				asserter.Equal(timeout, entry.BackendTimeoutSeconds)
+				asserter.Equal(allow, entry.Allow)
+				asserter.Equal(10, entry.RateLimit)
+				asserter.Equal(5, entry.RateLimitBurst)
+				asserter.Equal(map[string]string{"Cache-Control": "no-store"}, entry.ResponseHeaders)
+				asserter.False(entry.StripPaths, "policy for the host shouldn't apply")
+			},
+		},
+		{
+			"policy matched by host in the same namespace",
+			map[string]string{},
+			func(asserter *assert.Assertions, entry IngressEntry) {
+				asserter.True(entry.StripPaths)
+				asserter.Equal(backendTimeout, entry.BackendTimeoutSeconds)
+				asserter.Zero(entry.RateLimit)
+				asserter.Equal(strings.Split(ingressDefaultAllow, ","), entry.Allow)
+			},
+		},
+		{
+			"missing policy",
+			map[string]string{routePolicyAnnotation: "other-namespace"},
+			func(asserter *assert.Assertions, entry IngressEntry) {
+				asserter.Equal(strings.Split(ingressDefaultAllow, ","), entry.Allow)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			// given
+			asserter := assert.New(t)
+			updater := new(fakeUpdater)
+			client := new(fake.FakeClient)
+			config := defaultConfig()
+			config.KubernetesClient = client
+			config.Updaters = []Updater{updater}
+			config.RoutePolicies = true
+			controller := New(config, make(chan struct{}))
+
+			test.annotations[ingressClassAnnotation] = defaultIngressClass
+			ingresses := createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, test.annotations, ingressPath)
+			var entries IngressEntries
+			updater.On("Start").Return(nil)
+			updater.On("Stop").Return(nil)
+			updater.On("Update", mock.Anything).Run(func(args mock.Arguments) {
+				entries = args.Get(0).(IngressEntries)
+			}).Return(nil)
+			client.On("GetAllIngresses").Return(ingresses, nil)
+			client.On("GetServices").Return(createDefaultServices(), nil)
+			client.On("GetRoutePolicies").Return(policies, nil)
+			client.On("Relist").Return(nil)
+			for _, watch := range []string{"WatchIngresses", "WatchServices", "WatchNamespaces", "WatchRoutePolicies"} {
+				watcher, _ := createFakeWatcher()
+				client.On(watch).Return(watcher)
+			}
+
+			// when
+			asserter.NoError(controller.Start())
+			asserter.NoError(controller.Resync())
+			time.Sleep(smallWaitTime)
+			asserter.NoError(controller.Stop())
+
+			// then
+			client.AssertExpectations(t)
+			if asserter.Len(entries, 1) {
+				test.assertions(asserter, entries[0])
+			}
+		})
+	}
+}
+
+func TestAllowListsAreReadFromConfigMaps(t *testing.T) {
+	configMaps := []*corev1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "partners", Labels: allowListLabels},
+			Data:       map[string]string{"allow": "10.1.0.0/16\n10.2.0.0/16\n"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "unlabelled"},
+			Data:       map[string]string{"allow": "10.0.0.0/8"},
+		},
+	}
+
+	var tests = []struct {
+		description string
+		annotations map[string]string
+		allow       []string
+	}{
+		{
+			"config map replaces the default",
+			map[string]string{allowFromConfigMapAnnotation: "shared/partners"},
+			[]string{"10.1.0.0/16", "10.2.0.0/16"},
+		},
+		{
+			"config map adds to the allow annotation",
+			map[string]string{allowFromConfigMapAnnotation: "shared/partners", ingressAllowAnnotation: "10.0.0.0/16"},
+			[]string{"10.0.0.0/16", "10.1.0.0/16", "10.2.0.0/16"},
+		},
+		{
+			"missing config map allows nothing",
+			map[string]string{allowFromConfigMapAnnotation: "partners"},
+			[]string{},
+		},
+		{
+			"config map not labelled as an allow list allows nothing",
+			map[string]string{allowFromConfigMapAnnotation: "shared/unlabelled"},
+			[]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			// given
+			asserter := assert.New(t)
+			updater := new(fakeUpdater)
+			client := new(fake.FakeClient)
+			config := defaultConfig()
+			config.KubernetesClient = client
+			config.Updaters = []Updater{updater}
+			config.AllowFromConfigMaps = true
+			controller := New(config, make(chan struct{}))
+
+			test.annotations[ingressClassAnnotation] = defaultIngressClass
+			ingresses := createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, test.annotations, ingressPath)
+			var entries IngressEntries
+			updater.On("Start").Return(nil)
+			updater.On("Stop").Return(nil)
+			updater.On("Update", mock.Anything).Run(func(args mock.Arguments) {
+				entries = args.Get(0).(IngressEntries)
+			}).Return(nil)
+			client.On("GetAllIngresses").Return(ingresses, nil)
+			client.On("GetServices").Return(createDefaultServices(), nil)
+			client.On("GetConfigMaps").Return(configMaps, nil)
+			client.On("Relist").Return(nil)
+			for _, watch := range []string{"WatchIngresses", "WatchServices", "WatchNamespaces", "WatchConfigMaps"} {
+				watcher, _ := createFakeWatcher()
+				client.On(watch).Return(watcher)
+			}
+
+			// when
+			asserter.NoError(controller.Start())
+			asserter.NoError(controller.Resync())
+			time.Sleep(smallWaitTime)
+			asserter.NoError(controller.Stop())
+
+			// then
+			client.AssertExpectations(t)
+			if asserter.Len(entries, 1) {
+				asserter.Equal(test.allow, entries[0].Allow)
+			}
+		})
+	}
+}
+
+func TestAPIKeysAreReadFromSecrets(t *testing.T) {
+	secrets := []*corev1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ingressNamespace, Name: "api-keys", Labels: apiKeysLabels},
+			Data:       map[string][]byte{"partner": []byte("c2VjcmV0")},
+		},
+	}
+
+	var tests = []struct {
+		description string
+		annotations map[string]string
+		header      string
+		keys        map[string]string
+		rateLimit   int
+	}{
+		{
+			"secret allows its keys in the default header",
+			map[string]string{apiKeysFromSecretAnnotation: "api-keys"},
+			DefaultAPIKeyHeader,
+			map[string]string{"c2VjcmV0": "partner"},
+			0,
+		},
+		{
+			"missing secret allows no keys",
+			map[string]string{apiKeysFromSecretAnnotation: "other", apiKeyHeaderAnnotation: "X-Token"},
+			"X-Token",
+			map[string]string{},
+			0,
+		},
+		{
+			"rate limit doesn't need a secret",
+			map[string]string{apiKeyRateLimitAnnotation: "10", apiKeyHeaderAnnotation: "X-Token: bad"},
+			DefaultAPIKeyHeader,
+			nil,
+			10,
+		},
+		{
+			"header alone does nothing",
+			map[string]string{apiKeyHeaderAnnotation: "X-Token", apiKeyRateLimitAnnotation: "-1"},
+			"",
+			nil,
+			0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			// given
+			asserter := assert.New(t)
+			updater := new(fakeUpdater)
+			client := new(fake.FakeClient)
+			config := defaultConfig()
+			config.KubernetesClient = client
+			config.Updaters = []Updater{updater}
+			config.APIKeysFromSecrets = true
+			controller := New(config, make(chan struct{}))
+
+			test.annotations[ingressClassAnnotation] = defaultIngressClass
+			ingresses := createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, test.annotations, ingressPath)
+			var entries IngressEntries
+			updater.On("Start").Return(nil)
+			updater.On("Stop").Return(nil)
+			updater.On("Update", mock.Anything).Run(func(args mock.Arguments) {
+				entries = args.Get(0).(IngressEntries)
+			}).Return(nil)
+			client.On("GetAllIngresses").Return(ingresses, nil)
+			client.On("GetServices").Return(createDefaultServices(), nil)
+			client.On("GetSecrets").Return(secrets, nil)
+			client.On("Relist").Return(nil)
+			for _, watch := range []string{"WatchIngresses", "WatchServices", "WatchNamespaces", "WatchSecrets"} {
+				watcher, _ := createFakeWatcher()
+				client.On(watch).Return(watcher)
+			}
+
+			// when
+			asserter.NoError(controller.Start())
+			asserter.NoError(controller.Resync())
+			time.Sleep(smallWaitTime)
+			asserter.NoError(controller.Stop())
+
+			// then
+			client.AssertExpectations(t)
+			if asserter.Len(entries, 1) {
+				asserter.Equal(test.header, entries[0].APIKeyHeader)
+				asserter.Equal(test.keys, entries[0].APIKeys)
+				asserter.Equal(test.rateLimit, entries[0].APIKeyRateLimit)
+			}
+		})
+	}
+}
+
 func defaultConfig() Config {
 	return Config{
 		DefaultAllow:                 ingressDefaultAllow,
@@ -691,13 +1090,13 @@ func TestUpdaterIsUpdatedForIngressWithExactPathFalse(t *testing.T) {
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressWithOverriddenBackendTimeout(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithSSLPassthrough(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress with overridden backend timeout",
+		"ingress with ssl passthrough set to true",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:   "",
-			stripPathAnnotation:      "false",
-			backendTimeoutSeconds:    "20",
+			sslPassthroughAnnotation: "true",
+			backendTimeoutSeconds:    "10",
 			frontendSchemeAnnotation: "internal",
 			ingressClassAnnotation:   defaultIngressClass,
 		}, ingressPath),
@@ -713,22 +1112,22 @@ func TestUpdaterIsUpdatedForIngressWithOverriddenBackendTimeout(t *testing.T) {
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
-			BackendTimeoutSeconds: 20,
+			SSLPassthrough:        true,
+			BackendTimeoutSeconds: backendTimeout,
 		}},
 		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressWithOverriddenLegacyBackendTimeout(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithACME(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress with overridden backend timeout",
+		"ingress with acme set to true",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
-			ingressAllowAnnotation:        "",
-			stripPathAnnotation:           "false",
-			legacyBackendKeepaliveSeconds: "20",
-			frontendSchemeAnnotation:      "internal",
-			ingressClassAnnotation:        defaultIngressClass,
+			ingressAllowAnnotation:   "",
+			acmeAnnotation:           "true",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
 		}, ingressPath),
 		createDefaultServices(),
 		createDefaultNamespaces(),
@@ -742,19 +1141,20 @@ func TestUpdaterIsUpdatedForIngressWithOverriddenLegacyBackendTimeout(t *testing
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
-			BackendTimeoutSeconds: 20,
+			ACME:                  true,
+			BackendTimeoutSeconds: backendTimeout,
 		}},
 		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressWithDefaultBackendTimeout(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithVaultHtpasswd(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress with default backend timeout",
+		"ingress with a vault htpasswd secret",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:   "",
-			stripPathAnnotation:      "false",
+			vaultHtpasswdAnnotation:  "admins",
+			backendTimeoutSeconds:    "10",
 			frontendSchemeAnnotation: "internal",
 			ingressClassAnnotation:   defaultIngressClass,
 		}, ingressPath),
@@ -770,23 +1170,19 @@ func TestUpdaterIsUpdatedForIngressWithDefaultBackendTimeout(t *testing.T) {
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
+			HtpasswdSecret:        "admins",
 			BackendTimeoutSeconds: backendTimeout,
 		}},
 		defaultConfig(),
 	})
-}
-
-func TestUpdaterIsUpdatedForIngressWithOverriddenBackendMaxConnections(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress with overridden backend max connections",
+		"ingress with an invalid vault htpasswd secret",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:   "",
-			stripPathAnnotation:      "false",
-			backendTimeoutSeconds:    "20",
+			vaultHtpasswdAnnotation:  "../other-namespace/admins",
+			backendTimeoutSeconds:    "10",
 			frontendSchemeAnnotation: "internal",
 			ingressClassAnnotation:   defaultIngressClass,
-			backendMaxConnections:    "512",
 		}, ingressPath),
 		createDefaultServices(),
 		createDefaultNamespaces(),
@@ -800,86 +1196,49 @@ func TestUpdaterIsUpdatedForIngressWithOverriddenBackendMaxConnections(t *testin
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
-			BackendTimeoutSeconds: 20,
-			BackendMaxConnections: 512,
+			BackendTimeoutSeconds: backendTimeout,
 		}},
 		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressWithOverriddenBackendMaxRequestsPerConnection(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithBackendSPIFFE(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress with overridden backend max requests per connection",
+		"ingress with backend spiffe set to true",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
-			ingressAllowAnnotation:          "",
-			stripPathAnnotation:             "false",
-			frontendSchemeAnnotation:        "internal",
-			ingressClassAnnotation:          defaultIngressClass,
-			backendMaxRequestsPerConnection: "100",
+			ingressAllowAnnotation:   "",
+			backendSPIFFEAnnotation:  "true",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
 		}, ingressPath),
 		createDefaultServices(),
 		createDefaultNamespaces(),
 		[]IngressEntry{{
-			Namespace:                       ingressNamespace,
-			Name:                            ingressName,
-			Host:                            ingressHost,
-			Path:                            ingressPath,
-			ServiceAddress:                  serviceIP,
-			ServicePort:                     ingressSvcPort,
-			LbScheme:                        "internal",
-			IngressClass:                    defaultIngressClass,
-			Allow:                           []string{},
-			StripPaths:                      false,
-			BackendTimeoutSeconds:           10,
-			BackendMaxConnections:           defaultMaxConnections,
-			BackendMaxRequestsPerConnection: 100,
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			BackendSPIFFE:         true,
+			BackendSPIFFEName:     ingressSvcName + "." + ingressNamespace + ".svc",
+			BackendTimeoutSeconds: backendTimeout,
 		}},
 		defaultConfig(),
 	})
-}
-
-func TestUpdaterIsUpdatedForIngressWithOverriddenBackendConnectionKeepAlive(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress with overridden backend max requests per connection",
+		"ingress with backend spiffe name",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
-			ingressAllowAnnotation:     "",
-			stripPathAnnotation:        "false",
-			frontendSchemeAnnotation:   "internal",
-			ingressClassAnnotation:     defaultIngressClass,
-			backendConnectionKeepalive: "5m",
-		}, ingressPath),
-		createDefaultServices(),
-		createDefaultNamespaces(),
-		[]IngressEntry{{
-			Namespace:               ingressNamespace,
-			Name:                    ingressName,
-			Host:                    ingressHost,
-			Path:                    ingressPath,
-			ServiceAddress:          serviceIP,
-			ServicePort:             ingressSvcPort,
-			LbScheme:                "internal",
-			IngressClass:            defaultIngressClass,
-			Allow:                   []string{},
-			StripPaths:              false,
-			BackendTimeoutSeconds:   10,
-			BackendMaxConnections:   defaultMaxConnections,
-			BackendKeepaliveTimeout: 5 * time.Minute,
-		}},
-		defaultConfig(),
-	})
-}
-
-func TestUpdaterSkipsEntriesForIngressWithInvalidBackendConnectionKeepAliveAndBackendMaxRequestsPerConnection(t *testing.T) {
-	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress with overridden backend max requests per connection",
-		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
-			ingressAllowAnnotation:          "",
-			stripPathAnnotation:             "false",
-			frontendSchemeAnnotation:        "internal",
-			ingressClassAnnotation:          defaultIngressClass,
-			backendConnectionKeepalive:      "50a",
-			backendMaxRequestsPerConnection: "-1",
+			ingressAllowAnnotation:      "",
+			backendSPIFFEAnnotation:     "true",
+			backendSPIFFENameAnnotation: "foo.example.org",
+			backendTimeoutSeconds:       "10",
+			frontendSchemeAnnotation:    "internal",
+			ingressClassAnnotation:      defaultIngressClass,
 		}, ingressPath),
 		createDefaultServices(),
 		createDefaultNamespaces(),
@@ -893,21 +1252,22 @@ func TestUpdaterSkipsEntriesForIngressWithInvalidBackendConnectionKeepAliveAndBa
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
-			BackendTimeoutSeconds: 10,
-			BackendMaxConnections: defaultMaxConnections,
+			BackendSPIFFE:         true,
+			BackendSPIFFEName:     "foo.example.org",
+			BackendTimeoutSeconds: backendTimeout,
 		}},
 		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressWithDefaultBackendMaxConnections(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithCountries(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress with default backend max connections",
+		"ingress with allowed and denied countries",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:   "",
-			stripPathAnnotation:      "false",
-			backendTimeoutSeconds:    "20",
+			allowCountriesAnnotation: "gb, IE",
+			denyCountriesAnnotation:  "FR",
+			backendTimeoutSeconds:    "10",
 			frontendSchemeAnnotation: "internal",
 			ingressClassAnnotation:   defaultIngressClass,
 		}, ingressPath),
@@ -923,20 +1283,23 @@ func TestUpdaterIsUpdatedForIngressWithDefaultBackendMaxConnections(t *testing.T
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
-			BackendTimeoutSeconds: 20,
-			BackendMaxConnections: defaultMaxConnections,
+			AllowCountries:        []string{"GB", "IE"},
+			DenyCountries:         []string{"FR"},
+			BackendTimeoutSeconds: backendTimeout,
 		}},
 		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressWithDefaultProxyBufferValuesWhenNotOverridden(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithTracingDisabled(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress with default proxy buffer values when not overridden by the ingress definition",
+		"ingress with tracing disabled",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
-			ingressAllowAnnotation: "",
-			ingressClassAnnotation: defaultIngressClass,
+			ingressAllowAnnotation:   "",
+			tracingAnnotation:        "false",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
 		}, ingressPath),
 		createDefaultServices(),
 		createDefaultNamespaces(),
@@ -947,31 +1310,24 @@ func TestUpdaterIsUpdatedForIngressWithDefaultProxyBufferValuesWhenNotOverridden
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
 			ServicePort:           ingressSvcPort,
-			LbScheme:              "",
+			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
-			BackendTimeoutSeconds: 10,
-			BackendMaxConnections: defaultMaxConnections,
-			ProxyBufferSize:       2,
-			ProxyBufferBlocks:     3,
+			DisableTracing:        true,
+			BackendTimeoutSeconds: backendTimeout,
 		}},
-		Config{
-			DefaultBackendTimeoutSeconds: backendTimeout,
-			DefaultProxyBufferSize:       2,
-			DefaultProxyBufferBlocks:     3,
-			Name:                         defaultIngressClass,
-		},
+		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressOverridesDefaultProxyBufferValues(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithTracingSampleRate(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress definition overrides default proxy buffer values",
+		"ingress with a tracing sample rate",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:      "",
-			proxyBufferSizeAnnotation:   "6",
-			proxyBufferBlocksAnnotation: "4",
+			tracingSampleRateAnnotation: "0.25",
+			backendTimeoutSeconds:       "10",
+			frontendSchemeAnnotation:    "internal",
 			ingressClassAnnotation:      defaultIngressClass,
 		}, ingressPath),
 		createDefaultServices(),
@@ -983,31 +1339,24 @@ func TestUpdaterIsUpdatedForIngressOverridesDefaultProxyBufferValues(t *testing.
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
 			ServicePort:           ingressSvcPort,
-			LbScheme:              "",
+			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
-			BackendTimeoutSeconds: 10,
-			BackendMaxConnections: defaultMaxConnections,
-			ProxyBufferSize:       6,
-			ProxyBufferBlocks:     4,
+			TracingSampleRate:     0.25,
+			BackendTimeoutSeconds: backendTimeout,
 		}},
-		Config{
-			DefaultBackendTimeoutSeconds: backendTimeout,
-			DefaultProxyBufferSize:       2,
-			DefaultProxyBufferBlocks:     3,
-			Name:                         defaultIngressClass,
-		},
+		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressDefinitionResetsToMacWhenProxyBufferValuesExceedMax(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithInvalidTracingSampleRate(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress definition resets to max when proxy buffer values exceed max allowed values",
+		"ingress with an invalid tracing sample rate",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:      "",
-			proxyBufferSizeAnnotation:   "64",
-			proxyBufferBlocksAnnotation: "12",
+			tracingSampleRateAnnotation: "2",
+			backendTimeoutSeconds:       "10",
+			frontendSchemeAnnotation:    "internal",
 			ingressClassAnnotation:      defaultIngressClass,
 		}, ingressPath),
 		createDefaultServices(),
@@ -1019,35 +1368,26 @@ func TestUpdaterIsUpdatedForIngressDefinitionResetsToMacWhenProxyBufferValuesExc
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
 			ServicePort:           ingressSvcPort,
-			LbScheme:              "",
+			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
-			BackendTimeoutSeconds: 10,
-			BackendMaxConnections: defaultMaxConnections,
-			ProxyBufferSize:       32,
-			ProxyBufferBlocks:     8,
+			BackendTimeoutSeconds: backendTimeout,
 		}},
-		Config{
-			DefaultBackendTimeoutSeconds: backendTimeout,
-			DefaultProxyBufferSize:       2,
-			DefaultProxyBufferBlocks:     3,
-			Name:                         defaultIngressClass,
-		},
+		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressClassNotSetInIngress(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithBackupService(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress without ingress class set",
+		"ingress with a backup service",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:   "",
-			stripPathAnnotation:      "false",
+			backupServiceAnnotation:  "fallback:9090",
 			backendTimeoutSeconds:    "10",
 			frontendSchemeAnnotation: "internal",
 			ingressClassAnnotation:   defaultIngressClass,
 		}, ingressPath),
-		createDefaultServices(),
+		append(createDefaultServices(), createServiceFixture("fallback", ingressNamespace, "10.254.0.99")...),
 		createDefaultNamespaces(),
 		[]IngressEntry{{
 			Namespace:             ingressNamespace,
@@ -1056,25 +1396,106 @@ func TestUpdaterIsUpdatedForIngressClassNotSetInIngress(t *testing.T) {
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
 			ServicePort:           ingressSvcPort,
+			BackupServiceAddress:  "10.254.0.99",
+			BackupServicePort:     9090,
 			LbScheme:              "internal",
 			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
 			BackendTimeoutSeconds: backendTimeout,
 		}},
 		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressClassSetToDefaultInIngress(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithBackendProtocol(t *testing.T) {
+	for _, protocol := range []string{"h2c", "http", "fastcgi", "uwsgi", "grpc"} {
+		expected := protocol
+		if protocol == "grpc" {
+			// invalid, so the default is used
+			expected = ""
+		}
+		runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+			"ingress with backend protocol " + protocol,
+			createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+				ingressAllowAnnotation:    "",
+				backendProtocolAnnotation: protocol,
+				backendTimeoutSeconds:     "10",
+				frontendSchemeAnnotation:  "internal",
+				ingressClassAnnotation:    defaultIngressClass,
+			}, ingressPath),
+			createDefaultServices(),
+			createDefaultNamespaces(),
+			[]IngressEntry{{
+				Namespace:             ingressNamespace,
+				Name:                  ingressName,
+				Host:                  ingressHost,
+				Path:                  ingressPath,
+				ServiceAddress:        serviceIP,
+				ServicePort:           ingressSvcPort,
+				BackendProtocol:       expected,
+				LbScheme:              "internal",
+				IngressClass:          defaultIngressClass,
+				Allow:                 []string{},
+				BackendTimeoutSeconds: backendTimeout,
+			}},
+			defaultConfig(),
+		})
+	}
+}
+
+func TestUpdaterIsUpdatedForIngressWithInterceptErrors(t *testing.T) {
+	config := defaultConfig()
+	config.DefaultInterceptErrors = []int{500}
+
+	tests := []struct {
+		annotation string
+		expected   []int
+	}{
+		{"502, 503,504", []int{502, 503, 504}},
+		{"", []int{}},
+		{"200", []int{500}},
+		{"oops", []int{500}},
+	}
+
+	for _, test := range tests {
+		runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+			"ingress intercepting errors " + test.annotation,
+			createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+				ingressAllowAnnotation:    "",
+				interceptErrorsAnnotation: test.annotation,
+				backendTimeoutSeconds:     "10",
+				frontendSchemeAnnotation:  "internal",
+				ingressClassAnnotation:    defaultIngressClass,
+			}, ingressPath),
+			createDefaultServices(),
+			createDefaultNamespaces(),
+			[]IngressEntry{{
+				Namespace:             ingressNamespace,
+				Name:                  ingressName,
+				Host:                  ingressHost,
+				Path:                  ingressPath,
+				ServiceAddress:        serviceIP,
+				ServicePort:           ingressSvcPort,
+				InterceptErrors:       test.expected,
+				LbScheme:              "internal",
+				IngressClass:          defaultIngressClass,
+				Allow:                 []string{},
+				BackendTimeoutSeconds: backendTimeout,
+			}},
+			config,
+		})
+	}
+}
+
+func TestUpdaterIsUpdatedForIngressWithSecurityHeaders(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress with class set to default value",
+		"ingress with security headers",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
-			ingressAllowAnnotation:   "",
-			stripPathAnnotation:      "false",
-			backendTimeoutSeconds:    "10",
-			frontendSchemeAnnotation: "internal",
-			ingressClassAnnotation:   defaultIngressClass,
+			ingressAllowAnnotation:    "",
+			securityHeadersAnnotation: " strict",
+			backendTimeoutSeconds:     "10",
+			frontendSchemeAnnotation:  "internal",
+			ingressClassAnnotation:    defaultIngressClass,
 		}, ingressPath),
 		createDefaultServices(),
 		createDefaultNamespaces(),
@@ -1085,100 +1506,378 @@ func TestUpdaterIsUpdatedForIngressClassSetToDefaultInIngress(t *testing.T) {
 			Path:                  ingressPath,
 			ServiceAddress:        serviceIP,
 			ServicePort:           ingressSvcPort,
+			SecurityHeaders:       "strict",
 			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
 			BackendTimeoutSeconds: backendTimeout,
-			IngressClass:          defaultIngressClass,
 		}},
-		Config{
-			DefaultAllow:                 ingressDefaultAllow,
-			DefaultBackendTimeoutSeconds: backendTimeout,
-			Name:                         defaultIngressClass,
-		},
+		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsNotUpdatedForIngressClassSetToTestAndConfigSetToDefault(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithInternalPaths(t *testing.T) {
+	for annotation, expected := range map[string][]string{
+		"/admin, /metrics": {"/admin", "/metrics"},
+		"admin":            nil,
+	} {
+		runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+			"ingress with internal paths " + annotation,
+			createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+				ingressAllowAnnotation:   "",
+				internalPathsAnnotation:  annotation,
+				backendTimeoutSeconds:    "10",
+				frontendSchemeAnnotation: "internal",
+				ingressClassAnnotation:   defaultIngressClass,
+			}, ingressPath),
+			createDefaultServices(),
+			createDefaultNamespaces(),
+			[]IngressEntry{{
+				Namespace:             ingressNamespace,
+				Name:                  ingressName,
+				Host:                  ingressHost,
+				Path:                  ingressPath,
+				ServiceAddress:        serviceIP,
+				ServicePort:           ingressSvcPort,
+				InternalPaths:         expected,
+				LbScheme:              "internal",
+				IngressClass:          defaultIngressClass,
+				Allow:                 []string{},
+				BackendTimeoutSeconds: backendTimeout,
+			}},
+			defaultConfig(),
+		})
+	}
+}
+
+func TestUpdaterIsUpdatedForIngressWithTrailingSlash(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress requesting class==test; feed instance has class " + defaultIngressClass,
+		"ingress with trailing slash mode",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:   "",
-			stripPathAnnotation:      "false",
+			trailingSlashAnnotation:  "serve",
 			backendTimeoutSeconds:    "10",
 			frontendSchemeAnnotation: "internal",
-			ingressClassAnnotation:   "test",
+			ingressClassAnnotation:   defaultIngressClass,
 		}, ingressPath),
 		createDefaultServices(),
 		createDefaultNamespaces(),
-		nil,
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			TrailingSlash:         "serve",
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			BackendTimeoutSeconds: backendTimeout,
+		}},
 		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedWhenIncludingClasslessIngresses(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithWebSocketUpgrade(t *testing.T) {
+	config := defaultConfig()
+	config.DefaultWebSocketUpgrade = true
+
+	tests := []struct {
+		upgrade         string
+		timeout         string
+		expectedUpgrade bool
+		expectedTimeout int
+	}{
+		{"true", "3600", true, 3600},
+		{"false", "3600", false, 3600},
+		{"oops", "0", true, 0},
+		{"true", "forever", true, 0},
+	}
+
+	for _, test := range tests {
+		runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+			"ingress with websocket upgrade " + test.upgrade + " and timeout " + test.timeout,
+			createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+				ingressAllowAnnotation:     "",
+				webSocketUpgradeAnnotation: test.upgrade,
+				webSocketTimeoutAnnotation: test.timeout,
+				backendTimeoutSeconds:      "10",
+				frontendSchemeAnnotation:   "internal",
+				ingressClassAnnotation:     defaultIngressClass,
+			}, ingressPath),
+			createDefaultServices(),
+			createDefaultNamespaces(),
+			[]IngressEntry{{
+				Namespace:               ingressNamespace,
+				Name:                    ingressName,
+				Host:                    ingressHost,
+				Path:                    ingressPath,
+				ServiceAddress:          serviceIP,
+				ServicePort:             ingressSvcPort,
+				WebSocketUpgrade:        test.expectedUpgrade,
+				WebSocketTimeoutSeconds: test.expectedTimeout,
+				LbScheme:                "internal",
+				IngressClass:            defaultIngressClass,
+				Allow:                   []string{},
+				BackendTimeoutSeconds:   backendTimeout,
+			}},
+			config,
+		})
+	}
+}
+
+func TestUpdaterIsUpdatedForIngressWithNJSHandlers(t *testing.T) {
+	tests := []struct {
+		content              string
+		headerFilter         string
+		expectedContent      string
+		expectedHeaderFilter string
+	}{
+		{"hello.content", " headers.filter.add ", "hello.content", "headers.filter.add"},
+		{"content", "headers.add()", "", ""},
+	}
+
+	for _, test := range tests {
+		runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+			"ingress with njs handlers " + test.content + " and " + test.headerFilter,
+			createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+				ingressAllowAnnotation:    "",
+				njsContentAnnotation:      test.content,
+				njsHeaderFilterAnnotation: test.headerFilter,
+				backendTimeoutSeconds:     "10",
+				frontendSchemeAnnotation:  "internal",
+				ingressClassAnnotation:    defaultIngressClass,
+			}, ingressPath),
+			createDefaultServices(),
+			createDefaultNamespaces(),
+			[]IngressEntry{{
+				Namespace:             ingressNamespace,
+				Name:                  ingressName,
+				Host:                  ingressHost,
+				Path:                  ingressPath,
+				ServiceAddress:        serviceIP,
+				ServicePort:           ingressSvcPort,
+				NJSContent:            test.expectedContent,
+				NJSHeaderFilter:       test.expectedHeaderFilter,
+				LbScheme:              "internal",
+				IngressClass:          defaultIngressClass,
+				Allow:                 []string{},
+				BackendTimeoutSeconds: backendTimeout,
+			}},
+			defaultConfig(),
+		})
+	}
+}
+
+func TestUpdaterIsUpdatedForIngressWithStatsName(t *testing.T) {
+	tests := []struct {
+		annotation string
+		expected   string
+	}{
+		{" checkout-api ", "checkout-api"},
+		{"checkout::api", ""},
+		{"checkout api", ""},
+	}
+
+	for _, test := range tests {
+		runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+			"ingress with stats name " + test.annotation,
+			createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+				ingressAllowAnnotation:   "",
+				statsNameAnnotation:      test.annotation,
+				backendTimeoutSeconds:    "10",
+				frontendSchemeAnnotation: "internal",
+				ingressClassAnnotation:   defaultIngressClass,
+			}, ingressPath),
+			createDefaultServices(),
+			createDefaultNamespaces(),
+			[]IngressEntry{{
+				Namespace:             ingressNamespace,
+				Name:                  ingressName,
+				Host:                  ingressHost,
+				Path:                  ingressPath,
+				ServiceAddress:        serviceIP,
+				ServicePort:           ingressSvcPort,
+				StatsName:             test.expected,
+				LbScheme:              "internal",
+				IngressClass:          defaultIngressClass,
+				Allow:                 []string{},
+				BackendTimeoutSeconds: backendTimeout,
+			}},
+			defaultConfig(),
+		})
+	}
+}
+
+func TestUpdaterIsUpdatedWithOnlyTheHostsInItsShard(t *testing.T) {
+	shard := Shard{Index: 0, Count: 2}
+	if !shard.Owns(ingressHost) {
+		shard.Index = 1
+	}
+	otherHost := ""
+	for i := 0; otherHost == ""; i++ {
+		if host := fmt.Sprintf("other-%d.sky.com", i); !shard.Owns(host) {
+			otherHost = host
+		}
+	}
+
+	ingresses := append(createDefaultIngresses(), createIngressesFixture(ingressNamespace, otherHost, ingressSvcName,
+		ingressSvcPort, map[string]string{ingressClassAnnotation: defaultIngressClass}, ingressPath)...)
+	entries := createLbEntriesFixture()
+	entries[0].Ingress = ingresses[0]
+	config := defaultConfig()
+	config.Shard = shard
+
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress has no class annotation; feed-ingress is including classless ingresses",
-		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+		"ingress hosts in another shard are ignored",
+		ingresses,
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		entries,
+		config,
+	})
+}
+
+func TestUpdaterIsUpdatedWithTemplatedHostsForRulesWithoutOne(t *testing.T) {
+	ingresses := createIngressesFixture(ingressNamespace, "", ingressSvcName, ingressSvcPort, map[string]string{
+		ingressAllowAnnotation:   ingressAllow,
+		backendTimeoutSeconds:    "10",
+		frontendSchemeAnnotation: "internal",
+		ingressClassAnnotation:   defaultIngressClass,
+	}, ingressPath)
+	entries := createLbEntriesFixture()
+	entries[0].Host = ingressName + "." + ingressNamespace + ".sky.com"
+	entries[0].Ingress = ingresses[0]
+	config := defaultConfig()
+	config.HostTemplate = "{name}.{namespace}.sky.com"
+
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress rule without a host gets one from the template",
+		ingresses,
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		entries,
+		config,
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithPathType(t *testing.T) {
+	tests := []struct {
+		pathType   networkingv1.PathType
+		exactPath  bool
+		prefixPath bool
+	}{
+		{networkingv1.PathTypeExact, true, false},
+		{networkingv1.PathTypePrefix, false, true},
+		{networkingv1.PathTypeImplementationSpecific, false, false},
+	}
+
+	for _, test := range tests {
+		pathType := test.pathType
+		ingresses := createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:   "",
-			stripPathAnnotation:      "false",
+			exactPathAnnotation:      "false",
 			backendTimeoutSeconds:    "10",
 			frontendSchemeAnnotation: "internal",
-		}, ingressPath),
+			ingressClassAnnotation:   defaultIngressClass,
+		}, ingressPath)
+		ingresses[0].Spec.Rules[0].HTTP.Paths[0].PathType = &pathType
+
+		runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+			"ingress with path type " + string(pathType),
+			ingresses,
+			createDefaultServices(),
+			createDefaultNamespaces(),
+			[]IngressEntry{{
+				Namespace:             ingressNamespace,
+				Name:                  ingressName,
+				Host:                  ingressHost,
+				Path:                  ingressPath,
+				ServiceAddress:        serviceIP,
+				ServicePort:           ingressSvcPort,
+				ExactPath:             test.exactPath,
+				PrefixPath:            test.prefixPath,
+				LbScheme:              "internal",
+				IngressClass:          defaultIngressClass,
+				Allow:                 []string{},
+				BackendTimeoutSeconds: backendTimeout,
+			}},
+			defaultConfig(),
+		})
+	}
+}
+
+func TestUpdaterIsUpdatedForIngressWithPathRegex(t *testing.T) {
+	pathType := networkingv1.PathTypeExact
+	ingresses := createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+		ingressAllowAnnotation:   "",
+		pathRegexAnnotation:      "true",
+		backendTimeoutSeconds:    "10",
+		frontendSchemeAnnotation: "internal",
+		ingressClassAnnotation:   defaultIngressClass,
+	}, "^/api/v[0-9]+/")
+	ingresses[0].Spec.Rules[0].HTTP.Paths[0].PathType = &pathType
+
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with a path regex",
+		ingresses,
 		createDefaultServices(),
 		createDefaultNamespaces(),
 		[]IngressEntry{{
 			Namespace:             ingressNamespace,
 			Name:                  ingressName,
 			Host:                  ingressHost,
-			Path:                  ingressPath,
+			Path:                  "^/api/v[0-9]+/",
+			PathRegex:             true,
 			ServiceAddress:        serviceIP,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
-			StripPaths:            false,
 			BackendTimeoutSeconds: backendTimeout,
-			IngressClass:          "",
 		}},
-		Config{
-			DefaultAllow:                 ingressDefaultAllow,
-			DefaultBackendTimeoutSeconds: backendTimeout,
-			Name:                         defaultIngressClass,
-			IncludeClasslessIngresses:    true,
-		},
+		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsNotUpdatedWhenExcludingClasslessIngresses(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithMissingBackupService(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress has no class annotation; feed-ingress is excluding classless ingresses",
+		"ingress with a backup service which doesn't exist",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:   "",
-			stripPathAnnotation:      "false",
+			backupServiceAnnotation:  "missing",
 			backendTimeoutSeconds:    "10",
 			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
 		}, ingressPath),
-		createDefaultServices(),
+		append(createDefaultServices(), createServiceFixture("fallback", ingressNamespace, "10.254.0.99")...),
 		createDefaultNamespaces(),
-		nil,
-		Config{
-			DefaultAllow:                 ingressDefaultAllow,
-			DefaultBackendTimeoutSeconds: backendTimeout,
-			Name:                         defaultIngressClass,
-			IncludeClasslessIngresses:    false,
-		},
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			BackendTimeoutSeconds: backendTimeout,
+		}},
+		defaultConfig(),
 	})
 }
 
-func TestUpdaterIsUpdatedForIngressClassSetToTestInIngressAndConfig(t *testing.T) {
+func TestUpdaterIsUpdatedForIngressWithOverriddenBackendTimeout(t *testing.T) {
 	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress requesting class==test; feed has class test",
+		"ingress with overridden backend timeout",
 		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
 			ingressAllowAnnotation:   "",
 			stripPathAnnotation:      "false",
-			backendTimeoutSeconds:    "10",
+			backendTimeoutSeconds:    "20",
 			frontendSchemeAnnotation: "internal",
-			ingressClassAnnotation:   "test",
+			ingressClassAnnotation:   defaultIngressClass,
 		}, ingressPath),
 		createDefaultServices(),
 		createDefaultNamespaces(),
@@ -1190,44 +1889,1083 @@ func TestUpdaterIsUpdatedForIngressClassSetToTestInIngressAndConfig(t *testing.T
 			ServiceAddress:        serviceIP,
 			ServicePort:           ingressSvcPort,
 			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
 			Allow:                 []string{},
 			StripPaths:            false,
-			BackendTimeoutSeconds: backendTimeout,
-			IngressClass:          "test",
+			BackendTimeoutSeconds: 20,
 		}},
-		Config{
-			DefaultAllow:                 ingressDefaultAllow,
-			DefaultBackendTimeoutSeconds: backendTimeout,
-			Name:                         "test",
-		},
+		defaultConfig(),
 	})
 }
 
-func TestNamespaceSelectorsIsUsedToGetIngresses(t *testing.T) {
-	asserter := assert.New(t)
-
-	client := new(fake.FakeClient)
-	updater := new(fakeUpdater)
-
-	config := Config{
-		DefaultAllow:                 ingressDefaultAllow,
-		DefaultBackendTimeoutSeconds: backendTimeout,
-		Name:                         defaultIngressClass,
+func TestUpdaterIsUpdatedForIngressWithOverriddenLegacyBackendTimeout(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with overridden backend timeout",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:        "",
+			stripPathAnnotation:           "false",
+			legacyBackendKeepaliveSeconds: "20",
+			frontendSchemeAnnotation:      "internal",
+			ingressClassAnnotation:        defaultIngressClass,
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: 20,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithDefaultBackendTimeout(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with default backend timeout",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			stripPathAnnotation:      "false",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: backendTimeout,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithOverriddenBackendMaxConnections(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with overridden backend max connections",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			stripPathAnnotation:      "false",
+			backendTimeoutSeconds:    "20",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+			backendMaxConnections:    "512",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: 20,
+			BackendMaxConnections: 512,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithOverriddenBackendMaxRequestsPerConnection(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with overridden backend max requests per connection",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:          "",
+			stripPathAnnotation:             "false",
+			frontendSchemeAnnotation:        "internal",
+			ingressClassAnnotation:          defaultIngressClass,
+			backendMaxRequestsPerConnection: "100",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:                       ingressNamespace,
+			Name:                            ingressName,
+			Host:                            ingressHost,
+			Path:                            ingressPath,
+			ServiceAddress:                  serviceIP,
+			ServicePort:                     ingressSvcPort,
+			LbScheme:                        "internal",
+			IngressClass:                    defaultIngressClass,
+			Allow:                           []string{},
+			StripPaths:                      false,
+			BackendTimeoutSeconds:           10,
+			BackendMaxConnections:           defaultMaxConnections,
+			BackendMaxRequestsPerConnection: 100,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithOverriddenBackendConnectionKeepAlive(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with overridden backend max requests per connection",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:     "",
+			stripPathAnnotation:        "false",
+			frontendSchemeAnnotation:   "internal",
+			ingressClassAnnotation:     defaultIngressClass,
+			backendConnectionKeepalive: "5m",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:               ingressNamespace,
+			Name:                    ingressName,
+			Host:                    ingressHost,
+			Path:                    ingressPath,
+			ServiceAddress:          serviceIP,
+			ServicePort:             ingressSvcPort,
+			LbScheme:                "internal",
+			IngressClass:            defaultIngressClass,
+			Allow:                   []string{},
+			StripPaths:              false,
+			BackendTimeoutSeconds:   10,
+			BackendMaxConnections:   defaultMaxConnections,
+			BackendKeepaliveTimeout: 5 * time.Minute,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterSkipsEntriesForIngressWithInvalidBackendConnectionKeepAliveAndBackendMaxRequestsPerConnection(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with overridden backend max requests per connection",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:          "",
+			stripPathAnnotation:             "false",
+			frontendSchemeAnnotation:        "internal",
+			ingressClassAnnotation:          defaultIngressClass,
+			backendConnectionKeepalive:      "50a",
+			backendMaxRequestsPerConnection: "-1",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: 10,
+			BackendMaxConnections: defaultMaxConnections,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithOverriddenBackendMaxFails(t *testing.T) {
+	config := defaultConfig()
+	config.DefaultBackendMaxFails = 3
+	config.DefaultBackendFailTimeout = time.Second * 10
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with overridden backend max fails",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			backendTimeoutSeconds:    "20",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+			backendMaxFails:          "5",
+			backendFailTimeout:       "30s",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			BackendTimeoutSeconds: 20,
+			BackendMaxFails:       5,
+			BackendFailTimeout:    time.Second * 30,
+		}},
+		config,
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithDefaultBackendMaxFails(t *testing.T) {
+	config := defaultConfig()
+	config.DefaultBackendMaxFails = 3
+	config.DefaultBackendFailTimeout = time.Second * 10
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with default backend max fails",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			backendTimeoutSeconds:    "20",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+			backendMaxFails:          "-1",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			BackendTimeoutSeconds: 20,
+			BackendMaxFails:       3,
+			BackendFailTimeout:    time.Second * 10,
+		}},
+		config,
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithOverriddenBackendKeepaliveCount(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with overridden backend keepalive count",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			backendTimeoutSeconds:    "20",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+			backendKeepaliveCount:    "64",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			BackendTimeoutSeconds: 20,
+			BackendKeepaliveCount: 64,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithDefaultBackendMaxConnections(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with default backend max connections",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			stripPathAnnotation:      "false",
+			backendTimeoutSeconds:    "20",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: 20,
+			BackendMaxConnections: defaultMaxConnections,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithDefaultProxyBufferValuesWhenNotOverridden(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with default proxy buffer values when not overridden by the ingress definition",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation: "",
+			ingressClassAnnotation: defaultIngressClass,
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: 10,
+			BackendMaxConnections: defaultMaxConnections,
+			ProxyBufferSize:       2,
+			ProxyBufferBlocks:     3,
+		}},
+		Config{
+			DefaultBackendTimeoutSeconds: backendTimeout,
+			DefaultProxyBufferSize:       2,
+			DefaultProxyBufferBlocks:     3,
+			Name:                         defaultIngressClass,
+		},
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressOverridesDefaultProxyBufferValues(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress definition overrides default proxy buffer values",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:      "",
+			proxyBufferSizeAnnotation:   "6",
+			proxyBufferBlocksAnnotation: "4",
+			ingressClassAnnotation:      defaultIngressClass,
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: 10,
+			BackendMaxConnections: defaultMaxConnections,
+			ProxyBufferSize:       6,
+			ProxyBufferBlocks:     4,
+		}},
+		Config{
+			DefaultBackendTimeoutSeconds: backendTimeout,
+			DefaultProxyBufferSize:       2,
+			DefaultProxyBufferBlocks:     3,
+			Name:                         defaultIngressClass,
+		},
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressDefinitionResetsToMacWhenProxyBufferValuesExceedMax(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress definition resets to max when proxy buffer values exceed max allowed values",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:      "",
+			proxyBufferSizeAnnotation:   "64",
+			proxyBufferBlocksAnnotation: "12",
+			ingressClassAnnotation:      defaultIngressClass,
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: 10,
+			BackendMaxConnections: defaultMaxConnections,
+			ProxyBufferSize:       32,
+			ProxyBufferBlocks:     8,
+		}},
+		Config{
+			DefaultBackendTimeoutSeconds: backendTimeout,
+			DefaultProxyBufferSize:       2,
+			DefaultProxyBufferBlocks:     3,
+			Name:                         defaultIngressClass,
+		},
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressClassNotSetInIngress(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress without ingress class set",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			stripPathAnnotation:      "false",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: backendTimeout,
+		}},
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressClassSetToDefaultInIngress(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with class set to default value",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			stripPathAnnotation:      "false",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: backendTimeout,
+			IngressClass:          defaultIngressClass,
+		}},
+		Config{
+			DefaultAllow:                 ingressDefaultAllow,
+			DefaultBackendTimeoutSeconds: backendTimeout,
+			Name:                         defaultIngressClass,
+		},
+	})
+}
+
+func TestUpdaterIsNotUpdatedForIngressClassSetToTestAndConfigSetToDefault(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress requesting class==test; feed instance has class " + defaultIngressClass,
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			stripPathAnnotation:      "false",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   "test",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		nil,
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedWhenIncludingClasslessIngresses(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress has no class annotation; feed-ingress is including classless ingresses",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			stripPathAnnotation:      "false",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: backendTimeout,
+			IngressClass:          "",
+		}},
+		Config{
+			DefaultAllow:                 ingressDefaultAllow,
+			DefaultBackendTimeoutSeconds: backendTimeout,
+			Name:                         defaultIngressClass,
+			IncludeClasslessIngresses:    true,
+		},
+	})
+}
+
+func TestUpdaterIsNotUpdatedWhenExcludingClasslessIngresses(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress has no class annotation; feed-ingress is excluding classless ingresses",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			stripPathAnnotation:      "false",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		nil,
+		Config{
+			DefaultAllow:                 ingressDefaultAllow,
+			DefaultBackendTimeoutSeconds: backendTimeout,
+			Name:                         defaultIngressClass,
+			IncludeClasslessIngresses:    false,
+		},
+	})
+}
+
+func TestUpdaterIsUpdatedForAnyIngressClassWhenConsideringAllClasses(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress requesting class==test; feed-dns considers all classes",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			stripPathAnnotation:      "false",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   "test",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: backendTimeout,
+			IngressClass:          "test",
+		}},
+		Config{
+			DefaultAllow:                 ingressDefaultAllow,
+			DefaultBackendTimeoutSeconds: backendTimeout,
+			AllIngressClasses:            true,
+		},
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressClassSetToTestInIngressAndConfig(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress requesting class==test; feed has class test",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			stripPathAnnotation:      "false",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   "test",
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			Allow:                 []string{},
+			StripPaths:            false,
+			BackendTimeoutSeconds: backendTimeout,
+			IngressClass:          "test",
+		}},
+		Config{
+			DefaultAllow:                 ingressDefaultAllow,
+			DefaultBackendTimeoutSeconds: backendTimeout,
+			Name:                         "test",
+		},
+	})
+}
+
+func TestNamespaceSelectorsIsUsedToGetIngresses(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+
+	config := Config{
+		DefaultAllow:                 ingressDefaultAllow,
+		DefaultBackendTimeoutSeconds: backendTimeout,
+		Name:                         defaultIngressClass,
 		NamespaceSelectors:           []*k8s.NamespaceSelector{{LabelName: "team", LabelValue: "theteam"}},
 		MatchAllNamespaceSelectors:   false,
 	}
 
 	config.KubernetesClient = client
 	config.Updaters = []Updater{updater}
-
+
+	controller := New(config, make(chan struct{}))
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+
+	// The purpose of this test is to ensure that the NamespaceSelectors is passed to GetIngresses
+	client.On("GetIngresses", config.NamespaceSelectors, config.MatchAllNamespaceSelectors).Return([]*networkingv1.Ingress{}, nil)
+
+	ingressWatcher, ingressCh := createFakeWatcher()
+	serviceWatcher, serviceCh := createFakeWatcher()
+	namespaceWatcher, namespaceCh := createFakeWatcher()
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+
+	asserter.NoError(controller.Start())
+	ingressCh <- struct{}{}
+	serviceCh <- struct{}{}
+	namespaceCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+
+	asserter.EqualError(controller.Health(), "updates failed to apply: found 0 ingresses")
+	asserter.NoError(controller.Stop())
+	time.Sleep(smallWaitTime)
+	updater.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func TestUpdaterIsUpdatedForIngressWithoutHostDefinition(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress without host definition",
+		createIngressesFixture(ingressNamespace, "", ingressSvcName, ingressSvcPort, map[string]string{
+			ingressClassAnnotation: defaultIngressClass,
+		}, ""),
+		createServiceFixture(ingressSvcName, "lalala land", serviceIP),
+		createDefaultNamespaces(),
+		nil,
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithoutPathDefinition(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress without path definition",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressClassAnnotation: defaultIngressClass,
+		}, ""),
+		createServiceFixture(ingressSvcName, "lalala land", serviceIP),
+		createDefaultNamespaces(),
+		nil,
+		defaultConfig(),
+	})
+}
+
+func TestUpdaterIsUpdatedForIngressWithoutRulesDefinition(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress without rules definition",
+		createIngressWithoutRules(),
+		createServiceFixture(ingressSvcName, "lalala land", serviceIP),
+		createDefaultNamespaces(),
+		nil,
+		defaultConfig(),
+	})
+}
+
+type clientExpectation func(client *fake.FakeClient, ingresses []*networkingv1.Ingress)
+
+var expectGetAllIngresses = func(client *fake.FakeClient, ingresses []*networkingv1.Ingress) {
+	client.On("GetAllIngresses").Return(ingresses, nil)
+}
+
+var expectGetIngresses = func(client *fake.FakeClient, ingresses []*networkingv1.Ingress) {
+	client.On("GetIngresses", &k8s.NamespaceSelector{LabelName: "team", LabelValue: "theteam"}).Return(ingresses, nil)
+}
+
+func runAndAssertUpdates(t *testing.T, clientExpectation clientExpectation, test testSpec) {
+	//given
+	asserter := assert.New(t)
+
+	fmt.Printf("test: %s\n", test.description)
+	// add ingress pointers to entries
+	test.entries = addIngresses(test.ingresses, test.entries)
+
+	// setup clients
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+
+	config := test.config
+
+	config.KubernetesClient = client
+	config.Updaters = []Updater{updater}
+
+	controller := New(config, make(chan struct{}))
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	// once for each update: ingress, service, namespace
+	updater.On("Update", test.entries).Return(nil).Times(3)
+
+	clientExpectation(client, test.ingresses)
+	client.On("GetServices").Return(test.services, nil)
+	client.On("RecordIngressEvent", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	ingressWatcher, ingressCh := createFakeWatcher()
+	serviceWatcher, serviceCh := createFakeWatcher()
+	namespaceWatcher, namespaceCh := createFakeWatcher()
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+
+	//when
+	asserter.NoError(controller.Start())
+	ingressCh <- struct{}{}
+	serviceCh <- struct{}{}
+	namespaceCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+
+	//then
+	asserter.NoError(controller.Stop())
+	time.Sleep(smallWaitTime)
+	updater.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func addIngresses(ingresses []*networkingv1.Ingress, entries IngressEntries) IngressEntries {
+	if len(ingresses) != len(entries) {
+		return entries
+	}
+	appendedEntries := IngressEntries{}
+	for i, entry := range entries {
+		entry.Ingress = ingresses[i]
+		appendedEntries = append(appendedEntries, entry)
+	}
+	return appendedEntries
+}
+
+func createLbEntriesFixture() IngressEntries {
+	return []IngressEntry{{
+		Namespace:             ingressNamespace,
+		Name:                  ingressName,
+		Host:                  ingressHost,
+		Path:                  ingressPath,
+		ServiceAddress:        serviceIP,
+		ServicePort:           ingressSvcPort,
+		Allow:                 strings.Split(ingressAllow, ","),
+		LbScheme:              lbScheme,
+		IngressClass:          defaultIngressClass,
+		BackendTimeoutSeconds: backendTimeout,
+	}}
+}
+
+const (
+	ingressHost           = "foo.sky.com"
+	ingressPath           = "/foo"
+	ingressName           = "foo-ingress"
+	ingressSvcName        = "foo-svc"
+	ingressSvcPort        = 80
+	ingressNamespace      = "happysky"
+	ingressAllow          = "10.82.0.0/16,10.44.0.0/16"
+	ingressDefaultAllow   = "10.50.0.0/16,10.1.0.0/16"
+	serviceIP             = "10.254.0.82"
+	lbScheme              = "internal"
+	backendTimeout        = 10
+	defaultMaxConnections = 0
+)
+
+func createDefaultIngresses() []*networkingv1.Ingress {
+	return createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+		ingressAllowAnnotation:   ingressAllow,
+		backendTimeoutSeconds:    "10",
+		frontendSchemeAnnotation: "internal",
+		ingressClassAnnotation:   defaultIngressClass,
+	}, ingressPath)
+}
+
+func createIngressesFromNonELBAnnotation(legacyAnnotations bool) []*networkingv1.Ingress {
+	var timeoutAnnotation, schemeAnnotation string
+	if legacyAnnotations {
+		timeoutAnnotation = legacyBackendKeepaliveSeconds
+		schemeAnnotation = legacyFrontendElbSchemeAnnotation
+	} else {
+		timeoutAnnotation = backendTimeoutSeconds
+		schemeAnnotation = frontendSchemeAnnotation
+	}
+
+	return createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+		ingressAllowAnnotation: ingressAllow,
+		timeoutAnnotation:      "10",
+		schemeAnnotation:       "internal",
+		ingressClassAnnotation: defaultIngressClass,
+	}, ingressPath)
+}
+
+func createIngressWithoutRules() []*networkingv1.Ingress {
+	return []*networkingv1.Ingress{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ingressName,
+				Namespace: ingressNamespace,
+				Annotations: map[string]string{
+					ingressClassAnnotation: defaultIngressClass,
+				},
+			},
+			Spec: networkingv1.IngressSpec{},
+		},
+	}
+
+}
+
+func TestUpdaterIsUpdatedForIngressWithDrain(t *testing.T) {
+	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
+		"ingress with drain set to true",
+		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
+			ingressAllowAnnotation:   "",
+			drainAnnotation:          "true",
+			backendTimeoutSeconds:    "10",
+			frontendSchemeAnnotation: "internal",
+			ingressClassAnnotation:   defaultIngressClass,
+		}, ingressPath),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		[]IngressEntry{{
+			Namespace:             ingressNamespace,
+			Name:                  ingressName,
+			Host:                  ingressHost,
+			Path:                  ingressPath,
+			ServiceAddress:        serviceIP,
+			ServicePort:           ingressSvcPort,
+			LbScheme:              "internal",
+			IngressClass:          defaultIngressClass,
+			Allow:                 []string{},
+			Drain:                 true,
+			BackendTimeoutSeconds: backendTimeout,
+		}},
+		defaultConfig(),
+	})
+}
+
+func createIngressesFixture(namespace string, host string, serviceName string, servicePort int, ingressAnnotations map[string]string, path string) []*networkingv1.Ingress {
+
+	pathType := networkingv1.PathTypeImplementationSpecific
+	paths := []networkingv1.HTTPIngressPath{{
+		Path:     path,
+		PathType: &pathType,
+		Backend: networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{
+				Name: serviceName,
+				Port: networkingv1.ServiceBackendPort{
+					Name:   "",
+					Number: int32(servicePort),
+				},
+			},
+		},
+	}}
+
+	annotations := make(map[string]string)
+
+	for annotationName, annotationVal := range ingressAnnotations {
+		switch annotationName {
+		case ingressAllowAnnotation:
+			annotations[ingressAllowAnnotation] = annotationVal
+		case stripPathAnnotation:
+			annotations[stripPathAnnotation] = annotationVal
+		case exactPathAnnotation:
+			annotations[exactPathAnnotation] = annotationVal
+		case pathRegexAnnotation:
+			annotations[pathRegexAnnotation] = annotationVal
+		case sslPassthroughAnnotation:
+			annotations[sslPassthroughAnnotation] = annotationVal
+		case acmeAnnotation:
+			annotations[acmeAnnotation] = annotationVal
+		case drainAnnotation:
+			annotations[drainAnnotation] = annotationVal
+		case vaultHtpasswdAnnotation:
+			annotations[vaultHtpasswdAnnotation] = annotationVal
+		case backendSPIFFEAnnotation:
+			annotations[backendSPIFFEAnnotation] = annotationVal
+		case backendSPIFFENameAnnotation:
+			annotations[backendSPIFFENameAnnotation] = annotationVal
+		case routePolicyAnnotation:
+			annotations[routePolicyAnnotation] = annotationVal
+		case allowFromConfigMapAnnotation:
+			annotations[allowFromConfigMapAnnotation] = annotationVal
+		case allowCountriesAnnotation:
+			annotations[allowCountriesAnnotation] = annotationVal
+		case denyCountriesAnnotation:
+			annotations[denyCountriesAnnotation] = annotationVal
+		case tracingAnnotation:
+			annotations[tracingAnnotation] = annotationVal
+		case tracingSampleRateAnnotation:
+			annotations[tracingSampleRateAnnotation] = annotationVal
+		case legacyFrontendElbSchemeAnnotation:
+			annotations[legacyFrontendElbSchemeAnnotation] = annotationVal
+		case frontendSchemeAnnotation:
+			annotations[frontendSchemeAnnotation] = annotationVal
+		case legacyBackendKeepaliveSeconds:
+			annotations[legacyBackendKeepaliveSeconds] = annotationVal
+		case backendTimeoutSeconds:
+			annotations[backendTimeoutSeconds] = annotationVal
+		case backendMaxConnections:
+			annotations[backendMaxConnections] = annotationVal
+		case backendMaxFails:
+			annotations[backendMaxFails] = annotationVal
+		case backendKeepaliveCount:
+			annotations[backendKeepaliveCount] = annotationVal
+		case backupServiceAnnotation:
+			annotations[backupServiceAnnotation] = annotationVal
+		case backendProtocolAnnotation:
+			annotations[backendProtocolAnnotation] = annotationVal
+		case interceptErrorsAnnotation:
+			annotations[interceptErrorsAnnotation] = annotationVal
+		case securityHeadersAnnotation:
+			annotations[securityHeadersAnnotation] = annotationVal
+		case internalPathsAnnotation:
+			annotations[internalPathsAnnotation] = annotationVal
+		case trailingSlashAnnotation:
+			annotations[trailingSlashAnnotation] = annotationVal
+		case webSocketUpgradeAnnotation:
+			annotations[webSocketUpgradeAnnotation] = annotationVal
+		case webSocketTimeoutAnnotation:
+			annotations[webSocketTimeoutAnnotation] = annotationVal
+		case apiKeyHeaderAnnotation:
+			annotations[apiKeyHeaderAnnotation] = annotationVal
+		case apiKeysFromSecretAnnotation:
+			annotations[apiKeysFromSecretAnnotation] = annotationVal
+		case apiKeyRateLimitAnnotation:
+			annotations[apiKeyRateLimitAnnotation] = annotationVal
+		case statsNameAnnotation:
+			annotations[statsNameAnnotation] = annotationVal
+		case njsContentAnnotation:
+			annotations[njsContentAnnotation] = annotationVal
+		case njsHeaderFilterAnnotation:
+			annotations[njsHeaderFilterAnnotation] = annotationVal
+		case backendFailTimeout:
+			annotations[backendFailTimeout] = annotationVal
+		case proxyBufferSizeAnnotation:
+			annotations[proxyBufferSizeAnnotation] = annotationVal
+		case proxyBufferBlocksAnnotation:
+			annotations[proxyBufferBlocksAnnotation] = annotationVal
+		case ingressClassAnnotation:
+			annotations[ingressClassAnnotation] = annotationVal
+		case backendConnectionKeepalive:
+			annotations[backendConnectionKeepalive] = annotationVal
+		case backendMaxRequestsPerConnection:
+			annotations[backendMaxRequestsPerConnection] = annotationVal
+		}
+	}
+
+	ingressDefinition := createIngressWithoutRules()
+	var ingressRules []networkingv1.IngressRule
+
+	if host != "" {
+		ingressRuleValue := networkingv1.IngressRuleValue{}
+		if path != "" {
+			ingressRuleValue.HTTP = &networkingv1.HTTPIngressRuleValue{Paths: paths}
+		}
+		ingressRule := networkingv1.IngressRule{
+			Host:             host,
+			IngressRuleValue: ingressRuleValue,
+		}
+
+		ingressRules = append(ingressRules, ingressRule)
+	}
+
+	ingressDefinition[0].ObjectMeta.Namespace = namespace
+	ingressDefinition[0].ObjectMeta.Annotations = annotations
+	ingressDefinition[0].Spec.Rules = ingressRules
+
+	return ingressDefinition
+}
+
+func createDefaultServices() []*corev1.Service {
+	return createServiceFixture(ingressSvcName, ingressNamespace, serviceIP)
+}
+
+func createServiceFixture(name string, namespace string, clusterIP string) []*corev1.Service {
+	return []*corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: corev1.ServiceSpec{
+				ClusterIP: clusterIP,
+			},
+		},
+	}
+}
+
+func createDefaultNamespaces() []*corev1.Namespace {
+	return createNamespaceFixture(ingressNamespace, map[string]string{})
+}
+
+func createNamespaceFixture(name string, labels map[string]string) []*corev1.Namespace {
+	return []*corev1.Namespace{
+		{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Namespace",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: labels,
+			},
+			Spec:   corev1.NamespaceSpec{},
+			Status: corev1.NamespaceStatus{},
+		},
+	}
+}
+
+func TestUpdateFailsWhenK8sClientReturnsNoIngresses(t *testing.T) {
+	test := testSpec{
+		"ingress without rules definition",
+		createDefaultIngresses(),
+		createDefaultServices(),
+		createDefaultNamespaces(),
+		createLbEntriesFixture(),
+		defaultConfig(),
+	}
+
+	asserter := assert.New(t)
+	fmt.Printf("test: %s\n", test.description)
+	test.entries = addIngresses(test.ingresses, test.entries)
+
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+
+	config := test.config
+	config.KubernetesClient = client
+	config.Updaters = []Updater{updater}
 	controller := New(config, make(chan struct{}))
 
 	updater.On("Start").Return(nil)
 	updater.On("Stop").Return(nil)
 	updater.On("Health").Return(nil)
 
-	// The purpose of this test is to ensure that the NamespaceSelectors is passed to GetIngresses
-	client.On("GetIngresses", config.NamespaceSelectors, config.MatchAllNamespaceSelectors).Return([]*networkingv1.Ingress{}, nil)
+	// This is the call we are testing (by returning an empty array of ingresses)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{}, nil)
 
 	ingressWatcher, ingressCh := createFakeWatcher()
 	serviceWatcher, serviceCh := createFakeWatcher()
@@ -1240,356 +2978,464 @@ func TestNamespaceSelectorsIsUsedToGetIngresses(t *testing.T) {
 	ingressCh <- struct{}{}
 	serviceCh <- struct{}{}
 	namespaceCh <- struct{}{}
+
 	time.Sleep(smallWaitTime)
 
+	// This is the main assertion we are making (that 0 ingresses fails the update)
 	asserter.EqualError(controller.Health(), "updates failed to apply: found 0 ingresses")
 	asserter.NoError(controller.Stop())
+
 	time.Sleep(smallWaitTime)
+
 	updater.AssertExpectations(t)
 	client.AssertExpectations(t)
 }
 
-func TestUpdaterIsUpdatedForIngressWithoutHostDefinition(t *testing.T) {
-	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress without host definition",
-		createIngressesFixture(ingressNamespace, "", ingressSvcName, ingressSvcPort, map[string]string{
-			ingressClassAnnotation: defaultIngressClass,
-		}, ""),
-		createServiceFixture(ingressSvcName, "lalala land", serviceIP),
-		createDefaultNamespaces(),
-		nil,
-		defaultConfig(),
-	})
-}
+func TestUpdateSucceedsWithNoIngressesWhenAllowed(t *testing.T) {
+	asserter := assert.New(t)
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+	controller := New(Config{
+		KubernetesClient:   client,
+		Updaters:           []Updater{updater},
+		AllowZeroIngresses: true,
+	}, make(chan struct{}))
 
-func TestUpdaterIsUpdatedForIngressWithoutPathDefinition(t *testing.T) {
-	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress without path definition",
-		createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
-			ingressClassAnnotation: defaultIngressClass,
-		}, ""),
-		createServiceFixture(ingressSvcName, "lalala land", serviceIP),
-		createDefaultNamespaces(),
-		nil,
-		defaultConfig(),
-	})
-}
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.MatchedBy(func(entries IngressEntries) bool { return len(entries) == 0 })).Return(nil)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{}, nil)
+	client.On("GetServices").Return([]*corev1.Service{}, nil)
 
-func TestUpdaterIsUpdatedForIngressWithoutRulesDefinition(t *testing.T) {
-	runAndAssertUpdates(t, expectGetAllIngresses, testSpec{
-		"ingress without rules definition",
-		createIngressWithoutRules(),
-		createServiceFixture(ingressSvcName, "lalala land", serviceIP),
-		createDefaultNamespaces(),
-		nil,
-		defaultConfig(),
-	})
-}
+	ingressWatcher, ingressCh := createFakeWatcher()
+	serviceWatcher, serviceCh := createFakeWatcher()
+	namespaceWatcher, namespaceCh := createFakeWatcher()
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
 
-type clientExpectation func(client *fake.FakeClient, ingresses []*networkingv1.Ingress)
+	asserter.NoError(controller.Start())
+	ingressCh <- struct{}{}
+	serviceCh <- struct{}{}
+	namespaceCh <- struct{}{}
 
-var expectGetAllIngresses = func(client *fake.FakeClient, ingresses []*networkingv1.Ingress) {
-	client.On("GetAllIngresses").Return(ingresses, nil)
-}
+	time.Sleep(smallWaitTime)
 
-var expectGetIngresses = func(client *fake.FakeClient, ingresses []*networkingv1.Ingress) {
-	client.On("GetIngresses", &k8s.NamespaceSelector{LabelName: "team", LabelValue: "theteam"}).Return(ingresses, nil)
-}
+	asserter.NoError(controller.Health())
+	asserter.Equal(float64(0), testutil.ToFloat64(ingressEntries))
+	asserter.NoError(controller.Stop())
 
-func runAndAssertUpdates(t *testing.T, clientExpectation clientExpectation, test testSpec) {
-	//given
-	asserter := assert.New(t)
+	time.Sleep(smallWaitTime)
 
-	fmt.Printf("test: %s\n", test.description)
-	// add ingress pointers to entries
-	test.entries = addIngresses(test.ingresses, test.entries)
+	updater.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
 
-	// setup clients
+func TestConflictingIngressesAreReportedOnce(t *testing.T) {
+	asserter := assert.New(t)
 	client := new(fake.FakeClient)
 	updater := new(fakeUpdater)
+	controller := New(Config{
+		KubernetesClient: client,
+		Updaters:         []Updater{updater},
+		ConflictStrategy: ConflictOldest,
+	}, make(chan struct{}))
 
-	config := test.config
+	older := createDefaultIngresses()[0]
+	older.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	newer := createDefaultIngresses()[0]
+	newer.Name = "newer-ingress"
+	newer.CreationTimestamp = metav1.Now()
 
-	config.KubernetesClient = client
-	config.Updaters = []Updater{updater}
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.MatchedBy(func(entries IngressEntries) bool {
+		return len(entries) == 1 && entries[0].Name == older.Name
+	})).Return(nil)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{newer, older}, nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("RecordIngressEvent", newer, "HostPathConflict", mock.AnythingOfType("string")).Return(nil)
 
-	controller := New(config, make(chan struct{}))
+	ingressWatcher, ingressCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
 
+	asserter.NoError(controller.Start())
+	ingressCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	ingressCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+
+	asserter.NoError(controller.Health())
+	asserter.Equal(float64(1), testutil.ToFloat64(
+		ingressConflicts.WithLabelValues(newer.Namespace, newer.Name, ingressHost, ingressPath)))
+	asserter.NoError(controller.Stop())
+
+	updater.AssertExpectations(t)
+	client.AssertExpectations(t)
+	client.AssertNumberOfCalls(t, "RecordIngressEvent", 1)
+}
+
+func TestSkippedIngressesAreCountedByReasonAndReported(t *testing.T) {
+	asserter := assert.New(t)
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+	controller := New(Config{
+		KubernetesClient: client,
+		Updaters:         []Updater{updater},
+		Name:             defaultIngressClass,
+	}, make(chan struct{}))
+
+	valid := createDefaultIngresses()[0]
+	noService := createDefaultIngresses()[0]
+	noService.Name = "no-service"
+	noService.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name = "missing-service"
+	otherClass := createDefaultIngresses()[0]
+	otherClass.Name = "other-class"
+	otherClass.Annotations = map[string]string{ingressClassAnnotation: "another-controller"}
+	invalid := createDefaultIngresses()[0]
+	invalid.Name = "invalid"
+	invalid.Spec.Rules[0].Host = ""
+
+	skipCount := func(reason string) float64 {
+		return testutil.ToFloat64(skippedIngresses.WithLabelValues(reason))
+	}
 	updater.On("Start").Return(nil)
 	updater.On("Stop").Return(nil)
-	// once for each update: ingress, service, namespace
-	updater.On("Update", test.entries).Return(nil).Times(3)
-
-	clientExpectation(client, test.ingresses)
-	client.On("GetServices").Return(test.services, nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.MatchedBy(func(entries IngressEntries) bool {
+		return len(entries) == 1 && entries[0].Name == valid.Name
+	})).Return(nil)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{valid, noService, otherClass, invalid}, nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("RecordIngressEvent", noService, "ServiceNotFound", mock.AnythingOfType("string")).Return(nil)
+	client.On("RecordIngressEvent", invalid, "InvalidIngressEntry", mock.AnythingOfType("string")).Return(nil)
 
 	ingressWatcher, ingressCh := createFakeWatcher()
-	serviceWatcher, serviceCh := createFakeWatcher()
-	namespaceWatcher, namespaceCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
 	client.On("WatchIngresses").Return(ingressWatcher)
 	client.On("WatchServices").Return(serviceWatcher)
 	client.On("WatchNamespaces").Return(namespaceWatcher)
 
-	//when
 	asserter.NoError(controller.Start())
 	ingressCh <- struct{}{}
-	serviceCh <- struct{}{}
-	namespaceCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	ingressCh <- struct{}{}
 	time.Sleep(smallWaitTime)
 
-	//then
+	asserter.NoError(controller.Health())
+	asserter.Equal(float64(1), skipCount(skipServiceMissing), "entries should only be counted once across updates")
+	asserter.Equal(float64(1), skipCount(skipClassMismatch))
+	asserter.Equal(float64(1), skipCount(skipInvalidEntry))
+	asserter.Equal(float64(0), skipCount(skipConflict))
 	asserter.NoError(controller.Stop())
-	time.Sleep(smallWaitTime)
+
 	updater.AssertExpectations(t)
 	client.AssertExpectations(t)
+	client.AssertNumberOfCalls(t, "RecordIngressEvent", 2)
 }
 
-func addIngresses(ingresses []*networkingv1.Ingress, entries IngressEntries) IngressEntries {
-	if len(ingresses) != len(entries) {
-		return entries
-	}
-	appendedEntries := IngressEntries{}
-	for i, entry := range entries {
-		entry.Ingress = ingresses[i]
-		appendedEntries = append(appendedEntries, entry)
+func TestBackendsWithoutReadyEndpointsAreReportedButStillUsed(t *testing.T) {
+	asserter := assert.New(t)
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+	controller := New(Config{
+		KubernetesClient: client,
+		Updaters:         []Updater{updater},
+		CheckEndpoints:   true,
+	}, make(chan struct{}))
+
+	ingress := createDefaultIngresses()[0]
+	services := createDefaultServices()
+	services[0].Spec.Ports = []corev1.ServicePort{{Name: "http", Port: ingressSvcPort}}
+	notReady := false
+	slices := []*discoveryv1.EndpointSlice{newEndpointSlice(ingressNamespace, ingressSvcName, "http", 8080,
+		discoveryv1.Endpoint{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}})}
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.MatchedBy(func(entries IngressEntries) bool {
+		return len(entries) == 1 && entries[0].Name == ingress.Name
+	})).Return(nil)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{ingress}, nil)
+	client.On("GetServices").Return(services, nil)
+	client.On("SetEndpointSliceServices", map[string]bool{ingressNamespace + "/" + ingressSvcName: true}).Return(nil)
+	client.On("GetEndpointSlices").Return(slices, nil)
+	client.On("RecordIngressEvent", ingress, "NoReadyEndpoints", mock.AnythingOfType("string")).Return(nil)
+
+	ingressWatcher, ingressCh := createFakeWatcher()
+	for _, watch := range []string{"WatchServices", "WatchNamespaces", "WatchEndpointSlices"} {
+		watcher, _ := createFakeWatcher()
+		client.On(watch).Return(watcher)
 	}
-	return appendedEntries
-}
+	client.On("WatchIngresses").Return(ingressWatcher)
 
-func createLbEntriesFixture() IngressEntries {
-	return []IngressEntry{{
-		Namespace:             ingressNamespace,
-		Name:                  ingressName,
-		Host:                  ingressHost,
-		Path:                  ingressPath,
-		ServiceAddress:        serviceIP,
-		ServicePort:           ingressSvcPort,
-		Allow:                 strings.Split(ingressAllow, ","),
-		LbScheme:              lbScheme,
-		IngressClass:          defaultIngressClass,
-		BackendTimeoutSeconds: backendTimeout,
-	}}
-}
+	asserter.NoError(controller.Start())
+	ingressCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	ingressCh <- struct{}{}
+	time.Sleep(smallWaitTime)
 
-const (
-	ingressHost           = "foo.sky.com"
-	ingressPath           = "/foo"
-	ingressName           = "foo-ingress"
-	ingressSvcName        = "foo-svc"
-	ingressSvcPort        = 80
-	ingressNamespace      = "happysky"
-	ingressAllow          = "10.82.0.0/16,10.44.0.0/16"
-	ingressDefaultAllow   = "10.50.0.0/16,10.1.0.0/16"
-	serviceIP             = "10.254.0.82"
-	lbScheme              = "internal"
-	backendTimeout        = 10
-	defaultMaxConnections = 0
-)
+	asserter.NoError(controller.Health())
+	asserter.Equal(float64(1), testutil.ToFloat64(
+		ingressUnreadyBackends.WithLabelValues(ingress.Namespace, ingress.Name, ingressHost, ingressPath)))
+	asserter.NoError(controller.Stop())
 
-func createDefaultIngresses() []*networkingv1.Ingress {
-	return createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
-		ingressAllowAnnotation:   ingressAllow,
-		backendTimeoutSeconds:    "10",
-		frontendSchemeAnnotation: "internal",
-		ingressClassAnnotation:   defaultIngressClass,
-	}, ingressPath)
+	updater.AssertExpectations(t)
+	client.AssertExpectations(t)
+	client.AssertNumberOfCalls(t, "RecordIngressEvent", 1)
 }
 
-func createIngressesFromNonELBAnnotation(legacyAnnotations bool) []*networkingv1.Ingress {
-	var timeoutAnnotation, schemeAnnotation string
-	if legacyAnnotations {
-		timeoutAnnotation = legacyBackendKeepaliveSeconds
-		schemeAnnotation = legacyFrontendElbSchemeAnnotation
-	} else {
-		timeoutAnnotation = backendTimeoutSeconds
-		schemeAnnotation = frontendSchemeAnnotation
-	}
+func TestEntriesHaveTheReadyEndpointsOfTheirServicePortInEndpointsMode(t *testing.T) {
+	asserter := assert.New(t)
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+	controller := New(Config{
+		KubernetesClient: client,
+		Updaters:         []Updater{updater},
+		EndpointsMode:    true,
+	}, make(chan struct{}))
 
-	return createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort, map[string]string{
-		ingressAllowAnnotation: ingressAllow,
-		timeoutAnnotation:      "10",
-		schemeAnnotation:       "internal",
-		ingressClassAnnotation: defaultIngressClass,
-	}, ingressPath)
-}
+	ingress := createDefaultIngresses()[0]
+	services := createDefaultServices()
+	services[0].Spec.Ports = []corev1.ServicePort{{Name: "http", Port: ingressSvcPort}}
+	notReady := false
+	slices := []*discoveryv1.EndpointSlice{newEndpointSlice(ingressNamespace, ingressSvcName, "http", 8080,
+		discoveryv1.Endpoint{Addresses: []string{"10.0.0.2"}},
+		discoveryv1.Endpoint{Addresses: []string{"10.0.0.1"}},
+		discoveryv1.Endpoint{Addresses: []string{"10.0.0.3"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}})}
 
-func createIngressWithoutRules() []*networkingv1.Ingress {
-	return []*networkingv1.Ingress{
-		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      ingressName,
-				Namespace: ingressNamespace,
-				Annotations: map[string]string{
-					ingressClassAnnotation: defaultIngressClass,
-				},
-			},
-			Spec: networkingv1.IngressSpec{},
-		},
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.MatchedBy(func(entries IngressEntries) bool {
+		return len(entries) == 1 && entries[0].ServiceAddress == serviceIP && reflect.DeepEqual(entries[0].Endpoints,
+			[]Endpoint{{Address: "10.0.0.1", Port: 8080}, {Address: "10.0.0.2", Port: 8080}})
+	})).Return(nil)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{ingress}, nil)
+	client.On("GetServices").Return(services, nil)
+	client.On("SetEndpointSliceServices", map[string]bool{ingressNamespace + "/" + ingressSvcName: true}).Return(nil)
+	client.On("GetEndpointSlices").Return(slices, nil)
+
+	ingressWatcher, ingressCh := createFakeWatcher()
+	for _, watch := range []string{"WatchServices", "WatchNamespaces", "WatchEndpointSlices"} {
+		watcher, _ := createFakeWatcher()
+		client.On(watch).Return(watcher)
 	}
+	client.On("WatchIngresses").Return(ingressWatcher)
 
-}
+	asserter.NoError(controller.Start())
+	ingressCh <- struct{}{}
+	time.Sleep(smallWaitTime)
 
-func createIngressesFixture(namespace string, host string, serviceName string, servicePort int, ingressAnnotations map[string]string, path string) []*networkingv1.Ingress {
+	asserter.NoError(controller.Health())
+	asserter.NoError(controller.Stop())
 
-	pathType := networkingv1.PathTypeImplementationSpecific
-	paths := []networkingv1.HTTPIngressPath{{
-		Path:     path,
-		PathType: &pathType,
-		Backend: networkingv1.IngressBackend{
-			Service: &networkingv1.IngressServiceBackend{
-				Name: serviceName,
-				Port: networkingv1.ServiceBackendPort{
-					Name:   "",
-					Number: int32(servicePort),
-				},
-			},
-		},
-	}}
+	updater.AssertExpectations(t)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "RecordIngressEvent", mock.Anything, mock.Anything, mock.Anything)
+}
 
-	annotations := make(map[string]string)
+func TestHeadlessServicesAreProxiedToThroughTheirEndpointsInEndpointsMode(t *testing.T) {
+	asserter := assert.New(t)
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+	controller := New(Config{
+		KubernetesClient: client,
+		Updaters:         []Updater{updater},
+		EndpointsMode:    true,
+	}, make(chan struct{}))
 
-	for annotationName, annotationVal := range ingressAnnotations {
-		switch annotationName {
-		case ingressAllowAnnotation:
-			annotations[ingressAllowAnnotation] = annotationVal
-		case stripPathAnnotation:
-			annotations[stripPathAnnotation] = annotationVal
-		case exactPathAnnotation:
-			annotations[exactPathAnnotation] = annotationVal
-		case legacyFrontendElbSchemeAnnotation:
-			annotations[legacyFrontendElbSchemeAnnotation] = annotationVal
-		case frontendSchemeAnnotation:
-			annotations[frontendSchemeAnnotation] = annotationVal
-		case legacyBackendKeepaliveSeconds:
-			annotations[legacyBackendKeepaliveSeconds] = annotationVal
-		case backendTimeoutSeconds:
-			annotations[backendTimeoutSeconds] = annotationVal
-		case backendMaxConnections:
-			annotations[backendMaxConnections] = annotationVal
-		case proxyBufferSizeAnnotation:
-			annotations[proxyBufferSizeAnnotation] = annotationVal
-		case proxyBufferBlocksAnnotation:
-			annotations[proxyBufferBlocksAnnotation] = annotationVal
-		case ingressClassAnnotation:
-			annotations[ingressClassAnnotation] = annotationVal
-		case backendConnectionKeepalive:
-			annotations[backendConnectionKeepalive] = annotationVal
-		case backendMaxRequestsPerConnection:
-			annotations[backendMaxRequestsPerConnection] = annotationVal
-		}
+	ingresses := append(createDefaultIngresses(), createIngressesFixture(ingressNamespace, "unready.com",
+		"unready-service", ingressSvcPort, map[string]string{}, ingressPath)...)
+	services := append(createServiceFixture(ingressSvcName, ingressNamespace, corev1.ClusterIPNone),
+		createServiceFixture("unready-service", ingressNamespace, corev1.ClusterIPNone)...)
+	for _, service := range services {
+		service.Spec.Ports = []corev1.ServicePort{{Name: "http", Port: ingressSvcPort}}
 	}
+	slices := []*discoveryv1.EndpointSlice{newEndpointSlice(ingressNamespace, ingressSvcName, "http", 8080,
+		discoveryv1.Endpoint{Addresses: []string{"10.0.0.2"}},
+		discoveryv1.Endpoint{Addresses: []string{"10.0.0.1"}})}
 
-	ingressDefinition := createIngressWithoutRules()
-	var ingressRules []networkingv1.IngressRule
-
-	if host != "" {
-		ingressRuleValue := networkingv1.IngressRuleValue{}
-		if path != "" {
-			ingressRuleValue.HTTP = &networkingv1.HTTPIngressRuleValue{Paths: paths}
-		}
-		ingressRule := networkingv1.IngressRule{
-			Host:             host,
-			IngressRuleValue: ingressRuleValue,
-		}
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.MatchedBy(func(entries IngressEntries) bool {
+		return len(entries) == 1 && entries[0].Headless &&
+			entries[0].ServiceAddress == ingressSvcName+"."+ingressNamespace+".svc" &&
+			reflect.DeepEqual(entries[0].Endpoints, []Endpoint{{Address: "10.0.0.1", Port: 8080},
+				{Address: "10.0.0.2", Port: 8080}})
+	})).Return(nil)
+	client.On("GetAllIngresses").Return(ingresses, nil)
+	client.On("GetServices").Return(services, nil)
+	client.On("SetEndpointSliceServices", map[string]bool{ingressNamespace + "/" + ingressSvcName: true,
+		ingressNamespace + "/unready-service": true}).Return(nil)
+	client.On("GetEndpointSlices").Return(slices, nil)
+	client.On("RecordIngressEvent", ingresses[1], "HeadlessServiceUnready", mock.AnythingOfType("string")).Return(nil)
 
-		ingressRules = append(ingressRules, ingressRule)
+	ingressWatcher, ingressCh := createFakeWatcher()
+	for _, watch := range []string{"WatchServices", "WatchNamespaces", "WatchEndpointSlices"} {
+		watcher, _ := createFakeWatcher()
+		client.On(watch).Return(watcher)
 	}
+	client.On("WatchIngresses").Return(ingressWatcher)
 
-	ingressDefinition[0].ObjectMeta.Namespace = namespace
-	ingressDefinition[0].ObjectMeta.Annotations = annotations
-	ingressDefinition[0].Spec.Rules = ingressRules
+	asserter.NoError(controller.Start())
+	ingressCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+	ingressCh <- struct{}{}
+	time.Sleep(smallWaitTime)
 
-	return ingressDefinition
-}
+	asserter.NoError(controller.Health())
+	asserter.Equal(float64(1), testutil.ToFloat64(skippedIngresses.WithLabelValues(skipHeadlessUnready)))
+	asserter.NoError(controller.Stop())
 
-func createDefaultServices() []*corev1.Service {
-	return createServiceFixture(ingressSvcName, ingressNamespace, serviceIP)
+	updater.AssertExpectations(t)
+	client.AssertExpectations(t)
+	client.AssertNumberOfCalls(t, "RecordIngressEvent", 1)
 }
 
-func createServiceFixture(name string, namespace string, clusterIP string) []*corev1.Service {
-	return []*corev1.Service{
-		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      name,
-				Namespace: namespace,
-			},
-			Spec: corev1.ServiceSpec{
-				ClusterIP: clusterIP,
-			},
-		},
-	}
-}
+func TestOnlyServicesReferencedByServedIngressesAreWatched(t *testing.T) {
+	asserter := assert.New(t)
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+	controller := New(Config{
+		Name:                   defaultIngressClass,
+		KubernetesClient:       client,
+		Updaters:               []Updater{updater},
+		ReferencedServicesOnly: true,
+	}, make(chan struct{}))
 
-func createDefaultNamespaces() []*corev1.Namespace {
-	return createNamespaceFixture(ingressNamespace, map[string]string{})
-}
+	ingress := createDefaultIngresses()[0]
+	otherClass := createIngressesFixture("other-namespace", "other.com", "other-service", ingressSvcPort,
+		map[string]string{ingressClassAnnotation: "other"}, ingressPath)[0]
 
-func createNamespaceFixture(name string, labels map[string]string) []*corev1.Namespace {
-	return []*corev1.Namespace{
-		{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Namespace",
-				APIVersion: "v1",
-			},
-			ObjectMeta: metav1.ObjectMeta{
-				Name:   name,
-				Labels: labels,
-			},
-			Spec:   corev1.NamespaceSpec{},
-			Status: corev1.NamespaceStatus{},
-		},
-	}
-}
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.MatchedBy(func(entries IngressEntries) bool {
+		return len(entries) == 1 && entries[0].Name == ingress.Name
+	})).Return(nil)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{ingress, otherClass}, nil)
+	client.On("SetReferencedServices", map[string]bool{}).Return(nil).Once()
+	client.On("SetReferencedServices", map[string]bool{ingressNamespace + "/" + ingressSvcName: true}).Return(nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
 
-func TestUpdateFailsWhenK8sClientReturnsNoIngresses(t *testing.T) {
-	test := testSpec{
-		"ingress without rules definition",
-		createDefaultIngresses(),
-		createDefaultServices(),
-		createDefaultNamespaces(),
-		createLbEntriesFixture(),
-		defaultConfig(),
+	ingressWatcher, ingressCh := createFakeWatcher()
+	for _, watch := range []string{"WatchServices", "WatchNamespaces"} {
+		watcher, _ := createFakeWatcher()
+		client.On(watch).Return(watcher)
 	}
+	client.On("WatchIngresses").Return(ingressWatcher)
 
-	asserter := assert.New(t)
-	fmt.Printf("test: %s\n", test.description)
-	test.entries = addIngresses(test.ingresses, test.entries)
+	asserter.NoError(controller.Start())
+	ingressCh <- struct{}{}
+	time.Sleep(smallWaitTime)
+
+	asserter.NoError(controller.Health())
+	asserter.NoError(controller.Stop())
+
+	updater.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
 
+func TestIngressesCantUseHostsOwnedByAnotherNamespace(t *testing.T) {
+	asserter := assert.New(t)
 	client := new(fake.FakeClient)
 	updater := new(fakeUpdater)
+	controller := New(Config{
+		KubernetesClient: client,
+		Updaters:         []Updater{updater},
+		HostOwnership:    true,
+	}, make(chan struct{}))
 
-	config := test.config
-	config.KubernetesClient = client
-	config.Updaters = []Updater{updater}
-	controller := New(config, make(chan struct{}))
+	owner := createDefaultIngresses()[0]
+	owner.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	hijacker := createIngressesFixture("other-namespace", ingressHost, ingressSvcName, ingressSvcPort,
+		map[string]string{ingressClassAnnotation: defaultIngressClass}, "/hijack")[0]
+	hijacker.CreationTimestamp = metav1.Now()
+	services := append(createDefaultServices(), createServiceFixture(ingressSvcName, "other-namespace", serviceIP)...)
 
 	updater.On("Start").Return(nil)
 	updater.On("Stop").Return(nil)
 	updater.On("Health").Return(nil)
-
-	// This is the call we are testing (by returning an empty array of ingresses)
-	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{}, nil)
+	updater.On("Update", mock.MatchedBy(func(entries IngressEntries) bool {
+		return len(entries) == 1 && entries[0].Namespace == owner.Namespace
+	})).Return(nil)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{hijacker, owner}, nil)
+	client.On("GetServices").Return(services, nil)
+	client.On("RecordIngressEvent", hijacker, "HostOwnedByAnotherNamespace", mock.AnythingOfType("string")).Return(nil)
 
 	ingressWatcher, ingressCh := createFakeWatcher()
-	serviceWatcher, serviceCh := createFakeWatcher()
-	namespaceWatcher, namespaceCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
 	client.On("WatchIngresses").Return(ingressWatcher)
 	client.On("WatchServices").Return(serviceWatcher)
 	client.On("WatchNamespaces").Return(namespaceWatcher)
 
 	asserter.NoError(controller.Start())
 	ingressCh <- struct{}{}
-	serviceCh <- struct{}{}
-	namespaceCh <- struct{}{}
-
 	time.Sleep(smallWaitTime)
 
-	// This is the main assertion we are making (that 0 ingresses fails the update)
-	asserter.EqualError(controller.Health(), "updates failed to apply: found 0 ingresses")
+	asserter.NoError(controller.Health())
+	asserter.Equal(float64(1), testutil.ToFloat64(
+		ingressHostRejections.WithLabelValues("other-namespace", hijacker.Name, ingressHost)))
 	asserter.NoError(controller.Stop())
 
+	updater.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+func TestIngressesBeyondTheirNamespaceQuotaAreRejected(t *testing.T) {
+	asserter := assert.New(t)
+	client := new(fake.FakeClient)
+	updater := new(fakeUpdater)
+	controller := New(Config{
+		KubernetesClient: client,
+		Updaters:         []Updater{updater},
+		NamespaceQuota:   NamespaceQuota{MaxHosts: 1},
+	}, make(chan struct{}))
+
+	existing := createDefaultIngresses()[0]
+	existing.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	extra := createIngressesFixture(ingressNamespace, "extra.com", ingressSvcName, ingressSvcPort,
+		map[string]string{ingressClassAnnotation: defaultIngressClass}, ingressPath)[0]
+	extra.Name = "extra"
+	extra.CreationTimestamp = metav1.Now()
+
+	updater.On("Start").Return(nil)
+	updater.On("Stop").Return(nil)
+	updater.On("Health").Return(nil)
+	updater.On("Update", mock.MatchedBy(func(entries IngressEntries) bool {
+		return len(entries) == 1 && entries[0].Name == existing.Name
+	})).Return(nil)
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{extra, existing}, nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	client.On("RecordIngressEvent", extra, "NamespaceQuotaExceeded", mock.AnythingOfType("string")).Return(nil)
+
+	ingressWatcher, ingressCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+
+	asserter.NoError(controller.Start())
+	ingressCh <- struct{}{}
 	time.Sleep(smallWaitTime)
 
+	asserter.NoError(controller.Health())
+	asserter.Equal(float64(1), testutil.ToFloat64(
+		ingressQuotaRejections.WithLabelValues(ingressNamespace, "extra", "extra.com", ingressPath, "hosts")))
+	asserter.NoError(controller.Stop())
+
 	updater.AssertExpectations(t)
 	client.AssertExpectations(t)
 }
@@ -0,0 +1,66 @@
+package controller
+
+import "fmt"
+
+// hostOwners tracks the namespace which owns each host. A host is claimed by the namespace of its oldest ingress,
+// and stays with that namespace for as long as it has an ingress for the host, so other namespaces can't take it
+// over.
+type hostOwners map[string]string
+
+// hostRejection is an entry which wasn't used, because its host is owned by another namespace.
+type hostRejection struct {
+	owner, rejected IngressEntry
+}
+
+func (r hostRejection) String() string {
+	return fmt.Sprintf("%s %s is owned by namespace %s", r.rejected.NamespaceName(), r.rejected.Host,
+		r.owner.Namespace)
+}
+
+// claim updates the owners from the entries, returning the entries for hosts their namespace owns, in their original
+// order, and those which were rejected.
+func (o hostOwners) claim(entries []IngressEntry) ([]IngressEntry, []hostRejection) {
+	// the oldest entry of each namespace with the host, to choose owners and explain rejections
+	claims := make(map[string]map[string]IngressEntry)
+	for _, e := range entries {
+		namespaces, ok := claims[e.Host]
+		if !ok {
+			namespaces = make(map[string]IngressEntry)
+			claims[e.Host] = namespaces
+		}
+		if existing, ok := namespaces[e.Namespace]; !ok || ConflictOldest.prefer(e, existing, nil) {
+			namespaces[e.Namespace] = e
+		}
+	}
+
+	for host := range o {
+		if _, ok := claims[host][o[host]]; !ok {
+			delete(o, host)
+		}
+	}
+	for host, namespaces := range claims {
+		if _, ok := o[host]; ok {
+			continue
+		}
+		var oldest *IngressEntry
+		for _, e := range namespaces {
+			e := e
+			if oldest == nil || ConflictOldest.prefer(e, *oldest, nil) {
+				oldest = &e
+			}
+		}
+		o[host] = oldest.Namespace
+	}
+
+	var allowed []IngressEntry
+	var rejections []hostRejection
+	for _, e := range entries {
+		owner := o[e.Host]
+		if e.Namespace == owner {
+			allowed = append(allowed, e)
+		} else {
+			rejections = append(rejections, hostRejection{owner: claims[e.Host][owner], rejected: e})
+		}
+	}
+	return allowed, rejections
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hostEntry(namespace, name, host string, age time.Duration) IngressEntry {
+	return IngressEntry{
+		Namespace:         namespace,
+		Name:              name,
+		Host:              host,
+		Path:              "/",
+		CreationTimestamp: time.Unix(1500000000, 0).Add(-age),
+	}
+}
+
+func TestHostsAreOwnedByTheNamespaceOfTheirOldestIngress(t *testing.T) {
+	asserter := assert.New(t)
+	owner := hostEntry("team-a", "app", "foo.sky.com", time.Hour)
+	ownerPath := hostEntry("team-a", "other-app", "foo.sky.com", 0)
+	hijacker := hostEntry("team-b", "hijack", "foo.sky.com", time.Minute)
+	unrelated := hostEntry("team-b", "app", "bar.sky.com", 0)
+	owners := make(hostOwners)
+
+	allowed, rejections := owners.claim([]IngressEntry{hijacker, ownerPath, owner, unrelated})
+
+	asserter.Equal([]IngressEntry{ownerPath, owner, unrelated}, allowed)
+	asserter.Equal([]hostRejection{{owner: owner, rejected: hijacker}}, rejections)
+	asserter.Equal(hostOwners{"foo.sky.com": "team-a", "bar.sky.com": "team-b"}, owners)
+}
+
+func TestHostsStayWithTheirOwnerWhileItHasIngresses(t *testing.T) {
+	asserter := assert.New(t)
+	owner := hostEntry("team-a", "app", "foo.sky.com", 0)
+	owners := hostOwners{"foo.sky.com": "team-a"}
+	older := hostEntry("team-b", "older", "foo.sky.com", time.Hour)
+
+	allowed, rejections := owners.claim([]IngressEntry{owner, older})
+
+	asserter.Equal([]IngressEntry{owner}, allowed, "ownership shouldn't change once claimed")
+	asserter.Equal([]hostRejection{{owner: owner, rejected: older}}, rejections)
+}
+
+func TestHostsAreReleasedWhenTheOwnerHasNoIngresses(t *testing.T) {
+	asserter := assert.New(t)
+	owners := hostOwners{"foo.sky.com": "team-a"}
+	claimant := hostEntry("team-b", "app", "foo.sky.com", 0)
+
+	allowed, rejections := owners.claim([]IngressEntry{claimant})
+
+	asserter.Equal([]IngressEntry{claimant}, allowed)
+	asserter.Empty(rejections)
+	asserter.Equal(hostOwners{"foo.sky.com": "team-b"}, owners)
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// HostTemplate generates the host of ingress rules which don't have one, from the ingress's {name} and {namespace},
+// such as {name}.{namespace}.example.com. Empty leaves those rules without a host, so they're skipped.
+type HostTemplate string
+
+const (
+	hostTemplateName      = "{name}"
+	hostTemplateNamespace = "{namespace}"
+)
+
+// templatedHost matches the hosts generated from valid templates, as names and namespaces are DNS labels.
+var templatedHost = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+
+// Validate returns an error if the template wouldn't generate a distinct, valid host for every ingress.
+func (t HostTemplate) Validate() error {
+	if t == "" {
+		return nil
+	}
+	template := string(t)
+	if !strings.Contains(template, hostTemplateName) || !strings.Contains(template, hostTemplateNamespace) {
+		return fmt.Errorf("host template %q must contain both %s and %s", template, hostTemplateName,
+			hostTemplateNamespace)
+	}
+	example := strings.NewReplacer(hostTemplateName, "name", hostTemplateNamespace, "namespace").Replace(template)
+	if !templatedHost.MatchString(example) {
+		return fmt.Errorf("host template %q generates invalid hosts, such as %s", template, example)
+	}
+	return nil
+}
+
+// host returns the generated host of the ingress, or empty if there's no template.
+func (t HostTemplate) host(ingress *networkingv1.Ingress) string {
+	if t == "" {
+		return ""
+	}
+	return strings.NewReplacer(hostTemplateName, ingress.Name, hostTemplateNamespace, ingress.Namespace).
+		Replace(string(t))
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHostTemplateGeneratesHostFromIngress(t *testing.T) {
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team"}}
+
+	assert.Equal(t, "app.team.sky.com", HostTemplate("{name}.{namespace}.sky.com").host(ingress))
+	assert.Equal(t, "team-app.sky.com", HostTemplate("{namespace}-{name}.sky.com").host(ingress))
+	assert.Equal(t, "", HostTemplate("").host(ingress))
+}
+
+func TestHostTemplateValidation(t *testing.T) {
+	assert.NoError(t, HostTemplate("").Validate())
+	assert.NoError(t, HostTemplate("{name}.{namespace}.sky.com").Validate())
+	assert.EqualError(t, HostTemplate("{name}.sky.com").Validate(),
+		`host template "{name}.sky.com" must contain both {name} and {namespace}`)
+	assert.EqualError(t, HostTemplate("{name}.{namespace}.sky.com/").Validate(),
+		`host template "{name}.{namespace}.sky.com/" generates invalid hosts, such as name.namespace.sky.com/`)
+	assert.Error(t, HostTemplate("{name}.{namespace}.{zone}").Validate())
+}
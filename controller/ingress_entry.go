@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,6 +32,10 @@ type IngressEntry struct {
 	ServiceAddress string
 	// ServicePort is the port to proxy traffic to. Must be non-zero.
 	ServicePort int32
+	// BackupServiceAddress is the address of a service which takes traffic when the backend is unavailable, if any.
+	BackupServiceAddress string
+	// BackupServicePort is the port of the backup service.
+	BackupServicePort int32
 	// Allow are the ips or CIDRs that are allowed to access the service.
 	Allow []string
 	// LbScheme internet-facing or internal will dictate which kind of load balancer to attach to.
@@ -38,12 +44,25 @@ type IngressEntry struct {
 	StripPaths bool
 	// ExactPath indicates that the Path should be treated as an exact match rather than a prefix
 	ExactPath bool
+	// PrefixPath matches the Path element-wise, as for a Prefix pathType, so it's also matched without its trailing
+	// slash rather than redirected.
+	PrefixPath bool
+	// PathRegex treats the Path as a regular expression, matched after the exact and prefix paths.
+	PathRegex bool
 	// BackendTimeoutSeconds backend timeout
 	BackendTimeoutSeconds int
 	// BackendMaxConnections maximum backend connections
 	BackendMaxConnections int
+	// BackendMaxFails is the number of failed requests within BackendFailTimeout after which the backend is ejected
+	// for BackendFailTimeout, or 0 for nginx's default.
+	BackendMaxFails int
+	// BackendFailTimeout is how long failures are counted for, and how long the backend is ejected, or 0 for nginx's default.
+	BackendFailTimeout time.Duration
 	// BackendKeepaliveTimeout timeout for idle connections to upstream
 	BackendKeepaliveTimeout time.Duration
+	// BackendKeepaliveCount is the number of idle keepalive connections to the upstream kept by each nginx worker,
+	// or 0 for the global count.
+	BackendKeepaliveCount int
 	// BackendMaxRequestsPerConnection max requests per connection to upstream, after which it will be closed
 	BackendMaxRequestsPerConnection uint64
 	// Ingress creation time
@@ -54,6 +73,132 @@ type IngressEntry struct {
 	ProxyBufferSize int
 	// Number of buffers used for reading a response from the proxied server, for a single connection.
 	ProxyBufferBlocks int
+	// SSLPassthrough routes TLS connections for the host directly to the backend, which terminates them itself.
+	SSLPassthrough bool
+	// ACME requests a certificate for the host from an ACME server, if feed-ingress has one configured.
+	ACME bool
+	// BackendSPIFFE proxies to the backend over TLS, presenting feed-ingress's SPIFFE identity as a client certificate.
+	BackendSPIFFE bool
+	// BackendSPIFFEName is the DNS name the backend's SVID must have, if BackendSPIFFE is set.
+	BackendSPIFFEName string
+	// AllowCountries are the ISO 3166 country codes of clients allowed to access the service, or empty to allow all.
+	AllowCountries []string
+	// DenyCountries are the ISO 3166 country codes of clients denied access to the service.
+	DenyCountries []string
+	// DisableTracing excludes requests to the service from OpenTracing.
+	DisableTracing bool
+	// TracingSampleRate is the proportion of requests to trace, between 0 and 1, or 0 to use the tracer's sampling.
+	TracingSampleRate float64
+	// BackendProtocol is how requests are proxied to the backend, one of the BackendProtocol constants, or empty
+	// for http.
+	BackendProtocol string
+	// InterceptErrors are the backend response status codes replaced with the controller's own error pages.
+	InterceptErrors []int
+	// SecurityHeaders is the profile of security headers added to responses, or empty for the controller's default.
+	SecurityHeaders string
+	// InternalPaths are sub-paths of Path which are only reachable internally, even if the rest of the path is
+	// public.
+	InternalPaths []string
+	// TrailingSlash is how the path is handled when requested without its trailing slash, or empty for the
+	// controller's default.
+	TrailingSlash string
+	// WebSocketUpgrade proxies WebSocket upgrade requests to the backend.
+	WebSocketUpgrade bool
+	// WebSocketTimeoutSeconds replaces BackendTimeoutSeconds for reading and sending on upgraded connections, if
+	// it's set.
+	WebSocketTimeoutSeconds int
+	// NJSContent is the njs function, as module.function, which handles requests instead of the backend.
+	NJSContent string
+	// NJSHeaderFilter is the njs function, as module.function, which changes the response headers.
+	NJSHeaderFilter string
+	// APIKeyHeader is the request header with the API key, if APIKeys or APIKeyRateLimit are set.
+	APIKeyHeader string
+	// APIKeys are the only API keys allowed, to the names of their clients, if not nil. Empty denies every request.
+	APIKeys map[string]string
+	// APIKeyRateLimit is the requests per second allowed for each API key, or 0 for no limit.
+	APIKeyRateLimit int
+	// StatsName replaces the path in the vhost stats and metrics of the entry, if set.
+	StatsName string
+	// HtpasswdSecret is the Vault secret, under the ingress's namespace, with the htpasswd file required for HTTP
+	// basic auth, if set.
+	HtpasswdSecret string
+	// RateLimit is the requests per second allowed from each client address, or 0 for no limit.
+	RateLimit int
+	// RateLimitBurst is the number of requests allowed above RateLimit before they're rejected.
+	RateLimitBurst int
+	// RequestHeaders are set on requests to the backend. An empty value removes the header.
+	RequestHeaders map[string]string
+	// ResponseHeaders are set on responses, replacing any from the backend. An empty value removes the header.
+	ResponseHeaders map[string]string
+	// Endpoints are the ready pods of the service port, which are proxied to instead of ServiceAddress in
+	// endpoints mode. Empty uses ServiceAddress.
+	Endpoints []Endpoint
+	// Drain turns new requests away with a 503 while the entry stays configured, so its backend can be drained.
+	Drain bool
+	// Headless is set when the service has no cluster IP, so it's only proxied to through its Endpoints, in
+	// endpoints mode. ServiceAddress is then the service's DNS name.
+	Headless bool
+}
+
+// Endpoint is a ready pod address of an entry's service port.
+type Endpoint struct {
+	// Address is the pod's IP.
+	Address string `json:"address"`
+	// Port is the pod's target port for the service port.
+	Port int32 `json:"port"`
+	// Backup is set for pods outside the preferred zone, which are only proxied to when those in it are unavailable.
+	Backup bool `json:"backup,omitempty"`
+	// Weight is the pod's share of requests relative to the other pods, or 0 for the default of 1.
+	Weight int32 `json:"weight,omitempty"`
+}
+
+// Protocols for proxying to backends, set with the sky.uk/backend-protocol annotation.
+const (
+	// BackendProtocolHTTP proxies over HTTP/1.1, which is the default.
+	BackendProtocolHTTP = "http"
+	// BackendProtocolH2C proxies over cleartext HTTP/2, for backends such as gRPC servers without TLS.
+	BackendProtocolH2C = "h2c"
+	// BackendProtocolFastCGI proxies over FastCGI, for application servers such as PHP-FPM.
+	BackendProtocolFastCGI = "fastcgi"
+	// BackendProtocolUWSGI proxies over uwsgi, for Python application servers such as uWSGI.
+	BackendProtocolUWSGI = "uwsgi"
+)
+
+// validBackendProtocol returns true if the protocol can be used to proxy to backends.
+func validBackendProtocol(protocol string) bool {
+	switch protocol {
+	case BackendProtocolHTTP, BackendProtocolH2C, BackendProtocolFastCGI, BackendProtocolUWSGI:
+		return true
+	}
+	return false
+}
+
+// statsName can be used in a vhost stats filter key, which is split on ::.
+var statsName = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+func validStatsName(name string) bool {
+	return statsName.MatchString(name)
+}
+
+// dnsName is a host name, which can be used in the nginx config.
+var dnsName = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+func validDNSName(name string) bool {
+	return dnsName.MatchString(name)
+}
+
+// secretName is the name of a secret under a namespace, which can also be used as a file name.
+var secretName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func validSecretName(name string) bool {
+	return secretName.MatchString(name)
+}
+
+// njsHandler is a function exported by an njs module, such as module.function or module.object.function.
+var njsHandler = regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)+$`)
+
+func validNJSHandler(handler string) bool {
+	return njsHandler.MatchString(handler)
 }
 
 // Borrowed from the go stdlib, net/url:shouldEscape()
@@ -88,6 +233,19 @@ func isPathValid(path string) bool {
 	return true
 }
 
+// validatePathRegex checks a path regex compiles, and can be used in the nginx config. Regexes are compiled by nginx
+// with PCRE, so only the syntax in common with Go's regexp can be checked.
+func validatePathRegex(path string) error {
+	if path == "" {
+		return errors.New("empty regex")
+	}
+	if strings.ContainsAny(path, "\"; \t\r\n") {
+		return errors.New("contains whitespace, quotes or semicolons")
+	}
+	_, err := regexp.Compile(path)
+	return err
+}
+
 // validate returns error if entry has invalid fields.
 func (e IngressEntry) validate() error {
 	if e.Host == "" {
@@ -102,7 +260,11 @@ func (e IngressEntry) validate() error {
 	if e.ServicePort == 0 {
 		return errors.New("missing service port")
 	}
-	if !isPathValid(e.Path) {
+	if e.PathRegex {
+		if err := validatePathRegex(e.Path); err != nil {
+			return fmt.Errorf("path regex '%s' is invalid: %v", e.Path, err)
+		}
+	} else if !isPathValid(e.Path) {
 		return fmt.Errorf("path '%s' contains illegal characters", e.Path)
 	}
 
@@ -123,14 +285,99 @@ func (e IngressEntry) validate() error {
 		return fmt.Errorf("host %s: invalid entries in sky.uk/allow: %s", e.Host, strings.Join(invalidAllowEntries, ","))
 	}
 
+	if invalid := invalidCountries(e.AllowCountries); len(invalid) > 0 {
+		return fmt.Errorf("host %s: invalid country codes in sky.uk/allow-countries: %s", e.Host, strings.Join(invalid, ","))
+	}
+	if invalid := invalidCountries(e.DenyCountries); len(invalid) > 0 {
+		return fmt.Errorf("host %s: invalid country codes in sky.uk/deny-countries: %s", e.Host, strings.Join(invalid, ","))
+	}
+
 	return nil
 }
 
+// parseCountries splits a comma separated list of country codes, ignoring case and whitespace.
+func parseCountries(countries string) []string {
+	parsed := []string{}
+	for _, country := range strings.Split(countries, ",") {
+		if country = strings.ToUpper(strings.TrimSpace(country)); country != "" {
+			parsed = append(parsed, country)
+		}
+	}
+	return parsed
+}
+
+// parseInternalPaths splits a comma separated list of sub-paths, which must each start with a /.
+func parseInternalPaths(paths string) ([]string, error) {
+	parsed := []string{}
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		if !strings.HasPrefix(path, "/") || !isPathValid(path) {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		parsed = append(parsed, path)
+	}
+	return parsed, nil
+}
+
+// ParseInterceptErrors splits a comma separated list of status codes to intercept, which nginx only allows between
+// 300 and 599. An empty list intercepts nothing.
+func ParseInterceptErrors(codes string) ([]int, error) {
+	parsed := []int{}
+	for _, code := range strings.Split(codes, ",") {
+		if code = strings.TrimSpace(code); code == "" {
+			continue
+		}
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 300 || status > 599 {
+			return nil, fmt.Errorf("invalid status code %q, must be between 300 and 599", code)
+		}
+		parsed = append(parsed, status)
+	}
+	return parsed, nil
+}
+
+// parseBackupService splits a backup service into its name and port, which defaults to the ingress backend's port.
+func parseBackupService(backup string, defaultPort int32) (string, int32, error) {
+	name, port := strings.TrimSpace(backup), defaultPort
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		parsed, err := strconv.ParseUint(name[i+1:], 10, 16)
+		if err != nil || parsed == 0 {
+			return "", 0, fmt.Errorf("invalid port %q", name[i+1:])
+		}
+		name, port = name[:i], int32(parsed)
+	}
+	if name == "" {
+		return "", 0, errors.New("missing service name")
+	}
+	return name, port, nil
+}
+
+// invalidCountries returns the entries which aren't two letter, upper case, ISO 3166 country codes.
+func invalidCountries(countries []string) []string {
+	var invalid []string
+	for _, country := range countries {
+		if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+			invalid = append(invalid, country)
+		}
+	}
+	return invalid
+}
+
 // NamespaceName returns the string "Namespace/Name".
 func (e IngressEntry) NamespaceName() string {
 	return fmt.Sprintf("%s/%s", e.Namespace, e.Name)
 }
 
+// HtpasswdFile returns the name of the file the entry's htpasswd secret is written to, unique to its namespace.
+func (e IngressEntry) HtpasswdFile() string {
+	if e.HtpasswdSecret == "" {
+		return ""
+	}
+	return e.Namespace + "_" + e.HtpasswdSecret
+}
+
 func (e IngressEntry) String() string {
 	return fmt.Sprintf("IngressEntry[Namespace=%s,Name=%s,Host=%s,Path=%s,ServiceAddress=%s,ServicePort=%d]",
 		e.Namespace, e.Name, e.Host, e.Path, e.ServiceAddress, e.ServicePort)
@@ -182,3 +182,141 @@ func TestIngressDisallowsPathWithSpace(t *testing.T) {
 	err := e.validate()
 	asserter.Error(err)
 }
+
+func TestIngressAllowsPathRegex(t *testing.T) {
+	asserter := assert.New(t)
+	e := IngressEntry{
+		Host:           "x",
+		Path:           "^/api/v[0-9]{1,2}/(users|groups)$",
+		PathRegex:      true,
+		ServiceAddress: "x",
+		ServicePort:    1,
+	}
+	asserter.NoError(e.validate())
+}
+
+func TestIngressDisallowsInvalidPathRegex(t *testing.T) {
+	asserter := assert.New(t)
+	for _, path := range []string{"", "/api/(v1", "/api/v1 /", `/api";`} {
+		e := IngressEntry{
+			Host:           "x",
+			Path:           path,
+			PathRegex:      true,
+			ServiceAddress: "x",
+			ServicePort:    1,
+		}
+		asserter.Error(e.validate(), path)
+	}
+}
+
+func TestCountriesAreParsed(t *testing.T) {
+	asserter := assert.New(t)
+	asserter.Equal([]string{"GB", "IE"}, parseCountries(" gb, IE ,"))
+	asserter.Equal([]string{}, parseCountries(""))
+}
+
+func TestInvalidCountriesResultInError(t *testing.T) {
+	asserter := assert.New(t)
+	e := IngressEntry{
+		Host:           "x",
+		ServiceAddress: "x",
+		ServicePort:    1,
+		AllowCountries: []string{"GB"},
+		DenyCountries:  []string{"GBR", "1E"},
+	}
+	err := e.validate()
+	asserter.EqualError(err, "host x: invalid country codes in sky.uk/deny-countries: GBR,1E")
+}
+
+func TestBackupServiceIsParsed(t *testing.T) {
+	var tests = []struct {
+		backup string
+		name   string
+		port   int32
+		err    string
+	}{
+		{"fallback", "fallback", 8080, ""},
+		{"fallback:9090", "fallback", 9090, ""},
+		{" fallback:9090 ", "fallback", 9090, ""},
+		{"fallback:http", "", 0, `invalid port "http"`},
+		{"fallback:0", "", 0, `invalid port "0"`},
+		{":9090", "", 0, "missing service name"},
+	}
+
+	for _, test := range tests {
+		name, port, err := parseBackupService(test.backup, 8080)
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.backup)
+			continue
+		}
+		assert.NoError(t, err, test.backup)
+		assert.Equal(t, test.name, name, test.backup)
+		assert.Equal(t, test.port, port, test.backup)
+	}
+}
+
+func TestValidBackendProtocols(t *testing.T) {
+	asserter := assert.New(t)
+
+	asserter.True(validBackendProtocol("http"))
+	asserter.True(validBackendProtocol("h2c"))
+	asserter.True(validBackendProtocol("fastcgi"))
+	asserter.True(validBackendProtocol("uwsgi"))
+	asserter.False(validBackendProtocol("H2C"))
+	asserter.False(validBackendProtocol("grpc"))
+	asserter.False(validBackendProtocol(""))
+}
+
+func TestValidStatsNames(t *testing.T) {
+	asserter := assert.New(t)
+
+	asserter.True(validStatsName("checkout-api"))
+	asserter.True(validStatsName("/checkout/v1.2_api"))
+	asserter.False(validStatsName("checkout::api"))
+	asserter.False(validStatsName("checkout api"))
+	asserter.False(validStatsName(""))
+}
+
+func TestValidNJSHandlers(t *testing.T) {
+	asserter := assert.New(t)
+
+	asserter.True(validNJSHandler("main.hello"))
+	asserter.True(validNJSHandler("headers.filter.add_$"))
+	asserter.False(validNJSHandler("hello"))
+	asserter.False(validNJSHandler("main.hello()"))
+	asserter.False(validNJSHandler("main.hello; return 200"))
+	asserter.False(validNJSHandler("1main.hello"))
+	asserter.False(validNJSHandler(""))
+}
+
+func TestParseInterceptErrors(t *testing.T) {
+	asserter := assert.New(t)
+
+	codes, err := ParseInterceptErrors(" 500,502 ,,503")
+	asserter.NoError(err)
+	asserter.Equal([]int{500, 502, 503}, codes)
+
+	codes, err = ParseInterceptErrors("")
+	asserter.NoError(err)
+	asserter.Equal([]int{}, codes)
+
+	_, err = ParseInterceptErrors("299")
+	asserter.Error(err)
+	_, err = ParseInterceptErrors("600")
+	asserter.Error(err)
+	_, err = ParseInterceptErrors("5xx")
+	asserter.Error(err)
+}
+
+func TestParseInternalPaths(t *testing.T) {
+	asserter := assert.New(t)
+
+	paths, err := parseInternalPaths("/admin, /metrics/,")
+	asserter.NoError(err)
+	asserter.Equal([]string{"/admin", "/metrics/"}, paths)
+
+	_, err = parseInternalPaths("admin")
+	asserter.Error(err)
+	_, err = parseInternalPaths("/admin{}")
+	asserter.Error(err)
+}
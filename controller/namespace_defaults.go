@@ -0,0 +1,71 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// namespaceDefaultAnnotations are the ingress annotations which can be set on a namespace, as defaults for its
+// ingresses.
+var namespaceDefaultAnnotations = []string{
+	ingressAllowAnnotation,
+	frontendSchemeAnnotation,
+	stripPathAnnotation,
+	exactPathAnnotation,
+	backendSPIFFEAnnotation,
+	backendTimeoutSeconds,
+	backendConnectionKeepalive,
+	backendKeepaliveCount,
+	backendMaxRequestsPerConnection,
+	backendMaxConnections,
+	backendMaxFails,
+	backendFailTimeout,
+	proxyBufferSizeAnnotation,
+	proxyBufferBlocksAnnotation,
+}
+
+// legacyAnnotations are older names for annotations. An ingress with the legacy name doesn't get the namespace default.
+var legacyAnnotations = map[string]string{
+	frontendSchemeAnnotation: legacyFrontendElbSchemeAnnotation,
+	backendTimeoutSeconds:    legacyBackendKeepaliveSeconds,
+}
+
+// namespaceDefaults are the default annotations set on each namespace.
+type namespaceDefaults map[string]map[string]string
+
+func newNamespaceDefaults(namespaces []*corev1.Namespace) namespaceDefaults {
+	defaults := make(namespaceDefaults)
+	for _, namespace := range namespaces {
+		for _, annotation := range namespaceDefaultAnnotations {
+			if value, ok := namespace.Annotations[annotation]; ok {
+				if defaults[namespace.Name] == nil {
+					defaults[namespace.Name] = make(map[string]string)
+				}
+				defaults[namespace.Name][annotation] = value
+			}
+		}
+	}
+	return defaults
+}
+
+// annotations returns the ingress's annotations, merged over the defaults of its namespace.
+func (d namespaceDefaults) annotations(ingress *networkingv1.Ingress) map[string]string {
+	defaults := d[ingress.Namespace]
+	if len(defaults) == 0 {
+		return ingress.Annotations
+	}
+
+	annotations := make(map[string]string, len(ingress.Annotations)+len(defaults))
+	for annotation, value := range defaults {
+		if legacy, ok := legacyAnnotations[annotation]; ok {
+			if _, overridden := ingress.Annotations[legacy]; overridden {
+				continue
+			}
+		}
+		annotations[annotation] = value
+	}
+	for annotation, value := range ingress.Annotations {
+		annotations[annotation] = value
+	}
+	return annotations
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIngressAnnotationsOverrideNamespaceDefaults(t *testing.T) {
+	defaults := newNamespaceDefaults([]*corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "team", Annotations: map[string]string{
+			ingressAllowAnnotation:   "10.0.0.0/8",
+			backendTimeoutSeconds:    "30",
+			frontendSchemeAnnotation: "internal",
+			"unrelated":              "ignored",
+		}}},
+	})
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Annotations: map[string]string{
+		ingressAllowAnnotation:            "",
+		legacyFrontendElbSchemeAnnotation: "internet-facing",
+	}}}
+
+	assert.Equal(t, map[string]string{
+		ingressAllowAnnotation:            "",
+		backendTimeoutSeconds:             "30",
+		legacyFrontendElbSchemeAnnotation: "internet-facing",
+	}, defaults.annotations(ingress))
+}
+
+func TestIngressesWithoutNamespaceDefaultsAreUnchanged(t *testing.T) {
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Annotations: map[string]string{
+		stripPathAnnotation: "true",
+	}}}
+	var disabled namespaceDefaults
+
+	assert.Equal(t, ingress.Annotations, newNamespaceDefaults(nil).annotations(ingress))
+	assert.Equal(t, ingress.Annotations, disabled.annotations(ingress))
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+)
+
+// NamespaceQuota limits the edge configuration each namespace can use, so one team can't use it all up in a
+// multi-tenant cluster. Zero is no limit.
+type NamespaceQuota struct {
+	// MaxHosts is the number of hosts each namespace's ingresses can use.
+	MaxHosts int
+	// MaxPaths is the number of host/path entries each namespace's ingresses can have.
+	MaxPaths int
+	// MaxRateLimitZones is the number of rate limits, per client or per API key, each namespace's entries can have,
+	// as each needs its own shared memory zone.
+	MaxRateLimitZones int
+}
+
+func (q NamespaceQuota) enabled() bool {
+	return q.MaxHosts > 0 || q.MaxPaths > 0 || q.MaxRateLimitZones > 0
+}
+
+// quotaRejection is an entry which wasn't used, because its namespace has used up its quota of a resource.
+type quotaRejection struct {
+	entry    IngressEntry
+	resource string
+	limit    int
+}
+
+func (r quotaRejection) String() string {
+	return fmt.Sprintf("%s %s%s exceeds the namespace quota of %d %s", r.entry.NamespaceName(), r.entry.Host,
+		r.entry.Path, r.limit, r.resource)
+}
+
+// namespaceUsage is what a namespace's entries have used of its quota so far.
+type namespaceUsage struct {
+	hosts          map[string]bool
+	paths          int
+	rateLimitZones int
+}
+
+// enforce returns the entries within their namespace's quota, in their original order, and those which were
+// rejected. Older entries use the quota first, so new ingresses can't take it from those already being served.
+func (q NamespaceQuota) enforce(entries []IngressEntry) ([]IngressEntry, []quotaRejection) {
+	if !q.enabled() {
+		return entries, nil
+	}
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return ConflictOldest.prefer(entries[order[i]], entries[order[j]], nil)
+	})
+
+	usage := make(map[string]*namespaceUsage)
+	rejected := make(map[int]quotaRejection)
+	for _, i := range order {
+		e := entries[i]
+		u, ok := usage[e.Namespace]
+		if !ok {
+			u = &namespaceUsage{hosts: make(map[string]bool)}
+			usage[e.Namespace] = u
+		}
+		zones := rateLimitZones(e)
+
+		switch {
+		case q.MaxHosts > 0 && !u.hosts[e.Host] && len(u.hosts) >= q.MaxHosts:
+			rejected[i] = quotaRejection{entry: e, resource: "hosts", limit: q.MaxHosts}
+		case q.MaxPaths > 0 && u.paths >= q.MaxPaths:
+			rejected[i] = quotaRejection{entry: e, resource: "paths", limit: q.MaxPaths}
+		case q.MaxRateLimitZones > 0 && zones > 0 && u.rateLimitZones+zones > q.MaxRateLimitZones:
+			rejected[i] = quotaRejection{entry: e, resource: "rate limit zones", limit: q.MaxRateLimitZones}
+		default:
+			u.hosts[e.Host] = true
+			u.paths++
+			u.rateLimitZones += zones
+		}
+	}
+
+	var allowed []IngressEntry
+	var rejections []quotaRejection
+	for i, e := range entries {
+		if rejection, ok := rejected[i]; ok {
+			rejections = append(rejections, rejection)
+		} else {
+			allowed = append(allowed, e)
+		}
+	}
+	return allowed, rejections
+}
+
+// rateLimitZones is the number of rate limits of the entry, each of which needs its own zone.
+func rateLimitZones(e IngressEntry) int {
+	zones := 0
+	if e.RateLimit > 0 {
+		zones++
+	}
+	if e.APIKeyRateLimit > 0 {
+		zones++
+	}
+	return zones
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOldestEntriesUseTheNamespaceQuotaFirst(t *testing.T) {
+	asserter := assert.New(t)
+	oldest := hostEntry("team-a", "app", "foo.sky.com", time.Hour)
+	samePath := hostEntry("team-a", "api", "foo.sky.com", time.Minute)
+	samePath.Path = "/api"
+	newest := hostEntry("team-a", "new", "bar.sky.com", 0)
+	otherTeam := hostEntry("team-b", "app", "baz.sky.com", 0)
+	quota := NamespaceQuota{MaxHosts: 1}
+
+	allowed, rejections := quota.enforce([]IngressEntry{newest, samePath, otherTeam, oldest})
+
+	asserter.Equal([]IngressEntry{samePath, otherTeam, oldest}, allowed)
+	asserter.Equal([]quotaRejection{{entry: newest, resource: "hosts", limit: 1}}, rejections)
+}
+
+func TestNamespaceQuotaLimitsPathsAndRateLimitZones(t *testing.T) {
+	asserter := assert.New(t)
+	app := hostEntry("team-a", "app", "foo.sky.com", time.Hour)
+	app.RateLimit = 10
+	app.APIKeyRateLimit = 5
+	limited := hostEntry("team-a", "limited", "bar.sky.com", time.Minute)
+	limited.RateLimit = 10
+	unlimited := hostEntry("team-a", "unlimited", "baz.sky.com", time.Second)
+	extra := hostEntry("team-a", "extra", "qux.sky.com", 0)
+	quota := NamespaceQuota{MaxPaths: 2, MaxRateLimitZones: 2}
+
+	allowed, rejections := quota.enforce([]IngressEntry{app, limited, unlimited, extra})
+
+	asserter.Equal([]IngressEntry{app, unlimited}, allowed)
+	asserter.Equal([]quotaRejection{
+		{entry: limited, resource: "rate limit zones", limit: 2},
+		{entry: extra, resource: "paths", limit: 2},
+	}, rejections)
+}
+
+func TestNoNamespaceQuotaAllowsEveryEntry(t *testing.T) {
+	entries := []IngressEntry{hostEntry("team-a", "app", "foo.sky.com", 0), hostEntry("team-a", "app", "bar.sky.com", 0)}
+
+	allowed, rejections := NamespaceQuota{}.enforce(entries)
+
+	assert.Equal(t, entries, allowed)
+	assert.Empty(t, rejections)
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/k8s"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// upstreamWeightAnnotation sets a pod's share of the requests to its service in endpoints mode, relative to the other
+// pods of the service, which have a weight of 1 unless they set one too.
+const upstreamWeightAnnotation = "sky.uk/upstream-weight"
+
+// maxUpstreamWeight keeps weights small enough for nginx once they're multiplied while slow starting.
+const maxUpstreamWeight = 100
+
+// podWeights are the upstream weights set by pods, by namespace/name.
+type podWeights map[string]int32
+
+// newPodWeights reads the weight of each pod labelled as weighted. Invalid weights are logged and ignored, so the pod
+// gets the default weight.
+func newPodWeights(pods []*corev1.Pod) podWeights {
+	weights := make(podWeights)
+	for _, pod := range pods {
+		if pod.Labels[k8s.WeightedPodsLabel] != "true" {
+			continue
+		}
+		value, ok := pod.Annotations[upstreamWeightAnnotation]
+		if !ok {
+			continue
+		}
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 1 || weight > maxUpstreamWeight {
+			log.Warnf("Ignoring %s=%q on pod %s/%s, as it isn't a number from 1 to %d", upstreamWeightAnnotation,
+				value, pod.Namespace, pod.Name, maxUpstreamWeight)
+			continue
+		}
+		weights[pod.Namespace+"/"+pod.Name] = int32(weight)
+	}
+	return weights
+}
+
+// forEndpoint returns the weight of the endpoint's pod, or 0 if it doesn't set one.
+func (w podWeights) forEndpoint(endpoint discoveryv1.Endpoint) int32 {
+	if endpoint.TargetRef == nil || endpoint.TargetRef.Kind != "Pod" {
+		return 0
+	}
+	return w[endpoint.TargetRef.Namespace+"/"+endpoint.TargetRef.Name]
+}
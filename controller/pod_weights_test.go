@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/sky-uk/feed/k8s"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodWeightsAreReadFromWeightedPods(t *testing.T) {
+	asserter := assert.New(t)
+	pod := func(name, weight string, labelled bool) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: name,
+			Annotations: map[string]string{upstreamWeightAnnotation: weight}}}
+		if labelled {
+			pod.Labels = map[string]string{k8s.WeightedPodsLabel: "true"}
+		}
+		return pod
+	}
+
+	weights := newPodWeights([]*corev1.Pod{
+		pod("large", "4", true),
+		pod("unlabelled", "4", false),
+		pod("zero", "0", true),
+		pod("too-large", "101", true),
+		pod("not-a-number", "lots", true),
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "unset",
+			Labels: map[string]string{k8s.WeightedPodsLabel: "true"}}},
+	})
+
+	asserter.Equal(podWeights{"team/large": 4}, weights)
+	asserter.Equal(int32(4), weights.forEndpoint(discoveryv1.Endpoint{
+		TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: "team", Name: "large"}}))
+	asserter.Zero(weights.forEndpoint(discoveryv1.Endpoint{
+		TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: "team", Name: "unset"}}))
+	asserter.Zero(weights.forEndpoint(discoveryv1.Endpoint{}), "no pod")
+}
+
+func TestReadyEndpointsHaveTheWeightsOfTheirPods(t *testing.T) {
+	services := []*corev1.Service{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "app"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}}
+	slices := []*discoveryv1.EndpointSlice{newEndpointSlice("team", "app", "http", 8080,
+		discoveryv1.Endpoint{Addresses: []string{"10.0.0.1"},
+			TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: "team", Name: "app-large"}},
+		discoveryv1.Endpoint{Addresses: []string{"10.0.0.2"},
+			TargetRef: &corev1.ObjectReference{Kind: "Pod", Namespace: "team", Name: "app-small"}})}
+
+	assert.Equal(t, []Endpoint{{Address: "10.0.0.1", Port: 8080, Weight: 4}, {Address: "10.0.0.2", Port: 8080}},
+		newReadyEndpoints(services, slices, "", podWeights{"team/app-large": 4}).forPort("team", "app", 80))
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// readyEndpoints are the ready endpoints of each service port, by service namespace/name. Entries for ports without
+// any can only get 502s.
+type readyEndpoints map[string]map[int32][]Endpoint
+
+// newReadyEndpoints matches each service port to the endpoint slice ports of the same name, which is how kubernetes
+// maps a service port to its pods' target port. If zone is set, endpoints in other zones are backups while the port
+// has endpoints in the zone. Endpoints have the weights of their pods.
+func newReadyEndpoints(services []*corev1.Service, slices []*discoveryv1.EndpointSlice, zone string,
+	weights podWeights) readyEndpoints {
+	readyByPortName := make(map[string]map[string][]Endpoint)
+	for _, slice := range slices {
+		key := slice.Namespace + "/" + slice.Labels[discoveryv1.LabelServiceName]
+		if readyByPortName[key] == nil {
+			readyByPortName[key] = make(map[string][]Endpoint)
+		}
+		for _, port := range slice.Ports {
+			if port.Port == nil {
+				continue
+			}
+			name := ""
+			if port.Name != nil {
+				name = *port.Name
+			}
+			for _, endpoint := range slice.Endpoints {
+				if !isReady(endpoint) {
+					continue
+				}
+				otherZone := zone != "" && (endpoint.Zone == nil || *endpoint.Zone != zone)
+				weight := weights.forEndpoint(endpoint)
+				for _, address := range endpoint.Addresses {
+					readyByPortName[key][name] = append(readyByPortName[key][name],
+						Endpoint{Address: address, Port: *port.Port, Backup: otherZone, Weight: weight})
+				}
+			}
+		}
+	}
+
+	ready := make(readyEndpoints)
+	for _, svc := range services {
+		key := svc.Namespace + "/" + svc.Name
+		ports := make(map[int32][]Endpoint)
+		for _, port := range svc.Spec.Ports {
+			if endpoints := readyByPortName[key][port.Name]; len(endpoints) > 0 {
+				ports[port.Port] = withoutOnlyBackups(sortedEndpoints(endpoints))
+			}
+		}
+		ready[key] = ports
+	}
+	return ready
+}
+
+// isReady is true if the endpoint is ready. An unknown condition is ready.
+func isReady(endpoint discoveryv1.Endpoint) bool {
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
+
+// sortedEndpoints sorts the endpoints and drops duplicates, which kubernetes can briefly have across slices, so
+// entries only change when their endpoints do.
+func sortedEndpoints(endpoints []Endpoint) []Endpoint {
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Address != endpoints[j].Address {
+			return endpoints[i].Address < endpoints[j].Address
+		}
+		return endpoints[i].Port < endpoints[j].Port
+	})
+	unique := endpoints[:0]
+	for i, endpoint := range endpoints {
+		if i == 0 || endpoint != endpoints[i-1] {
+			unique = append(unique, endpoint)
+		}
+	}
+	return unique
+}
+
+// withoutOnlyBackups makes backups of the endpoints normal endpoints again if they're all backups, as there are no
+// endpoints in the zone to prefer.
+func withoutOnlyBackups(endpoints []Endpoint) []Endpoint {
+	for _, endpoint := range endpoints {
+		if !endpoint.Backup {
+			return endpoints
+		}
+	}
+	for i := range endpoints {
+		endpoints[i].Backup = false
+	}
+	return endpoints
+}
+
+// forPort returns the ready endpoints of the service port.
+func (r readyEndpoints) forPort(namespace, service string, port int32) []Endpoint {
+	return r[namespace+"/"+service][port]
+}
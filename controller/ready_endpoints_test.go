@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReadyEndpointsAreMatchedToServicePortsByName(t *testing.T) {
+	asserter := assert.New(t)
+	services := []*corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "app"},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80},
+				{Name: "admin", Port: 8081},
+				{Name: "metrics", Port: 9090},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "unnamed"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "no-endpoints"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+		},
+	}
+	ready, notReady := true, false
+	slices := []*discoveryv1.EndpointSlice{
+		newEndpointSlice("team", "app", "http", 8080, discoveryv1.Endpoint{Addresses: []string{"10.0.0.1"},
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready}}),
+		newEndpointSlice("team", "app", "admin", 8081, discoveryv1.Endpoint{Addresses: []string{"10.0.0.2"},
+			Conditions: discoveryv1.EndpointConditions{Ready: &notReady}}),
+		newEndpointSlice("team", "unnamed", "", 8080, discoveryv1.Endpoint{Addresses: []string{"10.0.0.3"}}),
+	}
+
+	readyEndpoints := newReadyEndpoints(services, slices, "", nil)
+
+	asserter.Equal([]Endpoint{{Address: "10.0.0.1", Port: 8080}}, readyEndpoints.forPort("team", "app", 80))
+	asserter.Empty(readyEndpoints.forPort("team", "app", 8081), "only not ready endpoints")
+	asserter.Empty(readyEndpoints.forPort("team", "app", 9090), "no endpoints for the port")
+	asserter.Empty(readyEndpoints.forPort("team", "app", 8080), "target port rather than service port")
+	asserter.Equal([]Endpoint{{Address: "10.0.0.3", Port: 8080}}, readyEndpoints.forPort("team", "unnamed", 80),
+		"unknown readiness should be ready")
+	asserter.Empty(readyEndpoints.forPort("team", "no-endpoints", 80))
+	asserter.Empty(readyEndpoints.forPort("other", "app", 80))
+}
+
+func TestReadyEndpointsAreSortedWithoutDuplicates(t *testing.T) {
+	services := []*corev1.Service{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "app"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}}
+	slices := []*discoveryv1.EndpointSlice{
+		newEndpointSlice("team", "app", "http", 8080, discoveryv1.Endpoint{Addresses: []string{"10.0.0.2"}},
+			discoveryv1.Endpoint{Addresses: []string{"10.0.0.1"}}),
+		newEndpointSlice("team", "app", "http", 8080, discoveryv1.Endpoint{Addresses: []string{"10.0.0.1"}}),
+	}
+
+	assert.Equal(t, []Endpoint{{Address: "10.0.0.1", Port: 8080}, {Address: "10.0.0.2", Port: 8080}},
+		newReadyEndpoints(services, slices, "", nil).forPort("team", "app", 80))
+}
+
+func TestReadyEndpointsInOtherZonesAreBackupsWhileThereAreEndpointsInTheZone(t *testing.T) {
+	asserter := assert.New(t)
+	services := []*corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "app"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "elsewhere"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+		},
+	}
+	zoneA, zoneB := "eu-west-1a", "eu-west-1b"
+	slices := []*discoveryv1.EndpointSlice{
+		newEndpointSlice("team", "app", "http", 8080,
+			discoveryv1.Endpoint{Addresses: []string{"10.0.0.1"}, Zone: &zoneA},
+			discoveryv1.Endpoint{Addresses: []string{"10.0.0.2"}, Zone: &zoneB},
+			discoveryv1.Endpoint{Addresses: []string{"10.0.0.3"}}),
+		newEndpointSlice("team", "elsewhere", "http", 8080,
+			discoveryv1.Endpoint{Addresses: []string{"10.0.1.1"}, Zone: &zoneB}),
+	}
+
+	readyEndpoints := newReadyEndpoints(services, slices, zoneA, nil)
+
+	asserter.Equal([]Endpoint{{Address: "10.0.0.1", Port: 8080}, {Address: "10.0.0.2", Port: 8080, Backup: true},
+		{Address: "10.0.0.3", Port: 8080, Backup: true}}, readyEndpoints.forPort("team", "app", 80))
+	asserter.Equal([]Endpoint{{Address: "10.0.1.1", Port: 8080}}, readyEndpoints.forPort("team", "elsewhere", 80),
+		"no endpoints in the zone to prefer")
+	asserter.Equal([]Endpoint{{Address: "10.0.0.1", Port: 8080}, {Address: "10.0.0.2", Port: 8080},
+		{Address: "10.0.0.3", Port: 8080}}, newReadyEndpoints(services, slices, "", nil).forPort("team", "app", 80))
+}
+
+func newEndpointSlice(namespace, service, portName string, port int32, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: service + "-" + portName,
+			Labels: map[string]string{discoveryv1.LabelServiceName: service}},
+		Endpoints: endpoints,
+		Ports:     []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+	}
+}
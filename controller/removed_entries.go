@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// removedKey identifies an ingress's entry for a host and path across updates.
+type removedKey struct {
+	namespace, name string
+	route           routeKey
+}
+
+func newRemovedKey(e IngressEntry) removedKey {
+	return removedKey{e.Namespace, e.Name, newRouteKey(e)}
+}
+
+// drainingEntry is an entry removed from the ingresses, which is kept draining until its window ends.
+type drainingEntry struct {
+	entry IngressEntry
+	until time.Time
+}
+
+// removedEntries keeps the entries removed from the ingresses for a window after they're removed, set to Drain, so
+// new requests are turned away while those in flight finish, rather than the entries disappearing at once. It's only
+// used by the update loop.
+type removedEntries struct {
+	window   time.Duration
+	last     map[removedKey]IngressEntry
+	draining map[removedKey]drainingEntry
+}
+
+// add returns the entries with those removed since the last update which are still draining, in a stable order after
+// the entries. A draining entry is dropped once its window ends, or if its host and path are used by another entry.
+func (r *removedEntries) add(entries []IngressEntry, now time.Time) []IngressEntry {
+	if r.window <= 0 {
+		return entries
+	}
+
+	live := make(map[removedKey]IngressEntry, len(entries))
+	routes := make(map[routeKey]bool, len(entries))
+	for _, e := range entries {
+		live[newRemovedKey(e)] = e
+		routes[newRouteKey(e)] = true
+	}
+
+	if r.draining == nil {
+		r.draining = make(map[removedKey]drainingEntry)
+	}
+	for key, e := range r.last {
+		if _, ok := live[key]; ok {
+			continue
+		}
+		if _, ok := r.draining[key]; !ok {
+			log.Infof("Draining %s for %v, as it was removed", e, r.window)
+			e.Drain = true
+			r.draining[key] = drainingEntry{entry: e, until: now.Add(r.window)}
+		}
+	}
+	r.last = live
+
+	var draining []IngressEntry
+	for key, d := range r.draining {
+		if _, ok := live[key]; ok {
+			delete(r.draining, key)
+			continue
+		}
+		if !now.Before(d.until) {
+			log.Infof("Removing %s, as its drain window has ended", d.entry)
+			delete(r.draining, key)
+			continue
+		}
+		if routes[key.route] {
+			log.Infof("Removing draining %s, as its host and path are used by another ingress", d.entry)
+			delete(r.draining, key)
+			continue
+		}
+		draining = append(draining, d.entry)
+	}
+	sort.Slice(draining, func(i, j int) bool {
+		return lessRemovedKey(newRemovedKey(draining[i]), newRemovedKey(draining[j]))
+	})
+	drainingEntries.Set(float64(len(draining)))
+
+	return append(entries, draining...)
+}
+
+// due returns true if a draining entry's window has ended, so an update is needed to remove it.
+func (r *removedEntries) due(now time.Time) bool {
+	for _, d := range r.draining {
+		if !now.Before(d.until) {
+			return true
+		}
+	}
+	return false
+}
+
+func lessRemovedKey(i, j removedKey) bool {
+	if i.namespace != j.namespace {
+		return i.namespace < j.namespace
+	}
+	if i.name != j.name {
+		return i.name < j.name
+	}
+	if i.route.host != j.route.host {
+		return i.route.host < j.route.host
+	}
+	return i.route.path < j.route.path
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemovedEntriesDrainUntilTheirWindowEnds(t *testing.T) {
+	initMetrics()
+	asserter := assert.New(t)
+	now := time.Now()
+	a := IngressEntry{Namespace: "core", Name: "a", Host: "a.com", Path: "/"}
+	b := IngressEntry{Namespace: "core", Name: "b", Host: "b.com", Path: "/"}
+	removed := removedEntries{window: time.Minute}
+
+	asserter.Equal([]IngressEntry{a, b}, removed.add([]IngressEntry{a, b}, now))
+
+	drainingB := b
+	drainingB.Drain = true
+	asserter.Equal([]IngressEntry{a, drainingB}, removed.add([]IngressEntry{a}, now.Add(time.Second)))
+	asserter.Equal([]IngressEntry{a, drainingB}, removed.add([]IngressEntry{a}, now.Add(30*time.Second)))
+	asserter.False(removed.due(now.Add(30 * time.Second)))
+
+	asserter.True(removed.due(now.Add(61 * time.Second)))
+	asserter.Equal([]IngressEntry{a}, removed.add([]IngressEntry{a}, now.Add(61*time.Second)))
+	asserter.False(removed.due(now.Add(time.Hour)))
+}
+
+func TestRemovedEntriesStopDrainingWhenTheyReturnOrTheirRouteIsTaken(t *testing.T) {
+	initMetrics()
+	asserter := assert.New(t)
+	now := time.Now()
+	a := IngressEntry{Namespace: "core", Name: "a", Host: "a.com", Path: "/"}
+	b := IngressEntry{Namespace: "core", Name: "b", Host: "b.com", Path: "/"}
+	takesB := IngressEntry{Namespace: "other", Name: "b", Host: "b.com", Path: "/"}
+	removed := removedEntries{window: time.Minute}
+
+	removed.add([]IngressEntry{a, b}, now)
+	removed.add(nil, now)
+	asserter.Equal([]IngressEntry{a, takesB}, removed.add([]IngressEntry{a, takesB}, now))
+	asserter.Empty(removed.draining)
+
+	removed.add(nil, now)
+	asserter.Len(removed.draining, 2)
+	asserter.Equal([]IngressEntry{a, b}, removed.add([]IngressEntry{a, b}, now))
+	asserter.Empty(removed.draining)
+}
+
+func TestRemovedEntriesAreDroppedWithoutAWindow(t *testing.T) {
+	a := IngressEntry{Namespace: "core", Name: "a", Host: "a.com", Path: "/"}
+	removed := removedEntries{}
+
+	removed.add([]IngressEntry{a}, time.Now())
+	assert.Empty(t, removed.add(nil, time.Now()))
+}
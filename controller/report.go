@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sky-uk/feed/k8s"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// RoutingReport is the routing table an update gives the updaters, and why entries were left out of it or may fail.
+type RoutingReport struct {
+	Routes   []ReportRoute
+	Problems []ReportProblem
+}
+
+// ReportRoute is a host and path, the service and ingress it's routed to, and its effective timeouts.
+type ReportRoute struct {
+	Host    string
+	Path    string
+	Service string
+	Ingress string
+	// BackendTimeout is how long the backend has to respond, and WebSocketTimeout replaces it on upgraded
+	// connections, or is zero if WebSockets aren't proxied.
+	BackendTimeout   time.Duration
+	WebSocketTimeout time.Duration
+	// BackendFailTimeout is how long a failing backend is ejected for, or zero for nginx's default.
+	BackendFailTimeout time.Duration
+}
+
+// ReportProblem is an event the update would record on an ingress, such as one losing out on a conflict.
+type ReportProblem struct {
+	Ingress string
+	Reason  string
+	Message string
+}
+
+// Report computes the routing table as the controller would, without updating anything or recording events, so
+// app teams can see why an ingress isn't live without the controller's logs. The config's updaters are ignored.
+func Report(conf Config, timeout time.Duration) (RoutingReport, error) {
+	client := &reportClient{Client: conf.KubernetesClient}
+	updater := &reportUpdater{reports: make(chan RoutingReport, 1), client: client}
+	conf.KubernetesClient = client
+	conf.Updaters = []Updater{updater}
+	c := New(conf, make(chan struct{})).(*controller)
+	updater.services = &c.services
+
+	if err := c.Start(); err != nil {
+		return RoutingReport{}, err
+	}
+	defer func() { _ = c.Stop() }()
+
+	select {
+	case report := <-updater.reports:
+		return report, nil
+	case <-time.After(timeout):
+		if err := c.updatesHealth.Get(); err != nil {
+			return RoutingReport{}, fmt.Errorf("no update within %v: %v", timeout, err)
+		}
+		return RoutingReport{}, fmt.Errorf("no update within %v", timeout)
+	}
+}
+
+// reportClient keeps the events the controller records, rather than creating them. Events recorded again by a
+// retried update are only kept once.
+type reportClient struct {
+	k8s.Client
+	lock     sync.Mutex
+	problems []ReportProblem
+	seen     map[ReportProblem]bool
+}
+
+func (c *reportClient) RecordIngressEvent(ingress *networkingv1.Ingress, reason, message string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	problem := ReportProblem{Ingress: ingress.Namespace + "/" + ingress.Name, Reason: reason, Message: message}
+	if c.seen == nil {
+		c.seen = make(map[ReportProblem]bool)
+	}
+	if !c.seen[problem] {
+		c.seen[problem] = true
+		c.problems = append(c.problems, problem)
+	}
+	return nil
+}
+
+func (c *reportClient) UpdateIngressStatus(*networkingv1.Ingress) error {
+	return errors.New("ingress statuses aren't updated by a report")
+}
+
+func (c *reportClient) takeProblems() []ReportProblem {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	problems := c.problems
+	c.problems = nil
+	return problems
+}
+
+// reportUpdater builds a report from the first update's entries. The service cache isn't changed while the update
+// waits for it.
+type reportUpdater struct {
+	reports  chan RoutingReport
+	client   *reportClient
+	services *serviceCache
+}
+
+func (u *reportUpdater) Start() error     { return nil }
+func (u *reportUpdater) Stop() error      { return nil }
+func (u *reportUpdater) Health() error    { return nil }
+func (u *reportUpdater) Readiness() error { return nil }
+func (u *reportUpdater) String() string   { return "report" }
+
+func (u *reportUpdater) Update(entries IngressEntries) error {
+	// services by namespace/address, to name the service of each entry
+	names := make(map[string]string)
+	for name, cached := range u.services.services {
+		names[name.namespace+"/"+cached.address] = name.name
+	}
+
+	report := RoutingReport{Routes: []ReportRoute{}, Problems: u.client.takeProblems()}
+	for _, e := range entries {
+		service := e.ServiceAddress
+		if name, ok := names[e.Namespace+"/"+e.ServiceAddress]; ok {
+			service = name
+		}
+		route := ReportRoute{
+			Host:               e.Host,
+			Path:               e.Path,
+			Service:            service + ":" + strconv.Itoa(int(e.ServicePort)),
+			Ingress:            e.NamespaceName(),
+			BackendTimeout:     time.Duration(e.BackendTimeoutSeconds) * time.Second,
+			BackendFailTimeout: e.BackendFailTimeout,
+		}
+		if e.WebSocketUpgrade {
+			route.WebSocketTimeout = route.BackendTimeout
+			if e.WebSocketTimeoutSeconds > 0 {
+				route.WebSocketTimeout = time.Duration(e.WebSocketTimeoutSeconds) * time.Second
+			}
+		}
+		report.Routes = append(report.Routes, route)
+	}
+	sort.Slice(report.Routes, func(i, j int) bool {
+		if report.Routes[i].Host != report.Routes[j].Host {
+			return report.Routes[i].Host < report.Routes[j].Host
+		}
+		return report.Routes[i].Path < report.Routes[j].Path
+	})
+	sort.SliceStable(report.Problems, func(i, j int) bool {
+		return report.Problems[i].Ingress < report.Problems[j].Ingress
+	})
+
+	select {
+	case u.reports <- report:
+	default:
+	}
+	return nil
+}
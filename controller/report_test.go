@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	fake "github.com/sky-uk/feed/util/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReportHasTheRoutingTableAndProblemsWithoutRecordingEvents(t *testing.T) {
+	asserter := assert.New(t)
+	client := new(fake.FakeClient)
+
+	winner := createDefaultIngresses()[0]
+	loser := createIngressesFixture(ingressNamespace, ingressHost, ingressSvcName, ingressSvcPort,
+		map[string]string{ingressClassAnnotation: defaultIngressClass}, ingressPath)[0]
+	loser.Name = "z-" + ingressName
+	loser.CreationTimestamp = metav1.NewTime(time.Now())
+
+	client.On("GetAllIngresses").Return([]*networkingv1.Ingress{loser, winner}, nil)
+	client.On("GetServices").Return(createDefaultServices(), nil)
+	ingressWatcher, ingressCh := createFakeWatcher()
+	serviceWatcher, _ := createFakeWatcher()
+	namespaceWatcher, _ := createFakeWatcher()
+	client.On("WatchIngresses").Return(ingressWatcher)
+	client.On("WatchServices").Return(serviceWatcher)
+	client.On("WatchNamespaces").Return(namespaceWatcher)
+	ingressCh <- struct{}{}
+
+	report, err := Report(Config{
+		KubernetesClient:             client,
+		Name:                         defaultIngressClass,
+		DefaultBackendTimeoutSeconds: backendTimeout,
+	}, time.Second)
+
+	asserter.NoError(err)
+	asserter.Equal([]ReportRoute{{
+		Host:           ingressHost,
+		Path:           ingressPath,
+		Service:        ingressSvcName + ":80",
+		Ingress:        ingressNamespace + "/" + ingressName,
+		BackendTimeout: 10 * time.Second,
+	}}, report.Routes)
+	if asserter.Len(report.Problems, 1) {
+		asserter.Equal(ingressNamespace+"/"+loser.Name, report.Problems[0].Ingress)
+		asserter.Equal("HostPathConflict", report.Problems[0].Reason)
+	}
+	client.AssertNotCalled(t, "RecordIngressEvent", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/k8s"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// routePolicies indexes FeedRoutePolicies by namespace, for looking up the policy of an ingress.
+type routePolicies map[string][]*k8s.RoutePolicy
+
+func newRoutePolicies(policies []*k8s.RoutePolicy) routePolicies {
+	index := make(routePolicies)
+	for _, policy := range policies {
+		index[policy.Namespace] = append(index[policy.Namespace], policy)
+	}
+	return index
+}
+
+// find returns the policy referenced by the ingress's annotation, or else the first policy in its namespace
+// for the host. Policies in other namespaces are never used, so teams can't change each other's routes.
+func (r routePolicies) find(ingress *networkingv1.Ingress, host string) *k8s.RoutePolicy {
+	if name, ok := ingress.Annotations[routePolicyAnnotation]; ok {
+		for _, policy := range r[ingress.Namespace] {
+			if policy.Name == name {
+				return policy
+			}
+		}
+		log.Warnf("Ingress %s/%s references route policy %s which doesn't exist or is invalid", ingress.Namespace, ingress.Name, name)
+		return nil
+	}
+
+	for _, policy := range r[ingress.Namespace] {
+		for _, policyHost := range policy.Spec.Hosts {
+			if policyHost == strings.ToLower(host) {
+				return policy
+			}
+		}
+	}
+	return nil
+}
+
+// applyRoutePolicy overrides the entry with the fields set in the policy.
+func applyRoutePolicy(entry *IngressEntry, policy *k8s.RoutePolicy) {
+	spec := policy.Spec
+	if spec.Allow != nil {
+		entry.Allow = *spec.Allow
+	}
+	if spec.StripPath != nil {
+		entry.StripPaths = *spec.StripPath
+	}
+	if spec.ExactPath != nil {
+		entry.ExactPath = *spec.ExactPath
+	}
+	if spec.BackendTimeoutSeconds != nil {
+		entry.BackendTimeoutSeconds = *spec.BackendTimeoutSeconds
+	}
+	if spec.BackendMaxConnections != nil {
+		entry.BackendMaxConnections = *spec.BackendMaxConnections
+	}
+	if spec.BackendKeepaliveTimeout != nil {
+		entry.BackendKeepaliveTimeout = spec.KeepaliveTimeout()
+	}
+	if spec.BackendMaxRequestsPerConnection != nil {
+		entry.BackendMaxRequestsPerConnection = *spec.BackendMaxRequestsPerConnection
+	}
+	if spec.ProxyBufferSize != nil {
+		entry.ProxyBufferSize = *spec.ProxyBufferSize
+		if entry.ProxyBufferSize > maxAllowedProxyBufferSize {
+			log.Warnf("Route policy %s/%s proxyBufferSize %dk exceeds the max permissible value %dk. Using %dk.",
+				policy.Namespace, policy.Name, entry.ProxyBufferSize, maxAllowedProxyBufferSize, maxAllowedProxyBufferSize)
+			entry.ProxyBufferSize = maxAllowedProxyBufferSize
+		}
+	}
+	if spec.ProxyBufferBlocks != nil {
+		entry.ProxyBufferBlocks = *spec.ProxyBufferBlocks
+		if entry.ProxyBufferBlocks > maxAllowedProxyBufferBlocks {
+			log.Warnf("Route policy %s/%s proxyBufferBlocks %d exceeds the max permissible value %d. Using %d.",
+				policy.Namespace, policy.Name, entry.ProxyBufferBlocks, maxAllowedProxyBufferBlocks, maxAllowedProxyBufferBlocks)
+			entry.ProxyBufferBlocks = maxAllowedProxyBufferBlocks
+		}
+	}
+	if spec.RateLimit != nil {
+		entry.RateLimit = spec.RateLimit.RequestsPerSecond
+		entry.RateLimitBurst = spec.RateLimit.Burst
+	}
+	if spec.RequestHeaders != nil {
+		entry.RequestHeaders = spec.RequestHeaders
+	}
+	if spec.ResponseHeaders != nil {
+		entry.ResponseHeaders = spec.ResponseHeaders
+	}
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/util"
+)
+
+// RoutingTableVersion is the version of the routing table format, which is increased by changes that aren't
+// backwards compatible, such as removing or renaming a field.
+const RoutingTableVersion = 1
+
+// RoutingTable is the routing state applied by the last successful update, written for other tools to consume.
+type RoutingTable struct {
+	Version int `json:"version"`
+	// Hash is the hash of the entries, which only changes when they do.
+	Hash      string              `json:"hash"`
+	AppliedAt time.Time           `json:"appliedAt"`
+	Entries   []RoutingTableEntry `json:"entries"`
+}
+
+// RoutingTableEntry is an entry of the routing table. Secrets, such as API keys, are left out.
+type RoutingTableEntry struct {
+	Namespace             string     `json:"namespace"`
+	Name                  string     `json:"name"`
+	IngressClass          string     `json:"ingressClass,omitempty"`
+	Host                  string     `json:"host"`
+	Path                  string     `json:"path"`
+	PathType              string     `json:"pathType"`
+	ServiceAddress        string     `json:"serviceAddress"`
+	ServicePort           int32      `json:"servicePort"`
+	BackupService         string     `json:"backupService,omitempty"`
+	Headless              bool       `json:"headless,omitempty"`
+	Endpoints             []Endpoint `json:"endpoints,omitempty"`
+	FrontendScheme        string     `json:"frontendScheme,omitempty"`
+	Allow                 []string   `json:"allow"`
+	AllowCountries        []string   `json:"allowCountries,omitempty"`
+	DenyCountries         []string   `json:"denyCountries,omitempty"`
+	InternalPaths         []string   `json:"internalPaths,omitempty"`
+	SSLPassthrough        bool       `json:"sslPassthrough,omitempty"`
+	BackendProtocol       string     `json:"backendProtocol,omitempty"`
+	BackendTimeoutSeconds int        `json:"backendTimeoutSeconds"`
+	APIKeysRequired       bool       `json:"apiKeysRequired,omitempty"`
+	BasicAuth             bool       `json:"basicAuth,omitempty"`
+	RateLimit             int        `json:"rateLimit,omitempty"`
+	Drain                 bool       `json:"drain,omitempty"`
+}
+
+// newRoutingTable builds the routing table of the entries, ordered by host, path, namespace and name.
+func newRoutingTable(entries []IngressEntry, applied time.Time) RoutingTable {
+	table := RoutingTable{Version: RoutingTableVersion, AppliedAt: applied, Entries: []RoutingTableEntry{}}
+	for _, e := range entries {
+		table.Entries = append(table.Entries, newRoutingTableEntry(e))
+	}
+	sort.SliceStable(table.Entries, func(i, j int) bool {
+		a, b := table.Entries[i], table.Entries[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	entriesJSON, _ := json.Marshal(table.Entries)
+	sum := sha256.Sum256(entriesJSON)
+	table.Hash = hex.EncodeToString(sum[:])
+	return table
+}
+
+func newRoutingTableEntry(e IngressEntry) RoutingTableEntry {
+	entry := RoutingTableEntry{
+		Namespace:             e.Namespace,
+		Name:                  e.Name,
+		IngressClass:          e.IngressClass,
+		Host:                  e.Host,
+		Path:                  e.Path,
+		PathType:              pathType(e),
+		ServiceAddress:        e.ServiceAddress,
+		ServicePort:           e.ServicePort,
+		Headless:              e.Headless,
+		Endpoints:             e.Endpoints,
+		FrontendScheme:        e.LbScheme,
+		Allow:                 e.Allow,
+		AllowCountries:        e.AllowCountries,
+		DenyCountries:         e.DenyCountries,
+		InternalPaths:         e.InternalPaths,
+		SSLPassthrough:        e.SSLPassthrough,
+		BackendProtocol:       e.BackendProtocol,
+		BackendTimeoutSeconds: e.BackendTimeoutSeconds,
+		APIKeysRequired:       e.APIKeys != nil,
+		BasicAuth:             e.HtpasswdSecret != "",
+		RateLimit:             e.RateLimit,
+		Drain:                 e.Drain,
+	}
+	if e.BackupServiceAddress != "" {
+		entry.BackupService = e.BackupServiceAddress + ":" + strconv.Itoa(int(e.BackupServicePort))
+	}
+	if entry.Allow == nil {
+		entry.Allow = []string{}
+	}
+	return entry
+}
+
+func pathType(e IngressEntry) string {
+	switch {
+	case e.PathRegex:
+		return "Regex"
+	case e.ExactPath:
+		return "Exact"
+	case e.PrefixPath:
+		return "Prefix"
+	}
+	return "ImplementationSpecific"
+}
+
+// writeRoutingTable writes the routing table of the applied entries to the file, if set. A failure is logged and
+// counted, rather than failing the update, as the entries have already been applied.
+func (c *controller) writeRoutingTable(entries []IngressEntry, applied time.Time) {
+	if c.routingTableFile == "" {
+		return
+	}
+	contents, err := json.MarshalIndent(newRoutingTable(entries, applied), "", "  ")
+	if err == nil {
+		err = util.WriteFileAtomically(c.routingTableFile, append(contents, '\n'), 0644)
+	}
+	if err != nil {
+		log.Warnf("Unable to write the routing table to %s: %v", c.routingTableFile, err)
+		routingTableWriteFailures.Inc()
+	}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutingTableIsOrderedAndLeavesOutSecrets(t *testing.T) {
+	asserter := assert.New(t)
+	applied := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	entries := []IngressEntry{
+		{Namespace: "core", Name: "b", Host: "b.com", Path: "/", ServiceAddress: "10.0.0.2", ServicePort: 80,
+			ExactPath: true, APIKeys: map[string]string{"secret-key": "client"}},
+		{Namespace: "core", Name: "a", Host: "a.com", Path: "/api/", ServiceAddress: "10.0.0.1", ServicePort: 8080,
+			BackupServiceAddress: "10.0.0.3", BackupServicePort: 8080, Allow: []string{"10.0.0.0/8"},
+			Endpoints: []Endpoint{{Address: "172.16.0.1", Port: 9090}}},
+	}
+
+	table := newRoutingTable(entries, applied)
+
+	asserter.Equal(RoutingTableVersion, table.Version)
+	asserter.Equal(applied, table.AppliedAt)
+	if asserter.Len(table.Entries, 2) {
+		asserter.Equal(RoutingTableEntry{Namespace: "core", Name: "a", Host: "a.com", Path: "/api/",
+			PathType: "ImplementationSpecific", ServiceAddress: "10.0.0.1", ServicePort: 8080,
+			BackupService: "10.0.0.3:8080", Allow: []string{"10.0.0.0/8"},
+			Endpoints: []Endpoint{{Address: "172.16.0.1", Port: 9090}}}, table.Entries[0])
+		asserter.Equal("Exact", table.Entries[1].PathType)
+		asserter.True(table.Entries[1].APIKeysRequired)
+	}
+	contents, err := json.Marshal(table)
+	asserter.NoError(err)
+	asserter.NotContains(string(contents), "secret-key")
+
+	asserter.Equal(table.Hash, newRoutingTable(entries, applied.Add(time.Hour)).Hash,
+		"hash should only change with the entries")
+	asserter.NotEqual(table.Hash, newRoutingTable(entries[:1], applied).Hash)
+}
+
+func TestRoutingTableIsWrittenToTheFile(t *testing.T) {
+	initMetrics()
+	asserter := assert.New(t)
+	dir, err := ioutil.TempDir("", "routing_table")
+	asserter.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "routing.json")
+	c := &controller{routingTableFile: file}
+
+	c.writeRoutingTable([]IngressEntry{{Namespace: "core", Name: "a", Host: "a.com", Path: "/"}}, time.Now())
+
+	contents, err := ioutil.ReadFile(file)
+	asserter.NoError(err)
+	var table RoutingTable
+	asserter.NoError(json.Unmarshal(contents, &table))
+	asserter.Equal(1, table.Version)
+	if asserter.Len(table.Entries, 1) {
+		asserter.Equal("a.com", table.Entries[0].Host)
+		asserter.Equal([]string{}, table.Entries[0].Allow)
+	}
+}
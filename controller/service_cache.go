@@ -0,0 +1,67 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// serviceCache indexes services by namespace/name across updates. The client's store keeps the same object for a
+// service until a watch event replaces it, and never changes it in place, so only the services which were added,
+// changed or deleted since the last update are indexed again, rather than rebuilding the index every update.
+type serviceCache struct {
+	services map[serviceName]*cachedService
+	update   uint64
+}
+
+type cachedService struct {
+	service *corev1.Service
+	address string
+	// seen is the last update the service was listed in.
+	seen uint64
+}
+
+// sync brings the cache up to date with the services listed for this update, returning how many were indexed again
+// and how many were removed.
+func (s *serviceCache) sync(services []*corev1.Service) (changed, removed int) {
+	if s.services == nil {
+		s.services = make(map[serviceName]*cachedService, len(services))
+	}
+	s.update++
+
+	for _, svc := range services {
+		name := serviceName{namespace: svc.Namespace, name: svc.Name}
+		if cached, ok := s.services[name]; ok && cached.service == svc {
+			cached.seen = s.update
+			continue
+		}
+		s.services[name] = &cachedService{service: svc, address: svc.Spec.ClusterIP, seen: s.update}
+		changed++
+	}
+
+	// names are unique, so the cache only has more services than were listed if some were deleted
+	if len(s.services) == len(services) {
+		return changed, 0
+	}
+	for name, cached := range s.services {
+		if cached.seen != s.update {
+			delete(s.services, name)
+			removed++
+		}
+	}
+	return changed, removed
+}
+
+// address returns the cluster IP of the service, or "" if it doesn't exist.
+func (s *serviceCache) address(name serviceName) string {
+	if cached, ok := s.services[name]; ok {
+		return cached.address
+	}
+	return ""
+}
+
+// get returns the service, or nil if it doesn't exist.
+func (s *serviceCache) get(namespace, name string) *corev1.Service {
+	if cached, ok := s.services[serviceName{namespace: namespace, name: name}]; ok {
+		return cached.service
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newService(namespace, name, clusterIP string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       corev1.ServiceSpec{ClusterIP: clusterIP},
+	}
+}
+
+func TestServiceCacheOnlyIndexesServicesWhichChanged(t *testing.T) {
+	asserter := assert.New(t)
+	app, web := newService("team", "app", "10.254.0.1"), newService("team", "web", "10.254.0.2")
+	var cache serviceCache
+
+	changed, removed := cache.sync([]*corev1.Service{app, web})
+	asserter.Equal(2, changed)
+	asserter.Equal(0, removed)
+	asserter.Equal("10.254.0.1", cache.address(serviceName{namespace: "team", name: "app"}))
+	asserter.Equal(web, cache.get("team", "web"))
+
+	changed, removed = cache.sync([]*corev1.Service{app, web})
+	asserter.Equal(0, changed, "the same objects are unchanged")
+	asserter.Equal(0, removed)
+
+	updated := newService("team", "app", "10.254.0.3")
+	changed, removed = cache.sync([]*corev1.Service{updated, web})
+	asserter.Equal(1, changed)
+	asserter.Equal(0, removed)
+	asserter.Equal("10.254.0.3", cache.address(serviceName{namespace: "team", name: "app"}))
+}
+
+func TestServiceCacheRemovesDeletedServices(t *testing.T) {
+	asserter := assert.New(t)
+	app, web := newService("team", "app", "10.254.0.1"), newService("team", "web", "10.254.0.2")
+	var cache serviceCache
+	cache.sync([]*corev1.Service{app, web})
+
+	changed, removed := cache.sync([]*corev1.Service{web})
+	asserter.Equal(0, changed)
+	asserter.Equal(1, removed)
+	asserter.Equal("", cache.address(serviceName{namespace: "team", name: "app"}))
+	asserter.Nil(cache.get("team", "app"))
+
+	// a service replacing a deleted one in the same update
+	api := newService("team", "api", "10.254.0.4")
+	changed, removed = cache.sync([]*corev1.Service{api})
+	asserter.Equal(1, changed)
+	asserter.Equal(1, removed)
+	asserter.Equal("", cache.address(serviceName{namespace: "team", name: "web"}))
+	asserter.Equal("10.254.0.4", cache.address(serviceName{namespace: "team", name: "api"}))
+}
+
+// benchmarkServices is an order of magnitude more services than ingress entries in our largest clusters.
+const benchmarkServices = 10000
+
+func createBenchmarkServices() []*corev1.Service {
+	services := make([]*corev1.Service, 0, benchmarkServices)
+	for i := 0; i < benchmarkServices; i++ {
+		services = append(services, newService(fmt.Sprintf("namespace-%d", i%100), fmt.Sprintf("service-%d", i),
+			fmt.Sprintf("10.254.%d.%d", i/256, i%256)))
+	}
+	return services
+}
+
+func BenchmarkServiceCache(b *testing.B) {
+	services := createBenchmarkServices()
+
+	b.Run("rebuilt each update", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var cache serviceCache
+			cache.sync(services)
+		}
+	})
+
+	b.Run("kept between updates", func(b *testing.B) {
+		var cache serviceCache
+		cache.sync(services)
+		// a service changes between most updates
+		changes := make([]*corev1.Service, b.N)
+		for i := range changes {
+			changed := *services[i%len(services)]
+			changes[i] = &changed
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			services[i%len(services)] = changes[i]
+			cache.sync(services)
+		}
+	})
+}
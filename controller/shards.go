@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// Shard is a deterministic share of the hosts in a cluster, so several groups of feed instances can each serve part
+// of a very large config. Hosts are divided by hash, so every path of a host is served by the same shard.
+type Shard struct {
+	// Index of this shard, from 0 to Count-1.
+	Index int
+	// Count of shards the hosts are divided between. 0 or 1 serves every host.
+	Count int
+}
+
+// Validate returns an error if the index isn't one of the shards.
+func (s Shard) Validate() error {
+	if s.Count < 0 {
+		return fmt.Errorf("shard count %d can't be negative", s.Count)
+	}
+	if s.Count <= 1 {
+		if s.Index != 0 {
+			return fmt.Errorf("shard index %d needs a shard count of more than 1", s.Index)
+		}
+		return nil
+	}
+	if s.Index < 0 || s.Index >= s.Count {
+		return fmt.Errorf("shard index %d must be from 0 to %d", s.Index, s.Count-1)
+	}
+	return nil
+}
+
+// Owns returns true if the host is served by this shard.
+func (s Shard) Owns(host string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(strings.ToLower(host)))
+	return int(hash.Sum32()%uint32(s.Count)) == s.Index
+}
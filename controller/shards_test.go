@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEveryHostIsOwnedByExactlyOneShard(t *testing.T) {
+	const count = 4
+	served := make([]int, count)
+
+	for i := 0; i < 1000; i++ {
+		host := fmt.Sprintf("host-%d.sky.com", i)
+		owners := 0
+		for index := 0; index < count; index++ {
+			if (Shard{Index: index, Count: count}).Owns(host) {
+				owners++
+				served[index]++
+			}
+		}
+		assert.Equal(t, 1, owners, host)
+	}
+
+	for index, hosts := range served {
+		assert.InDelta(t, 250, hosts, 50, "shard %d", index)
+	}
+}
+
+func TestHostsAreShardedIgnoringCase(t *testing.T) {
+	for index := 0; index < 3; index++ {
+		shard := Shard{Index: index, Count: 3}
+		assert.Equal(t, shard.Owns("foo.sky.com"), shard.Owns("FOO.sky.com"))
+	}
+}
+
+func TestNoShardingOwnsEveryHost(t *testing.T) {
+	assert.True(t, Shard{}.Owns("foo.sky.com"))
+	assert.True(t, Shard{Count: 1}.Owns("foo.sky.com"))
+}
+
+func TestShardsAreValidated(t *testing.T) {
+	assert.NoError(t, Shard{}.Validate())
+	assert.NoError(t, Shard{Index: 2, Count: 3}.Validate())
+	assert.EqualError(t, Shard{Index: 3, Count: 3}.Validate(), "shard index 3 must be from 0 to 2")
+	assert.EqualError(t, Shard{Index: -1, Count: 3}.Validate(), "shard index -1 must be from 0 to 2")
+	assert.EqualError(t, Shard{Index: 1}.Validate(), "shard index 1 needs a shard count of more than 1")
+	assert.EqualError(t, Shard{Count: -2}.Validate(), "shard count -2 can't be negative")
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ShutdownConfig sets out the drain sequence. Updaters are stopped in reverse order: first the frontends, which are
+// the updaters after nginx, then nginx, then the rest. Timeouts of 0 don't limit the stage.
+type ShutdownConfig struct {
+	// FrontendsTimeout is how long the frontends have to deregister, including any drain delay of their own.
+	FrontendsTimeout time.Duration
+	// DelayAfterFrontends is how long to wait after the frontends have stopped, before nginx is stopped.
+	DelayAfterFrontends time.Duration
+	// NginxTimeout is how long nginx has to stop, which includes its workers finishing their requests.
+	NginxTimeout time.Duration
+	// DelayAfterNginx is how long to wait after nginx has stopped, before the remaining updaters are stopped.
+	DelayAfterNginx time.Duration
+}
+
+// stopAll stops the stages in reverse order, following the drain sequence. Nginx is any prerequisite updater, and
+// the frontends are the stages after the last of them. Updaters which fail or time out are logged and left behind,
+// so that shutdown carries on.
+func stopAll(stages []updateStage, conf ShutdownConfig) {
+	lastPrerequisite := -1
+	for i, stage := range stages {
+		if stage.isPrerequisite() {
+			lastPrerequisite = i
+		}
+	}
+
+	for i := len(stages) - 1; i >= 0; i-- {
+		stage := stages[i]
+		switch {
+		case i > lastPrerequisite:
+			stage.stop(conf.FrontendsTimeout)
+			if i == lastPrerequisite+1 && lastPrerequisite >= 0 {
+				wait(conf.DelayAfterFrontends, "after stopping frontends")
+			}
+		case stage.isPrerequisite():
+			stage.stop(conf.NginxTimeout)
+			wait(conf.DelayAfterNginx, "after stopping nginx")
+		default:
+			stage.stop(0)
+		}
+	}
+}
+
+func (s updateStage) isPrerequisite() bool {
+	if len(s) != 1 {
+		return false
+	}
+	p, ok := s[0].Updater.(Prerequisite)
+	return ok && p.Prerequisite()
+}
+
+// stop stops the stage's updaters in reverse order, all within the timeout. Running updates are cancelled and
+// waited for first, as updaters aren't thread safe.
+func (s updateStage) stop(timeout time.Duration) {
+	var timedOut <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+
+	for i := len(s) - 1; i >= 0; i-- {
+		staged, u := s[i], s[i].Updater
+		done := make(chan error, 1)
+		go func() {
+			staged.abandonUpdate()
+			done <- u.Stop()
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Warnf("Error while stopping %v: %v", u, err)
+			}
+		case <-timedOut:
+			log.Warnf("Timed out after %v stopping %v", timeout, u)
+			for _, remaining := range s[:i] {
+				log.Warnf("Not stopping %v, as shutdown timed out", remaining.Updater)
+			}
+			return
+		}
+	}
+}
+
+func wait(delay time.Duration, reason string) {
+	if delay > 0 {
+		log.Infof("Waiting %v %s", delay, reason)
+		time.Sleep(delay)
+	}
+}
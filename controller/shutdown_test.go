@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdatersAreStoppedInReverseOrderWithDelays(t *testing.T) {
+	asserter := assert.New(t)
+	e := &events{}
+	vault := &stageUpdater{name: "vault", events: e}
+	nginx := &stageUpdater{name: "nginx", prerequisite: true, events: e}
+	elb := &stageUpdater{name: "elb", events: e}
+	status := &stageUpdater{name: "status", err: errors.New("unreachable"), events: e}
+	conf := ShutdownConfig{DelayAfterFrontends: smallDelay, DelayAfterNginx: smallDelay}
+
+	start := time.Now()
+	stopAll(newTestStages(vault, nginx, elb, status), conf)
+
+	asserter.Equal([]string{"stop status", "stop elb", "stop nginx", "stop vault"}, e.get(),
+		"errors shouldn't stop the shutdown")
+	asserter.True(time.Since(start) >= smallDelay*2, "should wait after frontends and nginx")
+}
+
+func TestStagesWhichTimeOutAreLeftBehind(t *testing.T) {
+	asserter := assert.New(t)
+	e := &events{}
+	vault := &stageUpdater{name: "vault", events: e}
+	nginx := &stageUpdater{name: "nginx", prerequisite: true, stopDelay: smallDelay * 4, events: e}
+	elb := &stageUpdater{name: "elb", events: e}
+	gorb := &stageUpdater{name: "gorb", stopDelay: smallDelay * 4, events: e}
+	conf := ShutdownConfig{FrontendsTimeout: smallDelay, NginxTimeout: smallDelay}
+
+	start := time.Now()
+	stopAll(newTestStages(vault, nginx, elb, gorb), conf)
+
+	asserter.Equal([]string{"stop vault"}, e.get(), "elb should be skipped after gorb timed out")
+	asserter.True(time.Since(start) < smallDelay*4, "shouldn't wait for updaters which timed out")
+}
+
+func TestFrontendsAreStoppedWithoutNginx(t *testing.T) {
+	e := &events{}
+	elb := &stageUpdater{name: "elb", events: e}
+	status := &stageUpdater{name: "status", events: e}
+
+	stopAll(newTestStages(elb, status), ShutdownConfig{DelayAfterFrontends: time.Hour})
+
+	assert.Equal(t, []string{"stop status", "stop elb"}, e.get())
+}
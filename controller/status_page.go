@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Status is what the controller is serving, being the entries of the last successful update.
+type Status struct {
+	// LastApplied is when the entries were last applied, or zero if they never have been.
+	LastApplied time.Time     `json:"lastApplied"`
+	Entries     []StatusEntry `json:"entries"`
+}
+
+// StatusEntry is a host and path, the service it's routed to, and the ingress it's from.
+type StatusEntry struct {
+	Host    string `json:"host"`
+	Path    string `json:"path"`
+	Service string `json:"service"`
+	Ingress string `json:"ingress"`
+}
+
+// appliedEntries are the entries of the last successful update.
+type appliedEntries struct {
+	sync.Mutex
+	entries []IngressEntry
+	time    time.Time
+}
+
+func (a *appliedEntries) set(entries []IngressEntry, applied time.Time) {
+	a.Lock()
+	defer a.Unlock()
+	a.entries = entries
+	a.time = applied
+}
+
+func (a *appliedEntries) status() Status {
+	a.Lock()
+	defer a.Unlock()
+	status := Status{LastApplied: a.time, Entries: []StatusEntry{}}
+	for _, e := range a.entries {
+		status.Entries = append(status.Entries, StatusEntry{
+			Host:    e.Host,
+			Path:    e.Path,
+			Service: e.ServiceAddress + ":" + strconv.Itoa(int(e.ServicePort)),
+			Ingress: e.NamespaceName(),
+		})
+	}
+	sort.Slice(status.Entries, func(i, j int) bool {
+		if status.Entries[i].Host != status.Entries[j].Host {
+			return status.Entries[i].Host < status.Entries[j].Host
+		}
+		return status.Entries[i].Path < status.Entries[j].Path
+	})
+	return status
+}
+
+// StatusPagePath is where the status page is served on the health port.
+const StatusPagePath = "/status"
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>feed status</title></head>
+<body>
+<h1>feed status</h1>
+<p>{{ if .LastApplied.IsZero }}No entries have been applied yet.{{ else }}{{ len .Entries }} entries last applied at {{ .LastApplied.Format "2006-01-02T15:04:05Z07:00" }}.{{ end }}</p>
+<table>
+<tr><th>Host</th><th>Path</th><th>Service</th><th>Ingress</th></tr>
+{{- range .Entries }}
+<tr><td>{{ .Host }}</td><td>{{ .Path }}</td><td>{{ .Service }}</td><td>{{ .Ingress }}</td></tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+// NewStatusPage serves the controller's status as an HTML table, or as JSON if the client accepts it or the
+// request has ?format=json.
+func NewStatusPage(status func() Status) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := status()
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				log.Warnf("Unable to write status page: %v", err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusPageTemplate.Execute(w, status); err != nil {
+			log.Warnf("Unable to write status page: %v", err)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusListsTheAppliedEntriesByHostAndPath(t *testing.T) {
+	var applied appliedEntries
+	assert.Equal(t, Status{Entries: []StatusEntry{}}, applied.status())
+
+	now := time.Now()
+	applied.set([]IngressEntry{
+		{Namespace: "team", Name: "b", Host: "b.com", Path: "/", ServiceAddress: "10.0.0.2", ServicePort: 8080},
+		{Namespace: "team", Name: "a", Host: "a.com", Path: "/z", ServiceAddress: "10.0.0.1", ServicePort: 80},
+		{Namespace: "team", Name: "a", Host: "a.com", Path: "/a", ServiceAddress: "10.0.0.1", ServicePort: 80},
+	}, now)
+
+	assert.Equal(t, Status{
+		LastApplied: now,
+		Entries: []StatusEntry{
+			{Host: "a.com", Path: "/a", Service: "10.0.0.1:80", Ingress: "team/a"},
+			{Host: "a.com", Path: "/z", Service: "10.0.0.1:80", Ingress: "team/a"},
+			{Host: "b.com", Path: "/", Service: "10.0.0.2:8080", Ingress: "team/b"},
+		},
+	}, applied.status())
+}
+
+func TestStatusPageIsServedAsHTMLOrJSON(t *testing.T) {
+	status := Status{
+		LastApplied: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Entries:     []StatusEntry{{Host: "a.com", Path: "/<a>", Service: "10.0.0.1:80", Ingress: "team/a"}},
+	}
+	page := NewStatusPage(func() Status { return status })
+
+	recorder := httptest.NewRecorder()
+	page.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, StatusPagePath, nil))
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "1 entries last applied at 2020-01-02T03:04:05Z.")
+	assert.Contains(t, recorder.Body.String(),
+		"<tr><td>a.com</td><td>/&lt;a&gt;</td><td>10.0.0.1:80</td><td>team/a</td></tr>")
+
+	for _, request := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, StatusPagePath+"?format=json", nil),
+		func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, StatusPagePath, nil)
+			r.Header.Set("Accept", "application/json")
+			return r
+		}(),
+	} {
+		recorder = httptest.NewRecorder()
+		page.ServeHTTP(recorder, request)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		var served Status
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &served))
+		assert.Equal(t, status, served)
+	}
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/util"
+)
+
+// updateStage is a set of updaters which don't depend on each other, so are updated concurrently.
+type updateStage []*stagedUpdater
+
+type stagedUpdater struct {
+	Updater
+	// set while an update is running, which can outlast its timeout
+	updating util.SafeBool
+	// the running update, which is closed once it returns and abandoned by cancel
+	lock     sync.Mutex
+	finished chan struct{}
+	cancel   context.CancelFunc
+	stopping bool
+	// how long the update took in the last call to updateAll, or 0 if it wasn't updated, guarded by lock
+	took     time.Duration
+	timedOut bool
+}
+
+// newUpdateStages splits the updaters into stages at each prerequisite, keeping their order.
+func newUpdateStages(updaters []Updater) []updateStage {
+	var stages []updateStage
+	var current updateStage
+	for _, u := range updaters {
+		if p, ok := u.(Prerequisite); ok && p.Prerequisite() {
+			if len(current) > 0 {
+				stages = append(stages, current)
+				current = nil
+			}
+			stages = append(stages, updateStage{&stagedUpdater{Updater: u}})
+			continue
+		}
+		current = append(current, &stagedUpdater{Updater: u})
+	}
+	if len(current) > 0 {
+		stages = append(stages, current)
+	}
+	return stages
+}
+
+// updateAll updates each stage in turn, stopping at the first stage with a failed updater as later stages may
+// depend on it.
+func updateAll(stages []updateStage, entries IngressEntries, timeout time.Duration) error {
+	for _, stage := range stages {
+		for _, u := range stage {
+			u.setTook(0, false)
+		}
+	}
+	for _, stage := range stages {
+		errs := make([]error, len(stage))
+		var wg sync.WaitGroup
+		for i, u := range stage {
+			wg.Add(1)
+			go func(i int, u *stagedUpdater) {
+				defer wg.Done()
+				errs[i] = u.updateWithTimeout(entries, timeout)
+			}(i, u)
+		}
+		wg.Wait()
+
+		var result *multierror.Error
+		for _, err := range errs {
+			if err != nil {
+				result = multierror.Append(result, err)
+			}
+		}
+		if err := result.ErrorOrNil(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *stagedUpdater) updateWithTimeout(entries IngressEntries, timeout time.Duration) error {
+	// updaters aren't thread safe, so one which timed out is skipped until it finishes
+	if u.updating.Get() {
+		return fmt.Errorf("%v: previous update is still in progress", u.Updater)
+	}
+	u.updating.Set(true)
+
+	u.lock.Lock()
+	if u.stopping {
+		u.lock.Unlock()
+		u.updating.Set(false)
+		return fmt.Errorf("%v: stopping", u.Updater)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	u.cancel, u.finished = cancel, finished
+	u.lock.Unlock()
+	// cancelling abandons the update if it timed out, for updaters which support it
+	defer cancel()
+
+	log.Debugf("Calling updater %v", u.Updater)
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer close(finished)
+		defer u.updating.Set(false)
+		err := u.update(ctx, entries)
+		// observed once it returns, so updates which time out are still timed
+		updaterUpdateDuration.WithLabelValues(fmt.Sprint(u.Updater)).Observe(time.Since(start).Seconds())
+		done <- err
+	}()
+
+	var timedOut <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+
+	select {
+	case err := <-done:
+		u.setTook(time.Since(start), false)
+		if err != nil {
+			return fmt.Errorf("%v: %v", u.Updater, err)
+		}
+		updaterLastSuccessfulUpdate.WithLabelValues(fmt.Sprint(u.Updater)).SetToCurrentTime()
+		return nil
+	case <-timedOut:
+		u.setTook(timeout, true)
+		return fmt.Errorf("%v: update timed out after %v", u.Updater, timeout)
+	}
+}
+
+// breakdown describes how long each updater took in the last call to updateAll, with the phases of those which
+// report them, such as "nginx 1.2s (render 300ms, write 900ms), elb 2s".
+func breakdown(stages []updateStage) string {
+	var updaters []string
+	for _, stage := range stages {
+		for _, u := range stage {
+			u.lock.Lock()
+			took, timedOut := u.took, u.timedOut
+			u.lock.Unlock()
+			if took == 0 {
+				continue
+			}
+			if timedOut {
+				updaters = append(updaters, fmt.Sprintf("%v timed out after %v", u.Updater, took))
+				continue
+			}
+			description := fmt.Sprintf("%v %v", u.Updater, took.Round(time.Millisecond))
+			if p, ok := u.Updater.(PhasedUpdater); ok {
+				var phases []string
+				for _, phase := range p.UpdatePhases() {
+					phases = append(phases, fmt.Sprintf("%s %v", phase.Name, phase.Duration.Round(time.Millisecond)))
+				}
+				if len(phases) > 0 {
+					description += " (" + strings.Join(phases, ", ") + ")"
+				}
+			}
+			updaters = append(updaters, description)
+		}
+	}
+	return strings.Join(updaters, ", ")
+}
+
+func (u *stagedUpdater) setTook(took time.Duration, timedOut bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.took, u.timedOut = took, timedOut
+}
+
+func (u *stagedUpdater) update(ctx context.Context, entries IngressEntries) error {
+	if c, ok := u.Updater.(ContextUpdater); ok {
+		return c.UpdateWithContext(ctx, entries)
+	}
+	return u.Update(entries)
+}
+
+// abandonUpdate cancels any running update and waits for it to return, so the updater can be stopped. No more
+// updates are started afterwards.
+func (u *stagedUpdater) abandonUpdate() {
+	u.lock.Lock()
+	u.stopping = true
+	cancel, finished := u.cancel, u.finished
+	u.lock.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-finished
+	}
+}
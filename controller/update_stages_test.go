@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// stageUpdater records when it was updated or stopped, taking delay or stopDelay to do so.
+type stageUpdater struct {
+	name         string
+	prerequisite bool
+	delay        time.Duration
+	stopDelay    time.Duration
+	err          error
+	events       *events
+}
+
+type events struct {
+	sync.Mutex
+	log []string
+}
+
+func (e *events) add(event string) {
+	e.Lock()
+	defer e.Unlock()
+	e.log = append(e.log, event)
+}
+
+func (e *events) get() []string {
+	e.Lock()
+	defer e.Unlock()
+	return append([]string{}, e.log...)
+}
+
+func (u *stageUpdater) Update(IngressEntries) error {
+	u.events.add("start " + u.name)
+	time.Sleep(u.delay)
+	u.events.add("end " + u.name)
+	return u.err
+}
+
+func (u *stageUpdater) Stop() error {
+	time.Sleep(u.stopDelay)
+	u.events.add("stop " + u.name)
+	return u.err
+}
+
+func (u *stageUpdater) Start() error       { return nil }
+func (u *stageUpdater) Health() error      { return nil }
+func (u *stageUpdater) Readiness() error   { return nil }
+func (u *stageUpdater) Prerequisite() bool { return u.prerequisite }
+func (u *stageUpdater) String() string     { return u.name }
+
+func TestUpdatersAreSplitIntoStagesAtPrerequisites(t *testing.T) {
+	e := &events{}
+	vault := &stageUpdater{name: "vault", events: e}
+	nginx := &stageUpdater{name: "nginx", prerequisite: true, events: e}
+	acme := &stageUpdater{name: "acme", events: e}
+	elb := &stageUpdater{name: "elb", events: e}
+
+	stages := newTestStages(vault, nginx, acme, elb)
+
+	var names [][]string
+	for _, stage := range stages {
+		var stageNames []string
+		for _, u := range stage {
+			stageNames = append(stageNames, fmt.Sprint(u.Updater))
+		}
+		names = append(names, stageNames)
+	}
+	assert.Equal(t, [][]string{{"vault"}, {"nginx"}, {"acme", "elb"}}, names)
+}
+
+func TestIndependentUpdatersAreUpdatedConcurrently(t *testing.T) {
+	asserter := assert.New(t)
+	e := &events{}
+	nginx := &stageUpdater{name: "nginx", prerequisite: true, delay: smallDelay, events: e}
+	elb := &stageUpdater{name: "elb", delay: smallDelay, events: e}
+	status := &stageUpdater{name: "status", delay: smallDelay, events: e}
+
+	asserter.NoError(updateAll(newTestStages(nginx, elb, status), nil, 0))
+
+	log := e.get()
+	asserter.Equal([]string{"start nginx", "end nginx"}, log[:2], "frontends should only be updated after nginx")
+	asserter.ElementsMatch([]string{"start elb", "start status"}, log[2:4], "frontends should be updated concurrently")
+	asserter.ElementsMatch([]string{"end elb", "end status"}, log[4:])
+}
+
+func TestLaterStagesAreNotUpdatedAfterAFailure(t *testing.T) {
+	asserter := assert.New(t)
+	e := &events{}
+	vault := &stageUpdater{name: "vault", err: errors.New("sealed"), events: e}
+	acme := &stageUpdater{name: "acme", err: errors.New("rate limited"), events: e}
+	nginx := &stageUpdater{name: "nginx", prerequisite: true, events: e}
+	elb := &stageUpdater{name: "elb", events: e}
+
+	err := updateAll(newTestStages(vault, acme, nginx, elb), nil, 0)
+
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "vault: sealed")
+		asserter.Contains(err.Error(), "acme: rate limited")
+	}
+	asserter.NotContains(e.get(), "start nginx")
+	asserter.NotContains(e.get(), "start elb")
+}
+
+func TestSlowUpdatersTimeOutAndAreSkippedUntilFinished(t *testing.T) {
+	asserter := assert.New(t)
+	e := &events{}
+	slow := &stageUpdater{name: "slow", delay: smallDelay * 4, events: e}
+	fast := &stageUpdater{name: "fast", events: e}
+	stages := newTestStages(slow, fast)
+
+	err := updateAll(stages, nil, smallDelay)
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "slow: update timed out after")
+	}
+	err = updateAll(stages, nil, smallDelay)
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "slow: previous update is still in progress")
+	}
+	asserter.Equal(1, count(e.get(), "start slow"), "slow updater shouldn't be called concurrently")
+	asserter.Equal(2, count(e.get(), "end fast"))
+
+	time.Sleep(smallDelay * 4)
+	asserter.NoError(updateAll(stages, nil, smallDelay*8))
+}
+
+func TestTimedOutUpdatesAreCancelled(t *testing.T) {
+	asserter := assert.New(t)
+	e := &events{}
+	plugin := &cancellableUpdater{stageUpdater{name: "plugin", delay: smallDelay * 8, events: e}}
+	stages := newTestStages(plugin)
+
+	err := updateAll(stages, nil, smallDelay)
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "plugin: update timed out after")
+	}
+	time.Sleep(smallDelay)
+	asserter.Contains(e.get(), "cancelled plugin")
+	asserter.NoError(updateAll(stages, nil, 0), "updater should be updated once its cancelled update has returned")
+}
+
+func TestRunningUpdatesAreCancelledAndWaitedForBeforeStopping(t *testing.T) {
+	asserter := assert.New(t)
+	e := &events{}
+	slow := &stageUpdater{name: "slow", delay: smallDelay * 2, events: e}
+	plugin := &cancellableUpdater{stageUpdater{name: "plugin", delay: time.Minute, events: e}}
+	stages := newTestStages(slow, plugin)
+
+	go func() { _ = updateAll(stages, nil, 0) }()
+	time.Sleep(smallDelay)
+	stopAll(stages, ShutdownConfig{})
+
+	log := e.get()
+	asserter.ElementsMatch([]string{"start slow", "start plugin"}, log[:2])
+	asserter.Equal([]string{"cancelled plugin", "stop plugin", "end slow", "stop slow"}, log[2:],
+		"updates should finish before their updaters are stopped")
+	err := updateAll(stages, nil, 0)
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "stopping")
+	}
+}
+
+func TestUpdatesAreBrokenDownByUpdaterAndPhase(t *testing.T) {
+	asserter := assert.New(t)
+	e := &events{}
+	nginx := &phasedUpdater{stageUpdater{name: "timed-nginx", prerequisite: true, delay: smallDelay, events: e}}
+	elb := &stageUpdater{name: "timed-elb", delay: smallDelay * 4, events: e}
+	status := &stageUpdater{name: "timed-status", err: errors.New("throttled"), events: e}
+	stages := newTestStages(nginx, elb, status)
+
+	asserter.Error(updateAll(stages, nil, smallDelay*2))
+
+	asserter.Regexp(`^timed-nginx \d+ms \(render 50ms\), timed-elb timed out after 100ms, timed-status \S+$`,
+		breakdown(stages))
+	asserter.Equal(uint64(1), sampleCount(updaterUpdateDuration.WithLabelValues("timed-nginx")))
+	asserter.Equal(uint64(1), sampleCount(updaterUpdateDuration.WithLabelValues("timed-status")))
+
+	time.Sleep(smallDelay * 4)
+	asserter.Equal(uint64(1), sampleCount(updaterUpdateDuration.WithLabelValues("timed-elb")),
+		"updates should be timed once they return, even if they timed out")
+}
+
+// phasedUpdater reports its whole update as rendering.
+type phasedUpdater struct {
+	stageUpdater
+}
+
+func (u *phasedUpdater) UpdatePhases() []UpdatePhase {
+	return []UpdatePhase{{Name: "render", Duration: u.delay}}
+}
+
+// cancellableUpdater returns early from updates when they're cancelled.
+type cancellableUpdater struct {
+	stageUpdater
+}
+
+func (u *cancellableUpdater) UpdateWithContext(ctx context.Context, _ IngressEntries) error {
+	u.events.add("start " + u.name)
+	select {
+	case <-time.After(u.delay):
+		u.events.add("end " + u.name)
+		return nil
+	case <-ctx.Done():
+		u.events.add("cancelled " + u.name)
+		return ctx.Err()
+	}
+}
+
+const smallDelay = time.Millisecond * 50
+
+func newTestStages(updaters ...Updater) []updateStage {
+	initMetrics()
+	return newUpdateStages(updaters)
+}
+
+func sampleCount(histogram prometheus.Observer) uint64 {
+	var metric dto.Metric
+	_ = histogram.(prometheus.Metric).Write(&metric)
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func count(events []string, event string) int {
+	n := 0
+	for _, e := range events {
+		if e == event {
+			n++
+		}
+	}
+	return n
+}
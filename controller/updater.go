@@ -1,5 +1,10 @@
 package controller
 
+import (
+	"context"
+	"time"
+)
+
 // Updater that the Controller delegates to.
 type Updater interface {
 	// Start the ingress updater, returning immediately after it's started.
@@ -16,3 +21,31 @@ type Updater interface {
 	// may be called often. Any long running checks should be done separately.
 	Readiness() error
 }
+
+// Prerequisite is an optional interface for updaters which the updaters after them depend on, such as nginx, which
+// must have the new config before frontends are attached to it. Other updaters are updated concurrently.
+type Prerequisite interface {
+	// Prerequisite returns true if the updaters after this one must wait for it to be updated.
+	Prerequisite() bool
+}
+
+// ContextUpdater is an optional interface for updaters which can abandon an update, such as those which call other
+// services. The context is cancelled if the update times out or the updater is stopped.
+type ContextUpdater interface {
+	// UpdateWithContext is Update, returning early with an error once ctx is done.
+	UpdateWithContext(ctx context.Context, entries IngressEntries) error
+}
+
+// PhasedUpdater is an optional interface for updaters whose updates have distinct phases, such as rendering and
+// writing the nginx config, so a slow update can be broken down.
+type PhasedUpdater interface {
+	// UpdatePhases returns how long each phase of the last update took, in the order they ran. It's only called
+	// once the update has returned.
+	UpdatePhases() []UpdatePhase
+}
+
+// UpdatePhase is how long a phase of an update took.
+type UpdatePhase struct {
+	Name     string
+	Duration time.Duration
+}
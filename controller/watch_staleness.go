@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// staleWatches returns an error naming each watched resource with no list or watch event within staleAfter of now.
+// Kubernetes ends watches every few minutes, and they're re-established with a new watch or list, so a healthy but
+// quiet resource still shows activity.
+func staleWatches(activity map[string]time.Time, staleAfter time.Duration, now time.Time) error {
+	var stale []string
+	for resource, last := range activity {
+		if now.Sub(last) > staleAfter {
+			stale = append(stale, fmt.Sprintf("%s (last seen %s ago)", resource, now.Sub(last).Round(time.Second)))
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	sort.Strings(stale)
+	return fmt.Errorf("watches may have stopped, nothing received for more than %v from: %s", staleAfter,
+		strings.Join(stale, ", "))
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentWatchesAreNotStale(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	activity := map[string]time.Time{
+		"ingresses": now.Add(-time.Minute),
+		"services":  now.Add(-9 * time.Minute),
+	}
+
+	assert.NoError(t, staleWatches(activity, 10*time.Minute, now))
+	assert.NoError(t, staleWatches(map[string]time.Time{}, 10*time.Minute, now))
+}
+
+func TestWatchesWithoutActivityAreStale(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	activity := map[string]time.Time{
+		"services":   now.Add(-time.Hour),
+		"ingresses":  now.Add(-11 * time.Minute),
+		"namespaces": now.Add(-time.Minute),
+	}
+
+	assert.EqualError(t, staleWatches(activity, 10*time.Minute, now),
+		"watches may have stopped, nothing received for more than 10m0s from: "+
+			"ingresses (last seen 11m0s ago), services (last seen 1h0m0s ago)")
+}
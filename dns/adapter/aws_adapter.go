@@ -29,6 +29,8 @@ type AWSAdapterConfig struct {
 	ALBClient     ALB
 	ELBClient     elb.ELB
 	ELBFinder     FindELBsFunc
+	// IngressClass limits the ELBs found to those tagged with it, as feed-ingress does. Leave blank for any ELB.
+	IngressClass string
 }
 
 type awsAdapter struct {
@@ -52,6 +54,11 @@ func NewAWSAdapter(config *AWSAdapterConfig) (FrontendAdapter, error) {
 		config.ELBClient = awselb.New(awsSession)
 	}
 
+	if config.ELBFinder == nil && config.IngressClass != "" {
+		config.ELBFinder = func(e elb.ELB, labelValue string) (map[string]elb.LoadBalancerDetails, error) {
+			return elb.FindFrontEndElbsWithIngressClassName(e, labelValue, config.IngressClass)
+		}
+	}
 	if config.ELBFinder == nil {
 		config.ELBFinder = elb.FindFrontEndElbs
 	}
@@ -0,0 +1,68 @@
+package adapter
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+type staticAddressAdapter struct {
+	addressesWithScheme map[string]string
+	ttl                 *int64
+}
+
+// NewStaticAddressAdapter creates a FrontendAdapter which interacts with load balancers accessed by static IP
+// addresses, such as merlin or gorb virtual IPs. It manages A records pointing directly at the addresses.
+func NewStaticAddressAdapter(addressesWithScheme map[string]string, ttl time.Duration) FrontendAdapter {
+	return &staticAddressAdapter{addressesWithScheme, aws.Int64(int64(ttl.Seconds()))}
+}
+
+func (s *staticAddressAdapter) Initialise() (map[string]DNSDetails, error) {
+	schemeToFrontendMap := make(map[string]DNSDetails)
+	for scheme, address := range s.addressesWithScheme {
+		schemeToFrontendMap[scheme] = DNSDetails{DNSName: address}
+	}
+
+	return schemeToFrontendMap, nil
+}
+
+func (s *staticAddressAdapter) CreateChange(action string, host string, details DNSDetails,
+	recordExists bool, existingRecord *ConsolidatedRecord) *route53.Change {
+
+	if recordExists && existingRecord.TTL != *s.ttl || !recordExists || action == "DELETE" {
+		rrs := &route53.ResourceRecordSet{
+			Name: aws.String(host),
+			Type: aws.String(route53.RRTypeA),
+			TTL:  s.ttl,
+			ResourceRecords: []*route53.ResourceRecord{
+				{
+					Value: aws.String(details.DNSName),
+				},
+			},
+		}
+
+		return &route53.Change{
+			Action:            aws.String(action),
+			ResourceRecordSet: rrs,
+		}
+	}
+
+	return nil
+}
+
+// IsManaged returns true for A records of a single address. Alias A records, such as those to ELBs, aren't managed.
+func (s *staticAddressAdapter) IsManaged(rrs *route53.ResourceRecordSet) (*ConsolidatedRecord, bool) {
+	if *rrs.Type == route53.RRTypeA && rrs.AliasTarget == nil && len(rrs.ResourceRecords) == 1 {
+		record := ConsolidatedRecord{
+			Name:     *rrs.Name,
+			PointsTo: *rrs.ResourceRecords[0].Value,
+		}
+		if rrs.TTL != nil {
+			record.TTL = *rrs.TTL
+		}
+		return &record, true
+	}
+
+	return nil, false
+}
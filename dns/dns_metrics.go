@@ -7,20 +7,53 @@ import (
 	"github.com/sky-uk/feed/util/metrics"
 )
 
+// Reasons for skipping an ingress entry, used as the reason label of skippedEntries.
+const (
+	skipOutsideZone       = "outside_zone"
+	skipConflictingScheme = "conflicting_scheme"
+	skipUnknownScheme     = "unknown_scheme"
+)
+
+var skipReasons = []string{skipOutsideZone, skipConflictingScheme, skipUnknownScheme}
+
+// Route53 requests, used as the request label of requestFailures.
+const (
+	listRecordsRequest   = "ListResourceRecordSets"
+	changeRecordsRequest = "ChangeResourceRecordSets"
+)
+
 var once sync.Once
-var recordsGauge prometheus.Gauge
 var updateCount, failedCount, skippedCount prometheus.Counter
+var appliedChanges, requestFailures *prometheus.CounterVec
+var recordsGauge, unmanagedRecordsGauge, lastUpdateGauge, skippedEntries *prometheus.GaugeVec
 
 func initMetrics() {
 	once.Do(func() {
-		recordsGauge = metrics.RegisterNewDefaultGauge(metrics.PrometheusDNSSubsystem,
-			"route53_records", "The current number of records.")
+		recordsGauge = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusDNSSubsystem,
+			"route53_records", "The current number of records, by hosted zone.", []string{"hosted_zone"})
+		unmanagedRecordsGauge = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusDNSSubsystem,
+			"route53_unmanaged_records",
+			"The current number of records in the hosted zone which point somewhere other than feed's frontends, "+
+				"so are owned by others and left untouched.", []string{"hosted_zone"})
+		lastUpdateGauge = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusDNSSubsystem,
+			"route53_last_update_timestamp_seconds", "The time of the last successful update of each hosted zone.",
+			[]string{"hosted_zone"})
 		updateCount = metrics.RegisterNewDefaultCounter(metrics.PrometheusDNSSubsystem,
 			"route53_updates", "The number of record updates to Route53.")
 		failedCount = metrics.RegisterNewDefaultCounter(metrics.PrometheusDNSSubsystem,
 			"route53_failures", "The number of failed updates to route53.")
+		appliedChanges = metrics.RegisterNewDefaultCounterVec(metrics.PrometheusDNSSubsystem,
+			"route53_applied_changes", "The number of record changes successfully applied to Route53, by action.",
+			[]string{"action"})
+		requestFailures = metrics.RegisterNewDefaultCounterVec(metrics.PrometheusDNSSubsystem,
+			"route53_request_failures", "The number of failed requests to Route53, by request.",
+			[]string{"request"})
 		skippedCount = metrics.RegisterNewDefaultCounter(metrics.PrometheusDNSSubsystem,
 			"skipped_ingress_entries",
 			"The number of ingress entries skipped by feed-dns, such as being outside of the Route53 hosted zone.")
+		skippedEntries = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusDNSSubsystem,
+			"current_skipped_ingress_entries",
+			"The number of ingress entries skipped by the last update, by hosted zone and reason.",
+			[]string{"hosted_zone", "reason"})
 	})
 }
@@ -3,7 +3,9 @@ package dns
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/route53"
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/controller"
@@ -15,23 +17,52 @@ type hostToIngress map[string]controller.IngressEntry
 
 type updater struct {
 	r53                 r53.Route53Client
+	hostedZoneID        string
 	schemeToFrontendMap map[string]adapter.DNSDetails
 	domain              string
 	lbAdapter           adapter.FrontendAdapter
+	// privateScheme is the scheme every record points at, whatever the scheme of its ingress, or empty to use it.
+	privateScheme string
+	states        recordStates
+	// reverse manages the PTR records of the frontends' addresses, or is nil if they aren't managed.
+	reverse *reverseZone
 }
 
 // New creates an updater for dns
-func New(hostedZoneID string, lbAdapter adapter.FrontendAdapter, retries int) controller.Updater {
+func New(hostedZoneID string, lbAdapter adapter.FrontendAdapter, backoff r53.Backoff) controller.Updater {
 	initMetrics()
 
 	return &updater{
-		r53:                 r53.New(hostedZoneID, retries),
+		r53:                 r53.New(hostedZoneID, backoff),
+		hostedZoneID:        hostedZoneID,
 		lbAdapter:           lbAdapter,
 		schemeToFrontendMap: make(map[string]adapter.DNSDetails),
 	}
 }
 
+// NewPrivate creates an updater for a private hosted zone, whose records all point at the frontend of the scheme,
+// such as internal, whatever the scheme of their ingress. Used alongside an updater of the public zone, so hosts
+// are reached through the internal frontend from inside the network.
+func NewPrivate(hostedZoneID string, scheme string, lbAdapter adapter.FrontendAdapter,
+	backoff r53.Backoff) controller.Updater {
+	u := New(hostedZoneID, lbAdapter, backoff).(*updater)
+	u.privateScheme = scheme
+	return u
+}
+
+// NewWithReverseZone creates an updater which also points the PTR records of the frontends' addresses in the reverse
+// hosted zone at their hosts. The frontends must be reached by static IPv4 addresses.
+func NewWithReverseZone(hostedZoneID, reverseHostedZoneID string, lbAdapter adapter.FrontendAdapter,
+	ttl time.Duration, backoff r53.Backoff) controller.Updater {
+	u := New(hostedZoneID, lbAdapter, backoff).(*updater)
+	u.reverse = newReverseZone(reverseHostedZoneID, hostedZoneID, ttl, backoff)
+	return u
+}
+
 func (u *updater) String() string {
+	if u.privateScheme != "" {
+		return "route53 private zone updater"
+	}
 	return "route53 updater"
 }
 
@@ -43,6 +74,9 @@ func (u *updater) Start() error {
 		return err
 	}
 	u.schemeToFrontendMap = schemeToFrontendMap
+	if _, ok := schemeToFrontendMap[u.privateScheme]; u.privateScheme != "" && !ok {
+		return fmt.Errorf("no %s frontend for the private hosted zone %s", u.privateScheme, u.hostedZoneID)
+	}
 
 	domain, err := u.r53.GetHostedZoneDomain()
 	if err != nil {
@@ -50,6 +84,12 @@ func (u *updater) Start() error {
 	}
 	u.domain = domain
 
+	if u.reverse != nil {
+		if err := u.reverse.start(schemeToFrontendMap); err != nil {
+			return err
+		}
+	}
+
 	log.Info("Dns updater started")
 	return nil
 }
@@ -66,11 +106,18 @@ func (u *updater) Readiness() error {
 	return nil
 }
 
+// ZoneStatus returns the state of the records managed in the hosted zone.
+func (u *updater) ZoneStatus() ZoneStatus {
+	return u.states.status(u.hostedZoneID)
+}
+
 func (u *updater) Update(entries controller.IngressEntries) error {
 	route53Records, err := u.r53.GetRecords()
 	if err != nil {
 		log.Warn("Unable to get records from Route53. Not updating Route53.", err)
 		failedCount.Inc()
+		requestFailures.WithLabelValues(listRecordsRequest).Inc()
+		u.states.failed(err)
 		return err
 	}
 
@@ -78,18 +125,33 @@ func (u *updater) Update(entries controller.IngressEntries) error {
 	records := u.consolidateRecordsFromRoute53(route53Records)
 
 	records = u.determineManagedRecordSets(records)
-	recordsGauge.Set(float64(len(records)))
+	recordsGauge.WithLabelValues(u.hostedZoneID).Set(float64(len(records)))
+	u.states.listed(u.domain, records)
 
-	changes := u.calculateChanges(records, entries)
+	changes, hosts := u.calculateChanges(records, entries)
+	u.states.changing(changes)
 
 	updateCount.Add(float64(len(changes)))
 
 	err = u.r53.UpdateRecordSets(changes)
+	u.states.applied(err, time.Now())
 	if err != nil {
 		failedCount.Inc()
+		requestFailures.WithLabelValues(changeRecordsRequest).Inc()
 		return fmt.Errorf("unable to update record sets: %v", err)
 	}
 
+	for _, change := range changes {
+		appliedChanges.WithLabelValues(aws.StringValue(change.Action)).Inc()
+	}
+	lastUpdateGauge.WithLabelValues(u.hostedZoneID).SetToCurrentTime()
+
+	if u.reverse != nil {
+		if err := u.reverse.update(u.schemeToFrontendMap, hosts); err != nil {
+			failedCount.Inc()
+			return fmt.Errorf("unable to update PTR records: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -120,6 +182,7 @@ func (u *updater) determineManagedRecordSets(rrs []adapter.ConsolidatedRecord) [
 		}
 	}
 
+	unmanagedRecordsGauge.WithLabelValues(u.hostedZoneID).Set(float64(len(nonManaged)))
 	if len(nonManaged) > 0 {
 		log.Infof("Filtered %d non-managed resource record sets: %v", len(nonManaged), nonManaged)
 	}
@@ -128,12 +191,16 @@ func (u *updater) determineManagedRecordSets(rrs []adapter.ConsolidatedRecord) [
 }
 
 func (u *updater) calculateChanges(originalRecords []adapter.ConsolidatedRecord,
-	entries controller.IngressEntries) []*route53.Change {
+	entries controller.IngressEntries) ([]*route53.Change, hostToIngress) {
 
 	log.Infof("Current %s records: %d", u.domain, len(originalRecords))
 	log.Debugf("Current %s record set: %v", u.domain, originalRecords)
 	log.Debug("Processing ingress update: ", entries)
 
+	for _, reason := range skipReasons {
+		skippedEntries.WithLabelValues(u.hostedZoneID, reason).Set(0)
+	}
+
 	hostToIngress, skipped := u.indexByHost(entries)
 	changes, skipped2 := u.createChanges(hostToIngress, originalRecords)
 
@@ -146,7 +213,7 @@ func (u *updater) calculateChanges(originalRecords []adapter.ConsolidatedRecord,
 
 	log.Debug("Host to ingress entry: ", hostToIngress)
 	log.Infof("Calculated changes to dns: %v", changes)
-	return changes
+	return changes, hostToIngress
 }
 
 func (u *updater) indexByHost(entries []controller.IngressEntry) (hostToIngress, []string) {
@@ -155,6 +222,9 @@ func (u *updater) indexByHost(entries []controller.IngressEntry) (hostToIngress,
 
 	for _, entry := range entries {
 		log.Debugf("Processing entry %v", entry)
+		if u.privateScheme != "" {
+			entry.LbScheme = u.privateScheme
+		}
 		// Ingress entries in k8s aren't allowed to have the . on the end.
 		// AWS adds it regardless of whether you specify it.
 		hostNameWithPeriod := entry.Host + "."
@@ -163,6 +233,7 @@ func (u *updater) indexByHost(entries []controller.IngressEntry) (hostToIngress,
 		if !strings.HasSuffix(hostNameWithPeriod, "."+u.domain) {
 			skipped = append(skipped, entry.NamespaceName()+":host:"+hostNameWithPeriod)
 			skippedCount.Inc()
+			skippedEntries.WithLabelValues(u.hostedZoneID, skipOutsideZone).Inc()
 			continue
 		}
 
@@ -170,6 +241,7 @@ func (u *updater) indexByHost(entries []controller.IngressEntry) (hostToIngress,
 			if previous.LbScheme != entry.LbScheme {
 				skipped = append(skipped, entry.NamespaceName()+":conflicting-scheme:"+entry.LbScheme)
 				skippedCount.Inc()
+				skippedEntries.WithLabelValues(u.hostedZoneID, skipConflictingScheme).Inc()
 			}
 		} else {
 			mapping[hostNameWithPeriod] = entry
@@ -195,6 +267,7 @@ func (u *updater) createChanges(hostToIngress hostToIngress,
 		if !exists {
 			skipped = append(skipped, entry.NamespaceName()+":scheme:"+entry.LbScheme)
 			skippedCount.Inc()
+			skippedEntries.WithLabelValues(u.hostedZoneID, skipUnknownScheme).Inc()
 			continue
 		}
 
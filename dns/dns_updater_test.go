@@ -11,8 +11,10 @@ import (
 	awsalb "github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
 	"github.com/sky-uk/feed/elb"
 	"github.com/sky-uk/feed/util/metrics"
 	"github.com/stretchr/testify/assert"
@@ -166,7 +168,7 @@ func setupForELB(albNames []string, elbLabelValue string) (*updater, *mockR53Cli
 		ELBFinder:     mockELB.FindFrontEndElbs,
 	}
 	lbAdapter, _ := adapter.NewAWSAdapter(&config)
-	dnsUpdater := New(hostedZoneID, lbAdapter, 1).(*updater)
+	dnsUpdater := New(hostedZoneID, lbAdapter, r53.Backoff{Retries: 1}).(*updater)
 
 	mockR53 := &mockR53Client{}
 	dnsUpdater.r53 = mockR53
@@ -176,7 +178,7 @@ func setupForELB(albNames []string, elbLabelValue string) (*updater, *mockR53Cli
 func setupForExplicitAddresses(definedFrontends map[string]string) (*updater, *mockR53Client) {
 	lbAdapter := adapter.NewStaticHostnameAdapter(definedFrontends, 5*time.Minute)
 
-	dnsUpdater := New(hostedZoneID, lbAdapter, 1).(*updater)
+	dnsUpdater := New(hostedZoneID, lbAdapter, r53.Backoff{Retries: 1}).(*updater)
 	mockR53 := &mockR53Client{}
 	dnsUpdater.r53 = mockR53
 	return dnsUpdater, mockR53
@@ -249,6 +251,8 @@ func TestUpdateRecordSetFail(t *testing.T) {
 	ingressUpdate := []controller.IngressEntry{{Host: "verification.james.com", LbScheme: internalScheme}}
 
 	mockR53.On("UpdateRecordSets", mock.Anything).Return(errors.New("no updates for you"))
+	failuresBefore := testutil.ToFloat64(requestFailures.WithLabelValues(changeRecordsRequest))
+	upsertsBefore := testutil.ToFloat64(appliedChanges.WithLabelValues("UPSERT"))
 
 	// when
 	assert.NoError(t, dnsUpdater.Start())
@@ -256,6 +260,55 @@ func TestUpdateRecordSetFail(t *testing.T) {
 
 	//then
 	assert.Error(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(requestFailures.WithLabelValues(changeRecordsRequest))-failuresBefore)
+	assert.Equal(t, upsertsBefore, testutil.ToFloat64(appliedChanges.WithLabelValues("UPSERT")))
+}
+
+func TestUpdateMetrics(t *testing.T) {
+	// given
+	dnsUpdater, mockR53, _, mockALB := setupForELB(albNames, "")
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		{
+			Name: aws.String("old.james.com."),
+			Type: aws.String(route53.RRTypeA),
+			AliasTarget: &route53.AliasTarget{
+				DNSName:      aws.String(internalALBDnsNameWithPeriod),
+				HostedZoneId: aws.String(lbHostedZoneID),
+			},
+		},
+		{
+			Name: aws.String("others.james.com."),
+			Type: aws.String(route53.RRTypeA),
+			AliasTarget: &route53.AliasTarget{
+				DNSName:      aws.String(unassocALBDnsNameWithPeriod),
+				HostedZoneId: aws.String(lbHostedZoneID),
+			},
+		},
+	}, nil)
+	mockALB.mockDescribeLoadBalancers(albNames, lbDetails, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+	upsertsBefore := testutil.ToFloat64(appliedChanges.WithLabelValues("UPSERT"))
+	deletesBefore := testutil.ToFloat64(appliedChanges.WithLabelValues("DELETE"))
+
+	ingressUpdate := []controller.IngressEntry{
+		{Host: "new.james.com", LbScheme: internalScheme},
+		{Host: "elsewhere.com", LbScheme: internalScheme},
+		{Host: "unknown.james.com", LbScheme: "unknown"},
+	}
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	assert.NoError(t, dnsUpdater.Update(ingressUpdate))
+
+	// then
+	assert.Equal(t, 1.0, testutil.ToFloat64(recordsGauge.WithLabelValues(hostedZoneID)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(unmanagedRecordsGauge.WithLabelValues(hostedZoneID)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(appliedChanges.WithLabelValues("UPSERT"))-upsertsBefore)
+	assert.Equal(t, 1.0, testutil.ToFloat64(appliedChanges.WithLabelValues("DELETE"))-deletesBefore)
+	assert.Equal(t, 1.0, testutil.ToFloat64(skippedEntries.WithLabelValues(hostedZoneID, skipOutsideZone)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(skippedEntries.WithLabelValues(hostedZoneID, skipUnknownScheme)))
+	assert.NotZero(t, testutil.ToFloat64(lastUpdateGauge.WithLabelValues(hostedZoneID)))
 }
 
 func TestRecordSetUpdates(t *testing.T) {
@@ -946,3 +999,219 @@ func TestRecordSetUpdatesWithAddressArguments(t *testing.T) {
 		}
 	}
 }
+
+func TestPrivateZoneRecordsPointAtTheInternalFrontend(t *testing.T) {
+	// given
+	ttl := aws.Int64(300)
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{
+		internalScheme: internalAddressArgument,
+		externalScheme: externalAddressArgument,
+	}, 5*time.Minute)
+	dnsUpdater := NewPrivate(hostedZoneID, internalScheme, lbAdapter, r53.Backoff{Retries: 1}).(*updater)
+	mockR53 := &mockR53Client{}
+	dnsUpdater.r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords(nil, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{{
+		Action: aws.String("UPSERT"),
+		ResourceRecordSet: &route53.ResourceRecordSet{
+			Name:            aws.String("foo.james.com."),
+			Type:            aws.String(route53.RRTypeCname),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(internalAddressArgument)}},
+			TTL:             ttl,
+		},
+	}}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update([]controller.IngressEntry{{Host: "foo.james.com", LbScheme: externalScheme}})
+
+	// then
+	assert.NoError(t, err)
+	mockR53.AssertExpectations(t)
+}
+
+func TestPrivateZoneNeedsAFrontendForItsScheme(t *testing.T) {
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{externalScheme: externalAddressArgument},
+		5*time.Minute)
+	dnsUpdater := NewPrivate(hostedZoneID, internalScheme, lbAdapter, r53.Backoff{Retries: 1})
+
+	assert.EqualError(t, dnsUpdater.Start(), "no internal frontend for the private hosted zone "+hostedZoneID)
+}
+
+func TestRecordSetUpdatesWithStaticAddresses(t *testing.T) {
+	// given
+	ttl := aws.Int64(300)
+	lbAdapter := adapter.NewStaticAddressAdapter(map[string]string{
+		internalScheme: "10.0.0.1",
+		externalScheme: "192.0.2.1",
+	}, 5*time.Minute)
+	dnsUpdater := New(hostedZoneID, lbAdapter, r53.Backoff{Retries: 1}).(*updater)
+	mockR53 := &mockR53Client{}
+	dnsUpdater.r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords([]*route53.ResourceRecordSet{
+		{
+			Name:            aws.String("old.james.com."),
+			Type:            aws.String(route53.RRTypeA),
+			ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}},
+			TTL:             ttl,
+		},
+		{
+			Name: aws.String("alias.james.com."),
+			Type: aws.String(route53.RRTypeA),
+			AliasTarget: &route53.AliasTarget{
+				DNSName:      aws.String(internalALBDnsNameWithPeriod),
+				HostedZoneId: aws.String(lbHostedZoneID),
+			},
+		},
+	}, nil)
+	mockR53.On("UpdateRecordSets", []*route53.Change{
+		{
+			Action: aws.String("UPSERT"),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name:            aws.String("foo.james.com."),
+				Type:            aws.String(route53.RRTypeA),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("192.0.2.1")}},
+				TTL:             ttl,
+			},
+		},
+		{
+			Action: aws.String("DELETE"),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name:            aws.String("old.james.com."),
+				Type:            aws.String(route53.RRTypeA),
+				ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("10.0.0.1")}},
+				TTL:             ttl,
+			},
+		},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update([]controller.IngressEntry{{Host: "foo.james.com", LbScheme: externalScheme}})
+
+	// then
+	assert.NoError(t, err)
+	mockR53.AssertExpectations(t)
+}
+
+func setupForReverseZone(frontends map[string]string) (*updater, *mockR53Client, *mockR53Client) {
+	lbAdapter := adapter.NewStaticAddressAdapter(frontends, 5*time.Minute)
+	dnsUpdater := NewWithReverseZone(hostedZoneID, "5678", lbAdapter, 5*time.Minute,
+		r53.Backoff{Retries: 1}).(*updater)
+	mockR53 := &mockR53Client{}
+	dnsUpdater.r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+	mockR53.mockGetRecords(nil, nil)
+	mockR53.On("UpdateRecordSets", mock.Anything).Return(nil)
+	reverseR53 := &mockR53Client{}
+	dnsUpdater.reverse.r53 = reverseR53
+	reverseR53.On("GetHostedZoneDomain").Return("10.in-addr.arpa.", nil)
+	return dnsUpdater, mockR53, reverseR53
+}
+
+func TestPTRRecordsOfFrontendAddressesAreOwnedThroughTXTRecords(t *testing.T) {
+	// given
+	ttl := aws.Int64(300)
+	owner := []*route53.ResourceRecord{{Value: aws.String(`"heritage=feed-dns,hosted-zone=1234"`)}}
+	dnsUpdater, _, reverseR53 := setupForReverseZone(map[string]string{
+		internalScheme: "10.0.0.1",
+		externalScheme: "192.0.2.1",
+	})
+	stalePTR := &route53.ResourceRecordSet{
+		Name:            aws.String("9.0.0.10.in-addr.arpa."),
+		Type:            aws.String(route53.RRTypePtr),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("old.james.com.")}},
+		TTL:             ttl,
+	}
+	staleTXT := &route53.ResourceRecordSet{
+		Name:            aws.String("9.0.0.10.in-addr.arpa."),
+		Type:            aws.String(route53.RRTypeTxt),
+		ResourceRecords: owner,
+		TTL:             ttl,
+	}
+	reverseR53.mockGetRecords([]*route53.ResourceRecordSet{stalePTR, staleTXT}, nil)
+	reverseR53.On("UpdateRecordSets", []*route53.Change{
+		{
+			Action: aws.String("UPSERT"),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name: aws.String("1.0.0.10.in-addr.arpa."),
+				Type: aws.String(route53.RRTypePtr),
+				ResourceRecords: []*route53.ResourceRecord{
+					{Value: aws.String("bar.james.com.")},
+					{Value: aws.String("foo.james.com.")},
+				},
+				TTL: ttl,
+			},
+		},
+		{
+			Action: aws.String("UPSERT"),
+			ResourceRecordSet: &route53.ResourceRecordSet{
+				Name:            aws.String("1.0.0.10.in-addr.arpa."),
+				Type:            aws.String(route53.RRTypeTxt),
+				ResourceRecords: owner,
+				TTL:             ttl,
+			},
+		},
+		{Action: aws.String("DELETE"), ResourceRecordSet: stalePTR},
+		{Action: aws.String("DELETE"), ResourceRecordSet: staleTXT},
+	}).Return(nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update([]controller.IngressEntry{
+		{Host: "foo.james.com", LbScheme: internalScheme},
+		{Host: "bar.james.com", LbScheme: internalScheme},
+		{Host: "baz.james.com", LbScheme: externalScheme},
+	})
+
+	// then
+	assert.NoError(t, err)
+	reverseR53.AssertExpectations(t)
+}
+
+func TestPTRRecordsWithoutAnOwnerAreLeftAlone(t *testing.T) {
+	// given
+	dnsUpdater, _, reverseR53 := setupForReverseZone(map[string]string{internalScheme: "10.0.0.1"})
+	reverseR53.mockGetRecords([]*route53.ResourceRecordSet{{
+		Name:            aws.String("1.0.0.10.in-addr.arpa."),
+		Type:            aws.String(route53.RRTypePtr),
+		ResourceRecords: []*route53.ResourceRecord{{Value: aws.String("someone.else.com.")}},
+		TTL:             aws.Int64(300),
+	}}, nil)
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update([]controller.IngressEntry{{Host: "foo.james.com", LbScheme: internalScheme}})
+
+	// then
+	assert.NoError(t, err)
+	reverseR53.AssertNotCalled(t, "UpdateRecordSets", mock.Anything)
+}
+
+func TestPTRRecordsFailToUpdate(t *testing.T) {
+	// given
+	dnsUpdater, _, reverseR53 := setupForReverseZone(map[string]string{internalScheme: "10.0.0.1"})
+	reverseR53.mockGetRecords(nil, nil)
+	reverseR53.On("UpdateRecordSets", mock.Anything).Return(errors.New("doh"))
+
+	// when
+	assert.NoError(t, dnsUpdater.Start())
+	err := dnsUpdater.Update([]controller.IngressEntry{{Host: "foo.james.com", LbScheme: internalScheme}})
+
+	// then
+	assert.EqualError(t, err, "unable to update PTR records: doh")
+}
+
+func TestPTRRecordsNeedTheAddressesOfTheFrontends(t *testing.T) {
+	lbAdapter := adapter.NewStaticHostnameAdapter(map[string]string{internalScheme: internalAddressArgument},
+		5*time.Minute)
+	dnsUpdater := NewWithReverseZone(hostedZoneID, "5678", lbAdapter, 5*time.Minute, r53.Backoff{Retries: 1}).(*updater)
+	mockR53 := &mockR53Client{}
+	dnsUpdater.r53 = mockR53
+	mockR53.mockGetHostedZoneDomain()
+
+	assert.EqualError(t, dnsUpdater.Start(),
+		"PTR records need the IPv4 address of each frontend, but the internal frontend is "+internalAddressArgument)
+}
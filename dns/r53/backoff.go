@@ -0,0 +1,79 @@
+package r53
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const (
+	// DefaultRetryBaseDelay is the default longest wait before the first retry.
+	DefaultRetryBaseDelay = 200 * time.Millisecond
+	// DefaultRetryMaxDelay is the default longest wait before any retry.
+	DefaultRetryMaxDelay = 30 * time.Second
+)
+
+// Kinds of failed call, used as the error label of callErrors.
+const (
+	throttledError = "throttled"
+	transientError = "transient"
+	fatalError     = "fatal"
+)
+
+// Backoff configures how failed calls to Route53 are retried. Each retry waits for a random time up to an
+// exponentially increasing limit, so clients which were throttled together don't retry together.
+type Backoff struct {
+	// Retries is how many times a failed call is retried.
+	Retries int
+	// BaseDelay is the longest wait before the first retry, which doubles for each retry after it.
+	BaseDelay time.Duration
+	// MaxDelay is the longest wait before any retry.
+	MaxDelay time.Duration
+}
+
+// limit returns the longest wait before the retry, counting from 0.
+func (b Backoff) limit(retry int) time.Duration {
+	base, max := b.BaseDelay, b.MaxDelay
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxDelay
+	}
+	limit := base
+	for i := 0; i < retry && limit < max; i++ {
+		limit *= 2
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit
+}
+
+// delay returns a random wait before the retry, up to its limit.
+func (b Backoff) delay(retry int, random *rand.Rand) time.Duration {
+	return time.Duration(random.Int63n(int64(b.limit(retry)) + 1))
+}
+
+// classifyError returns whether the error was throttling, such as a 429 or Throttling response, a transient error
+// worth retrying, or a fatal error such as an invalid change batch.
+func classifyError(err error) string {
+	if request.IsErrorThrottle(err) {
+		return throttledError
+	}
+	if failure, ok := err.(awserr.RequestFailure); ok {
+		switch {
+		case failure.StatusCode() == http.StatusTooManyRequests:
+			return throttledError
+		case failure.StatusCode() >= http.StatusInternalServerError:
+			return transientError
+		}
+	}
+	if request.IsErrorRetryable(err) {
+		return transientError
+	}
+	return fatalError
+}
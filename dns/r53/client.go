@@ -2,11 +2,17 @@ package r53
 
 import (
 	"fmt"
+	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/util"
+	"github.com/sky-uk/feed/util/metrics"
 )
 
 const maxRecordChanges = 100
@@ -25,28 +31,90 @@ type r53 interface {
 	ListResourceRecordSets(input *route53.ListResourceRecordSetsInput) (*route53.ListResourceRecordSetsOutput, error)
 }
 
+var once sync.Once
+var callDuration *prometheus.HistogramVec
+var callErrors *prometheus.CounterVec
+
+func initMetrics() {
+	once.Do(func() {
+		callDuration = metrics.RegisterNewDefaultHistogramVec(metrics.PrometheusDNSSubsystem,
+			"route53_call_duration_seconds", "How long each call to the Route53 API takes, in seconds, by call.",
+			nil, []string{"call"})
+		callErrors = metrics.RegisterNewDefaultCounterVec(metrics.PrometheusDNSSubsystem,
+			"route53_call_errors",
+			"The number of failed calls to the Route53 API, including those retried, by call and error: "+
+				"throttled, transient or fatal.",
+			[]string{"call", "error"})
+	})
+}
+
 // Route53Client enables interaction with aws route53
 type client struct {
 	r53              r53
 	hostedZone       string
 	maxRecordChanges int
+	backoff          Backoff
+	random           *rand.Rand
+	sleep            func(time.Duration)
+	// recordTypes are the types of record listed by GetRecords
+	recordTypes map[string]bool
 }
 
-// New creates a route53 client used to interact with aws
-func New(hostedZone string, retries int) Route53Client {
-	config := aws.Config{MaxRetries: aws.Int(retries)}
+// New creates a route53 client used to interact with aws. Failed calls are retried with the backoff, rather than
+// by the aws sdk.
+func New(hostedZone string, backoff Backoff) Route53Client {
+	initMetrics()
+	config := aws.Config{MaxRetries: aws.Int(0)}
 	awsSession, _ := session.NewSession()
 	return &client{
 		r53:              route53.New(awsSession, &config),
 		hostedZone:       hostedZone,
 		maxRecordChanges: maxRecordChanges,
+		backoff:          backoff,
+		random:           rand.New(rand.NewSource(time.Now().UnixNano())),
+		sleep:            time.Sleep,
+		recordTypes:      map[string]bool{route53.RRTypeA: true, route53.RRTypeCname: true},
+	}
+}
+
+// NewReverse creates a route53 client for a reverse hosted zone, such as 10.in-addr.arpa, which lists its PTR
+// records and the TXT records marking their owners.
+func NewReverse(hostedZone string, backoff Backoff) Route53Client {
+	c := New(hostedZone, backoff).(*client)
+	c.recordTypes = map[string]bool{route53.RRTypePtr: true, route53.RRTypeTxt: true}
+	return c
+}
+
+// call makes the call to the Route53 API, retrying it with backoff while it fails with throttling or a transient
+// error.
+func (dns *client) call(name string, f func() error) error {
+	for retry := 0; ; retry++ {
+		start := time.Now()
+		err := f()
+		callDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		if err == nil {
+			return nil
+		}
+
+		kind := classifyError(err)
+		callErrors.WithLabelValues(name, kind).Inc()
+		if kind == fatalError || retry >= dns.backoff.Retries {
+			return err
+		}
+		delay := dns.backoff.delay(retry, dns.random)
+		log.Warnf("Route53 %s failed with a %s error, retrying in %v: %v", name, kind, delay, err)
+		dns.sleep(delay)
 	}
 }
 
 // GetHostedZoneDomain gets the domain for the hosted zone
 func (dns *client) GetHostedZoneDomain() (string, error) {
 	input := &route53.GetHostedZoneInput{Id: aws.String(dns.hostedZone)}
-	hostedZone, err := dns.r53.GetHostedZone(input)
+	var hostedZone *route53.GetHostedZoneOutput
+	err := dns.call("GetHostedZone", func() (err error) {
+		hostedZone, err = dns.r53.GetHostedZone(input)
+		return err
+	})
 	if err != nil {
 		return "", fmt.Errorf("unable to get Hosted Zone Info: %v", err)
 	}
@@ -65,7 +133,10 @@ func (dns *client) UpdateRecordSets(changes []*route53.Change) error {
 			},
 		}
 
-		_, err := dns.r53.ChangeResourceRecordSets(recordSetsInput)
+		err := dns.call("ChangeResourceRecordSets", func() error {
+			_, err := dns.r53.ChangeResourceRecordSets(recordSetsInput)
+			return err
+		})
 
 		if err != nil {
 			return fmt.Errorf("failed to create A record: %v", err)
@@ -75,14 +146,18 @@ func (dns *client) UpdateRecordSets(changes []*route53.Change) error {
 	return nil
 }
 
-// GetRecords gets a list of DNS records from aws.
+// GetRecords gets a list of the DNS records of the client's record types from aws.
 func (dns *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
 	var records []*route53.ResourceRecordSet
 	request := &route53.ListResourceRecordSetsInput{
 		HostedZoneId: aws.String(dns.hostedZone),
 	}
 	for {
-		recordSetsOutput, err := dns.r53.ListResourceRecordSets(request)
+		var recordSetsOutput *route53.ListResourceRecordSetsOutput
+		err := dns.call("ListResourceRecordSets", func() (err error) {
+			recordSetsOutput, err = dns.r53.ListResourceRecordSets(request)
+			return err
+		})
 
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch A records: %v", err)
@@ -91,7 +166,7 @@ func (dns *client) GetRecords() ([]*route53.ResourceRecordSet, error) {
 		recordSets := recordSetsOutput.ResourceRecordSets
 
 		for _, recordSet := range recordSets {
-			if *recordSet.Type == route53.RRTypeA || *recordSet.Type == route53.RRTypeCname {
+			if dns.recordTypes[*recordSet.Type] {
 				records = append(records, recordSet)
 			}
 		}
@@ -3,13 +3,22 @@ package r53
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sky-uk/feed/util/metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
 type fake53 struct {
 	mock.Mock
 }
@@ -121,6 +130,37 @@ func TestGetRecordsFiltersOutNonARecordsAndCNAMERecords(t *testing.T) {
 	assert.Equal(t, acRecords, records)
 }
 
+func TestReverseZoneClientsGetPTRAndTXTRecords(t *testing.T) {
+	// given
+	fake53 := new(fake53)
+	reverse := NewReverse(hostedZone, Backoff{}).(*client)
+	reverse.r53 = fake53
+	ptrRecord := &route53.ResourceRecordSet{
+		Name: aws.String("1.0.0.10.in-addr.arpa."),
+		Type: aws.String("PTR"),
+	}
+	txtRecord := &route53.ResourceRecordSet{
+		Name: aws.String("1.0.0.10.in-addr.arpa."),
+		Type: aws.String("TXT"),
+	}
+	soaRecord := &route53.ResourceRecordSet{
+		Name: aws.String("10.in-addr.arpa."),
+		Type: aws.String("SOA"),
+	}
+	fake53.On("ListResourceRecordSets", &route53.ListResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZone),
+	}).Return(&route53.ListResourceRecordSetsOutput{
+		ResourceRecordSets: []*route53.ResourceRecordSet{ptrRecord, txtRecord, soaRecord},
+	}, nil)
+
+	// when
+	records, err := reverse.GetRecords()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*route53.ResourceRecordSet{ptrRecord, txtRecord}, records)
+}
+
 func TestGetARecordPages(t *testing.T) {
 	// given
 	client, fake53 := createClient()
@@ -205,8 +245,70 @@ func TestUpdateRecordSetsPartial(t *testing.T) {
 	})
 }
 
+func TestThrottledCallsAreRetriedWithBackoff(t *testing.T) {
+	// given
+	client, fake53 := createClient()
+	client.backoff = Backoff{Retries: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+	var delays []time.Duration
+	client.sleep = func(d time.Duration) { delays = append(delays, d) }
+	throttled := awserr.NewRequestFailure(awserr.New("Throttling", "Rate exceeded", nil), 400, "")
+	tooMany := awserr.NewRequestFailure(awserr.New("TooManyRequests", "slow down", nil), 429, "")
+	fake53.On("ChangeResourceRecordSets", mock.Anything).Return(nil, throttled).Once()
+	fake53.On("ChangeResourceRecordSets", mock.Anything).Return(nil, tooMany).Once()
+	fake53.On("ChangeResourceRecordSets", mock.Anything).Return(&route53.ChangeResourceRecordSetsOutput{}, nil)
+	throttledBefore := testutil.ToFloat64(callErrors.WithLabelValues("ChangeResourceRecordSets", throttledError))
+
+	// when
+	err := client.UpdateRecordSets([]*route53.Change{{Action: aws.String("UPSERT")}})
+
+	// then
+	assert.NoError(t, err)
+	fake53.AssertNumberOfCalls(t, "ChangeResourceRecordSets", 3)
+	assert.Len(t, delays, 2)
+	assert.True(t, delays[0] <= time.Second, "first delay %v", delays[0])
+	assert.True(t, delays[1] <= 2*time.Second, "second delay %v", delays[1])
+	assert.Equal(t, 2.0,
+		testutil.ToFloat64(callErrors.WithLabelValues("ChangeResourceRecordSets", throttledError))-throttledBefore)
+}
+
+func TestCallsAreNotRetriedPastTheRetries(t *testing.T) {
+	client, fake53 := createClient()
+	client.backoff = Backoff{Retries: 2}
+	fake53.On("ListResourceRecordSets", mock.Anything).Return(nil,
+		awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "unavailable", nil), 503, ""))
+
+	_, err := client.GetRecords()
+
+	assert.Error(t, err)
+	fake53.AssertNumberOfCalls(t, "ListResourceRecordSets", 3)
+}
+
+func TestFatalErrorsAreNotRetried(t *testing.T) {
+	client, fake53 := createClient()
+	client.backoff = Backoff{Retries: 2}
+	fake53.On("ChangeResourceRecordSets", mock.Anything).Return(nil,
+		awserr.NewRequestFailure(awserr.New("InvalidChangeBatch", "record doesn't exist", nil), 400, ""))
+
+	err := client.UpdateRecordSets([]*route53.Change{{Action: aws.String("DELETE")}})
+
+	assert.Error(t, err)
+	fake53.AssertNumberOfCalls(t, "ChangeResourceRecordSets", 1)
+}
+
+func TestBackoffLimitDoublesUpToTheMaxDelay(t *testing.T) {
+	backoff := Backoff{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	assert.Equal(t, time.Second, backoff.limit(0))
+	assert.Equal(t, 2*time.Second, backoff.limit(1))
+	assert.Equal(t, 4*time.Second, backoff.limit(2))
+	assert.Equal(t, 5*time.Second, backoff.limit(3))
+	assert.Equal(t, 5*time.Second, backoff.limit(100))
+	assert.Equal(t, DefaultRetryBaseDelay, Backoff{}.limit(0))
+}
+
 func createClient() (*client, *fake53) {
-	client := New(hostedZone, 1).(*client)
+	client := New(hostedZone, Backoff{Retries: 1}).(*client)
+	client.sleep = func(time.Duration) {}
 	fake53 := new(fake53)
 	client.r53 = fake53
 	return client, fake53
@@ -0,0 +1,213 @@
+package dns
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns/adapter"
+)
+
+// StatusPagePath is where the status of the managed records is served on the health port.
+const StatusPagePath = "/status"
+
+// ZoneStatus is the state of the records managed in a hosted zone, as of the last update.
+type ZoneStatus struct {
+	HostedZone string `json:"hostedZone"`
+	Domain     string `json:"domain"`
+	// LastUpdated is when the zone was last updated successfully, or zero if it hasn't been.
+	LastUpdated time.Time `json:"lastUpdated"`
+	// LastError is why the last update failed, or empty if it succeeded.
+	LastError string         `json:"lastError,omitempty"`
+	Records   []RecordStatus `json:"records"`
+}
+
+// RecordStatus is a managed hostname, what it points at, and any change to it which hasn't been applied.
+type RecordStatus struct {
+	Host string `json:"host"`
+	// Target is what the record points at in Route53, or empty if it doesn't exist yet.
+	Target string `json:"target,omitempty"`
+	// LastChanged is when this feed-dns last changed the record, or zero if it hasn't since it started.
+	LastChanged time.Time `json:"lastChanged"`
+	// Pending is a change which failed to be applied, or is being applied.
+	Pending *PendingChange `json:"pending,omitempty"`
+}
+
+// PendingChange is a change to a record which hasn't been applied.
+type PendingChange struct {
+	Action string `json:"action"`
+	Target string `json:"target"`
+	// Error is why the change failed, or empty if it's being applied.
+	Error string `json:"error,omitempty"`
+}
+
+// StatusReporter is an updater which reports the state of the records it manages.
+type StatusReporter interface {
+	ZoneStatus() ZoneStatus
+}
+
+// recordStates tracks the state of the records managed by an updater, shared with the status page.
+type recordStates struct {
+	sync.Mutex
+	domain      string
+	records     map[string]*RecordStatus
+	lastUpdated time.Time
+	lastError   string
+}
+
+// listed records the targets of the managed records in the domain, as listed from Route53.
+func (s *recordStates) listed(domain string, records []adapter.ConsolidatedRecord) {
+	s.Lock()
+	defer s.Unlock()
+	s.domain = domain
+	current := make(map[string]*RecordStatus)
+	for _, record := range records {
+		state := &RecordStatus{Host: record.Name, Target: record.PointsTo}
+		if previous, ok := s.records[record.Name]; ok {
+			state.LastChanged = previous.LastChanged
+		}
+		current[record.Name] = state
+	}
+	s.records = current
+}
+
+// changing records the changes as pending, until they're applied.
+func (s *recordStates) changing(changes []*route53.Change) {
+	s.Lock()
+	defer s.Unlock()
+	for _, change := range changes {
+		host := aws.StringValue(change.ResourceRecordSet.Name)
+		state, ok := s.records[host]
+		if !ok {
+			state = &RecordStatus{Host: host}
+			s.records[host] = state
+		}
+		state.Pending = &PendingChange{Action: aws.StringValue(change.Action), Target: changeTarget(change)}
+	}
+}
+
+// applied records the pending changes as applied, or failed with the error.
+func (s *recordStates) applied(err error, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	if err != nil {
+		s.lastError = err.Error()
+		for _, state := range s.records {
+			if state.Pending != nil {
+				state.Pending.Error = err.Error()
+			}
+		}
+		return
+	}
+
+	s.lastUpdated = now
+	s.lastError = ""
+	for host, state := range s.records {
+		if state.Pending == nil {
+			continue
+		}
+		if state.Pending.Action == route53.ChangeActionDelete {
+			delete(s.records, host)
+			continue
+		}
+		state.Target = state.Pending.Target
+		state.LastChanged = now
+		state.Pending = nil
+	}
+}
+
+// failed records the error of an update which couldn't list the records.
+func (s *recordStates) failed(err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastError = err.Error()
+}
+
+func (s *recordStates) status(hostedZone string) ZoneStatus {
+	s.Lock()
+	defer s.Unlock()
+	status := ZoneStatus{
+		HostedZone:  hostedZone,
+		Domain:      s.domain,
+		LastUpdated: s.lastUpdated,
+		LastError:   s.lastError,
+		Records:     []RecordStatus{},
+	}
+	for _, state := range s.records {
+		record := *state
+		if state.Pending != nil {
+			pending := *state.Pending
+			record.Pending = &pending
+		}
+		status.Records = append(status.Records, record)
+	}
+	sort.Slice(status.Records, func(i, j int) bool { return status.Records[i].Host < status.Records[j].Host })
+	return status
+}
+
+// changeTarget returns what the record of the change points at.
+func changeTarget(change *route53.Change) string {
+	rrs := change.ResourceRecordSet
+	if rrs.AliasTarget != nil {
+		return aws.StringValue(rrs.AliasTarget.DNSName)
+	}
+	if len(rrs.ResourceRecords) > 0 {
+		return aws.StringValue(rrs.ResourceRecords[0].Value)
+	}
+	return ""
+}
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>feed-dns status</title></head>
+<body>
+<h1>feed-dns status</h1>
+{{- range . }}
+<h2>{{ .Domain }} ({{ .HostedZone }})</h2>
+<p>{{ if .LastUpdated.IsZero }}Not updated yet.{{ else }}{{ len .Records }} records, last updated at {{ .LastUpdated.Format "2006-01-02T15:04:05Z07:00" }}.{{ end }}{{ if .LastError }} The last update failed: {{ .LastError }}{{ end }}</p>
+<table>
+<tr><th>Host</th><th>Target</th><th>Last changed</th><th>Pending</th></tr>
+{{- range .Records }}
+<tr><td>{{ .Host }}</td><td>{{ .Target }}</td><td>{{ if not .LastChanged.IsZero }}{{ .LastChanged.Format "2006-01-02T15:04:05Z07:00" }}{{ end }}</td><td>{{ with .Pending }}{{ .Action }} {{ .Target }}{{ if .Error }} failed: {{ .Error }}{{ end }}{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
+
+// NewStatusPage serves the state of the records managed by the updaters as HTML tables, or as JSON if the client
+// accepts it or the request has ?format=json.
+func NewStatusPage(updaters []controller.Updater) http.Handler {
+	var reporters []StatusReporter
+	for _, u := range updaters {
+		if reporter, ok := u.(StatusReporter); ok {
+			reporters = append(reporters, reporter)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zones := []ZoneStatus{}
+		for _, reporter := range reporters {
+			zones = append(zones, reporter.ZoneStatus())
+		}
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(zones); err != nil {
+				log.Warnf("Unable to write status page: %v", err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusPageTemplate.Execute(w, zones); err != nil {
+			log.Warnf("Unable to write status page: %v", err)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/stretchr/testify/assert"
+)
+
+func aliasChange(action, host, target string) *route53.Change {
+	return &route53.Change{
+		Action: aws.String(action),
+		ResourceRecordSet: &route53.ResourceRecordSet{
+			Name:        aws.String(host),
+			Type:        aws.String(route53.RRTypeA),
+			AliasTarget: &route53.AliasTarget{DNSName: aws.String(target)},
+		},
+	}
+}
+
+func TestRecordStatesTrackAppliedAndFailedChanges(t *testing.T) {
+	var states recordStates
+	first := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	second := first.Add(time.Minute)
+
+	states.listed(domain, []adapter.ConsolidatedRecord{
+		{Name: "old.james.com.", PointsTo: "internal-lb."},
+		{Name: "same.james.com.", PointsTo: "internal-lb."},
+	})
+	states.changing([]*route53.Change{
+		aliasChange("UPSERT", "new.james.com.", "external-lb."),
+		aliasChange("DELETE", "old.james.com.", "internal-lb."),
+	})
+	states.applied(nil, first)
+
+	assert.Equal(t, ZoneStatus{
+		HostedZone:  hostedZoneID,
+		Domain:      domain,
+		LastUpdated: first,
+		Records: []RecordStatus{
+			{Host: "new.james.com.", Target: "external-lb.", LastChanged: first},
+			{Host: "same.james.com.", Target: "internal-lb."},
+		},
+	}, states.status(hostedZoneID))
+
+	states.listed(domain, []adapter.ConsolidatedRecord{
+		{Name: "new.james.com.", PointsTo: "external-lb."},
+		{Name: "same.james.com.", PointsTo: "internal-lb."},
+	})
+	states.changing([]*route53.Change{aliasChange("UPSERT", "same.james.com.", "external-lb.")})
+	states.applied(errors.New("throttled"), second)
+
+	assert.Equal(t, ZoneStatus{
+		HostedZone:  hostedZoneID,
+		Domain:      domain,
+		LastUpdated: first,
+		LastError:   "throttled",
+		Records: []RecordStatus{
+			{Host: "new.james.com.", Target: "external-lb.", LastChanged: first},
+			{Host: "same.james.com.", Target: "internal-lb.",
+				Pending: &PendingChange{Action: "UPSERT", Target: "external-lb.", Error: "throttled"}},
+		},
+	}, states.status(hostedZoneID))
+}
+
+func TestStatusPageIsServedAsHTMLOrJSON(t *testing.T) {
+	dnsUpdater, _ := setupForExplicitAddresses(map[string]string{internalScheme: internalAddressArgument})
+	dnsUpdater.states.listed(domain, []adapter.ConsolidatedRecord{{Name: "foo.james.com.", PointsTo: "<lb>"}})
+	page := NewStatusPage([]controller.Updater{dnsUpdater})
+
+	recorder := httptest.NewRecorder()
+	page.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, StatusPagePath, nil))
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "<h2>james.com. (1234)</h2>")
+	assert.Contains(t, recorder.Body.String(), "<tr><td>foo.james.com.</td><td>&lt;lb&gt;</td><td></td><td></td></tr>")
+
+	recorder = httptest.NewRecorder()
+	page.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, StatusPagePath+"?format=json", nil))
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var served []ZoneStatus
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &served))
+	assert.Equal(t, []ZoneStatus{dnsUpdater.ZoneStatus()}, served)
+}
@@ -0,0 +1,186 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/route53"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
+)
+
+// reverseZone manages the PTR records of the frontends' addresses in a reverse hosted zone, such as
+// 10.in-addr.arpa, so each address resolves back to the hosts pointing at it. A PTR record is only changed or deleted
+// if a TXT record of the same name marks it as owned by the feed-dns of the forward hosted zone, so records made by
+// anything else are left alone.
+type reverseZone struct {
+	r53          r53.Route53Client
+	hostedZoneID string
+	domain       string
+	// owner is the value of the TXT records marking the PTR records owned
+	owner string
+	ttl   int64
+}
+
+func newReverseZone(hostedZoneID, forwardHostedZoneID string, ttl time.Duration, backoff r53.Backoff) *reverseZone {
+	return &reverseZone{
+		r53:          r53.NewReverse(hostedZoneID, backoff),
+		hostedZoneID: hostedZoneID,
+		owner:        `"heritage=feed-dns,hosted-zone=` + forwardHostedZoneID + `"`,
+		ttl:          int64(ttl.Seconds()),
+	}
+}
+
+// start checks every frontend has an IPv4 address, as only those have PTR records.
+func (z *reverseZone) start(frontends map[string]adapter.DNSDetails) error {
+	for scheme, frontend := range frontends {
+		if _, ok := reverseName(frontend.DNSName); !ok {
+			return fmt.Errorf("PTR records need the IPv4 address of each frontend, but the %s frontend is %s",
+				scheme, frontend.DNSName)
+		}
+	}
+
+	domain, err := z.r53.GetHostedZoneDomain()
+	if err != nil {
+		return fmt.Errorf("unable to get domain for reverse hosted zone: %v", err)
+	}
+	z.domain = domain
+	return nil
+}
+
+// reverseName is the name of the PTR record of an IPv4 address, such as 1.0.0.10.in-addr.arpa. for 10.0.0.1.
+func reverseName(address string) (string, bool) {
+	ip := net.ParseIP(address).To4()
+	if ip == nil {
+		return "", false
+	}
+	return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip[3], ip[2], ip[1], ip[0]), true
+}
+
+// update points the PTR record of each frontend address in the zone at the hosts of its scheme, and deletes the
+// owned records of addresses without any.
+func (z *reverseZone) update(frontends map[string]adapter.DNSDetails, hosts hostToIngress) error {
+	records, err := z.r53.GetRecords()
+	if err != nil {
+		requestFailures.WithLabelValues(listRecordsRequest).Inc()
+		return err
+	}
+	ptrs := make(map[string]*route53.ResourceRecordSet)
+	owners := make(map[string]*route53.ResourceRecordSet)
+	for _, rrs := range records {
+		name := aws.StringValue(rrs.Name)
+		switch aws.StringValue(rrs.Type) {
+		case route53.RRTypePtr:
+			ptrs[name] = rrs
+		case route53.RRTypeTxt:
+			for _, rr := range rrs.ResourceRecords {
+				if aws.StringValue(rr.Value) == z.owner {
+					owners[name] = rrs
+				}
+			}
+		}
+	}
+	recordsGauge.WithLabelValues(z.hostedZoneID).Set(float64(len(owners)))
+	unmanagedRecordsGauge.WithLabelValues(z.hostedZoneID).Set(float64(len(ptrs) - len(owners)))
+
+	wanted := z.wantedRecords(frontends, hosts)
+	var changes []*route53.Change
+	var names []string
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		existing, exists := ptrs[name]
+		_, owned := owners[name]
+		if exists && !owned {
+			log.Warnf("Leaving the PTR record %s alone, as it isn't owned by this feed-dns", name)
+			continue
+		}
+		if !exists || aws.Int64Value(existing.TTL) != z.ttl || !sameValues(existing, wanted[name]) {
+			changes = append(changes, z.change(route53.ChangeActionUpsert, name, route53.RRTypePtr, wanted[name]))
+		}
+		if !owned {
+			changes = append(changes, z.change(route53.ChangeActionUpsert, name, route53.RRTypeTxt, []string{z.owner}))
+		}
+	}
+	var unwanted []string
+	for name := range owners {
+		if _, ok := wanted[name]; !ok {
+			unwanted = append(unwanted, name)
+		}
+	}
+	sort.Strings(unwanted)
+	for _, name := range unwanted {
+		if ptr, ok := ptrs[name]; ok {
+			changes = append(changes, &route53.Change{Action: aws.String(route53.ChangeActionDelete), ResourceRecordSet: ptr})
+		}
+		changes = append(changes, &route53.Change{Action: aws.String(route53.ChangeActionDelete),
+			ResourceRecordSet: owners[name]})
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+	log.Infof("Calculated changes to PTR records: %v", changes)
+	updateCount.Add(float64(len(changes)))
+	if err := z.r53.UpdateRecordSets(changes); err != nil {
+		requestFailures.WithLabelValues(changeRecordsRequest).Inc()
+		return err
+	}
+	for _, change := range changes {
+		appliedChanges.WithLabelValues(aws.StringValue(change.Action)).Inc()
+	}
+	lastUpdateGauge.WithLabelValues(z.hostedZoneID).SetToCurrentTime()
+	return nil
+}
+
+// wantedRecords are the sorted hosts pointing at each frontend address in the zone, by the name of its PTR record.
+func (z *reverseZone) wantedRecords(frontends map[string]adapter.DNSDetails, hosts hostToIngress) map[string][]string {
+	wanted := make(map[string][]string)
+	for scheme, frontend := range frontends {
+		name, ok := reverseName(frontend.DNSName)
+		if !ok || !strings.HasSuffix(name, "."+z.domain) {
+			continue
+		}
+		for host, entry := range hosts {
+			if entry.LbScheme == scheme {
+				wanted[name] = append(wanted[name], host)
+			}
+		}
+	}
+	for _, values := range wanted {
+		sort.Strings(values)
+	}
+	return wanted
+}
+
+func (z *reverseZone) change(action, name, recordType string, values []string) *route53.Change {
+	rrs := &route53.ResourceRecordSet{Name: aws.String(name), Type: aws.String(recordType), TTL: aws.Int64(z.ttl)}
+	for _, value := range values {
+		rrs.ResourceRecords = append(rrs.ResourceRecords, &route53.ResourceRecord{Value: aws.String(value)})
+	}
+	return &route53.Change{Action: aws.String(action), ResourceRecordSet: rrs}
+}
+
+func sameValues(rrs *route53.ResourceRecordSet, values []string) bool {
+	if len(rrs.ResourceRecords) != len(values) {
+		return false
+	}
+	existing := make([]string, 0, len(values))
+	for _, rr := range rrs.ResourceRecords {
+		existing = append(existing, aws.StringValue(rr.Value))
+	}
+	sort.Strings(existing)
+	for i := range values {
+		if existing[i] != values[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -98,6 +98,9 @@ echo "--- Configuring NGINX"
     --with-threads \
     --with-file-aio \
     --with-http_v2_module \
+    --with-stream \
+    --with-stream_ssl_preread_module \
+    --with-stream_realip_module \
     --with-ipv6 \
     --with-debug \
     --add-module=/tmp/nginx/nginx-module-vts-${VTS_VERSION}\
@@ -114,6 +117,9 @@ echo "--- Building dynamic modules"
     --with-threads \
     --with-file-aio \
     --with-http_v2_module \
+    --with-stream \
+    --with-stream_ssl_preread_module \
+    --with-stream_realip_module \
     --with-ipv6 \
     --with-debug \
     --with-http_ssl_module \
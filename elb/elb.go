@@ -151,7 +151,7 @@ func (e *elb) attachToFrontEnds() error {
 }
 
 // FindFrontEndElbs supports finding ELBs without ingress class for backwards compatibility
-// with feed-dns, which does not support multiple ingress controllers
+// with feed-dns run without an ingress class
 func FindFrontEndElbs(awsElb ELB, frontendTagValue string) (map[string]LoadBalancerDetails, error) {
 	return FindFrontEndElbsWithIngressClassName(awsElb, frontendTagValue, "")
 }
@@ -51,3 +51,7 @@ func (s *status) Readiness() error {
 func (s *status) Update(ingresses controller.IngressEntries) error {
 	return k8sStatus.Update(ingresses, s.loadBalancers, s.kubernetesClient)
 }
+
+func (s *status) String() string {
+	return "static status"
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"net"
 	"os"
 	"time"
 
@@ -9,28 +10,47 @@ import (
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/dns"
 	"github.com/sky-uk/feed/dns/adapter"
+	"github.com/sky-uk/feed/dns/r53"
 	"github.com/sky-uk/feed/elb"
 	"github.com/sky-uk/feed/k8s"
 	"github.com/sky-uk/feed/util/cmd"
 	"github.com/sky-uk/feed/util/metrics"
 )
 
+// internalScheme is the scheme of the internal frontend, which the records of the private hosted zone point at.
+const internalScheme = "internal"
+
 var (
-	debug                      bool
-	kubeconfig                 string
-	resyncPeriod               time.Duration
-	healthPort                 int
-	albNames                   cmd.CommaSeparatedValues
-	elbLabelValue              string
-	elbRegion                  string
-	r53HostedZone              string
-	pushgatewayURL             string
-	pushgatewayIntervalSeconds int
-	pushgatewayLabels          cmd.KeyValues
-	awsAPIRetries              int
-	internalHostname           string
-	externalHostname           string
-	cnameTimeToLive            time.Duration
+	debug                     bool
+	kubeconfig                string
+	resyncPeriod              time.Duration
+	healthPort                int
+	healthPortTLS             cmd.HealthPortTLS
+	loopStuckAfter            time.Duration
+	slowUpdateThreshold       time.Duration
+	adminPort                 cmd.AdminPort
+	albNames                  cmd.CommaSeparatedValues
+	elbLabelValue             string
+	elbRegion                 string
+	r53HostedZone             string
+	r53PrivateHostedZone      string
+	managePTRRecords          bool
+	r53ReverseHostedZone      string
+	pushgateway               cmd.Pushgateway
+	pushgatewayLabels         cmd.KeyValues
+	r53Backoff                r53.Backoff
+	internalHostname          string
+	externalHostname          string
+	internalAddress           string
+	externalAddress           string
+	cnameTimeToLive           time.Duration
+	metricsExporters          cmd.CommaSeparatedValues
+	statsDTags                cmd.CommaSeparatedValues
+	statsDConfig              metrics.StatsDConfig
+	shard                     controller.Shard
+	ingressClass              string
+	includeClasslessIngresses bool
+	hostTemplate              string
 )
 
 func init() {
@@ -43,6 +63,10 @@ func init() {
 		defaultPushgatewayIntervalSeconds = 60
 		defaultAwsAPIRetries              = 5
 		defaultCnameTTL                   = 5 * time.Minute
+		defaultStatsDAddress              = "127.0.0.1:8125"
+		defaultStatsDInterval             = 10 * time.Second
+		defaultLoopStuckAfter             = 10 * time.Minute
+		defaultSlowUpdateThreshold        = 30 * time.Second
 	)
 
 	flag.BoolVar(&debug, "debug", false,
@@ -53,6 +77,22 @@ func init() {
 		"Resync with the API server periodically to handle missed updates.")
 	flag.IntVar(&healthPort, "health-port", defaultHealthPort,
 		"Port for checking the health of the ingress controller.")
+	flag.DurationVar(&loopStuckAfter, "update-loop-stuck-after", defaultLoopStuckAfter,
+		"Fail liveness on /alive when the update loop hasn't gone round for this long, as an update is stuck. "+
+			"It goes round every 10s without updates, so this must be longer. Set to 0 to disable.")
+	flag.DurationVar(&slowUpdateThreshold, "slow-update-threshold", defaultSlowUpdateThreshold,
+		"Log a warning with how long each step took when an update takes longer than this. Set to 0 to disable.")
+	flag.StringVar(&healthPortTLS.CertFile, "health-port-tls-cert", "",
+		"Certificate file for serving the health port over https. Leave blank to serve over http.")
+	flag.StringVar(&healthPortTLS.KeyFile, "health-port-tls-key", "",
+		"Private key file for serving the health port over https.")
+	flag.StringVar(&healthPortTLS.ClientCAFile, "health-port-client-ca", "",
+		"CA file used to verify client certificates on the health port. Requires -health-port-tls-cert. "+
+			"Leave blank to not require client certificates.")
+	flag.IntVar(&adminPort.Port, "admin-port", 0,
+		"Port on localhost for admin actions, such as "+cmd.ResyncPath+". Leave as 0 to disable them.")
+	flag.StringVar(&adminPort.TokenFile, "admin-token-file", "",
+		"File holding a token which admin actions must send as a bearer token. Leave blank to not require one.")
 	flag.Var(&albNames, "alb-names",
 		"Comma delimited list of ALB names to use for Route53 updates. Should only include a single ALB name per LB scheme.")
 	flag.StringVar(&elbRegion, "elb-region", defaultElbRegion,
@@ -62,20 +102,83 @@ func init() {
 			"depending on the scheme.")
 	flag.StringVar(&r53HostedZone, "r53-hosted-zone", defaultHostedZone,
 		"Route53 hosted zone id to manage.")
-	flag.StringVar(&pushgatewayURL, "pushgateway", "",
+	flag.StringVar(&r53PrivateHostedZone, "r53-private-hosted-zone", "",
+		"Route53 private hosted zone id to also manage, for the same domain as -r53-hosted-zone. Its records point "+
+			"at the internal frontend whatever the scheme of their ingress. Leave blank to only manage -r53-hosted-zone.")
+	flag.BoolVar(&managePTRRecords, "manage-ptr-records", false,
+		"Point the PTR records of -internal-address and -external-address in -r53-reverse-hosted-zone at the hosts "+
+			"of their ingresses. Records are marked as owned by a TXT record of the same name, and records without "+
+			"one are left alone.")
+	flag.StringVar(&r53ReverseHostedZone, "r53-reverse-hosted-zone", "",
+		"Route53 reverse hosted zone id of the frontend addresses, such as the zone of 10.in-addr.arpa, for "+
+			"-manage-ptr-records.")
+	flag.StringVar(&pushgateway.URL, "pushgateway", "",
 		"Prometheus Pushgateway URL for pushing metrics. Leave blank to not push metrics.")
-	flag.IntVar(&pushgatewayIntervalSeconds, "pushgateway-interval", defaultPushgatewayIntervalSeconds,
+	flag.IntVar(&pushgateway.IntervalSeconds, "pushgateway-interval", defaultPushgatewayIntervalSeconds,
 		"Interval in seconds for pushing metrics.")
 	flag.Var(&pushgatewayLabels, "pushgateway-label",
 		"A label=value pair to attach to metrics pushed to prometheus. Specify multiple times for multiple labels.")
-	flag.IntVar(&awsAPIRetries, "aws-api-retries", defaultAwsAPIRetries,
-		"Number of times a request to the AWS API is retried.")
+	flag.Var(&pushgateway.Grouping, "pushgateway-grouping",
+		"A label=value pair to add to the grouping key of pushed metrics, such as instance=<pod name>, so replicas "+
+			"don't overwrite each other's metrics. instance defaults to the hostname. Specify multiple times for "+
+			"multiple labels.")
+	flag.StringVar(&pushgateway.Username, "pushgateway-username", "",
+		"Username for basic auth to the pushgateway. Requires -pushgateway-password-file.")
+	flag.StringVar(&pushgateway.PasswordFile, "pushgateway-password-file", "",
+		"File holding the password for basic auth to the pushgateway.")
+	flag.StringVar(&pushgateway.CAFile, "pushgateway-ca", "",
+		"CA file used to verify the pushgateway's certificate. Leave blank to use the system CAs.")
+	flag.BoolVar(&pushgateway.DeleteOnShutdown, "pushgateway-delete-on-shutdown", false,
+		"Delete the pushed metrics from the pushgateway on shutdown, so they don't outlive the pod.")
+	flag.IntVar(&r53Backoff.Retries, "aws-api-retries", defaultAwsAPIRetries,
+		"Number of times a failed request to the Route53 API is retried, with exponential backoff and jitter. "+
+			"Throttled and transient failures are retried.")
+	flag.DurationVar(&r53Backoff.BaseDelay, "aws-api-retry-base-delay", r53.DefaultRetryBaseDelay,
+		"Longest wait before the first retry of a Route53 request, doubling for each retry after it. Each wait is "+
+			"random, up to this limit.")
+	flag.DurationVar(&r53Backoff.MaxDelay, "aws-api-retry-max-delay", r53.DefaultRetryMaxDelay,
+		"Longest wait before any retry of a Route53 request.")
+	flag.StringVar(&ingressClass, "ingress-class", "",
+		"Only manage records for ingresses with a matching kubernetes.io/ingress.class annotation, and alias to ELBs "+
+			"tagged with "+elb.IngressClassTag+"=value. Leave blank to manage records for every ingress.")
+	flag.BoolVar(&includeClasslessIngresses, "include-classless-ingresses", false,
+		"In addition to ingresses matching -ingress-class, also manage records for those with no "+
+			"kubernetes.io/ingress.class annotation.")
+	flag.StringVar(&hostTemplate, "ingress-host-template", "",
+		"Template generating the host of ingress rules without one, from the ingress's {name} and {namespace}, "+
+			"such as {name}.{namespace}.example.com. Use the same template as feed-ingress. Leave blank to skip rules "+
+			"without a host.")
+	flag.IntVar(&shard.Index, "shard-index", 0,
+		"Index of the shard of hosts to manage records for, from 0 to -shard-count - 1.")
+	flag.IntVar(&shard.Count, "shard-count", 0,
+		"Number of shards hosts are divided between by feed-ingress. Point this at the frontends of the shard's "+
+			"feed-ingress instances. 0 or 1 manages every host.")
 	flag.StringVar(&internalHostname, "internal-hostname", "",
 		"Hostname of the internal facing load-balancer. If specified, external-hostname must also be given.")
 	flag.StringVar(&externalHostname, "external-hostname", "",
 		"Hostname of the internet facing load-balancer. If specified, internal-hostname must also be given.")
+	flag.StringVar(&internalAddress, "internal-address", "",
+		"IPv4 address of the internal facing load-balancer, such as a merlin virtual IP. A records are created "+
+			"pointing directly at it.")
+	flag.StringVar(&externalAddress, "external-address", "",
+		"IPv4 address of the internet facing load-balancer, such as a merlin virtual IP. A records are created "+
+			"pointing directly at it.")
 	flag.DurationVar(&cnameTimeToLive, "cname-ttl", defaultCnameTTL,
-		"Time-to-live of CNAME records")
+		"Time-to-live of CNAME records, and of A records to -internal-address and -external-address")
+	metricsExporters = cmd.CommaSeparatedValues{cmd.PrometheusExporter}
+	flag.Var(&metricsExporters, "metrics-exporters",
+		"Comma delimited list of exporters to make metrics available through. One or both of "+
+			cmd.PrometheusExporter+" and "+cmd.StatsDExporter+".")
+	flag.StringVar(&statsDConfig.Address, "statsd-address", defaultStatsDAddress,
+		"Address of the StatsD server, as host:port, when the statsd exporter is enabled.")
+	flag.StringVar(&statsDConfig.Prefix, "statsd-prefix", "",
+		"Prefix to add to the name of metrics sent to StatsD.")
+	flag.Var(&statsDTags, "statsd-tags",
+		"Comma delimited list of key:value tags to attach to metrics sent to StatsD. Requires -statsd-dogstatsd.")
+	flag.BoolVar(&statsDConfig.DogStatsD, "statsd-dogstatsd", false,
+		"Send labels and tags using the DogStatsD extension. Otherwise label values are appended to metric names.")
+	flag.DurationVar(&statsDConfig.Interval, "statsd-interval", defaultStatsDInterval,
+		"Interval for sending metrics to StatsD.")
 }
 
 func main() {
@@ -83,7 +186,13 @@ func main() {
 	validateConfig()
 
 	cmd.ConfigureLogging(debug)
-	cmd.ConfigureMetrics("feed-dns", pushgatewayLabels, pushgatewayURL, pushgatewayIntervalSeconds)
+	if err := cmd.ConfigureMetrics("feed-dns", pushgatewayLabels, pushgateway); err != nil {
+		log.Fatal("Unable to configure metrics: ", err)
+	}
+	statsDConfig.Tags = statsDTags
+	if err := cmd.ConfigureExporters(metricsExporters, statsDConfig); err != nil {
+		log.Fatal("Unable to configure metrics exporters: ", err)
+	}
 
 	stopCh := make(chan struct{})
 	client, err := k8s.New(kubeconfig, resyncPeriod, stopCh)
@@ -95,16 +204,34 @@ func main() {
 	if lbErr != nil {
 		log.Fatal("Error during initialisation: ", lbErr)
 	}
-	dnsUpdater := dns.New(r53HostedZone, lbAdapter, awsAPIRetries)
+	updater := dns.New(r53HostedZone, lbAdapter, r53Backoff)
+	if managePTRRecords {
+		updater = dns.NewWithReverseZone(r53HostedZone, r53ReverseHostedZone, lbAdapter, cnameTimeToLive, r53Backoff)
+	}
+	updaters := []controller.Updater{updater}
+	if r53PrivateHostedZone != "" {
+		updaters = append(updaters, dns.NewPrivate(r53PrivateHostedZone, internalScheme, lbAdapter, r53Backoff))
+	}
 
 	feedController := controller.New(controller.Config{
-		KubernetesClient: client,
-		Updaters:         []controller.Updater{dnsUpdater},
+		KubernetesClient:          client,
+		Updaters:                  updaters,
+		Shard:                     shard,
+		Name:                      ingressClass,
+		IncludeClasslessIngresses: includeClasslessIngresses,
+		AllIngressClasses:         ingressClass == "",
+		HostTemplate:              controller.HostTemplate(hostTemplate),
+		LoopStuckAfter:            loopStuckAfter,
+		SlowUpdateThreshold:       slowUpdateThreshold,
 	}, stopCh)
 
 	cmd.AddHealthMetrics(feedController, metrics.PrometheusDNSSubsystem)
-	cmd.AddHealthPort(feedController, healthPort)
+	cmd.AddHealthPort(feedController, healthPort, healthPortTLS)
+	cmd.AddPage(dns.StatusPagePath, dns.NewStatusPage(updaters))
 	cmd.AddSignalHandler(feedController)
+	cmd.AddResyncSignalHandler(feedController.Resync)
+	cmd.AddAdminHandler(cmd.ResyncPath, feedController.Resync)
+	cmd.AddAdminPort(adminPort)
 
 	if err := feedController.Start(); err != nil {
 		log.Fatal("Error while starting controller: ", err)
@@ -117,7 +244,7 @@ func createFrontendAdapter() (adapter.FrontendAdapter, error) {
 	if internalHostname != "" || externalHostname != "" {
 		addressesWithScheme := make(map[string]string)
 		if internalHostname != "" {
-			addressesWithScheme["internal"] = internalHostname
+			addressesWithScheme[internalScheme] = internalHostname
 		}
 
 		if externalHostname != "" {
@@ -127,11 +254,25 @@ func createFrontendAdapter() (adapter.FrontendAdapter, error) {
 		return adapter.NewStaticHostnameAdapter(addressesWithScheme, cnameTimeToLive), nil
 	}
 
+	if internalAddress != "" || externalAddress != "" {
+		addressesWithScheme := make(map[string]string)
+		if internalAddress != "" {
+			addressesWithScheme[internalScheme] = internalAddress
+		}
+
+		if externalAddress != "" {
+			addressesWithScheme["internet-facing"] = externalAddress
+		}
+
+		return adapter.NewStaticAddressAdapter(addressesWithScheme, cnameTimeToLive), nil
+	}
+
 	config := adapter.AWSAdapterConfig{
 		Region:        elbRegion,
 		HostedZoneID:  r53HostedZone,
 		ELBLabelValue: elbLabelValue,
 		ALBNames:      albNames,
+		IngressClass:  ingressClass,
 	}
 	return adapter.NewAWSAdapter(&config)
 }
@@ -142,13 +283,55 @@ func validateConfig() {
 		os.Exit(-1)
 	}
 
-	if elbLabelValue == "" && len(albNames) == 0 && internalHostname == "" && externalHostname == "" {
-		log.Error("Must specify at least one of alb-names, elb-label-value, internal-hostname or external-hostname")
+	hostnames := internalHostname != "" || externalHostname != ""
+	addresses := internalAddress != "" || externalAddress != ""
+	loadBalancers := elbLabelValue != "" || len(albNames) > 0
+	if !hostnames && !addresses && !loadBalancers {
+		log.Error("Must specify at least one of alb-names, elb-label-value, internal-hostname, external-hostname, " +
+			"internal-address or external-address")
 		os.Exit(-1)
 	}
 
-	if (internalHostname != "" || externalHostname != "") && (elbLabelValue != "" || len(albNames) > 0) {
+	if hostnames && loadBalancers {
 		log.Error("Can't supply both ELB/ALB and non-ALB/ELB hostname. Choose one or the other.")
 		os.Exit(-1)
 	}
+
+	if addresses && (hostnames || loadBalancers) {
+		log.Error("Can't supply addresses with ELB/ALB or hostnames. Choose one or the other.")
+		os.Exit(-1)
+	}
+
+	for _, address := range []string{internalAddress, externalAddress} {
+		if ip := net.ParseIP(address); address != "" && (ip == nil || ip.To4() == nil) {
+			log.Errorf("Invalid address %q, must be an IPv4 address", address)
+			os.Exit(-1)
+		}
+	}
+
+	if includeClasslessIngresses && ingressClass == "" {
+		log.Error("Must supply ingress-class with include-classless-ingresses")
+		os.Exit(-1)
+	}
+
+	if r53PrivateHostedZone != "" && r53PrivateHostedZone == r53HostedZone {
+		log.Error("Must supply a different r53-private-hosted-zone to r53-hosted-zone")
+		os.Exit(-1)
+	}
+
+	if managePTRRecords && (!addresses || r53ReverseHostedZone == "") {
+		log.Error("Must supply internal-address or external-address, and r53-reverse-hosted-zone, with " +
+			"manage-ptr-records")
+		os.Exit(-1)
+	}
+
+	if err := shard.Validate(); err != nil {
+		log.Errorf("Invalid shard-index or shard-count: %v", err)
+		os.Exit(-1)
+	}
+
+	if err := controller.HostTemplate(hostTemplate).Validate(); err != nil {
+		log.Errorf("Invalid ingress-host-template: %v", err)
+		os.Exit(-1)
+	}
 }
@@ -1,9 +1,19 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/sky-uk/feed/acme"
+	"github.com/sky-uk/feed/dns/r53"
+	"github.com/sky-uk/feed/hook"
 	"github.com/sky-uk/feed/nginx"
+	"github.com/sky-uk/feed/plugin"
+	"github.com/sky-uk/feed/spiffe"
+	"github.com/sky-uk/feed/vault"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/controller"
@@ -13,17 +23,20 @@ import (
 	cmdutil "github.com/sky-uk/feed/util/cmd"
 )
 
+const nginxUpgradePath = "/admin/nginx/upgrade"
+
 type appendIngressUpdaters = func(kubernetesClient k8s.Client, updaters []controller.Updater) ([]controller.Updater, error)
 
 func runCmd(appender appendIngressUpdaters) {
-	if ingressClassName == defaultIngressClassName {
-		log.Fatalf("The argument --%s is required", ingressClassFlag)
-	}
-	controllerConfig.Name = ingressClassName
-	controllerConfig.IncludeClasslessIngresses = includeUnnamedIngresses
+	configureController()
 
 	cmdutil.ConfigureLogging(debug)
-	cmdutil.ConfigureMetrics("feed-ingress", pushgatewayLabels, pushgatewayURL, pushgatewayIntervalSeconds)
+	if err := cmdutil.ConfigureMetrics("feed-ingress", pushgatewayLabels, pushgateway); err != nil {
+		log.Fatal("Unable to configure metrics: ", err)
+	}
+	if err := cmdutil.ConfigureExporters(metricsExporters, statsDConfig); err != nil {
+		log.Fatal("Unable to configure metrics exporters: ", err)
+	}
 
 	stopCh := make(chan struct{})
 	client, err := k8s.New(kubeconfig, resyncPeriod, stopCh)
@@ -37,17 +50,20 @@ func runCmd(appender appendIngressUpdaters) {
 		log.Fatal("Unable to create ingress updaters: ", err)
 	}
 
-	controllerConfig.NamespaceSelectors, err = parseNamespaceSelector(namespaceSelectors)
-	if err != nil {
-		log.Fatalf("invalid format for --%s (%s)", ingressControllerNamespaceSelectorsFlag, namespaceSelectors)
+	if len(controllerConfig.DefaultInterceptErrors) > 0 && nginxConfig.ErrorPagesDir == "" {
+		log.Fatal("--nginx-default-intercept-errors needs --nginx-error-pages-dir to replace the errors with")
 	}
-	controllerConfig.MatchAllNamespaceSelectors = matchAllNamespaceSelectors
 
 	feedController := controller.New(controllerConfig, stopCh)
 
 	cmdutil.AddHealthMetrics(feedController, metrics.PrometheusIngressSubsystem)
-	cmdutil.AddHealthPort(feedController, healthPort)
+	cmdutil.AddHealthPort(feedController, healthPort, healthPortTLS)
 	cmdutil.AddSignalHandler(feedController)
+	cmdutil.AddResyncSignalHandler(feedController.Resync)
+	cmdutil.AddAdminHandler(cmdutil.ResyncPath, feedController.Resync)
+	cmdutil.AddAdminPort(adminPort)
+	cmdutil.AddDebugPort(debugPort)
+	cmdutil.AddPage(controller.StatusPagePath, controller.NewStatusPage(feedController.Status))
 
 	if err = feedController.Start(); err != nil {
 		log.Fatal("Error while starting controller: ", err)
@@ -57,8 +73,44 @@ func runCmd(appender appendIngressUpdaters) {
 	select {}
 }
 
+// configureController sets the controller config from the flags, exiting if they're invalid.
+func configureController() {
+	if ingressClassName == defaultIngressClassName {
+		log.Fatalf("The argument --%s is required", ingressClassFlag)
+	}
+	controllerConfig.Name = ingressClassName
+	controllerConfig.IncludeClasslessIngresses = includeUnnamedIngresses
+	controllerConfig.ConflictStrategy = controller.ConflictStrategy(conflictStrategy)
+	if !controllerConfig.ConflictStrategy.Valid() {
+		log.Fatalf("Invalid --conflict-strategy %q, must be one of %v", conflictStrategy, controller.ConflictStrategies)
+	}
+	if err := controllerConfig.Shard.Validate(); err != nil {
+		log.Fatalf("Invalid --shard-index or --shard-count: %v", err)
+	}
+	controllerConfig.HostTemplate = controller.HostTemplate(hostTemplate)
+	if err := controllerConfig.HostTemplate.Validate(); err != nil {
+		log.Fatalf("Invalid --ingress-host-template: %v", err)
+	}
+
+	var err error
+	controllerConfig.NamespaceSelectors, err = parseNamespaceSelector(namespaceSelectors)
+	if err != nil {
+		log.Fatalf("invalid format for --%s (%s)", ingressControllerNamespaceSelectorsFlag, namespaceSelectors)
+	}
+	controllerConfig.MatchAllNamespaceSelectors = matchAllNamespaceSelectors
+
+	controllerConfig.DefaultInterceptErrors, err = controller.ParseInterceptErrors(defaultInterceptErrors)
+	if err != nil {
+		log.Fatalf("Invalid --nginx-default-intercept-errors: %v", err)
+	}
+}
+
 func createIngressUpdaters(kubernetesClient k8s.Client, appender appendIngressUpdaters) ([]controller.Updater, error) {
-	nginxConfig.Ports = createPortsConfig(ingressPort, ingressHTTPSPort)
+	listeners, err := parseListeners(ingressListeners)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --ingress-listen: %v", err)
+	}
+	nginxConfig.Ports = createPortsConfig(ingressPort, ingressHTTPSPort, listeners...)
 
 	nginxConfig.HealthPort = ingressHealthPort
 	nginxConfig.SSLPath = nginxSSLPath
@@ -68,17 +120,96 @@ func createIngressUpdaters(kubernetesClient k8s.Client, appender appendIngressUp
 	nginxConfig.VhostStatsRequestBuckets = nginxVhostStatsRequestBuckets
 	nginxConfig.OpenTracingPlugin = nginxOpenTracingPluginPath
 	nginxConfig.OpenTracingConfig = nginxOpenTracingConfigPath
+	nginxConfig.MetricsAllowedHosts = nginxMetricsAllowedHosts
+	nginxConfig.AllowZeroEntries = controllerConfig.AllowZeroIngresses
+	confDir := nginxConfig.ConfDir
+	if confDir == "" {
+		confDir = nginxConfig.WorkingDir
+	}
+	nginxConfig.HtpasswdDir = filepath.Join(confDir, "htpasswd")
+
+	var acmeUpdater controller.Updater
+	if acmeEnabled {
+		if nginxConfig.SSLCertificatesDir == "" {
+			return nil, errors.New("--ssl-certs-dir is required for --acme")
+		}
+		acmeConfig.ChallengeDir = filepath.Join(acmeConfig.StateDir, "challenges")
+		acmeConfig.CertificatesDir = nginxConfig.SSLCertificatesDir
+		acmeConfig.Route53Backoff = r53.Backoff{Retries: defaultACMEAPIRetries, BaseDelay: r53.DefaultRetryBaseDelay,
+			MaxDelay: r53.DefaultRetryMaxDelay}
+		nginxConfig.ACMEChallengeDir = acmeConfig.ChallengeDir
+
+		var err error
+		if acmeUpdater, err = acme.New(acmeConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	var updaters []controller.Updater
+	if vaultConfig.Address != "" {
+		if vaultConfig.PKIRole != "" && nginxConfig.SSLCertificatesDir == "" {
+			return nil, errors.New("--ssl-certs-dir is required for --vault-pki-role")
+		}
+		vaultConfig.SSLPath = nginxSSLPath
+		vaultConfig.CertificatesDir = nginxConfig.SSLCertificatesDir
+		vaultConfig.HtpasswdDir = nginxConfig.HtpasswdDir
+
+		vaultUpdater, err := vault.New(vaultConfig)
+		if err != nil {
+			return nil, err
+		}
+		// started before nginx, so the default certificate is in place when it first starts
+		updaters = append(updaters, vaultUpdater)
+	}
+
+	if spiffeConfig.WorkloadAPIAddress != "" {
+		if nginxConfig.SPIFFESVIDDir == "" {
+			return nil, errors.New("--spiffe-svid-dir is required for --spiffe-workload-api-address")
+		}
+		spiffeConfig.CertificateFile = nginxConfig.SVIDCertificate()
+		spiffeConfig.KeyFile = nginxConfig.SVIDKey()
+		spiffeConfig.BundleFile = nginxConfig.SVIDBundle()
+
+		spiffeUpdater, err := spiffe.New(spiffeConfig)
+		if err != nil {
+			return nil, err
+		}
+		// started before nginx, so the SVID is in place when it first starts
+		updaters = append(updaters, spiffeUpdater)
+	}
+
 	nginxUpdater := nginx.New(nginxConfig)
+	if upgrader, ok := nginxUpdater.(nginx.Upgrader); ok {
+		cmdutil.AddAdminHandler(nginxUpgradePath, upgrader.Upgrade)
+	}
 
-	updaters := []controller.Updater{nginxUpdater}
-	updaters, err := appender(kubernetesClient, updaters)
+	updaters = append(updaters, nginxUpdater)
+	if acmeUpdater != nil {
+		updaters = append(updaters, acmeUpdater)
+	}
+	if externalUpdaterConfig.Endpoint != "" {
+		externalUpdater, err := plugin.New(externalUpdaterConfig)
+		if err != nil {
+			return nil, err
+		}
+		updaters = append(updaters, externalUpdater)
+	}
+	updaters, err = appender(kubernetesClient, updaters)
 	if err != nil {
 		return nil, err
 	}
+	// Updaters are stopped in reverse order, so the hook runs before frontends are deregistered and drained.
+	if preDrainHookConfig.Enabled() {
+		preDrainHook, err := hook.New(preDrainHookConfig)
+		if err != nil {
+			return nil, err
+		}
+		updaters = append(updaters, preDrainHook)
+	}
 	return updaters, nil
 }
 
-func createPortsConfig(ingressPort int, ingressHTTPSPort int) []nginx.Port {
+func createPortsConfig(ingressPort int, ingressHTTPSPort int, listeners ...nginx.Port) []nginx.Port {
 	var ports = []nginx.Port{}
 	if ingressPort != unset {
 		ports = append(ports, nginx.Port{Name: "http", Port: ingressPort})
@@ -86,6 +217,7 @@ func createPortsConfig(ingressPort int, ingressHTTPSPort int) []nginx.Port {
 	if ingressHTTPSPort != unset {
 		ports = append(ports, nginx.Port{Name: "https", Port: ingressHTTPSPort})
 	}
+	ports = append(ports, listeners...)
 
 	if len(ports) == 0 {
 		log.Fatal("Error http or https port must be provided,(--ingress-port=XXXX or --ingress-https-port=XXXX) exiting")
@@ -93,6 +225,51 @@ func createPortsConfig(ingressPort int, ingressHTTPSPort int) []nginx.Port {
 	return ports
 }
 
+// parseListeners parses --ingress-listen flags of the form port[,ssl][,http2][,proxy-protocol].
+func parseListeners(listeners []string) ([]nginx.Port, error) {
+	var ports []nginx.Port
+	seen := make(map[int]bool)
+	for _, listener := range listeners {
+		fields := strings.Split(listener, ",")
+		port, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port in %q", listener)
+		}
+		if seen[port] {
+			return nil, fmt.Errorf("port %d is listed more than once", port)
+		}
+		seen[port] = true
+
+		p := nginx.Port{Name: "http", Port: port}
+		for _, option := range fields[1:] {
+			option = strings.TrimSpace(option)
+			if strings.HasPrefix(option, "scheme=") {
+				if p.Scheme = strings.TrimPrefix(option, "scheme="); p.Scheme == "" {
+					return nil, fmt.Errorf("empty scheme in %q", listener)
+				}
+				continue
+			}
+			switch option {
+			case "ssl":
+				p.SSL = true
+				p.Name = "https"
+			case "http2":
+				p.HTTP2 = true
+			case "proxy-protocol":
+				p.ProxyProtocol = true
+			default:
+				return nil, fmt.Errorf("unknown option %q in %q, must be ssl, http2, proxy-protocol or "+
+					"scheme=<scheme>", option, listener)
+			}
+		}
+		if p.HTTP2 && !p.SSL {
+			return nil, fmt.Errorf("http2 needs ssl in %q", listener)
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
 func parseNamespaceSelector(nameValueStringSlice []string) ([]*k8s.NamespaceSelector, error) {
 	if len(nameValueStringSlice) == 0 {
 		return nil, nil
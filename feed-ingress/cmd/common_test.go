@@ -40,3 +40,37 @@ func TestCreatePortsConfigWithPorts(t *testing.T) {
 
 	assert.Equal(t, expectedPorts, ports, "they should be equal")
 }
+
+func TestCreatePortsConfigWithListeners(t *testing.T) {
+	ports := createPortsConfig(1, unset, nginx.Port{Name: "https", Port: 2, SSL: true})
+	expectedPorts := []nginx.Port{{Name: "http", Port: 1}, {Name: "https", Port: 2, SSL: true}}
+
+	assert.Equal(t, expectedPorts, ports)
+}
+
+func TestParseListeners(t *testing.T) {
+	ports, err := parseListeners([]string{"80,proxy-protocol", "443, ssl, http2", "8443,ssl,proxy-protocol",
+		"9443,ssl,scheme=internal"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []nginx.Port{
+		{Name: "http", Port: 80, ProxyProtocol: true},
+		{Name: "https", Port: 443, SSL: true, HTTP2: true},
+		{Name: "https", Port: 8443, SSL: true, ProxyProtocol: true},
+		{Name: "https", Port: 9443, SSL: true, Scheme: "internal"},
+	}, ports)
+}
+
+func TestParseInvalidListeners(t *testing.T) {
+	for _, listeners := range [][]string{
+		{"http"},
+		{"0"},
+		{"80,tls"},
+		{"80,http2"},
+		{"80,scheme="},
+		{"80", "80,ssl"},
+	} {
+		_, err := parseListeners(listeners)
+		assert.Error(t, err, "%v", listeners)
+	}
+}
@@ -1,21 +1,26 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sky-uk/feed/k8s"
 
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/gorb"
+	"github.com/sky-uk/feed/gorb/gorbstatus"
 	"github.com/spf13/cobra"
 )
 
 var (
 	gorbIngressInstanceIP          string
+	gorbIngressInstanceIPv6        string
 	gorbEndpoint                   string
 	gorbServicesDefinition         string
+	gorbIPv6ServicesDefinition     string
 	gorbBackendMethod              string
 	gorbBackendWeight              int
 	gorbVipLoadbalancer            string
@@ -23,6 +28,18 @@ var (
 	gorbBackendHealthcheckInterval string
 	gorbBackendHealthcheckType     string
 	gorbInterfaceProcFsPath        string
+	gorbBackendHealthcheckPath     string
+	gorbBackendHealthcheckPort     int
+	gorbBackendHealthcheckExpect   int
+	gorbServiceHealthchecks        []string
+	gorbNodeName                   string
+	gorbBackendWeightLabel         string
+	gorbBackendWeightPerCPU        int
+	gorbBackendWeightHighLoad      float64
+	gorbBackendWeightInterval      time.Duration
+	gorbBackendWeightRamp          time.Duration
+	gorbBackendWeightRampSteps     int
+	gorbStatusAddresses            []string
 )
 
 const (
@@ -36,6 +53,10 @@ const (
 	defaultGorbInterfaceProcFsPath        = "/host-ipv4-proc/"
 	defaultGorbBackendHealthcheckInterval = "1s"
 	defaultGorbBackendHealthcheckType     = "http"
+	defaultGorbBackendHealthcheckPath     = "/"
+	defaultGorbBackendHealthcheckExpect   = 404
+	defaultGorbBackendWeightInterval      = 30 * time.Second
+	defaultGorbBackendWeightRampSteps     = 10
 )
 
 var gorbCmd = &cobra.Command{
@@ -53,22 +74,58 @@ func init() {
 	gorbCmd.Flags().StringVar(&gorbEndpoint, "gorb-endpoint", defaultGorbEndpoint, "Define the endpoint to talk to gorb for registration.")
 	gorbCmd.Flags().StringVar(&gorbIngressInstanceIP, "gorb-ingress-instance-ip", defaultGorbIngressInstanceIP,
 		"Define the ingress instance ip, the ip of the node where feed-ingress is running.")
+	gorbCmd.Flags().StringVar(&gorbIngressInstanceIPv6, "gorb-ingress-instance-ipv6", "",
+		"Define the ingress instance IPv6 address, registered with the --gorb-ipv6-services-definition services for dual-stack IPVS.")
 	gorbCmd.Flags().StringVar(&gorbServicesDefinition, "gorb-services-definition", defaultGorbServicesDefinition,
 		"Comma separated list of Service Definition (e.g. 'http-proxy:80,https-proxy:443') to register via Gorb")
+	gorbCmd.Flags().StringVar(&gorbIPv6ServicesDefinition, "gorb-ipv6-services-definition", "",
+		"Comma separated list of Service Definition of virtual services on IPv6 vips (e.g. 'http-proxy-v6:80,https-proxy-v6:443') "+
+			"to register via Gorb with --gorb-ingress-instance-ipv6")
 	gorbCmd.Flags().StringVar(&gorbBackendMethod, "gorb-backend-method", defaultGorbBackendMethod,
 		"Define the backend method (e.g. nat, dr, tunnel) to register via Gorb ")
 	gorbCmd.Flags().IntVar(&gorbBackendWeight, "gorb-backend-weight", defaultGorbBackendWeight,
 		"Define the backend weight to register via Gorb")
+	gorbCmd.Flags().StringVar(&gorbNodeName, "gorb-node-name", "",
+		"Name of the node feed-ingress runs on, such as from the downward API, to weight the backend by. Needed by the "+
+			"--gorb-backend-weight-* flags")
+	gorbCmd.Flags().StringVar(&gorbBackendWeightLabel, "gorb-backend-weight-label", "",
+		"Node label whose value is the backend weight. Nodes without the label use --gorb-backend-weight-per-cpu or "+
+			"--gorb-backend-weight")
+	gorbCmd.Flags().IntVar(&gorbBackendWeightPerCPU, "gorb-backend-weight-per-cpu", 0,
+		"Weight of each CPU of the node's capacity, so the backend weight is proportional to the size of the node. "+
+			"0 uses --gorb-backend-weight")
+	gorbCmd.Flags().Float64Var(&gorbBackendWeightHighLoad, "gorb-backend-weight-high-load", 0,
+		"1 minute load average per CPU of the node above which the backend weight is halved. 0 never halves it")
+	gorbCmd.Flags().DurationVar(&gorbBackendWeightInterval, "gorb-backend-weight-interval", defaultGorbBackendWeightInterval,
+		"How often the backend weight is computed again from the node, changing it in Gorb if it changed")
+	gorbCmd.Flags().DurationVar(&gorbBackendWeightRamp, "gorb-backend-weight-ramp", 0,
+		"How long a newly registered backend takes to step up to its full weight, so it only gets its full share of "+
+			"traffic once nginx has warmed up. 0 registers it at its full weight")
+	gorbCmd.Flags().IntVar(&gorbBackendWeightRampSteps, "gorb-backend-weight-ramp-steps", defaultGorbBackendWeightRampSteps,
+		"How many equal steps --gorb-backend-weight-ramp increases the weight in")
 	gorbCmd.Flags().StringVar(&gorbVipLoadbalancer, "gorb-vip-loadbalancer", defaultGorbVipLoadbalancer,
-		"Define the vip loadbalancer to set the loopback. Only necessary when Direct Return is enabled.")
+		"Define the comma separated IPv4 or IPv6 vips of the loadbalancer to set the loopback. Only necessary when Direct Return is enabled.")
 	gorbCmd.Flags().BoolVar(&gorbManageLoopback, "gorb-management-loopback", defaultGorbManageLoopback,
 		"Enable loopback creation. Only necessary when Direct Return is enabled")
 	gorbCmd.Flags().StringVar(&gorbInterfaceProcFsPath, "gorb-interface-proc-fs-path", defaultGorbInterfaceProcFsPath,
-		"Path to the interface proc file system. Only necessary when Direct Return is enabled")
+		"Path to the interface IPv4 proc file system, for the ARP settings of IPv4 vips. Only necessary when Direct Return is enabled")
 	gorbCmd.Flags().StringVar(&gorbBackendHealthcheckInterval, "gorb-backend-healthcheck-interval", defaultGorbBackendHealthcheckInterval,
 		"Define the gorb healthcheck interval for the backend")
 	gorbCmd.Flags().StringVar(&gorbBackendHealthcheckType, "gorb-backend-healthcheck-type", defaultGorbBackendHealthcheckType,
 		"Define the gorb healthcheck type for the backend. Must be either 'tcp', 'http' or 'none'")
+	gorbCmd.Flags().StringVar(&gorbBackendHealthcheckPath, "gorb-backend-healthcheck-path", defaultGorbBackendHealthcheckPath,
+		"Define the path requested by http healthchecks of the backend, such as a readiness endpoint")
+	gorbCmd.Flags().IntVar(&gorbBackendHealthcheckPort, "gorb-backend-healthcheck-port", 0,
+		"Define the port checked by healthchecks of the backend, instead of the port of each service. 0 checks the service port")
+	gorbCmd.Flags().IntVar(&gorbBackendHealthcheckExpect, "gorb-backend-healthcheck-expected-status", defaultGorbBackendHealthcheckExpect,
+		"Define the status code expected by http healthchecks of the backend")
+	gorbCmd.Flags().StringArrayVar(&gorbServiceHealthchecks, "gorb-service-healthcheck", []string{},
+		"Override the backend healthcheck of a service, as <service>:<key>=<value>,... with keys type, path, port and "+
+			"expected-status (e.g. 'https-proxy:type=tcp' or 'http-proxy:path=/health,port=8080,expected-status=200'). "+
+			"Specify multiple times for multiple services")
+	gorbCmd.Flags().StringSliceVar(&gorbStatusAddresses, "gorb-status-addresses", []string{},
+		"Comma separated IPs or hostnames of the gorb vips to set as the load balancer status of every ingress, for "+
+			"consumers such as external-dns. Leave empty to not update ingress statuses")
 }
 
 func appendGorbIngressUpdaters(kubernetesClient k8s.Client, updaters []controller.Updater) ([]controller.Updater, error) {
@@ -77,13 +134,29 @@ func appendGorbIngressUpdaters(kubernetesClient k8s.Client, updaters []controlle
 		return nil, fmt.Errorf("invalid gorb services definition. Must be a comma separated list - e.g. 'http-proxy:80,https-proxy:443', but was %s", gorbServicesDefinition)
 	}
 
-	if gorbBackendHealthcheckType != "tcp" && gorbBackendHealthcheckType != "http" && gorbBackendHealthcheckType != "none" {
+	if gorbIPv6ServicesDefinition != "" {
+		ipv6Services, err := toVirtualServices(gorbIPv6ServicesDefinition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gorb IPv6 services definition. Must be a comma separated list - e.g. 'http-proxy-v6:80,https-proxy-v6:443', but was %s", gorbIPv6ServicesDefinition)
+		}
+		for _, service := range ipv6Services {
+			service.IPv6 = true
+			virtualServices = append(virtualServices, service)
+		}
+	}
+
+	if !validHealthcheckType(gorbBackendHealthcheckType) {
 		return nil, fmt.Errorf("invalid gorb backend healthcheck type. Must be either 'tcp', 'http' or 'none', but was %s", gorbBackendHealthcheckType)
 	}
 
+	if err := addServiceHealthchecks(virtualServices, gorbServiceHealthchecks); err != nil {
+		return nil, err
+	}
+
 	config := gorb.Config{
 		ServerBaseURL:              gorbEndpoint,
 		InstanceIP:                 gorbIngressInstanceIP,
+		InstanceIPv6:               gorbIngressInstanceIPv6,
 		DrainDelay:                 drainDelay,
 		ServicesDefinition:         virtualServices,
 		BackendMethod:              gorbBackendMethod,
@@ -93,13 +166,47 @@ func appendGorbIngressUpdaters(kubernetesClient k8s.Client, updaters []controlle
 		BackendHealthcheckInterval: gorbBackendHealthcheckInterval,
 		BackendHealthcheckType:     gorbBackendHealthcheckType,
 		InterfaceProcFsPath:        gorbInterfaceProcFsPath,
+		BackendHealthcheckPath:     gorbBackendHealthcheckPath,
+		BackendHealthcheckPort:     gorbBackendHealthcheckPort,
+		BackendHealthcheckExpect:   strconv.Itoa(gorbBackendHealthcheckExpect),
+		WeightRamp:                 gorbBackendWeightRamp,
+		WeightRampSteps:            gorbBackendWeightRampSteps,
+	}
+
+	if gorbBackendWeightLabel != "" || gorbBackendWeightPerCPU > 0 || gorbBackendWeightHighLoad > 0 {
+		if gorbNodeName == "" {
+			return nil, errors.New("--gorb-node-name is needed to weight the gorb backend by the node")
+		}
+		if gorbBackendWeightInterval <= 0 {
+			return nil, errors.New("--gorb-backend-weight-interval must be positive")
+		}
+		config.NodeWeight = &gorb.NodeWeight{
+			Nodes:    kubernetesClient,
+			NodeName: gorbNodeName,
+			Label:    gorbBackendWeightLabel,
+			PerCPU:   gorbBackendWeightPerCPU,
+			HighLoad: gorbBackendWeightHighLoad,
+			Interval: gorbBackendWeightInterval,
+		}
 	}
 
 	gorbUpdater, err := gorb.New(&config)
 	if err != nil {
 		return nil, err
 	}
-	return append(updaters, gorbUpdater), nil
+	updaters = append(updaters, gorbUpdater)
+
+	if len(gorbStatusAddresses) == 0 {
+		return updaters, nil
+	}
+	statusUpdater, err := gorbstatus.New(gorbstatus.Config{
+		Addresses:        gorbStatusAddresses,
+		KubernetesClient: kubernetesClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(updaters, statusUpdater), nil
 }
 
 func toVirtualServices(servicesCsv string) ([]gorb.VirtualService, error) {
@@ -118,3 +225,59 @@ func toVirtualServices(servicesCsv string) ([]gorb.VirtualService, error) {
 	}
 	return virtualServices, nil
 }
+
+func validHealthcheckType(healthcheckType string) bool {
+	return healthcheckType == "tcp" || healthcheckType == "http" || healthcheckType == "none"
+}
+
+// addServiceHealthchecks sets the healthcheck overrides of the services, each as <service>:<key>=<value>,...
+func addServiceHealthchecks(virtualServices []gorb.VirtualService, overrides []string) error {
+	for _, override := range overrides {
+		nameAndArgs := strings.SplitN(override, ":", 2)
+		if len(nameAndArgs) != 2 {
+			return fmt.Errorf("invalid gorb service healthcheck %s, must be <service>:<key>=<value>,...", override)
+		}
+
+		var healthcheck gorb.Healthcheck
+		for _, arg := range strings.Split(nameAndArgs[1], ",") {
+			keyValue := strings.SplitN(arg, "=", 2)
+			if len(keyValue) != 2 {
+				return fmt.Errorf("invalid gorb service healthcheck %s, must be <service>:<key>=<value>,...", override)
+			}
+			key, value := keyValue[0], keyValue[1]
+			switch key {
+			case "type":
+				if !validHealthcheckType(value) {
+					return fmt.Errorf("invalid type in gorb service healthcheck %s. Must be either 'tcp', 'http' or 'none'", override)
+				}
+				healthcheck.Type = value
+			case "path":
+				healthcheck.Path = value
+			case "port", "expected-status":
+				number, err := strconv.Atoi(value)
+				if err != nil || number <= 0 {
+					return fmt.Errorf("invalid %s in gorb service healthcheck %s", key, override)
+				}
+				if key == "port" {
+					healthcheck.Port = number
+				} else {
+					healthcheck.Expect = value
+				}
+			default:
+				return fmt.Errorf("unknown key %s in gorb service healthcheck %s, must be type, path, port or expected-status", key, override)
+			}
+		}
+
+		found := false
+		for i := range virtualServices {
+			if virtualServices[i].Name == nameAndArgs[0] {
+				virtualServices[i].Healthcheck = healthcheck
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("gorb service healthcheck %s is for a service which isn't in --gorb-services-definition", override)
+		}
+	}
+	return nil
+}
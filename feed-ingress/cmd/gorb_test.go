@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sky-uk/feed/gorb"
+)
+
+func TestServiceHealthchecksOverrideTheirService(t *testing.T) {
+	services := []gorb.VirtualService{{Name: "http-proxy", Port: 80}, {Name: "https-proxy", Port: 443}}
+
+	err := addServiceHealthchecks(services, []string{
+		"http-proxy:path=/health,port=8080,expected-status=200",
+		"https-proxy:type=tcp",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []gorb.VirtualService{
+		{Name: "http-proxy", Port: 80, Healthcheck: gorb.Healthcheck{Path: "/health", Port: 8080, Expect: "200"}},
+		{Name: "https-proxy", Port: 443, Healthcheck: gorb.Healthcheck{Type: "tcp"}},
+	}, services)
+}
+
+func TestInvalidServiceHealthchecksAreRejected(t *testing.T) {
+	for _, override := range []string{
+		"http-proxy",
+		"http-proxy:path",
+		"http-proxy:type=udp",
+		"http-proxy:port=http",
+		"http-proxy:expected-status=0",
+		"http-proxy:timeout=1s",
+		"ftp-proxy:type=tcp",
+	} {
+		services := []gorb.VirtualService{{Name: "http-proxy", Port: 80}}
+		assert.Error(t, addServiceHealthchecks(services, []string{override}), override)
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/k8s"
+	cmdutil "github.com/sky-uk/feed/util/cmd"
+	"github.com/spf13/cobra"
+)
+
+const defaultReportTimeout = time.Minute
+
+var reportTimeout time.Duration
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Print the routing table computed from the cluster's ingresses, and why any are left out",
+	Long: `Report lists the ingresses as feed-ingress would, with the same flags, and prints each host and
+path with the service and ingress it's routed to and its effective timeouts. Ingresses left out,
+such as those losing a conflict, are listed with the event they would get. Nothing is updated.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runReport(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+
+	reportCmd.Flags().DurationVar(&reportTimeout, "report-timeout", defaultReportTimeout,
+		"How long to wait for the ingresses and services to be listed from the apiserver.")
+}
+
+func runReport(out io.Writer) {
+	configureController()
+	cmdutil.ConfigureLogging(debug)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	client, err := k8s.New(kubeconfig, resyncPeriod, stopCh)
+	if err != nil {
+		log.Fatal("Unable to create k8s client: ", err)
+	}
+	controllerConfig.KubernetesClient = client
+
+	report, err := controller.Report(controllerConfig, reportTimeout)
+	if err != nil {
+		log.Fatal("Unable to compute the routing table: ", err)
+	}
+	if err := printReport(out, report); err != nil {
+		log.Fatal("Unable to print the routing table: ", err)
+	}
+}
+
+func printReport(out io.Writer, report controller.RoutingReport) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tPATH\tSERVICE\tINGRESS\tTIMEOUT\tWEBSOCKET TIMEOUT\tFAIL TIMEOUT")
+	for _, r := range report.Routes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\t%s\t%s\n", r.Host, r.Path, r.Service, r.Ingress, r.BackendTimeout,
+			durationOr(r.WebSocketTimeout, "-"), durationOr(r.BackendFailTimeout, "default"))
+	}
+	if len(report.Problems) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "INGRESS\tREASON\tMESSAGE")
+		for _, p := range report.Problems {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", p.Ingress, p.Reason, p.Message)
+		}
+	}
+	return w.Flush()
+}
+
+// durationOr formats the duration, or returns unset if it's zero.
+func durationOr(d time.Duration, unset string) string {
+	if d == 0 {
+		return unset
+	}
+	return d.String()
+}
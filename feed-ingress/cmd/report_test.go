@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportIsPrintedAsTables(t *testing.T) {
+	var out bytes.Buffer
+
+	err := printReport(&out, controller.RoutingReport{
+		Routes: []controller.ReportRoute{
+			{Host: "foo.com", Path: "/", Service: "web:80", Ingress: "team/web", BackendTimeout: time.Minute},
+			{Host: "foo.com", Path: "/ws", Service: "ws:8080", Ingress: "team/ws", BackendTimeout: 10 * time.Second,
+				WebSocketTimeout: time.Hour, BackendFailTimeout: 30 * time.Second},
+		},
+		Problems: []controller.ReportProblem{
+			{Ingress: "other/web", Reason: "HostPathConflict", Message: "Host foo.com and path / are also used by team/web"},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `HOST     PATH  SERVICE  INGRESS   TIMEOUT  WEBSOCKET TIMEOUT  FAIL TIMEOUT
+foo.com  /     web:80   team/web  1m0s     -                  default
+foo.com  /ws   ws:8080  team/ws   10s      1h0m0s             30s
+
+INGRESS    REASON            MESSAGE
+other/web  HostPathConflict  Host foo.com and path / are also used by team/web
+`, out.String())
+}
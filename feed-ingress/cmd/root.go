@@ -5,9 +5,15 @@ import (
 	"os"
 	"time"
 
+	"github.com/sky-uk/feed/acme"
 	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/hook"
 	"github.com/sky-uk/feed/nginx"
+	"github.com/sky-uk/feed/plugin"
+	"github.com/sky-uk/feed/spiffe"
 	"github.com/sky-uk/feed/util/cmd"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/sky-uk/feed/vault"
 	"github.com/spf13/cobra"
 )
 
@@ -33,9 +39,13 @@ var (
 	resyncPeriod      time.Duration
 	ingressPort       int
 	ingressHTTPSPort  int
+	ingressListeners  []string
 	ingressHealthPort int
 	controllerConfig  controller.Config
 	healthPort        int
+	healthPortTLS     cmd.HealthPortTLS
+	adminPort         cmd.AdminPort
+	debugPort         cmd.DebugPort
 
 	nginxConfig                   nginx.Conf
 	nginxLogHeaders               []string
@@ -45,34 +55,58 @@ var (
 	nginxVhostStatsRequestBuckets []string
 	nginxOpenTracingPluginPath    string
 	nginxOpenTracingConfigPath    string
+	nginxMetricsAllowedHosts      []string
+	defaultInterceptErrors        string
+
+	acmeEnabled  bool
+	acmeConfig   acme.Config
+	vaultConfig  vault.Config
+	spiffeConfig spiffe.Config
+
+	externalUpdaterConfig plugin.Config
+	preDrainHookConfig    hook.Config
 
 	ingressClassName           string
+	conflictStrategy           string
+	hostTemplate               string
 	includeUnnamedIngresses    bool
 	namespaceSelectors         []string
 	matchAllNamespaceSelectors bool
 
-	pushgatewayURL             string
-	pushgatewayIntervalSeconds int
-	pushgatewayLabels          cmd.KeyValues
+	pushgateway       cmd.Pushgateway
+	pushgatewayLabels cmd.KeyValues
+	metricsExporters  []string
+	statsDConfig      metrics.StatsDConfig
 )
 
 const (
 	unset = -1
 
-	defaultResyncPeriod      = time.Minute * 15
-	defaultIngressPort       = unset
-	defaultIngressHTTPSPort  = unset
-	defaultIngressHealthPort = 8081
-	defaultIngressAllow      = "0.0.0.0/0"
-	defaultIngressStripPath  = true
-	defaultIngressExactPath  = false
-	defaultHealthPort        = 12082
+	defaultResyncPeriod        = time.Minute * 15
+	defaultUpdaterTimeout      = time.Minute * 2
+	defaultSlowUpdateThreshold = time.Second * 30
+	defaultLoopStuckAfter      = time.Minute * 10
+	defaultIngressPort         = unset
+	defaultIngressHTTPSPort    = unset
+	defaultIngressHealthPort   = 8081
+	defaultIngressAllow        = "0.0.0.0/0"
+	defaultIngressStripPath    = true
+	defaultIngressExactPath    = false
+	defaultHealthPort          = 12082
+	defaultDebugPort           = 12083
 
 	defaultNginxBinary                       = "/usr/sbin/nginx"
 	defaultNginxWorkingDir                   = "/nginx"
 	defaultNginxWorkers                      = 1
 	defaultNginxWorkerConnections            = 1024
 	defaultNginxWorkerShutdownTimeoutSeconds = 0
+	defaultIngressBindAddress                = ""
+	defaultNginxIPv6                         = false
+	defaultNginxSSLPassthroughPort           = 8444
+	defaultNginxWorkerRlimitNofile           = 0
+	defaultNginxMultiAccept                  = true
+	defaultNginxUseEpoll                     = true
+	defaultNginxResetTimedoutConnection      = false
 	defaultNginxKeepAliveSeconds             = 60
 	defaultNginxBackendKeepalives            = 512
 	defaultNginxBackendTimeoutSeconds        = 60
@@ -85,19 +119,49 @@ const (
 	defaultNginxServerNamesHashMaxSize       = unset
 	defaultNginxProxyProtocol                = false
 	defaultNginxUpdatePeriod                 = time.Second * 30
+	defaultNginxHSTSMaxAge                   = time.Hour * 24 * 365
 	defaultNginxSSLPath                      = "/etc/ssl/default-ssl/default-ssl"
 	defaultNginxVhostStatsSharedMemory       = 1
 	defaultNginxOpenTracingPluginPath        = ""
 	defaultNginxOpenTracingConfigPath        = ""
+	defaultTracingServiceName                = "feed-ingress"
 	defaultAccessLogDir                      = "/var/log/nginx"
+	defaultAccessLogBufferSizeKB             = 32
+	defaultAccessLogFlushInterval            = time.Minute
+	defaultAccessLogMaxSizeMB                = 0
+	defaultAccessLogRotateInterval           = time.Duration(0)
+	defaultAccessLogMaxFiles                 = 5
 	defaultClientHeaderBufferSize            = 16
 	defaultClientBodyBufferSize              = 16
 	defaultLargeClientHeaderBufferBlocks     = 4
 	defaultSetRealIPFromHeader               = "X-Forwarded-For"
+	defaultNginxMetricsHostLevelOnly         = false
+	defaultNginxMetricsMaxIngressSeries      = 0
+	defaultNginxMetricsRequestSizes          = false
+	defaultNginxMetricsUpdateInterval        = time.Second * 10
+
+	defaultACMEStateDir    = "/var/lib/feed/acme"
+	defaultACMERenewBefore = time.Hour * 24 * 30
+	defaultACMEAPIRetries  = 5
+
+	defaultSPIFFEStartTimeout = time.Minute
+
+	defaultVaultKubernetesAuthMount = "kubernetes"
+	defaultVaultPKIMount            = "pki"
+	defaultVaultKVMount             = "secret"
+	defaultVaultRenewBefore         = time.Hour * 24
+	defaultVaultCheckInterval       = time.Minute * 5
+
+	defaultExternalUpdaterTimeout = time.Second * 30
+	defaultPreDrainTimeout        = time.Second * 30
 
 	defaultIngressClassName           = ""
 	defaultIncludeUnnamedIngresses    = false
 	defaultPushgatewayIntervalSeconds = 60
+	defaultStatsDAddress              = "127.0.0.1:8125"
+	defaultStatsDPrefix               = ""
+	defaultStatsDDogStatsD            = false
+	defaultStatsDInterval             = 10 * time.Second
 )
 
 const (
@@ -112,6 +176,11 @@ const (
 func init() {
 	configureGeneralFlags()
 	configureNginxFlags()
+	configureACMEFlags()
+	configureVaultFlags()
+	configureExternalUpdaterFlags()
+	configurePreDrainFlags()
+	configureShutdownFlags()
 	configurePrometheusFlags()
 }
 
@@ -122,12 +191,87 @@ func configureGeneralFlags() {
 		"Path to kubeconfig for connecting to the apiserver. Leave blank to connect inside a cluster.")
 	rootCmd.PersistentFlags().DurationVar(&resyncPeriod, "resync-period", defaultResyncPeriod,
 		"Resync with the apiserver periodically to handle missed updates.")
+	rootCmd.PersistentFlags().IntVar(&controllerConfig.Shard.Index, "shard-index", 0,
+		"Index of the shard of hosts served by this feed-ingress, from 0 to --shard-count - 1.")
+	rootCmd.PersistentFlags().IntVar(&controllerConfig.Shard.Count, "shard-count", 0,
+		"Number of shards to divide hosts between by hash, each served by its own group of feed-ingress instances "+
+			"and frontends. 0 or 1 serves every host.")
+	rootCmd.PersistentFlags().StringVar(&hostTemplate, "ingress-host-template", "",
+		"Template generating the host of ingress rules without one, from the ingress's {name} and {namespace}, "+
+			"such as {name}.{namespace}.example.com. Leave blank to skip rules without a host.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.WatchStaleAfter, "kubernetes-watch-stale-after", 0,
+		"Fail health when a watched resource hasn't been listed or had a watch event from the apiserver for this long, "+
+			"as its watch may have silently stopped. The apiserver ends watches every 5-10 minutes, so this should be "+
+			"longer than that. Set to 0 to disable.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.LoopStuckAfter, "update-loop-stuck-after", defaultLoopStuckAfter,
+		"Fail liveness on /alive when the update loop hasn't gone round for this long, as an update is stuck. "+
+			"It goes round every 10s without updates, so this must be longer, and should be longer than --updater-timeout. "+
+			"Set to 0 to disable.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.UpdaterTimeout, "updater-timeout", defaultUpdaterTimeout,
+		"How long each updater, such as nginx or a load balancer, has to apply an update before it's considered failed. "+
+			"Updaters which don't depend on each other are updated concurrently. Set to 0 for no limit.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.SlowUpdateThreshold, "slow-update-threshold", defaultSlowUpdateThreshold,
+		"Log a warning with how long each step and updater took, such as rendering the nginx config, when an update "+
+			"takes longer than this. Set to 0 to disable.")
 	rootCmd.PersistentFlags().IntVar(&ingressPort, "ingress-port", defaultIngressPort,
 		"Port to serve ingress traffic to backend services.")
 	rootCmd.PersistentFlags().IntVar(&ingressHTTPSPort, "ingress-https-port", defaultIngressHTTPSPort,
 		"Port to serve ingress https traffic to backend services.")
+	rootCmd.PersistentFlags().StringArrayVar(&ingressListeners, "ingress-listen", []string{},
+		"Another port to serve ingress traffic on, with its own settings, as "+
+			"port[,ssl][,http2][,proxy-protocol][,scheme=<scheme>]. A port with a scheme only serves ingresses with that "+
+			"sky.uk/frontend-scheme. "+
+			"Can be repeated, e.g. --ingress-listen=80,proxy-protocol --ingress-listen=443,ssl,http2. "+
+			"--nginx-proxy-protocol and --nginx-http2 still apply to every port.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.UnixSocket, "ingress-unix-socket", "",
+		"Path of a Unix domain socket to also serve plain http ingress traffic on, for running as a sidecar behind "+
+			"another local proxy. X-Forwarded-For from clients of the socket is trusted.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.IngressBindAddress, "ingress-bind-address", defaultIngressBindAddress,
+		"Address to serve ingress traffic on. Leave blank to serve on all IPv4 addresses.")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.SSLPassthroughPort, "nginx-ssl-passthrough-port", defaultNginxSSLPassthroughPort,
+		"Local port for terminating https traffic when any ingress uses the sky.uk/ssl-passthrough annotation. "+
+			"The https port then routes connections by SNI, passing them through or on to this port. Each further "+
+			"ssl port of --ingress-listen uses the next port up.")
+	rootCmd.PersistentFlags().BoolVar(&nginxConfig.IPv6, "nginx-ipv6", defaultNginxIPv6,
+		"Also serve ingress traffic on all IPv6 addresses, for dual-stack clusters.")
 	rootCmd.PersistentFlags().IntVar(&ingressHealthPort, "ingress-health-port", defaultIngressHealthPort,
-		"Port for ingress /health and /status pages. Should be used by frontends to determine if ingress is available.")
+		"Port for ingress /health, /ready and /status pages. Should be used by frontends to determine if ingress is available.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.ReadyCanary, "ingress-ready-canary", "",
+		"Namespace/name of an ingress whose backends must be reachable for /ready on the ingress health port to "+
+			"succeed. Leave blank for /ready to succeed once the ingresses are configured.")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.ValidationPort, "nginx-validation-port", 0,
+		"Loopback port to start a second nginx on with each changed config, to run --nginx-validation-probe against "+
+			"before the config is loaded. The current config is kept if a probe fails. 0 disables validation.")
+	rootCmd.PersistentFlags().StringArrayVar(&nginxConfig.ValidationProbes, "nginx-validation-probe", []string{},
+		"A host/path to request from the validation nginx, which fails on a connection error or 5xx response. "+
+			"Can be repeated.")
+	rootCmd.PersistentFlags().DurationVar(&nginxConfig.ValidationTimeout, "nginx-validation-timeout", 0,
+		"How long the validation nginx has to start and answer the probes. 0 uses 10s.")
+	rootCmd.PersistentFlags().StringArrayVar(&nginxConfig.SelfChecks, "nginx-self-check", []string{},
+		"A host/path to request through the live nginx every --nginx-self-check-interval, on its first plain http port, "+
+			"which fails on a connection error or 5xx response. Exported as feed_ingress_self_check_success and "+
+			"feed_ingress_self_check_duration_seconds. Can be repeated.")
+	rootCmd.PersistentFlags().DurationVar(&nginxConfig.SelfCheckInterval, "nginx-self-check-interval", 0,
+		"How often the --nginx-self-check requests are made. 0 uses 30s.")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.MaxRestarts, "nginx-max-restarts", 0,
+		"How many times in a row to start nginx again after it exits unexpectedly, keeping feed-ingress up meanwhile. "+
+			"0 leaves nginx stopped, failing the health check.")
+	rootCmd.PersistentFlags().DurationVar(&nginxConfig.RestartBackoff, "nginx-restart-backoff", 0,
+		"How long to wait before restarting nginx, doubling for each restart in a row up to "+
+			"--nginx-restart-max-backoff. 0 uses 1s.")
+	rootCmd.PersistentFlags().DurationVar(&nginxConfig.RestartMaxBackoff, "nginx-restart-max-backoff", 0,
+		"The longest wait before restarting nginx. Restarts are counted from zero again once nginx stays up this long. "+
+			"0 uses 1m.")
+	rootCmd.PersistentFlags().DurationVar(&nginxConfig.RollbackWindow, "nginx-rollback-window", 0,
+		"How long to watch nginx after a reload for crashing workers, or server errors above "+
+			"--nginx-rollback-server-error-ratio, before rolling back to the last good config. The config is loaded "+
+			"again if the failure carries on for another window after rolling back. Reloads are held meanwhile. "+
+			"0 disables rollback.")
+	rootCmd.PersistentFlags().Float64Var(&nginxConfig.RollbackServerErrorRatio, "nginx-rollback-server-error-ratio", 0,
+		"Share of responses, from 0 to 1, which can be server errors after a reload before it's rolled back. "+
+			"0 only rolls back when workers crash.")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.ConfigHistory, "nginx-config-history", 0,
+		"Number of previous nginx configs to keep in the working directory, as nginx.conf.1 for the most recent.")
 	rootCmd.PersistentFlags().StringVar(&controllerConfig.DefaultAllow, "ingress-allow", defaultIngressAllow,
 		"Source IP or CIDR to allow ingress access by default. This is overridden by the sky.uk/allow "+
 			"annotation on ingress resources. Leave empty to deny all access by default.")
@@ -144,7 +288,23 @@ func configureGeneralFlags() {
 			" If disabled, it would match both (and redirect requests from 'myhost/myapp/health' to "+
 			" '/myhost/myapp/health/'. Can be overridden with the sky.uk/exact-path annotation per ingress")
 	rootCmd.PersistentFlags().IntVar(&healthPort, "health-port", defaultHealthPort,
-		"Port for checking the health of the ingress controller on /health. Also provides /debug/pprof.")
+		"Port for checking the health of the ingress controller on /health.")
+	rootCmd.PersistentFlags().StringVar(&healthPortTLS.CertFile, "health-port-tls-cert", "",
+		"Certificate file for serving the health port over https. Leave blank to serve over http.")
+	rootCmd.PersistentFlags().StringVar(&healthPortTLS.KeyFile, "health-port-tls-key", "",
+		"Private key file for serving the health port over https.")
+	rootCmd.PersistentFlags().StringVar(&healthPortTLS.ClientCAFile, "health-port-client-ca", "",
+		"CA file used to verify client certificates on the health port. Requires --health-port-tls-cert. "+
+			"Leave blank to not require client certificates.")
+	rootCmd.PersistentFlags().IntVar(&adminPort.Port, "admin-port", 0,
+		"Port on localhost for admin actions, such as "+cmd.ResyncPath+" and "+nginxUpgradePath+". "+
+			"Leave as 0 to disable them.")
+	rootCmd.PersistentFlags().StringVar(&adminPort.TokenFile, "admin-token-file", "",
+		"File holding a token which admin actions must send as a bearer token. Leave blank to not require one.")
+	rootCmd.PersistentFlags().IntVar(&debugPort.Port, "debug-port", defaultDebugPort,
+		"Port for /debug/pprof. It only listens on localhost unless --debug-allow is set. Set to 0 to disable it.")
+	rootCmd.PersistentFlags().StringSliceVar(&debugPort.Allow, "debug-allow", []string{},
+		"CIDRs of clients allowed to reach the debug port besides localhost, which makes it listen on all interfaces.")
 	rootCmd.PersistentFlags().StringVar(&ingressClassName, ingressClassFlag, defaultIngressClassName,
 		fmt.Sprintf("The name of this instance. It will consider only ingress resources with matching %s annotation values.", ingressClassAnnotation))
 	rootCmd.PersistentFlags().BoolVar(&includeUnnamedIngresses, includeClasslessIngressesFlag, defaultIncludeUnnamedIngresses,
@@ -153,6 +313,63 @@ func configureGeneralFlags() {
 		"Only consider ingresses within namespaces having labels matching the selectors (e.g. app=loadtest).")
 	rootCmd.PersistentFlags().BoolVar(&matchAllNamespaceSelectors, matchAllNamespaceSelectorFlags, false,
 		fmt.Sprintf("Use only those namespaces containing all the labels passed in %s flag. Default is any i.e or match of labels", ingressControllerNamespaceSelectorsFlag))
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.RoutePolicies, "route-policies", false,
+		"Configure routes with FeedRoutePolicy resources, which override annotations. Requires the CRD from "+
+			"examples/feed-route-policy-crd.yml to be installed.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.AllowFromConfigMaps, "allow-from-configmaps", false,
+		"Read allowed CIDRs from the config map referenced by the sky.uk/allow-from-configmap annotation, "+
+			"which must be labelled feed.sky.uk/allow-list=true. Requires permission to get, list and watch config maps.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.APIKeysFromSecrets, "api-keys-from-secrets", false,
+		"Only allow requests with an API key from the secret referenced by the sky.uk/api-keys-from-secret annotation, "+
+			"which must be labelled feed.sky.uk/api-keys=true. Requires permission to get, list and watch secrets.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.CheckEndpoints, "check-endpoints", false,
+		"Report ingresses whose service port has no ready endpoints, with an event and the "+
+			"feed_controller_ingress_unready_backends metric. They're still served. Requires permission to get, "+
+			"list and watch endpoint slices.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.EndpointsMode, "endpoints-mode", false,
+		"Proxy to the ready pods of each ingress's service port rather than its cluster IP, falling back to the "+
+			"cluster IP while there are none. Requires permission to get, list and watch endpoint slices.")
+	rootCmd.PersistentFlags().StringVar(&controllerConfig.EndpointsZone, "endpoints-zone", "",
+		"With --endpoints-mode, the zone of the node feed runs on, such as its topology.kubernetes.io/zone label. "+
+			"Ready pods in the zone are preferred, and pods in other zones are only used when those in it are "+
+			"unavailable.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.UpstreamWeights, "upstream-weights", false,
+		"With --endpoints-mode, weight each pod of a service by its sky.uk/upstream-weight annotation, from 1 to "+
+			"100, relative to the other pods. Only pods labelled feed.sky.uk/weighted=true are watched. Requires "+
+			"permission to get, list and watch pods.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.ReferencedServicesOnly, "referenced-services-only", false,
+		"Only keep the services referenced by the backends and backup services of this instance's ingresses, rather "+
+			"than every service in the cluster, to save memory and updates in big clusters. Services are listed again "+
+			"whenever an ingress references a new one.")
+	rootCmd.PersistentFlags().StringVar(&conflictStrategy, "conflict-strategy", string(controller.ConflictByName),
+		"Which ingress is used when several have the same host and path: name (first by namespace and name), oldest, "+
+			"newest, priority (highest sky.uk/route-priority annotation, then oldest) or same-namespace (the namespace "+
+			"with the most paths on the host, then oldest). The others get a HostPathConflict event.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.NamespaceDefaults, "namespace-defaults", false,
+		"Use sky.uk/* ingress annotations set on a namespace, such as sky.uk/allow, as defaults for the ingresses in it.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.HostOwnership, "host-ownership", false,
+		"Only allow ingresses to use a host owned by their namespace. A host is owned by the namespace of its oldest "+
+			"ingress, until that namespace has no ingresses for it. Others get a HostOwnedByAnotherNamespace event.")
+	rootCmd.PersistentFlags().IntVar(&controllerConfig.NamespaceQuota.MaxHosts, "namespace-max-hosts", 0,
+		"Maximum hosts the ingresses of each namespace can use, or 0 for no limit. The oldest ingresses use the quota "+
+			"first, and entries beyond it get a NamespaceQuotaExceeded event.")
+	rootCmd.PersistentFlags().IntVar(&controllerConfig.NamespaceQuota.MaxPaths, "namespace-max-paths", 0,
+		"Maximum host/path entries the ingresses of each namespace can have, or 0 for no limit.")
+	rootCmd.PersistentFlags().IntVar(&controllerConfig.NamespaceQuota.MaxRateLimitZones, "namespace-max-rate-limit-zones", 0,
+		"Maximum rate limits, per client or per API key, the ingresses of each namespace can have, as each needs its "+
+			"own nginx shared memory zone, or 0 for no limit.")
+	rootCmd.PersistentFlags().StringVar(&controllerConfig.RoutingTableFile, "routing-table-file", "",
+		"File to write the routing table to as JSON after each successful update, for other tools to consume. "+
+			"Leave blank to not write it.")
+	rootCmd.PersistentFlags().StringVar(&controllerConfig.AuditLogFile, "audit-log-file", "",
+		"File to append a JSON line to for each change to an ingress's entries applied by an update, with who made "+
+			"the change from the ingress's managed fields. Leave blank to not keep an audit log.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.RemovalDrainWindow, "removal-drain-window", 0,
+		"Keep the paths of deleted ingresses for this long, returning 503 for new requests while those in flight "+
+			"finish, before removing them. 0 removes them at the next update.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.AllowZeroIngresses, "allow-zero-ingresses", false,
+		"Start nginx and stay healthy when there are no ingresses, serving a 404 for every request, e.g. to bootstrap "+
+			"a new cluster. The feed_controller_ingress_entries metric can be used to alert when there are none.")
 
 	_ = rootCmd.PersistentFlags().MarkDeprecated(includeClasslessIngressesFlag,
 		fmt.Sprintf("please annotate ingress resources explicitly with %s", ingressClassAnnotation))
@@ -163,27 +380,87 @@ func configureNginxFlags() {
 		"Location of nginx binary.")
 	rootCmd.PersistentFlags().StringVar(&nginxConfig.WorkingDir, "nginx-workdir", defaultNginxWorkingDir,
 		"Directory to store nginx files. Also the location of the nginx.tmpl file.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.ConfDir, "nginx-conf-dir", "",
+		"Directory to write nginx.conf and the files it includes to. Leave blank to use --nginx-workdir.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.PidPath, "nginx-pid-file", "",
+		"File nginx writes its pid to. The ssl passthrough socket is created alongside it. Leave blank for nginx.pid "+
+			"in --nginx-workdir.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.TempDir, "nginx-temp-dir", "",
+		"Directory nginx buffers request and response bodies in, as client_body_temp, proxy_temp, fastcgi_temp, "+
+			"uwsgi_temp and scgi_temp. Leave blank for the paths compiled into nginx.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.ClientBodyTempPath, "nginx-client-body-temp-path", "",
+		"Directory nginx buffers large request bodies in, instead of client_body_temp in --nginx-temp-dir.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.ProxyTempPath, "nginx-proxy-temp-path", "",
+		"Directory nginx buffers large responses from backends in, instead of proxy_temp in --nginx-temp-dir.")
+	rootCmd.PersistentFlags().StringSliceVar(&nginxConfig.Templates, "nginx-template", []string{},
+		"Templates to render nginx.conf from. The first is rendered, and later templates can redefine the named "+
+			"templates it uses. Specify multiple times or comma separated. Leave empty to use nginx.tmpl in --nginx-workdir.")
 	rootCmd.PersistentFlags().IntVar(&nginxConfig.WorkerProcesses, "nginx-workers", defaultNginxWorkers,
 		"Number of nginx worker processes.")
 	rootCmd.PersistentFlags().IntVar(&nginxConfig.WorkerConnections, "nginx-worker-connections", defaultNginxWorkerConnections,
 		"Max number of connections per nginx worker. Includes both client and proxy connections.")
 	rootCmd.PersistentFlags().IntVar(&nginxConfig.WorkerShutdownTimeoutSeconds, "nginx-worker-shutdown-timeout-seconds", defaultNginxWorkerShutdownTimeoutSeconds,
 		"Timeout for a graceful shutdown of worker processes.")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.WorkerRlimitNofile, "nginx-worker-rlimit-nofile", defaultNginxWorkerRlimitNofile,
+		"Limit on the number of open files for nginx worker processes. Should be at least double "+
+			"nginx-worker-connections. Set to 0 to use the limit nginx is started with.")
+	rootCmd.PersistentFlags().BoolVar(&nginxConfig.MultiAccept, "nginx-multi-accept", defaultNginxMultiAccept,
+		"Accept all new connections at once in each nginx worker, rather than one at a time.")
+	rootCmd.PersistentFlags().BoolVar(&nginxConfig.UseEpoll, "nginx-use-epoll", defaultNginxUseEpoll,
+		"Explicitly use the epoll connection processing method in nginx.")
+	rootCmd.PersistentFlags().BoolVar(&nginxConfig.ResetTimedoutConnection, "nginx-reset-timedout-connection", defaultNginxResetTimedoutConnection,
+		"Reset timed out client connections, freeing their memory immediately.")
 	rootCmd.PersistentFlags().IntVar(&nginxConfig.KeepaliveSeconds, "nginx-keepalive-seconds", defaultNginxKeepAliveSeconds,
 		"Keep alive time for persistent client connections to nginx. Should generally be set larger than frontend "+
 			"keep alive times to prevent stale connections.")
 	rootCmd.PersistentFlags().IntVar(&nginxConfig.BackendKeepalives, "nginx-backend-keepalive-count", defaultNginxBackendKeepalives,
 		"Maximum number of keepalive connections per backend service. Keepalive connections count against"+
 			" nginx-worker-connections limit, and will be restricted by that global limit as well.")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.MaxBackendKeepalives, "nginx-max-backend-keepalive-count", 0,
+		"Cap on the keepalive connections per backend service, including those set per ingress with the "+
+			"sky.uk/backend-keepalive-count annotation. Set to 0 for no cap.")
 	rootCmd.PersistentFlags().IntVar(&controllerConfig.DefaultBackendTimeoutSeconds, "nginx-default-backend-timeout-seconds",
 		defaultNginxBackendTimeoutSeconds,
 		"Timeout for requests to backends. Can be overridden per ingress with the sky.uk/backend-timeout-seconds annotation.")
+	rootCmd.PersistentFlags().BoolVar(&controllerConfig.DefaultWebSocketUpgrade, "nginx-allow-websocket-upgrade", false,
+		"Proxy WebSocket upgrade requests to backends. Can be overridden per ingress with the sky.uk/websocket-upgrade "+
+			"annotation, and the timeout of upgraded connections set with sky.uk/websocket-timeout.")
 	rootCmd.PersistentFlags().IntVar(&nginxConfig.BackendConnectTimeoutSeconds, "nginx-backend-connect-timeout-seconds",
 		defaultNginxBackendConnectTimeoutSeconds,
 		"Connect timeout to backend services.")
+	rootCmd.PersistentFlags().DurationVar(&nginxConfig.UpstreamSlowStart, "nginx-upstream-slow-start", 0,
+		"With --endpoints-mode, ramp the traffic to new pods of an ingress's service over this period, in steps of 10% "+
+			"at each reload. Set to 0 to give them their full share at once.")
 	rootCmd.PersistentFlags().IntVar(&controllerConfig.DefaultBackendMaxConnections, "nginx-default-backend-max-connections",
 		defaultNginxBackendMaxConnections,
 		"Maximum number of connections to a single backend. Can be overridden per ingress with the sky.uk/backend-max-connections annotation.")
+	rootCmd.PersistentFlags().IntVar(&controllerConfig.DefaultBackendMaxFails, "nginx-default-backend-max-fails", 0,
+		"Failed requests within the fail timeout after which a backend is ejected for the fail timeout. "+
+			"Set to 0 for nginx's default of 1. Can be overridden per ingress with the sky.uk/backend-max-fails annotation.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.DefaultBackendFailTimeout, "nginx-default-backend-fail-timeout", 0,
+		"Period over which backend failures are counted, and for which a failed backend is ejected. "+
+			"Set to 0 for nginx's default of 10s. Can be overridden per ingress with the sky.uk/backend-fail-timeout annotation.")
+	rootCmd.PersistentFlags().StringVar(&defaultInterceptErrors, "nginx-default-intercept-errors", "",
+		"Comma separated backend status codes, between 300 and 599, to replace with the pages in --nginx-error-pages-dir. "+
+			"Can be overridden per ingress with the sky.uk/intercept-errors annotation.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.ErrorPagesDir, "nginx-error-pages-dir", "",
+		"Directory of <status>.html pages, e.g. 500.html, which replace backend errors intercepted with "+
+			"--nginx-default-intercept-errors or the sky.uk/intercept-errors annotation. Leave blank to disable.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.SecurityHeaders, "nginx-security-headers", "off",
+		fmt.Sprintf("Profile of security headers added to every response, one of %v. "+
+			"Can be overridden per ingress with the sky.uk/security-headers annotation.", nginx.SecurityHeaderProfiles()))
+	rootCmd.PersistentFlags().StringSliceVar(&nginxConfig.HTTPSRedirectSchemes, "nginx-https-redirect-schemes", []string{},
+		"Comma separated frontend schemes, e.g. internet-facing, whose ingresses redirect plain http requests to https. "+
+			"The scheme is set per ingress with the sky.uk/frontend-scheme annotation.")
+	rootCmd.PersistentFlags().StringSliceVar(&nginxConfig.HSTSSchemes, "nginx-hsts-schemes", []string{},
+		"Comma separated frontend schemes, e.g. internet-facing, whose ingresses add a Strict-Transport-Security header "+
+			"to https responses.")
+	rootCmd.PersistentFlags().DurationVar(&nginxConfig.HSTSMaxAge, "nginx-hsts-max-age", defaultNginxHSTSMaxAge,
+		"max-age of the Strict-Transport-Security header added for --nginx-hsts-schemes. Set to 0 to add none.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.TrailingSlash, "nginx-trailing-slash", "301",
+		fmt.Sprintf("How a path is handled when requested without its trailing slash, one of %v: a redirect with that status "+
+			"code, or serve to proxy it without redirecting. Can be overridden per ingress with the sky.uk/trailing-slash "+
+			"annotation.", nginx.TrailingSlashModes()))
 	rootCmd.PersistentFlags().IntVar(&controllerConfig.DefaultProxyBufferSize, "nginx-default-proxy-buffer-size",
 		defaultNginxProxyBufferSize,
 		"Proxy buffer size for response. Can be overridden per ingress with the sky.uk/proxy-buffer-size-in-kb annotation.")
@@ -206,13 +483,52 @@ func configureNginxFlags() {
 		"How often nginx reloads can occur. Too frequent will result in many nginx worker processes alive at the same time.")
 	rootCmd.PersistentFlags().StringVar(&nginxConfig.AccessLogDir, "access-log-dir", defaultAccessLogDir, "Access logs direcoty.")
 	rootCmd.PersistentFlags().BoolVar(&nginxConfig.AccessLog, "access-log", false, "Enable access logs directive.")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.AccessLogBufferSizeKB, "access-log-buffer-size", defaultAccessLogBufferSizeKB,
+		"Size in KB of the buffer for writing access logs. Set to 0 to write access logs unbuffered.")
+	rootCmd.PersistentFlags().DurationVar(&nginxConfig.AccessLogFlushInterval, "access-log-flush-interval", defaultAccessLogFlushInterval,
+		"Maximum time buffered access logs are kept before being written. Set to 0 to only write when the buffer is full.")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.AccessLogMaxSizeMB, "access-log-max-size-mb", defaultAccessLogMaxSizeMB,
+		"Rotate the access log once it reaches this size in MB. Set to 0 to not rotate by size.")
+	rootCmd.PersistentFlags().DurationVar(&nginxConfig.AccessLogRotateInterval, "access-log-rotate-interval", defaultAccessLogRotateInterval,
+		"Rotate the access log at this interval. Set to 0 to not rotate periodically.")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.AccessLogMaxFiles, "access-log-max-files", defaultAccessLogMaxFiles,
+		"Number of rotated access logs to keep. Set to 0 to keep all of them.")
 	rootCmd.PersistentFlags().StringSliceVar(&nginxLogHeaders, "nginx-log-headers", []string{}, "Comma separated list of headers to be logged in access logs")
 	rootCmd.PersistentFlags().StringSliceVar(&nginxTrustedFrontends, "nginx-trusted-frontends", []string{},
 		"Comma separated list of CIDRs to trust when determining the client's real IP from "+
 			"frontends. The client IP is used for allowing or denying ingress access. "+
 			"This will typically be the ELB subnet.")
+	rootCmd.PersistentFlags().StringSliceVar(&nginxConfig.GlobalDeny, "ingress-global-deny", []string{},
+		"Comma separated list of CIDRs to deny in every location, regardless of each ingress's sky.uk/allow, "+
+			"e.g. known scanners.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.GlobalDenyFile, "ingress-global-deny-file", "",
+		"File of more CIDRs to deny in every location, one per line with # comments. Changes are picked up without "+
+			"a restart, e.g. when mounted from a ConfigMap.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.GeoIPDatabase, "geoip-database", "",
+		"Path to a MaxMind country database (.mmdb), used by the sky.uk/allow-countries and sky.uk/deny-countries annotations. "+
+			"Requires the nginx geoip2 module. Leave blank to disable.")
+	rootCmd.PersistentFlags().StringArrayVar(&nginxConfig.NJSModules, "nginx-njs-module", []string{},
+		"JavaScript file to load with the nginx njs module, named after the file without .js. Ingresses handle requests "+
+			"with its functions using the sky.uk/njs-content and sky.uk/njs-header-filter annotations. Can be repeated. "+
+			"Requires the nginx njs module.")
+	rootCmd.PersistentFlags().BoolVar(&nginxConfig.HTTP2, "nginx-http2", false,
+		"Accept HTTP/2 from clients on the https ports. gRPC clients need it to reach h2c backends.")
 	rootCmd.PersistentFlags().StringVar(&nginxSSLPath, "ssl-path", defaultNginxSSLPath,
 		"Set default ssl path + name file without extension.  Feed expects two files: one ending in .crt (the CA) and the other in .key (the private key).")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.SSLCertificatesDir, "ssl-certs-dir", "",
+		"Directory of <name>.crt and <name>.key pairs. Each host uses the certificate in this directory valid for it, "+
+			"preferring exact matches over wildcards, or the default from --ssl-path if none match. Leave blank to use the default for all hosts.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.SSLSessionTicketKeysDir, "ssl-session-ticket-keys-dir", "",
+		"Directory of 48 or 80 byte TLS session ticket keys shared by all replicas, e.g. from a Secret. Keys are used in lexical order, "+
+			"with the first encrypting new tickets, and nginx is reloaded when they change. Leave blank to disable session tickets.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.SPIFFESVIDDir, "spiffe-svid-dir", "",
+		"Directory of the X.509 SVID, as svid.pem and svid_key.pem, presented to backends with the sky.uk/backend-spiffe annotation, "+
+			"and the trust bundles they're verified against, as svid_bundle.pem. Leave blank to disable.")
+	rootCmd.PersistentFlags().StringVar(&spiffeConfig.WorkloadAPIAddress, "spiffe-workload-api-address", "",
+		"Address of the SPIFFE Workload API, e.g. unix:///run/spire/sockets/agent.sock, to keep the SVID and trust bundles "+
+			"in --spiffe-svid-dir up to date from. Leave blank if they're written by something else, such as spiffe-helper.")
+	rootCmd.PersistentFlags().DurationVar(&spiffeConfig.StartTimeout, "spiffe-start-timeout", defaultSPIFFEStartTimeout,
+		"How long to wait for the first SVID from the SPIFFE Workload API when starting.")
 	rootCmd.PersistentFlags().IntVar(&nginxVhostStatsSharedMemory, "nginx-vhost-stats-shared-memory", defaultNginxVhostStatsSharedMemory,
 		"Memory (in MiB) which should be allocated for use by the vhost statistics module")
 	rootCmd.PersistentFlags().StringSliceVar(&nginxVhostStatsRequestBuckets, "nginx-vhost-stats-request-buckets", []string{},
@@ -221,19 +537,154 @@ func configureNginxFlags() {
 		"Path to OpenTracing plugin on disk (eg. /usr/local/lib/libjaegertracing_plugin.so)")
 	rootCmd.PersistentFlags().StringVar(&nginxOpenTracingConfigPath, "nginx-opentracing-config-path", defaultNginxOpenTracingConfigPath,
 		"Path to OpenTracing config on disk (eg. /etc/jaeger-nginx-config.json)")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.TracingVendor, "tracing-vendor", "",
+		fmt.Sprintf("Enable OpenTracing with a generated config for one of %v, instead of --nginx-opentracing-config-path. "+
+			"The vendor's plugin is used unless --nginx-opentracing-plugin-path is set.", nginx.TracingVendors()))
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.TracingEndpoint, "tracing-endpoint", "",
+		"host:port of the tracing vendor's agent or collector. Defaults to the vendor's usual port on localhost.")
+	rootCmd.PersistentFlags().StringVar(&nginxConfig.TracingServiceName, "tracing-service-name", defaultTracingServiceName,
+		"Service name reported in traces by --tracing-vendor.")
+	rootCmd.PersistentFlags().BoolVar(&nginxConfig.TracingExemplars, "tracing-exemplars", false,
+		"Export the time of traced requests per ingress as feed_ingress_ingress_traced_request_time_seconds, with "+
+			"their trace IDs as OpenMetrics exemplars. Requires --tracing-vendor.")
 	rootCmd.PersistentFlags().IntVar(&nginxConfig.ClientHeaderBufferSize, "nginx-client-header-buffer-size-in-kb", defaultClientHeaderBufferSize, "Sets buffer size for reading client request header")
 	rootCmd.PersistentFlags().IntVar(&nginxConfig.ClientBodyBufferSize, "nginx-client-body-buffer-size-in-kb", defaultClientBodyBufferSize, "Sets buffer size for reading client request body")
 	rootCmd.PersistentFlags().IntVar(&nginxConfig.LargeClientHeaderBufferBlocks, "nginx-large-client-header-buffer-blocks", defaultLargeClientHeaderBufferBlocks, "Sets the maximum number of buffers used for reading large client request header")
 	rootCmd.PersistentFlags().StringVar(&nginxConfig.NginxSetRealIPFromHeader, "set-real-ip-from-header", defaultSetRealIPFromHeader, "Sets the name of the header to use to derive real ip for allow/deny")
+	rootCmd.PersistentFlags().BoolVar(&nginxConfig.MetricsHostLevelOnly, "nginx-metrics-host-level-only", defaultNginxMetricsHostLevelOnly,
+		"Aggregate the per-ingress request and byte metrics by host, rather than by host and path.")
+	rootCmd.PersistentFlags().StringSliceVar(&nginxMetricsAllowedHosts, "nginx-metrics-allowed-hosts", []string{},
+		"Comma separated list of hosts to export per-ingress metrics for. Metrics for all other hosts are "+
+			"aggregated under the host 'other'. Leave empty to export metrics for all hosts.")
+	rootCmd.PersistentFlags().IntVar(&nginxConfig.MetricsMaxIngressSeries, "nginx-metrics-max-ingress-series", defaultNginxMetricsMaxIngressSeries,
+		"Maximum number of host/path series to export per-ingress metrics for. Once reached, metrics for new "+
+			"series are aggregated under the host and path 'other'. Set to 0 for no limit.")
+	rootCmd.PersistentFlags().DurationVar(&nginxConfig.MetricsUpdateInterval, "nginx-metrics-update-interval", defaultNginxMetricsUpdateInterval,
+		"How often to poll the nginx vhost stats for metrics. Each poll is jittered by up to 10%, and the stats are only "+
+			"parsed when they've changed.")
+	rootCmd.PersistentFlags().BoolVar(&nginxConfig.MetricsRequestSizes, "nginx-metrics-request-sizes", defaultNginxMetricsRequestSizes,
+		"Export the number of requests by size for each ingress host and path. This adds a second vhost stats filter "+
+			"to every location, so may need a larger --nginx-vhost-stats-shared-memory.")
+}
+
+func configureACMEFlags() {
+	rootCmd.PersistentFlags().BoolVar(&acmeEnabled, "acme", false,
+		"Obtain and renew certificates from an ACME server for hosts with the sky.uk/acme annotation. "+
+			"Certificates are written to --ssl-certs-dir, which is required.")
+	rootCmd.PersistentFlags().StringVar(&acmeConfig.DirectoryURL, "acme-directory-url", acme.LetsEncryptDirectoryURL,
+		"Directory URL of the ACME server.")
+	rootCmd.PersistentFlags().StringVar(&acmeConfig.Email, "acme-email", "",
+		"Email address to register the ACME account with, for certificate expiry notices.")
+	rootCmd.PersistentFlags().StringVar(&acmeConfig.StateDir, "acme-state-dir", defaultACMEStateDir,
+		"Directory for the ACME account key and challenge responses. This should persist across restarts.")
+	rootCmd.PersistentFlags().DurationVar(&acmeConfig.RenewBefore, "acme-renew-before", defaultACMERenewBefore,
+		"How long before expiry to renew certificates.")
+	rootCmd.PersistentFlags().StringVar(&acmeConfig.Route53HostedZone, "acme-route53-hosted-zone", "",
+		"Route53 hosted zone to solve dns-01 challenges in, instead of http-01. This is required for wildcard hosts.")
+}
+
+func configureVaultFlags() {
+	rootCmd.PersistentFlags().StringVar(&vaultConfig.Address, "vault-address", "",
+		"Address of a Vault server to fetch certificates from, e.g. https://vault:8200. Leave blank to use certificates on disk only.")
+	rootCmd.PersistentFlags().StringVar(&vaultConfig.Token, "vault-token", "",
+		"Token to authenticate with Vault. Leave blank to log in with the pod's service account and --vault-kubernetes-role.")
+	rootCmd.PersistentFlags().StringVar(&vaultConfig.KubernetesAuthMount, "vault-kubernetes-auth-mount", defaultVaultKubernetesAuthMount,
+		"Mount path of the Vault Kubernetes auth method.")
+	rootCmd.PersistentFlags().StringVar(&vaultConfig.KubernetesRole, "vault-kubernetes-role", "",
+		"Vault role to log in as with the pod's service account.")
+	rootCmd.PersistentFlags().StringVar(&vaultConfig.PKIMount, "vault-pki-mount", defaultVaultPKIMount,
+		"Mount path of the Vault PKI secrets engine.")
+	rootCmd.PersistentFlags().StringVar(&vaultConfig.PKIRole, "vault-pki-role", "",
+		"Vault PKI role to issue certificates for every ingress host with. These are written to --ssl-certs-dir, which is required. "+
+			"Leave blank to not issue certificates.")
+	rootCmd.PersistentFlags().DurationVar(&vaultConfig.CertificateTTL, "vault-certificate-ttl", 0,
+		"TTL to request for certificates issued by Vault. Leave as 0 to use the role's default.")
+	rootCmd.PersistentFlags().DurationVar(&vaultConfig.RenewBefore, "vault-renew-before", defaultVaultRenewBefore,
+		"How long before expiry to renew certificates issued by Vault.")
+	rootCmd.PersistentFlags().StringVar(&vaultConfig.KVMount, "vault-kv-mount", defaultVaultKVMount,
+		"Mount path of the Vault KV version 2 secrets engine.")
+	rootCmd.PersistentFlags().StringVar(&vaultConfig.DefaultCertificatePath, "vault-default-certificate-path", "",
+		"KV secret with certificate and private_key fields to use as the default certificate, written to --ssl-path. "+
+			"Leave blank to use the default certificate on disk.")
+	rootCmd.PersistentFlags().StringVar(&vaultConfig.HtpasswdPrefix, "vault-htpasswd-prefix", "",
+		"KV path with an htpasswd secret per namespace, as <prefix>/<namespace>/<name>, for ingresses with the "+
+			"sky.uk/vault-htpasswd annotation. Leave blank to not fetch htpasswd files.")
+	rootCmd.PersistentFlags().DurationVar(&vaultConfig.CheckInterval, "vault-check-interval", defaultVaultCheckInterval,
+		"How often to check Vault for changes to the default certificate and htpasswd files, and renew certificates.")
+}
+
+func configureExternalUpdaterFlags() {
+	rootCmd.PersistentFlags().StringVar(&externalUpdaterConfig.Endpoint, "external-updater-endpoint", "",
+		"host:port of an external updater plugin, serving the gRPC API in plugin/updater.proto. "+
+			"It's called with the ingress entries on every update, e.g. to register a bespoke frontend. Leave blank to disable.")
+	rootCmd.PersistentFlags().DurationVar(&externalUpdaterConfig.Timeout, "external-updater-timeout", defaultExternalUpdaterTimeout,
+		"Timeout for calls to start, update and stop the external updater.")
+	rootCmd.PersistentFlags().BoolVar(&externalUpdaterConfig.TLS, "external-updater-tls", false,
+		"Call the external updater over TLS, rather than plaintext.")
+	rootCmd.PersistentFlags().StringVar(&externalUpdaterConfig.CAFile, "external-updater-tls-ca", "",
+		"PEM file of the CAs the external updater's certificate is verified against. Leave blank to use the system's.")
+	rootCmd.PersistentFlags().StringVar(&externalUpdaterConfig.CertFile, "external-updater-tls-cert", "",
+		"PEM file of the client certificate presented to the external updater. Leave blank to not present one.")
+	rootCmd.PersistentFlags().StringVar(&externalUpdaterConfig.KeyFile, "external-updater-tls-key", "",
+		"PEM file of the key of --external-updater-tls-cert.")
+}
+
+func configurePreDrainFlags() {
+	rootCmd.PersistentFlags().StringVar(&preDrainHookConfig.Command, "pre-drain-command", "",
+		"Shell command to run at the start of shutdown, before frontends are deregistered and drained. "+
+			"Leave blank to disable.")
+	rootCmd.PersistentFlags().StringVar(&preDrainHookConfig.WebhookURL, "pre-drain-webhook", "",
+		"URL to POST to at the start of shutdown, before frontends are deregistered and drained. "+
+			"Leave blank to disable.")
+	rootCmd.PersistentFlags().DurationVar(&preDrainHookConfig.Timeout, "pre-drain-timeout", defaultPreDrainTimeout,
+		"Timeout for the pre-drain command and webhook. Shutdown continues if they fail or time out.")
+}
+
+func configureShutdownFlags() {
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.Shutdown.FrontendsTimeout, "shutdown-frontends-timeout", 0,
+		"How long frontends, such as load balancers, have to deregister on shutdown, including any --drain-delay. "+
+			"Set to 0 for no limit.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.Shutdown.DelayAfterFrontends, "shutdown-delay-after-frontends", 0,
+		"How long to wait on shutdown after frontends have deregistered, before nginx is stopped.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.Shutdown.NginxTimeout, "shutdown-nginx-timeout", 0,
+		"How long nginx has to quit on shutdown, after which it's left to be killed. Set to 0 for no limit. "+
+			"Should be longer than --nginx-worker-shutdown-timeout-seconds.")
+	rootCmd.PersistentFlags().DurationVar(&controllerConfig.Shutdown.DelayAfterNginx, "shutdown-delay-after-nginx", 0,
+		"How long to wait on shutdown after nginx has quit, before the remaining updaters are stopped and feed-ingress exits.")
 }
 
 func configurePrometheusFlags() {
-	rootCmd.PersistentFlags().StringVar(&pushgatewayURL, "pushgateway", "",
+	rootCmd.PersistentFlags().StringVar(&pushgateway.URL, "pushgateway", "",
 		"Prometheus pushgateway URL for pushing metrics. Leave blank to not push metrics.")
-	rootCmd.PersistentFlags().IntVar(&pushgatewayIntervalSeconds, "pushgateway-interval", defaultPushgatewayIntervalSeconds,
+	rootCmd.PersistentFlags().IntVar(&pushgateway.IntervalSeconds, "pushgateway-interval", defaultPushgatewayIntervalSeconds,
 		"Interval in seconds for pushing metrics.")
 	rootCmd.PersistentFlags().Var(&pushgatewayLabels, "pushgateway-label",
 		"A label=value pair to attach to metrics pushed to prometheus. Specify multiple times for multiple labels.")
+	rootCmd.PersistentFlags().Var(&pushgateway.Grouping, "pushgateway-grouping",
+		"A label=value pair to add to the grouping key of pushed metrics, such as instance=<pod name>, so replicas "+
+			"don't overwrite each other's metrics. instance defaults to the hostname. Specify multiple times for "+
+			"multiple labels.")
+	rootCmd.PersistentFlags().StringVar(&pushgateway.Username, "pushgateway-username", "",
+		"Username for basic auth to the pushgateway. Requires --pushgateway-password-file.")
+	rootCmd.PersistentFlags().StringVar(&pushgateway.PasswordFile, "pushgateway-password-file", "",
+		"File holding the password for basic auth to the pushgateway.")
+	rootCmd.PersistentFlags().StringVar(&pushgateway.CAFile, "pushgateway-ca", "",
+		"CA file used to verify the pushgateway's certificate. Leave blank to use the system CAs.")
+	rootCmd.PersistentFlags().BoolVar(&pushgateway.DeleteOnShutdown, "pushgateway-delete-on-shutdown", false,
+		"Delete the pushed metrics from the pushgateway on shutdown, so they don't outlive the pod.")
+	rootCmd.PersistentFlags().StringSliceVar(&metricsExporters, "metrics-exporters", []string{cmd.PrometheusExporter},
+		"Comma delimited list of exporters to make metrics available through. One or both of "+
+			cmd.PrometheusExporter+" and "+cmd.StatsDExporter+".")
+	rootCmd.PersistentFlags().StringVar(&statsDConfig.Address, "statsd-address", defaultStatsDAddress,
+		"Address of the StatsD server, as host:port, when the statsd exporter is enabled.")
+	rootCmd.PersistentFlags().StringVar(&statsDConfig.Prefix, "statsd-prefix", defaultStatsDPrefix,
+		"Prefix to add to the name of metrics sent to StatsD.")
+	rootCmd.PersistentFlags().StringSliceVar(&statsDConfig.Tags, "statsd-tags", []string{},
+		"Comma delimited list of key:value tags to attach to metrics sent to StatsD. Requires --statsd-dogstatsd.")
+	rootCmd.PersistentFlags().BoolVar(&statsDConfig.DogStatsD, "statsd-dogstatsd", defaultStatsDDogStatsD,
+		"Send labels and tags using the DogStatsD extension. Otherwise label values are appended to metric names.")
+	rootCmd.PersistentFlags().DurationVar(&statsDConfig.Interval, "statsd-interval", defaultStatsDInterval,
+		"Interval for sending metrics to StatsD.")
 }
 
 func printVersion() string {
@@ -10,11 +10,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os/exec"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	multierror "github.com/hashicorp/go-multierror"
@@ -28,6 +30,8 @@ type PulseArgs struct {
 	Method string `json:"method"`
 	Path   string `json:"path"`
 	Expect string `json:"expect"`
+	// Port is checked instead of the backend's port, if set.
+	Port int `json:"port,omitempty"`
 }
 
 // Pulse defines backend health check
@@ -50,6 +54,18 @@ type BackendConfig struct {
 type VirtualService struct {
 	Name string
 	Port int
+	// IPv6 registers the instance's IPv6 address with this service, for a virtual service on an IPv6 VIP.
+	IPv6 bool
+	// Healthcheck overrides the backend healthcheck of this service.
+	Healthcheck Healthcheck
+}
+
+// Healthcheck overrides the backend healthcheck of a virtual service. Empty fields use the Config's.
+type Healthcheck struct {
+	Type   string
+	Path   string
+	Port   int
+	Expect string
 }
 
 // Config defines all the configuration required for gorb
@@ -65,6 +81,50 @@ type Config struct {
 	BackendHealthcheckInterval string
 	BackendHealthcheckType     string
 	InterfaceProcFsPath        string
+	// BackendHealthcheckPath is requested by http healthchecks, / if empty.
+	BackendHealthcheckPath string
+	// BackendHealthcheckPort is checked instead of the backend's port, if set.
+	BackendHealthcheckPort int
+	// BackendHealthcheckExpect is the status code http healthchecks expect, 404 if empty.
+	BackendHealthcheckExpect string
+	// InstanceIPv6 is registered with the IPv6 virtual services, for dual-stack IPVS.
+	InstanceIPv6 string
+	// NodeWeight computes the backend weight from the node, instead of always using BackendWeight, if set.
+	NodeWeight *NodeWeight
+	// WeightRamp is how long a newly added backend takes to step up to its full weight, or 0 to add it at its full
+	// weight.
+	WeightRamp time.Duration
+	// WeightRampSteps is how many steps the weight is increased in, each a WeightRampSteps'th of the full weight.
+	WeightRampSteps int
+}
+
+// pulse returns the backend healthcheck, with the overrides of a virtual service.
+func (c *Config) pulse(override Healthcheck) Pulse {
+	pulse := Pulse{
+		TypeHealthcheck: firstNonEmpty(override.Type, c.BackendHealthcheckType),
+		Interval:        c.BackendHealthcheckInterval,
+	}
+	if pulse.TypeHealthcheck == "http" {
+		pulse.Args = PulseArgs{
+			Method: "GET",
+			Path:   firstNonEmpty(override.Path, c.BackendHealthcheckPath, "/"),
+			Expect: firstNonEmpty(override.Expect, c.BackendHealthcheckExpect, "404"),
+			Port:   c.BackendHealthcheckPort,
+		}
+		if override.Port != 0 {
+			pulse.Args.Port = override.Port
+		}
+	}
+	return pulse
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
 }
 
 // Backend defines the backend configuration + service name
@@ -85,6 +145,18 @@ func New(c *Config) (controller.Updater, error) {
 	if c.ServerBaseURL == "" {
 		return nil, errors.New("unable to create Gorb updater: missing server ip address")
 	}
+	for _, service := range c.ServicesDefinition {
+		if service.IPv6 && c.InstanceIPv6 == "" {
+			return nil, fmt.Errorf("unable to create Gorb updater: missing instance IPv6 address for service %s", service.Name)
+		}
+	}
+	if c.ManageLoopback {
+		for _, vip := range strings.Split(c.VipLoadbalancer, ",") {
+			if net.ParseIP(vip) == nil {
+				return nil, fmt.Errorf("unable to create Gorb updater: invalid vip %s", vip)
+			}
+		}
+	}
 	initMetrics()
 	log.Infof("Gorb server url: %s, drainDelay: %v, instance ip adddress: %s, vipLoadbalancer: %s", c.ServerBaseURL, c.DrainDelay, c.InstanceIP, c.VipLoadbalancer)
 
@@ -92,22 +164,16 @@ func New(c *Config) (controller.Updater, error) {
 
 	var backendDefinition backend
 	for _, service := range c.ServicesDefinition {
-		pulse := Pulse{
-			TypeHealthcheck: c.BackendHealthcheckType,
-			Interval:        c.BackendHealthcheckInterval,
-		}
-		if c.BackendHealthcheckType == "http" {
-			pulse.Args = PulseArgs{
-				Method: "GET",
-				Path:   "/",
-				Expect: "404",
-			}
+		pulse := c.pulse(service.Healthcheck)
+		host := c.InstanceIP
+		if service.IPv6 {
+			host = c.InstanceIPv6
 		}
 
 		backendDefinition = backend{
 			serviceName: service.Name,
 			backendConfig: BackendConfig{
-				Host:   c.InstanceIP,
+				Host:   host,
 				Port:   service.Port,
 				Method: c.BackendMethod,
 				Weight: c.BackendWeight,
@@ -118,6 +184,13 @@ func New(c *Config) (controller.Updater, error) {
 		backendDefinitions = append(backendDefinitions, backendDefinition)
 	}
 
+	if c.WeightRamp > 0 && c.WeightRampSteps <= 0 {
+		return nil, errors.New("unable to create Gorb updater: the weight ramp needs at least one step")
+	}
+	if c.NodeWeight != nil && c.NodeWeight.loadAverage == nil {
+		c.NodeWeight.loadAverage = procLoadAverage
+	}
+
 	httpClient := pester.New()
 	httpClient.Timeout = time.Second * 2
 	httpClient.MaxRetries = 3
@@ -126,7 +199,9 @@ func New(c *Config) (controller.Updater, error) {
 		command:    &SimpleCommandRunner{},
 		config:     c,
 		backend:    backendDefinitions,
+		rampSteps:  make(map[string]int),
 		httpClient: httpClient,
+		stop:       make(chan struct{}),
 	}, nil
 }
 
@@ -149,17 +224,166 @@ type gorb struct {
 	command    CommandRunner
 	config     *Config
 	httpClient *pester.Client
-	backend    []backend
+	// backendLock guards the weights of the backends, which are changed by weighBackends, and their ramps
+	backendLock sync.Mutex
+	backend     []backend
+	// rampSteps is the step of the weight ramp of each backend being ramped up, by service name
+	rampSteps map[string]int
+	// stop stops the goroutines changing the backend weights, which running waits for
+	stop    chan struct{}
+	running sync.WaitGroup
 }
 
+// Start sets the weight of the backends from the node, and keeps it up to date, if NodeWeight is set.
 func (g *gorb) Start() error {
+	if g.config.NodeWeight == nil {
+		return nil
+	}
+	weight, err := g.config.NodeWeight.weight(g.config.BackendWeight)
+	if err != nil {
+		return err
+	}
+	g.setWeight(weight)
+
+	g.running.Add(1)
+	go g.weighBackends()
 	return nil
 }
 
+// weighBackends computes the weight of the node every interval, and changes the weight of the backends when it
+// changes.
+func (g *gorb) weighBackends() {
+	defer g.running.Done()
+	ticker := time.NewTicker(g.config.NodeWeight.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+
+		weight, err := g.config.NodeWeight.weight(g.config.BackendWeight)
+		if err != nil {
+			log.WithFields(log.Fields{"err": err}).Warn("Unable to compute the backend weight, keeping the current weight")
+			continue
+		}
+		if !g.setWeight(weight) {
+			continue
+		}
+		log.Infof("Changing the backend weight to %d", weight)
+		for _, backend := range g.backends() {
+			if err := g.modifyBackend(&backend); err != nil {
+				log.WithFields(log.Fields{"err": err, "backend": backend}).Warn("Unable to change the backend weight")
+			}
+		}
+	}
+}
+
+// setWeight sets the weight of the backends, returning whether it changed.
+func (g *gorb) setWeight(weight int) bool {
+	g.backendLock.Lock()
+	defer g.backendLock.Unlock()
+	backendWeightGauge.Set(float64(weight))
+	changed := false
+	for i := range g.backend {
+		changed = changed || g.backend[i].backendConfig.Weight != weight
+		g.backend[i].backendConfig.Weight = weight
+	}
+	return changed
+}
+
+// backends returns a copy of the backends, at their ramped weight while they're ramping up.
+func (g *gorb) backends() []backend {
+	g.backendLock.Lock()
+	defer g.backendLock.Unlock()
+	var backends []backend
+	for _, backend := range g.backend {
+		backends = append(backends, g.ramped(backend))
+	}
+	return backends
+}
+
+// ramped returns the backend at its weight for the step of its ramp, if it's ramping up. Called with backendLock held.
+func (g *gorb) ramped(b backend) backend {
+	if step, ok := g.rampSteps[b.serviceName]; ok {
+		b.backendConfig.Weight = b.backendConfig.Weight * step / g.config.WeightRampSteps
+		if b.backendConfig.Weight < 1 {
+			b.backendConfig.Weight = 1
+		}
+	}
+	return b
+}
+
+// startRamp starts the weight ramp of the backend from its first step, returning it at that weight, and whether it
+// was already ramping up.
+func (g *gorb) startRamp(serviceName string) (backend, bool) {
+	g.backendLock.Lock()
+	defer g.backendLock.Unlock()
+	_, ramping := g.rampSteps[serviceName]
+	g.rampSteps[serviceName] = 1
+	for _, b := range g.backend {
+		if b.serviceName == serviceName {
+			return g.ramped(b), ramping
+		}
+	}
+	return backend{}, ramping
+}
+
+// nextRampStep moves the ramp of the backend to its next step, returning it at that weight, and whether it has
+// reached its full weight.
+func (g *gorb) nextRampStep(serviceName string) (backend, bool) {
+	g.backendLock.Lock()
+	defer g.backendLock.Unlock()
+	g.rampSteps[serviceName]++
+	done := g.rampSteps[serviceName] >= g.config.WeightRampSteps
+	if done {
+		delete(g.rampSteps, serviceName)
+	}
+	for _, b := range g.backend {
+		if b.serviceName == serviceName {
+			return g.ramped(b), done
+		}
+	}
+	return backend{}, true
+}
+
+func (g *gorb) stopRamp(serviceName string) {
+	g.backendLock.Lock()
+	defer g.backendLock.Unlock()
+	delete(g.rampSteps, serviceName)
+}
+
+// rampUp steps up the weight of a newly added backend to its full weight over the ramp, so it only takes its full
+// share of traffic once nginx has warmed up, mirroring the drain on stop.
+func (g *gorb) rampUp(serviceName string) {
+	defer g.running.Done()
+	interval := g.config.WeightRamp / time.Duration(g.config.WeightRampSteps)
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-time.After(interval):
+		}
+
+		backend, done := g.nextRampStep(serviceName)
+		if err := g.modifyBackend(&backend); err != nil {
+			log.WithFields(log.Fields{"err": err, "backend": backend}).Warn("Unable to ramp up the backend weight")
+		}
+		if done {
+			log.WithFields(log.Fields{"backend": backend}).Info("Backend ramped up to its full weight")
+			return
+		}
+	}
+}
+
 // Stop removes this instance from Gorb
 func (g *gorb) Stop() error {
+	close(g.stop)
+	g.running.Wait()
+
 	var errorArr *multierror.Error
-	for _, backend := range g.backend {
+	for _, backend := range g.backends() {
 		backend.backendConfig.Weight = 0
 		err := g.modifyBackend(&backend)
 		if err != nil {
@@ -178,7 +402,7 @@ func (g *gorb) Stop() error {
 		errorArr = multierror.Append(errorArr, err)
 	}
 
-	for _, backend := range g.backend {
+	for _, backend := range g.backends() {
 		err := g.removeBackend(&backend)
 		if err != nil {
 			log.WithFields(log.Fields{"err": err}).Error("Unable to remove Backend ")
@@ -215,20 +439,31 @@ func (g *gorb) Update(controller.IngressEntries) error {
 		errorArr = multierror.Append(errorArr, err)
 	}
 
-	for _, backend := range g.backend {
+	for _, backend := range g.backends() {
 		backendNotFound, err := g.backendNotFound(&backend)
 		if err != nil {
 			log.WithFields(log.Fields{"err": err, "backend": backend}).Error("Unable to check if backend already exists")
 		}
 
 		if backendNotFound {
+			ramping := false
+			if g.config.WeightRamp > 0 {
+				backend, ramping = g.startRamp(backend.serviceName)
+			}
 			err := g.addBackend(&backend)
 			if err != nil {
 				log.WithFields(log.Fields{"err": err, "backend": backend}).Error("Error adding backend ")
 				errorArr = multierror.Append(errorArr, err)
+				if !ramping {
+					g.stopRamp(backend.serviceName)
+				}
 			} else {
 				log.WithFields(log.Fields{"backend": backend}).Infof("Backend added successfully")
 				attachedFrontendGauge.Set(float64(1))
+				if g.config.WeightRamp > 0 && !ramping {
+					g.running.Add(1)
+					go g.rampUp(backend.serviceName)
+				}
 			}
 		}
 	}
@@ -261,6 +496,12 @@ func (g *gorb) manageLoopBack(action loopbackAction) error {
 	var errorArr *multierror.Error
 	vipLoadbalancers := strings.Split(g.config.VipLoadbalancer, ",")
 	for index, vip := range vipLoadbalancers {
+		ip := net.ParseIP(vip)
+		if ip.To4() == nil {
+			errorArr = multierror.Append(errorArr, g.manageIPv6Loopback(ip, interfaceAction, expectedVipCount))
+			continue
+		}
+
 		vipCount, err := g.loopbackInterfaceCount(fmt.Sprintf("lo:%d", index), vip)
 		errorArr = multierror.Append(errorArr, err)
 		if vipCount == expectedVipCount {
@@ -278,6 +519,31 @@ func (g *gorb) manageLoopBack(action loopbackAction) error {
 	return errorArr.ErrorOrNil()
 }
 
+// manageIPv6Loopback adds or deletes an IPv6 vip on the loopback interface. IPv6 addresses can't have labels, so the
+// vip is found by its address. There are no ARP settings to change, as Linux only answers neighbour solicitations for
+// addresses of the interface they arrive on, so a vip on the loopback interface is never advertised.
+func (g *gorb) manageIPv6Loopback(vip net.IP, interfaceAction string, expectedVipCount int) error {
+	cmdOutput, err := g.command.Execute(fmt.Sprintf("sudo ip -6 addr show dev lo | grep -c 'inet6 %s/128 ' | xargs echo", vip))
+	if err != nil {
+		return fmt.Errorf("unable to check whether loopback interface has vip: %s, error %v", vip, err)
+	}
+	vipCount, err := strconv.Atoi(strings.TrimSpace(string(cmdOutput)))
+	if err != nil {
+		return fmt.Errorf("unable to parse loopback interface count from the output: %s, error :%v", string(cmdOutput), err)
+	}
+	if vipCount != expectedVipCount {
+		return nil
+	}
+
+	// nodad makes the vip usable at once, rather than after duplicate address detection
+	command := fmt.Sprintf("sudo ip -6 addr %s %s/128 dev lo", interfaceAction, vip)
+	if interfaceAction == "add" {
+		command += " nodad"
+	}
+	_, err = g.command.Execute(command)
+	return err
+}
+
 func (g *gorb) loopbackInterfaceCount(label string, vip string) (int, error) {
 	cmdOutput, err := g.command.Execute(fmt.Sprintf("sudo ip addr show label %s | grep -c %s/32 | xargs echo", label, vip))
 	if err != nil {
@@ -294,7 +560,7 @@ func (g *gorb) loopbackInterfaceCount(label string, vip string) (int, error) {
 func (g *gorb) backendNotFound(backend *backend) (bool, error) {
 	resp, err := g.httpClient.Get(g.serviceRequest(backend))
 	if err != nil {
-		return false, fmt.Errorf("unable to retrieve backend details for instance ip: %s, error :%v", g.config.InstanceIP, err)
+		return false, fmt.Errorf("unable to retrieve backend details for instance ip: %s, error :%v", backend.backendConfig.Host, err)
 	}
 	defer resp.Body.Close()
 	return resp.StatusCode == http.StatusNotFound, nil
@@ -354,7 +620,7 @@ func (g *gorb) executeRequest(method string, backend *backend, payload io.Reader
 }
 
 func (g *gorb) serviceRequest(backend *backend) string {
-	return fmt.Sprintf("%s/service/%s/node-%s-%s", g.config.ServerBaseURL, backend.serviceName, backend.serviceName, g.config.InstanceIP)
+	return fmt.Sprintf("%s/service/%s/node-%s-%s", g.config.ServerBaseURL, backend.serviceName, backend.serviceName, backend.backendConfig.Host)
 }
 
 func (g *gorb) String() string {
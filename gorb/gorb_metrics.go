@@ -10,10 +10,13 @@ import (
 
 var once sync.Once
 var attachedFrontendGauge prometheus.Gauge
+var backendWeightGauge prometheus.Gauge
 
 func initMetrics() {
 	once.Do(func() {
 		attachedFrontendGauge = metrics.RegisterNewDefaultGauge(metrics.PrometheusIngressSubsystem,
 			"gorb_frontends_attached", "The total number of frontends attached to Gorb")
+		backendWeightGauge = metrics.RegisterNewDefaultGauge(metrics.PrometheusIngressSubsystem,
+			"gorb_backend_weight", "The weight of the backends registered with Gorb")
 	})
 }
@@ -8,7 +8,9 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -17,6 +19,9 @@ import (
 	"github.com/sky-uk/feed/controller"
 	"github.com/sky-uk/feed/util/metrics"
 	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestE2E(t *testing.T) {
@@ -26,6 +31,7 @@ func TestE2E(t *testing.T) {
 
 const (
 	instanceIP                 = "10.10.0.1"
+	instanceIPv6               = "fd00::10"
 	drainImmediately           = 0
 	backendHealthcheckInterval = "1s"
 	backendHealthcheckType     = "http"
@@ -84,6 +90,30 @@ func mockEnableArpCommand(mockCommand *fakeCommandRunner) {
 	mockCommand.On("Execute", "echo 0 | sudo tee /host_ipv4_proc/arp_announce > /dev/null").Return([]byte{}, nil)
 }
 
+type fakeNodes struct {
+	node *corev1.Node
+}
+
+func (f *fakeNodes) GetNode(name string) (*corev1.Node, error) {
+	if f.node.Name != name {
+		return nil, fmt.Errorf("no node %s", name)
+	}
+	return f.node, nil
+}
+
+func newNodeWeight(cpus string, labels map[string]string, load float64) *NodeWeight {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: labels},
+		Status:     corev1.NodeStatus{Capacity: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpus)}},
+	}
+	return &NodeWeight{
+		Nodes:       &fakeNodes{node: node},
+		NodeName:    "node-1",
+		Interval:    time.Hour,
+		loadAverage: func() (float64, error) { return load, nil },
+	}
+}
+
 func singleServiceConfig(serverURL string) *Config {
 	config := newConfig(serverURL)
 	config.ServicesDefinition = []VirtualService{{Name: "http-proxy", Port: 80}}
@@ -242,6 +272,37 @@ var _ = Describe("Gorb", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("should create the backend healthcheck with the configured path, port and expected status", func() {
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 404})
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
+
+			config := singleServiceConfig(serverURL)
+			config.BackendHealthcheckPath = "/health"
+			config.BackendHealthcheckPort = 8080
+			config.BackendHealthcheckExpect = "200"
+			g, _ = New(config)
+			err := g.Update(controller.IngressEntries{})
+
+			Expect(len(gorbH.recordedRequests)).To(Equal(2))
+			Expect(gorbH.recordedRequests[1].body.Pulse.Args).To(Equal(PulseArgs{Method: "GET", Path: "/health", Expect: "200", Port: 8080}))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should override the backend healthcheck of a service", func() {
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 404})
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
+
+			config := singleServiceConfig(serverURL)
+			config.ServicesDefinition[0].Healthcheck = Healthcheck{Path: "/ready", Port: 9090}
+			g, _ = New(config)
+			err := g.Update(controller.IngressEntries{})
+
+			Expect(len(gorbH.recordedRequests)).To(Equal(2))
+			Expect(gorbH.recordedRequests[1].body.Pulse.TypeHealthcheck).To(Equal("http"))
+			Expect(gorbH.recordedRequests[1].body.Pulse.Args).To(Equal(PulseArgs{Method: "GET", Path: "/ready", Expect: "404", Port: 9090}))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
 		It("should remove itself on shutdown", func() {
 			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
 			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
@@ -296,6 +357,147 @@ var _ = Describe("Gorb", func() {
 		})
 	})
 
+	Describe("Node weight", func() {
+		It("should be the weight of the node label", func() {
+			weight := newNodeWeight("4", map[string]string{"gorb-weight": "300"}, 0)
+			weight.Label = "gorb-weight"
+			weight.PerCPU = 100
+
+			Expect(weight.weight(backendWeight)).To(Equal(300))
+		})
+
+		It("should be the weight per CPU for nodes without the label", func() {
+			weight := newNodeWeight("4", nil, 0)
+			weight.Label = "gorb-weight"
+			weight.PerCPU = 100
+
+			Expect(weight.weight(backendWeight)).To(Equal(400))
+		})
+
+		It("should be halved under high load", func() {
+			weight := newNodeWeight("4", nil, 10)
+			weight.HighLoad = 2
+
+			Expect(weight.weight(backendWeight)).To(Equal(backendWeight / 2))
+
+			weight.loadAverage = func() (float64, error) { return 6, nil }
+			Expect(weight.weight(backendWeight)).To(Equal(backendWeight))
+		})
+
+		It("should reject invalid labels", func() {
+			weight := newNodeWeight("4", map[string]string{"gorb-weight": "heavy"}, 0)
+			weight.Label = "gorb-weight"
+
+			_, err := weight.weight(backendWeight)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should register the backend with the weight of the node", func() {
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 404})
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
+
+			config := singleServiceConfig(serverURL)
+			config.NodeWeight = newNodeWeight("8", nil, 0)
+			config.NodeWeight.PerCPU = 50
+			g, _ = New(config)
+			Expect(g.Start()).To(Succeed())
+			err := g.Update(controller.IngressEntries{})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(gorbH.recordedRequests)).To(Equal(2))
+			Expect(gorbH.recordedRequests[1].body.Weight).To(Equal(400))
+		})
+
+		It("should change the backend weight when the node's weight changes", func() {
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
+
+			var load int64
+			config := singleServiceConfig(serverURL)
+			config.NodeWeight = newNodeWeight("4", nil, 0)
+			config.NodeWeight.HighLoad = 2
+			config.NodeWeight.Interval = 10 * time.Millisecond
+			config.NodeWeight.loadAverage = func() (float64, error) { return float64(atomic.LoadInt64(&load)), nil }
+			g, _ = New(config)
+			Expect(g.Start()).To(Succeed())
+			atomic.StoreInt64(&load, 10)
+
+			Eventually(func() int { return g.(*gorb).backends()[0].backendConfig.Weight }).Should(Equal(backendWeight / 2))
+			close(g.(*gorb).stop)
+			g.(*gorb).running.Wait()
+			Expect(len(gorbH.recordedRequests)).To(Equal(1))
+			Expect(gorbH.recordedRequests[0].method).To(Equal("PATCH"))
+			Expect(gorbH.recordedRequests[0].body.Weight).To(Equal(backendWeight / 2))
+		})
+	})
+
+	Describe("Weight ramp", func() {
+		It("should add the backend at low weight and step it up to its full weight", func() {
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 404})
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
+
+			config := singleServiceConfig(serverURL)
+			config.WeightRamp = 30 * time.Millisecond
+			config.WeightRampSteps = 3
+			g, _ = New(config)
+			err := g.Update(controller.IngressEntries{})
+			g.(*gorb).running.Wait()
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(gorbH.recordedRequests)).To(Equal(4))
+			Expect(gorbH.recordedRequests[1].method).To(Equal("PUT"))
+			Expect(gorbH.recordedRequests[1].body.Weight).To(Equal(backendWeight / 3))
+			Expect(gorbH.recordedRequests[2].method).To(Equal("PATCH"))
+			Expect(gorbH.recordedRequests[2].body.Weight).To(Equal(backendWeight * 2 / 3))
+			Expect(gorbH.recordedRequests[3].method).To(Equal("PATCH"))
+			Expect(gorbH.recordedRequests[3].body.Weight).To(Equal(backendWeight))
+		})
+
+		It("should not ramp up backends which are already registered", func() {
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
+
+			config := singleServiceConfig(serverURL)
+			config.WeightRamp = 30 * time.Millisecond
+			config.WeightRampSteps = 3
+			g, _ = New(config)
+			err := g.Update(controller.IngressEntries{})
+			g.(*gorb).running.Wait()
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(gorbH.recordedRequests)).To(Equal(1))
+		})
+	})
+
+	Describe("Dual-stack services", func() {
+		It("should register the instance IPv6 address with the IPv6 services", func() {
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 404})
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 404})
+			gorbH.responsePrimers = append(gorbH.responsePrimers, gorbResponsePrimer{statusCode: 200})
+
+			config := newConfig(serverURL)
+			config.InstanceIPv6 = instanceIPv6
+			config.ServicesDefinition = []VirtualService{{Name: "http-proxy", Port: 80}, {Name: "http-proxy-v6", Port: 80, IPv6: true}}
+			g, _ = New(config)
+			err := g.Update(controller.IngressEntries{})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(gorbH.recordedRequests)).To(Equal(4))
+			Expect(gorbH.recordedRequests[1].body.Host).To(Equal(instanceIP))
+			Expect(gorbH.recordedRequests[3].url.Path).To(Equal(fmt.Sprintf("/service/http-proxy-v6/node-http-proxy-v6-%s", instanceIPv6)))
+			Expect(gorbH.recordedRequests[3].body.Host).To(Equal(instanceIPv6))
+		})
+
+		It("should need the instance IPv6 address for IPv6 services", func() {
+			config := newConfig(serverURL)
+			config.ServicesDefinition = []VirtualService{{Name: "http-proxy-v6", Port: 80, IPv6: true}}
+			_, err := New(config)
+
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	Describe("Loopback interface", func() {
 		It("should be added when does not exists", func() {
 			g, _ = New(loopbackManagingConfig(serverURL))
@@ -338,6 +540,39 @@ var _ = Describe("Gorb", func() {
 			mockCommand.AssertExpectations(GinkgoT())
 		})
 
+		It("should add IPv6 vips without label or ARP settings", func() {
+			config := loopbackManagingConfig(serverURL)
+			config.VipLoadbalancer = vipLoadbalancer + ",fd00:0::1"
+			g, _ = New(config)
+			mockCommand := &fakeCommandRunner{}
+			g.(*gorb).command = mockCommand
+
+			mockLoopbackExistsCommand(mockCommand, vipLoadbalancer)
+			mockDisableArpCommand(mockCommand)
+			mockCommand.On("Execute", "sudo ip -6 addr show dev lo | grep -c 'inet6 fd00::1/128 ' | xargs echo").Return([]byte("0\n"), nil)
+			mockCommand.On("Execute", "sudo ip -6 addr add fd00::1/128 dev lo nodad").Return([]byte{}, nil)
+
+			err := g.Update(controller.IngressEntries{})
+			Expect(err).NotTo(HaveOccurred())
+			mockCommand.AssertExpectations(GinkgoT())
+			mockCommand.AssertNumberOfCalls(GinkgoT(), "Execute", 5)
+		})
+
+		It("should delete IPv6 vips on stop", func() {
+			config := loopbackManagingConfig(serverURL)
+			config.VipLoadbalancer = "fd00::1"
+			g, _ = New(config)
+			mockCommand := &fakeCommandRunner{}
+			g.(*gorb).command = mockCommand
+
+			mockCommand.On("Execute", "sudo ip -6 addr show dev lo | grep -c 'inet6 fd00::1/128 ' | xargs echo").Return([]byte("1\n"), nil)
+			mockCommand.On("Execute", "sudo ip -6 addr del fd00::1/128 dev lo").Return([]byte{}, nil)
+
+			err := g.Stop()
+			Expect(err).NotTo(HaveOccurred())
+			mockCommand.AssertExpectations(GinkgoT())
+		})
+
 		It("should not be deleted on stop if not present", func() {
 			g, _ = New(loopbackManagingConfig(serverURL))
 			mockCommand := &fakeCommandRunner{}
@@ -0,0 +1,69 @@
+/*
+Package gorbstatus provides an updater for a gorb frontend to update ingress statuses.
+*/
+package gorbstatus
+
+import (
+	"errors"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/k8s"
+	k8sStatus "github.com/sky-uk/feed/k8s/status"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Config for creating a new gorb status updater.
+type Config struct {
+	// Addresses are the IPs or hostnames of the gorb vips, which every ingress is served on.
+	Addresses        []string
+	KubernetesClient k8s.Client
+}
+
+// New creates a new gorb frontend status updater.
+func New(conf Config) (controller.Updater, error) {
+	if len(conf.Addresses) == 0 {
+		return nil, errors.New("unable to create gorb status updater: missing addresses")
+	}
+
+	return &status{
+		addresses:        conf.Addresses,
+		kubernetesClient: conf.KubernetesClient,
+	}, nil
+}
+
+type status struct {
+	addresses        []string
+	loadBalancer     v1.LoadBalancerStatus
+	kubernetesClient k8s.Client
+}
+
+// Start generates the loadBalancer status of the vips.
+func (s *status) Start() error {
+	s.loadBalancer = k8sStatus.GenerateLoadBalancerStatus(s.addresses)
+	return nil
+}
+
+func (s *status) Stop() error {
+	return nil
+}
+
+func (s *status) Health() error {
+	return nil
+}
+
+func (s *status) Readiness() error {
+	return nil
+}
+
+func (s *status) Update(ingresses controller.IngressEntries) error {
+	// the vips serve every ingress, whatever its frontend scheme
+	loadBalancers := make(map[string]v1.LoadBalancerStatus)
+	for _, ingress := range ingresses {
+		loadBalancers[ingress.LbScheme] = s.loadBalancer
+	}
+	return k8sStatus.Update(ingresses, loadBalancers, s.kubernetesClient)
+}
+
+func (s *status) String() string {
+	return "gorb status"
+}
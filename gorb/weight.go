@@ -0,0 +1,79 @@
+package gorb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NodeGetter gets a node, such as the k8s client.
+type NodeGetter interface {
+	GetNode(name string) (*corev1.Node, error)
+}
+
+// NodeWeight computes the backend weight from the node feed-ingress runs on, so nodes of different sizes get traffic
+// in proportion to their capacity.
+type NodeWeight struct {
+	Nodes    NodeGetter
+	NodeName string
+	// Label is the node label whose value is the weight. Nodes without it are weighted by PerCPU.
+	Label string
+	// PerCPU is the weight of each CPU of the node's capacity, or 0 to use the Config's BackendWeight.
+	PerCPU int
+	// HighLoad is the 1 minute load average per CPU above which the weight is halved, or 0 to never halve it.
+	HighLoad float64
+	// Interval is how often the weight is computed again, so changes to the label or load are picked up.
+	Interval time.Duration
+	// loadAverage returns the node's 1 minute load average.
+	loadAverage func() (float64, error)
+}
+
+// weight computes the weight of the node, starting from the default weight.
+func (w *NodeWeight) weight(defaultWeight int) (int, error) {
+	node, err := w.Nodes.GetNode(w.NodeName)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get node %s: %v", w.NodeName, err)
+	}
+	cpus := node.Status.Capacity.Cpu().Value()
+
+	weight := defaultWeight
+	if value, ok := node.Labels[w.Label]; w.Label != "" && ok {
+		weight, err = strconv.Atoi(value)
+		if err != nil || weight <= 0 {
+			return 0, fmt.Errorf("invalid weight %q in label %s of node %s", value, w.Label, w.NodeName)
+		}
+	} else if w.PerCPU > 0 && cpus > 0 {
+		weight = w.PerCPU * int(cpus)
+	}
+
+	if w.HighLoad > 0 && cpus > 0 {
+		load, err := w.loadAverage()
+		if err != nil {
+			return 0, err
+		}
+		if load/float64(cpus) > w.HighLoad {
+			weight /= 2
+			if weight < 1 {
+				weight = 1
+			}
+		}
+	}
+	return weight, nil
+}
+
+// procLoadAverage reads the 1 minute load average, which isn't namespaced so is the node's.
+func procLoadAverage() (float64, error) {
+	loadavg, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, fmt.Errorf("unable to read load average: %v", err)
+	}
+	fields := strings.Fields(string(loadavg))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unable to parse load average %q", loadavg)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
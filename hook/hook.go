@@ -0,0 +1,152 @@
+/*
+Package hook provides an updater which runs site specific steps at the start of shutdown, before frontends are
+deregistered and drained.
+*/
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+)
+
+// Config for the pre-drain hook.
+type Config struct {
+	// Command is run with /bin/sh -c.
+	Command string
+	// WebhookURL is sent a POST with the instance's hostname.
+	WebhookURL string
+	// Timeout for the command and webhook.
+	Timeout time.Duration
+}
+
+// Enabled returns true if there's a command or webhook to run.
+func (c Config) Enabled() bool {
+	return c.Command != "" || c.WebhookURL != ""
+}
+
+// New creates an updater which runs the hook when it's stopped. It should be the last updater, as updaters are
+// stopped in reverse order, so it runs before any frontends are deregistered.
+func New(conf Config) (controller.Updater, error) {
+	if !conf.Enabled() {
+		return nil, errors.New("unable to create pre-drain hook: missing command or webhook")
+	}
+	initMetrics()
+	return &hook{Config: conf, httpClient: &http.Client{}}, nil
+}
+
+type hook struct {
+	Config
+	httpClient *http.Client
+}
+
+type webhookRequest struct {
+	Event    string `json:"event"`
+	Instance string `json:"instance"`
+}
+
+func (h *hook) Start() error {
+	return nil
+}
+
+// Stop runs the command and webhook, returning any errors once both have finished. Errors don't prevent the rest
+// of the shutdown.
+func (h *hook) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+
+	var result *multierror.Error
+	if h.Command != "" {
+		log.Infof("Running pre-drain command: %s", h.Command)
+		if err := h.runCommand(ctx); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	if h.WebhookURL != "" {
+		log.Infof("Calling pre-drain webhook %s", h.WebhookURL)
+		if err := h.callWebhook(ctx); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	if err := result.ErrorOrNil(); err != nil {
+		hookFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+func (h *hook) runCommand(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", h.Command)
+	done := make(chan error, 1)
+	go func() {
+		out, err := cmd.CombinedOutput()
+		if len(out) > 0 {
+			log.Infof("Pre-drain command output: %s", out)
+		}
+		done <- err
+	}()
+
+	// Don't wait for output once timed out, as children of the shell can hold it open after the shell is killed.
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("pre-drain command failed: %v", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("pre-drain command timed out after %v", h.Timeout)
+	}
+}
+
+func (h *hook) callWebhook(ctx context.Context) error {
+	instance, err := os.Hostname()
+	if err != nil {
+		log.Warnf("Unable to lookup hostname for pre-drain webhook: %v", err)
+	}
+	body, err := json.Marshal(webhookRequest{Event: "pre-drain", Instance: instance})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid pre-drain webhook: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("pre-drain webhook failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("pre-drain webhook returned http status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (h *hook) Update(controller.IngressEntries) error {
+	return nil
+}
+
+func (h *hook) Health() error {
+	return nil
+}
+
+func (h *hook) Readiness() error {
+	return nil
+}
+
+func (h *hook) String() string {
+	return "pre-drain hook"
+}
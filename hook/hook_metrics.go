@@ -0,0 +1,18 @@
+package hook
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+var once sync.Once
+var hookFailures prometheus.Counter
+
+func initMetrics() {
+	once.Do(func() {
+		hookFailures = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"pre_drain_hook_failures", "The number of times the pre-drain command or webhook failed")
+	})
+}
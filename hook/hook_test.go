@@ -0,0 +1,105 @@
+package hook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+func TestCommandOrWebhookIsRequired(t *testing.T) {
+	_, err := New(Config{Timeout: time.Second})
+	assert.Error(t, err)
+}
+
+func TestCommandIsRunOnStop(t *testing.T) {
+	asserter := assert.New(t)
+	tmpDir, err := ioutil.TempDir("", "hook")
+	asserter.NoError(err)
+	defer os.RemoveAll(tmpDir)
+	marker := filepath.Join(tmpDir, "drained")
+
+	h, err := New(Config{Command: "touch " + marker, Timeout: time.Second})
+	asserter.NoError(err)
+
+	asserter.NoError(h.Start())
+	_, err = os.Stat(marker)
+	asserter.True(os.IsNotExist(err), "command shouldn't run until stopped")
+
+	asserter.NoError(h.Stop())
+	_, err = os.Stat(marker)
+	asserter.NoError(err, "command should have run")
+}
+
+func TestFailingCommandReturnsError(t *testing.T) {
+	h, err := New(Config{Command: "exit 1", Timeout: time.Second})
+	assert.NoError(t, err)
+
+	assert.Error(t, h.Stop())
+}
+
+func TestSlowCommandTimesOut(t *testing.T) {
+	h, err := New(Config{Command: "sleep 5", Timeout: time.Millisecond * 100})
+	assert.NoError(t, err)
+
+	start := time.Now()
+	assert.Error(t, h.Stop())
+	assert.True(t, time.Since(start) < time.Second*4, "command should have been killed")
+}
+
+func TestWebhookIsCalledOnStop(t *testing.T) {
+	asserter := assert.New(t)
+	var requests []webhookRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asserter.Equal(http.MethodPost, r.Method)
+		asserter.Equal("application/json", r.Header.Get("Content-Type"))
+		var req webhookRequest
+		asserter.NoError(json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+	}))
+	defer server.Close()
+
+	h, err := New(Config{WebhookURL: server.URL, Timeout: time.Second})
+	asserter.NoError(err)
+
+	asserter.NoError(h.Update(nil))
+	asserter.Empty(requests, "webhook shouldn't be called until stopped")
+	asserter.NoError(h.Stop())
+
+	hostname, _ := os.Hostname()
+	asserter.Equal([]webhookRequest{{Event: "pre-drain", Instance: hostname}}, requests)
+}
+
+func TestWebhookErrorStatusReturnsErrorAfterRunningCommand(t *testing.T) {
+	asserter := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	tmpDir, err := ioutil.TempDir("", "hook")
+	asserter.NoError(err)
+	defer os.RemoveAll(tmpDir)
+	marker := filepath.Join(tmpDir, "drained")
+
+	h, err := New(Config{Command: "touch " + marker, WebhookURL: server.URL, Timeout: time.Second})
+	asserter.NoError(err)
+
+	err = h.Stop()
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "http status 503")
+	}
+	_, err = os.Stat(marker)
+	asserter.NoError(err, "command should have run")
+}
@@ -9,16 +9,23 @@ package k8s
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	k8errors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	corev1_typed "k8s.io/client-go/kubernetes/typed/core/v1"
 	networkingv1_typed "k8s.io/client-go/kubernetes/typed/networking/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -27,6 +34,12 @@ import (
 // each existing endpoint / ingress produces a single update.
 const bufferedWatcherDuration = time.Millisecond * 50
 
+// How long a relisted informer has to sync before the relist is abandoned, and how often it's checked.
+const (
+	relistTimeout      = time.Minute
+	relistPollInterval = time.Millisecond * 100
+)
+
 // Client for connecting to a Kubernetes cluster.
 // Watchers will receive a notification whenever the client connects to the API server,
 // including reconnects, to notify that there may be new ingresses that need to be retrieved.
@@ -40,7 +53,7 @@ type Client interface {
 	// GetIngresses returns ingresses in namespaces with matching labels
 	GetIngresses([]*NamespaceSelector, bool) ([]*networkingv1.Ingress, error)
 
-	// GetServices returns all the services in the cluster.
+	// GetServices returns all the services in the cluster, or only those set with SetReferencedServices.
 	GetServices() ([]*corev1.Service, error)
 
 	// WatchIngresses watches for updates to ingresses and notifies the Watcher.
@@ -52,26 +65,104 @@ type Client interface {
 	// WatchNamespaces watches for updates to namespaces and notifies the Watcher.
 	WatchNamespaces() Watcher
 
+	// GetNamespaces returns all the namespaces in the cluster.
+	GetNamespaces() ([]*corev1.Namespace, error)
+
 	// UpdateIngressStatus updates the ingress status with the loadbalancer hostname or ip address.
 	UpdateIngressStatus(*networkingv1.Ingress) error
+
+	// GetRoutePolicies returns all the valid FeedRoutePolicies in the cluster.
+	GetRoutePolicies() ([]*RoutePolicy, error)
+
+	// WatchRoutePolicies watches for updates to FeedRoutePolicies and notifies the Watcher.
+	WatchRoutePolicies() Watcher
+
+	// GetConfigMaps returns all the config maps in the cluster.
+	GetConfigMaps() ([]*corev1.ConfigMap, error)
+
+	// WatchConfigMaps watches for updates to config maps and notifies the Watcher.
+	WatchConfigMaps() Watcher
+
+	// GetEndpointSlices returns the endpoint slices of the services set with SetEndpointSliceServices.
+	GetEndpointSlices() ([]*discoveryv1.EndpointSlice, error)
+
+	// WatchEndpointSlices watches for updates to the endpoint slices of the services set with
+	// SetEndpointSliceServices, and notifies the Watcher.
+	WatchEndpointSlices() Watcher
+
+	// SetReferencedServices sets the services, by namespace/name, which are listed and watched instead of all the
+	// services in the cluster. Services are relisted if any were added, so they're in the store when this returns.
+	SetReferencedServices(services map[string]bool) error
+
+	// SetEndpointSliceServices sets the services, by namespace/name, whose endpoint slices are watched. Endpoint
+	// slices are listed again if any services were added, which blocks until they've synced.
+	SetEndpointSliceServices(services map[string]bool) error
+
+	// GetSecrets returns the secrets labelled with APIKeysLabel.
+	GetSecrets() ([]*corev1.Secret, error)
+
+	// WatchSecrets watches for updates to secrets and notifies the Watcher.
+	WatchSecrets() Watcher
+
+	// GetPods returns the pods labelled with WeightedPodsLabel.
+	GetPods() ([]*corev1.Pod, error)
+
+	// WatchPods watches for updates to pods and notifies the Watcher.
+	WatchPods() Watcher
+
+	// RecordIngressEvent creates a Warning event on the ingress, so it's shown when the ingress is described.
+	RecordIngressEvent(ingress *networkingv1.Ingress, reason, message string) error
+
+	// GetNode returns the node of the name, from the apiserver rather than a watch.
+	GetNode(name string) (*corev1.Node, error)
+
+	// WatchActivity returns when each watched resource was last listed, or last had a watch event.
+	WatchActivity() map[string]time.Time
+
+	// Relist lists the watched ingresses and services from the apiserver again, and restarts their watches, so
+	// changes a watch missed are picked up.
+	Relist() error
 }
 
 type client struct {
 	sync.Mutex
-	ingressGetter       networkingv1_typed.IngressesGetter
-	stopCh              chan struct{}
-	informerFactory     informerFactory
-	eventHandlerFactory eventHandlerFactory
-	resyncPeriod        time.Duration
-	ingressStore        cache.Store
-	ingressController   cache.Controller
-	ingressWatcher      *handlerWatcher
-	serviceStore        cache.Store
-	serviceController   cache.Controller
-	serviceWatcher      *handlerWatcher
-	namespaceStore      cache.Store
-	namespaceController cache.Controller
-	namespaceWatcher    *handlerWatcher
+	ingressGetter           networkingv1_typed.IngressesGetter
+	eventsGetter            corev1_typed.EventsGetter
+	nodesGetter             corev1_typed.NodesGetter
+	stopCh                  chan struct{}
+	informerFactory         informerFactory
+	eventHandlerFactory     eventHandlerFactory
+	resyncPeriod            time.Duration
+	ingressStore            cache.Store
+	ingressController       cache.Controller
+	ingressWatcher          *handlerWatcher
+	ingressStop             func()
+	serviceStore            cache.Store
+	serviceController       cache.Controller
+	serviceWatcher          *handlerWatcher
+	serviceStop             func()
+	referencedServices      *serviceSet
+	namespaceStore          cache.Store
+	namespaceController     cache.Controller
+	namespaceWatcher        *handlerWatcher
+	routePolicyStore        cache.Store
+	routePolicyController   cache.Controller
+	routePolicyWatcher      *handlerWatcher
+	configMapStore          cache.Store
+	configMapController     cache.Controller
+	configMapWatcher        *handlerWatcher
+	endpointSliceStore      cache.Store
+	endpointSliceController cache.Controller
+	endpointSliceWatcher    *handlerWatcher
+	endpointSliceStop       func()
+	endpointSliceServices   serviceSet
+	secretStore             cache.Store
+	secretController        cache.Controller
+	secretWatcher           *handlerWatcher
+	podStore                cache.Store
+	podController           cache.Controller
+	podWatcher              *handlerWatcher
+	activity                *watchActivity
 }
 
 // NamespaceSelector defines the label name and value for filtering namespaces
@@ -87,17 +178,32 @@ func New(kubeconfig string, resyncPeriod time.Duration, stopCh chan struct{}) (C
 		return nil, err
 	}
 
-	clientset, err := kubernetes.NewForConfig(clientConfig)
+	// Custom resources are only served as JSON, so the dynamic client keeps the default content type.
+	dynamicClient, err := dynamic.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	protobufConfig := rest.CopyConfig(clientConfig)
+	protobufConfig.ContentType = runtime.ContentTypeProtobuf
+	protobufConfig.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	clientset, err := kubernetes.NewForConfig(protobufConfig)
 	if err != nil {
 		return nil, err
 	}
 
+	initMetrics()
+
+	activity := newWatchActivity()
 	return &client{
 		ingressGetter:       clientset.NetworkingV1(),
+		eventsGetter:        clientset.CoreV1(),
+		nodesGetter:         clientset.CoreV1(),
 		resyncPeriod:        resyncPeriod,
 		stopCh:              stopCh,
-		informerFactory:     &cacheInformerFactory{clientset: clientset},
+		informerFactory:     &cacheInformerFactory{clientset: clientset, dynamicClient: dynamicClient, activity: activity},
 		eventHandlerFactory: &bufferedEventHandlerFactory{},
+		activity:            activity,
 	}, nil
 }
 
@@ -106,15 +212,19 @@ func (c *client) GetAllIngresses() ([]*networkingv1.Ingress, error) {
 }
 
 func (c *client) GetIngresses(namespaceSelectors []*NamespaceSelector, matchAllNamespaceSelectors bool) ([]*networkingv1.Ingress, error) {
+	c.Lock()
+	ingressStore, ingressController := c.ingressStore, c.ingressController
+	c.Unlock()
+
 	if !c.namespaceController.HasSynced() {
 		return nil, errors.New("namespaces haven't synced yet")
 	}
-	if !c.ingressController.HasSynced() {
+	if !ingressController.HasSynced() {
 		return nil, errors.New("ingresses haven't synced yet")
 	}
 
 	var allIngresses []*networkingv1.Ingress
-	for _, obj := range c.ingressStore.List() {
+	for _, obj := range ingressStore.List() {
 		allIngresses = append(allIngresses, obj.(*networkingv1.Ingress))
 	}
 
@@ -213,21 +323,33 @@ func (c *client) createIngressSource() {
 
 	watcher := c.eventHandlerFactory.createBufferedHandler(bufferedWatcherDuration)
 	store, controller := c.informerFactory.createIngressInformer(c.resyncPeriod, watcher)
-	go controller.Run(c.stopCh)
 
 	c.ingressWatcher = watcher
 	c.ingressStore = store
 	c.ingressController = controller
+	c.ingressStop = c.runInformer(controller)
 }
 
 func (c *client) GetServices() ([]*corev1.Service, error) {
-	if !c.serviceController.HasSynced() {
+	c.Lock()
+	serviceStore, serviceController := c.serviceStore, c.serviceController
+	c.Unlock()
+
+	if !serviceController.HasSynced() {
 		return nil, errors.New("services haven't synced yet")
 	}
 
+	c.Lock()
+	referenced := c.referencedServices
+	c.Unlock()
+
 	var services []*corev1.Service
-	for _, obj := range c.serviceStore.List() {
-		services = append(services, obj.(*corev1.Service))
+	for _, obj := range serviceStore.List() {
+		service := obj.(*corev1.Service)
+		// services which are no longer referenced are left in the store until the next list
+		if referenced == nil || referenced.contains(service.Namespace, service.Name) {
+			services = append(services, service)
+		}
 	}
 
 	return services, nil
@@ -246,12 +368,114 @@ func (c *client) createServiceSource() {
 	}
 
 	watcher := c.eventHandlerFactory.createBufferedHandler(bufferedWatcherDuration)
-	store, controller := c.informerFactory.createServiceInformer(c.resyncPeriod, watcher)
-	go controller.Run(c.stopCh)
+	store, controller := c.informerFactory.createServiceInformer(c.resyncPeriod, watcher, c.referencedServices)
 
 	c.serviceWatcher = watcher
 	c.serviceStore = store
 	c.serviceController = controller
+	c.serviceStop = c.runInformer(controller)
+}
+
+func (c *client) SetReferencedServices(services map[string]bool) error {
+	c.Lock()
+	if c.referencedServices == nil {
+		c.referencedServices = &serviceSet{}
+	}
+	referenced := c.referencedServices
+	c.Unlock()
+
+	if !referenced.replace(services) {
+		return nil
+	}
+	// the added services were left out of the last list and watch
+	return c.relist("services", c.createServiceInformer,
+		&c.serviceWatcher, &c.serviceStore, &c.serviceController, &c.serviceStop)
+}
+
+func (c *client) createServiceInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+	c.Lock()
+	referenced := c.referencedServices
+	c.Unlock()
+	return c.informerFactory.createServiceInformer(resyncPeriod, eventHandler, referenced)
+}
+
+// runInformer runs the informer until the client is stopped, or the returned function is called when it's replaced.
+func (c *client) runInformer(controller cache.Controller) func() {
+	stop := make(chan struct{})
+	replaced := make(chan struct{})
+	go func() {
+		select {
+		case <-c.stopCh:
+		case <-replaced:
+		}
+		close(stop)
+	}()
+	go controller.Run(stop)
+
+	var once sync.Once
+	return func() { once.Do(func() { close(replaced) }) }
+}
+
+func (c *client) Relist() error {
+	if err := c.relist("ingresses", c.informerFactory.createIngressInformer,
+		&c.ingressWatcher, &c.ingressStore, &c.ingressController, &c.ingressStop); err != nil {
+		return err
+	}
+	return c.relist("services", c.createServiceInformer,
+		&c.serviceWatcher, &c.serviceStore, &c.serviceController, &c.serviceStop)
+}
+
+// relist replaces an informer with a new one, which lists everything again and starts a new watch. The old one is
+// kept until the new one has synced, so getters never see an empty store.
+func (c *client) relist(resource string, create func(time.Duration, cache.ResourceEventHandler) (cache.Store, cache.Controller),
+	watcher **handlerWatcher, store *cache.Store, controller *cache.Controller, stop *func()) error {
+
+	c.Lock()
+	handler := *watcher
+	c.Unlock()
+	if handler == nil {
+		// not watched, so there's nothing to relist
+		return nil
+	}
+
+	newStore, newController := create(c.resyncPeriod, handler)
+	newStop := c.runInformer(newController)
+	if !c.waitForSync(newController, relistTimeout) {
+		newStop()
+		return fmt.Errorf("%s didn't sync within %v of relisting them", resource, relistTimeout)
+	}
+
+	c.Lock()
+	oldStop := *stop
+	*store, *controller, *stop = newStore, newController, newStop
+	c.Unlock()
+
+	if oldStop != nil {
+		oldStop()
+	}
+	log.Infof("Relisted %s from the apiserver", resource)
+	return nil
+}
+
+func (c *client) waitForSync(controller cache.Controller, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for !controller.HasSynced() {
+		select {
+		case <-c.stopCh:
+			return false
+		case <-deadline:
+			return false
+		case <-time.After(relistPollInterval):
+		}
+	}
+	return true
+}
+
+func (c *client) GetNamespaces() ([]*corev1.Namespace, error) {
+	if !c.namespaceController.HasSynced() {
+		return nil, errors.New("namespaces haven't synced yet")
+	}
+	return toNamespaces(c.namespaceStore.List()), nil
 }
 
 func (c *client) WatchNamespaces() Watcher {
@@ -275,6 +499,197 @@ func (c *client) createNamespaceSource() {
 	c.namespaceController = controller
 }
 
+func (c *client) GetRoutePolicies() ([]*RoutePolicy, error) {
+	if !c.routePolicyController.HasSynced() {
+		return nil, errors.New("route policies haven't synced yet")
+	}
+
+	var policies []*RoutePolicy
+	for _, obj := range c.routePolicyStore.List() {
+		policy, err := toRoutePolicy(obj.(*unstructured.Unstructured))
+		if err != nil {
+			log.Warnf("Ignoring %v", err)
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func (c *client) WatchRoutePolicies() Watcher {
+	c.createRoutePolicySource()
+	return c.routePolicyWatcher
+}
+
+func (c *client) createRoutePolicySource() {
+	c.Lock()
+	defer c.Unlock()
+	if c.routePolicyStore != nil {
+		return
+	}
+
+	watcher := c.eventHandlerFactory.createBufferedHandler(bufferedWatcherDuration)
+	store, controller := c.informerFactory.createRoutePolicyInformer(c.resyncPeriod, watcher)
+	go controller.Run(c.stopCh)
+
+	c.routePolicyWatcher = watcher
+	c.routePolicyStore = store
+	c.routePolicyController = controller
+}
+
+func (c *client) GetConfigMaps() ([]*corev1.ConfigMap, error) {
+	if !c.configMapController.HasSynced() {
+		return nil, errors.New("config maps haven't synced yet")
+	}
+
+	var configMaps []*corev1.ConfigMap
+	for _, obj := range c.configMapStore.List() {
+		configMaps = append(configMaps, obj.(*corev1.ConfigMap))
+	}
+	return configMaps, nil
+}
+
+func (c *client) WatchConfigMaps() Watcher {
+	c.createConfigMapSource()
+	return c.configMapWatcher
+}
+
+func (c *client) createConfigMapSource() {
+	c.Lock()
+	defer c.Unlock()
+	if c.configMapStore != nil {
+		return
+	}
+
+	watcher := c.eventHandlerFactory.createBufferedHandler(bufferedWatcherDuration)
+	store, controller := c.informerFactory.createConfigMapInformer(c.resyncPeriod, watcher)
+	go controller.Run(c.stopCh)
+
+	c.configMapWatcher = watcher
+	c.configMapStore = store
+	c.configMapController = controller
+}
+
+func (c *client) GetEndpointSlices() ([]*discoveryv1.EndpointSlice, error) {
+	c.Lock()
+	endpointSliceStore, endpointSliceController := c.endpointSliceStore, c.endpointSliceController
+	c.Unlock()
+
+	if !endpointSliceController.HasSynced() {
+		return nil, errors.New("endpoint slices haven't synced yet")
+	}
+
+	var slices []*discoveryv1.EndpointSlice
+	for _, obj := range endpointSliceStore.List() {
+		slice := obj.(*discoveryv1.EndpointSlice)
+		// slices of services which are no longer used are left in the store until the next list
+		if c.endpointSliceServices.contains(slice.Namespace, slice.Labels[discoveryv1.LabelServiceName]) {
+			slices = append(slices, slice)
+		}
+	}
+	return slices, nil
+}
+
+func (c *client) WatchEndpointSlices() Watcher {
+	c.createEndpointSliceSource()
+	return c.endpointSliceWatcher
+}
+
+func (c *client) SetEndpointSliceServices(services map[string]bool) error {
+	if !c.endpointSliceServices.replace(services) {
+		return nil
+	}
+	// the slices of the added services were left out of the last list and watch
+	return c.relist("endpoint slices", c.createEndpointSliceInformer,
+		&c.endpointSliceWatcher, &c.endpointSliceStore, &c.endpointSliceController, &c.endpointSliceStop)
+}
+
+func (c *client) createEndpointSliceInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+	return c.informerFactory.createEndpointSliceInformer(resyncPeriod, eventHandler, &c.endpointSliceServices)
+}
+
+func (c *client) createEndpointSliceSource() {
+	c.Lock()
+	defer c.Unlock()
+	if c.endpointSliceStore != nil {
+		return
+	}
+
+	watcher := c.eventHandlerFactory.createBufferedHandler(bufferedWatcherDuration)
+	store, controller := c.createEndpointSliceInformer(c.resyncPeriod, watcher)
+
+	c.endpointSliceWatcher = watcher
+	c.endpointSliceStore = store
+	c.endpointSliceController = controller
+	c.endpointSliceStop = c.runInformer(controller)
+}
+
+func (c *client) GetSecrets() ([]*corev1.Secret, error) {
+	if !c.secretController.HasSynced() {
+		return nil, errors.New("secrets haven't synced yet")
+	}
+
+	var secrets []*corev1.Secret
+	for _, obj := range c.secretStore.List() {
+		secrets = append(secrets, obj.(*corev1.Secret))
+	}
+	return secrets, nil
+}
+
+func (c *client) WatchSecrets() Watcher {
+	c.createSecretSource()
+	return c.secretWatcher
+}
+
+func (c *client) createSecretSource() {
+	c.Lock()
+	defer c.Unlock()
+	if c.secretStore != nil {
+		return
+	}
+
+	watcher := c.eventHandlerFactory.createBufferedHandler(bufferedWatcherDuration)
+	store, controller := c.informerFactory.createSecretInformer(c.resyncPeriod, watcher)
+	go controller.Run(c.stopCh)
+
+	c.secretWatcher = watcher
+	c.secretStore = store
+	c.secretController = controller
+}
+
+func (c *client) GetPods() ([]*corev1.Pod, error) {
+	if !c.podController.HasSynced() {
+		return nil, errors.New("pods haven't synced yet")
+	}
+
+	var pods []*corev1.Pod
+	for _, obj := range c.podStore.List() {
+		pods = append(pods, obj.(*corev1.Pod))
+	}
+	return pods, nil
+}
+
+func (c *client) WatchPods() Watcher {
+	c.createPodSource()
+	return c.podWatcher
+}
+
+func (c *client) createPodSource() {
+	c.Lock()
+	defer c.Unlock()
+	if c.podStore != nil {
+		return
+	}
+
+	watcher := c.eventHandlerFactory.createBufferedHandler(bufferedWatcherDuration)
+	store, controller := c.informerFactory.createPodInformer(c.resyncPeriod, watcher)
+	go controller.Run(c.stopCh)
+
+	c.podWatcher = watcher
+	c.podStore = store
+	c.podController = controller
+}
+
 func (c *client) UpdateIngressStatus(ingress *networkingv1.Ingress) error {
 	ingressClient := c.ingressGetter.Ingresses(ingress.Namespace)
 
@@ -312,6 +727,41 @@ func (c *client) updateIngressAndHandleConflicts(ingressClient networkingv1_type
 	}
 }
 
+func (c *client) RecordIngressEvent(ingress *networkingv1.Ingress, reason, message string) error {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: ingress.Name + ".",
+			Namespace:    ingress.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      "networking.k8s.io/v1",
+			Kind:            "Ingress",
+			Namespace:       ingress.Namespace,
+			Name:            ingress.Name,
+			UID:             ingress.UID,
+			ResourceVersion: ingress.ResourceVersion,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: "feed-ingress"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := c.eventsGetter.Events(ingress.Namespace).Create(context.Background(), event, metav1.CreateOptions{})
+	return err
+}
+
+func (c *client) GetNode(name string) (*corev1.Node, error) {
+	return c.nodesGetter.Nodes().Get(context.Background(), name, metav1.GetOptions{})
+}
+
+func (c *client) WatchActivity() map[string]time.Time {
+	return c.activity.snapshot()
+}
+
 func ingressStatusEqual(i1 []corev1.LoadBalancerIngress, i2 []corev1.LoadBalancerIngress) bool {
 	if len(i1) != len(i2) {
 		return false
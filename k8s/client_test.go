@@ -10,9 +10,11 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/mock"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/tools/cache"
 
 	"github.com/sky-uk/feed/k8s/mocks"
@@ -136,7 +138,7 @@ var _ = Describe("Client", func() {
 			It("should create the service source and return the corresponding watcher", func() {
 				runExecutedCh := make(chan struct{})
 				fakesHandlerFactory.On("createBufferedHandler", bufferedWatcherDuration).Return(eventHandler)
-				fakesInformerFactory.On("createServiceInformer", resyncPeriod, eventHandler).Return(fakesStore, fakesController)
+				fakesInformerFactory.On("createServiceInformer", resyncPeriod, eventHandler, (*serviceSet)(nil)).Return(fakesStore, fakesController)
 				fakesController.On("Run", mock.Anything).Run(func(args mock.Arguments) {
 					runExecutedCh <- struct{}{}
 				})
@@ -176,7 +178,7 @@ var _ = Describe("Client", func() {
 			It("should guard against concurrent access", func() {
 				runExecutedCh := make(chan struct{})
 				fakesHandlerFactory.On("createBufferedHandler", bufferedWatcherDuration).Return(eventHandler)
-				fakesInformerFactory.On("createServiceInformer", resyncPeriod, eventHandler).Return(fakesStore, fakesController)
+				fakesInformerFactory.On("createServiceInformer", resyncPeriod, eventHandler, (*serviceSet)(nil)).Return(fakesStore, fakesController)
 				fakesController.On("Run", mock.Anything).Run(func(args mock.Arguments) {
 					runExecutedCh <- struct{}{}
 				})
@@ -271,6 +273,66 @@ var _ = Describe("Client", func() {
 			})
 		})
 
+		Describe("Relist", func() {
+
+			It("should replace the watched informers once the new ones have synced", func() {
+				oldStopped := false
+				clt.ingressWatcher = eventHandler
+				clt.ingressStore = &cache.FakeCustomStore{}
+				clt.ingressController = &fakeController{}
+				clt.ingressStop = func() { oldStopped = true }
+
+				fakesInformerFactory.On("createIngressInformer", resyncPeriod, eventHandler).Return(fakesStore, fakesController)
+				fakesController.On("Run", mock.Anything)
+				fakesController.On("HasSynced").Return(true)
+
+				Expect(clt.Relist()).To(Succeed())
+
+				Expect(clt.ingressStore).To(Equal(fakesStore))
+				Expect(clt.ingressController).To(Equal(fakesController))
+				Expect(oldStopped).To(BeTrue())
+				Expect(clt.serviceStore).To(BeNil(), "services aren't watched, so shouldn't be relisted")
+			})
+
+			It("should relist endpoint slices when services are added to them", func() {
+				clt.endpointSliceWatcher = eventHandler
+				clt.endpointSliceStore = &cache.FakeCustomStore{}
+				clt.endpointSliceController = &fakeController{}
+				clt.endpointSliceStop = func() {}
+
+				fakesInformerFactory.On("createEndpointSliceInformer", resyncPeriod, eventHandler, &clt.endpointSliceServices).
+					Return(fakesStore, fakesController).Once()
+				fakesController.On("Run", mock.Anything)
+				fakesController.On("HasSynced").Return(true)
+
+				Expect(clt.SetEndpointSliceServices(map[string]bool{"team/app": true, "team/web": true})).To(Succeed())
+				Expect(clt.endpointSliceStore).To(Equal(fakesStore))
+
+				Expect(clt.SetEndpointSliceServices(map[string]bool{"team/app": true})).To(Succeed(),
+					"removing services shouldn't relist")
+			})
+
+			It("should relist services when referenced services are added", func() {
+				Expect(clt.SetReferencedServices(map[string]bool{"team/app": true})).To(Succeed(),
+					"services aren't watched yet, so shouldn't be relisted")
+
+				clt.serviceWatcher = eventHandler
+				clt.serviceStore = &cache.FakeCustomStore{}
+				clt.serviceController = &fakeController{}
+				clt.serviceStop = func() {}
+
+				fakesInformerFactory.On("createServiceInformer", resyncPeriod, eventHandler, clt.referencedServices).
+					Return(fakesStore, fakesController).Once()
+				fakesController.On("Run", mock.Anything)
+				fakesController.On("HasSynced").Return(true)
+
+				Expect(clt.SetReferencedServices(map[string]bool{"team/app": true, "team/web": true})).To(Succeed())
+				Expect(clt.serviceStore).To(Equal(fakesStore))
+
+				Expect(clt.SetReferencedServices(map[string]bool{"team/web": true})).To(Succeed(),
+					"removing services shouldn't relist")
+			})
+		})
 	})
 
 	Describe("GetAllIngresses", func() {
@@ -491,6 +553,22 @@ var _ = Describe("Client", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("should only return referenced services when they're set", func() {
+			servicesInStore := []*corev1.Service{
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "app"}},
+				{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "old"}},
+			}
+			fakesServiceStore.ListFunc = func() []interface{} {
+				return []interface{}{servicesInStore[0], servicesInStore[1]}
+			}
+			fakesServiceController.On("HasSynced").Return(true)
+			clt.referencedServices = &serviceSet{services: map[string]bool{"team/app": true}}
+
+			services, err := clt.GetServices()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(services).To(Equal(servicesInStore[:1]))
+		})
+
 		It("should return an error when service controller has not synced", func() {
 			fakesServiceController.On("HasSynced").Return(false)
 			services, err := clt.GetServices()
@@ -500,6 +578,230 @@ var _ = Describe("Client", func() {
 
 	})
 
+	Describe("GetRoutePolicies", func() {
+		var (
+			fakesRoutePolicyStore      *cache.FakeCustomStore
+			fakesRoutePolicyController *fakeController
+			clt                        *client
+		)
+
+		routePolicy := func(name string, spec map[string]interface{}) *unstructured.Unstructured {
+			obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+			obj.SetNamespace("team")
+			obj.SetName(name)
+			return obj
+		}
+
+		BeforeEach(func() {
+			fakesRoutePolicyController = &fakeController{}
+			fakesRoutePolicyStore = &cache.FakeCustomStore{}
+			clt = &client{
+				routePolicyController: fakesRoutePolicyController,
+				routePolicyStore:      fakesRoutePolicyStore,
+			}
+		})
+
+		It("should return the valid route policies in the store when it has synced", func() {
+			fakesRoutePolicyStore.ListFunc = func() []interface{} {
+				return []interface{}{
+					routePolicy("valid", map[string]interface{}{
+						"hosts":                   []interface{}{"Foo.com"},
+						"allow":                   []interface{}{"10.0.0.0/8"},
+						"backendTimeoutSeconds":   int64(30),
+						"backendKeepaliveTimeout": "10s",
+						"rateLimit":               map[string]interface{}{"requestsPerSecond": int64(10), "burst": int64(20)},
+						"requestHeaders":          map[string]interface{}{"X-Team": "team"},
+						"responseHeaders":         map[string]interface{}{"Cache-Control": "no-store", "Server": ""},
+					}),
+					routePolicy("invalid-allow", map[string]interface{}{"allow": []interface{}{"nope"}}),
+					routePolicy("invalid-timeout", map[string]interface{}{"backendTimeoutSeconds": int64(-1)}),
+					routePolicy("invalid-rate-limit", map[string]interface{}{
+						"rateLimit": map[string]interface{}{"requestsPerSecond": int64(0)},
+					}),
+					routePolicy("reserved-request-header", map[string]interface{}{
+						"requestHeaders": map[string]interface{}{"Host": "example.com"},
+					}),
+					routePolicy("invalid-response-header", map[string]interface{}{
+						"responseHeaders": map[string]interface{}{"X-Injected": "a\";\n    return 200"},
+					}),
+					routePolicy("header-variable", map[string]interface{}{
+						"requestHeaders": map[string]interface{}{"X-Secret": "$http_authorization"},
+					}),
+				}
+			}
+			fakesRoutePolicyController.On("HasSynced").Return(true)
+
+			policies, err := clt.GetRoutePolicies()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policies).To(HaveLen(1))
+			Expect(policies[0].Namespace).To(Equal("team"))
+			Expect(policies[0].Name).To(Equal("valid"))
+			Expect(policies[0].Spec.Hosts).To(Equal([]string{"foo.com"}))
+			Expect(*policies[0].Spec.Allow).To(Equal([]string{"10.0.0.0/8"}))
+			Expect(*policies[0].Spec.BackendTimeoutSeconds).To(Equal(30))
+			Expect(policies[0].Spec.KeepaliveTimeout()).To(Equal(10 * time.Second))
+			Expect(policies[0].Spec.StripPath).To(BeNil())
+			Expect(*policies[0].Spec.RateLimit).To(Equal(RateLimit{RequestsPerSecond: 10, Burst: 20}))
+			Expect(policies[0].Spec.RequestHeaders).To(Equal(map[string]string{"X-Team": "team"}))
+			Expect(policies[0].Spec.ResponseHeaders).To(Equal(map[string]string{"Cache-Control": "no-store", "Server": ""}))
+		})
+
+		It("should return an error when route policy controller has not synced", func() {
+			fakesRoutePolicyController.On("HasSynced").Return(false)
+			policies, err := clt.GetRoutePolicies()
+			Expect(err).To(HaveOccurred())
+			Expect(policies).To(BeNil())
+		})
+	})
+
+	Describe("GetConfigMaps", func() {
+		var (
+			fakesConfigMapStore      *cache.FakeCustomStore
+			fakesConfigMapController *fakeController
+			clt                      *client
+		)
+
+		BeforeEach(func() {
+			fakesConfigMapController = &fakeController{}
+			fakesConfigMapStore = &cache.FakeCustomStore{}
+			clt = &client{
+				configMapController: fakesConfigMapController,
+				configMapStore:      fakesConfigMapStore,
+			}
+		})
+
+		It("should return the config maps in the store when it has synced", func() {
+			configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "allow"}}
+			fakesConfigMapStore.ListFunc = func() []interface{} {
+				return []interface{}{configMap}
+			}
+			fakesConfigMapController.On("HasSynced").Return(true)
+
+			configMaps, err := clt.GetConfigMaps()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMaps).To(Equal([]*corev1.ConfigMap{configMap}))
+		})
+
+		It("should return an error when config map controller has not synced", func() {
+			fakesConfigMapController.On("HasSynced").Return(false)
+			configMaps, err := clt.GetConfigMaps()
+			Expect(err).To(HaveOccurred())
+			Expect(configMaps).To(BeNil())
+		})
+	})
+
+	Describe("GetPods", func() {
+		var (
+			fakesPodStore      *cache.FakeCustomStore
+			fakesPodController *fakeController
+			clt                *client
+		)
+
+		BeforeEach(func() {
+			fakesPodController = &fakeController{}
+			fakesPodStore = &cache.FakeCustomStore{}
+			clt = &client{
+				podController: fakesPodController,
+				podStore:      fakesPodStore,
+			}
+		})
+
+		It("should return the pods in the store when it has synced", func() {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "app-abcde"}}
+			fakesPodStore.ListFunc = func() []interface{} {
+				return []interface{}{pod}
+			}
+			fakesPodController.On("HasSynced").Return(true)
+
+			pods, err := clt.GetPods()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pods).To(Equal([]*corev1.Pod{pod}))
+		})
+
+		It("should return an error when pod controller has not synced", func() {
+			fakesPodController.On("HasSynced").Return(false)
+			pods, err := clt.GetPods()
+			Expect(err).To(HaveOccurred())
+			Expect(pods).To(BeNil())
+		})
+	})
+
+	Describe("GetEndpointSlices", func() {
+		var (
+			fakesEndpointSliceStore      *cache.FakeCustomStore
+			fakesEndpointSliceController *fakeController
+			clt                          *client
+		)
+
+		BeforeEach(func() {
+			fakesEndpointSliceController = &fakeController{}
+			fakesEndpointSliceStore = &cache.FakeCustomStore{}
+			clt = &client{
+				endpointSliceController: fakesEndpointSliceController,
+				endpointSliceStore:      fakesEndpointSliceStore,
+			}
+		})
+
+		It("should return the endpoint slices of the services in use when it has synced", func() {
+			used := &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "app-abcde",
+				Labels: map[string]string{discoveryv1.LabelServiceName: "app"}}}
+			unused := &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "old-abcde",
+				Labels: map[string]string{discoveryv1.LabelServiceName: "old"}}}
+			fakesEndpointSliceStore.ListFunc = func() []interface{} {
+				return []interface{}{used, unused}
+			}
+			fakesEndpointSliceController.On("HasSynced").Return(true)
+			Expect(clt.SetEndpointSliceServices(map[string]bool{"team/app": true})).To(Succeed())
+
+			slices, err := clt.GetEndpointSlices()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(slices).To(Equal([]*discoveryv1.EndpointSlice{used}))
+		})
+
+		It("should return an error when endpoint slice controller has not synced", func() {
+			fakesEndpointSliceController.On("HasSynced").Return(false)
+			slices, err := clt.GetEndpointSlices()
+			Expect(err).To(HaveOccurred())
+			Expect(slices).To(BeNil())
+		})
+	})
+
+	Describe("GetSecrets", func() {
+		var (
+			fakesSecretStore      *cache.FakeCustomStore
+			fakesSecretController *fakeController
+			clt                   *client
+		)
+
+		BeforeEach(func() {
+			fakesSecretController = &fakeController{}
+			fakesSecretStore = &cache.FakeCustomStore{}
+			clt = &client{
+				secretController: fakesSecretController,
+				secretStore:      fakesSecretStore,
+			}
+		})
+
+		It("should return the secrets in the store when it has synced", func() {
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "api-keys"}}
+			fakesSecretStore.ListFunc = func() []interface{} {
+				return []interface{}{secret}
+			}
+			fakesSecretController.On("HasSynced").Return(true)
+
+			secrets, err := clt.GetSecrets()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secrets).To(Equal([]*corev1.Secret{secret}))
+		})
+
+		It("should return an error when secret controller has not synced", func() {
+			fakesSecretController.On("HasSynced").Return(false)
+			secrets, err := clt.GetSecrets()
+			Expect(err).To(HaveOccurred())
+			Expect(secrets).To(BeNil())
+		})
+	})
+
 	Describe("UpdateStatus", func() {
 		var mockController *gomock.Controller
 		var ingressClient *mocks.MockIngressInterface
@@ -641,7 +943,34 @@ func (i *fakeInformerFactory) createIngressInformer(resyncPeriod time.Duration,
 	return args.Get(0).(cache.Store), args.Get(1).(cache.Controller)
 }
 
-func (i *fakeInformerFactory) createServiceInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+func (i *fakeInformerFactory) createServiceInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler,
+	services *serviceSet) (cache.Store, cache.Controller) {
+	args := i.Called(resyncPeriod, eventHandler, services)
+	return args.Get(0).(cache.Store), args.Get(1).(cache.Controller)
+}
+
+func (i *fakeInformerFactory) createRoutePolicyInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+	args := i.Called(resyncPeriod, eventHandler)
+	return args.Get(0).(cache.Store), args.Get(1).(cache.Controller)
+}
+
+func (i *fakeInformerFactory) createConfigMapInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+	args := i.Called(resyncPeriod, eventHandler)
+	return args.Get(0).(cache.Store), args.Get(1).(cache.Controller)
+}
+
+func (i *fakeInformerFactory) createEndpointSliceInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler,
+	services *serviceSet) (cache.Store, cache.Controller) {
+	args := i.Called(resyncPeriod, eventHandler, services)
+	return args.Get(0).(cache.Store), args.Get(1).(cache.Controller)
+}
+
+func (i *fakeInformerFactory) createSecretInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+	args := i.Called(resyncPeriod, eventHandler)
+	return args.Get(0).(cache.Store), args.Get(1).(cache.Controller)
+}
+
+func (i *fakeInformerFactory) createPodInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
 	args := i.Called(resyncPeriod, eventHandler)
 	return args.Get(0).(cache.Store), args.Get(1).(cache.Controller)
 }
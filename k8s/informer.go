@@ -1,11 +1,18 @@
 package k8s
 
 import (
+	"context"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 )
@@ -16,24 +23,116 @@ var _ informerFactory = &cacheInformerFactory{}
 type informerFactory interface {
 	createNamespaceInformer(time.Duration, cache.ResourceEventHandler) (cache.Store, cache.Controller)
 	createIngressInformer(time.Duration, cache.ResourceEventHandler) (cache.Store, cache.Controller)
-	createServiceInformer(time.Duration, cache.ResourceEventHandler) (cache.Store, cache.Controller)
+	createServiceInformer(time.Duration, cache.ResourceEventHandler, *serviceSet) (cache.Store, cache.Controller)
+	createRoutePolicyInformer(time.Duration, cache.ResourceEventHandler) (cache.Store, cache.Controller)
+	createConfigMapInformer(time.Duration, cache.ResourceEventHandler) (cache.Store, cache.Controller)
+	createEndpointSliceInformer(time.Duration, cache.ResourceEventHandler, *serviceSet) (cache.Store, cache.Controller)
+	createSecretInformer(time.Duration, cache.ResourceEventHandler) (cache.Store, cache.Controller)
+	createPodInformer(time.Duration, cache.ResourceEventHandler) (cache.Store, cache.Controller)
 }
 
 type cacheInformerFactory struct {
-	clientset *kubernetes.Clientset
+	clientset     *kubernetes.Clientset
+	dynamicClient dynamic.Interface
+	activity      *watchActivity
+}
+
+// listWatch pages the lists of lw, and observes and records the activity of its lists and watches.
+func (c *cacheInformerFactory) listWatch(resource string, lw cache.ListerWatcher) cache.ListerWatcher {
+	return c.activity.track(resource, &pagedListWatch{ListerWatcher: lw, resource: resource, duration: requestDuration})
 }
 
 func (c *cacheInformerFactory) createNamespaceInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
 	namespaceLW := cache.NewListWatchFromClient(c.clientset.CoreV1().RESTClient(), "namespaces", "", fields.Everything())
-	return cache.NewInformer(namespaceLW, &corev1.Namespace{}, resyncPeriod, eventHandler)
+	return cache.NewInformer(c.listWatch("namespaces", namespaceLW), &corev1.Namespace{}, resyncPeriod, eventHandler)
 }
 
 func (c *cacheInformerFactory) createIngressInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
 	ingressLW := cache.NewListWatchFromClient(c.clientset.NetworkingV1().RESTClient(), "ingresses", "", fields.Everything())
-	return cache.NewInformer(ingressLW, &networkingv1.Ingress{}, resyncPeriod, eventHandler)
+	return cache.NewInformer(c.listWatch("ingresses", ingressLW), &networkingv1.Ingress{}, resyncPeriod, eventHandler)
 }
 
-func (c *cacheInformerFactory) createServiceInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+// createServiceInformer only keeps the services in the set, unless it's nil, so unreferenced services aren't stored or
+// notified.
+func (c *cacheInformerFactory) createServiceInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler,
+	services *serviceSet) (cache.Store, cache.Controller) {
 	serviceLW := cache.NewListWatchFromClient(c.clientset.CoreV1().RESTClient(), "services", "", fields.Everything())
-	return cache.NewInformer(serviceLW, &corev1.Service{}, resyncPeriod, eventHandler)
+	if services == nil {
+		return cache.NewInformer(c.listWatch("services", serviceLW), &corev1.Service{}, resyncPeriod, eventHandler)
+	}
+	filteredLW := &filteredListWatch{
+		ListerWatcher: c.listWatch("services", serviceLW),
+		keep: func(obj runtime.Object) bool {
+			service, ok := obj.(*corev1.Service)
+			return ok && services.contains(service.Namespace, service.Name)
+		},
+	}
+	return cache.NewInformer(filteredLW, &corev1.Service{}, resyncPeriod, eventHandler)
+}
+
+func (c *cacheInformerFactory) createRoutePolicyInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+	routePolicies := c.dynamicClient.Resource(RoutePolicyResource).Namespace(metav1.NamespaceAll)
+	routePolicyLW := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return routePolicies.List(context.Background(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return routePolicies.Watch(context.Background(), options)
+		},
+	}
+	return cache.NewInformer(c.listWatch(RoutePolicyResource.Resource, routePolicyLW), &unstructured.Unstructured{}, resyncPeriod, eventHandler)
+}
+
+// AllowListLabel must be set to true on config maps which ingresses can take allow lists from, so feed only watches
+// those, and only config maps published as allow lists can be referenced.
+const AllowListLabel = "feed.sky.uk/allow-list"
+
+func (c *cacheInformerFactory) createConfigMapInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+	configMapLW := cache.NewFilteredListWatchFromClient(c.clientset.CoreV1().RESTClient(), "configmaps", "",
+		withLabel(AllowListLabel))
+	return cache.NewInformer(c.listWatch("configmaps", configMapLW), &corev1.ConfigMap{}, resyncPeriod, eventHandler)
+}
+
+// withLabel restricts lists and watches to resources with label set to true.
+func withLabel(label string) func(*metav1.ListOptions) {
+	return func(options *metav1.ListOptions) {
+		options.LabelSelector = label + "=true"
+	}
+}
+
+// createEndpointSliceInformer only keeps the endpoint slices of services in the set, so the endpoints of the rest
+// of the cluster aren't stored, and changes to them aren't notified.
+func (c *cacheInformerFactory) createEndpointSliceInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler,
+	services *serviceSet) (cache.Store, cache.Controller) {
+	// slices which aren't managed for a service have no service name label
+	endpointSliceLW := cache.NewFilteredListWatchFromClient(c.clientset.DiscoveryV1().RESTClient(), "endpointslices", "",
+		func(options *metav1.ListOptions) { options.LabelSelector = discoveryv1.LabelServiceName })
+	filteredLW := &filteredListWatch{
+		ListerWatcher: c.listWatch("endpointslices", endpointSliceLW),
+		keep: func(obj runtime.Object) bool {
+			slice, ok := obj.(*discoveryv1.EndpointSlice)
+			return ok && services.contains(slice.Namespace, slice.Labels[discoveryv1.LabelServiceName])
+		},
+	}
+	return cache.NewInformer(filteredLW, &discoveryv1.EndpointSlice{}, resyncPeriod, eventHandler)
+}
+
+// APIKeysLabel must be set to true on secrets which ingresses can take API keys from, so feed only watches those,
+// rather than holding every secret in the cluster.
+const APIKeysLabel = "feed.sky.uk/api-keys"
+
+func (c *cacheInformerFactory) createSecretInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+	secretLW := cache.NewFilteredListWatchFromClient(c.clientset.CoreV1().RESTClient(), "secrets", "",
+		withLabel(APIKeysLabel))
+	return cache.NewInformer(c.listWatch("secrets", secretLW), &corev1.Secret{}, resyncPeriod, eventHandler)
+}
+
+// WeightedPodsLabel must be set to true on pods which set their upstream weight, so feed only watches those, rather
+// than holding every pod in the cluster.
+const WeightedPodsLabel = "feed.sky.uk/weighted"
+
+func (c *cacheInformerFactory) createPodInformer(resyncPeriod time.Duration, eventHandler cache.ResourceEventHandler) (cache.Store, cache.Controller) {
+	podLW := cache.NewFilteredListWatchFromClient(c.clientset.CoreV1().RESTClient(), "pods", "",
+		withLabel(WeightedPodsLabel))
+	return cache.NewInformer(c.listWatch("pods", podLW), &corev1.Pod{}, resyncPeriod, eventHandler)
 }
@@ -0,0 +1,131 @@
+package k8s
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// listPageSize is how many objects the apiserver returns per page of a list. Later pages are fetched with the
+// continue token of the previous one.
+const listPageSize = 500
+
+var once sync.Once
+var requestDuration *prometheus.HistogramVec
+
+func initMetrics() {
+	once.Do(func() {
+		requestDuration = metrics.RegisterNewDefaultHistogramVec(metrics.PrometheusControllerSubsystem,
+			"kubernetes_request_duration_seconds",
+			"How long lists and watches of each resource take to be served by the apiserver, in seconds. "+
+				"Each page of a list is observed separately.",
+			nil, []string{"resource", "verb"})
+	})
+}
+
+// pagedListWatch chunks the lists of lw into pages, and observes how long each list and watch request takes.
+type pagedListWatch struct {
+	cache.ListerWatcher
+	resource string
+	duration *prometheus.HistogramVec
+}
+
+func (p *pagedListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	// The apiserver serves resource version 0 from its watch cache, which ignores the limit and returns everything
+	// at once, so the first page reads the latest version instead.
+	if options.ResourceVersion == "0" && options.Continue == "" {
+		options.ResourceVersion = ""
+	}
+	if options.Limit == 0 {
+		options.Limit = listPageSize
+	}
+
+	start := time.Now()
+	list, err := p.ListerWatcher.List(options)
+	p.duration.WithLabelValues(p.resource, "list").Observe(time.Since(start).Seconds())
+	return list, err
+}
+
+func (p *pagedListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	start := time.Now()
+	w, err := p.ListerWatcher.Watch(options)
+	p.duration.WithLabelValues(p.resource, "watch").Observe(time.Since(start).Seconds())
+	return w, err
+}
+
+// filteredListWatch only lists and watches the objects of lw which keep returns true for, so the others aren't
+// stored or notified. Objects which stop being kept stay in the store until they're listed again.
+type filteredListWatch struct {
+	cache.ListerWatcher
+	keep func(runtime.Object) bool
+}
+
+func (f *filteredListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	list, err := f.ListerWatcher.List(options)
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	var kept []runtime.Object
+	for _, item := range items {
+		if f.keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	if err := meta.SetList(list, kept); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (f *filteredListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := f.ListerWatcher.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		switch event.Type {
+		case watch.Added, watch.Modified, watch.Deleted:
+			return event, f.keep(event.Object)
+		default:
+			// errors and bookmarks are needed by the reflector
+			return event, true
+		}
+	}), nil
+}
+
+// serviceSet is a set of services, by namespace/name, which can be changed while it's used to filter a list watch.
+type serviceSet struct {
+	sync.RWMutex
+	services map[string]bool
+}
+
+func (s *serviceSet) contains(namespace, name string) bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.services[namespace+"/"+name]
+}
+
+// replace sets the services, returning true if any were added.
+func (s *serviceSet) replace(services map[string]bool) bool {
+	s.Lock()
+	defer s.Unlock()
+	added := false
+	for service := range services {
+		if !s.services[service] {
+			added = true
+		}
+	}
+	s.services = services
+	return added
+}
@@ -0,0 +1,111 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newPagedListWatch(lists *[]metav1.ListOptions) *pagedListWatch {
+	return &pagedListWatch{
+		ListerWatcher: &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				*lists = append(*lists, options)
+				return &corev1.ServiceList{}, nil
+			},
+			WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+				return watch.NewFake(), nil
+			},
+		},
+		resource: "services",
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test"}, []string{"resource", "verb"}),
+	}
+}
+
+func TestListsArePaged(t *testing.T) {
+	var lists []metav1.ListOptions
+	lw := newPagedListWatch(&lists)
+
+	_, err := lw.List(metav1.ListOptions{ResourceVersion: "0"})
+	assert.NoError(t, err)
+	_, err = lw.List(metav1.ListOptions{Limit: 100, Continue: "next-page"})
+	assert.NoError(t, err)
+	_, err = lw.List(metav1.ListOptions{ResourceVersion: "1234"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []metav1.ListOptions{
+		{Limit: listPageSize},
+		{Limit: 100, Continue: "next-page"},
+		{Limit: listPageSize, ResourceVersion: "1234"},
+	}, lists)
+}
+
+func TestListAndWatchDurationsAreObserved(t *testing.T) {
+	var lists []metav1.ListOptions
+	lw := newPagedListWatch(&lists)
+
+	_, err := lw.List(metav1.ListOptions{})
+	assert.NoError(t, err)
+	w, err := lw.Watch(metav1.ListOptions{})
+	assert.NoError(t, err)
+	w.Stop()
+
+	assert.Equal(t, 2, testutil.CollectAndCount(lw.duration))
+}
+
+func TestOnlyTheEndpointSlicesOfServicesInTheSetAreListedAndWatched(t *testing.T) {
+	asserter := assert.New(t)
+	slice := func(namespace, service string) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: service + "-abcde",
+			Labels: map[string]string{discoveryv1.LabelServiceName: service}}}
+	}
+	services := &serviceSet{}
+	asserter.True(services.replace(map[string]bool{"team/app": true}))
+	fakeWatch := watch.NewFakeWithChanSize(3, false)
+	lw := &filteredListWatch{
+		ListerWatcher: &cache.ListWatch{
+			ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+				return &discoveryv1.EndpointSliceList{
+					ListMeta: metav1.ListMeta{Continue: "next-page"},
+					Items:    []discoveryv1.EndpointSlice{*slice("team", "app"), *slice("team", "other"), *slice("other", "app")},
+				}, nil
+			},
+			WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+				return fakeWatch, nil
+			},
+		},
+		keep: func(obj runtime.Object) bool {
+			s := obj.(*discoveryv1.EndpointSlice)
+			return services.contains(s.Namespace, s.Labels[discoveryv1.LabelServiceName])
+		},
+	}
+
+	list, err := lw.List(metav1.ListOptions{})
+	if asserter.NoError(err) {
+		slices := list.(*discoveryv1.EndpointSliceList)
+		asserter.Equal([]discoveryv1.EndpointSlice{*slice("team", "app")}, slices.Items)
+		asserter.Equal("next-page", slices.Continue)
+	}
+
+	w, err := lw.Watch(metav1.ListOptions{})
+	if !asserter.NoError(err) {
+		return
+	}
+	defer w.Stop()
+	fakeWatch.Add(slice("team", "other"))
+	fakeWatch.Modify(slice("team", "app"))
+	fakeWatch.Error(&metav1.Status{Message: "expired"})
+	asserter.Equal(watch.Modified, (<-w.ResultChan()).Type)
+	asserter.Equal(watch.Error, (<-w.ResultChan()).Type)
+
+	asserter.False(services.replace(map[string]bool{}), "removing services doesn't add any")
+	asserter.False(services.contains("team", "app"))
+}
@@ -0,0 +1,157 @@
+package k8s
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// RoutePolicyResource identifies the FeedRoutePolicy custom resource.
+var RoutePolicyResource = schema.GroupVersionResource{Group: "feed.sky.uk", Version: "v1alpha1", Resource: "feedroutepolicies"}
+
+// RoutePolicy holds the configuration for ingresses in its namespace which reference it by name, or which
+// are for one of its hosts.
+type RoutePolicy struct {
+	Namespace string
+	Name      string
+	Spec      RoutePolicySpec
+}
+
+// RoutePolicySpec is the configuration of a route. Unset fields are left as configured by annotations or defaults.
+type RoutePolicySpec struct {
+	// Hosts the policy applies to, for ingresses which don't reference a policy by name.
+	Hosts []string `json:"hosts,omitempty"`
+	// Allow is the list of IPs or CIDRs allowed to access the route. An empty list denies all.
+	Allow *[]string `json:"allow,omitempty"`
+	// StripPath before forwarding to the backend.
+	StripPath *bool `json:"stripPath,omitempty"`
+	// ExactPath matches the path exactly, rather than as a prefix.
+	ExactPath *bool `json:"exactPath,omitempty"`
+	// BackendTimeoutSeconds for reading from and writing to the backend.
+	BackendTimeoutSeconds *int `json:"backendTimeoutSeconds,omitempty"`
+	// BackendMaxConnections to each backend, or 0 for no limit.
+	BackendMaxConnections *int `json:"backendMaxConnections,omitempty"`
+	// BackendKeepaliveTimeout for idle backend connections, as a duration such as 30s.
+	BackendKeepaliveTimeout *string `json:"backendKeepaliveTimeout,omitempty"`
+	// BackendMaxRequestsPerConnection before a backend connection is closed.
+	BackendMaxRequestsPerConnection *uint64 `json:"backendMaxRequestsPerConnection,omitempty"`
+	// ProxyBufferSize in KiB, for the first part of the backend response.
+	ProxyBufferSize *int `json:"proxyBufferSize,omitempty"`
+	// ProxyBufferBlocks is the number of buffers for reading the backend response.
+	ProxyBufferBlocks *int `json:"proxyBufferBlocks,omitempty"`
+	// RateLimit limits the requests of each client address.
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+	// RequestHeaders are set on requests to the backend. An empty value removes the header.
+	RequestHeaders map[string]string `json:"requestHeaders,omitempty"`
+	// ResponseHeaders are set on responses, replacing any from the backend. An empty value removes the header.
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+}
+
+// RateLimit is the requests per second allowed from each client address. Requests over the limit are rejected with
+// 429 once Burst requests have been allowed above it.
+type RateLimit struct {
+	RequestsPerSecond int `json:"requestsPerSecond"`
+	Burst             int `json:"burst,omitempty"`
+}
+
+var (
+	headerName  = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	headerValue = regexp.MustCompile(`^[^"$\\\x00-\x1f\x7f]*$`)
+	// reservedRequestHeaders are set by feed for every backend, so can't be changed by a policy.
+	reservedRequestHeaders = map[string]bool{
+		"connection": true, "upgrade": true, "host": true, "proxy": true, "x-forwarded-for": true,
+		"x-forwarded-host": true, "x-forwarded-proto": true, "x-original-uri": true, "x-real-ip": true,
+	}
+)
+
+// KeepaliveTimeout parses BackendKeepaliveTimeout, which has already been validated.
+func (s *RoutePolicySpec) KeepaliveTimeout() time.Duration {
+	d, _ := time.ParseDuration(*s.BackendKeepaliveTimeout)
+	return d
+}
+
+// toRoutePolicy converts and validates an unstructured FeedRoutePolicy.
+func toRoutePolicy(obj *unstructured.Unstructured) (*RoutePolicy, error) {
+	policy := &RoutePolicy{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	spec, ok := obj.Object["spec"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("route policy %s/%s has no spec", policy.Namespace, policy.Name)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &policy.Spec); err != nil {
+		return nil, fmt.Errorf("route policy %s/%s is invalid: %v", policy.Namespace, policy.Name, err)
+	}
+	if err := policy.Spec.validate(); err != nil {
+		return nil, fmt.Errorf("route policy %s/%s is invalid: %v", policy.Namespace, policy.Name, err)
+	}
+	for i, host := range policy.Spec.Hosts {
+		policy.Spec.Hosts[i] = strings.ToLower(host)
+	}
+	return policy, nil
+}
+
+func (s *RoutePolicySpec) validate() error {
+	if s.Allow != nil {
+		for _, allow := range *s.Allow {
+			if net.ParseIP(allow) == nil {
+				if _, _, err := net.ParseCIDR(allow); err != nil {
+					return fmt.Errorf("allow %q isn't an IP or CIDR", allow)
+				}
+			}
+		}
+	}
+	for name, value := range map[string]*int{
+		"backendTimeoutSeconds": s.BackendTimeoutSeconds,
+		"backendMaxConnections": s.BackendMaxConnections,
+		"proxyBufferSize":       s.ProxyBufferSize,
+		"proxyBufferBlocks":     s.ProxyBufferBlocks,
+	} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if s.BackendKeepaliveTimeout != nil {
+		if _, err := time.ParseDuration(*s.BackendKeepaliveTimeout); err != nil {
+			return fmt.Errorf("backendKeepaliveTimeout: %v", err)
+		}
+	}
+	if s.RateLimit != nil {
+		if s.RateLimit.RequestsPerSecond <= 0 {
+			return fmt.Errorf("rateLimit.requestsPerSecond must be positive")
+		}
+		if s.RateLimit.Burst < 0 {
+			return fmt.Errorf("rateLimit.burst must not be negative")
+		}
+	}
+	for name, value := range s.RequestHeaders {
+		if reservedRequestHeaders[strings.ToLower(name)] {
+			return fmt.Errorf("request header %s is set by feed", name)
+		}
+		if err := validateHeader(name, value); err != nil {
+			return fmt.Errorf("requestHeaders: %v", err)
+		}
+	}
+	for name, value := range s.ResponseHeaders {
+		if err := validateHeader(name, value); err != nil {
+			return fmt.Errorf("responseHeaders: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateHeader fails if the header can't be written to the nginx config as is. Values can't contain quotes, or
+// variables which would be interpolated.
+func validateHeader(name, value string) error {
+	if !headerName.MatchString(name) {
+		return fmt.Errorf("%q isn't a valid header name", name)
+	}
+	if !headerValue.MatchString(value) {
+		return fmt.Errorf("header %s has a value with a quote, backslash, $ or control character", name)
+	}
+	return nil
+}
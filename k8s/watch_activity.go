@@ -0,0 +1,75 @@
+package k8s
+
+import (
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchActivity records when each watched resource was last listed, or last had a watch event, so a watch which
+// silently stops can be spotted. Informer resyncs replay the local store, so they don't count.
+type watchActivity struct {
+	sync.Mutex
+	last map[string]time.Time
+}
+
+func newWatchActivity() *watchActivity {
+	return &watchActivity{last: make(map[string]time.Time)}
+}
+
+func (a *watchActivity) record(resource string) {
+	a.Lock()
+	defer a.Unlock()
+	a.last[resource] = time.Now()
+}
+
+func (a *watchActivity) snapshot() map[string]time.Time {
+	snapshot := make(map[string]time.Time)
+	if a == nil {
+		return snapshot
+	}
+	a.Lock()
+	defer a.Unlock()
+	for resource, last := range a.last {
+		snapshot[resource] = last
+	}
+	return snapshot
+}
+
+// track wraps lw so its successful lists, watches and watch events are recorded against resource.
+func (a *watchActivity) track(resource string, lw cache.ListerWatcher) cache.ListerWatcher {
+	if a == nil {
+		return lw
+	}
+	return &trackedListWatch{ListerWatcher: lw, resource: resource, activity: a}
+}
+
+type trackedListWatch struct {
+	cache.ListerWatcher
+	resource string
+	activity *watchActivity
+}
+
+func (t *trackedListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	list, err := t.ListerWatcher.List(options)
+	if err == nil {
+		t.activity.record(t.resource)
+	}
+	return list, err
+}
+
+func (t *trackedListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := t.ListerWatcher.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	t.activity.record(t.resource)
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		t.activity.record(t.resource)
+		return event, true
+	}), nil
+}
@@ -0,0 +1,65 @@
+package k8s
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestWatchActivityRecordsListsAndWatchEvents(t *testing.T) {
+	asserter := assert.New(t)
+	activity := newWatchActivity()
+	fakeWatch := watch.NewFake()
+	lw := activity.track("services", &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &corev1.ServiceList{}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return fakeWatch, nil
+		},
+	})
+	asserter.Empty(activity.snapshot())
+
+	_, err := lw.List(metav1.ListOptions{})
+	asserter.NoError(err)
+	listed := activity.snapshot()["services"]
+	asserter.False(listed.IsZero())
+
+	w, err := lw.Watch(metav1.ListOptions{})
+	asserter.NoError(err)
+	defer w.Stop()
+	time.Sleep(time.Millisecond)
+	go fakeWatch.Add(&corev1.Service{})
+	<-w.ResultChan()
+
+	asserter.True(activity.snapshot()["services"].After(listed))
+}
+
+func TestWatchActivityIgnoresFailedLists(t *testing.T) {
+	activity := newWatchActivity()
+	lw := activity.track("services", &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return nil, errors.New("connection refused")
+		},
+	})
+
+	_, err := lw.List(metav1.ListOptions{})
+
+	assert.Error(t, err)
+	assert.Empty(t, activity.snapshot())
+}
+
+func TestNilWatchActivityLeavesListWatchAlone(t *testing.T) {
+	var activity *watchActivity
+	lw := &cache.ListWatch{}
+
+	assert.Equal(t, cache.ListerWatcher(lw), activity.track("services", lw))
+	assert.Empty(t, activity.snapshot())
+}
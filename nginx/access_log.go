@@ -0,0 +1,124 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	accessLogFile               = "access.log"
+	accessLogRotatedTimeFormat  = "20060102150405"
+	accessLogRotateMaxFrequency = time.Second * 10
+)
+
+func (c *Conf) accessLogRotationEnabled() bool {
+	return c.AccessLog && (c.AccessLogMaxSizeMB > 0 || c.AccessLogRotateInterval > 0)
+}
+
+// Sigusr1 sends a SIGUSR1 to the process, to reopen log files
+func (n *nginx) sigusr1() error {
+	master := n.master()
+	log.Debugf("Sending SIGUSR1 to %d", master)
+	return syscall.Kill(master, syscall.SIGUSR1)
+}
+
+func (n *nginxUpdater) periodicallyRotateAccessLog() {
+	checkInterval := accessLogRotateMaxFrequency
+	if n.AccessLogRotateInterval > 0 && n.AccessLogRotateInterval < checkInterval {
+		checkInterval = n.AccessLogRotateInterval
+	}
+	log.Infof("Rotating access logs every %v or %d MB, keeping %d", n.AccessLogRotateInterval,
+		n.AccessLogMaxSizeMB, n.AccessLogMaxFiles)
+
+	lastRotation := time.Now()
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.doneCh:
+			return
+		case now := <-ticker.C:
+			rotated, err := n.rotateAccessLogIfRequired(now, lastRotation)
+			if err != nil {
+				log.Warnf("Unable to rotate access log: %v", err)
+			}
+			if rotated {
+				lastRotation = now
+			}
+		}
+	}
+}
+
+// rotateAccessLogIfRequired moves the access log aside once it exceeds its maximum size or age, and signals
+// nginx to reopen it. If the access log has been moved by something else, nginx is signalled to reopen it once,
+// rather than on every check if nginx doesn't recreate it.
+func (n *nginxUpdater) rotateAccessLogIfRequired(now, lastRotation time.Time) (bool, error) {
+	file := filepath.Join(n.AccessLogDir, accessLogFile)
+	info, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		if n.accessLogReopened {
+			log.Debug("Access log is still missing after signalling nginx to reopen it")
+			return false, nil
+		}
+		log.Debug("Access log has been moved, signalling nginx to reopen it")
+		n.accessLogReopened = true
+		return false, n.nginx.sigusr1()
+	}
+	if err != nil {
+		return false, err
+	}
+	n.accessLogReopened = false
+
+	sizeExceeded := n.AccessLogMaxSizeMB > 0 && info.Size() >= int64(n.AccessLogMaxSizeMB)*1024*1024
+	intervalElapsed := n.AccessLogRotateInterval > 0 && now.Sub(lastRotation) >= n.AccessLogRotateInterval
+	if !sizeExceeded && !intervalElapsed {
+		return false, nil
+	}
+
+	if err := rotateAccessLog(n.AccessLogDir, now); err != nil {
+		return false, err
+	}
+	if err := n.nginx.sigusr1(); err != nil {
+		return true, fmt.Errorf("unable to signal nginx to reopen access log: %v", err)
+	}
+	return true, removeOldAccessLogs(n.AccessLogDir, n.AccessLogMaxFiles)
+}
+
+func rotateAccessLog(dir string, now time.Time) error {
+	file := filepath.Join(dir, accessLogFile)
+	rotated := file + "." + now.Format(accessLogRotatedTimeFormat)
+	log.Debugf("Rotating %s to %s", file, rotated)
+	return os.Rename(file, rotated)
+}
+
+// removeOldAccessLogs removes all but the newest maxFiles rotated access logs. If maxFiles is 0,
+// all rotated access logs are kept.
+func removeOldAccessLogs(dir string, maxFiles int) error {
+	if maxFiles <= 0 {
+		return nil
+	}
+
+	rotated, err := filepath.Glob(filepath.Join(dir, accessLogFile+".*"))
+	if err != nil {
+		return err
+	}
+	if len(rotated) <= maxFiles {
+		return nil
+	}
+
+	// the timestamp suffix sorts lexically in time order
+	sort.Strings(rotated)
+	for _, file := range rotated[:len(rotated)-maxFiles] {
+		log.Debugf("Removing old access log %s", file)
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package nginx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+)
+
+// apiKeysFilePrefix names the files of API keys in the working directory. Each is named by a hash of its contents,
+// so a config always includes the keys it was generated with, even once it's been replaced or rolled back to.
+const apiKeysFilePrefix = "api-keys-"
+
+// apiKeyCheck allows only requests with a known API key in a header, and limits the requests of each key. Each is
+// mapped from the header into its own variable, and rate limited in its own zone.
+type apiKeyCheck struct {
+	ID     int
+	Header string
+	// Auth allows only the Keys. Without it, any key is allowed.
+	Auth      bool
+	Keys      []apiKey
+	RateLimit int
+}
+
+// apiKey is an allowed key, and the name of its client.
+type apiKey struct {
+	Key    string
+	Client string
+}
+
+func newAPIKeyCheck(entry controller.IngressEntry) *apiKeyCheck {
+	if entry.APIKeys == nil && entry.APIKeyRateLimit == 0 {
+		return nil
+	}
+	check := &apiKeyCheck{Header: entry.APIKeyHeader, Auth: entry.APIKeys != nil, RateLimit: entry.APIKeyRateLimit}
+	for key, client := range entry.APIKeys {
+		check.Keys = append(check.Keys, apiKey{Key: key, Client: client})
+	}
+	sort.Slice(check.Keys, func(i, j int) bool { return check.Keys[i].Key < check.Keys[j].Key })
+	return check
+}
+
+// HeaderVariable is the nginx variable of the request header.
+func (c *apiKeyCheck) HeaderVariable() string {
+	return "$http_" + strings.ToLower(strings.Replace(c.Header, "-", "_", -1))
+}
+
+// ClientVariable is the name of the API key's client, or empty if the key isn't allowed.
+func (c *apiKeyCheck) ClientVariable() string {
+	return "$api_key_client_" + strconv.Itoa(c.ID)
+}
+
+// RateLimitKey is the client's name, so unknown keys aren't counted, or else the API key itself.
+func (c *apiKeyCheck) RateLimitKey() string {
+	if c.Auth {
+		return c.ClientVariable()
+	}
+	return c.HeaderVariable()
+}
+
+// Zone is the shared memory zone counting the requests of each key.
+func (c *apiKeyCheck) Zone() string {
+	return "api_key_" + strconv.Itoa(c.ID)
+}
+
+// apiKeyChecks numbers the distinct checks of locations, so each gets its own variable and zone.
+func apiKeyChecks(servers []*server) []*apiKeyCheck {
+	seen := make(map[*apiKeyCheck]bool)
+	var checks []*apiKeyCheck
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			if l.APIKey != nil && !seen[l.APIKey] {
+				seen[l.APIKey] = true
+				l.APIKey.ID = len(checks) + 1
+				checks = append(checks, l.APIKey)
+			}
+		}
+	}
+	return checks
+}
+
+// writeAPIKeys writes the maps naming the client of each key allowed by the checks to a file only feed and nginx's
+// master can read, so the keys aren't in nginx.conf, its history, or the logged diffs. It returns the file, or empty
+// if none of the checks only allow known keys. Called with configLock held.
+func (n *nginxUpdater) writeAPIKeys(checks []*apiKeyCheck) (string, error) {
+	var maps bytes.Buffer
+	for _, c := range checks {
+		if !c.Auth {
+			continue
+		}
+		fmt.Fprintf(&maps, "map \"key:%s\" %s {\n    default \"\";\n", c.HeaderVariable(), c.ClientVariable())
+		for _, k := range c.Keys {
+			fmt.Fprintf(&maps, "    \"key:%s\" \"%s\";\n", k.Key, k.Client)
+		}
+		maps.WriteString("}\n")
+	}
+	if maps.Len() == 0 {
+		return "", nil
+	}
+
+	sum := sha256.Sum256(maps.Bytes())
+	file := filepath.Join(n.ConfDir, apiKeysFilePrefix+hex.EncodeToString(sum[:8])+".conf")
+	if _, err := os.Stat(file); err == nil {
+		return file, nil
+	}
+	// written under another name first, as nginx could be reading the file
+	tmp, err := ioutil.TempFile(n.ConfDir, apiKeysFilePrefix+"*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(maps.Bytes()); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return file, os.Rename(tmp.Name(), file)
+}
+
+// removeUnusedAPIKeyFiles removes the API key files which aren't included by the current config, or by the last
+// good config it could be rolled back to. Only called by the signaller, which owns lastGoodConfig.
+func (n *nginxUpdater) removeUnusedAPIKeyFiles() {
+	n.configLock.Lock()
+	defer n.configLock.Unlock()
+	current, _ := ioutil.ReadFile(n.nginxConfFile())
+	files, err := filepath.Glob(filepath.Join(n.ConfDir, apiKeysFilePrefix+"*.conf"))
+	if err != nil {
+		log.Warnf("Unable to find unused API key files: %v", err)
+		return
+	}
+	for _, file := range files {
+		included := []byte("include " + file + ";")
+		if bytes.Contains(current, included) || bytes.Contains(n.lastGoodConfig, included) {
+			continue
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Unable to remove unused API key file: %v", err)
+		}
+	}
+}
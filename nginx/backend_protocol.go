@@ -0,0 +1,27 @@
+package nginx
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+)
+
+// checkBackendProtocols drops the options which can't be used with a location's backend protocol. Only proxy_pass
+// can rewrite the path, and the other protocols are cleartext so can't present a SPIFFE identity.
+func checkBackendProtocols(servers []*server) {
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			if l.BackendProtocol == "" || l.BackendProtocol == controller.BackendProtocolHTTP {
+				continue
+			}
+			if l.StripPath {
+				log.Warnf("Not stripping the path of %s%s, as it's proxied over %s", s.ServerName, l.Path, l.BackendProtocol)
+				l.StripPath = false
+			}
+			if l.BackendSPIFFE {
+				log.Warnf("Not presenting a SPIFFE identity to %s%s, as it's proxied over cleartext %s", s.ServerName, l.Path,
+					l.BackendProtocol)
+				l.BackendSPIFFE = false
+			}
+		}
+	}
+}
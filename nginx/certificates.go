@@ -0,0 +1,95 @@
+package nginx
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// certificate is a cert/key pair in the certificate directory, identified by the path without extension.
+type certificate struct {
+	path  string
+	names []string
+}
+
+// loadCertificates finds the cert/key pairs in dir, named <name>.crt and <name>.key, along with the
+// host names each certificate is valid for.
+func loadCertificates(dir string) ([]certificate, error) {
+	crts, err := filepath.Glob(filepath.Join(dir, "*.crt"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(crts)
+
+	var certs []certificate
+	for _, crt := range crts {
+		path := strings.TrimSuffix(crt, ".crt")
+		if _, err := os.Stat(path + ".key"); err != nil {
+			log.Warnf("Ignoring certificate %s as it has no matching key: %v", crt, err)
+			continue
+		}
+
+		names, err := certificateNames(crt)
+		if err != nil {
+			log.Warnf("Ignoring certificate %s: %v", crt, err)
+			continue
+		}
+		certs = append(certs, certificate{path: path, names: names})
+	}
+	return certs, nil
+}
+
+func certificateNames(file string) ([]string, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames, nil
+	}
+	if cert.Subject.CommonName != "" {
+		return []string{cert.Subject.CommonName}, nil
+	}
+	return nil, fmt.Errorf("certificate has no host names")
+}
+
+// selectCertificate returns the path of the certificate for host, preferring an exact match over a
+// wildcard. It returns empty if no certificate matches.
+func selectCertificate(certs []certificate, host string) string {
+	host = strings.ToLower(host)
+	wildcard := ""
+	if i := strings.Index(host, "."); i > 0 {
+		wildcard = "*" + host[i:]
+	}
+
+	match := ""
+	for _, cert := range certs {
+		for _, name := range cert.names {
+			name = strings.ToLower(name)
+			if name == host {
+				return cert.path
+			}
+			if match == "" && name == wildcard {
+				match = cert.path
+			}
+		}
+	}
+	return match
+}
@@ -0,0 +1,76 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sky-uk/feed/controller"
+)
+
+// benchmarkEntries is roughly the number of ingress entries in our largest clusters.
+const benchmarkEntries = 8000
+
+func createBenchmarkEntries() controller.IngressEntries {
+	entries := make(controller.IngressEntries, 0, benchmarkEntries)
+	for i := 0; i < benchmarkEntries; i++ {
+		entries = append(entries, controller.IngressEntry{
+			Namespace:             fmt.Sprintf("namespace-%d", i%100),
+			Name:                  fmt.Sprintf("ingress-%d", i),
+			Host:                  fmt.Sprintf("host-%d.example.com", i/4),
+			Path:                  fmt.Sprintf("/path-%d", i%4),
+			ServiceAddress:        fmt.Sprintf("10.254.%d.%d", i/256, i%256),
+			ServicePort:           8080,
+			Allow:                 []string{"10.0.0.0/8", "192.168.0.0/16"},
+			BackendTimeoutSeconds: 10,
+			CreationTimestamp:     time.Unix(int64(i), 0),
+		})
+	}
+	return entries
+}
+
+func BenchmarkCreateConfig(b *testing.B) {
+	tmpDir := setupWorkDir(b)
+	defer os.RemoveAll(tmpDir)
+	updater := New(newConf(tmpDir, fakeNginx)).(*nginxUpdater)
+	entries := createBenchmarkEntries()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := updater.createConfig(entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCreateServerEntries(b *testing.B) {
+	entries := createBenchmarkEntries()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		createServerEntries(entries)
+	}
+}
+
+func BenchmarkCreateUpstreamEntries(b *testing.B) {
+	entries := createBenchmarkEntries()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		createUpstreamEntries(entries)
+	}
+}
+
+func BenchmarkUniqueIngressEntries(b *testing.B) {
+	entries := createBenchmarkEntries()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		uniqueIngressEntries(entries)
+	}
+}
@@ -0,0 +1,38 @@
+package nginx
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+
+	"github.com/sky-uk/feed/controller"
+)
+
+type configHash [sha256.Size]byte
+
+// configHashOf hashes everything the config is generated from, other than the templates and files which are
+// watched for changes separately, so the config is only rendered when it could have changed.
+func (n *nginxUpdater) configHashOf(entries controller.IngressEntries) (configHash, error) {
+	// the order entries are received in doesn't change the config, and the caller's entries are left as they are
+	sorted := append(controller.IngressEntries(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return lessIngressEntry(&sorted[i], &sorted[j])
+	})
+
+	hash := sha256.New()
+	enc := json.NewEncoder(hash)
+	if err := enc.Encode(n.Conf); err != nil {
+		return configHash{}, err
+	}
+	for _, entry := range sorted {
+		// the ingress changes along with its status, but only the fields copied into the entry are used
+		entry.Ingress = nil
+		if err := enc.Encode(entry); err != nil {
+			return configHash{}, err
+		}
+	}
+
+	var sum configHash
+	copy(sum[:], hash.Sum(nil))
+	return sum, nil
+}
@@ -0,0 +1,79 @@
+package nginx
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	upstreamConnectFailureEvent = "upstream_connect_failure"
+	sslHandshakeErrorEvent      = "ssl_handshake_error"
+	workerCrashEvent            = "worker_crash"
+)
+
+// upstreamEjection is logged when an upstream server reaches max_fails, with the server it's proxying to,
+// e.g. upstream server temporarily disabled while reading response header from upstream, ..., upstream: "http://10.0.0.1:8080/"
+var upstreamEjection = regexp.MustCompile(`upstream server temporarily disabled.*upstream: "\w+://([^/"]+)`)
+
+// Nginx error log lines look like: 2019/01/02 15:04:05 [error] 7#7: *1 connect() failed ...
+var errorLogSeverity = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} \[(\w+)\]`)
+
+var errorLogEventMatchers = []struct {
+	event    string
+	patterns []string
+}{
+	{upstreamConnectFailureEvent, []string{"while connecting to upstream"}},
+	{sslHandshakeErrorEvent, []string{"SSL_do_handshake() failed", "while SSL handshaking"}},
+	{workerCrashEvent, []string{"exited on signal"}},
+}
+
+// newErrorLogWriter returns a writer for nginx's stderr, which logs each line and counts any notable
+// events in the error log.
+func newErrorLogWriter() io.Writer {
+	reader, writer := io.Pipe()
+	logWriter := log.StandardLogger().Writer()
+
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			line := scanner.Text()
+			_, _ = io.WriteString(logWriter, line+"\n")
+			recordErrorLogEvent(line)
+		}
+		if err := scanner.Err(); err != nil {
+			log.Warnf("Unable to parse nginx error log, no longer recording error log metrics: %v", err)
+		}
+		// keep draining so nginx never blocks on a full pipe
+		_, _ = io.Copy(logWriter, reader)
+	}()
+
+	return writer
+}
+
+func recordErrorLogEvent(line string) {
+	match := errorLogSeverity.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	severity := match[1]
+
+	if ejection := upstreamEjection.FindStringSubmatch(line); ejection != nil {
+		upstreamEjections.WithLabelValues(ejection[1]).Inc()
+	}
+
+	for _, matcher := range errorLogEventMatchers {
+		for _, pattern := range matcher.patterns {
+			if strings.Contains(line, pattern) {
+				errorLogEvents.WithLabelValues(matcher.event, severity).Inc()
+				if matcher.event == workerCrashEvent {
+					workerCrashes.Add(1)
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package nginx
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// checkInterceptErrors ignores intercepted errors if there are no error pages to replace them with, as nginx would
+// otherwise serve a 404 in their place.
+func (n *nginxUpdater) checkInterceptErrors(servers []*server) {
+	if n.ErrorPagesDir != "" {
+		return
+	}
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			if len(l.InterceptErrors) > 0 {
+				log.Warnf("Not intercepting errors from %s%s as no error pages directory is set", s.ServerName, l.Path)
+				l.InterceptErrors = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+// exemplarTag tags the syslog messages nginx sends for each traced request.
+const exemplarTag = "exemplar"
+
+var exemplarsOnce sync.Once
+var ingressTracedRequestTime *prometheus.HistogramVec
+
+// ExemplarSocket is the unix datagram socket nginx sends traced requests to, for exemplars.
+func (c Conf) ExemplarSocket() string {
+	return filepath.Join(filepath.Dir(c.PidPath), "exemplars.sock")
+}
+
+// ExemplarTraceContext are the nginx variables logged for each traced request, which the trace ID is read from.
+func (c Conf) ExemplarTraceContext() string {
+	return tracingVendors[c.TracingVendor].traceContext
+}
+
+// ExemplarTraceID is the nginx variable of the trace ID, which is only set for traced requests.
+func (c Conf) ExemplarTraceID() string {
+	return strings.Split(c.ExemplarTraceContext(), ":")[0]
+}
+
+func (n *nginxUpdater) checkTracingExemplars() error {
+	if !n.TracingExemplars {
+		return nil
+	}
+	if _, ok := tracingVendors[n.TracingVendor]; !ok {
+		return errors.New("tracing exemplars need a tracing vendor, which sets the trace ID header")
+	}
+	return nil
+}
+
+// listenForExemplars receives each traced request from nginx, and records its request time with its trace ID as an
+// exemplar, until nginx exits.
+func (n *nginxUpdater) listenForExemplars() error {
+	if !n.TracingExemplars {
+		return nil
+	}
+	exemplarsOnce.Do(func() {
+		ingressTracedRequestTime = metrics.RegisterNewDefaultHistogramVec(metrics.PrometheusIngressSubsystem,
+			"ingress_traced_request_time_seconds",
+			"The time taken by traced requests to this ingress, with the trace ID of a recent request in each bucket "+
+				"as an exemplar.", requestTimeBuckets(n.VhostStatsRequestBuckets), []string{"host", "path"})
+	})
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: n.ExemplarSocket(), Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("unable to listen for exemplars: %v", err)
+	}
+	go func() {
+		<-n.doneCh
+		conn.Close()
+	}()
+
+	// series are tracked separately to the vhost stats, as they're recorded from this goroutine
+	limiter := newIngressSeriesLimiter(n.MetricsHostLevelOnly, n.MetricsAllowedHosts, n.MetricsMaxIngressSeries)
+	sampledTraceID := tracingVendors[n.TracingVendor].sampledTraceID
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			size, err := conn.Read(buf)
+			if err != nil {
+				log.Debugf("Stopped receiving exemplars: %v", err)
+				return
+			}
+			recordExemplar(string(buf[:size]), limiter, sampledTraceID)
+		}
+	}()
+	return nil
+}
+
+// recordExemplar records a syslog message from nginx, such as
+// <190>Oct 16 10:00:00 exemplar: example.com 0.005 1f2e3d:4c5b:0:1 /path
+func recordExemplar(message string, limiter *ingressSeriesLimiter, sampledTraceID func(string) (string, bool)) {
+	i := strings.Index(message, exemplarTag+": ")
+	if i < 0 {
+		return
+	}
+	fields := strings.SplitN(strings.TrimSpace(message[i+len(exemplarTag)+2:]), " ", 4)
+	if len(fields) != 4 {
+		log.Debugf("Ignoring malformed exemplar %q", message)
+		return
+	}
+	requestTime, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		log.Debugf("Ignoring exemplar with malformed request time %q", message)
+		return
+	}
+	traceID, sampled := sampledTraceID(fields[2])
+	if !sampled || traceID == "" {
+		return
+	}
+
+	series := limiter.series(fields[0], fields[3])
+	ingressTracedRequestTime.WithLabelValues(series.host, series.path).(prometheus.ExemplarObserver).
+		ObserveWithExemplar(requestTime, prometheus.Labels{"trace_id": traceID})
+}
+
+// requestTimeBuckets are the vhost stats request buckets in seconds, or the prometheus defaults if they aren't set.
+func requestTimeBuckets(vhostStatsBuckets []string) []float64 {
+	var buckets []float64
+	for _, bucket := range vhostStatsBuckets {
+		seconds, err := strconv.ParseFloat(bucket, 64)
+		if err != nil {
+			return nil
+		}
+		buckets = append(buckets, seconds)
+	}
+	return buckets
+}
@@ -0,0 +1,42 @@
+package nginx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracingVendorsReadSampledTraceIDs(t *testing.T) {
+	var tests = []struct {
+		vendor  string
+		context string
+		traceID string
+		sampled bool
+	}{
+		{"jaeger", "5ca1ab1e:2:0:1", "5ca1ab1e", true},
+		{"jaeger", "5ca1ab1e:2:0:3", "5ca1ab1e", true},
+		{"jaeger", "5ca1ab1e:2:0:0", "5ca1ab1e", false},
+		{"jaeger", "5ca1ab1e", "", false},
+		{"zipkin", "5ca1ab1e:1", "5ca1ab1e", true},
+		{"zipkin", "5ca1ab1e:0", "5ca1ab1e", false},
+		{"zipkin", "5ca1ab1e:", "5ca1ab1e", false},
+		{"datadog", "12345:1", "12345", true},
+		{"datadog", "12345:2", "12345", true},
+		{"datadog", "12345:-1", "12345", false},
+		{"datadog", "12345:", "", false},
+	}
+
+	for _, test := range tests {
+		traceID, sampled := tracingVendors[test.vendor].sampledTraceID(test.context)
+		assert.Equal(t, test.sampled, sampled, "%s %s", test.vendor, test.context)
+		if test.sampled {
+			assert.Equal(t, test.traceID, traceID, "%s %s", test.vendor, test.context)
+		}
+	}
+}
+
+func TestRequestTimeBucketsFollowTheVhostStatsBuckets(t *testing.T) {
+	assert.Equal(t, []float64{0.005, 0.1, 10}, requestTimeBuckets([]string{"0.005", "0.1", "10"}))
+	assert.Nil(t, requestTimeBuckets(nil))
+	assert.Nil(t, requestTimeBuckets([]string{"0.005", "bad"}))
+}
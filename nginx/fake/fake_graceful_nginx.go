@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path"
 	"strings"
@@ -11,6 +12,9 @@ import (
 	"time"
 )
 
+// workerTitle is the process title of nginx workers, which feed looks for to time reloads.
+const workerTitle = "nginx: worker process"
+
 func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGQUIT, syscall.SIGHUP)
@@ -25,32 +29,73 @@ func main() {
 		os.Exit(0)
 	}
 
+	if os.Args[1] == "worker" {
+		runWorker()
+		return
+	}
+
 	startupMarkerFilename := startupMarkerFilename(os.Args[2])
 	err := ioutil.WriteFile(startupMarkerFilename, []byte("started!"), os.ModePerm)
 	if err != nil {
 		panic(err)
 	}
 
+	worker := startWorker()
+	defer stopWorker(worker)
 	timer := time.NewTimer(5 * time.Second)
 
-	select {
-	case sig := <-sigCh:
-		if sig == syscall.SIGQUIT {
-			time.Sleep(500 * time.Millisecond)
-			fmt.Println("Received sigquit, doing graceful shutdown")
-			os.Exit(0)
-		}
+	for {
+		select {
+		case sig := <-sigCh:
+			if sig == syscall.SIGQUIT {
+				time.Sleep(500 * time.Millisecond)
+				fmt.Println("Received sigquit, doing graceful shutdown")
+				stopWorker(worker)
+				os.Exit(0)
+			}
 
-		if sig == syscall.SIGHUP {
-			err := ioutil.WriteFile(startupMarkerFilename, []byte("reloaded!"), os.ModePerm)
-			if err != nil {
-				panic(err)
+			if sig == syscall.SIGHUP {
+				// like nginx, start new workers with the new config before stopping the old ones
+				old := worker
+				worker = startWorker()
+				stopWorker(old)
+				err := ioutil.WriteFile(startupMarkerFilename, []byte("reloaded!"), os.ModePerm)
+				if err != nil {
+					panic(err)
+				}
 			}
+
+		case <-timer.C:
+			fmt.Println("Quit after 5 seconds of nada")
+			stopWorker(worker)
+			os.Exit(-1)
 		}
+	}
+}
+
+// startWorker starts a child process with the title of an nginx worker.
+func startWorker() *exec.Cmd {
+	self, err := os.Executable()
+	if err != nil {
+		panic(err)
+	}
+	cmd := &exec.Cmd{Path: self, Args: []string{workerTitle, "worker"}}
+	if err := cmd.Start(); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func stopWorker(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+}
 
-	case <-timer.C:
-		fmt.Println("Quit after 5 seconds of nada")
-		os.Exit(-1)
+// runWorker waits until it's killed, or its master has gone.
+func runWorker() {
+	master := os.Getppid()
+	for os.Getppid() == master {
+		time.Sleep(100 * time.Millisecond)
 	}
 }
 
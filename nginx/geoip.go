@@ -0,0 +1,22 @@
+package nginx
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// checkCountries ignores country restrictions if there's no GeoIP database to look up clients in, as nginx can't
+// start with the country variable undefined.
+func (n *nginxUpdater) checkCountries(servers []*server) {
+	if n.GeoIPDatabase != "" {
+		return
+	}
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			if len(l.AllowCountries) > 0 || len(l.DenyCountries) > 0 {
+				log.Warnf("Ignoring country restrictions on %s%s as no GeoIP database is set", s.ServerName, l.Path)
+				l.AllowCountries = nil
+				l.DenyCountries = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package nginx
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// loadGlobalDeny returns the CIDRs denied in every location, from GlobalDeny and GlobalDenyFile. The file has a CIDR
+// or IP on each line, ignoring blank lines and # comments.
+func (n *nginxUpdater) loadGlobalDeny() ([]string, error) {
+	deny := append([]string{}, n.GlobalDeny...)
+
+	if n.GlobalDenyFile != "" {
+		file, err := os.Open(n.GlobalDenyFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(strings.SplitN(scanner.Text(), "#", 2)[0])
+			if line != "" {
+				deny = append(deny, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range deny {
+		if net.ParseIP(entry) == nil {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return nil, fmt.Errorf("invalid entry %q", entry)
+			}
+		}
+	}
+	return deny, nil
+}
@@ -0,0 +1,27 @@
+package nginx
+
+// setHTTPSRedirects redirects plain http requests to https, and adds HSTS to https responses, for locations of
+// ingresses whose frontend scheme is configured for them.
+func (n *nginxUpdater) setHTTPSRedirects(servers []*server) {
+	redirects := schemeSet(n.HTTPSRedirectSchemes)
+	hsts := schemeSet(n.HSTSSchemes)
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			l.RedirectToHTTPS = redirects[l.FrontendScheme]
+			l.HSTS = hsts[l.FrontendScheme] && n.HSTSMaxAge > 0
+		}
+	}
+}
+
+// HSTSMaxAgeSeconds is the max-age of the Strict-Transport-Security header.
+func (c Conf) HSTSMaxAgeSeconds() int {
+	return int(c.HSTSMaxAge.Seconds())
+}
+
+func schemeSet(schemes []string) map[string]bool {
+	set := make(map[string]bool, len(schemes))
+	for _, scheme := range schemes {
+		set[scheme] = true
+	}
+	return set
+}
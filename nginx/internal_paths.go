@@ -0,0 +1,71 @@
+package nginx
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// addInternalLocations adds a location restricted to internal clients for each of the internal paths of a server's
+// locations. Locations already under an internal path are restricted too, so they don't expose it.
+func addInternalLocations(serverName string, locs []*location) []*location {
+	var internal []*location
+	for _, l := range locs {
+		if len(l.InternalPaths) == 0 {
+			continue
+		}
+		if l.ExactPath || l.PathRegex {
+			log.Warnf("Ignoring internal paths of %s%s as it's not a prefix path", serverName, l.Path)
+			continue
+		}
+		for _, internalPath := range l.InternalPaths {
+			// a prefix without a trailing / so the internal path itself is covered, e.g. /admin as well as /admin/
+			path := strings.TrimSuffix(l.Path, "/") + "/" + strings.Trim(internalPath, "/")
+			if path == l.Path || path+"/" == l.Path {
+				l.Internal = true
+				continue
+			}
+			internalLocation := *l
+			internalLocation.Path = path
+			internalLocation.Internal = true
+			internalLocation.InternalPaths = nil
+			internal = append(internal, &internalLocation)
+		}
+	}
+
+	for _, i := range internal {
+		if existing := findLocation(locs, i.Path); existing != nil {
+			log.Warnf("Not adding internal path %s%s as it's already a location", serverName, i.Path)
+			existing.Internal = true
+			continue
+		}
+		locs = append(locs, i)
+	}
+
+	if len(internal) > 0 {
+		for _, l := range locs {
+			if l.Internal || l.ExactPath || l.PathRegex {
+				continue
+			}
+			for _, i := range internal {
+				if strings.HasPrefix(l.Path, i.Path+"/") {
+					log.Warnf("Restricting %s%s to internal clients as it's under the internal path %s", serverName,
+						l.Path, i.Path)
+					l.Internal = true
+					break
+				}
+			}
+		}
+	}
+
+	return locs
+}
+
+func findLocation(locs []*location, path string) *location {
+	for _, l := range locs {
+		if l.Path == path && !l.ExactPath && !l.PathRegex {
+			return l
+		}
+	}
+	return nil
+}
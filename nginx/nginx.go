@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -22,45 +25,236 @@ import (
 const (
 	nginxStartDelay                         = time.Millisecond * 100
 	metricsUpdateInterval                   = time.Second * 10
+	metricsUpdateJitter                     = 0.1
 	defaultMaxRequestsPerUpstreamConnection = uint64(1024)
+	procPath                                = "/proc"
+	drainingWorkerTitle                     = "nginx: worker process is shutting down"
+	workerTitle                             = "nginx: worker process"
+	upgradeTimeout                          = time.Second * 30
+	upgradePollInterval                     = time.Millisecond * 100
+	reloadTimeout                           = time.Second * 10
+	reloadPollInterval                      = time.Millisecond * 10
 )
 
+// Upgrader upgrades the nginx binary in place, without dropping connections.
+type Upgrader interface {
+	Upgrade() error
+}
+
 // Port configuration
 type Port struct {
 	Name string
 	Port int
+	// SSL terminates TLS on the port. Ports named https always terminate TLS.
+	SSL bool
+	// ProxyProtocol expects the PROXY protocol on the port. Always set if Conf.ProxyProtocol is.
+	ProxyProtocol bool
+	// HTTP2 accepts HTTP/2 on the port, if it terminates TLS. Always set if Conf.HTTP2 is.
+	HTTP2 bool
+	// Socket is the path of a Unix domain socket listened on instead of the port.
+	Socket string
+	// Scheme only serves ingresses with this sky.uk/frontend-scheme on the port, so a frontend per scheme only
+	// exposes its own ingresses. Blank serves every ingress.
+	Scheme string
+	// SSLTerminationPort is the local port the port's TLS connections are terminated on when ssl passthrough routes
+	// them by SNI. Each SSL port gets its own, counting up from Conf.SSLPassthroughPort.
+	SSLTerminationPort int
+}
+
+// listenPorts applies the settings for every port to each port.
+func (c *Conf) listenPorts() []Port {
+	ports := make([]Port, len(c.Ports))
+	sslPorts := 0
+	for i, port := range c.Ports {
+		port.SSL = port.SSL || port.Name == "https"
+		port.ProxyProtocol = port.ProxyProtocol || c.ProxyProtocol
+		port.HTTP2 = port.SSL && (port.HTTP2 || c.HTTP2)
+		if port.SSL && c.SSLPassthroughPort != 0 {
+			port.SSLTerminationPort = c.SSLPassthroughPort + sslPorts
+			sslPorts++
+		}
+		ports[i] = port
+	}
+	// local clients of the socket don't go through the load balancer, so it doesn't expect the PROXY protocol
+	if c.UnixSocket != "" {
+		ports = append(ports, Port{Name: "unix", Socket: c.UnixSocket})
+	}
+	return ports
 }
 
 // Conf configuration for NGINX
 type Conf struct {
 	BinaryLocation               string
 	WorkingDir                   string
+	Templates                    []string
 	WorkerProcesses              int
 	WorkerConnections            int
 	WorkerShutdownTimeoutSeconds int
+	WorkerRlimitNofile           int
+	MultiAccept                  bool
+	UseEpoll                     bool
+	ResetTimedoutConnection      bool
 	KeepaliveSeconds             int
 	BackendKeepalives            int
+	MaxBackendKeepalives         int
 	BackendConnectTimeoutSeconds int
 	ServerNamesHashBucketSize    int
 	ServerNamesHashMaxSize       int
 	HealthPort                   int
 	TrustedFrontends             []string
 	Ports                        []Port
+	IngressBindAddress           string
+	IPv6                         bool
+	SSLPassthroughPort           int
 	LogLevel                     string
 	ProxyProtocol                bool
 	AccessLog                    bool
 	AccessLogDir                 string
+	AccessLogMaxSizeMB           int
+	AccessLogRotateInterval      time.Duration
+	AccessLogMaxFiles            int
+	AccessLogBufferSizeKB        int
+	AccessLogFlushInterval       time.Duration
 	LogHeaders                   []string
 	AccessLogHeaders             string
 	UpdatePeriod                 time.Duration
 	SSLPath                      string
+	SSLCertificatesDir           string
+	SSLSessionTicketKeysDir      string
+	ACMEChallengeDir             string
+	HtpasswdDir                  string
+	SPIFFESVIDDir                string
 	VhostStatsSharedMemory       int
 	VhostStatsRequestBuckets     []string
 	OpenTracingPlugin            string
 	OpenTracingConfig            string
+	MetricsHostLevelOnly         bool
+	MetricsAllowedHosts          []string
+	MetricsMaxIngressSeries      int
+	// MetricsUpdateInterval is how often the vhost stats are polled for metrics. Zero uses the default of 10s.
+	MetricsUpdateInterval time.Duration
+	// MetricsRequestSizes exports the number of requests by size for each ingress, using a second vhost stats filter
+	// in every location.
+	MetricsRequestSizes bool
+	// AllowZeroEntries starts nginx with no ingress entries, so every request gets a 404, rather than failing.
+	AllowZeroEntries bool
+	// GlobalDeny are CIDRs denied in every location, regardless of the ingress's allow list.
+	GlobalDeny []string
+	// GlobalDenyFile has more CIDRs to deny, one per line. It's checked for changes along with the templates.
+	GlobalDenyFile string
+	// TracingVendor generates the OpenTracing config for jaeger, zipkin or datadog, instead of OpenTracingConfig.
+	TracingVendor string
+	// TracingEndpoint is the host:port of the vendor's agent or collector, or empty for the vendor's default.
+	TracingEndpoint string
+	// TracingServiceName is the service name reported in traces.
+	TracingServiceName string
+	// TracingExemplars records the time of traced requests per ingress, with their trace IDs as exemplars, so
+	// dashboards can link to traces. Needs a TracingVendor.
+	TracingExemplars bool
+	// UpstreamSlowStart ramps the weight of servers added to an upstream, such as new pods in endpoints mode, over
+	// this period. Zero gives them their full weight at once.
+	UpstreamSlowStart time.Duration
+	// GeoIPDatabase is a MaxMind country database, used to restrict clients by country. Leave blank to disable.
+	GeoIPDatabase string
+	// HTTP2 accepts HTTP/2 from clients on the https ports, which gRPC clients of h2c backends need.
+	HTTP2 bool
+	// ErrorPagesDir has the <status>.html pages which replace backend errors intercepted with the
+	// sky.uk/intercept-errors annotation. Leave blank to disable intercepting errors.
+	ErrorPagesDir string
+	// SecurityHeaders is the profile of security headers added to every response, one of SecurityHeaderProfiles.
+	// Can be overridden per ingress with the sky.uk/security-headers annotation. Leave blank to add none.
+	SecurityHeaders string
+	// HTTPSRedirectSchemes are the frontend schemes, from the sky.uk/frontend-scheme annotation, whose ingresses
+	// redirect plain http requests to https, so internal ingresses can stay on http.
+	HTTPSRedirectSchemes []string
+	// HSTSSchemes are the frontend schemes whose ingresses add a Strict-Transport-Security header to https
+	// responses, with a max-age of HSTSMaxAge. Zero HSTSMaxAge adds none.
+	HSTSSchemes []string
+	HSTSMaxAge  time.Duration
+	// TrailingSlash is how prefix paths requested without their trailing slash are handled, one of
+	// TrailingSlashModes: redirected with a status code, or served. Defaults to nginx's 301 redirect.
+	// Can be overridden per ingress with the sky.uk/trailing-slash annotation.
+	TrailingSlash string
+	// UnixSocket is the path of a Unix domain socket to serve plain http ingress traffic on, as well as the ports.
+	UnixSocket string
+	// NJSModules are JavaScript files loaded with the njs module, whose functions ingresses can handle requests with.
+	// Each is named after its file name without the .js extension.
+	NJSModules []string
+	// ReadyCanary is the namespace/name of an ingress whose backends must be reachable for the health port's /ready
+	// to succeed. Leave blank for /ready to succeed once the ingresses are first configured.
+	ReadyCanary string
+	// ValidationPort is a loopback port a second nginx serves each changed config on, so ValidationProbes can check
+	// it before it's loaded into the live nginx. 0 loads new configs after only checking them with nginx -t.
+	ValidationPort int
+	// ValidationProbes are the host/path requests made to the validation nginx. A connection error or 5xx response
+	// keeps the current config.
+	ValidationProbes []string
+	// ValidationTimeout is how long the validation nginx has to start and answer the probes. Zero uses 10s.
+	ValidationTimeout time.Duration
+	// SelfChecks are host/path requests made through the live nginx every SelfCheckInterval, on its first plain http
+	// port, to catch broken reloads which nginx -t can't. A connection error or 5xx response fails the check.
+	SelfChecks []string
+	// SelfCheckInterval is how often the SelfChecks are made. Zero uses 30s.
+	SelfCheckInterval time.Duration
+	// MaxRestarts is how many times in a row nginx is started again after it exits unexpectedly. Zero leaves it
+	// stopped, failing the health check.
+	MaxRestarts int
+	// RestartBackoff is how long to wait before the first restart, doubling for each one after it up to
+	// RestartMaxBackoff. Restarts are counted from zero again once nginx stays up for RestartMaxBackoff.
+	// Zero uses 1s and 1m.
+	RestartBackoff    time.Duration
+	RestartMaxBackoff time.Duration
+	// RollbackWindow is how long nginx is watched after a reload for workers crashing, or too many server errors.
+	// If they happen, the last good config is loaded again. Zero disables rollback.
+	RollbackWindow time.Duration
+	// RollbackServerErrorRatio is the share of responses which can be server errors in the RollbackWindow before
+	// rolling back. Zero only rolls back when workers crash.
+	RollbackServerErrorRatio float64
+	// ConfigHistory is how many previous configs are kept, as nginx.conf.1 for the most recent to nginx.conf.<N>.
+	ConfigHistory int
+	// ConfDir is where nginx.conf, and the files written for it to include, are written. Defaults to WorkingDir.
+	ConfDir string
+	// PidPath is where nginx writes its pid, with the ssl passthrough socket alongside. Defaults to nginx.pid in
+	// WorkingDir.
+	PidPath string
+	// TempDir has the temp paths nginx buffers bodies in, as client_body_temp, proxy_temp, fastcgi_temp, uwsgi_temp
+	// and scgi_temp. Leave blank for the paths compiled into nginx.
+	TempDir string
+	// ClientBodyTempPath is where nginx buffers large request bodies, instead of client_body_temp in TempDir.
+	ClientBodyTempPath string
+	// ProxyTempPath is where nginx buffers large responses from backends, instead of proxy_temp in TempDir.
+	ProxyTempPath string
 	HTTPConf
 }
 
+// TempPath is the directive and path of a directory nginx buffers bodies in.
+type TempPath struct {
+	Directive string
+	Path      string
+}
+
+// TempPaths are the temp paths set in the config, so nginx only writes to the TempDir, or the paths given, rather
+// than those compiled in.
+func (c Conf) TempPaths() []TempPath {
+	var paths []TempPath
+	for _, temp := range []struct{ name, path string }{
+		{"client_body", c.ClientBodyTempPath},
+		{"proxy", c.ProxyTempPath},
+		{"fastcgi", ""},
+		{"uwsgi", ""},
+		{"scgi", ""},
+	} {
+		path := temp.path
+		if path == "" && c.TempDir != "" {
+			path = filepath.Join(c.TempDir, temp.name+"_temp")
+		}
+		if path != "" {
+			paths = append(paths, TempPath{Directive: temp.name + "_temp_path", Path: path})
+		}
+	}
+	return paths
+}
+
 // HTTPConf configuration for http core module of nginx
 type HTTPConf struct {
 	ClientHeaderBufferSize        int
@@ -71,20 +265,134 @@ type HTTPConf struct {
 
 type nginx struct {
 	*exec.Cmd
+	sync.Mutex
+	// masterPid is the current master process. It differs from the started process after a binary upgrade.
+	masterPid int
+}
+
+func (n *nginx) master() int {
+	n.Lock()
+	defer n.Unlock()
+	if n.masterPid == 0 {
+		return n.Process.Pid
+	}
+	return n.masterPid
+}
+
+func (n *nginx) setMaster(pid int) {
+	n.Lock()
+	defer n.Unlock()
+	n.masterPid = pid
 }
 
 // Sigquit sends a SIGQUIT to the process
 func (n *nginx) sigquit() error {
-	p := n.Process
-	log.Debugf("Sending SIGQUIT to %d", p.Pid)
-	return p.Signal(syscall.SIGQUIT)
+	master := n.master()
+	log.Debugf("Sending SIGQUIT to %d", master)
+	if err := syscall.Kill(master, syscall.SIGQUIT); err != nil {
+		return err
+	}
+	if started := n.process(); master != started.Pid {
+		// the started process is left running without workers after an upgrade
+		log.Debugf("Sending SIGQUIT to %d", started.Pid)
+		return started.Signal(syscall.SIGQUIT)
+	}
+	return nil
 }
 
 // Sighup sends a SIGHUP to the process
 func (n *nginx) sighup() error {
-	p := n.Process
-	log.Debugf("Sending SIGHUP to %d", p.Pid)
-	return p.Signal(syscall.SIGHUP)
+	master := n.master()
+	log.Debugf("Sending SIGHUP to %d", master)
+	return syscall.Kill(master, syscall.SIGHUP)
+}
+
+// drainingWorkers counts the child processes of nginx which are shutting down. Old workers are left
+// in this state after a reload until their connections have finished.
+func (n *nginx) drainingWorkers() (int, error) {
+	_, draining, err := n.workers()
+	return draining, err
+}
+
+// workers returns the pids of the worker processes of nginx which are serving requests, and counts those which are
+// shutting down.
+func (n *nginx) workers() ([]int, int, error) {
+	masterPid := n.master()
+	procs, err := ioutil.ReadDir(procPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var serving []int
+	draining := 0
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || pid == masterPid {
+			continue
+		}
+
+		stat, err := ioutil.ReadFile(filepath.Join(procPath, proc.Name(), "stat"))
+		if err != nil {
+			// process has probably exited since listing
+			continue
+		}
+		if parentPid(stat) != masterPid {
+			continue
+		}
+
+		cmdline, err := ioutil.ReadFile(filepath.Join(procPath, proc.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		title := strings.Replace(string(cmdline), "\x00", " ", -1)
+		if strings.HasPrefix(title, drainingWorkerTitle) {
+			draining++
+		} else if strings.HasPrefix(title, workerTitle) {
+			serving = append(serving, pid)
+		}
+	}
+
+	return serving, draining, nil
+}
+
+// waitForNewWorkers waits until none of the old workers are serving requests, and at least one new one is, which is
+// when nginx has finished reloading. It returns false if that doesn't happen within the timeout.
+func (n *nginx) waitForNewWorkers(old []int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		serving, _, err := n.workers()
+		if err == nil && len(serving) > 0 && !containsAny(serving, old) {
+			return true
+		}
+		time.Sleep(reloadPollInterval)
+	}
+	return false
+}
+
+func containsAny(pids, of []int) bool {
+	for _, pid := range pids {
+		for _, o := range of {
+			if pid == o {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parentPid extracts the ppid from the contents of /proc/<pid>/stat, which is the second field
+// after the parenthesised command name.
+func parentPid(stat []byte) int {
+	s := string(stat)
+	fields := strings.Fields(s[strings.LastIndex(s, ")")+1:])
+	if len(fields) < 2 {
+		return -1
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return -1
+	}
+	return ppid
 }
 
 func (n *nginxUpdater) signalRequired() {
@@ -93,13 +401,38 @@ func (n *nginxUpdater) signalRequired() {
 
 func (n *nginxUpdater) signalIfRequired() {
 	if n.updateRequired.Get() {
+		var reloaded []byte
+		var before reloadSignals
+		if n.rollbackEnabled() {
+			n.configLock.Lock()
+			reloaded, _ = ioutil.ReadFile(n.nginxConfFile())
+			n.configLock.Unlock()
+			before = n.currentReloadSignals()
+		}
+
+		// without visible workers, such as when nginx isn't running as a child, the reload can't be timed
+		oldWorkers, _, _ := n.nginx.workers()
+		start := time.Now()
 		err := n.nginx.sighup()
 		if err != nil {
+			incrementReloadFailureMetric()
 			log.Fatalf("Failed to signal Nginx to reload configuration: %v", err)
 		}
 		log.Info("Signalling Nginx to reload configuration")
+		if len(oldWorkers) > 0 {
+			if n.nginx.waitForNewWorkers(oldWorkers, reloadTimeout) {
+				reloadDuration.Observe(time.Since(start).Seconds())
+			} else {
+				log.Warnf("Nginx workers weren't replaced within %v of signalling it to reload", reloadTimeout)
+			}
+		}
 		incrementReloadMetric()
 		n.updateRequired.Set(false)
+
+		if reloaded != nil {
+			n.watchReload(reloaded, before)
+		}
+		n.removeUnusedAPIKeyFiles()
 	}
 }
 
@@ -112,8 +445,44 @@ type nginxUpdater struct {
 	nginxStarted           nginxStarted
 	initialUpdateAttempted util.SafeBool
 	doneCh                 chan struct{}
+	stopCh                 chan struct{}
 	nginx                  *nginx
 	updateRequired         util.SafeBool
+	metricsLimiter         *ingressSeriesLimiter
+	statusCache            statusCache
+	upgradeLock            sync.Mutex
+	// guards generating config from lastEntries, as it's also done outside of Update
+	configLock  sync.Mutex
+	lastEntries controller.IngressEntries
+	// the hash of the last entries and conf the config was generated from, or zero if it needs to be generated
+	lastConfigHash configHash
+	// set when nginx.conf was written without being validated by nginx
+	configUnchecked util.SafeBool
+	// the error from the last render of the templates, if any
+	templateErr util.SafeError
+	// set once the config is generated from the ingresses, rather than before the first update, guarded by configLock
+	configured bool
+	// the template and data of the last config rendered, for rendering it for validation, guarded by configLock
+	lastTemplate     *template.Template
+	lastTemplateData loadBalancerTemplate
+	// the config nginx was last running without failing, for rolling back to, only used by the signaller once started
+	lastGoodConfig []byte
+	// the config which was rolled back after a failed reload, so it isn't loaded again, guarded by configLock
+	rejectedConfig []byte
+	// when the servers of each upstream were added, for slow starting them, guarded by configLock
+	serverAdditions map[string]serverAdditions
+	// set once nginx is signalled to reopen a missing access log, until it exists again, only used by the rotator
+	accessLogReopened bool
+	// how long the templates took to render for the last config generated, guarded by configLock
+	lastRender time.Duration
+	// guards starting nginx again after it exits, so Stop can't miss a restarted nginx
+	restartLock sync.Mutex
+	// set by Stop, so nginx exiting isn't restarted, guarded by restartLock
+	stopping bool
+	// why nginx isn't running while it's waiting to be restarted, or once it's given up on
+	restartHealth util.SafeError
+	// how long each phase of the last update took, only used by Update
+	updatePhases []controller.UpdatePhase
 }
 
 type nginxStarted struct {
@@ -124,23 +493,65 @@ type nginxStarted struct {
 // Used for generating nginx config
 type loadBalancerTemplate struct {
 	Conf
-	Servers   []*server
-	Upstreams []*upstream
+	Servers      []*server
+	Upstreams    []*upstream
+	Passthroughs []*passthrough
+	// SessionTicketKeys are files shared across replicas, or empty to disable session tickets.
+	SessionTicketKeys []string
+	// Deny are the CIDRs denied in every location, from GlobalDeny and GlobalDenyFile.
+	Deny []string
+	// TracingSamples are the sample rates used by locations, if OpenTracing is enabled.
+	TracingSamples []tracingSample
+	// APIKeyChecks are the API key checks used by locations.
+	APIKeyChecks []*apiKeyCheck
+	// APIKeysFile names the client of each key allowed by the APIKeyChecks, or is empty if none only allow known keys.
+	APIKeysFile string
+	// RateLimits are the client rate limits used by locations.
+	RateLimits []*rateLimit
+	// Ready is set once the ingresses are configured, for the health port's /ready.
+	Ready bool
+	// Canary is the ReadyCanary ingress path which /ready proxies to, or nil if it doesn't exist.
+	Canary *readyCanary
+	// Validation is set when rendering the config for the validation nginx, which has no health port.
+	Validation bool
+}
+
+type passthrough struct {
+	ServerName string
+	UpstreamID string
+	Server     string
+	// FrontendScheme is the ingress's sky.uk/frontend-scheme, which decides the ports the host is passed through on.
+	FrontendScheme string
 }
 
 type server struct {
 	Name       string
 	Names      []string
 	ServerName string
+	SSLPath    string
 	Locations  []*location
+	// TrailingSlashRedirects replace nginx's 301 redirects of locations without their trailing slash.
+	TrailingSlashRedirects []trailingSlashRedirect
 }
 
 type upstream struct {
 	ID                string
-	Server            string
+	Servers           []*upstreamServer
 	MaxConnections    int
 	KeepaliveTimeout  string
 	KeepaliveRequests uint64
+	Keepalives        int
+	MaxFails          int
+	FailTimeout       string
+	Backup            string
+}
+
+// upstreamServer is a server of an upstream, with its weight, or 0 for nginx's default. Weights are scaled while the
+// upstream has servers slow starting. Backup servers are only used when the rest are unavailable.
+type upstreamServer struct {
+	Address string
+	Weight  int
+	Backup  bool
 }
 
 type location struct {
@@ -152,10 +563,111 @@ type location struct {
 	BackendTimeoutSeconds int
 	ProxyBufferSize       int
 	ProxyBufferBlocks     int
+	BackendSPIFFE         bool
+	BackendSPIFFEName     string
+	AllowCountries        []string
+	DenyCountries         []string
+	DisableTracing        bool
+	TracingSample         tracingSample
+	BackendProtocol       string
+	InterceptErrors       []int
+	SecurityProfile       string
+	SecurityHeaders       []securityHeader
+	InternalPaths         []string
+	Internal              bool
+	TrailingSlash         string
+	PrefixPath            bool
+	PathRegex             bool
+	// WebSocket proxies WebSocket upgrade requests, keeping the connection open for up to WebSocketTimeout
+	// seconds between messages if it's set.
+	WebSocket        bool
+	WebSocketTimeout int
+	// NJSContent and NJSHeaderFilter are njs functions which handle requests instead of the backend, and change
+	// the response headers.
+	NJSContent      string
+	NJSHeaderFilter string
+	// APIKey checks the request's API key, if set.
+	APIKey *apiKeyCheck
+	// StatsName replaces the path in the location's vhost stats and metrics, if set.
+	StatsName string
+	// Htpasswd is the file in the htpasswd directory required for HTTP basic auth, if set.
+	Htpasswd string
+	// RateLimit limits the requests of each client address, if set.
+	RateLimit *rateLimit
+	// RequestHeaders are set on proxied requests, and ResponseHeaders replace the backend's.
+	RequestHeaders  map[string]string
+	ResponseHeaders map[string]string
+	// FrontendScheme is the ingress's sky.uk/frontend-scheme, which decides if plain http requests are redirected
+	// to https, and if https responses have HSTS.
+	FrontendScheme  string
+	RedirectToHTTPS bool
+	HSTS            bool
+	// Drain returns 503 for every request, while the location's upstream stays configured.
+	Drain bool
+}
+
+// Module is the nginx module proxying to the location's backend, which prefixes the module's directives.
+func (l *location) Module() string {
+	switch l.BackendProtocol {
+	case controller.BackendProtocolH2C:
+		return "grpc"
+	case controller.BackendProtocolFastCGI:
+		return "fastcgi"
+	case controller.BackendProtocolUWSGI:
+		return "uwsgi"
+	}
+	return "proxy"
+}
+
+// StatsKey is the name of the location in its vhost stats filter key, and the path label of its metrics.
+func (l *location) StatsKey() string {
+	if l.StatsName != "" {
+		return l.StatsName
+	}
+	return l.Path
+}
+
+// ProxyTimeoutSeconds is the read and send timeout of the location's proxied connections.
+func (l *location) ProxyTimeoutSeconds() int {
+	if l.WebSocket && l.WebSocketTimeout > 0 {
+		return l.WebSocketTimeout
+	}
+	return l.BackendTimeoutSeconds
 }
 
 func (c *Conf) nginxConfFile() string {
-	return c.WorkingDir + "/nginx.conf"
+	return c.ConfDir + "/nginx.conf"
+}
+
+// BindAddressPrefix is the address prefix for ingress listen directives, or empty to listen on all addresses.
+func (c Conf) BindAddressPrefix() string {
+	if c.IngressBindAddress == "" {
+		return ""
+	}
+	if strings.Contains(c.IngressBindAddress, ":") {
+		return "[" + c.IngressBindAddress + "]:"
+	}
+	return c.IngressBindAddress + ":"
+}
+
+// AccessLogFlush is the access log flush interval in nginx's time format, or empty if not set.
+func (c Conf) AccessLogFlush() string {
+	if c.AccessLogFlushInterval <= 0 {
+		return ""
+	}
+	if c.AccessLogFlushInterval%time.Minute == 0 {
+		return fmt.Sprintf("%dm", int(c.AccessLogFlushInterval/time.Minute))
+	}
+	return fmt.Sprintf("%ds", int(c.AccessLogFlushInterval.Seconds()))
+}
+
+// SSLPassthroughSocket is the socket of the stream server which passes connections through to their backends.
+func (c Conf) SSLPassthroughSocket() string {
+	return filepath.Join(filepath.Dir(c.PidPath), "ssl_passthrough.sock")
+}
+
+func (c *Conf) nginxPidFile() string {
+	return c.PidPath
 }
 
 // New creates an nginx updater.
@@ -163,19 +675,28 @@ func New(nginxConf Conf) controller.Updater {
 	initMetrics()
 
 	nginxConf.WorkingDir = strings.TrimSuffix(nginxConf.WorkingDir, "/")
+	nginxConf.ConfDir = strings.TrimSuffix(nginxConf.ConfDir, "/")
+	if nginxConf.ConfDir == "" {
+		nginxConf.ConfDir = nginxConf.WorkingDir
+	}
+	if nginxConf.PidPath == "" {
+		nginxConf.PidPath = nginxConf.WorkingDir + "/nginx.pid"
+	}
+	if len(nginxConf.Templates) == 0 {
+		nginxConf.Templates = []string{nginxConf.WorkingDir + "/nginx.tmpl"}
+	}
 	if nginxConf.LogLevel == "" {
 		nginxConf.LogLevel = "warn"
 	}
-
-	cmd := exec.Command(nginxConf.BinaryLocation, "-c", nginxConf.nginxConfFile())
-	cmd.Stdout = log.StandardLogger().Writer()
-	cmd.Stderr = log.StandardLogger().Writer()
-	cmd.Stdin = os.Stdin
+	nginxConf.Ports = nginxConf.listenPorts()
 
 	updater := &nginxUpdater{
 		Conf:   nginxConf,
 		doneCh: make(chan struct{}),
-		nginx:  &nginx{Cmd: cmd},
+		stopCh: make(chan struct{}),
+		nginx:  &nginx{Cmd: newNginxCmd(nginxConf)},
+		metricsLimiter: newIngressSeriesLimiter(nginxConf.MetricsHostLevelOnly, nginxConf.MetricsAllowedHosts,
+			nginxConf.MetricsMaxIngressSeries),
 	}
 
 	return updater
@@ -186,6 +707,42 @@ func (n *nginxUpdater) Start() error {
 		return err
 	}
 
+	if err := n.configureTracingVendor(); err != nil {
+		return err
+	}
+
+	if err := n.checkSecurityHeaders(); err != nil {
+		return err
+	}
+
+	if err := n.checkTrailingSlash(); err != nil {
+		return err
+	}
+
+	if err := n.checkNJSModules(); err != nil {
+		return err
+	}
+
+	if err := n.checkValidationProbes(); err != nil {
+		return err
+	}
+
+	if err := n.checkSelfChecks(); err != nil {
+		return err
+	}
+
+	if err := n.checkTracingExemplars(); err != nil {
+		return err
+	}
+
+	if err := n.removeStaleUnixSocket(); err != nil {
+		return err
+	}
+
+	if err := n.listenForExemplars(); err != nil {
+		return err
+	}
+
 	if err := n.initialiseNginxConf(); err != nil {
 		return fmt.Errorf("unable to initialise nginx config: %v", err)
 	}
@@ -200,6 +757,20 @@ func (n *nginxUpdater) logNginxVersion() error {
 	return cmd.Run()
 }
 
+// removeStaleUnixSocket removes the sockets left behind if nginx didn't exit cleanly, as nginx can't listen on them
+// while they exist.
+func (n *nginxUpdater) removeStaleUnixSocket() error {
+	for _, socket := range []string{n.UnixSocket, n.SSLPassthroughSocket(), n.ExemplarSocket()} {
+		if socket == "" {
+			continue
+		}
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove unix socket %s: %v", socket, err)
+		}
+	}
+	return nil
+}
+
 func (n *nginxUpdater) initialiseNginxConf() error {
 	err := os.Remove(n.nginxConfFile())
 	if err != nil {
@@ -223,6 +794,9 @@ func (n *nginxUpdater) ensureNginxRunning() error {
 
 		n.running.Set(true)
 		go n.waitForNginxToFinish()
+		if n.rollbackEnabled() {
+			n.lastGoodConfig, _ = ioutil.ReadFile(n.nginxConfFile())
+		}
 
 		time.Sleep(nginxStartDelay)
 		if !n.running.Get() {
@@ -231,6 +805,19 @@ func (n *nginxUpdater) ensureNginxRunning() error {
 
 		go n.periodicallyUpdateMetrics()
 		go n.backgroundSignaller()
+		if n.accessLogRotationEnabled() {
+			go n.periodicallyRotateAccessLog()
+		}
+		if n.tlsFilesWatched() {
+			go n.periodicallyCheckTLSFiles()
+		}
+		go n.periodicallyCheckTemplates()
+		if n.UpstreamSlowStart > 0 {
+			go n.periodicallyRampUpstreams()
+		}
+		if len(n.SelfChecks) > 0 {
+			go n.periodicallySelfCheck()
+		}
 
 		n.nginxStarted.done = true
 	}
@@ -239,31 +826,55 @@ func (n *nginxUpdater) ensureNginxRunning() error {
 }
 
 func (n *nginxUpdater) waitForNginxToFinish() {
-	err := n.nginx.Wait()
-	if err != nil {
-		log.Error("Nginx has exited with an error: ", err)
-	} else {
-		log.Info("Nginx has shutdown successfully")
+	restarts := 0
+	for {
+		started := time.Now()
+		err := n.nginx.Wait()
+		if err != nil {
+			log.Error("Nginx has exited with an error: ", err)
+		} else {
+			log.Info("Nginx has shutdown successfully")
+		}
+		n.running.Set(false)
+		n.lastErr.Set(err)
+		if !n.restartNginx(&restarts, time.Since(started)) {
+			break
+		}
 	}
-	n.running.Set(false)
-	n.lastErr.Set(err)
 	close(n.doneCh)
 }
 
 func (n *nginxUpdater) periodicallyUpdateMetrics() {
+	interval := n.MetricsUpdateInterval
+	if interval <= 0 {
+		interval = metricsUpdateInterval
+	}
+	log.Debugf("Updating nginx metrics every %v", interval)
+
 	n.updateMetrics()
-	ticker := time.NewTicker(metricsUpdateInterval)
-	defer ticker.Stop()
+	timer := time.NewTimer(jitter(interval))
+	defer timer.Stop()
 	for {
 		select {
 		case <-n.doneCh:
 			return
-		case <-ticker.C:
+		case <-timer.C:
 			n.updateMetrics()
+			timer.Reset(jitter(interval))
 		}
 	}
 }
 
+// jitter varies the interval by up to metricsUpdateJitter either way, so replicas started together don't poll
+// in lock step.
+func jitter(interval time.Duration) time.Duration {
+	maxJitter := int64(float64(interval) * metricsUpdateJitter)
+	if maxJitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(2*maxJitter+1)-maxJitter)
+}
+
 func (n *nginxUpdater) backgroundSignaller() {
 	log.Debugf("Nginx reload will check for updates every %v", n.UpdatePeriod)
 	throttle := time.NewTicker(n.UpdatePeriod)
@@ -280,16 +891,87 @@ func (n *nginxUpdater) backgroundSignaller() {
 }
 
 func (n *nginxUpdater) updateMetrics() {
-	if err := parseAndSetNginxMetrics(n.HealthPort); err != nil {
+	if err := parseAndSetNginxMetrics(n.HealthPort, n.metricsLimiter, &n.statusCache); err != nil {
 		log.Warnf("Unable to update nginx metrics: %v", err)
 		n.metricsUnhealthy.Set(true)
 	} else {
 		n.metricsUnhealthy.Set(false)
 	}
+
+	if count, err := n.nginx.drainingWorkers(); err != nil {
+		log.Debugf("Unable to count draining nginx workers: %v", err)
+	} else {
+		drainingWorkers.Set(float64(count))
+	}
+}
+
+// Upgrade performs an in-place upgrade of nginx to the binary currently on disk. A new master process
+// is started with SIGUSR2, then the old master's workers are gracefully shut down with SIGWINCH.
+// No connections are dropped, and frontends are left untouched.
+func (n *nginxUpdater) Upgrade() error {
+	n.upgradeLock.Lock()
+	defer n.upgradeLock.Unlock()
+
+	if !n.running.Get() {
+		return errors.New("unable to upgrade nginx as it isn't running")
+	}
+
+	oldMaster := n.nginx.master()
+	log.Infof("Upgrading nginx binary, signalling master process %d", oldMaster)
+	if err := syscall.Kill(oldMaster, syscall.SIGUSR2); err != nil {
+		return fmt.Errorf("unable to signal nginx to start a new master process: %v", err)
+	}
+
+	newMaster, err := n.waitForNewMaster(oldMaster)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("New nginx master process %d started, shutting down workers of %d", newMaster, oldMaster)
+	if err := syscall.Kill(oldMaster, syscall.SIGWINCH); err != nil {
+		return fmt.Errorf("unable to shut down workers of old nginx master process: %v", err)
+	}
+	if oldMaster != n.nginx.process().Pid {
+		// Only the started process is watched, so any other old master can be shut down entirely.
+		if err := syscall.Kill(oldMaster, syscall.SIGQUIT); err != nil {
+			log.Warnf("Unable to shut down old nginx master process %d: %v", oldMaster, err)
+		}
+	}
+	n.nginx.setMaster(newMaster)
+	binaryUpgrades.Inc()
+
+	return nil
+}
+
+func (n *nginxUpdater) waitForNewMaster(oldMaster int) (int, error) {
+	deadline := time.Now().Add(upgradeTimeout)
+	for time.Now().Before(deadline) {
+		if pid, err := readPidFile(n.nginxPidFile()); err == nil && pid != oldMaster {
+			return pid, nil
+		}
+		time.Sleep(upgradePollInterval)
+	}
+	return 0, fmt.Errorf("new nginx master process didn't start within %v", upgradeTimeout)
+}
+
+func readPidFile(file string) (int, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(contents)))
 }
 
 func (n *nginxUpdater) Stop() error {
-	if n.running.Get() {
+	n.restartLock.Lock()
+	if !n.stopping {
+		n.stopping = true
+		close(n.stopCh)
+	}
+	running := n.running.Get()
+	n.restartLock.Unlock()
+
+	if running {
 		log.Info("Shutting down nginx process")
 		if err := n.nginx.sigquit(); err != nil {
 			return fmt.Errorf("error shutting down nginx: %v", err)
@@ -305,18 +987,43 @@ func (n *nginxUpdater) Stop() error {
 func (n *nginxUpdater) Update(entries controller.IngressEntries) error {
 
 	// We don't expect 0 entries so this will protect us against http 404s
-	if len(entries) == 0 {
+	if len(entries) == 0 && !n.AllowZeroEntries {
 		return errors.New("nginx update has been called with 0 entries")
 	}
 
-	// Create new config
-	hasChanged, err := n.updateNginxConf(entries)
+	// Create new config, unless nothing it's generated from has changed
+	n.updatePhases = nil
+	start := time.Now()
+	n.configLock.Lock()
+	n.configured = true
+	n.lastRender = 0
+	hasChanged, err := n.updateNginxConfIfChanged(entries)
+	render := n.lastRender
+	n.configLock.Unlock()
+	if render > 0 {
+		n.addUpdatePhase("render", start, start.Add(render))
+		start = start.Add(render)
+	}
+	n.addUpdatePhase("write", start, time.Now())
 	if err != nil {
 		return fmt.Errorf("unable to update nginx config: %v", err)
 	}
 
+	// Nginx is never started with a config it hasn't validated
+	if n.configUnchecked.Get() {
+		start := time.Now()
+		err := n.checkNginxConfig()
+		n.addUpdatePhase("check", start, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
 	// This will start Nginx if it's the first call to Update
-	if nginxStartErr := n.ensureNginxRunning(); nginxStartErr != nil {
+	start = time.Now()
+	nginxStartErr := n.ensureNginxRunning()
+	n.addUpdatePhase("start", start, time.Now())
+	if nginxStartErr != nil {
 		return nginxStartErr
 	}
 
@@ -330,6 +1037,53 @@ func (n *nginxUpdater) Update(entries controller.IngressEntries) error {
 	return nil
 }
 
+// addUpdatePhase records a phase of the update which took a significant time.
+func (n *nginxUpdater) addUpdatePhase(name string, start, end time.Time) {
+	if took := end.Sub(start); took >= time.Millisecond {
+		n.updatePhases = append(n.updatePhases, controller.UpdatePhase{Name: name, Duration: took})
+	}
+}
+
+// UpdatePhases returns how long rendering, writing (validating, diffing, writing and checking), checking and starting
+// took in the last update. Reloads happen after the update, and are timed by the reload duration metric.
+func (n *nginxUpdater) UpdatePhases() []controller.UpdatePhase {
+	return n.updatePhases
+}
+
+// updateNginxConfIfChanged skips rendering the templates when the entries and conf are the same as last time, as
+// rendering the config for a large cluster is expensive and most resyncs change nothing.
+func (n *nginxUpdater) updateNginxConfIfChanged(entries controller.IngressEntries) (bool, error) {
+	hash, err := n.configHashOf(entries)
+	if err != nil {
+		log.Warnf("Unable to hash ingress entries, generating nginx config anyway: %v", err)
+	} else if hash == n.lastConfigHash {
+		log.Debug("Ingress entries are unchanged, skipping nginx config generation")
+		n.lastEntries = entries
+		return false, nil
+	}
+
+	hasChanged, err := n.updateNginxConf(entries)
+	if err != nil {
+		// nginx.conf may no longer match the last entries
+		n.lastConfigHash = configHash{}
+		return false, err
+	}
+	n.lastEntries = entries
+	n.lastConfigHash = hash
+	return hasChanged, nil
+}
+
+// refreshNginxConf regenerates the config from the last entries, for changes which aren't caused by an update.
+func (n *nginxUpdater) refreshNginxConf() (bool, error) {
+	n.configLock.Lock()
+	defer n.configLock.Unlock()
+	hasChanged, err := n.updateNginxConf(n.lastEntries)
+	if err != nil {
+		n.lastConfigHash = configHash{}
+	}
+	return hasChanged, err
+}
+
 func (n *nginxUpdater) updateNginxConf(entries controller.IngressEntries) (bool, error) {
 	updatedConfig, err := n.createConfig(entries)
 	if err != nil {
@@ -340,9 +1094,18 @@ func (n *nginxUpdater) updateNginxConf(entries controller.IngressEntries) (bool,
 	if err != nil {
 		log.Debugf("Error trying to read nginx.conf: %v", err)
 		log.Info("Creating nginx.conf for the first time")
+		n.configUnchecked.Set(true)
 		return writeFile(n.nginxConfFile(), updatedConfig)
 	}
 
+	// There's only a current config to keep once nginx is running
+	if n.ValidationPort > 0 && n.running.Get() && !bytes.Equal(existingConfig, updatedConfig) &&
+		!n.rejected(updatedConfig) {
+		if err := n.validateConfig(n.lastTemplate, n.lastTemplateData); err != nil {
+			return false, err
+		}
+	}
+
 	return n.diffAndUpdate(existingConfig, updatedConfig)
 }
 
@@ -358,7 +1121,14 @@ func (n *nginxUpdater) diffAndUpdate(existing, updated []byte) (bool, error) {
 		return false, nil
 	}
 
+	if n.rejected(updated) {
+		log.Warn("Not loading the nginx config which was rolled back after a failed reload")
+		return false, nil
+	}
+	n.keepConfigHistory(existing)
+
 	log.Infof("Updating nginx config: %s", string(diffOutput))
+	n.configUnchecked.Set(true)
 	_, err = writeFile(n.nginxConfFile(), updated)
 
 	if err != nil {
@@ -379,36 +1149,107 @@ func (n *nginxUpdater) checkNginxConfig() error {
 	var out bytes.Buffer
 	cmd.Stderr = &out
 	cmd.Stdout = &out
+	start := time.Now()
 	err := cmd.Run()
+	configCheckDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
+		configCheckFailures.Inc()
 		return fmt.Errorf("invalid config: %v: %s", err, out.String())
 	}
+	n.configUnchecked.Set(false)
 	return nil
 }
 
 func (n *nginxUpdater) createConfig(entries controller.IngressEntries) ([]byte, error) {
-	tmpl, err := template.New("nginx.tmpl").ParseFiles(n.WorkingDir + "/nginx.tmpl")
+	start := time.Now()
+	defer func() {
+		n.lastRender = time.Since(start)
+		configRenderDuration.Observe(n.lastRender.Seconds())
+	}()
+
+	tmpl, err := template.New(filepath.Base(n.Templates[0])).Funcs(templateFuncs).ParseFiles(n.Templates...)
 	if err != nil {
-		return nil, err
+		n.setTemplateErr(err)
+		return nil, fmt.Errorf("unable to parse nginx templates: %v", err)
+	}
+
+	httpEntries, passthroughEntries := partitionSSLPassthrough(entries)
+	serverEntries := createServerEntries(httpEntries)
+	if err := n.assignCertificates(serverEntries); err != nil {
+		return nil, fmt.Errorf("unable to load certificates: %v", err)
+	}
+	n.checkBackendSPIFFE(serverEntries)
+	n.checkCountries(serverEntries)
+	n.checkNJSHandlers(serverEntries)
+	checkBackendProtocols(serverEntries)
+	checkPathRegexes(serverEntries)
+	n.checkInterceptErrors(serverEntries)
+	n.setSecurityHeaders(serverEntries)
+	n.setHTTPSRedirects(serverEntries)
+	n.handleTrailingSlashes(serverEntries)
+	upstreamEntries := createUpstreamEntries(httpEntries)
+	n.applySlowStart(upstreamEntries, time.Now())
+	n.setKeepalives(upstreamEntries)
+	passthroughs := createPassthroughEntries(passthroughEntries)
+	if len(passthroughs) > 0 && !n.hasHTTPSPort() {
+		log.Warnf("Ignoring %d ssl passthrough hosts as there is no https port", len(passthroughs))
+		passthroughs = nil
+	}
+
+	var sessionTicketKeys []string
+	if n.SSLSessionTicketKeysDir != "" {
+		if sessionTicketKeys, err = loadSessionTicketKeys(n.SSLSessionTicketKeysDir); err != nil {
+			return nil, fmt.Errorf("unable to load session ticket keys: %v", err)
+		}
 	}
 
-	serverEntries := createServerEntries(entries)
-	upstreamEntries := createUpstreamEntries(entries)
+	deny, err := n.loadGlobalDeny()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load global deny list: %v", err)
+	}
+
+	checks := apiKeyChecks(serverEntries)
+	apiKeysFile, err := n.writeAPIKeys(checks)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write API keys: %v", err)
+	}
 
-	n.AccessLogHeaders = n.getNginxLogHeaders()
-	var output bytes.Buffer
+	// the conf is hashed before rendering, so it's left unchanged
+	conf := n.Conf
+	conf.AccessLogHeaders = n.getNginxLogHeaders()
+	output := configBuffers.Get().(*bytes.Buffer)
+	defer configBuffers.Put(output)
+	output.Reset()
 	lbTemplate := loadBalancerTemplate{
-		Conf:      n.Conf,
-		Servers:   serverEntries,
-		Upstreams: upstreamEntries,
+		Conf:              conf,
+		Servers:           serverEntries,
+		Upstreams:         upstreamEntries,
+		Passthroughs:      passthroughs,
+		SessionTicketKeys: sessionTicketKeys,
+		Deny:              deny,
+		TracingSamples:    tracingSamples(serverEntries),
+		APIKeyChecks:      checks,
+		APIKeysFile:       apiKeysFile,
+		RateLimits:        rateLimits(serverEntries),
+		Ready:             n.configured,
+		Canary:            n.findReadyCanary(httpEntries),
 	}
-	err = tmpl.Execute(&output, lbTemplate)
+	err = tmpl.Execute(output, lbTemplate)
+	n.setTemplateErr(err)
 
 	if err != nil {
 		return []byte{}, fmt.Errorf("unable to create nginx config from template: %v", err)
 	}
+	n.lastTemplate, n.lastTemplateData = tmpl, lbTemplate
+
+	// the buffer is reused, so its contents are copied out
+	return append([]byte(nil), output.Bytes()...), nil
+}
 
-	return output.Bytes(), nil
+// configBuffers are reused between updates, so the config is rendered without growing a new buffer each time,
+// which is a significant amount of garbage for large clusters.
+var configBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
 }
 
 func (n *nginxUpdater) getNginxLogHeaders() string {
@@ -427,7 +1268,7 @@ func (u upstreams) Less(i, j int) bool { return u[i].ID < u[j].ID }
 func (u upstreams) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
 
 func createUpstreamEntries(entries controller.IngressEntries) []*upstream {
-	idToUpstream := make(map[string]*upstream)
+	idToUpstream := make(map[string]*upstream, len(entries))
 
 	for _, ingressEntry := range entries {
 		maxRequestsPerConnection := defaultMaxRequestsPerUpstreamConnection
@@ -438,17 +1279,27 @@ func createUpstreamEntries(entries controller.IngressEntries) []*upstream {
 		if ingressEntry.BackendKeepaliveTimeout != 0 {
 			keepaliveTimeout = fmt.Sprintf("%ds", uint64(ingressEntry.BackendKeepaliveTimeout.Seconds()))
 		}
+		failTimeout := ""
+		if ingressEntry.BackendFailTimeout != 0 {
+			failTimeout = fmt.Sprintf("%ds", uint64(ingressEntry.BackendFailTimeout.Seconds()))
+		}
 		upstream := &upstream{
 			ID:                upstreamID(ingressEntry),
-			Server:            fmt.Sprintf("%s:%d", ingressEntry.ServiceAddress, ingressEntry.ServicePort),
+			Servers:           upstreamServers(ingressEntry),
 			MaxConnections:    ingressEntry.BackendMaxConnections,
 			KeepaliveRequests: maxRequestsPerConnection,
 			KeepaliveTimeout:  keepaliveTimeout,
+			Keepalives:        ingressEntry.BackendKeepaliveCount,
+			MaxFails:          ingressEntry.BackendMaxFails,
+			FailTimeout:       failTimeout,
+		}
+		if ingressEntry.BackupServiceAddress != "" {
+			upstream.Backup = serviceAddress(ingressEntry.BackupServiceAddress, ingressEntry.BackupServicePort)
 		}
 		idToUpstream[upstream.ID] = upstream
 	}
 
-	var sortedUpstreams []*upstream
+	sortedUpstreams := make([]*upstream, 0, len(idToUpstream))
 	for _, upstream := range idToUpstream {
 		sortedUpstreams = append(sortedUpstreams, upstream)
 	}
@@ -457,13 +1308,112 @@ func createUpstreamEntries(entries controller.IngressEntries) []*upstream {
 	return sortedUpstreams
 }
 
+// upstreamServers are the ready endpoints of the entry in endpoints mode, or else its service address.
+func upstreamServers(e controller.IngressEntry) []*upstreamServer {
+	if len(e.Endpoints) == 0 {
+		return []*upstreamServer{{Address: serviceAddress(e.ServiceAddress, e.ServicePort)}}
+	}
+	servers := make([]*upstreamServer, 0, len(e.Endpoints))
+	for _, endpoint := range e.Endpoints {
+		servers = append(servers, &upstreamServer{Address: serviceAddress(endpoint.Address, endpoint.Port),
+			Weight: int(endpoint.Weight), Backup: endpoint.Backup})
+	}
+	return servers
+}
+
+// setKeepalives uses the global keepalive count for upstreams which don't set their own, capped at
+// MaxBackendKeepalives so a few large services can't take over the pool.
+func (n *nginxUpdater) setKeepalives(upstreams []*upstream) {
+	for _, u := range upstreams {
+		if u.Keepalives == 0 {
+			u.Keepalives = n.BackendKeepalives
+		}
+		if n.MaxBackendKeepalives > 0 && u.Keepalives > n.MaxBackendKeepalives {
+			log.Debugf("Capping keepalive count of %s from %d to %d", u.ID, u.Keepalives, n.MaxBackendKeepalives)
+			u.Keepalives = n.MaxBackendKeepalives
+		}
+	}
+}
+
+// assignCertificates selects a certificate for each server from the certificate directory, if set. Servers
+// without a matching certificate use the default SSLPath.
+func (n *nginxUpdater) assignCertificates(servers []*server) error {
+	if n.SSLCertificatesDir == "" {
+		return nil
+	}
+
+	certs, err := loadCertificates(n.SSLCertificatesDir)
+	if err != nil {
+		return err
+	}
+	for _, s := range servers {
+		s.SSLPath = selectCertificate(certs, s.ServerName)
+	}
+	return nil
+}
+
+func partitionSSLPassthrough(entries controller.IngressEntries) (controller.IngressEntries, controller.IngressEntries) {
+	var httpEntries, passthroughEntries controller.IngressEntries
+	for _, entry := range entries {
+		if entry.SSLPassthrough {
+			passthroughEntries = append(passthroughEntries, entry)
+		} else {
+			httpEntries = append(httpEntries, entry)
+		}
+	}
+	return httpEntries, passthroughEntries
+}
+
+// createPassthroughEntries creates a single passthrough per host, as TLS connections can only be routed by SNI.
+func createPassthroughEntries(entries controller.IngressEntries) []*passthrough {
+	unique := uniqueIngressEntries(entries)
+	sort.Slice(unique, func(i, j int) bool { return unique[i].Path < unique[j].Path })
+
+	hostToPassthrough := make(map[string]*passthrough)
+	for _, ingressEntry := range unique {
+		if existing, exists := hostToPassthrough[ingressEntry.Host]; exists {
+			log.Infof("Ignoring ssl passthrough for '%s' because its host is already passed through to %s",
+				ingressEntry, existing.Server)
+			continue
+		}
+		hostToPassthrough[ingressEntry.Host] = &passthrough{
+			ServerName:     ingressEntry.Host,
+			UpstreamID:     upstreamID(ingressEntry),
+			Server:         serviceAddress(ingressEntry.ServiceAddress, ingressEntry.ServicePort),
+			FrontendScheme: ingressEntry.LbScheme,
+		}
+	}
+
+	var passthroughs []*passthrough
+	for _, p := range hostToPassthrough {
+		passthroughs = append(passthroughs, p)
+	}
+	sort.Slice(passthroughs, func(i, j int) bool { return passthroughs[i].ServerName < passthroughs[j].ServerName })
+	return passthroughs
+}
+
+func (c *Conf) hasHTTPSPort() bool {
+	for _, port := range c.Ports {
+		if port.SSL {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamID and serviceAddress are built by concatenation rather than fmt, as they're called for every entry on
+// every update.
 func upstreamID(e controller.IngressEntry) string {
-	return fmt.Sprintf("%s.%s.%s.%d", e.Namespace, e.Name, e.ServiceAddress, e.ServicePort)
+	return e.Namespace + "." + e.Name + "." + e.ServiceAddress + "." + strconv.Itoa(int(e.ServicePort))
+}
+
+func serviceAddress(address string, port int32) string {
+	return address + ":" + strconv.Itoa(int(port))
 }
 
 func (s server) HasRootLocation() bool {
 	for i := range s.Locations {
-		if s.Locations[i].Path == "/" {
+		if s.Locations[i].Path == "/" && !s.Locations[i].PathRegex {
 			return true
 		}
 	}
@@ -478,21 +1428,34 @@ func (s servers) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 type locations []*location
 
-func (l locations) Len() int           { return len(l) }
-func (l locations) Less(i, j int) bool { return l[i].Path < l[j].Path }
-func (l locations) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l locations) Len() int      { return len(l) }
+func (l locations) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+func (l locations) Less(i, j int) bool {
+	// nginx uses the first regex which matches, so they're ordered from the longest, and most specific
+	if l[i].PathRegex != l[j].PathRegex {
+		return !l[i].PathRegex
+	}
+	if l[i].PathRegex && len(l[i].Path) != len(l[j].Path) {
+		return len(l[i].Path) > len(l[j].Path)
+	}
+	return l[i].Path < l[j].Path
+}
 
 func createServerEntries(entries controller.IngressEntries) []*server {
+	unique := uniqueIngressEntries(entries)
 	hostToNginxEntry := make(map[string]*server)
+	// allocated together, rather than one at a time
+	allLocations := make([]location, len(unique))
 
-	for _, ingressEntry := range uniqueIngressEntries(entries) {
+	for i, ingressEntry := range unique {
 		serverEntry, exists := hostToNginxEntry[ingressEntry.Host]
 		if !exists {
 			serverEntry = &server{ServerName: ingressEntry.Host}
 			hostToNginxEntry[ingressEntry.Host] = serverEntry
 		}
 
-		location := location{
+		allLocations[i] = location{
 			Path:                  ingressEntry.Path,
 			UpstreamID:            upstreamID(ingressEntry),
 			Allow:                 ingressEntry.Allow,
@@ -501,16 +1464,42 @@ func createServerEntries(entries controller.IngressEntries) []*server {
 			BackendTimeoutSeconds: ingressEntry.BackendTimeoutSeconds,
 			ProxyBufferSize:       ingressEntry.ProxyBufferSize,
 			ProxyBufferBlocks:     ingressEntry.ProxyBufferBlocks,
+			BackendSPIFFE:         ingressEntry.BackendSPIFFE,
+			BackendSPIFFEName:     ingressEntry.BackendSPIFFEName,
+			AllowCountries:        ingressEntry.AllowCountries,
+			DenyCountries:         ingressEntry.DenyCountries,
+			DisableTracing:        ingressEntry.DisableTracing,
+			TracingSample:         tracingSample(ingressEntry.TracingSampleRate),
+			BackendProtocol:       ingressEntry.BackendProtocol,
+			InterceptErrors:       ingressEntry.InterceptErrors,
+			SecurityProfile:       ingressEntry.SecurityHeaders,
+			InternalPaths:         ingressEntry.InternalPaths,
+			TrailingSlash:         ingressEntry.TrailingSlash,
+			PrefixPath:            ingressEntry.PrefixPath,
+			PathRegex:             ingressEntry.PathRegex,
+			WebSocket:             ingressEntry.WebSocketUpgrade,
+			WebSocketTimeout:      ingressEntry.WebSocketTimeoutSeconds,
+			NJSContent:            ingressEntry.NJSContent,
+			NJSHeaderFilter:       ingressEntry.NJSHeaderFilter,
+			APIKey:                newAPIKeyCheck(ingressEntry),
+			StatsName:             ingressEntry.StatsName,
+			Htpasswd:              ingressEntry.HtpasswdFile(),
+			RateLimit:             newRateLimit(ingressEntry),
+			RequestHeaders:        ingressEntry.RequestHeaders,
+			ResponseHeaders:       ingressEntry.ResponseHeaders,
+			FrontendScheme:        ingressEntry.LbScheme,
+			Drain:                 ingressEntry.Drain,
 		}
 
 		serverEntry.Names = append(serverEntry.Names, ingressEntry.NamespaceName())
-		serverEntry.Locations = append(serverEntry.Locations, &location)
+		serverEntry.Locations = append(serverEntry.Locations, &allLocations[i])
 	}
 
-	var serverEntries []*server
+	serverEntries := make([]*server, 0, len(hostToNginxEntry))
 	for _, serverEntry := range hostToNginxEntry {
 		sort.Strings(serverEntry.Names)
 		serverEntry.Name = strings.Join(serverEntry.Names, " ")
+		serverEntry.Locations = addInternalLocations(serverEntry.ServerName, serverEntry.Locations)
 		sort.Sort(locations(serverEntry.Locations))
 		serverEntries = append(serverEntries, serverEntry)
 	}
@@ -525,35 +1514,49 @@ type ingressKey struct {
 
 func uniqueIngressEntries(entries controller.IngressEntries) []controller.IngressEntry {
 	sort.Slice(entries, func(i, j int) bool {
-		iEntry := entries[i]
-		jEntry := entries[j]
-		iString := strings.Join([]string{iEntry.Namespace, iEntry.Name, iEntry.Host, iEntry.Path,
-			iEntry.ServiceAddress, string(iEntry.ServicePort)}, ":")
-		jString := strings.Join([]string{jEntry.Namespace, jEntry.Name, jEntry.Host, jEntry.Path,
-			jEntry.ServiceAddress, string(jEntry.ServicePort)}, ":")
-		return iString < jString
+		return lessIngressEntry(&entries[i], &entries[j])
 	})
 
-	uniqueIngress := make(map[ingressKey]controller.IngressEntry)
+	uniqueIngress := make(map[ingressKey]int, len(entries))
+	uniqueIngressEntries := make([]controller.IngressEntry, 0, len(entries))
 	for _, ingressEntry := range entries {
-		ingressEntry.Path = createNginxPath(ingressEntry.Path, ingressEntry.ExactPath)
+		if !ingressEntry.PathRegex {
+			ingressEntry.Path = createNginxPath(ingressEntry.Path, ingressEntry.ExactPath)
+		}
 		key := ingressKey{ingressEntry.Host, ingressEntry.Path}
-		existingIngressEntry, exists := uniqueIngress[key]
+		existing, exists := uniqueIngress[key]
 		if !exists {
-			uniqueIngress[key] = ingressEntry
+			uniqueIngress[key] = len(uniqueIngressEntries)
+			uniqueIngressEntries = append(uniqueIngressEntries, ingressEntry)
 			continue
 		}
-		log.Infof("Ignoring '%s' because it duplicates the host/path of '%s'", ingressEntry, existingIngressEntry)
-	}
-
-	uniqueIngressEntries := make([]controller.IngressEntry, 0, len(uniqueIngress))
-	for _, value := range uniqueIngress {
-		uniqueIngressEntries = append(uniqueIngressEntries, value)
+		log.Infof("Ignoring '%s' because it duplicates the host/path of '%s'", ingressEntry, uniqueIngressEntries[existing])
 	}
 
 	return uniqueIngressEntries
 }
 
+// lessIngressEntry orders entries by namespace, name, host, path, then service, so the first of any duplicates
+// is always used.
+func lessIngressEntry(i, j *controller.IngressEntry) bool {
+	if i.Namespace != j.Namespace {
+		return i.Namespace < j.Namespace
+	}
+	if i.Name != j.Name {
+		return i.Name < j.Name
+	}
+	if i.Host != j.Host {
+		return i.Host < j.Host
+	}
+	if i.Path != j.Path {
+		return i.Path < j.Path
+	}
+	if i.ServiceAddress != j.ServiceAddress {
+		return i.ServiceAddress < j.ServiceAddress
+	}
+	return i.ServicePort < j.ServicePort
+}
+
 func createNginxPath(rawPath string, exactPath bool) string {
 	if exactPath {
 		return rawPath
@@ -563,13 +1566,16 @@ func createNginxPath(rawPath string, exactPath bool) string {
 	if len(nginxPath) == 0 {
 		nginxPath = "/"
 	} else {
-		nginxPath = fmt.Sprintf("/%s/", nginxPath)
+		nginxPath = "/" + nginxPath + "/"
 	}
 	return nginxPath
 }
 
 func (n *nginxUpdater) Health() error {
 	if !n.running.Get() {
+		if err := n.restartHealth.Get(); err != nil {
+			return err
+		}
 		return errors.New("nginx is not running")
 	}
 	if !n.initialUpdateAttempted.Get() {
@@ -578,6 +1584,9 @@ func (n *nginxUpdater) Health() error {
 	if n.metricsUnhealthy.Get() {
 		return errors.New("nginx metrics are failing to update")
 	}
+	if err := n.templateErr.Get(); err != nil {
+		return fmt.Errorf("nginx template is invalid: %v", err)
+	}
 	return nil
 }
 
@@ -589,6 +1598,11 @@ func (n *nginxUpdater) String() string {
 	return "nginx proxy"
 }
 
+// Prerequisite is true, as frontends must only be attached once nginx is running with the new config.
+func (n *nginxUpdater) Prerequisite() bool {
+	return true
+}
+
 func writeFile(location string, contents []byte) (bool, error) {
 	err := ioutil.WriteFile(location, contents, 0644)
 	if err != nil {
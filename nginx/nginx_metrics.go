@@ -1,10 +1,16 @@
 package nginx
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -19,11 +25,27 @@ var once sync.Once
 var connections, waitingConnections, writingConnections, readingConnections prometheus.Gauge
 var totalAccepts, totalHandled, totalRequests prometheus.Gauge
 var ingressRequests, endpointRequests, ingressBytes, endpointBytes *prometheus.GaugeVec
-var reloads prometheus.Counter
+var endpointResponseTime, endpointServerErrorRatio, upstreamRetries *prometheus.GaugeVec
+var reloads, reloadFailures, configCheckFailures, binaryUpgrades, nginxRestarts prometheus.Counter
+var restartLimitReached prometheus.Gauge
+var configRenderDuration, configCheckDuration, reloadDuration, validationDuration prometheus.Histogram
+var validationFailures, configRollbacks prometheus.Counter
+var drainingWorkers prometheus.Gauge
+var templateErrors prometheus.Counter
+var errorLogEvents *prometheus.CounterVec
+var upstreamEjections *prometheus.CounterVec
+var ingressRequestTime, ingressRequestSize *prometheus.GaugeVec
+var schemeRequests *prometheus.GaugeVec
 var ingressRequestsLabelNames = []string{"host", "path", "code"}
 var endpointRequestsLabelNames = []string{"name", "endpoint", "code"}
 var ingressBytesLabelNames = []string{"host", "path", "direction"}
+var ingressBucketLabelNames = []string{"host", "path", "le"}
 var endpointBytesLabelNames = []string{"name", "endpoint", "direction"}
+var endpointLabelNames = []string{"name", "endpoint"}
+var upstreamLabelNames = []string{"name"}
+var errorLogEventsLabelNames = []string{"event", "severity"}
+var upstreamEjectionsLabelNames = []string{"endpoint"}
+var schemeRequestsLabelNames = []string{"scheme", "code"}
 
 func initMetrics() {
 	once.Do(func() {
@@ -64,8 +86,74 @@ func initMetrics() {
 				"Direction is 'in' for bytes received from the endpoint, 'out' for bytes sent to the endpoint. "+
 				"For implementation reasons, this counter is a gauge.",
 			endpointBytesLabelNames)
+		endpointResponseTime = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusIngressSubsystem, "endpoint_response_time_seconds",
+			"The average time taken by this endpoint to respond to requests proxied by NGINX.",
+			endpointLabelNames)
+		endpointServerErrorRatio = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusIngressSubsystem, "endpoint_5xx_ratio",
+			"The ratio of requests proxied to this endpoint which resulted in a 5xx response.",
+			endpointLabelNames)
+		upstreamRetries = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusIngressSubsystem, "upstream_retries",
+			"The number of requests to this upstream over and above the number of client requests routed to it, "+
+				"which are the result of NGINX retrying a request against the upstream. "+
+				"For implementation reasons, this counter is a gauge.",
+			upstreamLabelNames)
 		reloads = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem, "reloads",
 			"Count of Nginx configuration reloads")
+		reloadFailures = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem, "reload_failures",
+			"Count of Nginx configuration reloads which failed, as Nginx could not be signalled.")
+		configCheckFailures = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"nginx_config_check_failures", "Count of Nginx configurations which failed 'nginx -t'.")
+		binaryUpgrades = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem, "nginx_binary_upgrades",
+			"Count of in-place upgrades of the Nginx binary.")
+		nginxRestarts = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem, "nginx_restarts",
+			"Count of times Nginx was restarted after its master process exited unexpectedly.")
+		restartLimitReached = metrics.RegisterNewDefaultGauge(metrics.PrometheusIngressSubsystem,
+			"nginx_restart_limit_reached",
+			"Set to 1 once Nginx has exited more times in a row than --nginx-max-restarts, so isn't restarted again.")
+		configRenderDuration = metrics.RegisterNewDefaultHistogram(metrics.PrometheusIngressSubsystem,
+			"nginx_config_render_duration_seconds", "Time taken to render the Nginx configuration from the template.", nil)
+		configCheckDuration = metrics.RegisterNewDefaultHistogram(metrics.PrometheusIngressSubsystem,
+			"nginx_config_check_duration_seconds", "Time taken by 'nginx -t' to check the Nginx configuration.", nil)
+		reloadDuration = metrics.RegisterNewDefaultHistogram(metrics.PrometheusIngressSubsystem,
+			"nginx_reload_duration_seconds",
+			"Time taken by Nginx to reload its configuration, from signalling it until its new workers have replaced "+
+				"the old ones.", nil)
+		validationDuration = metrics.RegisterNewDefaultHistogram(metrics.PrometheusIngressSubsystem,
+			"nginx_config_validation_duration_seconds",
+			"Time taken to start a validation Nginx with a new configuration and probe it.", nil)
+		validationFailures = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"nginx_config_validation_failures",
+			"Count of new Nginx configurations which weren't loaded, as they failed their probes on the validation port.")
+		configRollbacks = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"nginx_config_rollbacks",
+			"Count of reloads which were rolled back to the last good Nginx configuration, as workers crashed or too "+
+				"many requests failed afterwards.")
+		drainingWorkers = metrics.RegisterNewDefaultGauge(metrics.PrometheusIngressSubsystem, "nginx_draining_workers",
+			"The number of old Nginx worker processes which are still shutting down after a reload.")
+		templateErrors = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem, "nginx_template_errors",
+			"Count of failures to parse or render the Nginx templates.")
+		errorLogEvents = metrics.RegisterNewDefaultCounterVec(metrics.PrometheusIngressSubsystem, "nginx_error_log_events",
+			"Count of notable events logged to the Nginx error log. Event is one of 'upstream_connect_failure', "+
+				"'ssl_handshake_error' or 'worker_crash'.",
+			errorLogEventsLabelNames)
+		upstreamEjections = metrics.RegisterNewDefaultCounterVec(metrics.PrometheusIngressSubsystem, "upstream_ejections",
+			"Count of times an upstream server was ejected for max_fails failed requests within fail_timeout, by the "+
+				"endpoint it proxies to.",
+			upstreamEjectionsLabelNames)
+		ingressRequestTime = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusIngressSubsystem, "ingress_request_time_seconds_bucket",
+			"The cumulative number of requests to this ingress which took less than or equal to 'le' seconds, in the "+
+				"buckets set by --nginx-vhost-stats-request-buckets. Use with histogram_quantile for percentiles. "+
+				"For implementation reasons, this counter is a gauge.",
+			ingressBucketLabelNames)
+		schemeRequests = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusIngressSubsystem, "scheme_requests",
+			"The number of requests to the ports of each frontend scheme, which only serve ingresses of that scheme. "+
+				"For implementation reasons, this counter is a gauge.",
+			schemeRequestsLabelNames)
+		ingressRequestSize = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusIngressSubsystem, "ingress_request_size_bytes_bucket",
+			"The cumulative number of requests to this ingress with a size, including the request line and headers, "+
+				"less than or equal to 'le' bytes. Use with histogram_quantile for percentiles. "+
+				"For implementation reasons, this counter is a gauge.",
+			ingressBucketLabelNames)
 	})
 }
 
@@ -82,10 +170,20 @@ type VTSConnections struct {
 
 // VTSRequestData contains request details.
 type VTSRequestData struct {
-	Server    string        `json:"server"`
-	InBytes   float64       `json:"inBytes"`
-	OutBytes  float64       `json:"outBytes"`
-	Responses *VTSResponses `json:"responses"`
+	Server         string        `json:"server"`
+	RequestCounter float64       `json:"requestCounter"`
+	InBytes        float64       `json:"inBytes"`
+	OutBytes       float64       `json:"outBytes"`
+	ResponseMsec   float64       `json:"responseMsec"`
+	Responses      *VTSResponses `json:"responses"`
+	// RequestBuckets are only present when --nginx-vhost-stats-request-buckets is set.
+	RequestBuckets *VTSRequestBuckets `json:"requestBuckets"`
+}
+
+// VTSRequestBuckets contains the number of requests in each request time bucket.
+type VTSRequestBuckets struct {
+	Msecs    []float64 `json:"msecs"`
+	Counters []float64 `json:"counters"`
 }
 
 // VTSResponses contains response details.
@@ -100,24 +198,73 @@ type VTSResponses struct {
 // VTSMetrics represents the json returned by the VTS NGINX plugin.
 type VTSMetrics struct {
 	Connections   *VTSConnections                      `json:"connections"`
+	ServerZones   map[string]VTSRequestData            `json:"serverZones"`
 	FilterZones   map[string]map[string]VTSRequestData `json:"filterZones"`
 	UpstreamZones map[string][]VTSRequestData          `json:"upstreamZones"`
 }
 
-func parseAndSetNginxMetrics(statusPort int) error {
-	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/%s", statusPort, statusPath))
+// statusCache remembers the last status page, so it's only parsed when it has changed.
+type statusCache struct {
+	etag string
+	hash [sha256.Size]byte
+}
+
+// statusNow is the time of the status page itself, which changes on every request, so it's ignored when comparing
+// status pages.
+var statusNow = regexp.MustCompile(`"nowMsec":\d+,?`)
+
+// unchanged returns true if the status page is the same as the last one seen.
+func (c *statusCache) unchanged(body []byte) bool {
+	hash := sha256.Sum256(statusNow.ReplaceAll(body, nil))
+	if hash == c.hash {
+		return true
+	}
+	c.hash = hash
+	return false
+}
+
+func parseAndSetNginxMetrics(statusPort int, limiter *ingressSeriesLimiter, cache *statusCache) error {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d/%s", statusPort, statusPath), nil)
+	if err != nil {
+		return err
+	}
+	if cache.etag != "" {
+		req.Header.Set("If-None-Match", cache.etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	vtsMetrics, err := parseStatusBody(resp.Body)
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from nginx status page", resp.StatusCode)
+	}
+	cache.etag = resp.Header.Get("ETag")
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if cache.unchanged(body) {
+		log.Debug("Nginx status page is unchanged, skipping metrics update")
+		return nil
+	}
+	vtsMetrics, err := parseStatusBody(bytes.NewReader(body))
 	if err != nil {
+		// parse it again next time, rather than treat it as unchanged
+		cache.hash = [sha256.Size]byte{}
 		return err
 	}
 
 	updateNginxMetrics(vtsMetrics)
-	updateIngressMetrics(vtsMetrics)
+	updateIngressMetrics(vtsMetrics, limiter)
+	updateIngressRequestSizeMetrics(vtsMetrics, limiter)
+	updateSchemeMetrics(vtsMetrics)
 	updateEndpointMetrics(vtsMetrics)
+	updateUpstreamMetrics(vtsMetrics)
 
 	return nil
 }
@@ -132,9 +279,89 @@ func updateNginxMetrics(metrics VTSMetrics) {
 	totalRequests.Set(metrics.Connections.Requests)
 }
 
-func updateIngressMetrics(metrics VTSMetrics) {
-	for host, zoneDetails := range metrics.FilterZones {
-		for zone, requestData := range zoneDetails {
+const overflowLabelValue = "other"
+
+// aggregatedPathLabelValue is used for the path label when metrics are aggregated per host.
+const aggregatedPathLabelValue = "*"
+
+// requestSizeFilterPrefix marks the filter zones which count requests by size for each host, rather than
+// by upstream, e.g. "request_size@foo.com" with a zone of "/path/::1000".
+const requestSizeFilterPrefix = "request_size@"
+
+// requestSizeBuckets are the upper bounds of the $request_size_bucket map in the template, in order.
+var requestSizeBuckets = []string{"1000", "10000", "100000", "1e+06", "1e+07"}
+
+const infBucket = "+Inf"
+
+type ingressSeries struct {
+	host, path string
+}
+
+// ingressSeriesLimiter controls the cardinality of the per-ingress metrics.
+type ingressSeriesLimiter struct {
+	hostLevelOnly bool
+	allowedHosts  map[string]bool
+	maxSeries     int
+	tracked       map[ingressSeries]bool
+}
+
+func newIngressSeriesLimiter(hostLevelOnly bool, allowedHosts []string, maxSeries int) *ingressSeriesLimiter {
+	l := &ingressSeriesLimiter{
+		hostLevelOnly: hostLevelOnly,
+		maxSeries:     maxSeries,
+		tracked:       make(map[ingressSeries]bool),
+	}
+	if len(allowedHosts) > 0 {
+		l.allowedHosts = make(map[string]bool)
+		for _, host := range allowedHosts {
+			l.allowedHosts[host] = true
+		}
+	}
+	return l
+}
+
+// series returns the labels to record the given host and path under. Hosts which aren't allowed, and new
+// series once the maximum has been reached, are recorded under the overflow series. Series are tracked for
+// the lifetime of the process, so an existing series is never moved to the overflow series.
+func (l *ingressSeriesLimiter) series(host, path string) ingressSeries {
+	if l == nil {
+		return ingressSeries{host: host, path: path}
+	}
+
+	overflow := ingressSeries{host: overflowLabelValue, path: overflowLabelValue}
+
+	if l.allowedHosts != nil && !l.allowedHosts[host] {
+		return overflow
+	}
+
+	s := ingressSeries{host: host, path: path}
+	if l.hostLevelOnly {
+		s.path = aggregatedPathLabelValue
+	}
+
+	if l.maxSeries > 0 && !l.tracked[s] {
+		if len(l.tracked) >= l.maxSeries {
+			return overflow
+		}
+		l.tracked[s] = true
+	}
+
+	return s
+}
+
+func updateIngressMetrics(metrics VTSMetrics, limiter *ingressSeriesLimiter) {
+	aggregated := make(map[ingressSeries]*VTSRequestData)
+	requestTimes := make(map[ingressSeries]map[float64]float64)
+	var order []ingressSeries
+
+	// iterate in a stable order, so the same series are tracked when limited by the maximum series
+	for _, host := range sortedKeys(metrics.FilterZones) {
+		if strings.HasPrefix(host, requestSizeFilterPrefix) || strings.HasPrefix(host, schemeFilterPrefix) {
+			continue
+		}
+		zoneDetails := metrics.FilterZones[host]
+		for _, zone := range sortedZones(zoneDetails) {
+			requestData := zoneDetails[zone]
 			responses := requestData.Responses
 			if responses == nil {
 				log.Warnf("response was nil when trying to parse filter zones for %s", host)
@@ -148,15 +375,141 @@ func updateIngressMetrics(metrics VTSMetrics) {
 			}
 			path := strs[0]
 
-			ingressBytes.WithLabelValues(host, path, "in").Set(requestData.InBytes)
-			ingressBytes.WithLabelValues(host, path, "out").Set(requestData.OutBytes)
-			ingressRequests.WithLabelValues(host, path, "1xx").Set(responses.OneXX)
-			ingressRequests.WithLabelValues(host, path, "2xx").Set(responses.TwoXX)
-			ingressRequests.WithLabelValues(host, path, "3xx").Set(responses.ThreeXX)
-			ingressRequests.WithLabelValues(host, path, "4xx").Set(responses.FourXX)
-			ingressRequests.WithLabelValues(host, path, "5xx").Set(responses.FiveXX)
+			series := limiter.series(host, path)
+			total, exists := aggregated[series]
+			if !exists {
+				total = &VTSRequestData{Responses: &VTSResponses{}}
+				aggregated[series] = total
+				requestTimes[series] = make(map[float64]float64)
+				order = append(order, series)
+			}
+			total.RequestCounter += requestData.RequestCounter
+			total.InBytes += requestData.InBytes
+			total.OutBytes += requestData.OutBytes
+			total.Responses.OneXX += responses.OneXX
+			total.Responses.TwoXX += responses.TwoXX
+			total.Responses.ThreeXX += responses.ThreeXX
+			total.Responses.FourXX += responses.FourXX
+			total.Responses.FiveXX += responses.FiveXX
+			if buckets := requestData.RequestBuckets; buckets != nil && len(buckets.Msecs) == len(buckets.Counters) {
+				for i, msecs := range buckets.Msecs {
+					requestTimes[series][msecs] += buckets.Counters[i]
+				}
+			}
 		}
 	}
+
+	for _, series := range order {
+		requestData := aggregated[series]
+		responses := requestData.Responses
+		host, path := series.host, series.path
+
+		ingressBytes.WithLabelValues(host, path, "in").Set(requestData.InBytes)
+		ingressBytes.WithLabelValues(host, path, "out").Set(requestData.OutBytes)
+		ingressRequests.WithLabelValues(host, path, "1xx").Set(responses.OneXX)
+		ingressRequests.WithLabelValues(host, path, "2xx").Set(responses.TwoXX)
+		ingressRequests.WithLabelValues(host, path, "3xx").Set(responses.ThreeXX)
+		ingressRequests.WithLabelValues(host, path, "4xx").Set(responses.FourXX)
+		ingressRequests.WithLabelValues(host, path, "5xx").Set(responses.FiveXX)
+
+		if len(requestTimes[series]) > 0 {
+			bounds := make([]float64, 0, len(requestTimes[series]))
+			for msecs := range requestTimes[series] {
+				bounds = append(bounds, msecs)
+			}
+			sort.Float64s(bounds)
+			var cumulative float64
+			for _, msecs := range bounds {
+				cumulative += requestTimes[series][msecs]
+				le := strconv.FormatFloat(msecs/1000, 'g', -1, 64)
+				ingressRequestTime.WithLabelValues(host, path, le).Set(cumulative)
+			}
+			ingressRequestTime.WithLabelValues(host, path, infBucket).Set(requestData.RequestCounter)
+		}
+	}
+}
+
+// updateIngressRequestSizeMetrics sets the request size buckets from the filter zones which count requests by
+// their $request_size_bucket. These are only present when MetricsRequestSizes is enabled.
+func updateIngressRequestSizeMetrics(metrics VTSMetrics, limiter *ingressSeriesLimiter) {
+	sizes := make(map[ingressSeries]map[string]float64)
+	var order []ingressSeries
+
+	for _, group := range sortedKeys(metrics.FilterZones) {
+		if !strings.HasPrefix(group, requestSizeFilterPrefix) {
+			continue
+		}
+		host := strings.TrimPrefix(group, requestSizeFilterPrefix)
+		zoneDetails := metrics.FilterZones[group]
+		for _, zone := range sortedZones(zoneDetails) {
+			strs := strings.Split(zone, "::")
+			if len(strs) != 2 || strs[1] == "" {
+				log.Warnf("request size filter not formatted as expected for %s, got %s without a valid '::' split", host, zone)
+				continue
+			}
+
+			series := limiter.series(host, strs[0])
+			if _, exists := sizes[series]; !exists {
+				sizes[series] = make(map[string]float64)
+				order = append(order, series)
+			}
+			sizes[series][strs[1]] += zoneDetails[zone].RequestCounter
+		}
+	}
+
+	for _, series := range order {
+		var cumulative float64
+		for _, le := range requestSizeBuckets {
+			cumulative += sizes[series][le]
+			ingressRequestSize.WithLabelValues(series.host, series.path, le).Set(cumulative)
+		}
+		ingressRequestSize.WithLabelValues(series.host, series.path, infBucket).Set(cumulative + sizes[series][infBucket])
+	}
+}
+
+// updateSchemeMetrics sets the requests to the ports of each frontend scheme from their filter zones, which count
+// them per host. These are only present for ports with a scheme.
+func updateSchemeMetrics(metrics VTSMetrics) {
+	for group, zoneDetails := range metrics.FilterZones {
+		if !strings.HasPrefix(group, schemeFilterPrefix) {
+			continue
+		}
+		var total VTSResponses
+		for _, requestData := range zoneDetails {
+			if responses := requestData.Responses; responses != nil {
+				total.OneXX += responses.OneXX
+				total.TwoXX += responses.TwoXX
+				total.ThreeXX += responses.ThreeXX
+				total.FourXX += responses.FourXX
+				total.FiveXX += responses.FiveXX
+			}
+		}
+
+		scheme := strings.TrimPrefix(group, schemeFilterPrefix)
+		schemeRequests.WithLabelValues(scheme, "1xx").Set(total.OneXX)
+		schemeRequests.WithLabelValues(scheme, "2xx").Set(total.TwoXX)
+		schemeRequests.WithLabelValues(scheme, "3xx").Set(total.ThreeXX)
+		schemeRequests.WithLabelValues(scheme, "4xx").Set(total.FourXX)
+		schemeRequests.WithLabelValues(scheme, "5xx").Set(total.FiveXX)
+	}
+}
+
+func sortedKeys(filterZones map[string]map[string]VTSRequestData) []string {
+	keys := make([]string, 0, len(filterZones))
+	for key := range filterZones {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedZones(zones map[string]VTSRequestData) []string {
+	keys := make([]string, 0, len(zones))
+	for key := range zones {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func updateEndpointMetrics(metrics VTSMetrics) {
@@ -175,10 +528,51 @@ func updateEndpointMetrics(metrics VTSMetrics) {
 			endpointRequests.WithLabelValues(name, zone.Server, "3xx").Set(responses.ThreeXX)
 			endpointRequests.WithLabelValues(name, zone.Server, "4xx").Set(responses.FourXX)
 			endpointRequests.WithLabelValues(name, zone.Server, "5xx").Set(responses.FiveXX)
+			endpointResponseTime.WithLabelValues(name, zone.Server).Set(zone.ResponseMsec / 1000)
+			if zone.RequestCounter > 0 {
+				endpointServerErrorRatio.WithLabelValues(name, zone.Server).Set(responses.FiveXX / zone.RequestCounter)
+			}
 		}
 	}
 }
 
+// updateUpstreamMetrics derives the number of retries per upstream by comparing the requests proxied to the
+// upstream with the client requests received by the locations which route to it. Locations set their filter
+// key to "path::upstream", so the upstream name can be recovered from the filter zones.
+func updateUpstreamMetrics(metrics VTSMetrics) {
+	clientRequests := make(map[string]float64)
+	for group, zoneDetails := range metrics.FilterZones {
+		if strings.HasPrefix(group, requestSizeFilterPrefix) || strings.HasPrefix(group, schemeFilterPrefix) {
+			continue
+		}
+		for zone, requestData := range zoneDetails {
+			strs := strings.Split(zone, "::")
+			if len(strs) != 2 || strs[1] == "" {
+				continue
+			}
+			clientRequests[strs[1]] += requestData.RequestCounter
+		}
+	}
+
+	for name, zones := range metrics.UpstreamZones {
+		received, ok := clientRequests[name]
+		if !ok {
+			continue
+		}
+
+		var proxied float64
+		for _, zone := range zones {
+			proxied += zone.RequestCounter
+		}
+
+		retries := proxied - received
+		if retries < 0 {
+			retries = 0
+		}
+		upstreamRetries.WithLabelValues(name).Set(retries)
+	}
+}
+
 func parseStatusBody(body io.Reader) (VTSMetrics, error) {
 	dec := json.NewDecoder(body)
 	var vtsMetrics VTSMetrics
@@ -191,3 +585,7 @@ func parseStatusBody(body io.Reader) (VTSMetrics, error) {
 func incrementReloadMetric() {
 	reloads.Inc()
 }
+
+func incrementReloadFailureMetric() {
+	reloadFailures.Inc()
+}
@@ -1,13 +1,20 @@
 package nginx
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -15,6 +22,7 @@ import (
 	"testing"
 	"time"
 
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -52,6 +60,8 @@ func newConf(tmpDir string, binary string) Conf {
 		Ports:                        []Port{{Name: "http", Port: port}},
 		WorkerProcesses:              1,
 		WorkerShutdownTimeoutSeconds: 0,
+		MultiAccept:                  true,
+		UseEpoll:                     true,
 		BackendKeepalives:            1024,
 		BackendConnectTimeoutSeconds: 1,
 		ServerNamesHashMaxSize:       -1,
@@ -160,6 +170,363 @@ func TestNginxDoesNotReloadWithZeroIngresses(t *testing.T) {
 	assert.False(t, nginxHasReloaded(tmpDir))
 }
 
+func TestNginxStartsWithZeroIngressesWhenAllowed(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.AllowZeroEntries = true
+	lb := newNginxWithConf(conf)
+
+	lb.Start()
+
+	assert.NoError(t, lb.Update([]controller.IngressEntry{}))
+	assert.True(t, nginxHasStarted(tmpDir))
+}
+
+func TestGlobalDenyFileIsMergedWithFlag(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	denyFile := filepath.Join(tmpDir, "deny")
+	assert.NoError(ioutil.WriteFile(denyFile, []byte("# scanners\n203.0.113.0/24\n\n198.51.100.7 # embargoed\n"), 0644))
+	conf := newConf(tmpDir, fakeNginx)
+	conf.GlobalDeny = []string{"192.0.2.0/24"}
+	conf.GlobalDenyFile = denyFile
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{{Host: "foo.com", Path: "/", ServiceAddress: "foo", ServicePort: 8080}}))
+
+	config, err := ioutil.ReadFile(filepath.Join(tmpDir, "nginx.conf"))
+	assert.NoError(err)
+	assert.Contains(string(config), "            deny 192.0.2.0/24;\n"+
+		"            deny 203.0.113.0/24;\n"+
+		"            deny 198.51.100.7;\n")
+}
+
+func TestInvalidGlobalDenyFailsStart(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.GlobalDeny = []string{"not-a-cidr"}
+	lb := newNginxWithConf(conf)
+
+	err := lb.Start()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `invalid entry "not-a-cidr"`)
+	}
+}
+
+func TestTracingSamplesAreSplitByRequest(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.OpenTracingPlugin = "/my/plugin.so"
+	conf.OpenTracingConfig = "/etc/my/config.json"
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{
+		{Host: "foo.com", Path: "/", ServiceAddress: "foo", ServicePort: 8080, TracingSampleRate: 0.125},
+		{Host: "bar.com", Path: "/", ServiceAddress: "bar", ServicePort: 8080, TracingSampleRate: 0.125},
+	}))
+
+	config, err := ioutil.ReadFile(filepath.Join(tmpDir, "nginx.conf"))
+	assert.NoError(err)
+	assert.Equal(1, strings.Count(string(config), "split_clients"))
+	assert.Contains(string(config), "    split_clients $request_id $tracing_sample_12_5 {\n"+
+		"        12.5% 1;\n"+
+		"        * 0;\n"+
+		"    }\n")
+}
+
+func TestTracingVendorPresetsGenerateTracerConfig(t *testing.T) {
+	var tests = []struct {
+		vendor   string
+		endpoint string
+		plugin   string
+		config   string
+	}{
+		{"jaeger", "", "/usr/local/lib64/libjaegertracing.so",
+			`{"reporter":{"localAgentHostPort":"localhost:6831"},"sampler":{"param":1,"type":"const"},"service_name":"feed-ingress"}`},
+		{"zipkin", "zipkin.tracing:9411", "/usr/local/lib/libzipkin_opentracing_plugin.so",
+			`{"collector_host":"zipkin.tracing","collector_port":9411,"service_name":"feed-ingress"}`},
+		{"datadog", "10.0.0.1:8126", "/usr/local/lib/libdd_opentracing_plugin.so",
+			`{"agent_host":"10.0.0.1","agent_port":8126,"service":"feed-ingress"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.vendor, func(t *testing.T) {
+			assert := assert.New(t)
+			tmpDir := setupWorkDir(t)
+			defer os.Remove(tmpDir)
+			conf := newConf(tmpDir, fakeNginx)
+			conf.TracingVendor = test.vendor
+			conf.TracingEndpoint = test.endpoint
+			conf.TracingServiceName = "feed-ingress"
+			lb := newNginxWithConf(conf)
+
+			assert.NoError(lb.Start())
+
+			tracerConfig, err := ioutil.ReadFile(filepath.Join(tmpDir, "tracer-config.json"))
+			assert.NoError(err)
+			assert.JSONEq(test.config, string(tracerConfig))
+			config, err := ioutil.ReadFile(filepath.Join(tmpDir, "nginx.conf"))
+			assert.NoError(err)
+			assert.Contains(string(config), fmt.Sprintf("opentracing_load_tracer %s %s/tracer-config.json;", test.plugin, tmpDir))
+		})
+	}
+}
+
+func TestTracingVendorUsesExplicitPlugin(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.TracingVendor = "jaeger"
+	conf.OpenTracingPlugin = "/my/plugin.so"
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+
+	config, err := ioutil.ReadFile(filepath.Join(tmpDir, "nginx.conf"))
+	assert.NoError(err)
+	assert.Contains(string(config), fmt.Sprintf("opentracing_load_tracer /my/plugin.so %s/tracer-config.json;", tmpDir))
+}
+
+func TestUnknownTracingVendorFailsStart(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.TracingVendor = "unknown"
+	lb := newNginxWithConf(conf)
+
+	err := lb.Start()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `unknown tracing vendor "unknown", must be one of [datadog jaeger zipkin]`)
+	}
+}
+
+func TestTracingExemplarsAreRecordedFromTracedRequests(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.TracingVendor = "jaeger"
+	conf.TracingExemplars = true
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{{Host: "chris.com", Path: "/path/", ServiceAddress: "foo", ServicePort: 8080}}))
+
+	config, err := ioutil.ReadFile(filepath.Join(tmpDir, "nginx.conf"))
+	assert.NoError(err)
+	assert.Contains(string(config), "log_format exemplar '$server_name $request_time $opentracing_context_uber_trace_id $exemplar_path';")
+	assert.Contains(string(config), fmt.Sprintf("access_log syslog:server=unix:%s/exemplars.sock,nohostname,tag=exemplar exemplar if=$opentracing_context_uber_trace_id;", tmpDir))
+	assert.Contains(string(config), `set $exemplar_path "/path/";`)
+
+	conn, err := net.Dial("unixgram", filepath.Join(tmpDir, "exemplars.sock"))
+	assert.NoError(err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("<190>Oct 16 10:00:00 exemplar: chris.com 0.020 unsampled:2:0:0 /path/"))
+	assert.NoError(err)
+	_, err = conn.Write([]byte("<190>Oct 16 10:00:00 exemplar: chris.com 0.020 5ca1ab1e:2:0:1 /path/"))
+	assert.NoError(err)
+
+	var bucket *dto.Bucket
+	assert.Eventually(func() bool {
+		h := &dto.Metric{}
+		if err := ingressTracedRequestTime.WithLabelValues("chris.com", "/path/").(prometheus.Metric).Write(h); err != nil {
+			return false
+		}
+		for _, b := range h.Histogram.Bucket {
+			if b.Exemplar != nil {
+				bucket = b
+				return h.Histogram.GetSampleCount() == 1
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+	if assert.NotNil(bucket) {
+		assert.Equal(0.05, bucket.GetUpperBound())
+		assert.Equal("trace_id", bucket.Exemplar.Label[0].GetName())
+		assert.Equal("5ca1ab1e", bucket.Exemplar.Label[0].GetValue())
+	}
+	assert.NoError(lb.Stop())
+}
+
+func TestTracingExemplarsNeedATracingVendor(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.OpenTracingPlugin = "/my/plugin.so"
+	conf.TracingExemplars = true
+	lb := newNginxWithConf(conf)
+
+	assert.Error(t, lb.Start())
+}
+
+func TestAddedServersSlowStart(t *testing.T) {
+	assert := assert.New(t)
+	n := &nginxUpdater{Conf: Conf{UpstreamSlowStart: time.Minute}}
+	start := time.Now()
+	apply := func(now time.Time, addresses ...string) []*upstreamServer {
+		entry := controller.IngressEntry{Namespace: "core", Name: "foo", Host: "foo.com", Path: "/",
+			ServiceAddress: "10.254.0.1", ServicePort: 80}
+		for _, address := range addresses {
+			entry.Endpoints = append(entry.Endpoints, controller.Endpoint{Address: address, Port: 8080})
+		}
+		upstreams := createUpstreamEntries(controller.IngressEntries{entry})
+		n.applySlowStart(upstreams, now)
+		return upstreams[0].Servers
+	}
+
+	assert.Equal([]*upstreamServer{{Address: "10.0.0.1:8080"}, {Address: "10.0.0.2:8080"}},
+		apply(start, "10.0.0.1", "10.0.0.2"), "new upstreams can't slow start")
+
+	assert.Equal([]*upstreamServer{{Address: "10.0.0.1:8080", Weight: 10}, {Address: "10.0.0.2:8080", Weight: 10},
+		{Address: "10.0.0.3:8080", Weight: 1}}, apply(start, "10.0.0.1", "10.0.0.2", "10.0.0.3"))
+	assert.True(n.slowStarting())
+
+	assert.Equal([]*upstreamServer{{Address: "10.0.0.2:8080", Weight: 10}, {Address: "10.0.0.3:8080", Weight: 5}},
+		apply(start.Add(30*time.Second), "10.0.0.2", "10.0.0.3"), "removed servers should be dropped")
+
+	assert.Equal([]*upstreamServer{{Address: "10.0.0.2:8080"}, {Address: "10.0.0.3:8080"}},
+		apply(start.Add(time.Minute), "10.0.0.2", "10.0.0.3"))
+	assert.False(n.slowStarting())
+}
+
+func TestSlowStartingServersRampUpToTheirOwnWeight(t *testing.T) {
+	assert := assert.New(t)
+	n := &nginxUpdater{Conf: Conf{UpstreamSlowStart: time.Minute}}
+	start := time.Now()
+	entry := controller.IngressEntry{Namespace: "core", Name: "foo", Host: "foo.com", Path: "/",
+		ServiceAddress: "10.254.0.1", ServicePort: 80, Endpoints: []controller.Endpoint{{Address: "10.0.0.1", Port: 8080}}}
+	n.applySlowStart(createUpstreamEntries(controller.IngressEntries{entry}), start)
+
+	entry.Endpoints = append(entry.Endpoints, controller.Endpoint{Address: "10.0.0.2", Port: 8080, Weight: 4})
+	upstreams := createUpstreamEntries(controller.IngressEntries{entry})
+	n.applySlowStart(upstreams, start.Add(30*time.Second))
+	assert.Equal([]*upstreamServer{{Address: "10.0.0.1:8080", Weight: 10}, {Address: "10.0.0.2:8080", Weight: 1}},
+		upstreams[0].Servers)
+
+	upstreams = createUpstreamEntries(controller.IngressEntries{entry})
+	n.applySlowStart(upstreams, start.Add(time.Minute))
+	assert.Equal([]*upstreamServer{{Address: "10.0.0.1:8080", Weight: 10}, {Address: "10.0.0.2:8080", Weight: 20}},
+		upstreams[0].Servers)
+
+	upstreams = createUpstreamEntries(controller.IngressEntries{entry})
+	n.applySlowStart(upstreams, start.Add(2*time.Minute))
+	assert.Equal([]*upstreamServer{{Address: "10.0.0.1:8080"}, {Address: "10.0.0.2:8080", Weight: 4}},
+		upstreams[0].Servers)
+	assert.False(n.slowStarting())
+}
+
+func TestReplacedServersGetTheirFullShareAtOnce(t *testing.T) {
+	assert := assert.New(t)
+	n := &nginxUpdater{Conf: Conf{UpstreamSlowStart: time.Minute}}
+	now := time.Now()
+	entry := controller.IngressEntry{Namespace: "core", Name: "foo", Host: "foo.com", Path: "/",
+		ServiceAddress: "10.254.0.1", ServicePort: 80}
+	n.applySlowStart(createUpstreamEntries(controller.IngressEntries{entry}), now)
+
+	entry.Endpoints = []controller.Endpoint{{Address: "10.0.0.1", Port: 8080}}
+	upstreams := createUpstreamEntries(controller.IngressEntries{entry})
+	n.applySlowStart(upstreams, now)
+
+	assert.Equal([]*upstreamServer{{Address: "10.0.0.1:8080"}}, upstreams[0].Servers,
+		"pods replacing the service address have nothing to share traffic with")
+	assert.False(n.slowStarting())
+}
+
+func TestHeadlessServicesOfAnIngressGetTheirOwnUpstreams(t *testing.T) {
+	assert := assert.New(t)
+	entries := controller.IngressEntries{
+		{Namespace: "core", Name: "foo", Host: "foo.com", Path: "/a", ServiceAddress: "a.core.svc", ServicePort: 8080,
+			Headless: true, Endpoints: []controller.Endpoint{{Address: "10.0.0.1", Port: 8080},
+				{Address: "10.0.0.2", Port: 8080}}},
+		{Namespace: "core", Name: "foo", Host: "foo.com", Path: "/b", ServiceAddress: "b.core.svc", ServicePort: 8080,
+			Headless: true, Endpoints: []controller.Endpoint{{Address: "10.0.1.1", Port: 8080}}},
+	}
+
+	upstreams := createUpstreamEntries(entries)
+
+	if assert.Len(upstreams, 2) {
+		assert.Equal([]*upstreamServer{{Address: "10.0.0.1:8080"}, {Address: "10.0.0.2:8080"}}, upstreams[0].Servers)
+		assert.Equal([]*upstreamServer{{Address: "10.0.1.1:8080"}}, upstreams[1].Servers)
+	}
+}
+
+func TestRemovedUpstreamsStopSlowStarting(t *testing.T) {
+	assert := assert.New(t)
+	n := &nginxUpdater{Conf: Conf{UpstreamSlowStart: time.Minute}}
+	now := time.Now()
+	apply := func(entries controller.IngressEntries) {
+		n.applySlowStart(createUpstreamEntries(entries), now)
+	}
+	entry := controller.IngressEntry{Namespace: "core", Name: "foo", Host: "foo.com", Path: "/",
+		ServiceAddress: "10.254.0.1", ServicePort: 80, Endpoints: []controller.Endpoint{{Address: "10.0.0.1", Port: 8080}}}
+
+	apply(controller.IngressEntries{entry})
+	entry.Endpoints = append(entry.Endpoints, controller.Endpoint{Address: "10.0.0.2", Port: 8080})
+	apply(controller.IngressEntries{entry})
+	assert.True(n.slowStarting())
+	apply(controller.IngressEntries{})
+	assert.False(n.slowStarting())
+	assert.Empty(n.serverAdditions)
+}
+
+func TestUpstreamsHaveTheirEndpointsWithSlowStartWeights(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.UpstreamSlowStart = time.Hour
+	lb := newNginxWithConf(conf)
+	entry := controller.IngressEntry{Namespace: "core", Name: "foo", Host: "foo.com", Path: "/",
+		ServiceAddress: "10.254.0.1", ServicePort: 80, Endpoints: []controller.Endpoint{{Address: "10.0.0.1", Port: 8080}}}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{entry}))
+	config, err := ioutil.ReadFile(filepath.Join(tmpDir, "nginx.conf"))
+	assert.NoError(err)
+	assert.Contains(string(config), "    upstream core.foo.10.254.0.1.80 {\n"+
+		"        server 10.0.0.1:8080 max_conns=0;\n"+
+		"        keepalive 1024;\n")
+
+	entry.Endpoints = append(entry.Endpoints, controller.Endpoint{Address: "10.0.0.2", Port: 8080})
+	assert.NoError(lb.Update([]controller.IngressEntry{entry}))
+	config, err = ioutil.ReadFile(filepath.Join(tmpDir, "nginx.conf"))
+	assert.NoError(err)
+	assert.Contains(string(config), "    upstream core.foo.10.254.0.1.80 {\n"+
+		"        server 10.0.0.1:8080 max_conns=0 weight=10;\n"+
+		"        server 10.0.0.2:8080 max_conns=0 weight=1;\n"+
+		"        keepalive 1024;\n")
+	assert.NotContains(string(config), "10.254.0.1:80", "the service address isn't used while there are endpoints")
+	assert.Nil(lb.Stop())
+}
+
+func TestEndpointsInOtherZonesAreBackupServers(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entry := controller.IngressEntry{Namespace: "core", Name: "foo", Host: "foo.com", Path: "/",
+		ServiceAddress: "10.254.0.1", ServicePort: 80, Endpoints: []controller.Endpoint{{Address: "10.0.0.1", Port: 8080},
+			{Address: "10.0.0.2", Port: 8080, Backup: true}}}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{entry}))
+	config, err := ioutil.ReadFile(filepath.Join(tmpDir, "nginx.conf"))
+	assert.NoError(err)
+	assert.Contains(string(config), "    upstream core.foo.10.254.0.1.80 {\n"+
+		"        server 10.0.0.1:8080 max_conns=0;\n"+
+		"        server 10.0.0.2:8080 max_conns=0 backup;\n"+
+		"        keepalive 1024;\n")
+	assert.Nil(lb.Stop())
+}
+
 func TestReloadMetricIsIncremented(t *testing.T) {
 	assert := assert.New(t)
 	tmpDir := setupWorkDir(t)
@@ -186,6 +553,184 @@ func TestReloadMetricIsIncremented(t *testing.T) {
 
 	assert.True(nginxHasReloaded(tmpDir))
 	assert.Equal(float64(1), testutil.ToFloat64(reloads))
+	assert.Equal(uint64(1), histogramCount(reloadDuration))
+	assert.True(histogramCount(configRenderDuration) >= 3, "config should have been rendered for each update")
+	assert.True(histogramCount(configCheckDuration) >= 1, "config should have been checked")
+}
+
+func histogramCount(h prometheus.Histogram) uint64 {
+	var metric dto.Metric
+	h.Write(&metric)
+	return metric.Histogram.GetSampleCount()
+}
+
+func TestParentPidIsParsedFromProcStat(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(1234, parentPid([]byte("4321 (nginx) S 1234 4321 4321 0 -1 4194624")))
+	assert.Equal(1234, parentPid([]byte("4321 (nginx: (worker)) S 1234 4321 4321 0 -1 4194624")))
+	assert.Equal(-1, parentPid([]byte("4321 (nginx)")))
+}
+
+func TestPidIsReadFromPidFile(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	pidFile := tmpDir + "/nginx.pid"
+
+	_, err := readPidFile(pidFile)
+	assert.Error(err, "pid file doesn't exist yet")
+
+	assert.NoError(ioutil.WriteFile(pidFile, []byte("1234\n"), 0644))
+	pid, err := readPidFile(pidFile)
+	assert.NoError(err)
+	assert.Equal(1234, pid)
+}
+
+func TestConfPidAndTempPathsCanBeOutsideTheWorkingDir(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	confDir, runDir := filepath.Join(tmpDir, "conf"), filepath.Join(tmpDir, "run")
+	assert.NoError(os.Mkdir(confDir, 0755))
+	assert.NoError(os.Mkdir(runDir, 0755))
+	conf := newConf(tmpDir, fakeNginx)
+	conf.ConfDir = confDir
+	conf.PidPath = filepath.Join(runDir, "nginx.pid")
+	conf.TempDir = filepath.Join(tmpDir, "temp")
+	conf.ProxyTempPath = "/buffers"
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{{Host: "james.com", Path: "/", ServiceAddress: "foo",
+		ServicePort: 8080}}))
+	config, err := ioutil.ReadFile(filepath.Join(confDir, "nginx.conf"))
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	assert.NoFileExists(filepath.Join(tmpDir, "nginx.conf"))
+	assert.Contains(string(config), "pid "+filepath.Join(runDir, "nginx.pid")+";")
+	assert.Contains(string(config), "    client_body_temp_path "+filepath.Join(tmpDir, "temp", "client_body_temp")+";\n"+
+		"    proxy_temp_path /buffers;\n"+
+		"    fastcgi_temp_path "+filepath.Join(tmpDir, "temp", "fastcgi_temp")+";\n")
+}
+
+func TestTempPathsAreCompiledInByDefault(t *testing.T) {
+	assert.Empty(t, Conf{}.TempPaths())
+}
+
+func TestUpgradeFailsIfNginxIsNotRunning(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+
+	assert.Error(lb.(Upgrader).Upgrade())
+}
+
+func TestAccessLogIsRotatedAndOldLogsRemoved(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "access_log_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpDir)
+	start := time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(ioutil.WriteFile(tmpDir+"/access.log", []byte("GET /"), 0644))
+		assert.NoError(rotateAccessLog(tmpDir, start.Add(time.Duration(i)*time.Hour)))
+	}
+	assert.NoError(removeOldAccessLogs(tmpDir, 2))
+
+	files, err := filepath.Glob(tmpDir + "/access.log*")
+	assert.NoError(err)
+	assert.Equal([]string{
+		tmpDir + "/access.log.20190102160405",
+		tmpDir + "/access.log.20190102170405",
+	}, files)
+}
+
+func TestMissingAccessLogIsOnlyReopenedOnce(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "access_log_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpDir)
+	signals := tmpDir + "/signals"
+	fakeMaster := exec.Command("sh", "-c", "trap 'echo USR1 >> "+signals+"' USR1; while true; do sleep 0.01; done")
+	assert.NoError(fakeMaster.Start())
+	defer fakeMaster.Process.Kill()
+	// signals sent together are merged, so give the fake master time to handle each
+	signalWait := time.Millisecond * 100
+	time.Sleep(signalWait)
+	lb := &nginxUpdater{Conf: Conf{AccessLogDir: tmpDir}, nginx: &nginx{Cmd: fakeMaster}}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		_, err = lb.rotateAccessLogIfRequired(now, now)
+		assert.NoError(err)
+	}
+	time.Sleep(signalWait)
+	assert.NoError(ioutil.WriteFile(tmpDir+"/access.log", []byte("GET /"), 0644))
+	_, err = lb.rotateAccessLogIfRequired(now, now)
+	assert.NoError(err)
+	assert.NoError(os.Remove(tmpDir + "/access.log"))
+	_, err = lb.rotateAccessLogIfRequired(now, now)
+	assert.NoError(err)
+	time.Sleep(signalWait)
+
+	received, err := ioutil.ReadFile(signals)
+	assert.NoError(err)
+	assert.Equal("USR1\nUSR1\n", string(received), "should signal once for each time the access log goes missing")
+}
+
+func TestAllRotatedAccessLogsAreKeptWithoutMaxFiles(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "access_log_test")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpDir)
+	assert.NoError(ioutil.WriteFile(tmpDir+"/access.log.20190102150405", []byte("GET /"), 0644))
+
+	assert.NoError(removeOldAccessLogs(tmpDir, 0))
+
+	_, err = os.Stat(tmpDir + "/access.log.20190102150405")
+	assert.NoError(err)
+}
+
+func TestErrorLogEventsAreCounted(t *testing.T) {
+	assert := assert.New(t)
+	initMetrics()
+	connectFailures := errorLogEvents.WithLabelValues(upstreamConnectFailureEvent, "error")
+	sslErrors := errorLogEvents.WithLabelValues(sslHandshakeErrorEvent, "info")
+	workerCrashes := errorLogEvents.WithLabelValues(workerCrashEvent, "alert")
+	initialConnectFailures := metricValue(connectFailures)
+	initialSSLErrors := metricValue(sslErrors)
+	initialWorkerCrashes := metricValue(workerCrashes)
+
+	recordErrorLogEvent("2019/01/02 15:04:05 [error] 7#7: *1 connect() failed (111: Connection refused) " +
+		"while connecting to upstream, client: 10.0.0.1, server: foo.com")
+	recordErrorLogEvent("2019/01/02 15:04:05 [info] 7#7: *2 SSL_do_handshake() failed " +
+		"(SSL: error:1417A0C1:SSL routines:tls_post_process_client_hello:no shared cipher) while SSL handshaking")
+	recordErrorLogEvent("2019/01/02 15:04:05 [alert] 6#6: worker process 7 exited on signal 11")
+	recordErrorLogEvent("2019/01/02 15:04:05 [notice] 6#6: signal process started")
+	recordErrorLogEvent("while connecting to upstream")
+
+	assert.Equal(initialConnectFailures+1, metricValue(connectFailures))
+	assert.Equal(initialSSLErrors+1, metricValue(sslErrors))
+	assert.Equal(initialWorkerCrashes+1, metricValue(workerCrashes))
+}
+
+func TestUpstreamEjectionsAreCounted(t *testing.T) {
+	assert := assert.New(t)
+	initMetrics()
+	ejections := upstreamEjections.WithLabelValues("10.0.0.1:8080")
+	initialEjections := metricValue(ejections)
+
+	recordErrorLogEvent("2019/01/02 15:04:05 [warn] 7#7: *1 upstream server temporarily disabled while reading response " +
+		"header from upstream, client: 10.1.0.1, server: foo.com, request: \"GET / HTTP/1.1\", " +
+		"upstream: \"http://10.0.0.1:8080/\", host: \"foo.com\"")
+	recordErrorLogEvent("2019/01/02 15:04:05 [error] 7#7: *2 connect() failed (111: Connection refused) " +
+		"while connecting to upstream, client: 10.1.0.1, server: foo.com, upstream: \"http://10.0.0.1:8080/\"")
+
+	assert.Equal(initialEjections+1, metricValue(ejections))
 }
 
 func nginxHasStarted(tmpDir string) bool {
@@ -287,10 +832,28 @@ func TestNginxConfig(t *testing.T) {
 	enabledAccessLogConf := defaultConf
 	enabledAccessLogConf.AccessLog = true
 	enabledAccessLogConf.AccessLogDir = "/nginx-access-log"
+	enabledAccessLogConf.AccessLogBufferSizeKB = 32
+	enabledAccessLogConf.AccessLogFlushInterval = time.Minute
+
+	tunedAccessLogConf := enabledAccessLogConf
+	tunedAccessLogConf.AccessLogBufferSizeKB = 256
+	tunedAccessLogConf.AccessLogFlushInterval = 5 * time.Second
+
+	unbufferedAccessLogConf := enabledAccessLogConf
+	unbufferedAccessLogConf.AccessLogBufferSizeKB = 0
 
 	sslEndpointConf := defaultConf
 	sslEndpointConf.Ports = []Port{{Name: "https", Port: 443}}
 
+	bindAddressConf := defaultConf
+	bindAddressConf.IngressBindAddress = "10.0.0.1"
+
+	ipv6BindAddressConf := defaultConf
+	ipv6BindAddressConf.IngressBindAddress = "fd00::1"
+
+	ipv6Conf := sslEndpointConf
+	ipv6Conf.IPv6 = true
+
 	logHeadersConf := defaultConf
 	logHeadersConf.LogHeaders = []string{"Content-Type", "Authorization"}
 
@@ -298,6 +861,9 @@ func TestNginxConfig(t *testing.T) {
 	opentracingConf.OpenTracingPlugin = "/my/plugin.so"
 	opentracingConf.OpenTracingConfig = "/etc/my/config.json"
 
+	geoIPConf := defaultConf
+	geoIPConf.GeoIPDatabase = "/geoip/GeoLite2-Country.mmdb"
+
 	httpConf := defaultConf
 	httpConf.ClientHeaderBufferSize = 16
 	httpConf.ClientBodyBufferSize = 16
@@ -310,9 +876,32 @@ func TestNginxConfig(t *testing.T) {
 	workerShutdowntimeoutConf := defaultConf
 	workerShutdowntimeoutConf.WorkerShutdownTimeoutSeconds = 10
 
+	workerTuningConf := defaultConf
+	workerTuningConf.WorkerRlimitNofile = 65536
+	workerTuningConf.MultiAccept = false
+	workerTuningConf.UseEpoll = false
+	workerTuningConf.ResetTimedoutConnection = true
+
 	noVhostStatsRequestBucketsConf := defaultConf
 	noVhostStatsRequestBucketsConf.VhostStatsRequestBuckets = nil
 
+	requestSizesConf := defaultConf
+	requestSizesConf.MetricsRequestSizes = true
+
+	http2Conf := defaultConf
+	http2Conf.Ports = []Port{{Name: "http", Port: 80}, {Name: "https", Port: 443}}
+	http2Conf.HTTP2 = true
+
+	perPortConf := defaultConf
+	perPortConf.Ports = []Port{
+		{Name: "http", Port: 80, ProxyProtocol: true},
+		{Name: "https", Port: 443, HTTP2: true},
+		{Name: "nlb-https", Port: 8443, SSL: true, ProxyProtocol: true},
+	}
+	unixSocketConf := defaultConf
+	unixSocketConf.ProxyProtocol = true
+	unixSocketConf.UnixSocket = "/var/run/feed/ingress.sock"
+
 	var tests = []struct {
 		name             string
 		conf             Conf
@@ -406,6 +995,20 @@ func TestNginxConfig(t *testing.T) {
 				"access_log /nginx-access-log/access.log upstream_info buffer=32k flush=1m;",
 			},
 		},
+		{
+			"Access log buffer and flush interval can be configured",
+			tunedAccessLogConf,
+			[]string{
+				"access_log /nginx-access-log/access.log upstream_info buffer=256k flush=5s;",
+			},
+		},
+		{
+			"Access logs are unbuffered if buffer size is 0",
+			unbufferedAccessLogConf,
+			[]string{
+				"access_log /nginx-access-log/access.log upstream_info;",
+			},
+		},
 		{
 			"Access logs use custom headers when enabled",
 			logHeadersConf,
@@ -420,6 +1023,37 @@ func TestNginxConfig(t *testing.T) {
 				"listen 443 ssl default_server;",
 			},
 		},
+		{
+			"Ingress ports listen on all IPv4 addresses by default",
+			defaultConf,
+			[]string{
+				"listen 9090 default_server;",
+				"!listen [::]",
+			},
+		},
+		{
+			"Ingress ports can be bound to a specific address",
+			bindAddressConf,
+			[]string{
+				"listen 10.0.0.1:9090 default_server;",
+				"listen 0 default_server reuseport;",
+			},
+		},
+		{
+			"Ingress ports can be bound to a specific IPv6 address",
+			ipv6BindAddressConf,
+			[]string{
+				"listen [fd00::1]:9090 default_server;",
+			},
+		},
+		{
+			"Ingress ports also listen on IPv6 when enabled",
+			ipv6Conf,
+			[]string{
+				"listen 443 ssl default_server;",
+				"listen [::]:443 ssl default_server;",
+			},
+		},
 		{
 			"Vhost stats module has 1 MiB of shared memory",
 			defaultConf,
@@ -449,28 +1083,52 @@ func TestNginxConfig(t *testing.T) {
 			},
 		},
 		{
-			"Adds client headers buffer size attribute",
-			httpConf,
+			"GeoIP module is loaded",
+			geoIPConf,
 			[]string{
-				"client_header_buffer_size 16k;",
+				"load_module modules/ngx_http_geoip2_module.so;",
+				"geoip2 /geoip/GeoLite2-Country.mmdb {",
+				"$geoip2_country_code country iso_code;",
 			},
 		},
 		{
-			"Adds client body buffer size attribute",
-			httpConf,
+			"GeoIP country is logged",
+			geoIPConf,
 			[]string{
-				"client_body_buffer_size 16k;",
+				"' cc=\"$geoip2_country_code\"';",
 			},
 		},
 		{
-			"Adds large client header buffer attribute",
-			httpConf,
+			"GeoIP module isn't loaded by default",
+			defaultConf,
 			[]string{
-				"large_client_header_buffers 4 16k;",
+				"!ngx_http_geoip2_module",
+				"!geoip2_country_code",
 			},
 		},
 		{
-			"client headers buffer size attribute not present if not passed in",
+			"Adds client headers buffer size attribute",
+			httpConf,
+			[]string{
+				"client_header_buffer_size 16k;",
+			},
+		},
+		{
+			"Adds client body buffer size attribute",
+			httpConf,
+			[]string{
+				"client_body_buffer_size 16k;",
+			},
+		},
+		{
+			"Adds large client header buffer attribute",
+			httpConf,
+			[]string{
+				"large_client_header_buffers 4 16k;",
+			},
+		},
+		{
+			"client headers buffer size attribute not present if not passed in",
 			defaultConf,
 			[]string{
 				"!client_header_buffer_size",
@@ -511,6 +1169,26 @@ func TestNginxConfig(t *testing.T) {
 				"worker_shutdown_timeout 10;",
 			},
 		},
+		{
+			"Default worker tuning",
+			defaultConf,
+			[]string{
+				"!worker_rlimit_nofile",
+				"multi_accept on;",
+				"use epoll;",
+				"reset_timedout_connection off;",
+			},
+		},
+		{
+			"Worker tuning can be configured",
+			workerTuningConf,
+			[]string{
+				"worker_rlimit_nofile 65536;",
+				"multi_accept off;",
+				"!use epoll;",
+				"reset_timedout_connection on;",
+			},
+		},
 		{
 			"Vhost stats request buckets set if provided",
 			defaultConf,
@@ -523,6 +1201,67 @@ func TestNginxConfig(t *testing.T) {
 				"!vhost_traffic_status_histogram_buckets",
 			},
 		},
+		{
+			"Request sizes are counted by vhost stats if enabled",
+			requestSizesConf,
+			[]string{
+				"map $request_length $request_size_bucket {",
+				"\"~^(\\d{4}|10000)$\"      10000;",
+				"::$request_size_bucket request_size@$server_name;",
+			},
+		},
+		{
+			"HTTP/2 is accepted on https ports if enabled",
+			http2Conf,
+			[]string{
+				"listen 443 ssl http2;",
+				"listen 443 ssl http2 default_server;",
+				"!listen 80 http2",
+			},
+		},
+		{
+			"Ports have their own PROXY protocol, TLS and HTTP/2 settings",
+			perPortConf,
+			[]string{
+				"listen 80 proxy_protocol;",
+				"listen 443 ssl http2;",
+				"listen 8443 ssl proxy_protocol;",
+				"listen 80 default_server;",
+				"listen 443 ssl http2 default_server;",
+				"listen 8443 ssl default_server;",
+			},
+		},
+		{
+			"Can serve ingress traffic on a unix socket without the PROXY protocol",
+			unixSocketConf,
+			[]string{
+				"listen unix:/var/run/feed/ingress.sock;",
+				"listen unix:/var/run/feed/ingress.sock default_server;",
+				"set_real_ip_from unix:;",
+				"!listen [::]:unix",
+			},
+		},
+		{
+			"Doesn't serve on a unix socket by default",
+			defaultConf,
+			[]string{
+				"!unix:",
+			},
+		},
+		{
+			"HTTP/2 isn't accepted by default",
+			defaultConf,
+			[]string{
+				"!http2",
+			},
+		},
+		{
+			"Request sizes are not counted by default",
+			defaultConf,
+			[]string{
+				"!$request_size_bucket",
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -561,6 +1300,19 @@ func TestNginxIngressEntries(t *testing.T) {
 	sslEndpointConf := defaultConf
 	sslEndpointConf.Ports = []Port{{Name: "https", Port: 443}}
 
+	globalDenyConf := defaultConf
+	globalDenyConf.GlobalDeny = []string{"192.0.2.0/24", "198.51.100.7"}
+
+	geoIPConf := defaultConf
+	geoIPConf.GeoIPDatabase = "/geoip/GeoLite2-Country.mmdb"
+
+	keepaliveCapConf := defaultConf
+	keepaliveCapConf.MaxBackendKeepalives = 256
+
+	tracingConf := defaultConf
+	tracingConf.OpenTracingPlugin = "/my/plugin.so"
+	tracingConf.OpenTracingConfig = "/etc/my/config.json"
+
 	var tests = []struct {
 		name            string
 		config          Conf
@@ -736,6 +1488,247 @@ func TestNginxIngressEntries(t *testing.T) {
 					"            deny all;\n",
 			},
 		},
+		{
+			"Check global deny is before the allows",
+			globalDenyConf,
+			[]controller.IngressEntry{
+				{
+					Host:           "foo.com",
+					Namespace:      "core",
+					Name:           "foo-ingress",
+					Path:           "/path",
+					ServiceAddress: "service",
+					ServicePort:    9090,
+					Allow:          []string{"0.0.0.0/0"},
+				},
+			},
+			nil,
+			[]string{
+				"            proxy_buffers 0 0k;\n" +
+					"\n" +
+					"            # Deny globally blocked clients, regardless of the ingress's allow list.\n" +
+					"            deny 192.0.2.0/24;\n" +
+					"            deny 198.51.100.7;\n" +
+					"\n" +
+					"            # Allow localhost for debugging\n" +
+					"            allow 127.0.0.1;\n" +
+					"\n" +
+					"            # Restrict clients\n" +
+					"            allow 0.0.0.0/0;\n",
+			},
+		},
+		{
+			"Check countries are restricted before the allows",
+			geoIPConf,
+			[]controller.IngressEntry{
+				{
+					Host:           "foo.com",
+					Namespace:      "core",
+					Name:           "foo-ingress",
+					Path:           "/path",
+					ServiceAddress: "service",
+					ServicePort:    9090,
+					Allow:          []string{"0.0.0.0/0"},
+					AllowCountries: []string{"GB", "IE"},
+					DenyCountries:  []string{"FR"},
+				},
+			},
+			nil,
+			[]string{
+				"            proxy_buffers 0 0k;\n" +
+					"\n" +
+					"            # Deny clients from these countries.\n" +
+					"            if ($geoip2_country_code ~ ^(FR)$) {\n" +
+					"                return 403;\n" +
+					"            }\n" +
+					"\n" +
+					"            # Only allow clients from these countries.\n" +
+					"            if ($geoip2_country_code !~ ^(GB|IE)$) {\n" +
+					"                return 403;\n" +
+					"            }\n" +
+					"\n" +
+					"            # Allow localhost for debugging\n",
+			},
+		},
+		{
+			"Check countries are ignored without a GeoIP database",
+			defaultConf,
+			[]controller.IngressEntry{
+				{
+					Host:           "foo.com",
+					Namespace:      "core",
+					Name:           "foo-ingress",
+					Path:           "/path",
+					ServiceAddress: "service",
+					ServicePort:    9090,
+					Allow:          []string{"0.0.0.0/0"},
+					DenyCountries:  []string{"FR"},
+				},
+			},
+			nil,
+			[]string{
+				"            proxy_buffers 0 0k;\n" +
+					"\n" +
+					"            # Allow localhost for debugging\n",
+			},
+		},
+		{
+			"Check tracing can be disabled or sampled per location",
+			tracingConf,
+			[]controller.IngressEntry{
+				{
+					Host:           "foo.com",
+					Namespace:      "core",
+					Name:           "disabled",
+					Path:           "/disabled",
+					ServiceAddress: "service",
+					ServicePort:    9090,
+					DisableTracing: true,
+				},
+				{
+					Host:              "bar.com",
+					Namespace:         "core",
+					Name:              "sampled",
+					Path:              "/sampled",
+					ServiceAddress:    "service",
+					ServicePort:       9090,
+					TracingSampleRate: 0.125,
+				},
+				{
+					Host:              "bar.com",
+					Namespace:         "core",
+					Name:              "also-sampled",
+					Path:              "/also-sampled",
+					ServiceAddress:    "service",
+					ServicePort:       9090,
+					TracingSampleRate: 0.125,
+				},
+			},
+			nil,
+			[]string{
+				"            proxy_pass http://core.sampled.service.9090;\n" +
+					"\n" +
+					"            # Only trace a sample of requests.\n" +
+					"            opentracing_tag sampling.priority $tracing_sample_12_5;\n" +
+					"\n" +
+					"            # Set display name for vhost stats.\n",
+				"            proxy_pass http://core.disabled.service.9090;\n" +
+					"\n" +
+					"            # Exclude from tracing.\n" +
+					"            opentracing off;\n" +
+					"\n" +
+					"            # Set display name for vhost stats.\n",
+			},
+		},
+		{
+			"Check tracing annotations are ignored without OpenTracing",
+			defaultConf,
+			[]controller.IngressEntry{
+				{
+					Host:           "foo.com",
+					Namespace:      "core",
+					Name:           "disabled",
+					Path:           "/disabled",
+					ServiceAddress: "service",
+					ServicePort:    9090,
+					DisableTracing: true,
+				},
+			},
+			nil,
+			[]string{
+				"            proxy_pass http://core.disabled.service.9090;\n" +
+					"\n" +
+					"            # Set display name for vhost stats.\n",
+			},
+		},
+		{
+			"Check upstream servers can be ejected after failures",
+			defaultConf,
+			[]controller.IngressEntry{
+				{
+					Host:               "foo.com",
+					Namespace:          "core",
+					Name:               "foo-ingress",
+					Path:               "/path",
+					ServiceAddress:     "service",
+					ServicePort:        9090,
+					BackendMaxFails:    3,
+					BackendFailTimeout: 30 * time.Second,
+				},
+			},
+			[]string{
+				"    upstream core.foo-ingress.service.9090 {\n" +
+					"        server service:9090 max_conns=0 max_fails=3 fail_timeout=30s;\n" +
+					"        keepalive 1024;\n" +
+					"        keepalive_requests 1024;\n" +
+					"    }",
+			},
+			nil,
+		},
+		{
+			"Check backup services are used when the backend is unavailable",
+			defaultConf,
+			[]controller.IngressEntry{
+				{
+					Host:                 "foo.com",
+					Namespace:            "core",
+					Name:                 "foo-ingress",
+					Path:                 "/path",
+					ServiceAddress:       "service",
+					ServicePort:          9090,
+					BackupServiceAddress: "fallback",
+					BackupServicePort:    8080,
+					BackendMaxFails:      3,
+				},
+			},
+			[]string{
+				"    upstream core.foo-ingress.service.9090 {\n" +
+					"        server service:9090 max_conns=0 max_fails=3;\n" +
+					"        # Only used when the servers above are unavailable.\n" +
+					"        server fallback:8080 max_conns=0 max_fails=3 backup;\n" +
+					"        keepalive 1024;\n" +
+					"        keepalive_requests 1024;\n" +
+					"    }",
+			},
+			nil,
+		},
+		{
+			"Check keepalive count can be set per upstream up to the cap",
+			keepaliveCapConf,
+			[]controller.IngressEntry{
+				{
+					Host:                  "foo.com",
+					Namespace:             "core",
+					Name:                  "bar-ingress",
+					Path:                  "/bar",
+					ServiceAddress:        "service",
+					ServicePort:           9090,
+					BackendKeepaliveCount: 32,
+				},
+				{
+					Host:                  "foo.com",
+					Namespace:             "core",
+					Name:                  "foo-ingress",
+					Path:                  "/foo",
+					ServiceAddress:        "service",
+					ServicePort:           9090,
+					BackendKeepaliveCount: 2048,
+				},
+			},
+			[]string{
+				"    upstream core.bar-ingress.service.9090 {\n" +
+					"        server service:9090 max_conns=0;\n" +
+					"        keepalive 32;\n" +
+					"        keepalive_requests 1024;\n" +
+					"    }",
+				"    upstream core.foo-ingress.service.9090 {\n" +
+					"        server service:9090 max_conns=0;\n" +
+					"        keepalive 256;\n" +
+					"        keepalive_requests 1024;\n" +
+					"    }",
+			},
+			nil,
+		},
 		{
 			"Check nil allow works",
 			defaultConf,
@@ -1296,32 +2289,1450 @@ func TestNginxIngressEntries(t *testing.T) {
 		},
 	}
 
-	for _, test := range tests {
-		fmt.Printf("\n=== test: %s\n", test.name)
+	for _, test := range tests {
+		fmt.Printf("\n=== test: %s\n", test.name)
+
+		lb := newNginxWithConf(test.config)
+
+		assert.NoError(lb.Start())
+		entries := test.entries
+		err := lb.Update(entries)
+		assert.NoError(err)
+
+		config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+		assert.NoError(err)
+		configContents := string(config)
+
+		if test.upstreamEntries != nil {
+			assertConfigEntries(t, test.name, "upstream", `(?sU)(    upstream.+\n    })`, test.upstreamEntries, configContents)
+		}
+		if test.serverEntries != nil {
+			assertConfigEntries(t, test.name, "server", `(?sU)(# ingress:.+server.+\n    })`, test.serverEntries, configContents)
+		}
+		assert.Nil(lb.Stop())
+
+		if t.Failed() {
+			t.FailNow()
+		}
+	}
+}
+
+func TestSSLPassthroughRoutesBySNI(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Ports = []Port{{Name: "http", Port: 80}, {Name: "https", Port: 443}}
+	conf.SSLPassthroughPort = 8444
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{
+			Host:           "secure.com",
+			Namespace:      "core",
+			Name:           "secure-ingress",
+			Path:           "/",
+			ServiceAddress: "secure-service",
+			ServicePort:    8443,
+			SSLPassthrough: true,
+		},
+		{
+			Host:           "foo.com",
+			Namespace:      "core",
+			Name:           "foo-ingress",
+			Path:           "/",
+			ServiceAddress: "foo-service",
+			ServicePort:    8080,
+		},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	configContents := string(config)
+	assert.NoError(lb.Stop())
+
+	socket := tmpDir + "/ssl_passthrough.sock"
+	for _, expected := range []string{
+		"map $ssl_preread_server_name $ssl_passthrough_upstream_443 {\n        hostnames;\n" +
+			"        secure.com ssl_passthrough;\n        default ssl_termination_443;",
+		"    upstream ssl_termination_443 {\n        server 127.0.0.1:8444;\n    }",
+		"map $ssl_preread_server_name $ssl_passthrough_backend {\n        hostnames;\n" +
+			"        secure.com core.secure-ingress.secure-service.8443;",
+		"        server 127.0.0.1:8444;",
+		"        server unix:" + socket + ";",
+		"        server secure-service:8443;",
+		"        listen 443;\n        ssl_preread on;\n        proxy_pass $ssl_passthrough_upstream_443;\n" +
+			"        proxy_protocol on;",
+		"        listen unix:" + socket + " proxy_protocol;\n        set_real_ip_from unix:;\n" +
+			"        ssl_preread on;\n        proxy_pass $ssl_passthrough_backend;\n    }",
+		"        listen 127.0.0.1:8444 ssl proxy_protocol;",
+		"        listen 127.0.0.1:8444 ssl proxy_protocol default_server;",
+		"        listen 80;",
+		"proxy_pass http://core.foo-ingress.foo-service.8080;",
+	} {
+		assert.Contains(configContents, expected)
+	}
+	assert.NotContains(configContents, "listen 443 ssl")
+	assert.NotContains(configContents, "proxy_pass http://core.secure-ingress")
+
+	passthroughServer := configContents[strings.Index(configContents, "listen unix:"+socket):]
+	passthroughServer = passthroughServer[:strings.Index(passthroughServer, "}")]
+	assert.NotContains(passthroughServer, "proxy_protocol on", "passthrough backends shouldn't get a PROXY header")
+}
+
+func TestSSLPassthroughIsScopedToTheSSLPortsOfItsScheme(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Ports = []Port{
+		{Name: "https", Port: 443, SSL: true, Scheme: "internet-facing"},
+		{Name: "https", Port: 8443, SSL: true, Scheme: "internal"},
+	}
+	conf.SSLPassthroughPort = 8444
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{
+			Host:           "secure.com",
+			Namespace:      "core",
+			Name:           "secure-ingress",
+			Path:           "/",
+			ServiceAddress: "secure-service",
+			ServicePort:    8443,
+			SSLPassthrough: true,
+			LbScheme:       "internal",
+		},
+		{
+			Host:           "foo.com",
+			Namespace:      "core",
+			Name:           "foo-internet-facing",
+			Path:           "/",
+			ServiceAddress: "foo-service",
+			ServicePort:    8080,
+			LbScheme:       "internet-facing",
+		},
+		{
+			Host:           "foo.com",
+			Namespace:      "core",
+			Name:           "foo-internal",
+			Path:           "/internal/",
+			ServiceAddress: "foo-internal-service",
+			ServicePort:    8080,
+			LbScheme:       "internal",
+		},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	configContents := string(config)
+	assert.NoError(lb.Stop())
+
+	for _, expected := range []string{
+		"map $ssl_preread_server_name $ssl_passthrough_upstream_443 {\n        hostnames;\n" +
+			"        default ssl_termination_443;",
+		"map $ssl_preread_server_name $ssl_passthrough_upstream_8443 {\n        hostnames;\n" +
+			"        secure.com ssl_passthrough;\n        default ssl_termination_8443;",
+		"    upstream ssl_termination_443 {\n        server 127.0.0.1:8444;\n    }",
+		"    upstream ssl_termination_8443 {\n        server 127.0.0.1:8445;\n    }",
+		"        listen 443;\n        ssl_preread on;\n        proxy_pass $ssl_passthrough_upstream_443;",
+		"        listen 8443;\n        ssl_preread on;\n        proxy_pass $ssl_passthrough_upstream_8443;",
+	} {
+		assert.Contains(configContents, expected)
+	}
+	for _, port := range []string{"8444", "8445"} {
+		assert.Equal(1, strings.Count(configContents, "listen 127.0.0.1:"+port+" ssl proxy_protocol default_server;"),
+			"each ssl port should have its own default server")
+		assert.Equal(1, strings.Count(configContents, "listen 127.0.0.1:"+port+" ssl proxy_protocol;"),
+			"foo.com should be served once on each ssl port")
+	}
+}
+
+func TestSSLPassthroughListensOnIPv6(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Ports = []Port{{Name: "https", Port: 443}}
+	conf.IPv6 = true
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{
+			Host:           "*.secure.com",
+			Namespace:      "core",
+			Name:           "secure-ingress",
+			Path:           "/",
+			ServiceAddress: "secure-service",
+			ServicePort:    8443,
+			SSLPassthrough: true,
+		},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	assert.Contains(string(config), "        listen 443;\n        listen [::]:443;\n        ssl_preread on;")
+	assert.Contains(string(config), "        *.secure.com ssl_passthrough;")
+}
+
+func TestSSLPassthroughIsIgnoredWithoutHTTPSPort(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entries := []controller.IngressEntry{
+		{
+			Host:           "secure.com",
+			Namespace:      "core",
+			Name:           "secure-ingress",
+			Path:           "/",
+			ServiceAddress: "secure-service",
+			ServicePort:    8443,
+			SSLPassthrough: true,
+		},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	assert.NotContains(string(config), "stream {")
+	assert.NotContains(string(config), "secure-service")
+}
+
+func writeCertificate(t *testing.T, dir, name string, hosts ...string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     hosts,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	crt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".crt"), crt, 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), []byte("key"), 0600))
+}
+
+func TestCertificatesAreSelectedByHost(t *testing.T) {
+	assert := assert.New(t)
+	certDir, err := ioutil.TempDir(os.TempDir(), "certs")
+	assert.NoError(err)
+	defer os.RemoveAll(certDir)
+	writeCertificate(t, certDir, "wildcard", "*.example.com")
+	writeCertificate(t, certDir, "foo", "foo.example.com", "foo.org")
+	assert.NoError(ioutil.WriteFile(filepath.Join(certDir, "nokey.crt"), []byte("not used"), 0644))
+
+	certs, err := loadCertificates(certDir)
+	assert.NoError(err)
+
+	assert.Len(certs, 2)
+	assert.Equal(filepath.Join(certDir, "foo"), selectCertificate(certs, "foo.example.com"))
+	assert.Equal(filepath.Join(certDir, "foo"), selectCertificate(certs, "FOO.org"))
+	assert.Equal(filepath.Join(certDir, "wildcard"), selectCertificate(certs, "bar.example.com"))
+	assert.Equal("", selectCertificate(certs, "bar.baz.example.com"))
+	assert.Equal("", selectCertificate(certs, "other.com"))
+}
+
+func TestServersUseCertificateForTheirHost(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	certDir, err := ioutil.TempDir(os.TempDir(), "certs")
+	assert.NoError(err)
+	defer os.RemoveAll(certDir)
+	writeCertificate(t, certDir, "foo", "foo.com")
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Ports = []Port{{Name: "https", Port: 443}}
+	conf.SSLPath = "/etc/ssl/default"
+	conf.SSLCertificatesDir = certDir
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8080},
+		{Host: "bar.com", Namespace: "core", Name: "bar", Path: "/", ServiceAddress: "bar", ServicePort: 8080},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Regexp("(?s)server_name foo.com;\\s+# https.+?ssl_certificate "+regexp.QuoteMeta(certDir)+"/foo.crt;", configContents)
+	assert.Regexp("(?s)server_name bar.com;\\s+# https.+?ssl_certificate /etc/ssl/default.crt;", configContents)
+}
+
+func TestSessionTicketKeysAreLoadedInOrder(t *testing.T) {
+	assert := assert.New(t)
+	keysDir, err := ioutil.TempDir(os.TempDir(), "keys")
+	assert.NoError(err)
+	defer os.RemoveAll(keysDir)
+	assert.NoError(ioutil.WriteFile(filepath.Join(keysDir, "1.key"), make([]byte, 80), 0600))
+	assert.NoError(ioutil.WriteFile(filepath.Join(keysDir, "0.key"), make([]byte, 48), 0600))
+	assert.NoError(ioutil.WriteFile(filepath.Join(keysDir, "invalid.key"), make([]byte, 32), 0600))
+
+	keys, err := loadSessionTicketKeys(keysDir)
+	assert.NoError(err)
+	assert.Equal([]string{filepath.Join(keysDir, "0.key"), filepath.Join(keysDir, "1.key")}, keys)
+
+}
+
+func TestTLSFilesFingerprintChangesWhenRotated(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	certDir, err := ioutil.TempDir(os.TempDir(), "certs")
+	assert.NoError(err)
+	defer os.RemoveAll(certDir)
+	keysDir, err := ioutil.TempDir(os.TempDir(), "keys")
+	assert.NoError(err)
+	defer os.RemoveAll(keysDir)
+	defaultDir, err := ioutil.TempDir(os.TempDir(), "default")
+	assert.NoError(err)
+	defer os.RemoveAll(defaultDir)
+	writeCertificate(t, certDir, "foo", "foo.com")
+	writeCertificate(t, defaultDir, "default", "default")
+	assert.NoError(ioutil.WriteFile(filepath.Join(keysDir, "0.key"), make([]byte, 48), 0600))
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.SSLPath = filepath.Join(defaultDir, "default")
+	conf.SSLCertificatesDir = certDir
+	conf.SSLSessionTicketKeysDir = keysDir
+	lb := newNginxWithConf(conf).(*nginxUpdater)
+
+	initial, err := lb.tlsFilesFingerprint()
+	assert.NoError(err)
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(keysDir, "0.key"), []byte(strings.Repeat("a", 48)), 0600))
+	rotatedKey, err := lb.tlsFilesFingerprint()
+	assert.NoError(err)
+	assert.NotEqual(initial, rotatedKey, "rotating a session ticket key should change the fingerprint")
+
+	writeCertificate(t, certDir, "bar", "bar.com")
+	addedCert, err := lb.tlsFilesFingerprint()
+	assert.NoError(err)
+	assert.NotEqual(rotatedKey, addedCert, "adding a certificate should change the fingerprint")
+
+	writeCertificate(t, defaultDir, "default", "default")
+	renewedDefault, err := lb.tlsFilesFingerprint()
+	assert.NoError(err)
+	assert.NotEqual(addedCert, renewedDefault, "renewing the default certificate should change the fingerprint")
+}
+
+func TestSessionTicketKeysAreRendered(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	keysDir, err := ioutil.TempDir(os.TempDir(), "keys")
+	assert.NoError(err)
+	defer os.RemoveAll(keysDir)
+	assert.NoError(ioutil.WriteFile(filepath.Join(keysDir, "0.key"), make([]byte, 80), 0600))
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.SSLSessionTicketKeysDir = keysDir
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8080},
+	}))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Contains(configContents, "ssl_session_tickets on;")
+	assert.Contains(configContents, "ssl_session_ticket_key "+filepath.Join(keysDir, "0.key")+";")
+	assert.NotContains(configContents, "ssl_session_tickets off;")
+}
+
+func TestACMEChallengesAreServedOverHTTP(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Ports = []Port{{Name: "http", Port: 80}, {Name: "https", Port: 443}}
+	conf.ACMEChallengeDir = "/var/lib/feed/acme/challenges"
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8080, ACME: true},
+	}))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	challengeLocation := regexp.QuoteMeta("location ^~ /.well-known/acme-challenge/ {") + "\\s+alias /var/lib/feed/acme/challenges/;"
+	assert.Regexp("(?s)listen 80;\\s+server_name foo.com;.+?"+challengeLocation, configContents)
+	assert.Regexp("(?s)listen 80 default_server;.+?"+challengeLocation, configContents)
+	assert.Equal(2, strings.Count(configContents, "location ^~ /.well-known/acme-challenge/"),
+		"challenges should only be served over http")
+}
+
+func TestBackendsRequiringSPIFFEAreProxiedWithSVID(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.SPIFFESVIDDir = "/run/spiffe"
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8443, BackendSPIFFE: true,
+			BackendSPIFFEName: "foo.core.svc"},
+		{Host: "bar.com", Namespace: "core", Name: "bar", Path: "/", ServiceAddress: "bar", ServicePort: 8080},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Regexp(`(?s)server_name foo.com;.+?proxy_pass https://core.foo.foo.8443;\s+# Authenticate.+?`+
+		`proxy_ssl_certificate /run/spiffe/svid.pem;\s+proxy_ssl_certificate_key /run/spiffe/svid_key.pem;\s+`+
+		`proxy_ssl_trusted_certificate /run/spiffe/svid_bundle.pem;\s+proxy_ssl_verify on;\s+proxy_ssl_verify_depth 3;\s+`+
+		`proxy_ssl_name foo.core.svc;`, configContents)
+	assert.Contains(configContents, "proxy_pass http://core.bar.bar.8080;")
+	assert.Equal(1, strings.Count(configContents, "proxy_ssl_certificate "))
+}
+
+func TestBackendSPIFFEIsIgnoredWithoutSVIDDir(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8443, BackendSPIFFE: true},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	assert.Contains(string(config), "proxy_pass http://core.foo.foo.8443;")
+	assert.NotContains(string(config), "proxy_ssl_certificate")
+}
+
+func TestH2CBackendsAreProxiedWithGRPCPass(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.SPIFFESVIDDir = "/run/spiffe"
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8080,
+			BackendProtocol: controller.BackendProtocolH2C, BackendTimeoutSeconds: 30, StripPaths: true, BackendSPIFFE: true},
+		{Host: "bar.com", Namespace: "core", Name: "bar", Path: "/", ServiceAddress: "bar", ServicePort: 8080,
+			BackendProtocol: controller.BackendProtocolHTTP},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Regexp(`(?s)server_name foo.com;.+?grpc_pass grpc://core.foo.foo.8080;.+?`+
+		`grpc_read_timeout 30s;\s+grpc_send_timeout 30s;`, configContents)
+	assert.Contains(configContents, "proxy_pass http://core.bar.bar.8080;")
+	assert.Equal(1, strings.Count(configContents, "grpc_pass "))
+	assert.NotContains(configContents, "proxy_ssl_certificate", "h2c can't present a SPIFFE identity")
+	assert.Contains(configContents, "grpc_set_header X-Forwarded-For $proxy_add_x_forwarded_for;")
+}
+
+func TestFastCGIAndUWSGIBackendsArePassedWithTheirParams(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entries := []controller.IngressEntry{
+		{Host: "php.com", Namespace: "core", Name: "php", Path: "/", ServiceAddress: "php", ServicePort: 9000,
+			BackendProtocol: controller.BackendProtocolFastCGI, BackendTimeoutSeconds: 30, StripPaths: true},
+		{Host: "python.com", Namespace: "core", Name: "python", Path: "/", ServiceAddress: "python", ServicePort: 3031,
+			BackendProtocol: controller.BackendProtocolUWSGI, BackendTimeoutSeconds: 20},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Regexp(`(?s)server_name php.com;.+?include fastcgi_params;.+?`+
+		`fastcgi_param HTTP_X_FORWARDED_FOR \$proxy_add_x_forwarded_for;.+?fastcgi_keep_conn on;\s+`+
+		`fastcgi_pass core.php.php.9000;.+?fastcgi_read_timeout 30s;\s+fastcgi_send_timeout 30s;`, configContents)
+	assert.Regexp(`(?s)server_name python.com;.+?include uwsgi_params;.+?`+
+		`uwsgi_param HTTP_X_FORWARDED_FOR \$proxy_add_x_forwarded_for;.+?`+
+		`uwsgi_pass core.python.python.3031;.+?uwsgi_read_timeout 20s;\s+uwsgi_send_timeout 20s;`, configContents)
+	assert.NotContains(configContents, "proxy_pass http://core.")
+}
+
+func TestInterceptedErrorsAreReplacedWithErrorPages(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.ErrorPagesDir = "/etc/feed/error-pages"
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8080,
+			InterceptErrors: []int{500, 503}},
+		{Host: "bar.com", Namespace: "core", Name: "bar", Path: "/", ServiceAddress: "bar", ServicePort: 8080,
+			InterceptErrors: []int{502}, BackendProtocol: controller.BackendProtocolFastCGI},
+		{Host: "baz.com", Namespace: "core", Name: "baz", Path: "/", ServiceAddress: "baz", ServicePort: 8080},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Regexp(`(?s)server_name foo.com;.+?location \^~ /_feed_error_pages/ \{\s+internal;\s+`+
+		`alias /etc/feed/error-pages/;.+?proxy_intercept_errors on;\s+`+
+		`error_page 500 /_feed_error_pages/500.html;\s+error_page 503 /_feed_error_pages/503.html;`, configContents)
+	assert.Regexp(`(?s)server_name bar.com;.+?fastcgi_intercept_errors on;\s+`+
+		`error_page 502 /_feed_error_pages/502.html;`, configContents)
+	assert.Equal(2, strings.Count(configContents, "_intercept_errors on;"))
+}
+
+func TestErrorsAreNotInterceptedWithoutErrorPages(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8080,
+			InterceptErrors: []int{500}},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	assert.NotContains(string(config), "_intercept_errors")
+	assert.NotContains(string(config), "_feed_error_pages")
+}
+
+func TestSecurityHeadersAreAddedFromTheProfile(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.SecurityHeaders = "basic"
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "default.com", Namespace: "core", Name: "default", Path: "/", ServiceAddress: "default", ServicePort: 8080},
+		{Host: "strict.com", Namespace: "core", Name: "strict", Path: "/", ServiceAddress: "strict", ServicePort: 8080,
+			SecurityHeaders: "strict", BackendProtocol: controller.BackendProtocolH2C},
+		{Host: "off.com", Namespace: "core", Name: "off", Path: "/", ServiceAddress: "off", ServicePort: 8080,
+			SecurityHeaders: "off"},
+		{Host: "unknown.com", Namespace: "core", Name: "unknown", Path: "/", ServiceAddress: "unknown", ServicePort: 8080,
+			SecurityHeaders: "paranoid"},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	servers := regexp.MustCompile(`server_name `).Split(string(config), -1)
+	serverConfig := func(host string) string {
+		for _, s := range servers {
+			if strings.HasPrefix(s, host+";") {
+				return s
+			}
+		}
+		return ""
+	}
+
+	for _, host := range []string{"default.com", "unknown.com"} {
+		assert.Contains(serverConfig(host), "proxy_hide_header X-Frame-Options;\n            add_header X-Frame-Options \"SAMEORIGIN\" always;", host)
+		assert.Contains(serverConfig(host), "add_header X-Content-Type-Options \"nosniff\" always;", host)
+		assert.NotContains(serverConfig(host), "Permissions-Policy", host)
+	}
+	assert.Contains(serverConfig("strict.com"), "grpc_hide_header X-Frame-Options;\n            add_header X-Frame-Options \"DENY\" always;")
+	assert.Contains(serverConfig("strict.com"), "add_header Referrer-Policy \"no-referrer\" always;")
+	assert.Contains(serverConfig("strict.com"), "add_header Permissions-Policy \"accelerometer=(), camera=()")
+	assert.NotContains(serverConfig("off.com"), "add_header")
+}
+
+func TestUnknownSecurityHeadersProfileFailsToStart(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.SecurityHeaders = "paranoid"
+	lb := newNginxWithConf(conf)
+
+	assert.EqualError(t, lb.Start(), `unknown security headers profile "paranoid", must be one of [basic off strict]`)
+}
+
+func TestHTTPSRedirectsAndHSTSAreKeyedOffTheFrontendScheme(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.HTTPSRedirectSchemes = []string{"internet-facing"}
+	conf.HSTSSchemes = []string{"internet-facing"}
+	conf.HSTSMaxAge = time.Hour
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "public.com", Namespace: "core", Name: "public", Path: "/", ServiceAddress: "public", ServicePort: 8080,
+			LbScheme: "internet-facing"},
+		{Host: "private.com", Namespace: "core", Name: "private", Path: "/", ServiceAddress: "private", ServicePort: 8080,
+			LbScheme: "internal"},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	servers := regexp.MustCompile(`server_name `).Split(string(config), -1)
+	serverConfig := func(host string) string {
+		for _, s := range servers {
+			if strings.HasPrefix(s, host+";") {
+				return s
+			}
+		}
+		return ""
+	}
+
+	assert.Contains(string(config), "map $frontend_scheme $hsts {\n        https \"max-age=3600\";")
+	assert.Contains(serverConfig("public.com"), "if ($frontend_scheme = http) {\n                return 308 https://$host$request_uri;")
+	assert.Contains(serverConfig("public.com"), "add_header Strict-Transport-Security $hsts always;")
+	assert.NotContains(serverConfig("private.com"), "return 308")
+	assert.NotContains(serverConfig("private.com"), "Strict-Transport-Security")
+}
+
+func TestDrainedIngressesReturn503AndKeepTheirUpstream(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newUpdater(tmpDir)
+	entries := []controller.IngressEntry{
+		{Host: "drained.com", Namespace: "core", Name: "drained", Path: "/", ServiceAddress: "drained", ServicePort: 8080,
+			Drain: true},
+		{Host: "live.com", Namespace: "core", Name: "live", Path: "/", ServiceAddress: "live", ServicePort: 8080},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	drained := regexp.MustCompile(`server_name drained.com;[\s\S]*?location / \{\n\s*# Drained.*\n\s*return 503;`)
+	assert.Regexp(drained, string(config))
+	assert.Contains(string(config), "upstream core.drained.drained.8080 {")
+	assert.Equal(1, strings.Count(string(config), "return 503;"))
+}
+
+func TestPortsWithASchemeOnlyServeIngressesOfThatScheme(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Ports = []Port{{Name: "http", Port: 80}, {Name: "internal", Port: 8080, Scheme: "internal"},
+		{Name: "public", Port: 8081, Scheme: "internet-facing"}}
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "public.com", Namespace: "core", Name: "public", Path: "/", ServiceAddress: "public", ServicePort: 8080,
+			LbScheme: "internet-facing"},
+		{Host: "public.com", Namespace: "core", Name: "admin", Path: "/admin/", ServiceAddress: "admin", ServicePort: 8080,
+			LbScheme: "internal"},
+		{Host: "private.com", Namespace: "core", Name: "private", Path: "/", ServiceAddress: "private", ServicePort: 8080,
+			LbScheme: "internal"},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	servers := regexp.MustCompile(`(?s)server \{\n\s*listen (\d+);\s*server_name ([^;]+);.*?\n    \}`).
+		FindAllStringSubmatch(string(config), -1)
+	locations := make(map[string][]string)
+	for _, s := range servers {
+		key := s[2] + ":" + s[1]
+		for _, l := range regexp.MustCompile(`location (/\S*) \{`).FindAllStringSubmatch(s[0], -1) {
+			locations[key] = append(locations[key], l[1])
+		}
+		if s[1] != "80" {
+			assert.Contains(s[0], "vhost_traffic_status_filter_by_set_key $server_name scheme@", key)
+		}
+	}
+
+	assert.Equal([]string{"/", "/admin/"}, locations["public.com:80"], "every ingress is served on a port without a scheme")
+	assert.Equal([]string{"/"}, locations["private.com:80"])
+	assert.Equal([]string{"/admin/", "/"}, locations["public.com:8080"], "with a 404 for the root")
+	assert.Equal([]string{"/"}, locations["private.com:8080"])
+	assert.Equal([]string{"/"}, locations["public.com:8081"])
+	assert.NotContains(locations, "private.com:8081")
+}
+
+func TestInternalPathsAreRestrictedToTrustedFrontends(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.TrustedFrontends = []string{"10.50.185.0/24"}
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8080,
+			Allow: []string{"0.0.0.0/0"}, InternalPaths: []string{"/admin", "/metrics/"}},
+		{Host: "foo.com", Namespace: "core", Name: "foo-admin-api", Path: "/admin/api", ServiceAddress: "admin-api",
+			ServicePort: 8080, Allow: []string{"0.0.0.0/0"}},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	restricted := `\s+# Internal path, only reachable from the trusted frontends\s+allow 10.50.185.0/24;\s+deny all;`
+	public := `\s+# Restrict clients\s+allow 0.0.0.0/0;\s+deny all;`
+	assert.Regexp(`(?s)location / \{\s+# Keep original path when proxying.\s+proxy_pass http://core.foo.foo.8080;[^}]+?`+public, configContents)
+	assert.Regexp(`(?s)location /admin \{\s+# Keep original path when proxying.\s+proxy_pass http://core.foo.foo.8080;[^}]+?`+restricted, configContents)
+	assert.Regexp(`(?s)location /admin/api/ \{.+?proxy_pass http://core.foo-admin-api.admin-api.8080[^}]+?`+restricted, configContents)
+	assert.Regexp(`(?s)location /metrics \{[^}]+?`+restricted, configContents)
+}
+
+func TestInternalPathsAreInternalWithoutTrustedFrontends(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/api", ServiceAddress: "foo", ServicePort: 8080,
+			Allow: []string{"0.0.0.0/0"}, InternalPaths: []string{"/admin"}},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Regexp(`(?s)location /api/admin \{[^}]+?# Internal path, only reachable by internal redirects\s+internal;\s+deny all;`, configContents)
+	assert.Regexp(`(?s)location /api/ \{[^}]+?# Restrict clients\s+allow 0.0.0.0/0;`, configContents)
+}
+
+func TestTrailingSlashRedirectsCanBeChangedOrServed(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.TrailingSlash = "308"
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "root", Path: "/", ServiceAddress: "root", ServicePort: 8080},
+		{Host: "foo.com", Namespace: "core", Name: "default", Path: "/default", ServiceAddress: "default", ServicePort: 8080},
+		{Host: "foo.com", Namespace: "core", Name: "serve", Path: "/serve", ServiceAddress: "serve", ServicePort: 8080,
+			TrailingSlash: "serve", StripPaths: true},
+		{Host: "foo.com", Namespace: "core", Name: "nginx", Path: "/nginx", ServiceAddress: "nginx", ServicePort: 8080,
+			TrailingSlash: "301"},
+		{Host: "foo.com", Namespace: "core", Name: "unknown", Path: "/unknown", ServiceAddress: "unknown", ServicePort: 8080,
+			TrailingSlash: "404"},
+		{Host: "foo.com", Namespace: "core", Name: "exact", Path: "/exact", ServiceAddress: "exact", ServicePort: 8080,
+			TrailingSlash: "serve", ExactPath: true},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Contains(configContents, "location = /default {\n            return 308 /default/$is_args$args;\n        }")
+	assert.Contains(configContents, "location = /unknown {\n            return 308 /unknown/$is_args$args;\n        }")
+	assert.Regexp(`(?s)location = /serve \{\s+# Strip location path when proxying.+?proxy_pass http://core.serve.serve.8080/;`, configContents)
+	assert.Contains(configContents, "location /serve/ {")
+	assert.NotContains(configContents, "location = /nginx ")
+	assert.NotContains(configContents, "location = / ")
+	assert.Equal(1, strings.Count(configContents, "location = /exact "))
+}
+
+func TestUnknownTrailingSlashModeFailsToStart(t *testing.T) {
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.TrailingSlash = "404"
+	lb := newNginxWithConf(conf)
+
+	assert.EqualError(t, lb.Start(), `unknown trailing slash mode "404", must be one of [301 302 307 308 serve]`)
+}
+
+func TestPathRegexesAreOrderedAfterPrefixLocations(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "short", Path: "^/v[0-9]/", PathRegex: true, StripPaths: true,
+			ServiceAddress: "short", ServicePort: 8080},
+		{Host: "foo.com", Namespace: "core", Name: "long", Path: "^/v[0-9]{1,2}/users", PathRegex: true,
+			ServiceAddress: "long", ServicePort: 8080},
+		{Host: "foo.com", Namespace: "core", Name: "prefix", Path: "/z", ServiceAddress: "prefix", ServicePort: 8080},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Regexp(`(?s)location /z/ \{.+?location ~ "\^/v\[0-9\]\{1,2\}/users" \{.+?location ~ "\^/v\[0-9\]/" \{`,
+		configContents)
+	assert.Contains(configContents, `vhost_traffic_status_filter_by_set_key "^/v[0-9]{1,2}/users::$proxy_host" $server_name;`)
+	assert.Contains(configContents, "proxy_pass http://core.short.short.8080;", "regex locations can't strip the path")
+	assert.NotContains(configContents, "location = ^")
+}
+
+func TestWebSocketUpgradesAreProxiedWithTheirOwnTimeout(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "http", Path: "/http/", ServiceAddress: "http", ServicePort: 8080,
+			BackendTimeoutSeconds: 10, WebSocketTimeoutSeconds: 3600},
+		{Host: "foo.com", Namespace: "core", Name: "ws", Path: "/ws/", ServiceAddress: "ws", ServicePort: 8080,
+			BackendTimeoutSeconds: 10, WebSocketUpgrade: true, WebSocketTimeoutSeconds: 3600},
+		{Host: "foo.com", Namespace: "core", Name: "grpc", Path: "/grpc/", ServiceAddress: "grpc", ServicePort: 8080,
+			BackendTimeoutSeconds: 10, WebSocketUpgrade: true, BackendProtocol: controller.BackendProtocolH2C},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Contains(configContents, "map $http_upgrade $connection_upgrade {")
+	locationBlock := func(path string) string {
+		block := configContents[strings.Index(configContents, "location "+path+" {"):]
+		return block[:strings.Index(block, "\n        }")]
+	}
+	assert.Contains(locationBlock("/http/"), "proxy_read_timeout 10s;")
+	assert.NotContains(locationBlock("/http/"), "Upgrade")
+	assert.Regexp(`(?s)proxy_set_header Upgrade \$http_upgrade;\s+proxy_set_header Connection \$connection_upgrade;`+
+		`.+proxy_set_header Host \$host;.+proxy_read_timeout 3600s;\s+proxy_send_timeout 3600s;`, locationBlock("/ws/"))
+	assert.NotContains(locationBlock("/grpc/"), "Upgrade")
+	assert.Equal(1, strings.Count(configContents, "proxy_set_header Upgrade"))
+}
+
+func TestNJSHandlersAreAttachedFromLoadedModules(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.NJSModules = []string{"/etc/njs/main.js", "/etc/njs/headers.js"}
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "content", Path: "/content/", ServiceAddress: "content",
+			ServicePort: 8080, NJSContent: "main.hello", NJSHeaderFilter: "headers.filter.add"},
+		{Host: "foo.com", Namespace: "core", Name: "unknown", Path: "/unknown/", ServiceAddress: "unknown",
+			ServicePort: 8080, NJSContent: "other.hello"},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Contains(configContents, "load_module modules/ngx_http_js_module.so;")
+	assert.Contains(configContents, "js_import main from /etc/njs/main.js;")
+	assert.Contains(configContents, "js_import headers from /etc/njs/headers.js;")
+	assert.Regexp(`(?s)location /content/ \{\s+# Handle requests with njs instead of the backend.\s+js_content main.hello;`,
+		configContents)
+	assert.Contains(configContents, "js_header_filter headers.filter.add;")
+	assert.NotContains(configContents, "proxy_pass http://core.content.content.8080;")
+	assert.NotContains(configContents, "other.hello")
+	assert.Contains(configContents, "proxy_pass http://core.unknown.unknown.8080;")
+}
+
+func TestNJSModulesAreNotLoadedByDefault(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Path: "/", ServiceAddress: "foo", ServicePort: 8080, NJSContent: "main.hello"},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	assert.NotContains(string(config), "js_")
+}
+
+func TestInvalidNJSModulesFailToStart(t *testing.T) {
+	for _, modules := range [][]string{
+		{"/etc/njs/my-module.js"},
+		{"/etc/njs/main.js", "/etc/other/main.js"},
+	} {
+		tmpDir := setupWorkDir(t)
+		conf := newConf(tmpDir, fakeNginx)
+		conf.NJSModules = modules
+		lb := newNginxWithConf(conf)
+
+		assert.Error(t, lb.Start(), "%v", modules)
+		os.Remove(tmpDir)
+	}
+}
+
+func TestAPIKeysAreCheckedAndRateLimited(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "auth", Path: "/auth/", ServiceAddress: "auth", ServicePort: 8080,
+			APIKeyHeader: "X-Api-Key", APIKeys: map[string]string{"c2VjcmV0": "partner-b", "a1b2": "partner-a"},
+			APIKeyRateLimit: 5},
+		{Host: "foo.com", Namespace: "core", Name: "limit", Path: "/limit/", ServiceAddress: "limit", ServicePort: 8080,
+			APIKeyHeader: "X-Token", APIKeyRateLimit: 10},
+		{Host: "foo.com", Namespace: "core", Name: "none", Path: "/none/", ServiceAddress: "none", ServicePort: 8080,
+			APIKeyHeader: "X-Api-Key", APIKeys: map[string]string{}},
+		{Host: "foo.com", Namespace: "core", Name: "open", Path: "/open/", ServiceAddress: "open", ServicePort: 8080},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.NotContains(configContents, "c2VjcmV0", "API keys should be kept out of nginx.conf")
+	assert.Contains(configContents, "limit_req_zone $api_key_client_1 zone=api_key_1:1m rate=5r/s;")
+	assert.Contains(configContents, "limit_req_zone $http_x_token zone=api_key_2:1m rate=10r/s;")
+	assert.NotContains(configContents, "$api_key_client_2")
+	assert.NotContains(configContents, "zone=api_key_3")
+
+	files, err := filepath.Glob(filepath.Join(tmpDir, "api-keys-*.conf"))
+	assert.NoError(err)
+	if !assert.Len(files, 1) {
+		return
+	}
+	assert.Contains(configContents, "include "+files[0]+";")
+	info, err := os.Stat(files[0])
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	keys, err := ioutil.ReadFile(files[0])
+	assert.NoError(err)
+	assert.Equal(`map "key:$http_x_api_key" $api_key_client_1 {
+    default "";
+    "key:a1b2" "partner-a";
+    "key:c2VjcmV0" "partner-b";
+}
+map "key:$http_x_api_key" $api_key_client_3 {
+    default "";
+}
+`, string(keys))
+
+	locationBlock := func(path string) string {
+		block := configContents[strings.Index(configContents, "location "+path+" {"):]
+		return block[:strings.Index(block, "\n        }\n")]
+	}
+	assert.Contains(locationBlock("/auth/"), "if ($api_key_client_1 = \"\") {\n                return 401;")
+	assert.Contains(locationBlock("/auth/"), "limit_req zone=api_key_1 burst=5 nodelay;")
+	assert.NotContains(locationBlock("/limit/"), "return 401;")
+	assert.Contains(locationBlock("/limit/"), "limit_req zone=api_key_2 burst=10 nodelay;")
+	assert.Contains(locationBlock("/none/"), "if ($api_key_client_3 = \"\") {")
+	assert.NotContains(locationBlock("/open/"), "api_key")
+}
+
+func TestOnlyTheAPIKeysOfTheCurrentAndLastGoodConfigsAreKept(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	n := &nginxUpdater{Conf: Conf{WorkingDir: tmpDir, ConfDir: tmpDir}}
+	write := func(key string) string {
+		file, err := n.writeAPIKeys([]*apiKeyCheck{{ID: 1, Header: "X-Api-Key", Auth: true,
+			Keys: []apiKey{{Key: key, Client: "client"}}}})
+		assert.NoError(err)
+		return file
+	}
+
+	lastGood, current, unused := write("good"), write("current"), write("unused")
+	assert.Equal(current, write("current"), "the same keys should be written to the same file")
+	n.lastGoodConfig = []byte("include " + lastGood + ";")
+	assert.NoError(ioutil.WriteFile(n.nginxConfFile(), []byte("include "+current+";"), 0644))
+
+	n.removeUnusedAPIKeyFiles()
+
+	assert.FileExists(lastGood)
+	assert.FileExists(current)
+	assert.NoFileExists(unused)
+	empty, err := n.writeAPIKeys([]*apiKeyCheck{{ID: 1, Header: "X-Token", RateLimit: 10}})
+	assert.NoError(err)
+	assert.Empty(empty, "no file is needed without checks of known keys")
+}
+
+func TestRateLimitsAndHeadersOfRoutePoliciesAreApplied(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Path: "/limit/", ServiceAddress: "limit", ServicePort: 8080, RateLimit: 10, RateLimitBurst: 20,
+			APIKeyHeader: "X-Token", APIKeyRateLimit: 5},
+		{Host: "foo.com", Path: "/headers/", ServiceAddress: "headers", ServicePort: 8080, RateLimit: 1,
+			RequestHeaders:  map[string]string{"X-Team": "checkout", "X-Debug": ""},
+			ResponseHeaders: map[string]string{"Cache-Control": "no-store", "Server": ""}},
+		{Host: "foo.com", Path: "/open/", ServiceAddress: "open", ServicePort: 8080},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Contains(configContents, "limit_req_zone $binary_remote_addr zone=rate_limit_1:1m rate=1r/s;")
+	assert.Contains(configContents, "limit_req_zone $binary_remote_addr zone=rate_limit_2:1m rate=10r/s;")
+	assert.Equal(1, strings.Count(configContents, "limit_req_status 429;"))
+
+	locationBlock := func(path string) string {
+		block := configContents[strings.Index(configContents, "location "+path+" {"):]
+		return block[:strings.Index(block, "\n        }\n")]
+	}
+	assert.Contains(locationBlock("/limit/"), "limit_req zone=api_key_1 burst=5 nodelay;")
+	assert.Contains(locationBlock("/limit/"), "limit_req zone=rate_limit_2 burst=20 nodelay;")
+	assert.NotContains(locationBlock("/limit/"), "proxy_set_header Connection \"\";")
+	assert.Contains(locationBlock("/headers/"), "limit_req zone=rate_limit_1 nodelay;")
+	assert.Contains(locationBlock("/headers/"), `proxy_set_header X-Debug "";
+            proxy_set_header X-Team "checkout";
+            proxy_set_header Connection "";`)
+	assert.Contains(locationBlock("/headers/"), "proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;")
+	assert.Contains(locationBlock("/headers/"), `proxy_hide_header Cache-Control;
+            add_header Cache-Control "no-store" always;
+            proxy_hide_header Server;`)
+	assert.NotContains(locationBlock("/headers/"), "add_header Server")
+	assert.NotContains(locationBlock("/open/"), "limit_req")
+	assert.NotContains(locationBlock("/open/"), "_hide_header")
+}
+
+func TestStatsNameReplacesThePathInVhostStats(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.MetricsRequestSizes = true
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Path: "/checkout/v1/", ServiceAddress: "checkout", ServicePort: 8080, StatsName: "checkout-api"},
+		{Host: "foo.com", Path: "/basket/", ServiceAddress: "basket", ServicePort: 8080},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Contains(configContents, "vhost_traffic_status_filter_by_set_key checkout-api::$proxy_host $server_name;")
+	assert.Contains(configContents,
+		"vhost_traffic_status_filter_by_set_key checkout-api::$request_size_bucket request_size@$server_name;")
+	assert.Contains(configContents, "vhost_traffic_status_filter_by_set_key /basket/::$proxy_host $server_name;")
+	assert.NotContains(configContents, "/checkout/v1/::")
+}
+
+func TestHtpasswdSecretRequiresBasicAuth(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.HtpasswdDir = "/var/lib/feed/htpasswd"
+	lb := newNginxWithConf(conf)
+	entries := []controller.IngressEntry{
+		{Namespace: "core", Name: "admin", Host: "foo.com", Path: "/admin/", ServiceAddress: "admin", ServicePort: 8080,
+			HtpasswdSecret: "admins"},
+		{Namespace: "core", Name: "open", Host: "foo.com", Path: "/open/", ServiceAddress: "open", ServicePort: 8080},
+	}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update(entries))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	locationBlock := func(path string) string {
+		block := configContents[strings.Index(configContents, "location "+path+" {"):]
+		return block[:strings.Index(block, "\n        }")]
+	}
+	assert.Contains(locationBlock("/admin/"), "auth_basic \"core_admins\";")
+	assert.Contains(locationBlock("/admin/"), "auth_basic_user_file /var/lib/feed/htpasswd/core_admins;")
+	assert.NotContains(locationBlock("/open/"), "auth_basic")
+}
+
+func TestReadyOnceIngressesAreConfigured(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	lb := newNginxWithConf(newConf(tmpDir, fakeNginx))
+	readyLocation := func() string {
+		config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+		assert.NoError(err)
+		block := string(config)[strings.Index(string(config), "location /ready {"):]
+		return block[:strings.Index(block, "\n        }")]
+	}
+
+	assert.NoError(lb.Start())
+	assert.Contains(readyLocation(), "return 503;")
+
+	assert.NoError(lb.Update([]controller.IngressEntry{{Host: "foo.com", Path: "/", ServiceAddress: "foo", ServicePort: 8080}}))
+	assert.Contains(readyLocation(), "return 200;")
+	assert.NoError(lb.Stop())
+}
+
+func TestReadyProxiesToTheCanaryIngress(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.ReadyCanary = "core/canary"
+	lb := newNginxWithConf(conf)
+	readyLocation := func() string {
+		config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+		assert.NoError(err)
+		block := string(config)[strings.Index(string(config), "location /ready {"):]
+		return block[:strings.Index(block, "\n        }")]
+	}
+	app := controller.IngressEntry{Host: "foo.com", Namespace: "core", Name: "app", Path: "/", ServiceAddress: "app",
+		ServicePort: 8080}
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{app}))
+	assert.Contains(readyLocation(), "return 503;", "should not be ready without the canary")
+
+	assert.NoError(lb.Update([]controller.IngressEntry{
+		app,
+		{Host: "foo.com", Namespace: "core", Name: "canary", Path: "/canary/health", ServiceAddress: "canary",
+			ServicePort: 8080},
+		{Host: "foo.com", Namespace: "core", Name: "canary", Path: "/canary/(a|b)", ServiceAddress: "canary",
+			ServicePort: 8080, PathRegex: true},
+	}))
+	assert.Contains(readyLocation(), "proxy_set_header Host foo.com;")
+	assert.Contains(readyLocation(), "proxy_pass http://core.canary.canary.8080/canary/health;")
+	assert.NoError(lb.Stop())
+}
+
+func TestConfigWhichFailsValidationIsNotLoaded(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.HealthPort = 8081
+	conf.ValidationPort = 9099
+	conf.ValidationProbes = []string{"bar.com/health"}
+	conf.ValidationTimeout = 200 * time.Millisecond
+	lb := newNginxWithConf(conf)
 
-		lb := newNginxWithConf(test.config)
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{{Host: "foo.com", Path: "/", ServiceAddress: "foo", ServicePort: 8080}}))
 
-		assert.NoError(lb.Start())
-		entries := test.entries
-		err := lb.Update(entries)
-		assert.NoError(err)
+	// the fake nginx never listens, so validation fails
+	err := lb.Update([]controller.IngressEntry{{Host: "bar.com", Path: "/", ServiceAddress: "bar", ServicePort: 8080}})
+	assert.Error(err)
+	assert.Contains(err.Error(), "new config failed validation on port 9099, keeping the current config")
 
-		config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.Contains(string(config), "server_name foo.com;")
+	assert.NotContains(string(config), "server_name bar.com;")
+	assert.Contains(string(config), "pid "+tmpDir+"/nginx.pid;")
+
+	validation, err := ioutil.ReadFile(tmpDir + "/nginx-validation.conf")
+	assert.NoError(err)
+	assert.Contains(string(validation), "server_name bar.com;")
+	assert.Contains(string(validation), "listen 127.0.0.1:9099;")
+	assert.Contains(string(validation), "pid "+tmpDir+"/nginx-validation.pid;")
+	assert.NotContains(string(validation), "listen 8081")
+	assert.NotContains(string(validation), "listen "+strconv.Itoa(port))
+	assert.NoError(lb.Stop())
+}
+
+func TestPreviousConfigsAreKept(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.ConfigHistory = 2
+	lb := newNginxWithConf(conf)
+	update := func(host string) {
+		assert.NoError(lb.Update([]controller.IngressEntry{{Host: host, Path: "/", ServiceAddress: "svc", ServicePort: 8080}}))
+	}
+	history := func(i int) string {
+		config, err := ioutil.ReadFile(tmpDir + "/nginx.conf." + strconv.Itoa(i))
 		assert.NoError(err)
-		configContents := string(config)
+		return string(config)
+	}
 
-		if test.upstreamEntries != nil {
-			assertConfigEntries(t, test.name, "upstream", `(?sU)(    upstream.+\n    })`, test.upstreamEntries, configContents)
-		}
-		if test.serverEntries != nil {
-			assertConfigEntries(t, test.name, "server", `(?sU)(# ingress:.+server.+\n    })`, test.serverEntries, configContents)
-		}
-		assert.Nil(lb.Stop())
+	assert.NoError(lb.Start())
+	update("first.com")
+	update("second.com")
+	update("third.com")
+
+	assert.Contains(history(1), "server_name second.com;")
+	assert.Contains(history(2), "server_name first.com;")
+	assert.NoFileExists(tmpDir + "/nginx.conf.3")
+	info, err := os.Stat(tmpDir + "/nginx.conf.1")
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	assert.NoError(lb.Stop())
+}
 
-		if t.Failed() {
-			t.FailNow()
-		}
+func TestStaleUnixSocketIsRemovedOnStart(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.UnixSocket = filepath.Join(tmpDir, "ingress.sock")
+	assert.NoError(ioutil.WriteFile(conf.UnixSocket, []byte{}, 0644))
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+
+	_, err := os.Stat(conf.UnixSocket)
+	assert.True(os.IsNotExist(err), "stale socket should be removed")
+}
+
+func TestTemplatesCanBeRedefinedByLaterTemplates(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	override := filepath.Join(tmpDir, "https.tmpl")
+	assert.NoError(ioutil.WriteFile(override, []byte(`{{define "HTTPSConf"}}
+        ssl_certificate {{ . }}.crt;
+        ssl_certificate_key {{ . }}.key;
+        ssl_protocols {{ list "TLSv1.2" "TLSv1.3" | join " " }};
+{{ end }}`), 0644))
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Ports = []Port{{Name: "http", Port: 80}, {Name: "https", Port: 443}}
+	conf.Templates = []string{filepath.Join(tmpDir, "nginx.tmpl"), override}
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8080},
+	}))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	configContents := string(config)
+	assert.Contains(configContents, "ssl_protocols TLSv1.2 TLSv1.3;")
+	assert.NotContains(configContents, "ssl_prefer_server_ciphers")
+	assert.Contains(configContents, "server_name foo.com;", "the rest of the default template should be used")
+}
+
+func TestAlternativeTemplateIsRenderedWithHelperFunctions(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	alternative := filepath.Join(tmpDir, "alternative.tmpl")
+	assert.NoError(ioutil.WriteFile(alternative, []byte(`
+{{- range .Servers }}server {{ .ServerName | upper | quote }} {{ ternary "tls" "plain" (hasPrefix "secure" .ServerName) }}
+{{ end }}
+{{- .LogLevel | default "info" | printf "log %s" }}{{ "a,b,c" | splitList "," | join ";" | nindent 4 }}
+{{ dict "x" 1 | empty }} {{ coalesce "" .AccessLogDir "none" }} {{ add 1 2 }}`), 0644))
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Templates = []string{alternative}
+	conf.LogLevel = "error"
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{
+		{Host: "secure.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8080},
+		{Host: "foo.com", Namespace: "core", Name: "bar", Path: "/", ServiceAddress: "bar", ServicePort: 8080},
+	}))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.NoError(lb.Stop())
+
+	assert.Equal(`server "FOO.COM" plain
+server "SECURE.COM" tls
+log error
+    a;b;c
+false none 3`, string(config))
+}
+
+func TestInvalidTemplatesFailToStart(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	invalid := filepath.Join(tmpDir, "invalid.tmpl")
+	assert.NoError(ioutil.WriteFile(invalid, []byte(`{{ .Servers | unknownFunction }}`), 0644))
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Templates = []string{invalid}
+	lb := newNginxWithConf(conf)
+
+	err := lb.Start()
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "unable to parse nginx templates")
+	}
+}
+
+func TestTemplatesFingerprintChangesWhenEdited(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	override := filepath.Join(tmpDir, "override.tmpl")
+	assert.NoError(ioutil.WriteFile(override, []byte(`{{define "HTTPSConf"}}{{end}}`), 0644))
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.Templates = []string{filepath.Join(tmpDir, "nginx.tmpl"), override}
+	lb := newNginxWithConf(conf).(*nginxUpdater)
+
+	initial, err := lb.templatesFingerprint()
+	assert.NoError(err)
+	unchanged, err := lb.templatesFingerprint()
+	assert.NoError(err)
+	assert.Equal(initial, unchanged)
+
+	assert.NoError(ioutil.WriteFile(override, []byte(`{{define "HTTPSConf"}} {{end}}`), 0644))
+	edited, err := lb.templatesFingerprint()
+	assert.NoError(err)
+	assert.NotEqual(initial, edited, "editing any template should change the fingerprint")
+}
+
+func TestInvalidTemplateChangesAreReportedByHealth(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	template := filepath.Join(tmpDir, "nginx.tmpl")
+	valid, err := ioutil.ReadFile(template)
+	assert.NoError(err)
+
+	ts := stubHealthPort()
+	defer ts.Close()
+	conf := newConf(tmpDir, fakeNginx)
+	conf.HealthPort = getPort(ts)
+	lb := newNginxWithConf(conf).(*nginxUpdater)
+	assert.NoError(lb.Start())
+	assert.NoError(lb.Update([]controller.IngressEntry{
+		{Host: "foo.com", Namespace: "core", Name: "foo", Path: "/", ServiceAddress: "foo", ServicePort: 8080},
+	}))
+	assert.NoError(lb.Health())
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+
+	errorsBefore := testutil.ToFloat64(templateErrors)
+	assert.NoError(ioutil.WriteFile(template, []byte("{{ .Missing }}"), 0644))
+	_, err = lb.refreshNginxConf()
+	assert.Error(err)
+	if err := lb.Health(); assert.Error(err) {
+		assert.Contains(err.Error(), "nginx template is invalid")
+	}
+	assert.Equal(errorsBefore+1, testutil.ToFloat64(templateErrors))
+	unchangedConfig, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.Equal(string(config), string(unchangedConfig), "the last good config should be kept")
+
+	assert.NoError(ioutil.WriteFile(template, append(valid, []byte("# edited\n")...), 0644))
+	changed, err := lb.refreshNginxConf()
+	assert.NoError(err)
+	assert.True(changed)
+	assert.NoError(lb.Health(), "should be healthy once the template is fixed")
+
+	assert.NoError(lb.Stop())
+}
+
+func TestNginxIsNotStartedWithAConfigWhichFailedValidation(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+	lb := newUpdaterWithBinary(tmpDir, "./fake_nginx_failing_reload.sh")
+	entries := []controller.IngressEntry{
+		{Host: "foo.com", Path: "/path", ServiceAddress: "service", ServicePort: 9090},
+	}
+
+	assert.NoError(lb.Start())
+	assert.Error(lb.Update(entries))
+	err := lb.Update(entries)
+
+	if assert.Error(err, "unchanged config should still be validated") {
+		assert.Contains(err.Error(), "Config check failed")
 	}
+	assert.EqualError(lb.Health(), "nginx is not running")
 }
 
 func TestNginxRootPathLocations(t *testing.T) {
@@ -2042,6 +4453,46 @@ func TestDoesNotUpdateIfConfigurationHasNotChanged(t *testing.T) {
 	time.Sleep(time.Duration(1) * time.Second)
 }
 
+func TestSkipsConfigGenerationIfEntriesHaveNotChanged(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+	conf := newConf(tmpDir, fakeNginx)
+	// log headers are rendered into the conf, which shouldn't change what's hashed
+	conf.LogHeaders = []string{"X-Trace-Id"}
+	lb := newNginxWithConf(conf)
+
+	assert.NoError(lb.Start())
+	defer lb.Stop()
+
+	foo := controller.IngressEntry{Host: "foo.com", Path: "/foo", ServiceAddress: "foo", ServicePort: 9090}
+	bar := controller.IngressEntry{Host: "bar.com", Path: "/bar", ServiceAddress: "bar", ServicePort: 9090}
+	entries := []controller.IngressEntry{foo, bar}
+	assert.NoError(lb.Update(entries))
+	assert.Equal([]controller.IngressEntry{foo, bar}, entries, "the entries shouldn't be reordered")
+
+	// a config which would be replaced if it were generated again
+	assert.NoError(ioutil.WriteFile(tmpDir+"/nginx.conf", []byte("# not generated\n"), 0644))
+
+	// when
+	bar.Ingress = &networkingv1.Ingress{}
+	assert.NoError(lb.Update([]controller.IngressEntry{bar, foo}))
+
+	// then
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.Equal("# not generated\n", string(config), "order and ingress resource shouldn't affect the config")
+
+	// when
+	bar.Path = "/baz"
+	assert.NoError(lb.Update([]controller.IngressEntry{bar, foo}))
+
+	// then
+	config, err = ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.Contains(string(config), "location /baz/ {")
+}
+
 func TestRateLimitedForUpdates(t *testing.T) {
 	assert := assert.New(t)
 	tmpDir := setupWorkDir(t)
@@ -2124,6 +4575,144 @@ func TestUpdatesMetricsFromNginxStatusPage(t *testing.T) {
 	assertIngressRequestCounters(t,
 		"ingress-with-invalid-path.sandbox.cosmic.sky", "/bad/",
 		0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0)
+
+	// and
+	assertEndpointUpstreamMetrics(t,
+		"kube-system.10.254.201.199.80", "10.254.201.199:80",
+		0.001, 0.3, 0.0)
+	assertEndpointUpstreamMetrics(t,
+		"some-app.10.254.204.100.8080", "10.254.204.100:8080",
+		0.25, 0.25, 2.0)
+}
+
+func TestIngressMetricsCardinalityCanBeLimited(t *testing.T) {
+	assert := assert.New(t)
+	initMetrics()
+
+	vtsMetrics, err := parseStatusBody(strings.NewReader(string(statusResponseBody)))
+	assert.NoError(err)
+
+	updateIngressMetrics(vtsMetrics, newIngressSeriesLimiter(true, []string{"heapster.sandbox.cosmic.sky",
+		"heapster-external.sandbox.cosmic.sky", "ingress-with-valid-duplicate-path.sandbox.cosmic.sky"}, 2))
+
+	assertIngressRequestCounters(t,
+		"heapster-external.sandbox.cosmic.sky", "*",
+		898.0, 471.0, 6.0, 3.0, 2.0, 1.0, 7.0)
+	assertIngressRequestCounters(t,
+		"heapster.sandbox.cosmic.sky", "*",
+		2012.0, 1099.0, 0.0, 7.0, 0.0, 0.0, 0.0)
+	// the third allowed host exceeds the maximum series, and the last host isn't allowed
+	assertIngressRequestCounters(t,
+		"other", "other",
+		5000.0, 2000.0, 0.0, 5.0, 0.0, 0.0, 0.0)
+}
+
+func TestSchemeRequestsAreSummedOverHosts(t *testing.T) {
+	assert := assert.New(t)
+	initMetrics()
+
+	updateSchemeMetrics(VTSMetrics{FilterZones: map[string]map[string]VTSRequestData{
+		"scheme@internal": {
+			"foo.com": {Responses: &VTSResponses{TwoXX: 10, FiveXX: 1}},
+			"bar.com": {Responses: &VTSResponses{TwoXX: 5, FourXX: 2}},
+		},
+		"foo.com": {"/::upstream": {Responses: &VTSResponses{TwoXX: 100}}},
+	}})
+
+	req2xx, _ := schemeRequests.GetMetricWithLabelValues("internal", "2xx")
+	assert.Equal("feed_ingress_scheme_requests", metricName(req2xx))
+	assert.Equal(15.0, metricValue(req2xx))
+	req4xx, _ := schemeRequests.GetMetricWithLabelValues("internal", "4xx")
+	assert.Equal(2.0, metricValue(req4xx))
+	req5xx, _ := schemeRequests.GetMetricWithLabelValues("internal", "5xx")
+	assert.Equal(1.0, metricValue(req5xx))
+}
+
+func TestIngressRequestTimeAndSizeBuckets(t *testing.T) {
+	assert := assert.New(t)
+	initMetrics()
+
+	vtsMetrics, err := parseStatusBody(strings.NewReader(string(statusResponseBody)))
+	assert.NoError(err)
+
+	updateIngressMetrics(vtsMetrics, nil)
+	updateIngressRequestSizeMetrics(vtsMetrics, nil)
+
+	host, path := "heapster.sandbox.cosmic.sky", "/"
+	for le, expected := range map[string]float64{"0.005": 3, "0.01": 5, "0.05": 6, "+Inf": 7} {
+		bucket, _ := ingressRequestTime.GetMetricWithLabelValues(host, path, le)
+		assert.Equal("feed_ingress_ingress_request_time_seconds_bucket", metricName(bucket))
+		assert.Equal(expected, metricValue(bucket), "request time bucket %s", le)
+	}
+	for le, expected := range map[string]float64{"1000": 4, "10000": 4, "100000": 6, "1e+06": 6, "1e+07": 6, "+Inf": 7} {
+		bucket, _ := ingressRequestSize.GetMetricWithLabelValues(host, path, le)
+		assert.Equal("feed_ingress_ingress_request_size_bytes_bucket", metricName(bucket))
+		assert.Equal(expected, metricValue(bucket), "request size bucket %s", le)
+	}
+}
+
+func TestStatusPageIsOnlyParsedWhenChanged(t *testing.T) {
+	assert := assert.New(t)
+	cache := &statusCache{}
+
+	assert.False(cache.unchanged([]byte(`{"nowMsec":1000,"connections":{"active":1}}`)))
+	assert.True(cache.unchanged([]byte(`{"nowMsec":2000,"connections":{"active":1}}`)), "only the time has changed")
+	assert.False(cache.unchanged([]byte(`{"nowMsec":3000,"connections":{"active":2}}`)))
+}
+
+func TestStatusPageIsNotParsedWhenNotModified(t *testing.T) {
+	assert := assert.New(t)
+	initMetrics()
+
+	var ifNoneMatch []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write(statusResponseBody)
+	}))
+	defer ts.Close()
+
+	cache := &statusCache{}
+	assert.NoError(parseAndSetNginxMetrics(getPort(ts), nil, cache))
+	assert.NoError(parseAndSetNginxMetrics(getPort(ts), nil, cache))
+	assert.Equal([]string{"", `"v1"`}, ifNoneMatch)
+}
+
+func TestMetricsUpdateIntervalIsJittered(t *testing.T) {
+	assert := assert.New(t)
+
+	for i := 0; i < 100; i++ {
+		interval := jitter(time.Second * 10)
+		assert.True(interval >= time.Second*9 && interval <= time.Second*11, "%v should be within 10%% of 10s", interval)
+	}
+	assert.Equal(time.Duration(0), jitter(0))
+}
+
+func TestIngressSeriesLimiterKeepsTrackedSeries(t *testing.T) {
+	assert := assert.New(t)
+	limiter := newIngressSeriesLimiter(false, nil, 1)
+
+	assert.Equal(ingressSeries{"foo.com", "/foo/"}, limiter.series("foo.com", "/foo/"))
+	assert.Equal(ingressSeries{"other", "other"}, limiter.series("bar.com", "/bar/"))
+	assert.Equal(ingressSeries{"foo.com", "/foo/"}, limiter.series("foo.com", "/foo/"))
+}
+
+func assertEndpointUpstreamMetrics(t *testing.T, name, endpoint string, responseTime, serverErrorRatio, retries float64) {
+	assert := assert.New(t)
+
+	responseTimeGauge, _ := endpointResponseTime.GetMetricWithLabelValues(name, endpoint)
+	assert.Equal("feed_ingress_endpoint_response_time_seconds", metricName(responseTimeGauge))
+	assert.InDelta(responseTime, metricValue(responseTimeGauge), 0.0001, "response time for %s%s", name, endpoint)
+	ratioGauge, _ := endpointServerErrorRatio.GetMetricWithLabelValues(name, endpoint)
+	assert.Equal("feed_ingress_endpoint_5xx_ratio", metricName(ratioGauge))
+	assert.InDelta(serverErrorRatio, metricValue(ratioGauge), 0.0001, "5xx ratio for %s%s", name, endpoint)
+	retriesGauge, _ := upstreamRetries.GetMetricWithLabelValues(name)
+	assert.Equal("feed_ingress_upstream_retries", metricName(retriesGauge))
+	assert.Equal(retries, metricValue(retriesGauge), "retries for %s", name)
 }
 
 func assertIngressRequestCounters(t *testing.T, host, path string, in, out, ones, twos, threes, fours, fives float64) {
@@ -2236,19 +4825,23 @@ func TestFailsToUpdateIfConfigurationIsBroken(t *testing.T) {
 		},
 	}
 
+	failuresBefore := testutil.ToFloat64(configCheckFailures)
+	reloadFailuresBefore := testutil.ToFloat64(reloadFailures)
 	err := lb.Update(entries)
 	assert.Contains(err.Error(), "Config check failed")
 	assert.Contains(err.Error(), "./fake_nginx_failing_reload.sh -t")
+	assert.Equal(failuresBefore+1, testutil.ToFloat64(configCheckFailures))
+	assert.Equal(reloadFailuresBefore, testutil.ToFloat64(reloadFailures), "a failed check isn't a failed reload")
 }
 
-func setupWorkDir(t *testing.T) string {
+func setupWorkDir(t testing.TB) string {
 	tmpDir, err := ioutil.TempDir(os.TempDir(), "ingress_lb_test")
 	assert.NoError(t, err)
 	copyNginxTemplate(t, tmpDir)
 	return tmpDir
 }
 
-func copyNginxTemplate(t *testing.T, tmpDir string) {
+func copyNginxTemplate(t testing.TB, tmpDir string) {
 	assert.NoError(t, exec.Command("cp", "nginx.tmpl", tmpDir+"/").Run())
 }
 
@@ -2509,6 +5102,10 @@ var statusResponseBody = []byte(`{
         "requestCounter": 7,
         "inBytes": 2012,
         "outBytes": 1099,
+        "requestBuckets": {
+          "msecs": [5, 10, 50],
+          "counters": [3, 2, 1]
+        },
         "responses": {
           "1xx": 0,
           "2xx": 7,
@@ -2545,6 +5142,44 @@ var statusResponseBody = []byte(`{
         }
       }
     },
+    "request_size@heapster.sandbox.cosmic.sky": {
+      "/::1000": {
+        "requestCounter": 4,
+        "inBytes": 1000,
+        "outBytes": 500,
+        "responses": {
+          "1xx": 0,
+          "2xx": 4,
+          "3xx": 0,
+          "4xx": 0,
+          "5xx": 0
+        }
+      },
+      "/::100000": {
+        "requestCounter": 2,
+        "inBytes": 1012,
+        "outBytes": 599,
+        "responses": {
+          "1xx": 0,
+          "2xx": 2,
+          "3xx": 0,
+          "4xx": 0,
+          "5xx": 0
+        }
+      },
+      "/::+Inf": {
+        "requestCounter": 1,
+        "inBytes": 0,
+        "outBytes": 0,
+        "responses": {
+          "1xx": 0,
+          "2xx": 1,
+          "3xx": 0,
+          "4xx": 0,
+          "5xx": 0
+        }
+      }
+    },
     "ingress-with-valid-duplicate-path.sandbox.cosmic.sky": {
       "/path/::some-app.10.254.204.100.8080": {
         "requestCounter": 10,
@@ -2699,6 +5334,38 @@ var statusResponseBody = []byte(`{
           "5xx": 0
         }
       }
+    ],
+    "some-app.10.254.204.100.8080": [
+      {
+        "server": "10.254.204.100:8080",
+        "requestCounter": 12,
+        "inBytes": 5000,
+        "outBytes": 2000,
+        "responses": {
+          "1xx": 0,
+          "2xx": 9,
+          "3xx": 0,
+          "4xx": 0,
+          "5xx": 3
+        },
+        "responseMsec": 250,
+        "weight": 1,
+        "maxFails": 1,
+        "failTimeout": 10,
+        "backup": false,
+        "down": false,
+        "overCounts": {
+          "maxIntegerSize": 18446744073709551615,
+          "requestCounter": 0,
+          "inBytes": 0,
+          "outBytes": 0,
+          "1xx": 0,
+          "2xx": 0,
+          "3xx": 0,
+          "4xx": 0,
+          "5xx": 0
+        }
+      }
     ]
   }
 }
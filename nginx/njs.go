@@ -0,0 +1,67 @@
+package nginx
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var njsModuleName = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+
+// njsImport is a JavaScript file imported by the njs module. Its functions are referenced as name.function.
+type njsImport struct {
+	Name string
+	Path string
+}
+
+// NJSImports names each of the NJSModules after its file name without the .js extension.
+func (c Conf) NJSImports() []njsImport {
+	var imports []njsImport
+	for _, path := range c.NJSModules {
+		imports = append(imports, njsImport{Name: strings.TrimSuffix(filepath.Base(path), ".js"), Path: path})
+	}
+	return imports
+}
+
+// checkNJSModules fails if a module's name isn't a JavaScript identifier, or is the same as another module's.
+func (n *nginxUpdater) checkNJSModules() error {
+	names := make(map[string]bool)
+	for _, module := range n.NJSImports() {
+		if !njsModuleName.MatchString(module.Name) {
+			return fmt.Errorf("njs module %s must be named as a JavaScript identifier", module.Path)
+		}
+		if names[module.Name] {
+			return fmt.Errorf("njs module %s has the same name as another module", module.Path)
+		}
+		names[module.Name] = true
+	}
+	return nil
+}
+
+// checkNJSHandlers ignores handlers in modules which aren't loaded, as nginx can't start with them.
+func (n *nginxUpdater) checkNJSHandlers(servers []*server) {
+	loaded := make(map[string]bool)
+	for _, module := range n.NJSImports() {
+		loaded[module.Name] = true
+	}
+	known := func(handler string) bool {
+		return loaded[strings.SplitN(handler, ".", 2)[0]]
+	}
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			if l.NJSContent != "" && !known(l.NJSContent) {
+				log.Warnf("Ignoring njs content handler %s on %s%s as its module isn't loaded", l.NJSContent,
+					s.ServerName, l.Path)
+				l.NJSContent = ""
+			}
+			if l.NJSHeaderFilter != "" && !known(l.NJSHeaderFilter) {
+				log.Warnf("Ignoring njs header filter %s on %s%s as its module isn't loaded", l.NJSHeaderFilter,
+					s.ServerName, l.Path)
+				l.NJSHeaderFilter = ""
+			}
+		}
+	}
+}
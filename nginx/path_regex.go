@@ -0,0 +1,18 @@
+package nginx
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// checkPathRegexes stops stripping the path of regex locations, as nginx can't replace the part of the path matched
+// by a regex when proxying.
+func checkPathRegexes(servers []*server) {
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			if l.PathRegex && l.StripPath {
+				log.Warnf("Not stripping the path of %s%s, as it's a regex", s.ServerName, l.Path)
+				l.StripPath = false
+			}
+		}
+	}
+}
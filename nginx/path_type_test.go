@@ -0,0 +1,112 @@
+package nginx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+type ingressPath struct {
+	path     string
+	pathType string
+}
+
+// matchLocation picks the location nginx uses for a request, returning its upstream, or redirected if nginx
+// redirects the request to add a trailing slash instead.
+func matchLocation(s *server, uri string) (upstreamID string, redirected bool) {
+	for _, l := range s.Locations {
+		if l.ExactPath && l.Path == uri {
+			return l.UpstreamID, false
+		}
+	}
+	for _, r := range s.TrailingSlashRedirects {
+		if r.Path == uri {
+			return "", true
+		}
+	}
+	var longest *location
+	for _, l := range s.Locations {
+		if l.ExactPath {
+			continue
+		}
+		if l.Path == uri+"/" {
+			// nginx's own redirect of a proxied prefix location without its trailing slash
+			return "", true
+		}
+		if strings.HasPrefix(uri, l.Path) && (longest == nil || len(l.Path) > len(longest.Path)) {
+			longest = l
+		}
+	}
+	if longest == nil {
+		return "", false
+	}
+	return longest.UpstreamID, false
+}
+
+// The examples in https://kubernetes.io/docs/concepts/services-networking/ingress/#examples
+func TestPathTypesMatchTheIngressSpec(t *testing.T) {
+	tests := []struct {
+		paths   []ingressPath
+		request string
+		// index of the path the request is routed to, or -1 if it's not routed
+		expected int
+	}{
+		{[]ingressPath{{"/", "Prefix"}}, "/", 0},
+		{[]ingressPath{{"/", "Prefix"}}, "/foo/bar", 0},
+		{[]ingressPath{{"/foo", "Exact"}}, "/foo", 0},
+		{[]ingressPath{{"/foo", "Exact"}}, "/bar", -1},
+		{[]ingressPath{{"/foo", "Exact"}}, "/foo/", -1},
+		{[]ingressPath{{"/foo/", "Exact"}}, "/foo", -1},
+		{[]ingressPath{{"/foo", "Prefix"}}, "/foo", 0},
+		{[]ingressPath{{"/foo", "Prefix"}}, "/foo/", 0},
+		{[]ingressPath{{"/foo/", "Prefix"}}, "/foo", 0},
+		{[]ingressPath{{"/foo/", "Prefix"}}, "/foo/", 0},
+		{[]ingressPath{{"/aaa/bb", "Prefix"}}, "/aaa/bbb", -1},
+		{[]ingressPath{{"/aaa/bbb", "Prefix"}}, "/aaa/bbb", 0},
+		{[]ingressPath{{"/aaa/bbb/", "Prefix"}}, "/aaa/bbb", 0},
+		{[]ingressPath{{"/aaa/bbb", "Prefix"}}, "/aaa/bbb/", 0},
+		{[]ingressPath{{"/aaa/bbb", "Prefix"}}, "/aaa/bbb/ccc", 0},
+		{[]ingressPath{{"/aaa/bbb", "Prefix"}}, "/aaa/bbbxyz", -1},
+		{[]ingressPath{{"/", "Prefix"}, {"/aaa", "Prefix"}}, "/aaa/ccc", 1},
+		{[]ingressPath{{"/", "Prefix"}, {"/aaa", "Prefix"}, {"/aaa/bbb", "Prefix"}}, "/aaa/bbb", 2},
+		{[]ingressPath{{"/", "Prefix"}, {"/aaa", "Prefix"}, {"/aaa/bbb", "Prefix"}}, "/ccc", 0},
+		{[]ingressPath{{"/aaa", "Prefix"}}, "/ccc", -1},
+		{[]ingressPath{{"/foo", "Prefix"}, {"/foo", "Exact"}}, "/foo", 1},
+		{[]ingressPath{{"/foo", "Prefix"}, {"/foo", "Exact"}}, "/foo/", 0},
+		// ImplementationSpecific keeps nginx's redirect to add the trailing slash
+		{[]ingressPath{{"/foo", "ImplementationSpecific"}}, "/foo", -1},
+		{[]ingressPath{{"/foo", "ImplementationSpecific"}}, "/foo/bar", 0},
+	}
+
+	n := New(Conf{}).(*nginxUpdater)
+	for _, test := range tests {
+		var entries controller.IngressEntries
+		for i, p := range test.paths {
+			entries = append(entries, controller.IngressEntry{
+				Host:           "foo.com",
+				Namespace:      "core",
+				Name:           fmt.Sprintf("path-%d", i),
+				Path:           p.path,
+				ServiceAddress: fmt.Sprintf("service-%d", i),
+				ServicePort:    8080,
+				ExactPath:      p.pathType == "Exact",
+				PrefixPath:     p.pathType == "Prefix",
+			})
+		}
+
+		servers := createServerEntries(entries)
+		n.handleTrailingSlashes(servers)
+		routedTo, redirected := matchLocation(servers[0], test.request)
+
+		description := fmt.Sprintf("%v requesting %s", test.paths, test.request)
+		if test.expected < 0 {
+			assert.Empty(t, routedTo, description)
+		} else {
+			assert.False(t, redirected, description)
+			assert.Equal(t, upstreamID(entries[test.expected]), routedTo, description)
+		}
+	}
+}
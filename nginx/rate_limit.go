@@ -0,0 +1,40 @@
+package nginx
+
+import (
+	"strconv"
+
+	"github.com/sky-uk/feed/controller"
+)
+
+// rateLimit limits the requests per second of each client address to a location, in its own zone.
+type rateLimit struct {
+	ID                int
+	RequestsPerSecond int
+	Burst             int
+}
+
+func newRateLimit(entry controller.IngressEntry) *rateLimit {
+	if entry.RateLimit == 0 {
+		return nil
+	}
+	return &rateLimit{RequestsPerSecond: entry.RateLimit, Burst: entry.RateLimitBurst}
+}
+
+// Zone is the shared memory zone counting the requests of each client address.
+func (r *rateLimit) Zone() string {
+	return "rate_limit_" + strconv.Itoa(r.ID)
+}
+
+// rateLimits numbers the rate limits of locations, so each gets its own zone.
+func rateLimits(servers []*server) []*rateLimit {
+	var limits []*rateLimit
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			if l.RateLimit != nil && l.RateLimit.ID == 0 {
+				l.RateLimit.ID = len(limits) + 1
+				limits = append(limits, l.RateLimit)
+			}
+		}
+	}
+	return limits
+}
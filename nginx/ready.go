@@ -0,0 +1,27 @@
+package nginx
+
+import (
+	"github.com/sky-uk/feed/controller"
+)
+
+// readyCanary is where the /ready location proxies to, so it's only ready if the canary ingress's backends are.
+type readyCanary struct {
+	Host       string
+	Path       string
+	UpstreamID string
+}
+
+// findReadyCanary is the first path of the ReadyCanary ingress, or nil if it has none. Regex paths are skipped, as
+// they can't be requested as they are.
+func (n *nginxUpdater) findReadyCanary(entries []controller.IngressEntry) *readyCanary {
+	var canary *readyCanary
+	for _, e := range entries {
+		if e.NamespaceName() != n.ReadyCanary || e.PathRegex {
+			continue
+		}
+		if canary == nil || e.Host+e.Path < canary.Host+canary.Path {
+			canary = &readyCanary{Host: e.Host, Path: e.Path, UpstreamID: upstreamID(e)}
+		}
+	}
+	return canary
+}
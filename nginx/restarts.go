@@ -0,0 +1,136 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRestartBackoff    = time.Second
+	defaultRestartMaxBackoff = time.Minute
+)
+
+// newNginxCmd is the command for the live nginx. A new one is needed each time nginx is started again.
+func newNginxCmd(conf Conf) *exec.Cmd {
+	cmd := exec.Command(conf.BinaryLocation, "-c", conf.nginxConfFile())
+	cmd.Stdout = log.StandardLogger().Writer()
+	cmd.Stderr = newErrorLogWriter()
+	cmd.Stdin = os.Stdin
+	return cmd
+}
+
+// process is the started nginx process, which is replaced when nginx is restarted.
+func (n *nginx) process() *os.Process {
+	n.Lock()
+	defer n.Unlock()
+	return n.Process
+}
+
+// restarted replaces the exited nginx with the started command.
+func (n *nginx) restarted(cmd *exec.Cmd) {
+	n.Lock()
+	defer n.Unlock()
+	n.Cmd = cmd
+	n.masterPid = 0
+}
+
+func (c Conf) restartBackoff(restarts int) time.Duration {
+	backoff := c.RestartBackoff
+	if backoff <= 0 {
+		backoff = defaultRestartBackoff
+	}
+	maxBackoff := c.restartMaxBackoff()
+	for i := 0; i < restarts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+func (c Conf) restartMaxBackoff() time.Duration {
+	if c.RestartMaxBackoff <= 0 {
+		return defaultRestartMaxBackoff
+	}
+	return c.RestartMaxBackoff
+}
+
+// restartNginx starts nginx again after it exited unexpectedly, backing off between attempts, so the controller and
+// health port stay up rather than feed exiting. It returns false if nginx is being stopped, or has exited more than
+// MaxRestarts times in a row.
+func (n *nginxUpdater) restartNginx(restarts *int, uptime time.Duration) bool {
+	if n.MaxRestarts <= 0 || n.isStopping() {
+		return false
+	}
+	if uptime >= n.restartMaxBackoff() {
+		*restarts = 0
+	}
+
+	for {
+		if *restarts >= n.MaxRestarts {
+			log.Errorf("Nginx has exited %d times in a row, so isn't being restarted again", *restarts+1)
+			n.restartHealth.Set(fmt.Errorf("nginx is not running, as it exited %d times in a row", *restarts+1))
+			restartLimitReached.Set(1)
+			return false
+		}
+
+		backoff := n.restartBackoff(*restarts)
+		*restarts++
+		log.Warnf("Restarting nginx in %v, restart %d of %d", backoff, *restarts, n.MaxRestarts)
+		n.restartHealth.Set(fmt.Errorf("nginx is not running, restart %d of %d is pending", *restarts, n.MaxRestarts))
+		select {
+		case <-n.stopCh:
+			return false
+		case <-time.After(backoff):
+		}
+
+		started, err := n.startAgain()
+		if err != nil {
+			log.Errorf("Unable to restart nginx: %v", err)
+			continue
+		}
+		if started {
+			n.restartHealth.Set(nil)
+		}
+		return started
+	}
+}
+
+func (n *nginxUpdater) isStopping() bool {
+	n.restartLock.Lock()
+	defer n.restartLock.Unlock()
+	return n.stopping
+}
+
+// startAgain starts a new nginx with the current config, unless nginx is being stopped.
+func (n *nginxUpdater) startAgain() (bool, error) {
+	n.restartLock.Lock()
+	defer n.restartLock.Unlock()
+	if n.stopping {
+		return false, nil
+	}
+
+	// nginx's sockets are left behind if it was killed, unlike the exemplar socket which feed listens on
+	for _, socket := range []string{n.UnixSocket, n.SSLPassthroughSocket()} {
+		if socket == "" {
+			continue
+		}
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("unable to remove unix socket %s: %v", socket, err)
+		}
+	}
+	cmd := newNginxCmd(n.Conf)
+	if err := cmd.Start(); err != nil {
+		return false, fmt.Errorf("unable to start nginx: %v", err)
+	}
+	n.nginx.restarted(cmd)
+	n.running.Set(true)
+	nginxRestarts.Inc()
+	log.Infof("Restarted nginx as process %d", cmd.Process.Pid)
+	return true, nil
+}
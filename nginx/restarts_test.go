@@ -0,0 +1,68 @@
+package nginx
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sky-uk/feed/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartBackoffDoublesUpToTheMax(t *testing.T) {
+	conf := Conf{RestartBackoff: time.Second, RestartMaxBackoff: 5 * time.Second}
+
+	assert.Equal(t, time.Second, conf.restartBackoff(0))
+	assert.Equal(t, 2*time.Second, conf.restartBackoff(1))
+	assert.Equal(t, 4*time.Second, conf.restartBackoff(2))
+	assert.Equal(t, 5*time.Second, conf.restartBackoff(3))
+	assert.Equal(t, 5*time.Second, conf.restartBackoff(100))
+	assert.Equal(t, defaultRestartBackoff, Conf{}.restartBackoff(0))
+}
+
+func TestNginxIsRestartedUntilItExitsTooManyTimesInARow(t *testing.T) {
+	asserter := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.MaxRestarts = 1
+	conf.RestartBackoff = smallWaitTime
+	lb := newNginxWithConf(conf).(*nginxUpdater)
+	asserter.NoError(lb.Start())
+	asserter.NoError(lb.Update([]controller.IngressEntry{{Host: "james.com"}}))
+	restartsBefore := testutil.ToFloat64(nginxRestarts)
+
+	first := lb.nginx.process().Pid
+	asserter.NoError(syscall.Kill(first, syscall.SIGKILL))
+	asserter.Eventually(func() bool { return lb.running.Get() && lb.nginx.process().Pid != first },
+		time.Second, smallWaitTime, "nginx should be restarted")
+	asserter.NoError(lb.restartHealth.Get())
+	asserter.Equal(restartsBefore+1, testutil.ToFloat64(nginxRestarts))
+
+	asserter.NoError(syscall.Kill(lb.nginx.process().Pid, syscall.SIGKILL))
+	<-lb.doneCh
+	asserter.EqualError(lb.Health(), "nginx is not running, as it exited 2 times in a row")
+	asserter.Equal(1.0, testutil.ToFloat64(restartLimitReached))
+	asserter.NoError(lb.Stop())
+}
+
+func TestNginxIsNotRestartedWhenStopped(t *testing.T) {
+	asserter := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.MaxRestarts = 3
+	conf.RestartBackoff = smallWaitTime
+	lb := newNginxWithConf(conf).(*nginxUpdater)
+	asserter.NoError(lb.Start())
+	asserter.NoError(lb.Update([]controller.IngressEntry{{Host: "james.com"}}))
+
+	asserter.NoError(lb.Stop())
+	time.Sleep(2 * smallWaitTime)
+	asserter.False(lb.running.Get())
+	asserter.EqualError(lb.Health(), "nginx is not running")
+}
@@ -0,0 +1,189 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/util"
+)
+
+// minRollbackRequests is how many requests there must be after a reload before their server error ratio is trusted.
+const minRollbackRequests = 50
+
+// workerCrashes counts the workers which have crashed, as seen in the error log.
+var workerCrashes util.SafeInt
+
+// reloadSignals are the measures of nginx's health which are compared before and after a reload.
+type reloadSignals struct {
+	workerCrashes int
+	// requests and serverErrors are the totals of all server zones, or -1 if the status page couldn't be read
+	requests, serverErrors float64
+}
+
+func (n *nginxUpdater) rollbackEnabled() bool {
+	return n.RollbackWindow > 0
+}
+
+func (n *nginxUpdater) configHistoryFile(i int) string {
+	return n.nginxConfFile() + "." + strconv.Itoa(i)
+}
+
+// keepConfigHistory saves the config being replaced as nginx.conf.1, moving the older ones up to nginx.conf.<N>.
+func (n *nginxUpdater) keepConfigHistory(replaced []byte) {
+	if n.ConfigHistory <= 0 {
+		return
+	}
+	for i := n.ConfigHistory; i > 1; i-- {
+		if err := os.Rename(n.configHistoryFile(i-1), n.configHistoryFile(i)); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Unable to keep previous nginx config: %v", err)
+		}
+	}
+	// only feed's user can read them, like the API keys, in case they're copied elsewhere
+	if err := ioutil.WriteFile(n.configHistoryFile(1), replaced, 0600); err != nil {
+		log.Warnf("Unable to keep previous nginx config: %v", err)
+	}
+}
+
+// rejected returns true if the config was rolled back after a failed reload, so it isn't loaded again until the
+// ingresses or anything else it's generated from changes. Called with configLock held.
+func (n *nginxUpdater) rejected(config []byte) bool {
+	return n.rejectedConfig != nil && bytes.Equal(config, n.rejectedConfig)
+}
+
+func (n *nginxUpdater) currentReloadSignals() reloadSignals {
+	signals := reloadSignals{workerCrashes: workerCrashes.Get(), requests: -1, serverErrors: -1}
+	if n.RollbackServerErrorRatio <= 0 {
+		return signals
+	}
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/%s", n.HealthPort, statusPath))
+	if err != nil {
+		log.Debugf("Unable to read nginx status for rollback: %v", err)
+		return signals
+	}
+	defer resp.Body.Close()
+	status, err := parseStatusBody(resp.Body)
+	if err != nil {
+		log.Debugf("Unable to parse nginx status for rollback: %v", err)
+		return signals
+	}
+	if total, ok := status.ServerZones["*"]; ok && total.Responses != nil {
+		signals.requests, signals.serverErrors = total.RequestCounter, total.Responses.FiveXX
+	}
+	return signals
+}
+
+// reloadFailed returns why the reload failed, comparing the signals from before and after it, or empty if it didn't.
+func reloadFailed(before, after reloadSignals, maxServerErrorRatio float64) string {
+	if crashes := after.workerCrashes - before.workerCrashes; crashes > 0 {
+		return fmt.Sprintf("%d workers crashed", crashes)
+	}
+	if maxServerErrorRatio <= 0 || before.requests < 0 || after.requests < 0 {
+		return ""
+	}
+	requests := after.requests - before.requests
+	if requests < minRollbackRequests {
+		return ""
+	}
+	if ratio := (after.serverErrors - before.serverErrors) / requests; ratio > maxServerErrorRatio {
+		return fmt.Sprintf("%.0f%% of %.0f requests were server errors", ratio*100, requests)
+	}
+	return ""
+}
+
+// watchReload waits for the RollbackWindow after a reload, and rolls back to the last good config if the reload
+// failed. The signals are of all of nginx, so the failure must then clear for another window, or else it wasn't
+// caused by the reload, such as a backend failing at the same time, and the config is loaded again. Reloads are held
+// until it returns.
+func (n *nginxUpdater) watchReload(reloaded []byte, before reloadSignals) {
+	if !n.waitForRollbackWindow() {
+		return
+	}
+	reason := reloadFailed(before, n.currentReloadSignals(), n.RollbackServerErrorRatio)
+	if reason == "" {
+		n.lastGoodConfig = reloaded
+		return
+	}
+	if err := n.rollback(reloaded, reason); err != nil {
+		log.Errorf("Unable to roll back nginx config after a failed reload (%s): %v", reason, err)
+		return
+	}
+
+	rolledBack := n.currentReloadSignals()
+	if !n.waitForRollbackWindow() {
+		return
+	}
+	if carriedOn := reloadFailed(rolledBack, n.currentReloadSignals(), n.RollbackServerErrorRatio); carriedOn != "" {
+		log.Warnf("The failure carried on after rolling back (%s), so it wasn't caused by the reload", carriedOn)
+		if err := n.restore(reloaded); err != nil {
+			log.Errorf("Unable to load the rolled back nginx config again: %v", err)
+		}
+	}
+}
+
+// waitForRollbackWindow returns true once the RollbackWindow has passed, or false if nginx is stopped first.
+func (n *nginxUpdater) waitForRollbackWindow() bool {
+	select {
+	case <-n.doneCh:
+		return false
+	case <-time.After(n.RollbackWindow):
+		return true
+	}
+}
+
+// rollback loads the last good config, and keeps the failed one from being loaded again.
+func (n *nginxUpdater) rollback(failed []byte, reason string) error {
+	n.configLock.Lock()
+	defer n.configLock.Unlock()
+
+	if n.lastGoodConfig == nil {
+		return fmt.Errorf("there is no previous config to roll back to")
+	}
+	if _, err := writeFile(n.nginxConfFile(), n.lastGoodConfig); err != nil {
+		return err
+	}
+	if err := n.checkNginxConfig(); err != nil {
+		return err
+	}
+	if err := n.nginx.sighup(); err != nil {
+		incrementReloadFailureMetric()
+		return err
+	}
+	incrementReloadMetric()
+	configRollbacks.Inc()
+	log.Errorf("Rolled back to the last good nginx config, as the reload failed: %s", reason)
+
+	n.rejectedConfig = failed
+	// the next update regenerates the config, in case it changed since the failed reload
+	n.lastConfigHash = configHash{}
+	return nil
+}
+
+// restore loads a config which was rolled back again, as the failure wasn't caused by it. It becomes the last good
+// config without being watched, so a failure which carries on doesn't keep rolling it back.
+func (n *nginxUpdater) restore(config []byte) error {
+	n.configLock.Lock()
+	defer n.configLock.Unlock()
+
+	n.rejectedConfig = nil
+	n.lastConfigHash = configHash{}
+	if _, err := writeFile(n.nginxConfFile(), config); err != nil {
+		return err
+	}
+	if err := n.checkNginxConfig(); err != nil {
+		return err
+	}
+	if err := n.nginx.sighup(); err != nil {
+		incrementReloadFailureMetric()
+		return err
+	}
+	incrementReloadMetric()
+	n.lastGoodConfig = config
+	log.Info("Loaded the rolled back nginx config again")
+	return nil
+}
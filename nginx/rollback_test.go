@@ -0,0 +1,119 @@
+package nginx
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sky-uk/feed/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadFailsWhenWorkersCrash(t *testing.T) {
+	before := reloadSignals{workerCrashes: 3, requests: -1, serverErrors: -1}
+
+	assert.Equal(t, "", reloadFailed(before, before, 0.5))
+	assert.Equal(t, "2 workers crashed", reloadFailed(before, reloadSignals{workerCrashes: 5}, 0))
+}
+
+func TestReloadFailsWithTooManyServerErrors(t *testing.T) {
+	before := reloadSignals{requests: 1000, serverErrors: 10}
+
+	assert.Equal(t, "", reloadFailed(before, reloadSignals{requests: 1100, serverErrors: 30}, 0.5))
+	assert.Equal(t, "60% of 100 requests were server errors",
+		reloadFailed(before, reloadSignals{requests: 1100, serverErrors: 70}, 0.5))
+	assert.Equal(t, "", reloadFailed(before, reloadSignals{requests: 1100, serverErrors: 70}, 0),
+		"should only check server errors with a ratio")
+	assert.Equal(t, "", reloadFailed(before, reloadSignals{requests: 1010, serverErrors: 20}, 0.5),
+		"should need enough requests")
+	assert.Equal(t, "", reloadFailed(before, reloadSignals{requests: -1, serverErrors: -1}, 0.5),
+		"should skip server errors without the status page")
+}
+
+func TestRolledBackConfigIsNotLoadedAgain(t *testing.T) {
+	assert := assert.New(t)
+	tmpDir := setupWorkDir(t)
+	defer os.Remove(tmpDir)
+
+	conf := newConf(tmpDir, fakeNginx)
+	conf.RollbackWindow = time.Minute
+	n := New(conf).(*nginxUpdater)
+	good := []controller.IngressEntry{{Host: "good.com", Path: "/", ServiceAddress: "good", ServicePort: 8080}}
+	bad := []controller.IngressEntry{{Host: "bad.com", Path: "/", ServiceAddress: "bad", ServicePort: 8080}}
+
+	assert.NoError(n.Start())
+	assert.NoError(n.Update(good))
+	failed, err := n.createConfig(bad)
+	assert.NoError(err)
+	n.rejectedConfig = failed
+
+	assert.NoError(n.Update(bad))
+	config, err := ioutil.ReadFile(tmpDir + "/nginx.conf")
+	assert.NoError(err)
+	assert.Contains(string(config), "server_name good.com;")
+	assert.NoError(n.Stop())
+}
+
+func TestFailuresWhichClearAfterRollingBackRejectTheConfig(t *testing.T) {
+	assert := assert.New(t)
+	n, good, bad := startReloadedWithBadConfig(t)
+	defer os.Remove(n.WorkingDir)
+	defer n.Stop()
+
+	before := n.currentReloadSignals()
+	workerCrashes.Add(1)
+	n.watchReload(bad, before)
+
+	config, err := ioutil.ReadFile(n.nginxConfFile())
+	assert.NoError(err)
+	assert.Equal(string(good), string(config))
+	assert.Equal(bad, n.rejectedConfig)
+}
+
+func TestFailuresWhichCarryOnAfterRollingBackDontRejectTheConfig(t *testing.T) {
+	assert := assert.New(t)
+	n, _, bad := startReloadedWithBadConfig(t)
+	defer os.Remove(n.WorkingDir)
+	defer n.Stop()
+
+	crashing := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-crashing:
+				return
+			case <-time.After(10 * time.Millisecond):
+				workerCrashes.Add(1)
+			}
+		}
+	}()
+	n.watchReload(bad, n.currentReloadSignals())
+	close(crashing)
+
+	config, err := ioutil.ReadFile(n.nginxConfFile())
+	assert.NoError(err)
+	assert.Equal(string(bad), string(config))
+	assert.Nil(n.rejectedConfig)
+	assert.Equal(bad, n.lastGoodConfig)
+}
+
+// startReloadedWithBadConfig starts nginx with a good config, then writes a bad one as if it had been reloaded. The
+// signaller doesn't reload within the test, so watchReload can be called directly.
+func startReloadedWithBadConfig(t *testing.T) (*nginxUpdater, []byte, []byte) {
+	tmpDir := setupWorkDir(t)
+	conf := newConf(tmpDir, fakeNginx)
+	conf.RollbackWindow = 100 * time.Millisecond
+	conf.UpdatePeriod = time.Minute
+	n := New(conf).(*nginxUpdater)
+
+	assert.NoError(t, n.Start())
+	assert.NoError(t, n.Update([]controller.IngressEntry{{Host: "good.com", Path: "/", ServiceAddress: "good", ServicePort: 8080}}))
+	good, err := ioutil.ReadFile(n.nginxConfFile())
+	assert.NoError(t, err)
+	n.lastGoodConfig = good
+	bad, err := n.createConfig([]controller.IngressEntry{{Host: "bad.com", Path: "/", ServiceAddress: "bad", ServicePort: 8080}})
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(n.nginxConfFile(), bad, 0644))
+	return n, good, bad
+}
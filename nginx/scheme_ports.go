@@ -0,0 +1,42 @@
+package nginx
+
+// schemeFilterPrefix prefixes the vhost stats filter groups counting the requests to ports of each frontend scheme,
+// e.g. "scheme@internal" with a zone per host.
+const schemeFilterPrefix = "scheme@"
+
+// On is the server as rendered on the port: only its locations of ingresses with the port's frontend scheme, or all
+// of them if the port doesn't have one. Nil if it has none on the port.
+func (s *server) On(port Port) *server {
+	if port.Scheme == "" {
+		return s
+	}
+
+	var locs []*location
+	for _, l := range s.Locations {
+		if l.FrontendScheme == port.Scheme {
+			locs = append(locs, l)
+		}
+	}
+	if len(locs) == 0 {
+		return nil
+	}
+	if len(locs) == len(s.Locations) {
+		return s
+	}
+
+	scoped := *s
+	scoped.Locations = locs
+	scoped.TrailingSlashRedirects = nil
+	for _, redirect := range s.TrailingSlashRedirects {
+		if findLocation(locs, redirect.Path+"/") != nil {
+			scoped.TrailingSlashRedirects = append(scoped.TrailingSlashRedirects, redirect)
+		}
+	}
+	return &scoped
+}
+
+// On is whether the host is passed through on the port: if it's of the port's frontend scheme, or the port doesn't
+// have one.
+func (p *passthrough) On(port Port) bool {
+	return port.Scheme == "" || p.FrontendScheme == port.Scheme
+}
@@ -0,0 +1,69 @@
+package nginx
+
+import (
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// securityHeader is a response header added to every response from a location.
+type securityHeader struct {
+	Name  string
+	Value string
+}
+
+var securityHeaderProfiles = map[string][]securityHeader{
+	"off": nil,
+	"basic": {
+		{"X-Content-Type-Options", "nosniff"},
+		{"X-Frame-Options", "SAMEORIGIN"},
+		{"Referrer-Policy", "strict-origin-when-cross-origin"},
+	},
+	"strict": {
+		{"X-Content-Type-Options", "nosniff"},
+		{"X-Frame-Options", "DENY"},
+		{"Referrer-Policy", "no-referrer"},
+		{"Permissions-Policy", "accelerometer=(), camera=(), geolocation=(), gyroscope=(), magnetometer=(), " +
+			"microphone=(), payment=(), usb=()"},
+	},
+}
+
+// SecurityHeaderProfiles are the names of the supported security header profiles.
+func SecurityHeaderProfiles() []string {
+	var names []string
+	for name := range securityHeaderProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkSecurityHeaders fails if the default security header profile doesn't exist.
+func (n *nginxUpdater) checkSecurityHeaders() error {
+	if _, ok := securityHeaderProfiles[n.SecurityHeaders]; !ok && n.SecurityHeaders != "" {
+		return fmt.Errorf("unknown security headers profile %q, must be one of %v", n.SecurityHeaders,
+			SecurityHeaderProfiles())
+	}
+	return nil
+}
+
+// setSecurityHeaders sets the headers of each location's security header profile, or the default profile if the
+// location doesn't have one.
+func (n *nginxUpdater) setSecurityHeaders(servers []*server) {
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			profile := l.SecurityProfile
+			if profile == "" {
+				profile = n.SecurityHeaders
+			}
+			headers, ok := securityHeaderProfiles[profile]
+			if !ok {
+				log.Warnf("Ignoring unknown security headers profile %q on %s%s, must be one of %v. Using default",
+					profile, s.ServerName, l.Path, SecurityHeaderProfiles())
+				headers = securityHeaderProfiles[n.SecurityHeaders]
+			}
+			l.SecurityHeaders = headers
+		}
+	}
+}
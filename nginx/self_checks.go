@@ -0,0 +1,107 @@
+package nginx
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+const defaultSelfCheckInterval = 30 * time.Second
+
+var selfChecksOnce sync.Once
+var selfCheckSuccess *prometheus.GaugeVec
+var selfCheckDuration *prometheus.HistogramVec
+
+// selfCheckAddress is the first plain http port of the live nginx, which the self checks are requested from.
+func (c Conf) selfCheckAddress() (string, error) {
+	host := c.IngressBindAddress
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	for _, port := range c.Ports {
+		if !port.SSL && !port.ProxyProtocol && port.Socket == "" {
+			return net.JoinHostPort(host, strconv.Itoa(port.Port)), nil
+		}
+	}
+	return "", errors.New("self checks need a plain http port without the PROXY protocol")
+}
+
+func (n *nginxUpdater) checkSelfChecks() error {
+	if len(n.SelfChecks) == 0 {
+		return nil
+	}
+	if _, err := parseProbes("self check", n.SelfChecks); err != nil {
+		return err
+	}
+	_, err := n.selfCheckAddress()
+	return err
+}
+
+// periodicallySelfCheck requests each self check through the live nginx, recording whether it succeeded and how long
+// it took, to catch broken reloads which nginx -t can't.
+func (n *nginxUpdater) periodicallySelfCheck() {
+	checks, err := parseProbes("self check", n.SelfChecks)
+	if err != nil || len(checks) == 0 {
+		return
+	}
+	address, err := n.selfCheckAddress()
+	if err != nil {
+		return
+	}
+	initSelfCheckMetrics()
+
+	interval := n.SelfCheckInterval
+	if interval <= 0 {
+		interval = defaultSelfCheckInterval
+	}
+	client := &http.Client{
+		Timeout: interval,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.doneCh:
+			return
+		case <-ticker.C:
+			for _, check := range checks {
+				runSelfCheck(client, address, check)
+			}
+		}
+	}
+}
+
+func initSelfCheckMetrics() {
+	selfChecksOnce.Do(func() {
+		selfCheckSuccess = metrics.RegisterNewDefaultGaugeVec(metrics.PrometheusIngressSubsystem,
+			"self_check_success",
+			"Set to 1 if the last request for the self check through nginx succeeded, or 0 if it got a connection "+
+				"error or a 5xx response.", []string{"check"})
+		selfCheckDuration = metrics.RegisterNewDefaultHistogramVec(metrics.PrometheusIngressSubsystem,
+			"self_check_duration_seconds", "Time taken by the requests for each self check through nginx.",
+			nil, []string{"check"})
+	})
+}
+
+func runSelfCheck(client *http.Client, address string, check validationProbe) {
+	start := time.Now()
+	status, err := check.request(client, address)
+	selfCheckDuration.WithLabelValues(check.String()).Observe(time.Since(start).Seconds())
+	if err != nil {
+		log.Warnf("Self check %s failed: %v", check, err)
+		selfCheckSuccess.WithLabelValues(check.String()).Set(0)
+		return
+	}
+	log.Debugf("Self check %s got status %d", check, status)
+	selfCheckSuccess.WithLabelValues(check.String()).Set(1)
+}
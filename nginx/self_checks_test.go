@@ -0,0 +1,48 @@
+package nginx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfChecksRecordSuccessAndDuration(t *testing.T) {
+	initSelfCheckMetrics()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "broken.com" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+	client := &http.Client{Timeout: time.Second}
+
+	runSelfCheck(client, address, validationProbe{"ok.com", "/health"})
+	runSelfCheck(client, address, validationProbe{"broken.com", "/"})
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(selfCheckSuccess.WithLabelValues("ok.com/health")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(selfCheckSuccess.WithLabelValues("broken.com/")))
+	assert.Equal(t, 2, testutil.CollectAndCount(selfCheckDuration))
+}
+
+func TestSelfChecksAreMadeOnTheFirstPlainHTTPPort(t *testing.T) {
+	conf := Conf{Ports: []Port{{Name: "https", Port: 443, SSL: true}, {Name: "http", Port: 80, ProxyProtocol: true},
+		{Name: "unix", Socket: "/var/run/feed.sock"}, {Name: "http", Port: 8080}}}
+
+	address, err := conf.selfCheckAddress()
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8080", address)
+
+	conf.IngressBindAddress = "::1"
+	address, _ = conf.selfCheckAddress()
+	assert.Equal(t, "[::1]:8080", address)
+
+	conf.Ports = conf.Ports[:3]
+	_, err = conf.selfCheckAddress()
+	assert.EqualError(t, err, "self checks need a plain http port without the PROXY protocol")
+}
@@ -0,0 +1,40 @@
+package nginx
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// loadSessionTicketKeys returns the session ticket key files in dir in lexical order. The first key encrypts
+// new tickets, and the rest are only used to decrypt tickets issued by previous keys. Keys must be 48 or 80
+// bytes, as generated by "openssl rand 80".
+func loadSessionTicketKeys(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+		// Secret volumes contain hidden directories and symlinks used for atomic updates.
+		if file.Name()[0] == '.' {
+			continue
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Warnf("Ignoring session ticket key %s: %v", path, err)
+			continue
+		}
+		if len(contents) != 48 && len(contents) != 80 {
+			log.Warnf("Ignoring session ticket key %s as it is %d bytes, rather than 48 or 80", path, len(contents))
+			continue
+		}
+		keys = append(keys, path)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
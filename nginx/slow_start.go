@@ -0,0 +1,112 @@
+package nginx
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// slowStartWeight multiplies the weights of an upstream's warm servers while others are slow starting, which ramp up
+// to their own multiplied weight in steps of 10%.
+const slowStartWeight = 10
+
+// slowStartCheckInterval is how often ramping upstreams are moved on. Reloads are still limited by UpdatePeriod.
+const slowStartCheckInterval = time.Second * 5
+
+// serverAdditions are when each server of an upstream was added, by address. Servers which are warm have a zero time.
+type serverAdditions map[string]time.Time
+
+// applySlowStart ramps the weight of servers added to an existing upstream, such as new pods in endpoints mode, over
+// UpstreamSlowStart. nginx has no slow start of its own. The servers of a new upstream, or of one whose servers were
+// all replaced, get their full share at once, as there's nothing to share the traffic with. Removed servers are
+// dropped straight away.
+func (n *nginxUpdater) applySlowStart(upstreams []*upstream, now time.Time) {
+	if n.UpstreamSlowStart <= 0 {
+		return
+	}
+
+	additions := make(map[string]serverAdditions, len(upstreams))
+	for _, u := range upstreams {
+		previous := n.serverAdditions[u.ID]
+		warm := true
+		for _, s := range u.Servers {
+			if _, ok := previous[s.Address]; ok {
+				warm = false
+				break
+			}
+		}
+
+		added := make(serverAdditions, len(u.Servers))
+		ramping := false
+		for _, s := range u.Servers {
+			start, ok := previous[s.Address]
+			if !ok && !warm {
+				log.Infof("Slow starting %s in %s over %v", s.Address, u.ID, n.UpstreamSlowStart)
+				start = now
+			}
+			if !start.IsZero() && now.Sub(start) >= n.UpstreamSlowStart {
+				start = time.Time{}
+			}
+			added[s.Address] = start
+			if !start.IsZero() {
+				ramping = true
+			}
+		}
+		if ramping {
+			for _, s := range u.Servers {
+				weight := s.Weight
+				if weight == 0 {
+					weight = 1
+				}
+				s.Weight = slowStartWeight * weight
+				if start := added[s.Address]; !start.IsZero() {
+					s.Weight = int(time.Duration(s.Weight) * now.Sub(start) / n.UpstreamSlowStart)
+					if s.Weight < 1 {
+						s.Weight = 1
+					}
+				}
+			}
+		}
+		additions[u.ID] = added
+	}
+	n.serverAdditions = additions
+}
+
+// slowStarting is true while any server is ramping.
+func (n *nginxUpdater) slowStarting() bool {
+	n.configLock.Lock()
+	defer n.configLock.Unlock()
+	for _, added := range n.serverAdditions {
+		for _, start := range added {
+			if !start.IsZero() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// periodicallyRampUpstreams regenerates the config while upstreams are slow starting, so their traffic moves
+// across to the new servers at each reload.
+func (n *nginxUpdater) periodicallyRampUpstreams() {
+	ticker := time.NewTicker(slowStartCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.doneCh:
+			return
+		case <-ticker.C:
+			if !n.slowStarting() {
+				continue
+			}
+			changed, err := n.refreshNginxConf()
+			if err != nil {
+				log.Errorf("Unable to update nginx config for slow starting upstreams: %v", err)
+				continue
+			}
+			if changed {
+				n.signalRequired()
+			}
+		}
+	}
+}
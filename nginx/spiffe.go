@@ -0,0 +1,53 @@
+package nginx
+
+import (
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// File names of SVIDs from the SPIFFE Workload API, the same as spiffe-helper writes.
+const (
+	svidFile       = "svid.pem"
+	svidKeyFile    = "svid_key.pem"
+	svidBundleFile = "svid_bundle.pem"
+)
+
+// SVIDCertificate is the X.509 SVID presented to backends which require a SPIFFE identity.
+func (c Conf) SVIDCertificate() string {
+	return filepath.Join(c.SPIFFESVIDDir, svidFile)
+}
+
+// SVIDKey is the private key of the X.509 SVID.
+func (c Conf) SVIDKey() string {
+	return filepath.Join(c.SPIFFESVIDDir, svidKeyFile)
+}
+
+// SVIDBundle has the X.509 authorities of the trust bundles, which backends' SVIDs are verified against.
+func (c Conf) SVIDBundle() string {
+	return filepath.Join(c.SPIFFESVIDDir, svidBundleFile)
+}
+
+// svidFiles returns the SVID files nginx reads on reload, if any.
+func (c *Conf) svidFiles() []string {
+	if c.SPIFFESVIDDir == "" {
+		return nil
+	}
+	return []string{c.SVIDCertificate(), c.SVIDKey(), c.SVIDBundle()}
+}
+
+// checkBackendSPIFFE proxies to backends requiring a SPIFFE identity over plain http if there's no SVID to
+// present, as nginx can't start with a missing certificate.
+func (n *nginxUpdater) checkBackendSPIFFE(servers []*server) {
+	if n.SPIFFESVIDDir != "" {
+		return
+	}
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			if l.BackendSPIFFE {
+				log.Warnf("Ignoring backend spiffe annotation on %s%s as no SVID directory is set", s.ServerName, l.Path)
+				l.BackendSPIFFE = false
+			}
+		}
+	}
+}
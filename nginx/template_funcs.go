@@ -0,0 +1,129 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the helpers available to nginx templates, in addition to the methods of Conf. They're a subset
+// of sprig's functions, with the same names and argument order, so they're familiar to template authors.
+var templateFuncs = template.FuncMap{
+	"default":    defaultValue,
+	"empty":      empty,
+	"coalesce":   coalesce,
+	"ternary":    ternary,
+	"toString":   toString,
+	"atoi":       atoi,
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       join,
+	"quote":      func(v interface{}) string { return strconv.Quote(toString(v)) },
+	"squote":     func(v interface{}) string { return "'" + toString(v) + "'" },
+	"indent":     indent,
+	"nindent":    func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+	"add":        func(a, b int) int { return a + b },
+	"sub":        func(a, b int) int { return a - b },
+	"mul":        func(a, b int) int { return a * b },
+	"div":        func(a, b int) int { return a / b },
+	"list":       func(v ...interface{}) []interface{} { return v },
+	"dict":       dict,
+	"env":        os.Getenv,
+}
+
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	default:
+		return value.IsZero()
+	}
+}
+
+func defaultValue(def interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || empty(given[0]) {
+		return def
+	}
+	return given[0]
+}
+
+func coalesce(v ...interface{}) interface{} {
+	for _, value := range v {
+		if !empty(value) {
+			return value
+		}
+	}
+	return nil
+}
+
+func ternary(vtrue, vfalse interface{}, condition bool) interface{} {
+	if condition {
+		return vtrue
+	}
+	return vfalse
+}
+
+func toString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
+
+func join(sep string, v interface{}) string {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return toString(v)
+	}
+	parts := make([]string, value.Len())
+	for i := range parts {
+		parts[i] = toString(value.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
+
+func indent(spaces int, s string) string {
+	padding := strings.Repeat(" ", spaces)
+	return padding + strings.Replace(s, "\n", "\n"+padding, -1)
+}
+
+func dict(v ...interface{}) (map[string]interface{}, error) {
+	if len(v)%2 != 0 {
+		return nil, fmt.Errorf("dict requires key value pairs, but was given %d arguments", len(v))
+	}
+	d := make(map[string]interface{}, len(v)/2)
+	for i := 0; i < len(v); i += 2 {
+		d[toString(v[i])] = v[i+1]
+	}
+	return d, nil
+}
@@ -0,0 +1,77 @@
+package nginx
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const templatesCheckInterval = time.Second * 10
+
+func (n *nginxUpdater) setTemplateErr(err error) {
+	if err != nil {
+		templateErrors.Inc()
+	}
+	n.templateErr.Set(err)
+}
+
+// templatesFingerprint changes whenever the contents of any template, or the global deny file, changes.
+func (n *nginxUpdater) templatesFingerprint() (string, error) {
+	files := n.Templates
+	if n.GlobalDenyFile != "" {
+		files = append(append([]string{}, files...), n.GlobalDenyFile)
+	}
+
+	hash := sha256.New()
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		_, _ = hash.Write([]byte(file))
+		_, _ = hash.Write(contents)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// periodicallyCheckTemplates regenerates the config and reloads nginx whenever the templates or global deny file
+// change, such as when they're mounted from a ConfigMap. Invalid templates are reported by Health, and nginx keeps its last good config.
+func (n *nginxUpdater) periodicallyCheckTemplates() {
+	last, err := n.templatesFingerprint()
+	if err != nil {
+		log.Warnf("Unable to read nginx templates: %v", err)
+	}
+
+	ticker := time.NewTicker(templatesCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.doneCh:
+			return
+		case <-ticker.C:
+			current, err := n.templatesFingerprint()
+			if err != nil {
+				log.Warnf("Unable to read nginx templates: %v", err)
+				continue
+			}
+			if current == last {
+				continue
+			}
+			// the same templates aren't retried until they change again
+			last = current
+
+			log.Info("Nginx templates have changed, updating nginx config")
+			changed, err := n.refreshNginxConf()
+			if err != nil {
+				log.Errorf("Unable to update nginx config from the changed templates: %v", err)
+				continue
+			}
+			if changed {
+				n.signalRequired()
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package nginx
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const tlsFilesCheckInterval = time.Second * 30
+
+func (n *nginxUpdater) tlsFilesWatched() bool {
+	return n.hasHTTPSPort() || n.SPIFFESVIDDir != ""
+}
+
+// tlsFiles returns the certificates, keys and session ticket keys which nginx reads on reload.
+func (n *nginxUpdater) tlsFiles() ([]string, error) {
+	var files []string
+	for _, file := range append([]string{n.SSLPath + ".crt", n.SSLPath + ".key"}, n.svidFiles()...) {
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	if n.SSLCertificatesDir != "" {
+		certs, err := loadCertificates(n.SSLCertificatesDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			files = append(files, cert.path+".crt", cert.path+".key")
+		}
+	}
+	if n.SSLSessionTicketKeysDir != "" {
+		keys, err := loadSessionTicketKeys(n.SSLSessionTicketKeysDir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, keys...)
+	}
+	return files, nil
+}
+
+// tlsFilesFingerprint changes whenever certificates, SVIDs or session ticket keys are added, removed or rotated.
+func (n *nginxUpdater) tlsFilesFingerprint() (string, error) {
+	files, err := n.tlsFiles()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		_, _ = hash.Write([]byte(filepath.Clean(file)))
+		_, _ = hash.Write(contents)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// periodicallyCheckTLSFiles reloads nginx whenever certificates or session ticket keys change, so renewed
+// certificates are picked up without waiting for an ingress update.
+func (n *nginxUpdater) periodicallyCheckTLSFiles() {
+	last, err := n.tlsFilesFingerprint()
+	if err != nil {
+		log.Warnf("Unable to read TLS files: %v", err)
+	}
+
+	ticker := time.NewTicker(tlsFilesCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.doneCh:
+			return
+		case <-ticker.C:
+			current, err := n.tlsFilesFingerprint()
+			if err != nil {
+				log.Warnf("Unable to read TLS files: %v", err)
+				continue
+			}
+			if current == last {
+				continue
+			}
+
+			log.Info("Certificates or session ticket keys have changed, reloading nginx")
+			if _, err := n.refreshNginxConf(); err != nil {
+				log.Errorf("Unable to update nginx config with new TLS files: %v", err)
+				continue
+			}
+			// nginx only reads the contents of the files on reload
+			n.signalRequired()
+			last = current
+		}
+	}
+}
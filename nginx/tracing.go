@@ -0,0 +1,38 @@
+package nginx
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tracingSample is the proportion of requests to a location which are traced, or 0 to leave it to the tracer.
+type tracingSample float64
+
+// Percent is the sample as a percentage for split_clients, which allows up to two decimal places.
+func (s tracingSample) Percent() string {
+	percent := math.Max(math.Round(float64(s)*10000)/100, 0.01)
+	return strconv.FormatFloat(percent, 'f', -1, 64) + "%"
+}
+
+// Variable is set to 1 for sampled requests and 0 otherwise, for the sampling.priority tag.
+func (s tracingSample) Variable() string {
+	return "$tracing_sample_" + strings.Replace(strings.TrimSuffix(s.Percent(), "%"), ".", "_", -1)
+}
+
+// tracingSamples are the distinct sample rates of locations, so each gets one split_clients block.
+func tracingSamples(servers []*server) []tracingSample {
+	seen := make(map[tracingSample]bool)
+	var samples []tracingSample
+	for _, s := range servers {
+		for _, l := range s.Locations {
+			if l.TracingSample > 0 && !l.DisableTracing && !seen[l.TracingSample] {
+				seen[l.TracingSample] = true
+				samples = append(samples, l.TracingSample)
+			}
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples
+}
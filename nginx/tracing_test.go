@@ -0,0 +1,16 @@
+package nginx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracingSamplePercentages(t *testing.T) {
+	asserter := assert.New(t)
+	asserter.Equal("50%", tracingSample(0.5).Percent())
+	asserter.Equal("$tracing_sample_50", tracingSample(0.5).Variable())
+	asserter.Equal("0.01%", tracingSample(0.00001).Percent(), "split_clients can't go below 0.01%")
+	asserter.Equal("$tracing_sample_0_01", tracingSample(0.00001).Variable())
+	asserter.Equal("33.33%", tracingSample(1.0/3).Percent())
+}
@@ -0,0 +1,135 @@
+package nginx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const tracerConfigFile = "tracer-config.json"
+
+// tracingVendor is a preset for a vendor's OpenTracing plugin, so its config doesn't have to be written by hand.
+type tracingVendor struct {
+	plugin          string
+	defaultEndpoint string
+	config          func(serviceName, host string, port int) interface{}
+	// traceContext are the nginx variables of the context propagated to backends, joined by ':', which the trace ID
+	// and whether it's sampled are read from by sampledTraceID, for exemplars.
+	traceContext   string
+	sampledTraceID func(context string) (string, bool)
+}
+
+var tracingVendors = map[string]tracingVendor{
+	"jaeger": {
+		plugin:          "/usr/local/lib64/libjaegertracing.so",
+		defaultEndpoint: "localhost:6831",
+		config: func(serviceName, host string, port int) interface{} {
+			return map[string]interface{}{
+				"service_name": serviceName,
+				"sampler":      map[string]interface{}{"type": "const", "param": 1},
+				"reporter":     map[string]interface{}{"localAgentHostPort": net.JoinHostPort(host, strconv.Itoa(port))},
+			}
+		},
+		// uber-trace-id is trace-id:span-id:parent-span-id:flags, where flag 1 is sampled
+		traceContext: "$opentracing_context_uber_trace_id",
+		sampledTraceID: func(context string) (string, bool) {
+			fields := strings.Split(context, ":")
+			if len(fields) != 4 {
+				return "", false
+			}
+			flags, err := strconv.ParseUint(fields[3], 16, 8)
+			return fields[0], err == nil && flags&1 == 1
+		},
+	},
+	"zipkin": {
+		plugin:          "/usr/local/lib/libzipkin_opentracing_plugin.so",
+		defaultEndpoint: "localhost:9411",
+		config: func(serviceName, host string, port int) interface{} {
+			return map[string]interface{}{
+				"service_name":   serviceName,
+				"collector_host": host,
+				"collector_port": port,
+			}
+		},
+		traceContext: "$opentracing_context_x_b3_traceid:$opentracing_context_x_b3_sampled",
+		sampledTraceID: func(context string) (string, bool) {
+			fields := strings.Split(context, ":")
+			return fields[0], len(fields) == 2 && fields[1] == "1"
+		},
+	},
+	"datadog": {
+		plugin:          "/usr/local/lib/libdd_opentracing_plugin.so",
+		defaultEndpoint: "localhost:8126",
+		config: func(serviceName, host string, port int) interface{} {
+			return map[string]interface{}{
+				"service":    serviceName,
+				"agent_host": host,
+				"agent_port": port,
+			}
+		},
+		traceContext: "$opentracing_context_x_datadog_trace_id:$opentracing_context_x_datadog_sampling_priority",
+		sampledTraceID: func(context string) (string, bool) {
+			fields := strings.Split(context, ":")
+			if len(fields) != 2 {
+				return "", false
+			}
+			priority, err := strconv.Atoi(fields[1])
+			return fields[0], err == nil && priority > 0
+		},
+	},
+}
+
+// TracingVendors are the names of the supported tracing vendor presets.
+func TracingVendors() []string {
+	var names []string
+	for name := range tracingVendors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configureTracingVendor writes the tracer config for the TracingVendor preset, and uses its plugin unless
+// OpenTracingPlugin is set explicitly.
+func (n *nginxUpdater) configureTracingVendor() error {
+	if n.TracingVendor == "" {
+		return nil
+	}
+	vendor, ok := tracingVendors[n.TracingVendor]
+	if !ok {
+		return fmt.Errorf("unknown tracing vendor %q, must be one of %v", n.TracingVendor, TracingVendors())
+	}
+
+	endpoint := n.TracingEndpoint
+	if endpoint == "" {
+		endpoint = vendor.defaultEndpoint
+	}
+	host, portString, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid tracing endpoint %q: %v", endpoint, err)
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return fmt.Errorf("invalid tracing endpoint port %q: %v", portString, err)
+	}
+
+	config, err := json.MarshalIndent(vendor.config(n.TracingServiceName, host, port), "", "  ")
+	if err != nil {
+		return err
+	}
+	configFile := filepath.Join(n.ConfDir, tracerConfigFile)
+	if err := ioutil.WriteFile(configFile, config, 0644); err != nil {
+		return fmt.Errorf("unable to write tracer config: %v", err)
+	}
+
+	n.OpenTracingConfig = configFile
+	if n.OpenTracingPlugin == "" {
+		n.OpenTracingPlugin = vendor.plugin
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package nginx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	trailingSlashServe = "serve"
+	// nginx's own redirect of a prefix location's path without the trailing slash
+	trailingSlashDefault = "301"
+)
+
+// trailingSlashModes are the ways a path is handled without its trailing slash, being the status code it's
+// redirected with, or 0 to serve it as if it had the slash.
+var trailingSlashModes = map[string]int{
+	trailingSlashDefault: 301,
+	"302":                302,
+	"307":                307,
+	"308":                308,
+	trailingSlashServe:   0,
+}
+
+// trailingSlashRedirect redirects an exact path to the same path with a trailing slash.
+type trailingSlashRedirect struct {
+	Path string
+	Code int
+}
+
+// TrailingSlashModes are the names of the supported trailing slash modes.
+func TrailingSlashModes() []string {
+	var names []string
+	for name := range trailingSlashModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkTrailingSlash fails if the default trailing slash mode doesn't exist.
+func (n *nginxUpdater) checkTrailingSlash() error {
+	if _, ok := trailingSlashModes[n.TrailingSlash]; !ok && n.TrailingSlash != "" {
+		return fmt.Errorf("unknown trailing slash mode %q, must be one of %v", n.TrailingSlash, TrailingSlashModes())
+	}
+	return nil
+}
+
+// handleTrailingSlashes replaces nginx's 301 redirect of prefix locations requested without their trailing slash,
+// either serving them from an exact location or redirecting with another status code. Prefix paths are always
+// served, as the Ingress spec matches them element-wise.
+func (n *nginxUpdater) handleTrailingSlashes(servers []*server) {
+	for _, s := range servers {
+		added := false
+		for _, l := range s.Locations {
+			if l.ExactPath || l.PathRegex || l.Path == "/" || !strings.HasSuffix(l.Path, "/") {
+				continue
+			}
+			mode := l.TrailingSlash
+			if l.PrefixPath {
+				mode = trailingSlashServe
+			} else if mode == "" {
+				mode = n.TrailingSlash
+			}
+			code, ok := trailingSlashModes[mode]
+			if !ok {
+				log.Warnf("Ignoring unknown trailing slash mode %q on %s%s, must be one of %v. Using default",
+					mode, s.ServerName, l.Path, TrailingSlashModes())
+				mode = n.TrailingSlash
+				code = trailingSlashModes[mode]
+			}
+			if mode == "" || mode == trailingSlashDefault {
+				continue
+			}
+
+			path := strings.TrimSuffix(l.Path, "/")
+			if hasLocation(s.Locations, path) {
+				log.Warnf("Not changing the trailing slash redirect of %s%s as %s is already a location",
+					s.ServerName, l.Path, path)
+				continue
+			}
+			if code != 0 {
+				s.TrailingSlashRedirects = append(s.TrailingSlashRedirects, trailingSlashRedirect{path, code})
+				continue
+			}
+			exact := *l
+			exact.Path = path
+			exact.ExactPath = true
+			s.Locations = append(s.Locations, &exact)
+			added = true
+		}
+		if added {
+			sort.Sort(locations(s.Locations))
+		}
+	}
+}
+
+func hasLocation(locs []*location, path string) bool {
+	for _, l := range locs {
+		if l.Path == path && !l.PathRegex {
+			return true
+		}
+	}
+	return false
+}
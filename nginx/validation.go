@@ -0,0 +1,219 @@
+package nginx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultValidationTimeout = 10 * time.Second
+	validationPollInterval   = 50 * time.Millisecond
+)
+
+// validationProbe is a request made to the validation nginx, which must not fail for the new config to be loaded.
+type validationProbe struct {
+	host, path string
+}
+
+func (p validationProbe) String() string {
+	return p.host + p.path
+}
+
+// parseValidationProbes parses the ValidationProbes as host/path, where the path defaults to /.
+func parseValidationProbes(probes []string) ([]validationProbe, error) {
+	return parseProbes("validation probe", probes)
+}
+
+// parseProbes parses probes as host/path, where the path defaults to /. Kind names them in errors.
+func parseProbes(kind string, probes []string) ([]validationProbe, error) {
+	var parsed []validationProbe
+	for _, probe := range probes {
+		host, path := probe, "/"
+		if i := strings.Index(probe, "/"); i >= 0 {
+			host, path = probe[:i], probe[i:]
+		}
+		if host == "" {
+			return nil, fmt.Errorf("%s %q needs a host, as host/path", kind, probe)
+		}
+		parsed = append(parsed, validationProbe{host: host, path: path})
+	}
+	return parsed, nil
+}
+
+func (n *nginxUpdater) checkValidationProbes() error {
+	if n.ValidationPort == 0 {
+		return nil
+	}
+	_, err := parseValidationProbes(n.ValidationProbes)
+	return err
+}
+
+func (n *nginxUpdater) validationConfFile() string {
+	return n.ConfDir + "/nginx-validation.conf"
+}
+
+// PidFile is where nginx writes its pid. The validation nginx has its own, so it doesn't replace the live one's.
+func (t loadBalancerTemplate) PidFile() string {
+	if t.Validation {
+		return filepath.Join(filepath.Dir(t.PidPath), "nginx-validation.pid")
+	}
+	return t.nginxPidFile()
+}
+
+// validationConf serves only on the loopback validation port, so it can run alongside the live nginx.
+func (n *nginxUpdater) validationConf() Conf {
+	conf := n.Conf
+	conf.Ports = []Port{{Name: "validation", Port: n.ValidationPort}}
+	conf.IngressBindAddress = "127.0.0.1"
+	conf.IPv6 = false
+	conf.ProxyProtocol = false
+	conf.UnixSocket = ""
+	conf.TracingExemplars = false
+	return conf
+}
+
+// validateConfig renders the last config for the validation port, starts an nginx with it, and runs the probes
+// against it. The new config is only loaded into the live nginx if this succeeds. Called with configLock held.
+func (n *nginxUpdater) validateConfig(tmpl *template.Template, data loadBalancerTemplate) error {
+	data.Conf = n.validationConf()
+	data.Passthroughs = nil
+	data.Validation = true
+	var config bytes.Buffer
+	if err := tmpl.Execute(&config, data); err != nil {
+		return fmt.Errorf("unable to create validation config from template: %v", err)
+	}
+	if _, err := writeFile(n.validationConfFile(), config.Bytes()); err != nil {
+		return fmt.Errorf("unable to write validation config: %v", err)
+	}
+
+	start := time.Now()
+	err := n.runValidation()
+	validationDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		validationFailures.Inc()
+		return fmt.Errorf("new config failed validation on port %d, keeping the current config: %v",
+			n.ValidationPort, err)
+	}
+	log.Infof("New config passed validation on port %d", n.ValidationPort)
+	return nil
+}
+
+func (n *nginxUpdater) runValidation() error {
+	probes, err := parseValidationProbes(n.ValidationProbes)
+	if err != nil {
+		return err
+	}
+	timeout := n.ValidationTimeout
+	if timeout <= 0 {
+		timeout = defaultValidationTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	var out bytes.Buffer
+	cmd := exec.Command(n.BinaryLocation, "-c", n.validationConfFile())
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start nginx: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	defer stopValidation(cmd, exited)
+
+	address := "127.0.0.1:" + strconv.Itoa(n.ValidationPort)
+	if err := waitForListener(address, deadline, exited); err != nil {
+		select {
+		case <-exited:
+			// the output is only safe to read once nginx has exited
+			return fmt.Errorf("%v: %s", err, out.String())
+		default:
+			return err
+		}
+	}
+	return runProbes(address, probes, deadline)
+}
+
+// waitForListener waits until the address accepts connections, or nginx exits.
+func waitForListener(address string, deadline time.Time, exited <-chan struct{}) error {
+	for {
+		conn, err := net.DialTimeout("tcp", address, validationPollInterval)
+		if err == nil {
+			return conn.Close()
+		}
+		select {
+		case <-exited:
+			return errors.New("nginx exited before serving the config")
+		case <-time.After(validationPollInterval):
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("nginx didn't listen on %s in time", address)
+		}
+	}
+}
+
+// runProbes requests each probe from the address, failing on a connection error or a server error.
+func runProbes(address string, probes []validationProbe, deadline time.Time) error {
+	client := &http.Client{
+		Timeout: time.Until(deadline),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	for _, probe := range probes {
+		status, err := probe.request(client, address)
+		if err != nil {
+			return fmt.Errorf("probe %s: %v", probe, err)
+		}
+		log.Debugf("Validation probe %s got status %d", probe, status)
+	}
+	return nil
+}
+
+// request makes the probe's request to the address with its host, failing on a connection error or a server error.
+func (p validationProbe) request(client *http.Client, address string) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+address+p.path, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Host = p.host
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return resp.StatusCode, fmt.Errorf("got status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func stopValidation(cmd *exec.Cmd, exited <-chan struct{}) {
+	select {
+	case <-exited:
+		return
+	default:
+	}
+	_ = cmd.Process.Signal(syscall.SIGQUIT)
+	select {
+	case <-exited:
+	case <-time.After(defaultValidationTimeout):
+		log.Warn("Validation nginx didn't quit, killing it")
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+}
@@ -0,0 +1,41 @@
+package nginx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidationProbesAreParsed(t *testing.T) {
+	probes, err := parseValidationProbes([]string{"foo.com/health", "bar.com"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []validationProbe{{host: "foo.com", path: "/health"}, {host: "bar.com", path: "/"}}, probes)
+
+	_, err = parseValidationProbes([]string{"/health"})
+	assert.EqualError(t, err, `validation probe "/health" needs a host, as host/path`)
+}
+
+func TestProbesFailOnServerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "ok.com":
+			w.WriteHeader(http.StatusNotFound)
+		case "moved.com":
+			http.Redirect(w, r, "http://broken.com/", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+	deadline := time.Now().Add(time.Second)
+
+	assert.NoError(t, runProbes(address, []validationProbe{{"ok.com", "/"}, {"moved.com", "/"}}, deadline))
+	assert.EqualError(t, runProbes(address, []validationProbe{{"ok.com", "/"}, {"broken.com", "/health"}}, deadline),
+		"probe broken.com/health: got status 502")
+}
@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"github.com/sky-uk/feed/controller"
+)
+
+// toUpdateRequest converts the entries to the messages in updater.proto.
+func toUpdateRequest(entries controller.IngressEntries) *UpdateRequest {
+	request := &UpdateRequest{Entries: make([]*IngressEntry, 0, len(entries))}
+	for _, entry := range entries {
+		request.Entries = append(request.Entries, toIngressEntry(entry))
+	}
+	return request
+}
+
+func toIngressEntry(e controller.IngressEntry) *IngressEntry {
+	entry := &IngressEntry{
+		IngressClass:                    e.IngressClass,
+		Namespace:                       e.Namespace,
+		Name:                            e.Name,
+		Host:                            e.Host,
+		Path:                            e.Path,
+		ServiceAddress:                  e.ServiceAddress,
+		ServicePort:                     e.ServicePort,
+		Allow:                           e.Allow,
+		LbScheme:                        e.LbScheme,
+		StripPaths:                      e.StripPaths,
+		ExactPath:                       e.ExactPath,
+		BackendTimeoutSeconds:           int64(e.BackendTimeoutSeconds),
+		BackendMaxConnections:           int64(e.BackendMaxConnections),
+		BackendKeepaliveTimeoutMillis:   e.BackendKeepaliveTimeout.Milliseconds(),
+		BackendMaxRequestsPerConnection: e.BackendMaxRequestsPerConnection,
+		SslPassthrough:                  e.SSLPassthrough,
+		BackupServiceAddress:            e.BackupServiceAddress,
+		BackupServicePort:               e.BackupServicePort,
+		PrefixPath:                      e.PrefixPath,
+		PathRegex:                       e.PathRegex,
+		BackendMaxFails:                 int64(e.BackendMaxFails),
+		BackendFailTimeoutMillis:        e.BackendFailTimeout.Milliseconds(),
+		BackendKeepaliveCount:           int64(e.BackendKeepaliveCount),
+		ProxyBufferSize:                 int64(e.ProxyBufferSize),
+		ProxyBufferBlocks:               int64(e.ProxyBufferBlocks),
+		Acme:                            e.ACME,
+		BackendSpiffe:                   e.BackendSPIFFE,
+		BackendSpiffeName:               e.BackendSPIFFEName,
+		AllowCountries:                  e.AllowCountries,
+		DenyCountries:                   e.DenyCountries,
+		DisableTracing:                  e.DisableTracing,
+		TracingSampleRate:               e.TracingSampleRate,
+		BackendProtocol:                 e.BackendProtocol,
+		SecurityHeaders:                 e.SecurityHeaders,
+		InternalPaths:                   e.InternalPaths,
+		TrailingSlash:                   e.TrailingSlash,
+		WebsocketUpgrade:                e.WebSocketUpgrade,
+		WebsocketTimeoutSeconds:         int64(e.WebSocketTimeoutSeconds),
+		NjsContent:                      e.NJSContent,
+		NjsHeaderFilter:                 e.NJSHeaderFilter,
+		ApiKeyHeader:                    e.APIKeyHeader,
+		ApiKeysRequired:                 e.APIKeys != nil,
+		ApiKeyRateLimit:                 int64(e.APIKeyRateLimit),
+		StatsName:                       e.StatsName,
+		HtpasswdSecret:                  e.HtpasswdSecret,
+		RateLimit:                       int64(e.RateLimit),
+		RateLimitBurst:                  int64(e.RateLimitBurst),
+		RequestHeaders:                  e.RequestHeaders,
+		ResponseHeaders:                 e.ResponseHeaders,
+		Drain:                           e.Drain,
+		Headless:                        e.Headless,
+	}
+	if !e.CreationTimestamp.IsZero() {
+		entry.CreationTimestamp = e.CreationTimestamp.Unix()
+	}
+	for _, status := range e.InterceptErrors {
+		entry.InterceptErrors = append(entry.InterceptErrors, int32(status))
+	}
+	for _, endpoint := range e.Endpoints {
+		entry.Endpoints = append(entry.Endpoints, &Endpoint{Address: endpoint.Address, Port: endpoint.Port,
+			Backup: endpoint.Backup, Weight: endpoint.Weight})
+	}
+	return entry
+}
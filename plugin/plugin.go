@@ -0,0 +1,146 @@
+/*
+Package plugin provides an updater which delegates to an external process over gRPC, so that bespoke frontends can be
+registered without changes to feed. The API is defined in updater.proto.
+*/
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const healthTimeout = time.Second * 2
+
+// Config for the external updater.
+type Config struct {
+	// Endpoint is the host:port the plugin serves the Updater service on.
+	Endpoint string
+	// Timeout for Start, Update and Stop calls.
+	Timeout time.Duration
+	// TLS connects to the plugin over TLS, rather than plaintext HTTP/2.
+	TLS bool
+	// CAFile is the PEM bundle the plugin's certificate is verified against, or empty for the system roots.
+	CAFile string
+	// CertFile and KeyFile are the client certificate presented to the plugin, if set.
+	CertFile string
+	KeyFile  string
+}
+
+// New creates an updater which calls the plugin at the configured endpoint.
+func New(conf Config) (controller.Updater, error) {
+	if conf.Endpoint == "" {
+		return nil, errors.New("unable to create external updater: missing endpoint")
+	}
+	creds, err := conf.credentials()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create external updater: %v", err)
+	}
+	// connections are made lazily, so an unavailable plugin fails the calls rather than this
+	conn, err := grpc.Dial(conf.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create external updater: %v", err)
+	}
+	initMetrics()
+
+	return &plugin{
+		Config: conf,
+		conn:   conn,
+		client: NewUpdaterClient(conn),
+	}, nil
+}
+
+func (c Config) credentials() (credentials.TransportCredentials, error) {
+	if !c.TLS {
+		if c.CAFile != "" || c.CertFile != "" {
+			return nil, errors.New("a CA or client certificate needs TLS to be enabled")
+		}
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		ca, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates in %s", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+type plugin struct {
+	Config
+	conn   *grpc.ClientConn
+	client UpdaterClient
+}
+
+func (p *plugin) Start() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	if _, err := p.client.Start(ctx, &Empty{}); err != nil {
+		return fmt.Errorf("unable to start external updater: %v", err)
+	}
+	return nil
+}
+
+func (p *plugin) Stop() error {
+	defer p.conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	if _, err := p.client.Stop(ctx, &Empty{}); err != nil {
+		return fmt.Errorf("unable to stop external updater: %v", err)
+	}
+	return nil
+}
+
+func (p *plugin) Update(entries controller.IngressEntries) error {
+	return p.UpdateWithContext(context.Background(), entries)
+}
+
+// UpdateWithContext sends the entries to the plugin, abandoning the call if ctx is cancelled.
+func (p *plugin) UpdateWithContext(ctx context.Context, entries controller.IngressEntries) error {
+	log.Debugf("Sending %d ingress entries to external updater", len(entries))
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	if _, err := p.client.Update(ctx, toUpdateRequest(entries)); err != nil {
+		updateFailures.Inc()
+		return fmt.Errorf("unable to update external updater: %v", err)
+	}
+	return nil
+}
+
+func (p *plugin) Health() error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	_, err := p.client.Health(ctx, &Empty{})
+	return err
+}
+
+func (p *plugin) Readiness() error {
+	return nil
+}
+
+func (p *plugin) String() string {
+	return fmt.Sprintf("external updater at %s", p.Endpoint)
+}
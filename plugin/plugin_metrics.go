@@ -0,0 +1,18 @@
+package plugin
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+var once sync.Once
+var updateFailures prometheus.Counter
+
+func initMetrics() {
+	once.Do(func() {
+		updateFailures = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"external_updater_failures", "The number of failed updates of the external updater")
+	})
+}
@@ -0,0 +1,327 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+// fakePlugin serves the Updater service, recording the calls made and failing those in failures.
+type fakePlugin struct {
+	UnimplementedUpdaterServer
+	server   *grpc.Server
+	listener net.Listener
+	sync.Mutex
+	calls    []string
+	requests []*UpdateRequest
+	failures map[string]string
+	// updateDelay is how long updates take, unless they're cancelled
+	updateDelay time.Duration
+}
+
+func newFakePlugin(t *testing.T, opts ...grpc.ServerOption) *fakePlugin {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakePlugin{server: grpc.NewServer(opts...), listener: listener, failures: make(map[string]string)}
+	RegisterUpdaterServer(f.server, f)
+	go func() { _ = f.server.Serve(listener) }()
+	return f
+}
+
+func (f *fakePlugin) call(method string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.calls = append(f.calls, method)
+	if message, ok := f.failures[method]; ok {
+		return status.Error(codes.Internal, message)
+	}
+	return nil
+}
+
+func (f *fakePlugin) Start(context.Context, *Empty) (*Empty, error) {
+	return &Empty{}, f.call("Start")
+}
+
+func (f *fakePlugin) Update(ctx context.Context, request *UpdateRequest) (*Empty, error) {
+	f.Lock()
+	f.requests = append(f.requests, request)
+	f.Unlock()
+	select {
+	case <-time.After(f.updateDelay):
+	case <-ctx.Done():
+		return nil, f.call("Cancelled")
+	}
+	return &Empty{}, f.call("Update")
+}
+
+func (f *fakePlugin) Stop(context.Context, *Empty) (*Empty, error) {
+	return &Empty{}, f.call("Stop")
+}
+
+func (f *fakePlugin) Health(context.Context, *Empty) (*Empty, error) {
+	return &Empty{}, f.call("Health")
+}
+
+func (f *fakePlugin) endpoint() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakePlugin) Close() {
+	f.server.Stop()
+}
+
+func newPlugin(t *testing.T, f *fakePlugin) controller.Updater {
+	p, err := New(Config{Endpoint: f.endpoint(), Timeout: time.Second})
+	assert.NoError(t, err)
+	return p
+}
+
+func TestEndpointIsRequired(t *testing.T) {
+	_, err := New(Config{})
+	assert.Error(t, err)
+}
+
+func TestCallsArePassedToPlugin(t *testing.T) {
+	asserter := assert.New(t)
+	f := newFakePlugin(t)
+	defer f.Close()
+	p := newPlugin(t, f)
+
+	asserter.NoError(p.Start())
+	asserter.NoError(p.Update(controller.IngressEntries{}))
+	asserter.NoError(p.Health())
+	asserter.NoError(p.Stop())
+
+	asserter.Equal([]string{"Start", "Update", "Health", "Stop"}, f.calls)
+}
+
+func TestUpdateSendsIngressEntries(t *testing.T) {
+	asserter := assert.New(t)
+	f := newFakePlugin(t)
+	defer f.Close()
+	p := newPlugin(t, f)
+
+	asserter.NoError(p.Update(controller.IngressEntries{
+		{
+			Namespace:               "happysky",
+			Name:                    "foo-ingress",
+			Host:                    "foo.sky.com",
+			Path:                    "/foo",
+			ServiceAddress:          "10.254.0.1",
+			ServicePort:             8080,
+			Allow:                   []string{"10.0.0.0/8", "192.168.0.0/16"},
+			LbScheme:                "internal",
+			StripPaths:              true,
+			BackendTimeoutSeconds:   10,
+			BackendKeepaliveTimeout: time.Second * 30,
+			CreationTimestamp:       time.Unix(1500000000, 0),
+			InterceptErrors:         []int{502, 503},
+			APIKeyHeader:            "X-Api-Key",
+			APIKeys:                 map[string]string{"secret": "client"},
+			RateLimit:               10,
+			ResponseHeaders:         map[string]string{"Cache-Control": "no-store"},
+			Endpoints:               []controller.Endpoint{{Address: "10.0.0.1", Port: 8080, Backup: true, Weight: 3}},
+			Drain:                   true,
+			Headless:                true,
+		},
+		{Host: "bar.sky.com", SSLPassthrough: true},
+	}))
+
+	if !asserter.Len(f.requests, 1) || !asserter.Len(f.requests[0].Entries, 2) {
+		return
+	}
+	entry := f.requests[0].Entries[0]
+	asserter.Equal("happysky", entry.Namespace)
+	asserter.Equal("foo-ingress", entry.Name)
+	asserter.Equal("foo.sky.com", entry.Host)
+	asserter.Equal("/foo", entry.Path)
+	asserter.Equal("10.254.0.1", entry.ServiceAddress)
+	asserter.Equal(int32(8080), entry.ServicePort)
+	asserter.Equal([]string{"10.0.0.0/8", "192.168.0.0/16"}, entry.Allow)
+	asserter.Equal("internal", entry.LbScheme)
+	asserter.True(entry.StripPaths)
+	asserter.Equal(int64(10), entry.BackendTimeoutSeconds)
+	asserter.Equal(int64(30000), entry.BackendKeepaliveTimeoutMillis)
+	asserter.Equal(int64(1500000000), entry.CreationTimestamp)
+	asserter.Equal([]int32{502, 503}, entry.InterceptErrors)
+	asserter.Equal("X-Api-Key", entry.ApiKeyHeader)
+	asserter.True(entry.ApiKeysRequired)
+	asserter.NotContains(entry.String(), "secret", "API keys shouldn't be sent")
+	asserter.Equal(int64(10), entry.RateLimit)
+	asserter.Equal(map[string]string{"Cache-Control": "no-store"}, entry.ResponseHeaders)
+	if asserter.Len(entry.Endpoints, 1) {
+		asserter.Equal("10.0.0.1", entry.Endpoints[0].Address)
+		asserter.Equal(int32(8080), entry.Endpoints[0].Port)
+		asserter.True(entry.Endpoints[0].Backup)
+		asserter.Equal(int32(3), entry.Endpoints[0].Weight)
+	}
+	asserter.True(entry.Drain)
+	asserter.True(entry.Headless)
+
+	entry = f.requests[0].Entries[1]
+	asserter.Equal("bar.sky.com", entry.Host)
+	asserter.True(entry.SslPassthrough)
+	asserter.Zero(entry.CreationTimestamp)
+	asserter.False(entry.ApiKeysRequired)
+}
+
+func TestErrorStatusesAreReturned(t *testing.T) {
+	asserter := assert.New(t)
+	f := newFakePlugin(t)
+	defer f.Close()
+	f.failures["Update"] = "frontend unavailable"
+	f.failures["Health"] = "unhealthy"
+	p := newPlugin(t, f)
+
+	err := p.Update(controller.IngressEntries{})
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "code = Internal desc = frontend unavailable")
+	}
+	asserter.Error(p.Health())
+	asserter.NoError(p.Start())
+}
+
+func TestCancelledUpdatesAreAbandoned(t *testing.T) {
+	asserter := assert.New(t)
+	f := newFakePlugin(t)
+	defer f.Close()
+	f.updateDelay = time.Minute
+	p := newPlugin(t, f)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		cancel()
+	}()
+	err := p.(controller.ContextUpdater).UpdateWithContext(ctx, controller.IngressEntries{})
+
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "code = Canceled")
+	}
+	time.Sleep(time.Millisecond * 100)
+	f.Lock()
+	defer f.Unlock()
+	asserter.Equal([]string{"Cancelled"}, f.calls, "the plugin should see the call was cancelled")
+}
+
+func TestUnreachablePluginIsUnhealthy(t *testing.T) {
+	f := newFakePlugin(t)
+	p := newPlugin(t, f)
+	f.Close()
+
+	assert.Error(t, p.Health())
+	assert.Error(t, p.Start())
+}
+
+func TestPluginIsCalledOverMutualTLS(t *testing.T) {
+	asserter := assert.New(t)
+	dir, err := ioutil.TempDir("", "plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newCertificate(t, dir, "ca", nil)
+	server := newCertificate(t, dir, "server", ca)
+	newCertificate(t, dir, "client", ca)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Leaf)
+	f := newFakePlugin(t, grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{*server},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})))
+	defer f.Close()
+
+	p, err := New(Config{Endpoint: f.endpoint(), Timeout: time.Second, TLS: true, CAFile: filepath.Join(dir, "ca.pem"),
+		CertFile: filepath.Join(dir, "client.pem"), KeyFile: filepath.Join(dir, "client-key.pem")})
+	asserter.NoError(err)
+	asserter.NoError(p.Start())
+
+	plaintext := newPlugin(t, f)
+	asserter.Error(plaintext.Start(), "plaintext calls should fail")
+
+	withoutCA, err := New(Config{Endpoint: f.endpoint(), Timeout: time.Second, TLS: true})
+	asserter.NoError(err)
+	asserter.Error(withoutCA.Start(), "the plugin's certificate should be verified")
+
+	_, err = New(Config{Endpoint: f.endpoint(), CAFile: filepath.Join(dir, "ca.pem")})
+	asserter.Error(err, "a CA without TLS should be rejected")
+}
+
+// newCertificate writes a certificate for localhost and its key to dir, signed by parent or else self-signed.
+func newCertificate(t *testing.T, dir, name string, parent *tls.Certificate) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".pem"), certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return &cert
+}
@@ -0,0 +1,968 @@
+// The API feed-ingress uses to call an external updater, given with --external-updater-endpoint.
+// Plugins implement the Updater service. Errors are returned as gRPC statuses.
+//
+// The Go code is generated with `make proto`.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        (unknown)
+// source: plugin/updater.proto
+
+package plugin
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Empty struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *Empty) Reset() {
+	*x = Empty{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_plugin_updater_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Empty) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Empty) ProtoMessage() {}
+
+func (x *Empty) ProtoReflect() protoreflect.Message {
+	mi := &file_plugin_updater_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Empty.ProtoReflect.Descriptor instead.
+func (*Empty) Descriptor() ([]byte, []int) {
+	return file_plugin_updater_proto_rawDescGZIP(), []int{0}
+}
+
+type UpdateRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Entries []*IngressEntry `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+}
+
+func (x *UpdateRequest) Reset() {
+	*x = UpdateRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_plugin_updater_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *UpdateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateRequest) ProtoMessage() {}
+
+func (x *UpdateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_plugin_updater_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateRequest.ProtoReflect.Descriptor instead.
+func (*UpdateRequest) Descriptor() ([]byte, []int) {
+	return file_plugin_updater_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UpdateRequest) GetEntries() []*IngressEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+// IngressEntry is the ingress for a single host, path and service. The API keys of an entry aren't sent, only whether
+// they're required.
+type IngressEntry struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	IngressClass   string   `protobuf:"bytes,1,opt,name=ingress_class,json=ingressClass,proto3" json:"ingress_class,omitempty"`
+	Namespace      string   `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name           string   `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Host           string   `protobuf:"bytes,4,opt,name=host,proto3" json:"host,omitempty"`
+	Path           string   `protobuf:"bytes,5,opt,name=path,proto3" json:"path,omitempty"`
+	ServiceAddress string   `protobuf:"bytes,6,opt,name=service_address,json=serviceAddress,proto3" json:"service_address,omitempty"`
+	ServicePort    int32    `protobuf:"varint,7,opt,name=service_port,json=servicePort,proto3" json:"service_port,omitempty"`
+	Allow          []string `protobuf:"bytes,8,rep,name=allow,proto3" json:"allow,omitempty"`
+	// internal or internet-facing.
+	LbScheme                        string `protobuf:"bytes,9,opt,name=lb_scheme,json=lbScheme,proto3" json:"lb_scheme,omitempty"`
+	StripPaths                      bool   `protobuf:"varint,10,opt,name=strip_paths,json=stripPaths,proto3" json:"strip_paths,omitempty"`
+	ExactPath                       bool   `protobuf:"varint,11,opt,name=exact_path,json=exactPath,proto3" json:"exact_path,omitempty"`
+	BackendTimeoutSeconds           int64  `protobuf:"varint,12,opt,name=backend_timeout_seconds,json=backendTimeoutSeconds,proto3" json:"backend_timeout_seconds,omitempty"`
+	BackendMaxConnections           int64  `protobuf:"varint,13,opt,name=backend_max_connections,json=backendMaxConnections,proto3" json:"backend_max_connections,omitempty"`
+	BackendKeepaliveTimeoutMillis   int64  `protobuf:"varint,14,opt,name=backend_keepalive_timeout_millis,json=backendKeepaliveTimeoutMillis,proto3" json:"backend_keepalive_timeout_millis,omitempty"`
+	BackendMaxRequestsPerConnection uint64 `protobuf:"varint,15,opt,name=backend_max_requests_per_connection,json=backendMaxRequestsPerConnection,proto3" json:"backend_max_requests_per_connection,omitempty"`
+	// Seconds since the unix epoch.
+	CreationTimestamp        int64  `protobuf:"varint,16,opt,name=creation_timestamp,json=creationTimestamp,proto3" json:"creation_timestamp,omitempty"`
+	SslPassthrough           bool   `protobuf:"varint,17,opt,name=ssl_passthrough,json=sslPassthrough,proto3" json:"ssl_passthrough,omitempty"`
+	BackupServiceAddress     string `protobuf:"bytes,18,opt,name=backup_service_address,json=backupServiceAddress,proto3" json:"backup_service_address,omitempty"`
+	BackupServicePort        int32  `protobuf:"varint,19,opt,name=backup_service_port,json=backupServicePort,proto3" json:"backup_service_port,omitempty"`
+	PrefixPath               bool   `protobuf:"varint,20,opt,name=prefix_path,json=prefixPath,proto3" json:"prefix_path,omitempty"`
+	PathRegex                bool   `protobuf:"varint,21,opt,name=path_regex,json=pathRegex,proto3" json:"path_regex,omitempty"`
+	BackendMaxFails          int64  `protobuf:"varint,22,opt,name=backend_max_fails,json=backendMaxFails,proto3" json:"backend_max_fails,omitempty"`
+	BackendFailTimeoutMillis int64  `protobuf:"varint,23,opt,name=backend_fail_timeout_millis,json=backendFailTimeoutMillis,proto3" json:"backend_fail_timeout_millis,omitempty"`
+	BackendKeepaliveCount    int64  `protobuf:"varint,24,opt,name=backend_keepalive_count,json=backendKeepaliveCount,proto3" json:"backend_keepalive_count,omitempty"`
+	// In KiB.
+	ProxyBufferSize   int64    `protobuf:"varint,25,opt,name=proxy_buffer_size,json=proxyBufferSize,proto3" json:"proxy_buffer_size,omitempty"`
+	ProxyBufferBlocks int64    `protobuf:"varint,26,opt,name=proxy_buffer_blocks,json=proxyBufferBlocks,proto3" json:"proxy_buffer_blocks,omitempty"`
+	Acme              bool     `protobuf:"varint,27,opt,name=acme,proto3" json:"acme,omitempty"`
+	BackendSpiffe     bool     `protobuf:"varint,28,opt,name=backend_spiffe,json=backendSpiffe,proto3" json:"backend_spiffe,omitempty"`
+	BackendSpiffeName string   `protobuf:"bytes,29,opt,name=backend_spiffe_name,json=backendSpiffeName,proto3" json:"backend_spiffe_name,omitempty"`
+	AllowCountries    []string `protobuf:"bytes,30,rep,name=allow_countries,json=allowCountries,proto3" json:"allow_countries,omitempty"`
+	DenyCountries     []string `protobuf:"bytes,31,rep,name=deny_countries,json=denyCountries,proto3" json:"deny_countries,omitempty"`
+	DisableTracing    bool     `protobuf:"varint,32,opt,name=disable_tracing,json=disableTracing,proto3" json:"disable_tracing,omitempty"`
+	TracingSampleRate float64  `protobuf:"fixed64,33,opt,name=tracing_sample_rate,json=tracingSampleRate,proto3" json:"tracing_sample_rate,omitempty"`
+	// http, h2c, fastcgi or uwsgi. Empty is http.
+	BackendProtocol         string            `protobuf:"bytes,34,opt,name=backend_protocol,json=backendProtocol,proto3" json:"backend_protocol,omitempty"`
+	InterceptErrors         []int32           `protobuf:"varint,35,rep,packed,name=intercept_errors,json=interceptErrors,proto3" json:"intercept_errors,omitempty"`
+	SecurityHeaders         string            `protobuf:"bytes,36,opt,name=security_headers,json=securityHeaders,proto3" json:"security_headers,omitempty"`
+	InternalPaths           []string          `protobuf:"bytes,37,rep,name=internal_paths,json=internalPaths,proto3" json:"internal_paths,omitempty"`
+	TrailingSlash           string            `protobuf:"bytes,38,opt,name=trailing_slash,json=trailingSlash,proto3" json:"trailing_slash,omitempty"`
+	WebsocketUpgrade        bool              `protobuf:"varint,39,opt,name=websocket_upgrade,json=websocketUpgrade,proto3" json:"websocket_upgrade,omitempty"`
+	WebsocketTimeoutSeconds int64             `protobuf:"varint,40,opt,name=websocket_timeout_seconds,json=websocketTimeoutSeconds,proto3" json:"websocket_timeout_seconds,omitempty"`
+	NjsContent              string            `protobuf:"bytes,41,opt,name=njs_content,json=njsContent,proto3" json:"njs_content,omitempty"`
+	NjsHeaderFilter         string            `protobuf:"bytes,42,opt,name=njs_header_filter,json=njsHeaderFilter,proto3" json:"njs_header_filter,omitempty"`
+	ApiKeyHeader            string            `protobuf:"bytes,43,opt,name=api_key_header,json=apiKeyHeader,proto3" json:"api_key_header,omitempty"`
+	ApiKeysRequired         bool              `protobuf:"varint,44,opt,name=api_keys_required,json=apiKeysRequired,proto3" json:"api_keys_required,omitempty"`
+	ApiKeyRateLimit         int64             `protobuf:"varint,45,opt,name=api_key_rate_limit,json=apiKeyRateLimit,proto3" json:"api_key_rate_limit,omitempty"`
+	StatsName               string            `protobuf:"bytes,46,opt,name=stats_name,json=statsName,proto3" json:"stats_name,omitempty"`
+	HtpasswdSecret          string            `protobuf:"bytes,47,opt,name=htpasswd_secret,json=htpasswdSecret,proto3" json:"htpasswd_secret,omitempty"`
+	RateLimit               int64             `protobuf:"varint,48,opt,name=rate_limit,json=rateLimit,proto3" json:"rate_limit,omitempty"`
+	RateLimitBurst          int64             `protobuf:"varint,49,opt,name=rate_limit_burst,json=rateLimitBurst,proto3" json:"rate_limit_burst,omitempty"`
+	RequestHeaders          map[string]string `protobuf:"bytes,50,rep,name=request_headers,json=requestHeaders,proto3" json:"request_headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	ResponseHeaders         map[string]string `protobuf:"bytes,51,rep,name=response_headers,json=responseHeaders,proto3" json:"response_headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// The ready pods of the service port, when feed-ingress runs with --endpoints-mode.
+	Endpoints []*Endpoint `protobuf:"bytes,52,rep,name=endpoints,proto3" json:"endpoints,omitempty"`
+	Drain     bool        `protobuf:"varint,53,opt,name=drain,proto3" json:"drain,omitempty"`
+	Headless  bool        `protobuf:"varint,54,opt,name=headless,proto3" json:"headless,omitempty"`
+}
+
+func (x *IngressEntry) Reset() {
+	*x = IngressEntry{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_plugin_updater_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IngressEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngressEntry) ProtoMessage() {}
+
+func (x *IngressEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_plugin_updater_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngressEntry.ProtoReflect.Descriptor instead.
+func (*IngressEntry) Descriptor() ([]byte, []int) {
+	return file_plugin_updater_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *IngressEntry) GetIngressClass() string {
+	if x != nil {
+		return x.IngressClass
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetServiceAddress() string {
+	if x != nil {
+		return x.ServiceAddress
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetServicePort() int32 {
+	if x != nil {
+		return x.ServicePort
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetAllow() []string {
+	if x != nil {
+		return x.Allow
+	}
+	return nil
+}
+
+func (x *IngressEntry) GetLbScheme() string {
+	if x != nil {
+		return x.LbScheme
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetStripPaths() bool {
+	if x != nil {
+		return x.StripPaths
+	}
+	return false
+}
+
+func (x *IngressEntry) GetExactPath() bool {
+	if x != nil {
+		return x.ExactPath
+	}
+	return false
+}
+
+func (x *IngressEntry) GetBackendTimeoutSeconds() int64 {
+	if x != nil {
+		return x.BackendTimeoutSeconds
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetBackendMaxConnections() int64 {
+	if x != nil {
+		return x.BackendMaxConnections
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetBackendKeepaliveTimeoutMillis() int64 {
+	if x != nil {
+		return x.BackendKeepaliveTimeoutMillis
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetBackendMaxRequestsPerConnection() uint64 {
+	if x != nil {
+		return x.BackendMaxRequestsPerConnection
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetCreationTimestamp() int64 {
+	if x != nil {
+		return x.CreationTimestamp
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetSslPassthrough() bool {
+	if x != nil {
+		return x.SslPassthrough
+	}
+	return false
+}
+
+func (x *IngressEntry) GetBackupServiceAddress() string {
+	if x != nil {
+		return x.BackupServiceAddress
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetBackupServicePort() int32 {
+	if x != nil {
+		return x.BackupServicePort
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetPrefixPath() bool {
+	if x != nil {
+		return x.PrefixPath
+	}
+	return false
+}
+
+func (x *IngressEntry) GetPathRegex() bool {
+	if x != nil {
+		return x.PathRegex
+	}
+	return false
+}
+
+func (x *IngressEntry) GetBackendMaxFails() int64 {
+	if x != nil {
+		return x.BackendMaxFails
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetBackendFailTimeoutMillis() int64 {
+	if x != nil {
+		return x.BackendFailTimeoutMillis
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetBackendKeepaliveCount() int64 {
+	if x != nil {
+		return x.BackendKeepaliveCount
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetProxyBufferSize() int64 {
+	if x != nil {
+		return x.ProxyBufferSize
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetProxyBufferBlocks() int64 {
+	if x != nil {
+		return x.ProxyBufferBlocks
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetAcme() bool {
+	if x != nil {
+		return x.Acme
+	}
+	return false
+}
+
+func (x *IngressEntry) GetBackendSpiffe() bool {
+	if x != nil {
+		return x.BackendSpiffe
+	}
+	return false
+}
+
+func (x *IngressEntry) GetBackendSpiffeName() string {
+	if x != nil {
+		return x.BackendSpiffeName
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetAllowCountries() []string {
+	if x != nil {
+		return x.AllowCountries
+	}
+	return nil
+}
+
+func (x *IngressEntry) GetDenyCountries() []string {
+	if x != nil {
+		return x.DenyCountries
+	}
+	return nil
+}
+
+func (x *IngressEntry) GetDisableTracing() bool {
+	if x != nil {
+		return x.DisableTracing
+	}
+	return false
+}
+
+func (x *IngressEntry) GetTracingSampleRate() float64 {
+	if x != nil {
+		return x.TracingSampleRate
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetBackendProtocol() string {
+	if x != nil {
+		return x.BackendProtocol
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetInterceptErrors() []int32 {
+	if x != nil {
+		return x.InterceptErrors
+	}
+	return nil
+}
+
+func (x *IngressEntry) GetSecurityHeaders() string {
+	if x != nil {
+		return x.SecurityHeaders
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetInternalPaths() []string {
+	if x != nil {
+		return x.InternalPaths
+	}
+	return nil
+}
+
+func (x *IngressEntry) GetTrailingSlash() string {
+	if x != nil {
+		return x.TrailingSlash
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetWebsocketUpgrade() bool {
+	if x != nil {
+		return x.WebsocketUpgrade
+	}
+	return false
+}
+
+func (x *IngressEntry) GetWebsocketTimeoutSeconds() int64 {
+	if x != nil {
+		return x.WebsocketTimeoutSeconds
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetNjsContent() string {
+	if x != nil {
+		return x.NjsContent
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetNjsHeaderFilter() string {
+	if x != nil {
+		return x.NjsHeaderFilter
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetApiKeyHeader() string {
+	if x != nil {
+		return x.ApiKeyHeader
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetApiKeysRequired() bool {
+	if x != nil {
+		return x.ApiKeysRequired
+	}
+	return false
+}
+
+func (x *IngressEntry) GetApiKeyRateLimit() int64 {
+	if x != nil {
+		return x.ApiKeyRateLimit
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetStatsName() string {
+	if x != nil {
+		return x.StatsName
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetHtpasswdSecret() string {
+	if x != nil {
+		return x.HtpasswdSecret
+	}
+	return ""
+}
+
+func (x *IngressEntry) GetRateLimit() int64 {
+	if x != nil {
+		return x.RateLimit
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetRateLimitBurst() int64 {
+	if x != nil {
+		return x.RateLimitBurst
+	}
+	return 0
+}
+
+func (x *IngressEntry) GetRequestHeaders() map[string]string {
+	if x != nil {
+		return x.RequestHeaders
+	}
+	return nil
+}
+
+func (x *IngressEntry) GetResponseHeaders() map[string]string {
+	if x != nil {
+		return x.ResponseHeaders
+	}
+	return nil
+}
+
+func (x *IngressEntry) GetEndpoints() []*Endpoint {
+	if x != nil {
+		return x.Endpoints
+	}
+	return nil
+}
+
+func (x *IngressEntry) GetDrain() bool {
+	if x != nil {
+		return x.Drain
+	}
+	return false
+}
+
+func (x *IngressEntry) GetHeadless() bool {
+	if x != nil {
+		return x.Headless
+	}
+	return false
+}
+
+type Endpoint struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Port    int32  `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	Backup  bool   `protobuf:"varint,3,opt,name=backup,proto3" json:"backup,omitempty"`
+	Weight  int32  `protobuf:"varint,4,opt,name=weight,proto3" json:"weight,omitempty"`
+}
+
+func (x *Endpoint) Reset() {
+	*x = Endpoint{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_plugin_updater_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Endpoint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Endpoint) ProtoMessage() {}
+
+func (x *Endpoint) ProtoReflect() protoreflect.Message {
+	mi := &file_plugin_updater_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Endpoint.ProtoReflect.Descriptor instead.
+func (*Endpoint) Descriptor() ([]byte, []int) {
+	return file_plugin_updater_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Endpoint) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *Endpoint) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *Endpoint) GetBackup() bool {
+	if x != nil {
+		return x.Backup
+	}
+	return false
+}
+
+func (x *Endpoint) GetWeight() int32 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+var File_plugin_updater_proto protoreflect.FileDescriptor
+
+var file_plugin_updater_proto_rawDesc = []byte{
+	0x0a, 0x14, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2f, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x72,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0e, 0x66, 0x65, 0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75,
+	0x67, 0x69, 0x6e, 0x2e, 0x76, 0x31, 0x22, 0x07, 0x0a, 0x05, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22,
+	0x47, 0x0a, 0x0d, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x36, 0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x1c, 0x2e, 0x66, 0x65, 0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e,
+	0x76, 0x31, 0x2e, 0x49, 0x6e, 0x67, 0x72, 0x65, 0x73, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52,
+	0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x22, 0xa3, 0x13, 0x0a, 0x0c, 0x49, 0x6e, 0x67,
+	0x72, 0x65, 0x73, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x23, 0x0a, 0x0d, 0x69, 0x6e, 0x67,
+	0x72, 0x65, 0x73, 0x73, 0x5f, 0x63, 0x6c, 0x61, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0c, 0x69, 0x6e, 0x67, 0x72, 0x65, 0x73, 0x73, 0x43, 0x6c, 0x61, 0x73, 0x73, 0x12, 0x1c,
+	0x0a, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x09, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x12, 0x12, 0x0a, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65,
+	0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x68, 0x6f, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x65, 0x72, 0x76,
+	0x69, 0x63, 0x65, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73,
+	0x73, 0x12, 0x21, 0x0a, 0x0c, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x5f, 0x70, 0x6f, 0x72,
+	0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0b, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
+	0x50, 0x6f, 0x72, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x18, 0x08, 0x20,
+	0x03, 0x28, 0x09, 0x52, 0x05, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x62,
+	0x5f, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6c,
+	0x62, 0x53, 0x63, 0x68, 0x65, 0x6d, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x74, 0x72, 0x69, 0x70,
+	0x5f, 0x70, 0x61, 0x74, 0x68, 0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x73, 0x74,
+	0x72, 0x69, 0x70, 0x50, 0x61, 0x74, 0x68, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x65, 0x78, 0x61, 0x63,
+	0x74, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x65, 0x78,
+	0x61, 0x63, 0x74, 0x50, 0x61, 0x74, 0x68, 0x12, 0x36, 0x0a, 0x17, 0x62, 0x61, 0x63, 0x6b, 0x65,
+	0x6e, 0x64, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e,
+	0x64, 0x73, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x03, 0x52, 0x15, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e,
+	0x64, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x12,
+	0x36, 0x0a, 0x17, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x5f, 0x6d, 0x61, 0x78, 0x5f, 0x63,
+	0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x15, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x4d, 0x61, 0x78, 0x43, 0x6f, 0x6e, 0x6e,
+	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x47, 0x0a, 0x20, 0x62, 0x61, 0x63, 0x6b, 0x65,
+	0x6e, 0x64, 0x5f, 0x6b, 0x65, 0x65, 0x70, 0x61, 0x6c, 0x69, 0x76, 0x65, 0x5f, 0x74, 0x69, 0x6d,
+	0x65, 0x6f, 0x75, 0x74, 0x5f, 0x6d, 0x69, 0x6c, 0x6c, 0x69, 0x73, 0x18, 0x0e, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x1d, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x4b, 0x65, 0x65, 0x70, 0x61, 0x6c,
+	0x69, 0x76, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73,
+	0x12, 0x4c, 0x0a, 0x23, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x5f, 0x6d, 0x61, 0x78, 0x5f,
+	0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x73, 0x5f, 0x70, 0x65, 0x72, 0x5f, 0x63, 0x6f, 0x6e,
+	0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x04, 0x52, 0x1f, 0x62,
+	0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x4d, 0x61, 0x78, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x73, 0x50, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x2d,
+	0x0a, 0x12, 0x63, 0x72, 0x65, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x18, 0x10, 0x20, 0x01, 0x28, 0x03, 0x52, 0x11, 0x63, 0x72, 0x65, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x27, 0x0a,
+	0x0f, 0x73, 0x73, 0x6c, 0x5f, 0x70, 0x61, 0x73, 0x73, 0x74, 0x68, 0x72, 0x6f, 0x75, 0x67, 0x68,
+	0x18, 0x11, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x73, 0x73, 0x6c, 0x50, 0x61, 0x73, 0x73, 0x74,
+	0x68, 0x72, 0x6f, 0x75, 0x67, 0x68, 0x12, 0x34, 0x0a, 0x16, 0x62, 0x61, 0x63, 0x6b, 0x75, 0x70,
+	0x5f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73,
+	0x18, 0x12, 0x20, 0x01, 0x28, 0x09, 0x52, 0x14, 0x62, 0x61, 0x63, 0x6b, 0x75, 0x70, 0x53, 0x65,
+	0x72, 0x76, 0x69, 0x63, 0x65, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x2e, 0x0a, 0x13,
+	0x62, 0x61, 0x63, 0x6b, 0x75, 0x70, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x5f, 0x70,
+	0x6f, 0x72, 0x74, 0x18, 0x13, 0x20, 0x01, 0x28, 0x05, 0x52, 0x11, 0x62, 0x61, 0x63, 0x6b, 0x75,
+	0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x1f, 0x0a, 0x0b,
+	0x70, 0x72, 0x65, 0x66, 0x69, 0x78, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x14, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x0a, 0x70, 0x72, 0x65, 0x66, 0x69, 0x78, 0x50, 0x61, 0x74, 0x68, 0x12, 0x1d, 0x0a,
+	0x0a, 0x70, 0x61, 0x74, 0x68, 0x5f, 0x72, 0x65, 0x67, 0x65, 0x78, 0x18, 0x15, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x09, 0x70, 0x61, 0x74, 0x68, 0x52, 0x65, 0x67, 0x65, 0x78, 0x12, 0x2a, 0x0a, 0x11,
+	0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x5f, 0x6d, 0x61, 0x78, 0x5f, 0x66, 0x61, 0x69, 0x6c,
+	0x73, 0x18, 0x16, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64,
+	0x4d, 0x61, 0x78, 0x46, 0x61, 0x69, 0x6c, 0x73, 0x12, 0x3d, 0x0a, 0x1b, 0x62, 0x61, 0x63, 0x6b,
+	0x65, 0x6e, 0x64, 0x5f, 0x66, 0x61, 0x69, 0x6c, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74,
+	0x5f, 0x6d, 0x69, 0x6c, 0x6c, 0x69, 0x73, 0x18, 0x17, 0x20, 0x01, 0x28, 0x03, 0x52, 0x18, 0x62,
+	0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x46, 0x61, 0x69, 0x6c, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75,
+	0x74, 0x4d, 0x69, 0x6c, 0x6c, 0x69, 0x73, 0x12, 0x36, 0x0a, 0x17, 0x62, 0x61, 0x63, 0x6b, 0x65,
+	0x6e, 0x64, 0x5f, 0x6b, 0x65, 0x65, 0x70, 0x61, 0x6c, 0x69, 0x76, 0x65, 0x5f, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x18, 0x18, 0x20, 0x01, 0x28, 0x03, 0x52, 0x15, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e,
+	0x64, 0x4b, 0x65, 0x65, 0x70, 0x61, 0x6c, 0x69, 0x76, 0x65, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12,
+	0x2a, 0x0a, 0x11, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x5f, 0x62, 0x75, 0x66, 0x66, 0x65, 0x72, 0x5f,
+	0x73, 0x69, 0x7a, 0x65, 0x18, 0x19, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x70, 0x72, 0x6f, 0x78,
+	0x79, 0x42, 0x75, 0x66, 0x66, 0x65, 0x72, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x2e, 0x0a, 0x13, 0x70,
+	0x72, 0x6f, 0x78, 0x79, 0x5f, 0x62, 0x75, 0x66, 0x66, 0x65, 0x72, 0x5f, 0x62, 0x6c, 0x6f, 0x63,
+	0x6b, 0x73, 0x18, 0x1a, 0x20, 0x01, 0x28, 0x03, 0x52, 0x11, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x42,
+	0x75, 0x66, 0x66, 0x65, 0x72, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x61,
+	0x63, 0x6d, 0x65, 0x18, 0x1b, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x61, 0x63, 0x6d, 0x65, 0x12,
+	0x25, 0x0a, 0x0e, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x5f, 0x73, 0x70, 0x69, 0x66, 0x66,
+	0x65, 0x18, 0x1c, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0d, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64,
+	0x53, 0x70, 0x69, 0x66, 0x66, 0x65, 0x12, 0x2e, 0x0a, 0x13, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e,
+	0x64, 0x5f, 0x73, 0x70, 0x69, 0x66, 0x66, 0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x1d, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x11, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x53, 0x70, 0x69, 0x66,
+	0x66, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x27, 0x0a, 0x0f, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x5f,
+	0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x1e, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x0e, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x12,
+	0x25, 0x0a, 0x0e, 0x64, 0x65, 0x6e, 0x79, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x72, 0x69, 0x65,
+	0x73, 0x18, 0x1f, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x64, 0x65, 0x6e, 0x79, 0x43, 0x6f, 0x75,
+	0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x64, 0x69, 0x73, 0x61, 0x62, 0x6c,
+	0x65, 0x5f, 0x74, 0x72, 0x61, 0x63, 0x69, 0x6e, 0x67, 0x18, 0x20, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x0e, 0x64, 0x69, 0x73, 0x61, 0x62, 0x6c, 0x65, 0x54, 0x72, 0x61, 0x63, 0x69, 0x6e, 0x67, 0x12,
+	0x2e, 0x0a, 0x13, 0x74, 0x72, 0x61, 0x63, 0x69, 0x6e, 0x67, 0x5f, 0x73, 0x61, 0x6d, 0x70, 0x6c,
+	0x65, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x18, 0x21, 0x20, 0x01, 0x28, 0x01, 0x52, 0x11, 0x74, 0x72,
+	0x61, 0x63, 0x69, 0x6e, 0x67, 0x53, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x52, 0x61, 0x74, 0x65, 0x12,
+	0x29, 0x0a, 0x10, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x63, 0x6f, 0x6c, 0x18, 0x22, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x62, 0x61, 0x63, 0x6b, 0x65,
+	0x6e, 0x64, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x12, 0x29, 0x0a, 0x10, 0x69, 0x6e,
+	0x74, 0x65, 0x72, 0x63, 0x65, 0x70, 0x74, 0x5f, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x18, 0x23,
+	0x20, 0x03, 0x28, 0x05, 0x52, 0x0f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x63, 0x65, 0x70, 0x74, 0x45,
+	0x72, 0x72, 0x6f, 0x72, 0x73, 0x12, 0x29, 0x0a, 0x10, 0x73, 0x65, 0x63, 0x75, 0x72, 0x69, 0x74,
+	0x79, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x24, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0f, 0x73, 0x65, 0x63, 0x75, 0x72, 0x69, 0x74, 0x79, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73,
+	0x12, 0x25, 0x0a, 0x0e, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x5f, 0x70, 0x61, 0x74,
+	0x68, 0x73, 0x18, 0x25, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e,
+	0x61, 0x6c, 0x50, 0x61, 0x74, 0x68, 0x73, 0x12, 0x25, 0x0a, 0x0e, 0x74, 0x72, 0x61, 0x69, 0x6c,
+	0x69, 0x6e, 0x67, 0x5f, 0x73, 0x6c, 0x61, 0x73, 0x68, 0x18, 0x26, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0d, 0x74, 0x72, 0x61, 0x69, 0x6c, 0x69, 0x6e, 0x67, 0x53, 0x6c, 0x61, 0x73, 0x68, 0x12, 0x2b,
+	0x0a, 0x11, 0x77, 0x65, 0x62, 0x73, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x5f, 0x75, 0x70, 0x67, 0x72,
+	0x61, 0x64, 0x65, 0x18, 0x27, 0x20, 0x01, 0x28, 0x08, 0x52, 0x10, 0x77, 0x65, 0x62, 0x73, 0x6f,
+	0x63, 0x6b, 0x65, 0x74, 0x55, 0x70, 0x67, 0x72, 0x61, 0x64, 0x65, 0x12, 0x3a, 0x0a, 0x19, 0x77,
+	0x65, 0x62, 0x73, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74,
+	0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x28, 0x20, 0x01, 0x28, 0x03, 0x52, 0x17,
+	0x77, 0x65, 0x62, 0x73, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74,
+	0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x6e, 0x6a, 0x73, 0x5f, 0x63,
+	0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x18, 0x29, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x6e, 0x6a,
+	0x73, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x12, 0x2a, 0x0a, 0x11, 0x6e, 0x6a, 0x73, 0x5f,
+	0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x5f, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x18, 0x2a, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0f, 0x6e, 0x6a, 0x73, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x46, 0x69,
+	0x6c, 0x74, 0x65, 0x72, 0x12, 0x24, 0x0a, 0x0e, 0x61, 0x70, 0x69, 0x5f, 0x6b, 0x65, 0x79, 0x5f,
+	0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x18, 0x2b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x61, 0x70,
+	0x69, 0x4b, 0x65, 0x79, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x12, 0x2a, 0x0a, 0x11, 0x61, 0x70,
+	0x69, 0x5f, 0x6b, 0x65, 0x79, 0x73, 0x5f, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x64, 0x18,
+	0x2c, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x61, 0x70, 0x69, 0x4b, 0x65, 0x79, 0x73, 0x52, 0x65,
+	0x71, 0x75, 0x69, 0x72, 0x65, 0x64, 0x12, 0x2b, 0x0a, 0x12, 0x61, 0x70, 0x69, 0x5f, 0x6b, 0x65,
+	0x79, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x2d, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x0f, 0x61, 0x70, 0x69, 0x4b, 0x65, 0x79, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x69,
+	0x6d, 0x69, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x74, 0x61, 0x74, 0x73, 0x5f, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x2e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x73, 0x74, 0x61, 0x74, 0x73, 0x4e, 0x61,
+	0x6d, 0x65, 0x12, 0x27, 0x0a, 0x0f, 0x68, 0x74, 0x70, 0x61, 0x73, 0x73, 0x77, 0x64, 0x5f, 0x73,
+	0x65, 0x63, 0x72, 0x65, 0x74, 0x18, 0x2f, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x68, 0x74, 0x70,
+	0x61, 0x73, 0x73, 0x77, 0x64, 0x53, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x72,
+	0x61, 0x74, 0x65, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x30, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x09, 0x72, 0x61, 0x74, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x28, 0x0a, 0x10, 0x72, 0x61,
+	0x74, 0x65, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x5f, 0x62, 0x75, 0x72, 0x73, 0x74, 0x18, 0x31,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x0e, 0x72, 0x61, 0x74, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x42,
+	0x75, 0x72, 0x73, 0x74, 0x12, 0x59, 0x0a, 0x0f, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x5f,
+	0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x32, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x30, 0x2e,
+	0x66, 0x65, 0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x49,
+	0x6e, 0x67, 0x72, 0x65, 0x73, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x2e, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52,
+	0x0e, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12,
+	0x5c, 0x0a, 0x10, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x68, 0x65, 0x61, 0x64,
+	0x65, 0x72, 0x73, 0x18, 0x33, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x31, 0x2e, 0x66, 0x65, 0x65, 0x64,
+	0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x6e, 0x67, 0x72, 0x65,
+	0x73, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0f, 0x72, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x36, 0x0a,
+	0x09, 0x65, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x73, 0x18, 0x34, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x18, 0x2e, 0x66, 0x65, 0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x76,
+	0x31, 0x2e, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x52, 0x09, 0x65, 0x6e, 0x64, 0x70,
+	0x6f, 0x69, 0x6e, 0x74, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x64, 0x72, 0x61, 0x69, 0x6e, 0x18, 0x35,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x64, 0x72, 0x61, 0x69, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x68,
+	0x65, 0x61, 0x64, 0x6c, 0x65, 0x73, 0x73, 0x18, 0x36, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x68,
+	0x65, 0x61, 0x64, 0x6c, 0x65, 0x73, 0x73, 0x1a, 0x41, 0x0a, 0x13, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10,
+	0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79,
+	0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x42, 0x0a, 0x14, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x45, 0x6e, 0x74,
+	0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x68,
+	0x0a, 0x08, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x64,
+	0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x64, 0x64,
+	0x72, 0x65, 0x73, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x61, 0x63, 0x6b,
+	0x75, 0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x62, 0x61, 0x63, 0x6b, 0x75, 0x70,
+	0x12, 0x16, 0x0a, 0x06, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x06, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x32, 0xee, 0x01, 0x0a, 0x07, 0x55, 0x70, 0x64,
+	0x61, 0x74, 0x65, 0x72, 0x12, 0x35, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x72, 0x74, 0x12, 0x15, 0x2e,
+	0x66, 0x65, 0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x45,
+	0x6d, 0x70, 0x74, 0x79, 0x1a, 0x15, 0x2e, 0x66, 0x65, 0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75, 0x67,
+	0x69, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x12, 0x3e, 0x0a, 0x06, 0x55,
+	0x70, 0x64, 0x61, 0x74, 0x65, 0x12, 0x1d, 0x2e, 0x66, 0x65, 0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75,
+	0x67, 0x69, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x66, 0x65, 0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75, 0x67,
+	0x69, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x12, 0x34, 0x0a, 0x04, 0x53,
+	0x74, 0x6f, 0x70, 0x12, 0x15, 0x2e, 0x66, 0x65, 0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69,
+	0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x15, 0x2e, 0x66, 0x65, 0x65,
+	0x64, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x45, 0x6d, 0x70, 0x74,
+	0x79, 0x12, 0x36, 0x0a, 0x06, 0x48, 0x65, 0x61, 0x6c, 0x74, 0x68, 0x12, 0x15, 0x2e, 0x66, 0x65,
+	0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x2e, 0x76, 0x31, 0x2e, 0x45, 0x6d, 0x70,
+	0x74, 0x79, 0x1a, 0x15, 0x2e, 0x66, 0x65, 0x65, 0x64, 0x2e, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e,
+	0x2e, 0x76, 0x31, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x42, 0x1f, 0x5a, 0x1d, 0x67, 0x69, 0x74,
+	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x6b, 0x79, 0x2d, 0x75, 0x6b, 0x2f, 0x66,
+	0x65, 0x65, 0x64, 0x2f, 0x70, 0x6c, 0x75, 0x67, 0x69, 0x6e, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
+}
+
+var (
+	file_plugin_updater_proto_rawDescOnce sync.Once
+	file_plugin_updater_proto_rawDescData = file_plugin_updater_proto_rawDesc
+)
+
+func file_plugin_updater_proto_rawDescGZIP() []byte {
+	file_plugin_updater_proto_rawDescOnce.Do(func() {
+		file_plugin_updater_proto_rawDescData = protoimpl.X.CompressGZIP(file_plugin_updater_proto_rawDescData)
+	})
+	return file_plugin_updater_proto_rawDescData
+}
+
+var file_plugin_updater_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_plugin_updater_proto_goTypes = []interface{}{
+	(*Empty)(nil),         // 0: feed.plugin.v1.Empty
+	(*UpdateRequest)(nil), // 1: feed.plugin.v1.UpdateRequest
+	(*IngressEntry)(nil),  // 2: feed.plugin.v1.IngressEntry
+	(*Endpoint)(nil),      // 3: feed.plugin.v1.Endpoint
+	nil,                   // 4: feed.plugin.v1.IngressEntry.RequestHeadersEntry
+	nil,                   // 5: feed.plugin.v1.IngressEntry.ResponseHeadersEntry
+}
+var file_plugin_updater_proto_depIdxs = []int32{
+	2, // 0: feed.plugin.v1.UpdateRequest.entries:type_name -> feed.plugin.v1.IngressEntry
+	4, // 1: feed.plugin.v1.IngressEntry.request_headers:type_name -> feed.plugin.v1.IngressEntry.RequestHeadersEntry
+	5, // 2: feed.plugin.v1.IngressEntry.response_headers:type_name -> feed.plugin.v1.IngressEntry.ResponseHeadersEntry
+	3, // 3: feed.plugin.v1.IngressEntry.endpoints:type_name -> feed.plugin.v1.Endpoint
+	0, // 4: feed.plugin.v1.Updater.Start:input_type -> feed.plugin.v1.Empty
+	1, // 5: feed.plugin.v1.Updater.Update:input_type -> feed.plugin.v1.UpdateRequest
+	0, // 6: feed.plugin.v1.Updater.Stop:input_type -> feed.plugin.v1.Empty
+	0, // 7: feed.plugin.v1.Updater.Health:input_type -> feed.plugin.v1.Empty
+	0, // 8: feed.plugin.v1.Updater.Start:output_type -> feed.plugin.v1.Empty
+	0, // 9: feed.plugin.v1.Updater.Update:output_type -> feed.plugin.v1.Empty
+	0, // 10: feed.plugin.v1.Updater.Stop:output_type -> feed.plugin.v1.Empty
+	0, // 11: feed.plugin.v1.Updater.Health:output_type -> feed.plugin.v1.Empty
+	8, // [8:12] is the sub-list for method output_type
+	4, // [4:8] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_plugin_updater_proto_init() }
+func file_plugin_updater_proto_init() {
+	if File_plugin_updater_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_plugin_updater_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Empty); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_plugin_updater_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UpdateRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_plugin_updater_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IngressEntry); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_plugin_updater_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Endpoint); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_plugin_updater_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_plugin_updater_proto_goTypes,
+		DependencyIndexes: file_plugin_updater_proto_depIdxs,
+		MessageInfos:      file_plugin_updater_proto_msgTypes,
+	}.Build()
+	File_plugin_updater_proto = out.File
+	file_plugin_updater_proto_rawDesc = nil
+	file_plugin_updater_proto_goTypes = nil
+	file_plugin_updater_proto_depIdxs = nil
+}
@@ -0,0 +1,221 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: plugin/updater.proto
+
+package plugin
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// UpdaterClient is the client API for Updater service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UpdaterClient interface {
+	// Start is called once when feed-ingress starts, before any updates.
+	Start(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error)
+	// Update is called with all the ingress entries whenever they change, and on every resync.
+	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Stop is called once when feed-ingress stops.
+	Stop(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error)
+	// Health is called often, and should respond quickly. An error status marks feed-ingress unhealthy.
+	Health(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type updaterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUpdaterClient(cc grpc.ClientConnInterface) UpdaterClient {
+	return &updaterClient{cc}
+}
+
+func (c *updaterClient) Start(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/feed.plugin.v1.Updater/Start", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *updaterClient) Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/feed.plugin.v1.Updater/Update", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *updaterClient) Stop(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/feed.plugin.v1.Updater/Stop", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *updaterClient) Health(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/feed.plugin.v1.Updater/Health", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdaterServer is the server API for Updater service.
+// All implementations must embed UnimplementedUpdaterServer
+// for forward compatibility
+type UpdaterServer interface {
+	// Start is called once when feed-ingress starts, before any updates.
+	Start(context.Context, *Empty) (*Empty, error)
+	// Update is called with all the ingress entries whenever they change, and on every resync.
+	Update(context.Context, *UpdateRequest) (*Empty, error)
+	// Stop is called once when feed-ingress stops.
+	Stop(context.Context, *Empty) (*Empty, error)
+	// Health is called often, and should respond quickly. An error status marks feed-ingress unhealthy.
+	Health(context.Context, *Empty) (*Empty, error)
+	mustEmbedUnimplementedUpdaterServer()
+}
+
+// UnimplementedUpdaterServer must be embedded to have forward compatible implementations.
+type UnimplementedUpdaterServer struct {
+}
+
+func (UnimplementedUpdaterServer) Start(context.Context, *Empty) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Start not implemented")
+}
+func (UnimplementedUpdaterServer) Update(context.Context, *UpdateRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedUpdaterServer) Stop(context.Context, *Empty) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
+}
+func (UnimplementedUpdaterServer) Health(context.Context, *Empty) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+func (UnimplementedUpdaterServer) mustEmbedUnimplementedUpdaterServer() {}
+
+// UnsafeUpdaterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UpdaterServer will
+// result in compilation errors.
+type UnsafeUpdaterServer interface {
+	mustEmbedUnimplementedUpdaterServer()
+}
+
+func RegisterUpdaterServer(s grpc.ServiceRegistrar, srv UpdaterServer) {
+	s.RegisterService(&Updater_ServiceDesc, srv)
+}
+
+func _Updater_Start_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UpdaterServer).Start(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/feed.plugin.v1.Updater/Start",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UpdaterServer).Start(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Updater_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UpdaterServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/feed.plugin.v1.Updater/Update",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UpdaterServer).Update(ctx, req.(*UpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Updater_Stop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UpdaterServer).Stop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/feed.plugin.v1.Updater/Stop",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UpdaterServer).Stop(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Updater_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UpdaterServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/feed.plugin.v1.Updater/Health",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UpdaterServer).Health(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Updater_ServiceDesc is the grpc.ServiceDesc for Updater service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Updater_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "feed.plugin.v1.Updater",
+	HandlerType: (*UpdaterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Start",
+			Handler:    _Updater_Start_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _Updater_Update_Handler,
+		},
+		{
+			MethodName: "Stop",
+			Handler:    _Updater_Stop_Handler,
+		},
+		{
+			MethodName: "Health",
+			Handler:    _Updater_Health_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "plugin/updater.proto",
+}
@@ -0,0 +1,165 @@
+/*
+Package spiffe provides an updater which keeps feed-ingress's X.509 SVID and the trust bundles up to date from the
+SPIFFE Workload API, for nginx to present to backends and verify them with.
+*/
+package spiffe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/util"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+)
+
+// Config for the SPIFFE updater.
+type Config struct {
+	// WorkloadAPIAddress is the address of the SPIFFE Workload API, e.g. unix:///run/spire/sockets/agent.sock.
+	WorkloadAPIAddress string
+	// CertificateFile is where the X.509 SVID and its intermediates are written.
+	CertificateFile string
+	// KeyFile is where the private key of the X.509 SVID is written.
+	KeyFile string
+	// BundleFile is where the X.509 authorities of every trust bundle are written, to verify backends with.
+	BundleFile string
+	// StartTimeout is how long to wait for the first SVID when starting.
+	StartTimeout time.Duration
+}
+
+// New creates an updater which writes the X.509 SVID and trust bundles from the Workload API to disk. They're
+// rewritten whenever the Workload API rotates them.
+func New(conf Config) (controller.Updater, error) {
+	if conf.WorkloadAPIAddress == "" {
+		return nil, errors.New("unable to create SPIFFE updater: missing workload API address")
+	}
+	if conf.CertificateFile == "" || conf.KeyFile == "" || conf.BundleFile == "" {
+		return nil, errors.New("unable to create SPIFFE updater: missing SVID files")
+	}
+	initMetrics()
+
+	return &spiffe{
+		Config:    conf,
+		writtenCh: make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}, nil
+}
+
+type spiffe struct {
+	Config
+	cancel      context.CancelFunc
+	writtenCh   chan struct{}
+	writtenOnce sync.Once
+	doneCh      chan struct{}
+	sync.Mutex
+	expiry time.Time
+}
+
+// Start waits for the first SVID, so nginx doesn't start without one.
+func (s *spiffe) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go func() {
+		defer close(s.doneCh)
+		// retries with backoff until the context is cancelled
+		if err := workloadapi.WatchX509Context(ctx, s, workloadapi.WithAddr(s.WorkloadAPIAddress)); err != nil && ctx.Err() == nil {
+			log.Errorf("Stopped watching the SPIFFE Workload API: %v", err)
+		}
+	}()
+
+	select {
+	case <-s.writtenCh:
+		return nil
+	case <-time.After(s.StartTimeout):
+		cancel()
+		return fmt.Errorf("timed out waiting for an X.509 SVID from the SPIFFE Workload API at %s", s.WorkloadAPIAddress)
+	}
+}
+
+func (s *spiffe) Stop() error {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.doneCh
+	}
+	return nil
+}
+
+// Health fails once the SVID has expired, as it's no longer being rotated.
+func (s *spiffe) Health() error {
+	s.Lock()
+	defer s.Unlock()
+	if !s.expiry.IsZero() && time.Now().After(s.expiry) {
+		return fmt.Errorf("X.509 SVID expired at %v", s.expiry)
+	}
+	return nil
+}
+
+func (s *spiffe) Readiness() error {
+	return nil
+}
+
+func (s *spiffe) Update(controller.IngressEntries) error {
+	return nil
+}
+
+func (s *spiffe) String() string {
+	return "SPIFFE Workload API"
+}
+
+// OnX509ContextUpdate writes the default SVID and every trust bundle, so backends in federated trust domains are
+// verified too.
+func (s *spiffe) OnX509ContextUpdate(x509Context *workloadapi.X509Context) {
+	if err := s.write(x509Context); err != nil {
+		svidFailures.Inc()
+		log.Errorf("Unable to write X.509 SVID from the SPIFFE Workload API: %v", err)
+		return
+	}
+	svidUpdates.Inc()
+	s.writtenOnce.Do(func() { close(s.writtenCh) })
+}
+
+func (s *spiffe) OnX509ContextWatchError(err error) {
+	svidFailures.Inc()
+	log.Warnf("Unable to watch the SPIFFE Workload API for X.509 SVIDs: %v", err)
+}
+
+func (s *spiffe) write(x509Context *workloadapi.X509Context) error {
+	if len(x509Context.SVIDs) == 0 {
+		return errors.New("no SVIDs returned")
+	}
+	svid := x509Context.DefaultSVID()
+	certificates, key, err := svid.Marshal()
+	if err != nil {
+		return err
+	}
+
+	var bundles []byte
+	for _, bundle := range x509Context.Bundles.Bundles() {
+		contents, err := bundle.Marshal()
+		if err != nil {
+			return fmt.Errorf("unable to marshal bundle for %s: %v", bundle.TrustDomain(), err)
+		}
+		bundles = append(bundles, contents...)
+	}
+
+	// write the key first, as nginx is only reloaded once the certificate changes
+	if err := util.WriteFileAtomically(s.KeyFile, key, 0600); err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomically(s.BundleFile, bundles, 0644); err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomically(s.CertificateFile, certificates, 0644); err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.expiry = svid.Certificates[0].NotAfter
+	s.Unlock()
+	log.Infof("Updated X.509 SVID %s, which expires at %v", svid.ID, svid.Certificates[0].NotAfter)
+	return nil
+}
@@ -0,0 +1,21 @@
+package spiffe
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+var once sync.Once
+var svidUpdates prometheus.Counter
+var svidFailures prometheus.Counter
+
+func initMetrics() {
+	once.Do(func() {
+		svidUpdates = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"spiffe_svid_updates", "The number of X.509 SVIDs and trust bundles written from the SPIFFE Workload API")
+		svidFailures = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"spiffe_svid_failures", "The number of failed attempts to watch or write X.509 SVIDs from the SPIFFE Workload API")
+	})
+}
@@ -0,0 +1,117 @@
+package spiffe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+func newSPIFFE(t *testing.T, dir string) *spiffe {
+	updater, err := New(Config{
+		WorkloadAPIAddress: "unix://" + filepath.Join(dir, "agent.sock"),
+		CertificateFile:    filepath.Join(dir, "svid.pem"),
+		KeyFile:            filepath.Join(dir, "svid_key.pem"),
+		BundleFile:         filepath.Join(dir, "svid_bundle.pem"),
+		StartTimeout:       time.Millisecond * 100,
+	})
+	assert.NoError(t, err)
+	return updater.(*spiffe)
+}
+
+func newCertificate(t *testing.T, id spiffeid.ID, notAfter time.Time) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	uri, err := url.Parse(id.String())
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		URIs:         []*url.URL{uri},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		NotBefore:    time.Now(),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert, key
+}
+
+func TestSVIDAndBundlesAreWritten(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "spiffe")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	s := newSPIFFE(t, dir)
+
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	federated := spiffeid.RequireTrustDomainFromString("federated.org")
+	cert, key := newCertificate(t, spiffeid.RequireFromPath(td, "/feed-ingress"), time.Now().Add(time.Hour))
+	federatedCA, _ := newCertificate(t, spiffeid.RequireFromPath(federated, "/ca"), time.Now().Add(time.Hour))
+	s.OnX509ContextUpdate(&workloadapi.X509Context{
+		SVIDs: []*x509svid.SVID{{ID: spiffeid.RequireFromPath(td, "/feed-ingress"), Certificates: []*x509.Certificate{cert}, PrivateKey: key}},
+		Bundles: x509bundle.NewSet(
+			x509bundle.FromX509Authorities(td, []*x509.Certificate{cert}),
+			x509bundle.FromX509Authorities(federated, []*x509.Certificate{federatedCA}),
+		),
+	})
+
+	svid, err := x509svid.Load(filepath.Join(dir, "svid.pem"), filepath.Join(dir, "svid_key.pem"))
+	assert.NoError(err)
+	assert.Equal("spiffe://example.org/feed-ingress", svid.ID.String())
+	info, err := os.Stat(filepath.Join(dir, "svid_key.pem"))
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	bundle, err := x509bundle.Load(td, filepath.Join(dir, "svid_bundle.pem"))
+	assert.NoError(err)
+	assert.Len(bundle.X509Authorities(), 2, "bundles of every trust domain should be written")
+	assert.NoError(s.Health())
+}
+
+func TestUnhealthyOnceSVIDExpires(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "spiffe")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	s := newSPIFFE(t, dir)
+
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	cert, key := newCertificate(t, spiffeid.RequireFromPath(td, "/feed-ingress"), time.Now().Add(-time.Minute))
+	s.OnX509ContextUpdate(&workloadapi.X509Context{
+		SVIDs:   []*x509svid.SVID{{ID: spiffeid.RequireFromPath(td, "/feed-ingress"), Certificates: []*x509.Certificate{cert}, PrivateKey: key}},
+		Bundles: x509bundle.NewSet(x509bundle.FromX509Authorities(td, []*x509.Certificate{cert})),
+	})
+
+	assert.Error(s.Health())
+}
+
+func TestStartFailsWithoutAnSVID(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "spiffe")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s := newSPIFFE(t, dir)
+
+	assert.Error(t, s.Start())
+	assert.NoError(t, s.Stop())
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// CertificateExpiresBefore is true if the PEM encoded certificate in file expires before t, or can't be read.
+func CertificateExpiresBefore(file string, t time.Time) bool {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return true
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+	return t.After(cert.NotAfter)
+}
+
+// WriteFileAtomically writes contents to a temporary file before renaming it to path, so readers never see
+// a partially written file.
+func WriteFileAtomically(path string, contents []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, contents, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -1,26 +1,35 @@
 package cmd
 
 import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/onrik/logrus/filename"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/prometheus/client_golang/prometheus/push"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/feed/util/metrics"
 )
 
-// Pulse represents something alive whose health and readiness can be checked.
+// Pulse represents something alive whose liveness, health and readiness can be checked.
 type Pulse interface {
+	// Liveness returns nil unless it's stuck and should be restarted.
+	Liveness() error
 	// Health returns the current health, nil if healthy.
 	Health() error
 	// Readiness returns the current readiness, nil if ready
@@ -29,20 +38,240 @@ type Pulse interface {
 	Stop() error
 }
 
-// AddHealthPort is used to expose the health over http.
-func AddHealthPort(pulse Pulse, healthPort int) {
+// HealthPortTLS configures serving the health port over https. If ClientCAFile is set, clients must
+// present a certificate signed by it.
+type HealthPortTLS struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+// Enabled returns true if the health port should be served over https.
+func (t HealthPortTLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+func (t HealthPortTLS) serverConfig() (*tls.Config, error) {
+	if t.CertFile == "" || t.KeyFile == "" {
+		return nil, errors.New("both a certificate and key are required to serve the health port over https")
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if t.ClientCAFile != "" {
+		ca, err := ioutil.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", t.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// AddHealthPort is used to expose the health over http, or https if healthPortTLS is enabled.
+func AddHealthPort(pulse Pulse, healthPort int, healthPortTLS HealthPortTLS) {
+	server := &http.Server{Addr: ":" + strconv.Itoa(healthPort)}
+	if healthPortTLS.Enabled() {
+		tlsConfig, err := healthPortTLS.serverConfig()
+		if err != nil {
+			log.Fatalf("Unable to configure health port: %v", err)
+		}
+		server.TLSConfig = tlsConfig
+	}
+
 	http.HandleFunc("/health", healthHandler(pulse))
 	http.HandleFunc("/readiness", readinessHandler(pulse))
-	http.Handle("/metrics", promhttp.Handler())
-	http.HandleFunc("/alive", okHandler)
+	http.HandleFunc("/ready", readinessHandler(pulse))
+	if prometheusExporterEnabled {
+		// OpenMetrics is served to scrapers which ask for it, as it's needed for exemplars
+		http.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	}
+	http.HandleFunc("/alive", livenessHandler(pulse))
 
 	go func() {
-		log.Error(http.ListenAndServe(":"+strconv.Itoa(healthPort), nil))
+		if healthPortTLS.Enabled() {
+			log.Error(server.ListenAndServeTLS(healthPortTLS.CertFile, healthPortTLS.KeyFile))
+		} else {
+			log.Error(server.ListenAndServe())
+		}
 		log.Info(pulse.Stop())
 		os.Exit(-1)
 	}()
 }
 
+// ResyncPath is the admin endpoint for forcing a resync.
+const ResyncPath = "/admin/resync"
+
+// AddPage serves a page on the health port.
+func AddPage(path string, handler http.Handler) {
+	http.Handle(path, handler)
+}
+
+// AdminPort configures the port admin actions are served on. It's disabled unless Port is set, and only listens on
+// localhost, so actions can't be triggered by anything which reaches the health port, such as frontends.
+type AdminPort struct {
+	Port int
+	// TokenFile holds a token which must also be sent as a bearer token, if set.
+	TokenFile string
+}
+
+// Enabled returns true if admin actions should be served.
+func (a AdminPort) Enabled() bool {
+	return a.Port != 0
+}
+
+var adminMux = http.NewServeMux()
+
+// AddAdminHandler exposes an action on the admin port, triggered by a POST to path.
+func AddAdminHandler(path string, action func() error) {
+	adminMux.HandleFunc(path, adminHandler(action))
+}
+
+// AddAdminPort serves the admin actions on localhost, if adminPort is enabled.
+func AddAdminPort(adminPort AdminPort) {
+	if !adminPort.Enabled() {
+		return
+	}
+
+	var handler http.Handler = adminMux
+	if adminPort.TokenFile != "" {
+		token, err := ioutil.ReadFile(adminPort.TokenFile)
+		if err != nil {
+			log.Fatalf("Unable to read admin token: %v", err)
+		}
+		if handler, err = requireToken(strings.TrimSpace(string(token)), adminMux); err != nil {
+			log.Fatalf("Unable to configure admin port: %v", err)
+		}
+	}
+
+	server := &http.Server{Addr: "127.0.0.1:" + strconv.Itoa(adminPort.Port), Handler: handler}
+	go func() {
+		log.Errorf("Admin port stopped: %v", server.ListenAndServe())
+	}()
+}
+
+// DebugPort configures the port /debug/pprof is served on. It's disabled unless Port is set. It only listens on
+// localhost, unless Allow has CIDRs whose clients may also reach it.
+type DebugPort struct {
+	Port int
+	// Allow is the CIDRs of clients allowed to reach the debug port, besides localhost.
+	Allow []string
+}
+
+// Enabled returns true if the debug endpoints should be served.
+func (d DebugPort) Enabled() bool {
+	return d.Port != 0
+}
+
+// AddDebugPort serves /debug/pprof, if debugPort is enabled.
+func AddDebugPort(debugPort DebugPort) {
+	if !debugPort.Enabled() {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	address := "127.0.0.1:" + strconv.Itoa(debugPort.Port)
+	var handler http.Handler = mux
+	if len(debugPort.Allow) > 0 {
+		var err error
+		if handler, err = allowCIDRs(debugPort.Allow, mux); err != nil {
+			log.Fatalf("Unable to configure debug port: %v", err)
+		}
+		address = ":" + strconv.Itoa(debugPort.Port)
+	}
+
+	server := &http.Server{Addr: address, Handler: handler}
+	go func() {
+		log.Errorf("Debug port stopped: %v", server.ListenAndServe())
+	}()
+}
+
+// allowCIDRs only lets requests through to handler if they're from localhost or one of the cidrs.
+func allowCIDRs(cidrs []string, handler http.Handler) (http.Handler, error) {
+	var allowed []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", cidr, err)
+		}
+		allowed = append(allowed, ipNet)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !remoteAllowed(r.RemoteAddr, allowed) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, "forbidden\n")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}), nil
+}
+
+func remoteAllowed(remoteAddr string, allowed []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, ipNet := range allowed {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireToken only lets requests through to handler if they have token as their bearer token.
+func requireToken(token string, handler http.Handler) (http.Handler, error) {
+	if token == "" {
+		return nil, errors.New("the admin token is empty")
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, "a valid bearer token is required\n")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}), nil
+}
+
+func adminHandler(action func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_, _ = io.WriteString(w, "only POST is allowed\n")
+			return
+		}
+
+		if err := action(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, fmt.Sprintf("%v\n", err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "ok\n")
+	}
+}
+
 func healthHandler(pulse Pulse) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := pulse.Health(); err != nil {
@@ -69,9 +298,17 @@ func readinessHandler(pulse Pulse) http.HandlerFunc {
 	}
 }
 
-func okHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	_, _ = io.WriteString(w, "ok\n")
+func livenessHandler(pulse Pulse) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := pulse.Liveness(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, fmt.Sprintf("%v\n", err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "ok\n")
+	}
 }
 
 const pollInterval = time.Second
@@ -107,6 +344,7 @@ func AddSignalHandler(pulse Pulse) {
 		for sig := range c {
 			log.Infof("Signalled %v, shutting down gracefully", sig)
 			err := pulse.Stop()
+			stopMetricsPusher()
 			if err != nil {
 				log.Errorf("Error while stopping: %v", err)
 				os.Exit(-1)
@@ -116,6 +354,21 @@ func AddSignalHandler(pulse Pulse) {
 	}()
 }
 
+// AddResyncSignalHandler calls resync whenever SIGHUP is received.
+func AddResyncSignalHandler(resync func() error) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	go func() {
+		for range c {
+			log.Info("Signalled SIGHUP, forcing a resync")
+			if err := resync(); err != nil {
+				log.Errorf("Unable to resync: %v", err)
+			}
+		}
+	}()
+}
+
 // ConfigureLogging sets logging to Stdout and manages setting debug level
 func ConfigureLogging(debug bool) {
 	// logging is the main output, so write it all to stdout
@@ -130,13 +383,42 @@ func ConfigureLogging(debug bool) {
 
 // ConfigureMetrics sets up metrics pushing and default labels. This must be called before any metrics
 // are defined.
-func ConfigureMetrics(job string, prometheusLabels KeyValues, pushgatewayURL string, pushgatewayIntervalSeconds int) {
+func ConfigureMetrics(job string, prometheusLabels KeyValues, pushgateway Pushgateway) error {
 	labels := make(prometheus.Labels)
 	for _, l := range prometheusLabels {
 		labels[l.key] = l.value
 	}
 	metrics.SetConstLabels(labels)
-	addMetricsPusher(job, pushgatewayURL, time.Second*time.Duration(pushgatewayIntervalSeconds))
+	return addMetricsPusher(job, pushgateway)
+}
+
+const (
+	// PrometheusExporter serves metrics on the health port for prometheus to scrape.
+	PrometheusExporter = "prometheus"
+	// StatsDExporter sends metrics to a StatsD server.
+	StatsDExporter = "statsd"
+)
+
+var prometheusExporterEnabled = true
+
+// ConfigureExporters sets which exporters metrics are made available through. This must be called
+// before AddHealthPort.
+func ConfigureExporters(exporters []string, statsDConfig metrics.StatsDConfig) error {
+	prometheusExporterEnabled = false
+	for _, exporter := range exporters {
+		switch exporter {
+		case PrometheusExporter:
+			prometheusExporterEnabled = true
+		case StatsDExporter:
+			if err := metrics.StartStatsDExporter(statsDConfig); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown metrics exporter %q, must be one of %s or %s",
+				exporter, PrometheusExporter, StatsDExporter)
+		}
+	}
+	return nil
 }
 
 // AddHealthMetrics adds a global health metric for the given pulse. This should only be called
@@ -151,25 +433,3 @@ func createUnhealthyCounter(subsystem string) prometheus.Counter {
 		fmt.Sprintf("The number of seconds %s-%s has been unhealthy.",
 			metrics.PrometheusNamespace, subsystem))
 }
-
-// AddMetricsPusher starts a periodic push of metrics to a prometheus pushgateway.
-func addMetricsPusher(job, pushgatewayURL string, interval time.Duration) {
-	if pushgatewayURL == "" {
-		return
-	}
-
-	go func() {
-		tick := time.Tick(interval)
-		for range tick {
-			instance, err := os.Hostname()
-			if err != nil {
-				log.Warnf("Unable to lookup hostname for metrics: %v", err)
-				continue
-			}
-
-			if err := push.New(pushgatewayURL, job).Grouping("instance", instance).Push(); err != nil {
-				log.Warnf("Unable to push metrics: %v", err)
-			}
-		}
-	}()
-}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthPortTLSRequiresCertAndKey(t *testing.T) {
+	asserter := assert.New(t)
+
+	asserter.False(HealthPortTLS{}.Enabled())
+	asserter.True(HealthPortTLS{CertFile: "cert.pem"}.Enabled())
+
+	_, err := HealthPortTLS{CertFile: "cert.pem"}.serverConfig()
+	asserter.Error(err)
+}
+
+func TestHealthPortTLSWithoutClientCADoesNotRequireClientCerts(t *testing.T) {
+	asserter := assert.New(t)
+
+	config, err := HealthPortTLS{CertFile: "cert.pem", KeyFile: "key.pem"}.serverConfig()
+
+	asserter.NoError(err)
+	asserter.Equal(tls.NoClientCert, config.ClientAuth)
+}
+
+func TestHealthPortTLSRejectsInvalidClientCA(t *testing.T) {
+	asserter := assert.New(t)
+	caFile, err := ioutil.TempFile("", "client-ca")
+	asserter.NoError(err)
+	defer os.Remove(caFile.Name())
+	_, _ = caFile.WriteString("not a certificate")
+	caFile.Close()
+
+	_, err = HealthPortTLS{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: caFile.Name()}.serverConfig()
+	asserter.Error(err)
+
+	_, err = HealthPortTLS{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "/does/not/exist"}.serverConfig()
+	asserter.Error(err)
+}
+
+func TestAdminHandlerOnlyRunsActionOnPost(t *testing.T) {
+	asserter := assert.New(t)
+	calls := 0
+	handler := adminHandler(func() error {
+		calls++
+		return nil
+	})
+
+	get := httptest.NewRecorder()
+	handler(get, httptest.NewRequest(http.MethodGet, "/admin/action", nil))
+	asserter.Equal(http.StatusMethodNotAllowed, get.Code)
+	asserter.Equal(0, calls)
+
+	post := httptest.NewRecorder()
+	handler(post, httptest.NewRequest(http.MethodPost, "/admin/action", nil))
+	asserter.Equal(http.StatusOK, post.Code)
+	asserter.Equal(1, calls)
+}
+
+func TestAdminHandlerReturnsActionErrors(t *testing.T) {
+	asserter := assert.New(t)
+	handler := adminHandler(func() error { return errors.New("boom") })
+
+	post := httptest.NewRecorder()
+	handler(post, httptest.NewRequest(http.MethodPost, "/admin/action", nil))
+
+	asserter.Equal(http.StatusInternalServerError, post.Code)
+	asserter.Equal("boom\n", post.Body.String())
+}
+
+func TestAdminTokenIsRequired(t *testing.T) {
+	asserter := assert.New(t)
+	handler, err := requireToken("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	asserter.NoError(err)
+
+	for header, code := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/action", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		asserter.Equal(code, resp.Code, header)
+	}
+
+	_, err = requireToken("", handler)
+	asserter.Error(err)
+}
+
+func TestDebugPortOnlyAllowsLocalhostAndAllowedCIDRs(t *testing.T) {
+	asserter := assert.New(t)
+	handler, err := allowCIDRs([]string{"10.0.0.0/8", "fd00::/8"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	asserter.NoError(err)
+
+	for remoteAddr, code := range map[string]int{
+		"127.0.0.1:1234":   http.StatusOK,
+		"[::1]:1234":       http.StatusOK,
+		"10.1.2.3:1234":    http.StatusOK,
+		"[fd00::1]:1234":   http.StatusOK,
+		"192.168.0.1:1234": http.StatusForbidden,
+		"[fe80::1]:1234":   http.StatusForbidden,
+		"garbage":          http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+		req.RemoteAddr = remoteAddr
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		asserter.Equal(code, resp.Code, remoteAddr)
+	}
+
+	_, err = allowCIDRs([]string{"10.0.0.0"}, handler)
+	asserter.Error(err)
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	log "github.com/sirupsen/logrus"
+)
+
+// Pushgateway configures pushing metrics to a prometheus pushgateway. Pushing is disabled unless URL is set.
+type Pushgateway struct {
+	URL             string
+	IntervalSeconds int
+	// Grouping labels are added to the grouping key, so each replica pushes to its own group. The instance label
+	// defaults to the hostname, which is the node's rather than the pod's when running on the host network, so it
+	// can be set to the pod name here.
+	Grouping KeyValues
+	// Username and PasswordFile are sent as basic auth, if Username is set.
+	Username     string
+	PasswordFile string
+	// CAFile verifies the pushgateway's certificate instead of the system CAs, if set.
+	CAFile string
+	// DeleteOnShutdown deletes the group when shut down by a signal, so the metrics of a gone replica don't linger.
+	DeleteOnShutdown bool
+}
+
+// Enabled returns true if metrics should be pushed.
+func (p Pushgateway) Enabled() bool {
+	return p.URL != ""
+}
+
+// pusher pushes the metrics of the default registry to a single group until stopped.
+type pusher struct {
+	pusher           *push.Pusher
+	interval         time.Duration
+	deleteOnShutdown bool
+	stop             chan struct{}
+	stopped          chan struct{}
+}
+
+var metricsPusher *pusher
+
+func newPusher(job string, pushgateway Pushgateway) (*pusher, error) {
+	instance, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("unable to lookup hostname for the instance label: %v", err)
+	}
+	grouping := map[string]string{"instance": instance}
+	for _, kv := range pushgateway.Grouping {
+		grouping[kv.key] = kv.value
+	}
+
+	p := push.New(pushgateway.URL, job).Gatherer(prometheus.DefaultGatherer)
+	for name, value := range grouping {
+		p = p.Grouping(name, value)
+	}
+
+	if pushgateway.Username != "" {
+		password, err := ioutil.ReadFile(pushgateway.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read pushgateway password: %v", err)
+		}
+		p = p.BasicAuth(pushgateway.Username, strings.TrimSpace(string(password)))
+	}
+
+	if pushgateway.CAFile != "" {
+		ca, err := ioutil.ReadFile(pushgateway.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read pushgateway CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in pushgateway CA %s", pushgateway.CAFile)
+		}
+		p = p.Client(&http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		}})
+	}
+
+	return &pusher{
+		pusher:           p,
+		interval:         time.Second * time.Duration(pushgateway.IntervalSeconds),
+		deleteOnShutdown: pushgateway.DeleteOnShutdown,
+		stop:             make(chan struct{}),
+		stopped:          make(chan struct{}),
+	}, nil
+}
+
+// run pushes the metrics every interval until stopped.
+func (p *pusher) run() {
+	defer close(p.stopped)
+	tick := time.NewTicker(p.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := p.pusher.Push(); err != nil {
+				log.Warnf("Unable to push metrics: %v", err)
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// shutdown stops pushing, and deletes the group if configured to, so a push can't recreate it afterwards.
+func (p *pusher) shutdown() {
+	close(p.stop)
+	<-p.stopped
+	if !p.deleteOnShutdown {
+		return
+	}
+	if err := p.pusher.Delete(); err != nil {
+		log.Warnf("Unable to delete pushed metrics: %v", err)
+	}
+}
+
+// addMetricsPusher starts a periodic push of metrics to a prometheus pushgateway.
+func addMetricsPusher(job string, pushgateway Pushgateway) error {
+	if !pushgateway.Enabled() {
+		return nil
+	}
+
+	p, err := newPusher(job, pushgateway)
+	if err != nil {
+		return err
+	}
+	metricsPusher = p
+	go p.run()
+	return nil
+}
+
+// stopMetricsPusher stops pushing metrics, if they're pushed.
+func stopMetricsPusher() {
+	if metricsPusher != nil {
+		metricsPusher.shutdown()
+	}
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pushRequest struct {
+	method, path, username, password string
+}
+
+func fakePushgateway() (*httptest.Server, func() []pushRequest) {
+	var lock sync.Mutex
+	var requests []pushRequest
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		lock.Lock()
+		requests = append(requests, pushRequest{r.Method, r.URL.Path, username, password})
+		lock.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	return server, func() []pushRequest {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]pushRequest(nil), requests...)
+	}
+}
+
+func writeTempFile(t *testing.T, contents []byte) string {
+	f, err := ioutil.TempFile("", "pushgateway")
+	assert.NoError(t, err)
+	_, _ = f.Write(contents)
+	f.Close()
+	return f.Name()
+}
+
+func TestPusherPushesToItsGroupWithBasicAuthOverTLS(t *testing.T) {
+	asserter := assert.New(t)
+	server, requests := fakePushgateway()
+	defer server.Close()
+	caFile := writeTempFile(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	defer os.Remove(caFile)
+	passwordFile := writeTempFile(t, []byte("secret\n"))
+	defer os.Remove(passwordFile)
+
+	var grouping KeyValues
+	asserter.NoError(grouping.Set("instance=feed-ingress-abcde"))
+	p, err := newPusher("feed-ingress", Pushgateway{
+		URL:              server.URL,
+		IntervalSeconds:  1,
+		Grouping:         grouping,
+		Username:         "feed",
+		PasswordFile:     passwordFile,
+		CAFile:           caFile,
+		DeleteOnShutdown: true,
+	})
+	asserter.NoError(err)
+
+	asserter.NoError(p.pusher.Push())
+	go p.run()
+	p.shutdown()
+
+	asserter.Equal([]pushRequest{
+		{http.MethodPut, "/metrics/job/feed-ingress/instance/feed-ingress-abcde", "feed", "secret"},
+		{http.MethodDelete, "/metrics/job/feed-ingress/instance/feed-ingress-abcde", "feed", "secret"},
+	}, requests())
+}
+
+func TestPusherOnlyDeletesItsGroupIfConfiguredTo(t *testing.T) {
+	asserter := assert.New(t)
+	server, requests := fakePushgateway()
+	defer server.Close()
+	caFile := writeTempFile(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	defer os.Remove(caFile)
+
+	p, err := newPusher("feed-dns", Pushgateway{URL: server.URL, IntervalSeconds: 1, CAFile: caFile})
+	asserter.NoError(err)
+	go p.run()
+	p.shutdown()
+
+	for _, r := range requests() {
+		asserter.NotEqual(http.MethodDelete, r.method)
+	}
+}
+
+func TestPusherRejectsInvalidCA(t *testing.T) {
+	asserter := assert.New(t)
+	caFile := writeTempFile(t, []byte("not a certificate"))
+	defer os.Remove(caFile)
+
+	_, err := newPusher("feed-ingress", Pushgateway{URL: "https://pushgateway", IntervalSeconds: 1, CAFile: caFile})
+	asserter.Error(err)
+
+	_, err = newPusher("feed-ingress", Pushgateway{URL: "https://pushgateway", IntervalSeconds: 1,
+		Username: "feed", PasswordFile: "/does/not/exist"})
+	asserter.Error(err)
+}
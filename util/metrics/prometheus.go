@@ -14,6 +14,8 @@ const (
 	PrometheusIngressSubsystem = "ingress"
 	// PrometheusDNSSubsystem is the metric subsystem for feed-dns.
 	PrometheusDNSSubsystem = "dns"
+	// PrometheusControllerSubsystem is the metric subsystem for the controller shared by feed binaries.
+	PrometheusControllerSubsystem = "controller"
 )
 
 var labelsLock sync.Mutex
@@ -64,6 +66,17 @@ func counterOpts(subsystem, name, help string) prometheus.CounterOpts {
 	}
 }
 
+func histogramOpts(subsystem, name, help string, buckets []float64) prometheus.HistogramOpts {
+	return prometheus.HistogramOpts{
+		Namespace:   PrometheusNamespace,
+		Subsystem:   subsystem,
+		Name:        name,
+		Help:        help,
+		Buckets:     buckets,
+		ConstLabels: ConstLabels(),
+	}
+}
+
 func register(collector prometheus.Collector, name string) prometheus.Collector {
 	err := prometheus.Register(collector)
 	if err != nil {
@@ -86,3 +99,20 @@ func RegisterNewDefaultGaugeVec(subsystem, name, help string, labelNames []strin
 func RegisterNewDefaultCounter(subsystem, name, help string) prometheus.Counter {
 	return register(prometheus.NewCounter(counterOpts(subsystem, name, help)), name).(prometheus.Counter)
 }
+
+// RegisterNewDefaultHistogram creates and registers a named Histogram with default options.
+// If buckets is nil, prometheus.DefBuckets is used.
+func RegisterNewDefaultHistogram(subsystem, name, help string, buckets []float64) prometheus.Histogram {
+	return register(prometheus.NewHistogram(histogramOpts(subsystem, name, help, buckets)), name).(prometheus.Histogram)
+}
+
+// RegisterNewDefaultHistogramVec creates and registers a named HistogramVec with default options.
+// If buckets is nil, prometheus.DefBuckets is used.
+func RegisterNewDefaultHistogramVec(subsystem, name, help string, buckets []float64, labelNames []string) *prometheus.HistogramVec {
+	return register(prometheus.NewHistogramVec(histogramOpts(subsystem, name, help, buckets), labelNames), name).(*prometheus.HistogramVec)
+}
+
+// RegisterNewDefaultCounterVec creates and registers a named CounterVec with default options
+func RegisterNewDefaultCounterVec(subsystem, name, help string, labelNames []string) *prometheus.CounterVec {
+	return register(prometheus.NewCounterVec(counterOpts(subsystem, name, help), labelNames), name).(*prometheus.CounterVec)
+}
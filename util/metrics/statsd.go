@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+// StatsDConfig configures the export of metrics to a StatsD server.
+type StatsDConfig struct {
+	// Address of the StatsD server, as host:port.
+	Address string
+	// Prefix prepended to all metric names.
+	Prefix string
+	// Tags are key:value pairs attached to all metrics. Only sent when DogStatsD is enabled.
+	Tags []string
+	// DogStatsD sends labels and tags using the DogStatsD extension. Otherwise label values are
+	// appended to the metric name.
+	DogStatsD bool
+	// Interval between sending metrics.
+	Interval time.Duration
+}
+
+type statsDExporter struct {
+	conf     StatsDConfig
+	gatherer prometheus.Gatherer
+	conn     net.Conn
+	// previous values of counters, as StatsD expects counters to be sent as increments
+	previous map[string]float64
+}
+
+// StartStatsDExporter periodically sends all registered prometheus metrics to a StatsD server.
+// Gauges are sent as StatsD gauges, and counters as the increment since they were last sent.
+func StartStatsDExporter(conf StatsDConfig) error {
+	if conf.Address == "" {
+		return fmt.Errorf("missing statsd address")
+	}
+	if conf.Interval <= 0 {
+		return fmt.Errorf("invalid statsd interval %v", conf.Interval)
+	}
+
+	conn, err := net.Dial("udp", conf.Address)
+	if err != nil {
+		return fmt.Errorf("unable to connect to statsd at %s: %v", conf.Address, err)
+	}
+
+	exporter := &statsDExporter{
+		conf:     conf,
+		gatherer: prometheus.DefaultGatherer,
+		conn:     conn,
+		previous: make(map[string]float64),
+	}
+
+	go func() {
+		tick := time.Tick(conf.Interval)
+		for range tick {
+			if err := exporter.export(); err != nil {
+				log.Warnf("Unable to send metrics to statsd: %v", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (e *statsDExporter) export() error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	for _, line := range e.lines(families) {
+		if _, err := e.conn.Write([]byte(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *statsDExporter) lines(families []*dto.MetricFamily) []string {
+	var lines []string
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			name := e.name(family.GetName())
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = append(lines, e.counter(name, metric.Label, metric.Counter.GetValue()))
+			case dto.MetricType_GAUGE:
+				lines = append(lines, e.line(name, metric.Label, metric.Gauge.GetValue(), "g"))
+			case dto.MetricType_UNTYPED:
+				lines = append(lines, e.line(name, metric.Label, metric.Untyped.GetValue(), "g"))
+			case dto.MetricType_HISTOGRAM:
+				lines = append(lines, e.counter(name+"_count", metric.Label, float64(metric.Histogram.GetSampleCount())))
+				lines = append(lines, e.counter(name+"_sum", metric.Label, metric.Histogram.GetSampleSum()))
+			case dto.MetricType_SUMMARY:
+				lines = append(lines, e.counter(name+"_count", metric.Label, float64(metric.Summary.GetSampleCount())))
+				lines = append(lines, e.counter(name+"_sum", metric.Label, metric.Summary.GetSampleSum()))
+			}
+		}
+	}
+	return lines
+}
+
+func (e *statsDExporter) name(name string) string {
+	if e.conf.Prefix == "" {
+		return name
+	}
+	return strings.TrimSuffix(e.conf.Prefix, ".") + "." + name
+}
+
+func (e *statsDExporter) counter(name string, labels []*dto.LabelPair, value float64) string {
+	key := name + labelString(labels)
+	increment := value - e.previous[key]
+	if increment < 0 {
+		// counter has been reset
+		increment = value
+	}
+	e.previous[key] = value
+	return e.line(name, labels, increment, "c")
+}
+
+func (e *statsDExporter) line(name string, labels []*dto.LabelPair, value float64, metricType string) string {
+	formattedValue := strconv.FormatFloat(value, 'f', -1, 64)
+	if !e.conf.DogStatsD {
+		for _, label := range sortedLabels(labels) {
+			name += "." + sanitise(label.GetValue())
+		}
+		return fmt.Sprintf("%s:%s|%s", name, formattedValue, metricType)
+	}
+
+	var tags []string
+	for _, label := range sortedLabels(labels) {
+		tags = append(tags, label.GetName()+":"+label.GetValue())
+	}
+	tags = append(tags, e.conf.Tags...)
+	if len(tags) == 0 {
+		return fmt.Sprintf("%s:%s|%s", name, formattedValue, metricType)
+	}
+	return fmt.Sprintf("%s:%s|%s|#%s", name, formattedValue, metricType, strings.Join(tags, ","))
+}
+
+func sortedLabels(labels []*dto.LabelPair) []*dto.LabelPair {
+	sorted := make([]*dto.LabelPair, len(labels))
+	copy(sorted, labels)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GetName() < sorted[j].GetName() })
+	return sorted
+}
+
+func labelString(labels []*dto.LabelPair) string {
+	var s strings.Builder
+	for _, label := range sortedLabels(labels) {
+		s.WriteString(fmt.Sprintf(",%s=%s", label.GetName(), label.GetValue()))
+	}
+	return s.String()
+}
+
+// sanitise replaces characters which have a special meaning in the StatsD protocol.
+func sanitise(value string) string {
+	return strings.NewReplacer(":", "_", "|", "_", "@", "_", ".", "_", "/", "_").Replace(value)
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func strPtr(s string) *string { return &s }
+
+func floatPtr(f float64) *float64 { return &f }
+
+func counterFamily(value float64) []*dto.MetricFamily {
+	return []*dto.MetricFamily{{
+		Name: strPtr("feed_ingress_reloads"),
+		Type: dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{{
+			Label:   []*dto.LabelPair{{Name: strPtr("host"), Value: strPtr("foo.com")}},
+			Counter: &dto.Counter{Value: floatPtr(value)},
+		}},
+	}}
+}
+
+func gaugeFamily(value float64) []*dto.MetricFamily {
+	return []*dto.MetricFamily{{
+		Name: strPtr("feed_ingress_nginx_connections"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{{Name: strPtr("path"), Value: strPtr("/foo/")}},
+			Gauge: &dto.Gauge{Value: floatPtr(value)},
+		}},
+	}}
+}
+
+func TestStatsDCountersAreSentAsIncrements(t *testing.T) {
+	assert := assert.New(t)
+	exporter := &statsDExporter{conf: StatsDConfig{Prefix: "edge"}, previous: make(map[string]float64)}
+
+	assert.Equal([]string{"edge.feed_ingress_reloads.foo_com:5|c"}, exporter.lines(counterFamily(5)))
+	assert.Equal([]string{"edge.feed_ingress_reloads.foo_com:2|c"}, exporter.lines(counterFamily(7)))
+	assert.Equal([]string{"edge.feed_ingress_reloads.foo_com:1|c"}, exporter.lines(counterFamily(1)), "should handle reset")
+}
+
+func TestStatsDGaugesAreSentAsValues(t *testing.T) {
+	assert := assert.New(t)
+	exporter := &statsDExporter{previous: make(map[string]float64)}
+
+	assert.Equal([]string{"feed_ingress_nginx_connections._foo_:2.5|g"}, exporter.lines(gaugeFamily(2.5)))
+}
+
+func TestDogStatsDSendsLabelsAsTags(t *testing.T) {
+	assert := assert.New(t)
+	exporter := &statsDExporter{conf: StatsDConfig{DogStatsD: true, Tags: []string{"env:dev"}},
+		previous: make(map[string]float64)}
+
+	assert.Equal([]string{"feed_ingress_nginx_connections:3|g|#path:/foo/,env:dev"}, exporter.lines(gaugeFamily(3)))
+}
@@ -1,9 +1,12 @@
 package test
 
 import (
+	"time"
+
 	"github.com/sky-uk/feed/k8s"
 	"github.com/stretchr/testify/mock"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 )
 
@@ -42,18 +45,120 @@ func (c *FakeClient) WatchServices() k8s.Watcher {
 	return r.Get(0).(k8s.Watcher)
 }
 
+// SetReferencedServices mocks out calls to SetReferencedServices
+func (c *FakeClient) SetReferencedServices(services map[string]bool) error {
+	r := c.Called(services)
+	return r.Error(0)
+}
+
 // WatchNamespaces mocks out calls to WatchNamespaces
 func (c *FakeClient) WatchNamespaces() k8s.Watcher {
 	r := c.Called()
 	return r.Get(0).(k8s.Watcher)
 }
 
+// GetNamespaces mocks out calls to GetNamespaces
+func (c *FakeClient) GetNamespaces() ([]*corev1.Namespace, error) {
+	r := c.Called()
+	return r.Get(0).([]*corev1.Namespace), r.Error(1)
+}
+
 // UpdateIngressStatus mocks out calls to UpdateIngressStatus
 func (c *FakeClient) UpdateIngressStatus(*networkingv1.Ingress) error {
 	r := c.Called()
 	return r.Error(0)
 }
 
+// GetRoutePolicies mocks out calls to GetRoutePolicies
+func (c *FakeClient) GetRoutePolicies() ([]*k8s.RoutePolicy, error) {
+	r := c.Called()
+	return r.Get(0).([]*k8s.RoutePolicy), r.Error(1)
+}
+
+// WatchRoutePolicies mocks out calls to WatchRoutePolicies
+func (c *FakeClient) WatchRoutePolicies() k8s.Watcher {
+	r := c.Called()
+	return r.Get(0).(k8s.Watcher)
+}
+
+// GetConfigMaps mocks out calls to GetConfigMaps
+func (c *FakeClient) GetConfigMaps() ([]*corev1.ConfigMap, error) {
+	r := c.Called()
+	return r.Get(0).([]*corev1.ConfigMap), r.Error(1)
+}
+
+// WatchConfigMaps mocks out calls to WatchConfigMaps
+func (c *FakeClient) WatchConfigMaps() k8s.Watcher {
+	r := c.Called()
+	return r.Get(0).(k8s.Watcher)
+}
+
+// GetEndpointSlices mocks out calls to GetEndpointSlices
+func (c *FakeClient) GetEndpointSlices() ([]*discoveryv1.EndpointSlice, error) {
+	r := c.Called()
+	return r.Get(0).([]*discoveryv1.EndpointSlice), r.Error(1)
+}
+
+// WatchEndpointSlices mocks out calls to WatchEndpointSlices
+func (c *FakeClient) WatchEndpointSlices() k8s.Watcher {
+	r := c.Called()
+	return r.Get(0).(k8s.Watcher)
+}
+
+// SetEndpointSliceServices mocks out calls to SetEndpointSliceServices
+func (c *FakeClient) SetEndpointSliceServices(services map[string]bool) error {
+	r := c.Called(services)
+	return r.Error(0)
+}
+
+// GetSecrets mocks out calls to GetSecrets
+func (c *FakeClient) GetSecrets() ([]*corev1.Secret, error) {
+	r := c.Called()
+	return r.Get(0).([]*corev1.Secret), r.Error(1)
+}
+
+// WatchSecrets mocks out calls to WatchSecrets
+func (c *FakeClient) WatchSecrets() k8s.Watcher {
+	r := c.Called()
+	return r.Get(0).(k8s.Watcher)
+}
+
+// GetPods mocks out calls to GetPods
+func (c *FakeClient) GetPods() ([]*corev1.Pod, error) {
+	r := c.Called()
+	return r.Get(0).([]*corev1.Pod), r.Error(1)
+}
+
+// WatchPods mocks out calls to WatchPods
+func (c *FakeClient) WatchPods() k8s.Watcher {
+	r := c.Called()
+	return r.Get(0).(k8s.Watcher)
+}
+
+// RecordIngressEvent mocks out calls to RecordIngressEvent
+func (c *FakeClient) RecordIngressEvent(ingress *networkingv1.Ingress, reason, message string) error {
+	r := c.Called(ingress, reason, message)
+	return r.Error(0)
+}
+
+// GetNode mocks out calls to GetNode
+func (c *FakeClient) GetNode(name string) (*corev1.Node, error) {
+	r := c.Called(name)
+	return r.Get(0).(*corev1.Node), r.Error(1)
+}
+
+// WatchActivity mocks out calls to WatchActivity
+func (c *FakeClient) WatchActivity() map[string]time.Time {
+	r := c.Called()
+	return r.Get(0).(map[string]time.Time)
+}
+
+// Relist mocks out calls to Relist
+func (c *FakeClient) Relist() error {
+	r := c.Called()
+	return r.Error(0)
+}
+
 func (c *FakeClient) String() string {
 	return "FakeClient"
 }
@@ -0,0 +1,163 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// client is a minimal client for the Vault HTTP API.
+type client struct {
+	address    string
+	httpClient *http.Client
+	token      string
+	// renewable tokens are renewed before their lease expires, others are replaced by logging in again
+	renewable  bool
+	tokenTTL   time.Duration
+	tokenSince time.Time
+}
+
+type secret struct {
+	Data          map[string]interface{} `json:"data"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+func (c *client) request(method, path string, body interface{}) (*secret, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.address, "/")+"/v1/"+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Vault-Token", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		contents, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status %d from %s %s: %s", resp.StatusCode, method, path, strings.TrimSpace(string(contents)))
+	}
+
+	var s secret
+	if resp.StatusCode == http.StatusNoContent {
+		return &s, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return nil, fmt.Errorf("unable to decode response from %s %s: %v", method, path, err)
+	}
+	return &s, nil
+}
+
+// loginKubernetes exchanges the pod's service account token for a Vault token.
+func (c *client) loginKubernetes(mount, role, jwtFile string, now time.Time) error {
+	jwt, err := ioutil.ReadFile(jwtFile)
+	if err != nil {
+		return fmt.Errorf("unable to read service account token: %v", err)
+	}
+
+	s, err := c.request(http.MethodPost, "auth/"+mount+"/login", map[string]string{"role": role, "jwt": strings.TrimSpace(string(jwt))})
+	if err != nil {
+		return err
+	}
+	if s.Auth == nil {
+		return fmt.Errorf("no token returned from login")
+	}
+	c.token = s.Auth.ClientToken
+	c.renewable = s.Auth.Renewable
+	c.tokenTTL = time.Duration(s.Auth.LeaseDuration) * time.Second
+	c.tokenSince = now
+	return nil
+}
+
+// renewToken extends the lease of the current token.
+func (c *client) renewToken(now time.Time) error {
+	s, err := c.request(http.MethodPost, "auth/token/renew-self", map[string]string{})
+	if err != nil {
+		return err
+	}
+	if s.Auth != nil {
+		c.tokenTTL = time.Duration(s.Auth.LeaseDuration) * time.Second
+		c.tokenSince = now
+	}
+	return nil
+}
+
+// tokenExpiring is true once two thirds of the token's lease has passed. Tokens without a lease never expire.
+func (c *client) tokenExpiring(now time.Time) bool {
+	if c.tokenTTL == 0 {
+		return false
+	}
+	return now.After(c.tokenSince.Add(c.tokenTTL * 2 / 3))
+}
+
+// issueCertificate issues a certificate for host from the PKI secrets engine, returning the PEM encoded chain
+// and private key.
+func (c *client) issueCertificate(mount, role, host string, ttl time.Duration) ([]byte, []byte, error) {
+	request := map[string]string{"common_name": host}
+	if ttl > 0 {
+		request["ttl"] = ttl.String()
+	}
+	s, err := c.request(http.MethodPost, mount+"/issue/"+role, request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certificate, _ := s.Data["certificate"].(string)
+	key, _ := s.Data["private_key"].(string)
+	if certificate == "" || key == "" {
+		return nil, nil, fmt.Errorf("no certificate returned for %s", host)
+	}
+	chain := certificate + "\n"
+	if caChain, ok := s.Data["ca_chain"].([]interface{}); ok {
+		for _, ca := range caChain {
+			if ca, ok := ca.(string); ok {
+				chain += ca + "\n"
+			}
+		}
+	} else if issuing, ok := s.Data["issuing_ca"].(string); ok {
+		chain += issuing + "\n"
+	}
+	return []byte(chain), []byte(key + "\n"), nil
+}
+
+// readKV reads a secret from a KV version 2 secrets engine.
+func (c *client) readKV(mount, path string) (map[string]string, error) {
+	s, err := c.request(http.MethodGet, mount+"/data/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := s.Data["data"].(map[string]interface{})
+	values := make(map[string]string)
+	for k, v := range data {
+		if str, ok := v.(string); ok {
+			values[k] = str
+		}
+	}
+	return values, nil
+}
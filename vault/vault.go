@@ -0,0 +1,345 @@
+/*
+Package vault provides an updater which fetches and renews TLS certificates and htpasswd files from HashiCorp
+Vault, for nginx to load from disk.
+*/
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/util"
+)
+
+const (
+	defaultCertificateKey = "certificate"
+	defaultPrivateKeyKey  = "private_key"
+	htpasswdKey           = "htpasswd"
+)
+
+// Config for the Vault updater.
+type Config struct {
+	// Address of the Vault server, e.g. https://vault:8200.
+	Address string
+	// Token to authenticate with. If empty, the pod's service account is used to log in with KubernetesRole.
+	Token string
+	// KubernetesAuthMount is the mount path of the Kubernetes auth method.
+	KubernetesAuthMount string
+	// KubernetesRole to log in as.
+	KubernetesRole string
+	// PKIMount is the mount path of the PKI secrets engine.
+	PKIMount string
+	// PKIRole issues certificates for ingress hosts. Leave empty to not issue per host certificates.
+	PKIRole string
+	// CertificateTTL requested for issued certificates. Leave as 0 to use the role's default.
+	CertificateTTL time.Duration
+	// KVMount is the mount path of the KV version 2 secrets engine.
+	KVMount string
+	// DefaultCertificatePath is the KV secret holding the default certificate, in its certificate and
+	// private_key fields. Leave empty to use the default certificate on disk.
+	DefaultCertificatePath string
+	// SSLPath is where the default certificate is written, as SSLPath.crt and SSLPath.key.
+	SSLPath string
+	// CertificatesDir is where issued certificates are written, as <host>.crt and <host>.key.
+	CertificatesDir string
+	// HtpasswdPrefix is the KV path with a secret per namespace and name, holding the htpasswd file in its
+	// htpasswd field, for ingresses requiring basic auth. Leave empty to not fetch htpasswd files.
+	HtpasswdPrefix string
+	// HtpasswdDir is where htpasswd files are written, as named by IngressEntry.HtpasswdFile.
+	HtpasswdDir string
+	// RenewBefore is how long before expiry issued certificates are renewed.
+	RenewBefore time.Duration
+	// CheckInterval is how often certificates and the default certificate are checked for changes.
+	CheckInterval time.Duration
+}
+
+// New creates an updater which writes certificates from Vault to disk.
+func New(conf Config) (controller.Updater, error) {
+	if conf.Address == "" {
+		return nil, errors.New("unable to create Vault updater: missing address")
+	}
+	if conf.Token == "" && conf.KubernetesRole == "" {
+		return nil, errors.New("unable to create Vault updater: either a token or Kubernetes role is required")
+	}
+	if conf.PKIRole != "" && conf.CertificatesDir == "" {
+		return nil, errors.New("unable to create Vault updater: missing certificates directory")
+	}
+	if conf.DefaultCertificatePath != "" && conf.SSLPath == "" {
+		return nil, errors.New("unable to create Vault updater: missing ssl path")
+	}
+	if conf.HtpasswdPrefix != "" && conf.HtpasswdDir == "" {
+		return nil, errors.New("unable to create Vault updater: missing htpasswd directory")
+	}
+	initMetrics()
+
+	return &vault{
+		Config:   conf,
+		client:   &client{address: conf.Address, token: conf.Token, httpClient: &http.Client{Timeout: time.Second * 30}},
+		jwtFile:  serviceAccountTokenFile,
+		updateCh: make(chan struct{}, 1),
+		doneCh:   make(chan struct{}),
+	}, nil
+}
+
+type vault struct {
+	Config
+	client   *client
+	jwtFile  string
+	updateCh chan struct{}
+	doneCh   chan struct{}
+	sync.Mutex
+	hosts []string
+	// htpasswds are the KV paths of the htpasswd secrets, by file name
+	htpasswds map[string]string
+}
+
+// Start fetches the default certificate before nginx is first configured, so it doesn't start with a stale one.
+func (v *vault) Start() error {
+	if v.CertificatesDir != "" {
+		if err := os.MkdirAll(v.CertificatesDir, 0700); err != nil {
+			return fmt.Errorf("unable to create %s: %v", v.CertificatesDir, err)
+		}
+	}
+	if v.HtpasswdDir != "" {
+		// readable by the nginx workers, which check the files on each request
+		if err := os.MkdirAll(v.HtpasswdDir, 0755); err != nil {
+			return fmt.Errorf("unable to create %s: %v", v.HtpasswdDir, err)
+		}
+	}
+	if err := v.authenticate(time.Now()); err != nil {
+		return fmt.Errorf("unable to authenticate with Vault: %v", err)
+	}
+	if err := v.updateDefaultCertificate(); err != nil {
+		return fmt.Errorf("unable to fetch default certificate from Vault: %v", err)
+	}
+
+	go v.periodicallyCheckCertificates()
+	return nil
+}
+
+func (v *vault) Stop() error {
+	close(v.doneCh)
+	return nil
+}
+
+func (v *vault) Health() error {
+	return nil
+}
+
+func (v *vault) Readiness() error {
+	return nil
+}
+
+// Update records the hosts needing certificates and the htpasswd secrets, which are fetched in the background.
+func (v *vault) Update(entries controller.IngressEntries) error {
+	if v.PKIRole == "" && v.HtpasswdPrefix == "" {
+		return nil
+	}
+
+	v.Lock()
+	if v.PKIRole != "" {
+		v.hosts = uniqueHosts(entries)
+	}
+	if v.HtpasswdPrefix != "" {
+		v.htpasswds = htpasswdSecrets(entries, v.HtpasswdPrefix)
+	}
+	v.Unlock()
+
+	select {
+	case v.updateCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (v *vault) String() string {
+	return "Vault certificates"
+}
+
+// htpasswdSecrets returns the KV path of each entry's htpasswd secret, which is scoped to its namespace so
+// ingresses can't use another namespace's secrets.
+func htpasswdSecrets(entries controller.IngressEntries, prefix string) map[string]string {
+	secrets := make(map[string]string)
+	for _, entry := range entries {
+		if entry.HtpasswdSecret != "" {
+			secrets[entry.HtpasswdFile()] = strings.TrimSuffix(prefix, "/") + "/" + entry.Namespace + "/" + entry.HtpasswdSecret
+		}
+	}
+	return secrets
+}
+
+func uniqueHosts(entries controller.IngressEntries) []string {
+	unique := make(map[string]bool)
+	for _, entry := range entries {
+		unique[strings.ToLower(entry.Host)] = true
+	}
+
+	var hosts []string
+	for host := range unique {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (v *vault) periodicallyCheckCertificates() {
+	ticker := time.NewTicker(v.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.doneCh:
+			return
+		case <-v.updateCh:
+		case <-ticker.C:
+		}
+		v.checkCertificates(time.Now())
+	}
+}
+
+func (v *vault) checkCertificates(now time.Time) {
+	if err := v.authenticate(now); err != nil {
+		log.Errorf("Unable to authenticate with Vault: %v", err)
+		return
+	}
+
+	if err := v.updateDefaultCertificate(); err != nil {
+		fetchFailures.Inc()
+		log.Errorf("Unable to fetch default certificate from Vault: %v", err)
+	}
+
+	v.Lock()
+	hosts, htpasswds := v.hosts, v.htpasswds
+	v.Unlock()
+
+	if v.HtpasswdPrefix != "" {
+		v.updateHtpasswdFiles(htpasswds)
+	}
+
+	for _, host := range hosts {
+		path := filepath.Join(v.CertificatesDir, certificateName(host))
+		if !util.CertificateExpiresBefore(path+".crt", now.Add(v.RenewBefore)) {
+			continue
+		}
+		if err := v.issueCertificate(host, path); err != nil {
+			fetchFailures.Inc()
+			log.Errorf("Unable to issue certificate for %s from Vault: %v", host, err)
+			continue
+		}
+		certificatesIssued.Inc()
+		log.Infof("Issued certificate for %s from Vault", host)
+	}
+}
+
+// authenticate logs in with the service account when there is no token, or it can no longer be renewed.
+func (v *vault) authenticate(now time.Time) error {
+	if v.KubernetesRole == "" {
+		return nil
+	}
+	if v.client.token != "" && !v.client.tokenExpiring(now) {
+		return nil
+	}
+
+	if v.client.token != "" && v.client.renewable {
+		err := v.client.renewToken(now)
+		if err == nil {
+			return nil
+		}
+		log.Warnf("Unable to renew Vault token, logging in again: %v", err)
+	}
+	return v.client.loginKubernetes(v.KubernetesAuthMount, v.KubernetesRole, v.jwtFile, now)
+}
+
+// updateDefaultCertificate writes the default certificate from KV, if it has changed.
+func (v *vault) updateDefaultCertificate() error {
+	if v.DefaultCertificatePath == "" {
+		return nil
+	}
+
+	values, err := v.client.readKV(v.KVMount, v.DefaultCertificatePath)
+	if err != nil {
+		return err
+	}
+	certificate, key := values[defaultCertificateKey], values[defaultPrivateKeyKey]
+	if certificate == "" || key == "" {
+		return fmt.Errorf("secret %s must contain %s and %s", v.DefaultCertificatePath, defaultCertificateKey, defaultPrivateKeyKey)
+	}
+	return writeIfChanged(v.SSLPath, []byte(certificate), []byte(key))
+}
+
+// updateHtpasswdFiles writes the htpasswd files which have changed, and removes those no longer used. A file is
+// left alone if its secret can't be read, so basic auth fails closed with an error until it's written.
+func (v *vault) updateHtpasswdFiles(htpasswds map[string]string) {
+	for file, path := range htpasswds {
+		values, err := v.client.readKV(v.KVMount, path)
+		if err == nil && values[htpasswdKey] == "" {
+			err = fmt.Errorf("secret %s must contain %s", path, htpasswdKey)
+		}
+		if err != nil {
+			fetchFailures.Inc()
+			log.Errorf("Unable to fetch htpasswd file from Vault: %v", err)
+			continue
+		}
+
+		contents := []byte(values[htpasswdKey])
+		existing, _ := ioutil.ReadFile(filepath.Join(v.HtpasswdDir, file))
+		if string(existing) == string(contents) {
+			continue
+		}
+		// only holds password hashes, and must be readable by the nginx workers
+		if err := util.WriteFileAtomically(filepath.Join(v.HtpasswdDir, file), contents, 0644); err != nil {
+			log.Errorf("Unable to write htpasswd file %s: %v", file, err)
+			continue
+		}
+		log.Infof("Updated htpasswd file %s from Vault", file)
+	}
+
+	existing, err := ioutil.ReadDir(v.HtpasswdDir)
+	if err != nil {
+		log.Warnf("Unable to list htpasswd files: %v", err)
+		return
+	}
+	for _, info := range existing {
+		if _, ok := htpasswds[info.Name()]; !ok && !info.IsDir() {
+			_ = os.Remove(filepath.Join(v.HtpasswdDir, info.Name()))
+		}
+	}
+}
+
+func (v *vault) issueCertificate(host, path string) error {
+	chain, key, err := v.client.issueCertificate(v.PKIMount, v.PKIRole, host, v.CertificateTTL)
+	if err != nil {
+		return err
+	}
+	return writeIfChanged(path, chain, key)
+}
+
+// certificateName avoids writing wildcards into file names.
+func certificateName(host string) string {
+	return strings.Replace(host, "*", "wildcard", 1)
+}
+
+// writeIfChanged writes the certificate and key to path.crt and path.key, leaving them alone if unchanged so
+// nginx isn't reloaded unnecessarily.
+func writeIfChanged(path string, certificate, key []byte) error {
+	existingCertificate, _ := ioutil.ReadFile(path + ".crt")
+	existingKey, _ := ioutil.ReadFile(path + ".key")
+	if string(existingCertificate) == string(certificate) && string(existingKey) == string(key) {
+		return nil
+	}
+
+	// write the key first, as the certificate is only loaded once it has a matching key
+	if err := util.WriteFileAtomically(path+".key", key, 0600); err != nil {
+		return err
+	}
+	return util.WriteFileAtomically(path+".crt", certificate, 0644)
+}
@@ -0,0 +1,21 @@
+package vault
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/util/metrics"
+)
+
+var once sync.Once
+var certificatesIssued prometheus.Counter
+var fetchFailures prometheus.Counter
+
+func initMetrics() {
+	once.Do(func() {
+		certificatesIssued = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"vault_certificates_issued", "The number of certificates issued by Vault")
+		fetchFailures = metrics.RegisterNewDefaultCounter(metrics.PrometheusIngressSubsystem,
+			"vault_failures", "The number of failed attempts to fetch or issue certificates from Vault")
+	})
+}
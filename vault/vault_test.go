@@ -0,0 +1,207 @@
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sky-uk/feed/controller"
+	"github.com/sky-uk/feed/util/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	metrics.SetConstLabels(make(prometheus.Labels))
+}
+
+const vaultToken = "s.token"
+
+type fakeVault struct {
+	*httptest.Server
+	t       *testing.T
+	issued  []string
+	logins  int
+	renewed int
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	f := &fakeVault{t: t}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeVault) handle(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	if r.Method == http.MethodPost {
+		assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&body))
+	}
+
+	if r.URL.Path == "/v1/auth/kubernetes/login" {
+		assert.Equal(f.t, "feed", body["role"])
+		assert.Equal(f.t, "jwt", body["jwt"])
+		f.logins++
+		f.write(w, map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": vaultToken, "lease_duration": 3600, "renewable": true}})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != vaultToken {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/token/renew-self":
+		f.renewed++
+		f.write(w, map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": vaultToken, "lease_duration": 3600, "renewable": true}})
+	case "/v1/pki/issue/ingress":
+		f.issued = append(f.issued, body["common_name"])
+		certificate, key := newCertificate(f.t, body["common_name"])
+		f.write(w, map[string]interface{}{"data": map[string]interface{}{
+			"certificate": certificate, "private_key": key, "ca_chain": []string{"ca"}}})
+	case "/v1/secret/data/feed/htpasswd/core/admins":
+		f.write(w, map[string]interface{}{"data": map[string]interface{}{
+			"data": map[string]interface{}{"htpasswd": "admin:$apr1$hash\n"}}})
+	case "/v1/secret/data/feed/default":
+		certificate, key := newCertificate(f.t, "default")
+		f.write(w, map[string]interface{}{"data": map[string]interface{}{
+			"data": map[string]interface{}{"certificate": certificate, "private_key": key}}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeVault) write(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	assert.NoError(f.t, json.NewEncoder(w).Encode(v))
+}
+
+func newCertificate(t *testing.T, host string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour * 24),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func newVault(t *testing.T, server *fakeVault, dir string) *vault {
+	jwtFile := filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(jwtFile, []byte("jwt\n"), 0600))
+
+	updater, err := New(Config{
+		Address:                server.URL,
+		KubernetesAuthMount:    "kubernetes",
+		KubernetesRole:         "feed",
+		PKIMount:               "pki",
+		PKIRole:                "ingress",
+		KVMount:                "secret",
+		DefaultCertificatePath: "feed/default",
+		SSLPath:                filepath.Join(dir, "default"),
+		CertificatesDir:        filepath.Join(dir, "certs"),
+		HtpasswdPrefix:         "feed/htpasswd",
+		HtpasswdDir:            filepath.Join(dir, "htpasswd"),
+		RenewBefore:            time.Hour,
+		CheckInterval:          time.Hour,
+	})
+	assert.NoError(t, err)
+	v := updater.(*vault)
+	v.jwtFile = jwtFile
+	return v
+}
+
+func TestDefaultCertificateIsFetchedOnStart(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "vault")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	server := newFakeVault(t)
+	defer server.Close()
+
+	v := newVault(t, server, dir)
+	assert.NoError(v.Start())
+	defer v.Stop()
+
+	assert.Equal(1, server.logins)
+	assert.FileExists(filepath.Join(dir, "default.crt"))
+	assert.FileExists(filepath.Join(dir, "default.key"))
+}
+
+func TestCertificatesAreIssuedForHostsAndRenewed(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "vault")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	server := newFakeVault(t)
+	defer server.Close()
+
+	v := newVault(t, server, dir)
+	assert.NoError(v.Start())
+	defer v.Stop()
+	// set directly rather than through Update, so certificates aren't also checked in the background
+	v.hosts = uniqueHosts(controller.IngressEntries{{Host: "foo.com"}, {Host: "*.bar.com"}, {Host: "FOO.com"}})
+
+	now := time.Now()
+	v.checkCertificates(now)
+	assert.Equal([]string{"*.bar.com", "foo.com"}, server.issued)
+	assert.FileExists(filepath.Join(dir, "certs", "foo.com.crt"))
+	assert.FileExists(filepath.Join(dir, "certs", "wildcard.bar.com.key"))
+
+	v.checkCertificates(now)
+	assert.Len(server.issued, 2, "valid certificates shouldn't be reissued")
+
+	v.checkCertificates(now.Add(time.Hour * 23))
+	assert.Len(server.issued, 4, "certificates should be renewed before expiry")
+	assert.Equal(1, server.renewed, "token should be renewed before its lease expires")
+	assert.Equal(1, server.logins)
+}
+
+func TestHtpasswdFilesAreFetchedForTheirNamespace(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir(os.TempDir(), "vault")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	server := newFakeVault(t)
+	defer server.Close()
+
+	v := newVault(t, server, dir)
+	assert.NoError(v.Start())
+	defer v.Stop()
+	stale := filepath.Join(dir, "htpasswd", "core_removed")
+	assert.NoError(ioutil.WriteFile(stale, []byte("old:hash\n"), 0644))
+	v.htpasswds = htpasswdSecrets(controller.IngressEntries{
+		{Namespace: "core", Host: "foo.com", HtpasswdSecret: "admins"},
+		{Namespace: "other", Host: "bar.com", HtpasswdSecret: "admins"},
+		{Namespace: "core", Host: "baz.com"},
+	}, "feed/htpasswd")
+
+	v.checkCertificates(time.Now())
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "htpasswd", "core_admins"))
+	assert.NoError(err)
+	assert.Equal("admin:$apr1$hash\n", string(contents))
+	assert.NoFileExists(filepath.Join(dir, "htpasswd", "other_admins"), "secrets are only read from the ingress's namespace")
+	assert.NoFileExists(stale, "unused htpasswd files should be removed")
+}